@@ -300,7 +300,7 @@ func (c *Chain) pushBlockWithoutCheck(b *pt.Block) error {
 			return
 		}
 		for _, v := range b.Transactions {
-			if err = c.ms.applyTransactionProcedure(v)(tx); err != nil {
+			if err = c.ms.applyTransactionProcedureAt(v, b.Timestamp())(tx); err != nil {
 				return
 			}
 		}
@@ -316,7 +316,23 @@ func (c *Chain) pushBlockWithoutCheck(b *pt.Block) error {
 		c.bi.addBlock(node)
 		return
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	c.registerKeyRotations(b)
+	return nil
+}
+
+// registerKeyRotations registers the rotated keys of a committed block to the local public
+// key store, which is not part of the metaState and could not be rolled back.
+func (c *Chain) registerKeyRotations(b *pt.Block) {
+	for _, v := range b.Transactions {
+		if tx, ok := v.(*pt.KeyRotation); ok {
+			if err := kms.SetKeyRotation(&tx.Rotation); err != nil {
+				log.WithError(err).Warning("set key rotation to public keystore failed")
+			}
+		}
+	}
 }
 
 func (c *Chain) pushGenesisBlock(b *pt.Block) (err error) {
@@ -343,7 +359,7 @@ func (c *Chain) pushBlock(b *pt.Block) error {
 }
 
 func (c *Chain) produceBlock(now time.Time) error {
-	priv, err := kms.GetLocalPrivateKey()
+	priv, err := kms.GetLocalSigner()
 	if err != nil {
 		return err
 	}
@@ -428,8 +444,8 @@ func (c *Chain) produceBilling(br *pt.BillingRequest) (_ *pt.BillingRequest, err
 	}
 
 	// add block producer signature
-	var privKey *asymmetric.PrivateKey
-	privKey, err = kms.GetLocalPrivateKey()
+	var privKey asymmetric.Signer
+	privKey, err = kms.GetLocalSigner()
 	if err != nil {
 		return
 	}
@@ -17,11 +17,12 @@
 package blockproducer
 
 import (
-	"sort"
 	"sync"
 	"time"
 
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/consistent"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
@@ -48,20 +49,23 @@ var (
 	}
 )
 
-type allocatedNode struct {
-	NodeID       proto.NodeID
-	MemoryMetric uint64
-}
-
 // DBService defines block producer database service rpc endpoint.
 type DBService struct {
 	AllocationRounds int
 	ServiceMap       *DBServiceMap
 	Consistent       *consistent.Consistent
 	NodeMetrics      *metric.NodeMetricMap
+	AntiAffinity     AntiAffinity
+	// SyncCheckInterval and SyncTimeout control the state sync polling of the new peers
+	SyncCheckInterval time.Duration
+	SyncTimeout       time.Duration
 
 	// include block producer nodes for database allocation, for test case injection
 	includeBPNodesForAllocation bool
+
+	health  *healthMonitor
+	opsOnce sync.Once
+	ops     *dbOperations
 }
 
 // CreateDatabase defines block producer create database logic.
@@ -71,8 +75,11 @@ func (s *DBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types
 		return
 	}
 
-	// TODO(xq262144): verify identity
-	// verify identity
+	// the signee owns the database, or belongs to the owner policy
+	var owner proto.AccountAddress
+	if owner, err = createDatabaseOwner(&req.Header); err != nil {
+		return
+	}
 
 	defer func() {
 		log.WithFields(log.Fields{
@@ -112,8 +119,8 @@ func (s *DBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types
 	}()
 
 	// call miner nodes to provide service
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var privateKey asymmetric.Signer
+	if privateKey, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 
@@ -147,6 +154,7 @@ func (s *DBService) CreateDatabase(req *types.CreateDatabaseRequest, resp *types
 		Peers:        peers,
 		ResourceMeta: req.Header.ResourceMeta,
 		GenesisBlock: genesisBlock,
+		Owner:        owner,
 	}
 
 	log.WithField("meta", instanceMeta).Debug("generated instance meta")
@@ -173,14 +181,11 @@ func (s *DBService) DropDatabase(req *types.DropDatabaseRequest, resp *types.Dro
 		return
 	}
 
-	// TODO(xq262144): verify identity
-	// verify identity and database belonging
-
 	defer func() {
 		log.WithFields(log.Fields{
 			"db":   req.Header.DatabaseID,
 			"node": req.GetNodeID().String(),
-		}).Debug("drop database")
+		}).WithError(err).Debug("drop database")
 	}()
 
 	// get database peers
@@ -189,6 +194,11 @@ func (s *DBService) DropDatabase(req *types.DropDatabaseRequest, resp *types.Dro
 		return
 	}
 
+	// verify database belonging
+	if err = checkDropDatabaseOwner(instanceMeta, &req.Header); err != nil {
+		return
+	}
+
 	// call miner nodes to drop database
 	dropDBSvcReq := new(types.UpdateService)
 	dropDBSvcReq.Header.Op = types.DropDB
@@ -198,8 +208,8 @@ func (s *DBService) DropDatabase(req *types.DropDatabaseRequest, resp *types.Dro
 	if dropDBSvcReq.Header.Signee, err = kms.GetLocalPublicKey(); err != nil {
 		return
 	}
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var privateKey asymmetric.Signer
+	if privateKey, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 	if dropDBSvcReq.Sign(privateKey); err != nil {
@@ -226,6 +236,118 @@ func (s *DBService) DropDatabase(req *types.DropDatabaseRequest, resp *types.Dro
 	return
 }
 
+// checkDatabaseOwner checks the signee is the database owner or the block producer itself,
+// databases created without owner record can only be updated by the block producer.
+func checkDatabaseOwner(instance types.ServiceInstance, signee *asymmetric.PublicKey) (err error) {
+	if signee == nil {
+		return ErrDatabaseOwnerNotMatch
+	}
+	if kms.BP != nil && kms.BP.PublicKey != nil && kms.BP.PublicKey.IsEqual(signee) {
+		return
+	}
+	var addr proto.AccountAddress
+	if addr, err = crypto.PubKeyHash(signee); err != nil {
+		return
+	}
+	if instance.Owner == (proto.AccountAddress{}) || addr != instance.Owner {
+		err = ErrDatabaseOwnerNotMatch
+	}
+	return
+}
+
+// createDatabaseOwner returns the owner of the database to create: the signee, or the
+// multi-signature account of the owner policy which the signee belongs to.
+func createDatabaseOwner(h *types.SignedCreateDatabaseRequestHeader) (owner proto.AccountAddress, err error) {
+	if h.OwnerPolicy == nil {
+		return crypto.PubKeyHash(h.Signee)
+	}
+	if err = h.OwnerPolicy.Verify(); err != nil {
+		return
+	}
+	for _, k := range h.OwnerPolicy.PublicKeys {
+		if k.IsEqual(h.Signee) {
+			return h.OwnerPolicy.Address()
+		}
+	}
+	err = pt.ErrMultiSigUnknownSignee
+	return
+}
+
+// checkDropDatabaseOwner checks the drop request is signed by the database owner, or by the
+// threshold keys of the multi-signature owner account. The signatures are verified by the
+// request verification.
+func checkDropDatabaseOwner(instance types.ServiceInstance, h *types.SignedDropDatabaseRequestHeader) (err error) {
+	if h.MultiSig == nil {
+		return checkDatabaseOwner(instance, h.Signee)
+	}
+	var addr proto.AccountAddress
+	if addr, err = h.MultiSig.Policy.Address(); err != nil {
+		return
+	}
+	if instance.Owner == (proto.AccountAddress{}) || addr != instance.Owner {
+		err = ErrDatabaseOwnerNotMatch
+	}
+	return
+}
+
+// UpdateDatabase defines block producer update database logic. The peers changes are planned
+// synchronously, the database is deployed to the new peers and the removed peers are drained
+// after the new peers catch up in background.
+func (s *DBService) UpdateDatabase(req *types.UpdateDatabaseRequest, resp *types.UpdateDatabaseResponse) (err error) {
+	// verify signature
+	if err = req.Verify(); err != nil {
+		return
+	}
+
+	defer func() {
+		log.WithFields(log.Fields{
+			"db":    req.Header.DatabaseID,
+			"meta":  req.Header.ResourceMeta,
+			"drain": req.Header.DrainNodes,
+			"node":  req.GetNodeID().String(),
+		}).WithError(err).Debug("update database")
+	}()
+
+	var instance types.ServiceInstance
+	if instance, err = s.ServiceMap.Get(req.Header.DatabaseID); err != nil {
+		return
+	}
+
+	// verify identity and database belonging
+	if err = checkDatabaseOwner(instance, req.Header.Signee); err != nil {
+		return
+	}
+
+	resourceMeta := req.Header.ResourceMeta
+	if resourceMeta.Node == 0 {
+		err = ErrInvalidResourceMeta
+		return
+	}
+	// encryption key can't be changed
+	resourceMeta.EncryptionKey = instance.ResourceMeta.EncryptionKey
+
+	op := &types.DatabaseOperation{
+		DatabaseID: req.Header.DatabaseID,
+		Type:       types.OperationUpdate,
+		State:      types.OperationAllocating,
+	}
+
+	var survivors, newNodes []proto.NodeID
+	if survivors, newNodes, err = s.planUpdate(op, instance, resourceMeta, req.Header.DrainNodes); err != nil {
+		return
+	}
+
+	if err = s.startOperation(op, func(op *types.DatabaseOperation) error {
+		return s.updateDatabase(op, instance, resourceMeta, survivors, newNodes)
+	}); err != nil {
+		return
+	}
+
+	resp.Operation = s.getOperation(op)
+
+	return
+}
+
 // GetDatabase defines block producer get database logic.
 func (s *DBService) GetDatabase(req *types.GetDatabaseRequest, resp *types.GetDatabaseResponse) (err error) {
 	// verify signature
@@ -255,8 +377,8 @@ func (s *DBService) GetDatabase(req *types.GetDatabaseRequest, resp *types.GetDa
 		return
 	}
 
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var privateKey asymmetric.Signer
+	if privateKey, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 
@@ -281,8 +403,8 @@ func (s *DBService) GetNodeDatabases(req *types.InitService, resp *types.InitSer
 
 	// send response to client
 	resp.Header.Instances = instances
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var privateKey asymmetric.Signer
+	if privateKey, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 	err = resp.Sign(privateKey)
@@ -290,6 +412,18 @@ func (s *DBService) GetNodeDatabases(req *types.InitService, resp *types.InitSer
 	return
 }
 
+// PlanDatabase defines block producer dry run database placement logic for capacity planning,
+// nothing is allocated.
+func (s *DBService) PlanDatabase(req *types.PlanDatabaseRequest, resp *types.PlanDatabaseResponse) (err error) {
+	// a random key for the consistent hash neighbors, just like a new database
+	dbID := proto.DatabaseID(hash.THashH([]byte(time.Now().String())).String())
+	if resp.Nodes, resp.Candidates, err = s.placeNodes(dbID, req.ResourceMeta); err == ErrDatabaseAllocation {
+		// no placement is a valid planning result
+		err = nil
+	}
+	return
+}
+
 func (s *DBService) generateDatabaseID(reqNodeID *proto.RawNodeID) (dbID proto.DatabaseID, err error) {
 	var startNonce cpuminer.Uint256
 
@@ -323,9 +457,7 @@ func (s *DBService) generateDatabaseID(reqNodeID *proto.RawNodeID) (dbID proto.D
 }
 
 func (s *DBService) allocateNodes(lastTerm uint64, dbID proto.DatabaseID, resourceMeta types.ResourceMeta) (peers *proto.Peers, err error) {
-	curRange := int(resourceMeta.Node)
-	excludeNodes := make(map[proto.NodeID]bool)
-	var allocated []allocatedNode
+	var allocated []proto.NodeID
 
 	defer func() {
 		log.WithFields(log.Fields{
@@ -335,122 +467,12 @@ func (s *DBService) allocateNodes(lastTerm uint64, dbID proto.DatabaseID, resour
 		}).WithError(err).Debug("try allocated nodes")
 	}()
 
-	if resourceMeta.Node <= 0 {
-		err = ErrDatabaseAllocation
+	if allocated, _, err = s.placeNodes(dbID, resourceMeta); err != nil {
 		return
 	}
 
-	if !s.includeBPNodesForAllocation {
-		// add block producer nodes to exclude node list
-		for _, nodeID := range route.GetBPs() {
-			excludeNodes[nodeID] = true
-		}
-	}
-
-	for i := 0; i != s.AllocationRounds; i++ {
-		log.WithField("round", i).Debug("try allocation node")
-
-		var nodes []proto.Node
-
-		// clear previous allocated
-		allocated = allocated[:0]
-		rolesFilter := []proto.ServerRole{
-			proto.Miner,
-		}
-
-		if s.includeBPNodesForAllocation {
-			rolesFilter = append(rolesFilter, proto.Leader, proto.Follower)
-		}
-
-		nodes, err = s.Consistent.GetNeighborsEx(string(dbID), curRange, proto.ServerRoles(rolesFilter))
-
-		log.WithField("nodeCount", len(nodes)).Debug("found nodes to try dispatch")
-
-		// TODO(xq262144): brute force implementation to be optimized
-		var nodeIDs []proto.NodeID
-
-		for _, node := range nodes {
-			if _, ok := excludeNodes[node.ID]; !ok {
-				nodeIDs = append(nodeIDs, node.ID)
-			}
-		}
-
-		log.WithFields(log.Fields{
-			"nodeCount":  len(nodeIDs),
-			"totalCount": len(nodes),
-			"nodes":      nodeIDs,
-		}).Debug("found nodes to dispatch")
-
-		if len(nodeIDs) < int(resourceMeta.Node) {
-			continue
-		}
-
-		// check node resource status
-		metrics := s.NodeMetrics.GetMetrics(nodeIDs)
-
-		log.WithFields(log.Fields{
-			"recordCount": len(metrics),
-			"nodeCount":   len(nodeIDs),
-		}).Debug("found metric records to dispatch")
-
-		for nodeID, nodeMetric := range metrics {
-			log.WithField("node", nodeID).Debug("parse metric")
-
-			var metricValue uint64
-
-			// get metric
-			if metricValue, err = s.getMetric(nodeMetric, MetricKeyFreeMemory); err != nil {
-				log.WithField("node", nodeID).Debug("get memory metric failed")
-
-				// add to excludes
-				excludeNodes[nodeID] = true
-				continue
-			}
-
-			// TODO(xq262144): left reserved resources check is required
-			// TODO(xq262144): filesystem check to be implemented
-
-			if resourceMeta.Memory < metricValue {
-				// can allocate
-				allocated = append(allocated, allocatedNode{
-					NodeID:       nodeID,
-					MemoryMetric: metricValue,
-				})
-			} else {
-				log.WithFields(log.Fields{
-					"actual":   metricValue,
-					"expected": resourceMeta.Memory,
-					"node":     nodeID,
-				}).Debug("node memory node meets requirement")
-				excludeNodes[nodeID] = true
-			}
-		}
-
-		if len(allocated) >= int(resourceMeta.Node) {
-			// sort allocated node by metric
-			sort.Slice(allocated, func(i, j int) bool {
-				return allocated[i].MemoryMetric > allocated[j].MemoryMetric
-			})
-
-			allocated = allocated[:int(resourceMeta.Node)]
-
-			// build plain allocated slice
-			nodeAllocated := make([]proto.NodeID, 0, len(allocated))
-
-			for _, node := range allocated {
-				nodeAllocated = append(nodeAllocated, node.NodeID)
-			}
-
-			// build peers
-			return s.buildPeers(lastTerm+1, nodeAllocated)
-		}
-
-		curRange += int(resourceMeta.Node)
-	}
-
-	// allocation failed
-	err = ErrDatabaseAllocation
-	return
+	// build peers
+	return s.buildPeers(lastTerm+1, allocated)
 }
 
 func (s *DBService) getMetric(metric metric.MetricMap, keys []string) (value uint64, err error) {
@@ -484,8 +506,8 @@ func (s *DBService) buildPeers(term uint64, allocated []proto.NodeID) (peers *pr
 	}).Debug("build peers for term/nodes")
 
 	// get local private key
-	var privKey *asymmetric.PrivateKey
-	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var privKey asymmetric.Signer
+	if privKey, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 
@@ -509,8 +531,8 @@ func (s *DBService) generateGenesisBlock(dbID proto.DatabaseID, resourceMeta typ
 	// TODO(xq262144): following is stub code, real logic should be implemented in the future
 	emptyHash := hash.Hash{}
 
-	var privKey *asymmetric.PrivateKey
-	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var privKey asymmetric.Signer
+	if privKey, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 	var nodeID proto.NodeID
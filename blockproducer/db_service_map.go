@@ -173,3 +173,36 @@ func (c *DBServiceMap) GetDatabases(nodeID proto.NodeID) (dbs []types.ServiceIns
 
 	return
 }
+
+// GetNodes returns the nodes serving databases.
+func (c *DBServiceMap) GetNodes() (nodes []proto.NodeID) {
+	c.RLock()
+	defer c.RUnlock()
+
+	for nodeID, dbs := range c.nodeMap {
+		if len(dbs) > 0 {
+			nodes = append(nodes, nodeID)
+		}
+	}
+
+	return
+}
+
+// GetReserved returns the resources reserved by the databases on the node.
+func (c *DBServiceMap) GetReserved(nodeID proto.NodeID) (memory uint64, space uint64, count int) {
+	c.RLock()
+	defer c.RUnlock()
+
+	for dbID, ok := range c.nodeMap[nodeID] {
+		if !ok {
+			continue
+		}
+		if db, ok := c.dbMap[dbID]; ok {
+			memory += db.ResourceMeta.Memory
+			space += db.ResourceMeta.Space
+			count++
+		}
+	}
+
+	return
+}
@@ -20,6 +20,8 @@ import (
 	"testing"
 	"time"
 
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/metric"
@@ -176,6 +178,85 @@ func TestService(t *testing.T) {
 	})
 }
 
+func TestDatabaseOwner(t *testing.T) {
+	Convey("test database ownership of single and multi-signature accounts", t, func() {
+		var (
+			privs = make([]*asymmetric.PrivateKey, 3)
+			pubs  = make([]*asymmetric.PublicKey, 3)
+			err   error
+		)
+		for i := range privs {
+			privs[i], pubs[i], err = asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+		}
+		policy, err := pt.NewMultiSigPolicy(2, pubs[:2])
+		So(err, ShouldBeNil)
+		policyAddr, err := policy.Address()
+		So(err, ShouldBeNil)
+		singleAddr, err := crypto.PubKeyHash(pubs[0])
+		So(err, ShouldBeNil)
+
+		// the signee owns the database by default
+		createReq := new(types.CreateDatabaseRequest)
+		So(createReq.Sign(privs[0]), ShouldBeNil)
+		owner, err := createDatabaseOwner(&createReq.Header)
+		So(err, ShouldBeNil)
+		So(owner, ShouldEqual, singleAddr)
+
+		// the owner policy account owns the database if the signee belongs to it
+		createReq.Header.OwnerPolicy = policy
+		So(createReq.Sign(privs[1]), ShouldBeNil)
+		So(createReq.Verify(), ShouldBeNil)
+		owner, err = createDatabaseOwner(&createReq.Header)
+		So(err, ShouldBeNil)
+		So(owner, ShouldEqual, policyAddr)
+		So(createReq.Sign(privs[2]), ShouldBeNil)
+		_, err = createDatabaseOwner(&createReq.Header)
+		So(err, ShouldEqual, pt.ErrMultiSigUnknownSignee)
+
+		instance := types.ServiceInstance{DatabaseID: "db", Owner: policyAddr}
+		s := &DBService{
+			ServiceMap: &DBServiceMap{
+				dbMap:   map[proto.DatabaseID]types.ServiceInstance{"db": instance},
+				nodeMap: make(map[proto.NodeID]map[proto.DatabaseID]bool),
+				persist: &stubDBMetaPersistence{},
+			},
+		}
+
+		// single signed drop of a multi-signature account database
+		dropReq := new(types.DropDatabaseRequest)
+		dropReq.SetNodeID(&proto.RawNodeID{})
+		dropReq.Header.DatabaseID = "db"
+		So(dropReq.Sign(privs[0]), ShouldBeNil)
+		err = s.DropDatabase(dropReq, new(types.DropDatabaseResponse))
+		So(err, ShouldEqual, ErrDatabaseOwnerNotMatch)
+
+		// the drop should be signed by threshold keys of the owner policy
+		dropReq = types.NewMultiSigDropDatabaseRequest(
+			&types.DropDatabaseRequestHeader{DatabaseID: "db"}, policy)
+		dropReq.SetNodeID(&proto.RawNodeID{})
+		So(dropReq.Sign(privs[0]), ShouldBeNil)
+		err = s.DropDatabase(dropReq, new(types.DropDatabaseResponse))
+		So(err, ShouldEqual, pt.ErrMultiSigThreshold)
+		So(dropReq.Sign(privs[1]), ShouldBeNil)
+		So(dropReq.Verify(), ShouldBeNil)
+		So(checkDropDatabaseOwner(instance, &dropReq.Header), ShouldBeNil)
+
+		// tampered after signing
+		dropReq.Header.DatabaseID = "other"
+		So(dropReq.Verify(), ShouldNotBeNil)
+
+		// the multi-signature account doesn't own other databases
+		other, err := pt.NewMultiSigPolicy(1, pubs[2:])
+		So(err, ShouldBeNil)
+		dropReq = types.NewMultiSigDropDatabaseRequest(
+			&types.DropDatabaseRequestHeader{DatabaseID: "db"}, other)
+		So(dropReq.Sign(privs[2]), ShouldBeNil)
+		So(dropReq.Verify(), ShouldBeNil)
+		So(checkDropDatabaseOwner(instance, &dropReq.Header), ShouldEqual, ErrDatabaseOwnerNotMatch)
+	})
+}
+
 func buildQuery(queryType types.QueryType, connID uint64, seqNo uint64, databaseID proto.DatabaseID, queries []string) (query *types.Request, err error) {
 	// get node id
 	var nodeID proto.NodeID
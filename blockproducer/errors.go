@@ -25,6 +25,20 @@ var (
 	ErrDatabaseAllocation = errors.New("allocate database failed")
 	// ErrMetricNotCollected defines errors collected.
 	ErrMetricNotCollected = errors.New("metric not collected")
+	// ErrInvalidAntiAffinity defines invalid anti-affinity config error.
+	ErrInvalidAntiAffinity = errors.New("invalid anti-affinity, should be none, host or subnet")
+	// ErrNoSurvivingPeer defines database repair failure error when all peers are dead.
+	ErrNoSurvivingPeer = errors.New("no surviving peer of database")
+	// ErrInvalidResourceMeta defines invalid database resource meta error.
+	ErrInvalidResourceMeta = errors.New("invalid resource meta, at least one node is required")
+	// ErrNotDatabasePeer defines error when the node to drain is not a peer of the database.
+	ErrNotDatabasePeer = errors.New("node is not a peer of database")
+	// ErrOperationInProgress defines error when another operation of the database is running.
+	ErrOperationInProgress = errors.New("another operation of database is in progress")
+	// ErrServiceStopped defines error when the database service is stopped.
+	ErrServiceStopped = errors.New("database service stopped")
+	// ErrSyncTimeout defines error when the new peers can't catch up in time.
+	ErrSyncTimeout = errors.New("state sync of new peers timeout")
 
 	// Errors on main chain
 
@@ -72,4 +86,12 @@ var (
 	ErrTransactionMismatch = errors.New("transaction mismatch")
 	// ErrMetaStateNotFound indicates that meta state not found in db.
 	ErrMetaStateNotFound = errors.New("meta state not found in db")
+	// ErrInvalidSignee indicates that the transaction is not signed by an accepted account key.
+	ErrInvalidSignee = errors.New("transaction signee is not an accepted account key")
+	// ErrKeyRotationNotMatch indicates that the key rotation doesn't follow the account key.
+	ErrKeyRotationNotMatch = errors.New("key rotation doesn't match the account key")
+	// ErrMultiSigRequired indicates that a multi-signature account transaction is single signed.
+	ErrMultiSigRequired = errors.New("multi-signature account requires multi-signed transaction")
+	// ErrDatabaseOwnerNotMatch indicates that the transaction account is not the database owner.
+	ErrDatabaseOwnerNotMatch = errors.New("database owner not match")
 )
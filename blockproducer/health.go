@@ -0,0 +1,244 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+const (
+	// DefaultHealthCheckInterval defines the default interval to check miner health.
+	DefaultHealthCheckInterval = 10 * time.Second
+)
+
+// healthMonitor records the dead miners.
+type healthMonitor struct {
+	sync.RWMutex
+	deadTimeout time.Duration
+	startTime   time.Time
+	dead        map[proto.NodeID]time.Time
+	stopCh      chan struct{}
+	wg          sync.WaitGroup
+}
+
+// StartHealthMonitor starts to check the miners every interval. A miner is marked dead if it
+// doesn't upload metrics for deadTimeout, the dead peers of the databases served by the miner
+// are replaced by other miners. The miner metrics are local to each block producer, the monitor
+// should run on the leader only.
+func (s *DBService) StartHealthMonitor(deadTimeout time.Duration, interval time.Duration) {
+	s.health = &healthMonitor{
+		deadTimeout: deadTimeout,
+		startTime:   time.Now(),
+		dead:        make(map[proto.NodeID]time.Time),
+		stopCh:      make(chan struct{}),
+	}
+
+	s.health.wg.Add(1)
+	go func() {
+		defer s.health.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.health.stopCh:
+				return
+			case now := <-ticker.C:
+				s.checkHealth(now)
+			}
+		}
+	}()
+}
+
+// StopHealthMonitor stops the health monitor.
+func (s *DBService) StopHealthMonitor() {
+	if s.health == nil {
+		return
+	}
+
+	select {
+	case <-s.health.stopCh:
+	default:
+		close(s.health.stopCh)
+	}
+	s.health.wg.Wait()
+}
+
+func (s *DBService) deadNodes() (nodes []proto.NodeID) {
+	if s.health == nil {
+		return
+	}
+
+	s.health.RLock()
+	defer s.health.RUnlock()
+
+	for nodeID := range s.health.dead {
+		nodes = append(nodes, nodeID)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+
+	return
+}
+
+func (s *DBService) isDead(nodeID proto.NodeID) (dead bool) {
+	if s.health == nil {
+		return
+	}
+
+	s.health.RLock()
+	defer s.health.RUnlock()
+	_, dead = s.health.dead[nodeID]
+
+	return
+}
+
+// checkHealth marks the silent miners dead and starts repairs of the databases served by the
+// dead miners.
+func (s *DBService) checkHealth(now time.Time) {
+	h := s.health
+	nodes := s.ServiceMap.GetNodes()
+
+	h.RLock()
+	for nodeID := range h.dead {
+		nodes = append(nodes, nodeID)
+	}
+	h.RUnlock()
+
+	var deadNodes []proto.NodeID
+
+	for _, nodeID := range nodes {
+		lastSeen, ok := s.NodeMetrics.LastSeen(nodeID)
+		if !ok || lastSeen.Before(h.startTime) {
+			// give the miners not reported yet a full timeout since the monitor started
+			lastSeen = h.startTime
+		}
+		silent := now.Sub(lastSeen) > h.deadTimeout
+
+		h.Lock()
+		_, dead := h.dead[nodeID]
+		if silent && !dead {
+			h.dead[nodeID] = now
+			log.WithFields(log.Fields{
+				"node":     nodeID,
+				"lastSeen": lastSeen,
+			}).Warning("miner is dead")
+		} else if !silent && dead {
+			delete(h.dead, nodeID)
+			log.WithField("node", nodeID).Info("miner is alive again")
+		}
+		h.Unlock()
+
+		if silent {
+			deadNodes = append(deadNodes, nodeID)
+		}
+	}
+
+	for _, nodeID := range deadNodes {
+		instances, _ := s.ServiceMap.GetDatabases(nodeID)
+		for _, instance := range instances {
+			s.startRepair(instance.DatabaseID)
+		}
+	}
+}
+
+// startRepair starts to replace the dead peers of the database, nothing is done if another
+// operation of the database is running.
+func (s *DBService) startRepair(dbID proto.DatabaseID) {
+	instance, err := s.ServiceMap.Get(dbID)
+	if err != nil {
+		return
+	}
+
+	op := &types.DatabaseOperation{
+		DatabaseID: dbID,
+		Type:       types.OperationRepair,
+		State:      types.OperationAllocating,
+	}
+	for _, nodeID := range instance.Peers.Servers {
+		if s.isDead(nodeID) {
+			op.DeadNodes = append(op.DeadNodes, nodeID)
+		}
+	}
+	if len(op.DeadNodes) == 0 {
+		return
+	}
+
+	s.startOperation(op, func(op *types.DatabaseOperation) error {
+		return s.repairDatabase(op, instance)
+	})
+}
+
+// repairDatabase replaces the dead peers of the database. The new peers are deployed first
+// and start to sync state from the leader, the surviving peers are updated with a new term to
+// accept the new peers after that.
+func (s *DBService) repairDatabase(op *types.DatabaseOperation, instance types.ServiceInstance) (err error) {
+	var survivors []proto.NodeID
+	for _, nodeID := range instance.Peers.Servers {
+		if !s.isDead(nodeID) {
+			survivors = append(survivors, nodeID)
+		}
+	}
+	if len(survivors) == 0 {
+		err = ErrNoSurvivingPeer
+		return
+	}
+
+	// allocate replacements
+	var newNodes []proto.NodeID
+	if newNodes, _, err = s.placeReplicas(
+		op.DatabaseID, instance.ResourceMeta, len(op.DeadNodes), instance.Peers.Servers); err != nil {
+		return
+	}
+
+	// keep the leader if it's alive, the first server is chosen as leader
+	servers := make([]proto.NodeID, 0, len(survivors)+len(newNodes))
+	if !s.isDead(instance.Peers.Leader) {
+		servers = append(servers, instance.Peers.Leader)
+	}
+	for _, nodeID := range survivors {
+		if nodeID != instance.Peers.Leader {
+			servers = append(servers, nodeID)
+		}
+	}
+	servers = append(servers, newNodes...)
+
+	newInstance := instance
+	if newInstance.Peers, err = s.buildPeers(instance.Peers.Term+1, servers); err != nil {
+		return
+	}
+
+	s.setPeers(op, newInstance.Peers.Term, newNodes)
+
+	if err = s.addReplicas(op, newInstance, survivors, newNodes); err != nil {
+		return
+	}
+
+	if err = s.waitSynced(op); err != nil {
+		return
+	}
+
+	s.updateOperation(op, types.OperationDone, nil)
+
+	return
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/metric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHealthMonitor(t *testing.T) {
+	Convey("test miner health monitor", t, func() {
+		s := &DBService{
+			ServiceMap: &DBServiceMap{
+				dbMap: map[proto.DatabaseID]types.ServiceInstance{
+					"db": {
+						DatabaseID: "db",
+						Peers: &proto.Peers{
+							PeersHeader: proto.PeersHeader{
+								Term:    1,
+								Leader:  "node1",
+								Servers: []proto.NodeID{"node1", "node2"},
+							},
+						},
+					},
+				},
+				nodeMap: map[proto.NodeID]map[proto.DatabaseID]bool{
+					"node1": {"db": true},
+					"node2": {"db": true},
+				},
+			},
+			NodeMetrics: &metric.NodeMetricMap{},
+		}
+
+		// not started
+		So(s.isDead("node1"), ShouldBeFalse)
+		resp := &types.DatabaseOperationsResponse{}
+		So(s.GetDatabaseOperations(&types.DatabaseOperationsRequest{}, resp), ShouldBeNil)
+		So(resp.DeadNodes, ShouldBeEmpty)
+
+		s.StartHealthMonitor(time.Minute, time.Hour)
+		s.NodeMetrics.Update("node1", metric.MetricMap{})
+
+		s.checkHealth(time.Now())
+		So(s.isDead("node1"), ShouldBeFalse)
+		So(s.isDead("node2"), ShouldBeFalse)
+
+		// all peers are silent, the database can't be repaired
+		s.checkHealth(time.Now().Add(2 * time.Minute))
+		So(s.isDead("node1"), ShouldBeTrue)
+		So(s.isDead("node2"), ShouldBeTrue)
+		s.Stop()
+
+		resp = &types.DatabaseOperationsResponse{}
+		So(s.GetDatabaseOperations(&types.DatabaseOperationsRequest{}, resp), ShouldBeNil)
+		So(resp.DeadNodes, ShouldResemble, []proto.NodeID{"node1", "node2"})
+		So(resp.Operations, ShouldHaveLength, 1)
+		So(resp.Operations[0].DatabaseID, ShouldEqual, "db")
+		So(resp.Operations[0].Type, ShouldEqual, types.OperationRepair)
+		So(resp.Operations[0].State, ShouldEqual, types.OperationFailed)
+		So(resp.Operations[0].Error, ShouldEqual, ErrNoSurvivingPeer.Error())
+		So(resp.Operations[0].DeadNodes, ShouldResemble, []proto.NodeID{"node1", "node2"})
+
+		resp = &types.DatabaseOperationsResponse{}
+		So(s.GetDatabaseOperations(&types.DatabaseOperationsRequest{DatabaseID: "other"}, resp), ShouldBeNil)
+		So(resp.Operations, ShouldBeEmpty)
+
+		// miner comes back
+		s.health.startTime = time.Now().Add(-2 * time.Minute)
+		s.NodeMetrics.Update("node1", metric.MetricMap{})
+		s.checkHealth(time.Now())
+		So(s.isDead("node1"), ShouldBeFalse)
+		So(s.isDead("node2"), ShouldBeTrue)
+	})
+}
@@ -63,6 +63,10 @@ const (
 	TransactionTypeBaseAccount
 	// TransactionTypeCreateDatabase defines database creation transaction type.
 	TransactionTypeCreateDatabase
+	// TransactionTypeKeyRotation defines account key rotation transaction type.
+	TransactionTypeKeyRotation
+	// TransactionTypeDropDatabase defines database drop transaction type.
+	TransactionTypeDropDatabase
 	// TransactionTypeNumber defines transaction types number.
 	TransactionTypeNumber
 )
@@ -87,6 +91,10 @@ func (t TransactionType) String() string {
 		return "BaseAccount"
 	case TransactionTypeCreateDatabase:
 		return "CreateDatabase"
+	case TransactionTypeKeyRotation:
+		return "KeyRotation"
+	case TransactionTypeDropDatabase:
+		return "DropDatabase"
 	default:
 		return "Unknown"
 	}
@@ -99,7 +107,7 @@ type Transaction interface {
 	GetAccountNonce() AccountNonce
 	Hash() hash.Hash
 	GetTransactionType() TransactionType
-	Sign(signer *asymmetric.PrivateKey) error
+	Sign(signer asymmetric.Signer) error
 	Verify() error
 	MarshalHash() ([]byte, error)
 	Msgsize() int
@@ -44,7 +44,7 @@ func (e *TestTransactionEncode) Hash() hash.Hash {
 	return hash.Hash{}
 }
 
-func (e *TestTransactionEncode) Sign(signer *asymmetric.PrivateKey) error {
+func (e *TestTransactionEncode) Sign(signer asymmetric.Signer) error {
 	return nil
 }
 
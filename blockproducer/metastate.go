@@ -19,9 +19,13 @@ package blockproducer
 import (
 	"bytes"
 	"sync"
+	"time"
 
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
@@ -660,6 +664,146 @@ func (s *metaState) increaseNonce(addr proto.AccountAddress) (err error) {
 	return
 }
 
+func (s *metaState) rotateAccountKey(addr proto.AccountAddress, r *kms.KeyRotation) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		src, dst *accountObject
+		ok       bool
+	)
+	if dst, ok = s.dirty.accounts[addr]; !ok {
+		if src, ok = s.readonly.accounts[addr]; !ok {
+			return ErrAccountNotFound
+		}
+		dst = &accountObject{}
+		deepcopier.Copy(&src.Account).To(&dst.Account)
+		s.dirty.accounts[addr] = dst
+	}
+	var current = dst.PublicKey
+	if current == nil {
+		current = r.OriginalKey
+	}
+	if !current.IsEqual(r.OldKey) {
+		return ErrKeyRotationNotMatch
+	}
+	dst.PreviousKey = r.OldKey
+	dst.PreviousKeyExpire = r.Timestamp.Add(r.GracePeriod)
+	dst.PublicKey = r.NewKey
+	return
+}
+
+func (s *metaState) applyKeyRotation(tx *pt.KeyRotation) (err error) {
+	// The new key is registered to the local public key store once the block is
+	// committed, see Chain.registerKeyRotations.
+	return s.rotateAccountKey(tx.Address, &tx.Rotation)
+}
+
+func (s *metaState) setAccountMultiSigPolicy(
+	addr proto.AccountAddress, policy *pt.MultiSigPolicy) (err error,
+) {
+	s.Lock()
+	defer s.Unlock()
+	var (
+		src, dst *accountObject
+		ok       bool
+	)
+	if dst, ok = s.dirty.accounts[addr]; !ok {
+		if src, ok = s.readonly.accounts[addr]; !ok {
+			return ErrAccountNotFound
+		}
+		dst = &accountObject{}
+		deepcopier.Copy(&src.Account).To(&dst.Account)
+		s.dirty.accounts[addr] = dst
+	}
+	if dst.MultiSigPolicy != nil {
+		// The account address is the policy hash, so the policy never changes once set
+		return
+	}
+	dst.MultiSigPolicy = &pt.MultiSigPolicy{}
+	deepcopier.Copy(policy).To(dst.MultiSigPolicy)
+	return
+}
+
+func (s *metaState) applyDropDatabase(tx *pt.DropDatabase) (err error) {
+	o, loaded := s.loadSQLChainObject(tx.DatabaseID)
+	if !loaded {
+		return ErrDatabaseNotFound
+	}
+	if o.Owner != tx.Owner {
+		return ErrDatabaseOwnerNotMatch
+	}
+	s.deleteSQLChainObject(tx.DatabaseID)
+	return
+}
+
+// checkSignee checks that the transaction is signed by an accepted key of its account, or
+// carries the signatures required by its multi-signature account.
+func (s *metaState) checkSignee(t pi.Transaction, now time.Time) (err error) {
+	var (
+		signee = txSignee(t)
+		ms     = txMultiSig(t)
+	)
+	if ms != nil {
+		// Signatures and policy address have been checked by the static verification
+		return
+	}
+	if signee == nil {
+		return
+	}
+	o, loaded := s.loadAccountObject(t.GetAccountAddress())
+	if loaded && o.MultiSigPolicy != nil {
+		return ErrMultiSigRequired
+	}
+	if loaded && o.PublicKey != nil {
+		if !o.IsKeyAccepted(signee, now) {
+			err = ErrInvalidSignee
+		}
+		return
+	}
+	// The account key was never rotated, so the signee should be the key of the owner
+	// address. This also rejects single signed transactions of a multi-signature
+	// address, of which the policy is not set yet.
+	var addr proto.AccountAddress
+	if addr, err = crypto.PubKeyHash(signee); err != nil {
+		return
+	}
+	if addr != t.GetAccountAddress() {
+		err = ErrInvalidSignee
+	}
+	return
+}
+
+// txSignee returns the signee of the transactions signed by the account owner, or nil.
+func txSignee(t pi.Transaction) *asymmetric.PublicKey {
+	switch tx := t.(type) {
+	case *pt.Transfer:
+		return tx.Signee
+	case *pt.CreateDatabase:
+		return tx.Signee
+	case *pt.KeyRotation:
+		return tx.Signee
+	case *pt.DropDatabase:
+		return tx.Signee
+	case *pi.TransactionWrapper:
+		return txSignee(tx.Unwrap())
+	}
+	return nil
+}
+
+// txMultiSig returns the signatures of the transactions signed by a multi-signature account,
+// or nil.
+func txMultiSig(t pi.Transaction) *pt.MultiSig {
+	switch tx := t.(type) {
+	case *pt.Transfer:
+		return tx.MultiSig
+	case *pt.DropDatabase:
+		return tx.MultiSig
+	case *pi.TransactionWrapper:
+		return txMultiSig(tx.Unwrap())
+	}
+	return nil
+}
+
 func (s *metaState) applyBilling(tx *pt.Billing) (err error) {
 	for i, v := range tx.Receivers {
 		// Create empty receiver account if not found
@@ -683,6 +827,10 @@ func (s *metaState) applyTransaction(tx pi.Transaction) (err error) {
 		err = s.applyBilling(t)
 	case *pt.BaseAccount:
 		err = s.storeBaseAccount(t.Address, &accountObject{Account: t.Account})
+	case *pt.KeyRotation:
+		err = s.applyKeyRotation(t)
+	case *pt.DropDatabase:
+		err = s.applyDropDatabase(t)
 	case *pi.TransactionWrapper:
 		// call again using unwrapped transaction
 		err = s.applyTransaction(t.Unwrap())
@@ -692,9 +840,15 @@ func (s *metaState) applyTransaction(tx pi.Transaction) (err error) {
 	return
 }
 
-// applyTransaction tries to apply t to the metaState and push t to the memory pool if and
-// only if it can be applied correctly.
+// applyTransactionProcedure tries to apply t to the metaState at the current time and push t
+// to the memory pool if and only if it can be applied correctly.
 func (s *metaState) applyTransactionProcedure(t pi.Transaction) (_ func(*bolt.Tx) error) {
+	return s.applyTransactionProcedureAt(t, time.Now())
+}
+
+// applyTransactionProcedureAt tries to apply t to the metaState and push t to the memory pool
+// if and only if it can be applied correctly, the account keys are checked at the given time.
+func (s *metaState) applyTransactionProcedureAt(t pi.Transaction, now time.Time) (_ func(*bolt.Tx) error) {
 	var (
 		err     error
 		errPass = func(*bolt.Tx) error {
@@ -748,6 +902,11 @@ func (s *metaState) applyTransactionProcedure(t pi.Transaction) (_ func(*bolt.Tx
 			}).WithError(err).Debug("nonce not match during transaction apply")
 			return
 		}
+		// Check account key
+		if err = s.checkSignee(t, now); err != nil {
+			log.WithError(err).Debug("signee not accepted during transaction apply")
+			return
+		}
 		// Try to put transaction before any state change, will be rolled back later
 		// if transaction doesn't apply
 		tb := tx.Bucket(metaBucket[:]).Bucket(metaTransactionBucket).Bucket(ttype.Bytes())
@@ -760,6 +919,11 @@ func (s *metaState) applyTransactionProcedure(t pi.Transaction) (_ func(*bolt.Tx
 			log.WithError(err).Debug("apply transaction failed")
 			return
 		}
+		if ms := txMultiSig(t); ms != nil {
+			if err = s.setAccountMultiSigPolicy(addr, &ms.Policy); err != nil {
+				return
+			}
+		}
 		if err = s.increaseNonce(addr); err != nil {
 			// FIXME(leventeliu): should not fail here.
 			return
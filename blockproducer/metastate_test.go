@@ -21,9 +21,13 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
 	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	bolt "github.com/coreos/bbolt"
 	. "github.com/smartystreets/goconvey/convey"
@@ -36,8 +40,8 @@ func TestMetaState(t *testing.T) {
 			co      *sqlchainObject
 			bl      uint64
 			loaded  bool
-			addr1   = proto.AccountAddress{0x0, 0x0, 0x0, 0x1}
-			addr2   = proto.AccountAddress{0x0, 0x0, 0x0, 0x2}
+			addr1   = testAddress1
+			addr2   = testAddress2
 			addr3   = proto.AccountAddress{0x0, 0x0, 0x0, 0x3}
 			dbid1   = proto.DatabaseID("db#1")
 			dbid2   = proto.DatabaseID("db#2")
@@ -767,7 +771,11 @@ func TestMetaState(t *testing.T) {
 				}
 			)
 			for _, tx := range txs {
-				err = tx.Sign(testPrivKey)
+				var signer = testPrivKey
+				if tx.GetAccountAddress() == addr2 {
+					signer = testPrivKey2
+				}
+				err = tx.Sign(signer)
 				So(err, ShouldBeNil)
 				err = db.Update(ms.applyTransactionProcedure(tx))
 				So(err, ShouldBeNil)
@@ -843,3 +851,293 @@ func TestMetaState(t *testing.T) {
 		})
 	})
 }
+
+func TestMetaStateKeyRotation(t *testing.T) {
+	Convey("Given a new metaState object with an account", t, func() {
+		var (
+			ms      = newMetaState()
+			fl      = path.Join(testDataDir, t.Name())
+			db, err = bolt.Open(fl, 0600, nil)
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = db.Close()
+			So(err, ShouldBeNil)
+			err = os.Truncate(fl, 0)
+			So(err, ShouldBeNil)
+		})
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta, txbk *bolt.Bucket
+			if meta, err = tx.CreateBucket(metaBucket[:]); err != nil {
+				return
+			}
+			if txbk, err = meta.CreateBucket(metaTransactionBucket); err != nil {
+				return
+			}
+			for i := pi.TransactionType(0); i < pi.TransactionTypeNumber; i++ {
+				if _, err = txbk.CreateBucket(i.Bytes()); err != nil {
+					return
+				}
+			}
+			return
+		})
+		So(err, ShouldBeNil)
+
+		oldPriv, oldPub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		newPriv, newPub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		addr, err := crypto.PubKeyHash(oldPub)
+		So(err, ShouldBeNil)
+		now := time.Now()
+		err = db.Update(ms.applyTransactionProcedure(pt.NewBaseAccount(&pt.Account{
+			Address:           addr,
+			StableCoinBalance: 100,
+		})))
+		So(err, ShouldBeNil)
+
+		rotation := kms.NewKeyRotation(&kms.KeyRotationHeader{
+			OriginalKey: oldPub,
+			OldKey:      oldPub,
+			NewKey:      newPub,
+			Timestamp:   now,
+			GracePeriod: time.Hour,
+		})
+		So(rotation.Sign(oldPriv, newPriv), ShouldBeNil)
+		kr := pt.NewKeyRotation(&pt.KeyRotationHeader{
+			Address:  addr,
+			Nonce:    1,
+			Rotation: *rotation,
+		})
+		transfer := func(nonce pi.AccountNonce, signer asymmetric.Signer) *pt.Transfer {
+			tx := pt.NewTransfer(&pt.TransferHeader{
+				Sender:   addr,
+				Receiver: proto.AccountAddress{0x0, 0x0, 0x0, 0x1},
+				Nonce:    nonce,
+				Amount:   1,
+			})
+			So(tx.Sign(signer), ShouldBeNil)
+			return tx
+		}
+
+		Convey("The key rotation should be signed by the old key", func() {
+			So(kr.Sign(newPriv), ShouldBeNil)
+			So(kr.Verify(), ShouldNotBeNil)
+			err = db.Update(ms.applyTransactionProcedure(kr))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("The key rotation should be applied to the account", func() {
+			So(kr.Sign(oldPriv), ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedureAt(kr, now))
+			So(err, ShouldBeNil)
+			o, loaded := ms.loadAccountObject(addr)
+			So(loaded, ShouldBeTrue)
+			So(o.PublicKey.IsEqual(newPub), ShouldBeTrue)
+			So(o.PreviousKey.IsEqual(oldPub), ShouldBeTrue)
+			So(o.PreviousKeyExpire.Equal(now.Add(time.Hour)), ShouldBeTrue)
+
+			Convey("Both keys should be accepted within the grace period", func() {
+				err = db.Update(ms.applyTransactionProcedureAt(transfer(2, newPriv), now))
+				So(err, ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedureAt(transfer(3, oldPriv), now))
+				So(err, ShouldBeNil)
+			})
+			Convey("Only the new key should be accepted after the grace period", func() {
+				expired := now.Add(2 * time.Hour)
+				err = db.Update(ms.applyTransactionProcedureAt(transfer(2, oldPriv), expired))
+				So(err, ShouldEqual, ErrInvalidSignee)
+				err = db.Update(ms.applyTransactionProcedureAt(transfer(2, newPriv), expired))
+				So(err, ShouldBeNil)
+			})
+			Convey("The same rotation should not be applied twice", func() {
+				again := pt.NewKeyRotation(&pt.KeyRotationHeader{
+					Address:  addr,
+					Nonce:    2,
+					Rotation: *rotation,
+				})
+				So(again.Sign(oldPriv), ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedureAt(again, now))
+				So(err, ShouldEqual, ErrKeyRotationNotMatch)
+			})
+		})
+	})
+}
+
+func TestMetaStateMultiSig(t *testing.T) {
+	Convey("Given a new metaState object with a multi-signature account", t, func() {
+		var (
+			ms      = newMetaState()
+			fl      = path.Join(testDataDir, t.Name())
+			db, err = bolt.Open(fl, 0600, nil)
+		)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = db.Close()
+			So(err, ShouldBeNil)
+			err = os.Truncate(fl, 0)
+			So(err, ShouldBeNil)
+		})
+		err = db.Update(func(tx *bolt.Tx) (err error) {
+			var meta, txbk *bolt.Bucket
+			if meta, err = tx.CreateBucket(metaBucket[:]); err != nil {
+				return
+			}
+			if txbk, err = meta.CreateBucket(metaTransactionBucket); err != nil {
+				return
+			}
+			for i := pi.TransactionType(0); i < pi.TransactionTypeNumber; i++ {
+				if _, err = txbk.CreateBucket(i.Bytes()); err != nil {
+					return
+				}
+			}
+			return
+		})
+		So(err, ShouldBeNil)
+
+		var (
+			privs = make([]*asymmetric.PrivateKey, 3)
+			pubs  = make([]*asymmetric.PublicKey, 3)
+		)
+		for i := range privs {
+			privs[i], pubs[i], err = asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+		}
+		policy, err := pt.NewMultiSigPolicy(2, pubs)
+		So(err, ShouldBeNil)
+		addr, err := policy.Address()
+		So(err, ShouldBeNil)
+		err = db.Update(ms.applyTransactionProcedure(pt.NewBaseAccount(&pt.Account{
+			Address:           addr,
+			StableCoinBalance: 100,
+		})))
+		So(err, ShouldBeNil)
+		dbID := proto.DatabaseID("db")
+		So(ms.createSQLChain(addr, dbID), ShouldBeNil)
+
+		receiver := proto.AccountAddress{0x0, 0x0, 0x0, 0x1}
+		transfer := func(nonce pi.AccountNonce, signers ...*asymmetric.PrivateKey) *pt.Transfer {
+			tx := pt.NewMultiSigTransfer(&pt.TransferHeader{
+				Sender:   addr,
+				Receiver: receiver,
+				Nonce:    nonce,
+				Amount:   1,
+			}, policy)
+			for _, v := range signers {
+				So(tx.Sign(v), ShouldBeNil)
+			}
+			return tx
+		}
+
+		Convey("The transfer should be signed by threshold keys", func() {
+			err = db.Update(ms.applyTransactionProcedure(transfer(1, privs[0])))
+			So(err, ShouldEqual, pt.ErrMultiSigThreshold)
+			err = db.Update(ms.applyTransactionProcedure(transfer(1, privs[0], privs[2])))
+			So(err, ShouldBeNil)
+			b, loaded := ms.loadAccountStableBalance(receiver)
+			So(loaded, ShouldBeTrue)
+			So(b, ShouldEqual, 1)
+			o, loaded := ms.loadAccountObject(addr)
+			So(loaded, ShouldBeTrue)
+			So(o.MultiSigPolicy, ShouldNotBeNil)
+			So(o.MultiSigPolicy.Threshold, ShouldEqual, 2)
+
+			Convey("Single signed transactions should be rejected afterwards", func() {
+				tx := pt.NewTransfer(&pt.TransferHeader{
+					Sender:   addr,
+					Receiver: receiver,
+					Nonce:    2,
+					Amount:   1,
+				})
+				So(tx.Sign(privs[0]), ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(tx))
+				So(err, ShouldEqual, ErrMultiSigRequired)
+			})
+			Convey("The database should be dropped by the owner", func() {
+				dd := pt.NewMultiSigDropDatabase(&pt.DropDatabaseHeader{
+					Owner:      addr,
+					Nonce:      2,
+					DatabaseID: dbID,
+				}, policy)
+				So(dd.Sign(privs[1]), ShouldBeNil)
+				So(dd.Sign(privs[2]), ShouldBeNil)
+				err = db.Update(ms.applyTransactionProcedure(dd))
+				So(err, ShouldBeNil)
+				_, loaded := ms.loadSQLChainObject(dbID)
+				So(loaded, ShouldBeFalse)
+			})
+		})
+		Convey("The database should not be dropped by others", func() {
+			priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			other, err := crypto.PubKeyHash(pub)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(pt.NewBaseAccount(&pt.Account{
+				Address: other,
+			})))
+			So(err, ShouldBeNil)
+			dd := pt.NewDropDatabase(&pt.DropDatabaseHeader{
+				Owner:      other,
+				Nonce:      1,
+				DatabaseID: dbID,
+			})
+			So(dd.Sign(priv), ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(dd))
+			So(err, ShouldEqual, ErrDatabaseOwnerNotMatch)
+		})
+		Convey("The transfer should not be signed by a single key before the policy is set", func() {
+			tx := pt.NewTransfer(&pt.TransferHeader{
+				Sender:   addr,
+				Receiver: receiver,
+				Nonce:    1,
+				Amount:   1,
+			})
+			So(tx.Sign(privs[0]), ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(tx))
+			So(err, ShouldEqual, ErrInvalidSignee)
+			b, loaded := ms.loadAccountStableBalance(addr)
+			So(loaded, ShouldBeTrue)
+			So(b, ShouldEqual, 100)
+		})
+		Convey("The database should not be dropped by a single signature before the policy is set", func() {
+			dd := pt.NewDropDatabase(&pt.DropDatabaseHeader{
+				Owner:      addr,
+				Nonce:      1,
+				DatabaseID: dbID,
+			})
+			So(dd.Sign(privs[0]), ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(dd))
+			So(err, ShouldEqual, ErrInvalidSignee)
+			_, loaded := ms.loadSQLChainObject(dbID)
+			So(loaded, ShouldBeTrue)
+		})
+		Convey("The database should only be dropped with the owner signature", func() {
+			priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			owner, err := crypto.PubKeyHash(pub)
+			So(err, ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(pt.NewBaseAccount(&pt.Account{
+				Address: owner,
+			})))
+			So(err, ShouldBeNil)
+			ownerDB := proto.DatabaseID("owner-db")
+			So(ms.createSQLChain(owner, ownerDB), ShouldBeNil)
+
+			dd := pt.NewDropDatabase(&pt.DropDatabaseHeader{
+				Owner:      owner,
+				Nonce:      1,
+				DatabaseID: ownerDB,
+			})
+			So(dd.Sign(privs[0]), ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(dd))
+			So(err, ShouldEqual, ErrInvalidSignee)
+			_, loaded := ms.loadSQLChainObject(ownerDB)
+			So(loaded, ShouldBeTrue)
+
+			So(dd.Sign(priv), ShouldBeNil)
+			err = db.Update(ms.applyTransactionProcedure(dd))
+			So(err, ShouldBeNil)
+			_, loaded = ms.loadSQLChainObject(ownerDB)
+			So(loaded, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,504 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+const (
+	// DefaultSyncCheckInterval defines the default interval to poll the state sync progress of
+	// the new peers.
+	DefaultSyncCheckInterval = 5 * time.Second
+	// DefaultSyncTimeout defines the default max duration for the new peers to catch up.
+	DefaultSyncTimeout = time.Hour
+)
+
+// dbOperations records the progress of the operations changing the database peers, at most one
+// operation runs for each database.
+type dbOperations struct {
+	sync.RWMutex
+	ops    map[proto.DatabaseID]*types.DatabaseOperation
+	active map[proto.DatabaseID]bool
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+func (s *DBService) operations() *dbOperations {
+	s.opsOnce.Do(func() {
+		s.ops = &dbOperations{
+			ops:    make(map[proto.DatabaseID]*types.DatabaseOperation),
+			active: make(map[proto.DatabaseID]bool),
+			stopCh: make(chan struct{}),
+		}
+	})
+	return s.ops
+}
+
+// Stop stops the health monitor and waits for the running database operations.
+func (s *DBService) Stop() {
+	s.StopHealthMonitor()
+
+	ops := s.operations()
+	ops.Lock()
+	select {
+	case <-ops.stopCh:
+	default:
+		close(ops.stopCh)
+	}
+	ops.Unlock()
+	ops.wg.Wait()
+}
+
+// GetDatabaseOperations defines block producer get database operations logic.
+func (s *DBService) GetDatabaseOperations(
+	req *types.DatabaseOperationsRequest, resp *types.DatabaseOperationsResponse) (err error) {
+	resp.DeadNodes = s.deadNodes()
+
+	ops := s.operations()
+	ops.RLock()
+	defer ops.RUnlock()
+
+	for dbID, op := range ops.ops {
+		if req.DatabaseID == "" || req.DatabaseID == dbID {
+			resp.Operations = append(resp.Operations, copyOperation(op))
+		}
+	}
+
+	sort.Slice(resp.Operations, func(i, j int) bool {
+		return resp.Operations[i].DatabaseID < resp.Operations[j].DatabaseID
+	})
+
+	return
+}
+
+// startOperation records the operation and runs it in background, the operation is marked
+// failed if run returns error.
+func (s *DBService) startOperation(
+	op *types.DatabaseOperation, run func(op *types.DatabaseOperation) error) (err error) {
+	ops := s.operations()
+
+	ops.Lock()
+	defer ops.Unlock()
+
+	if ops.active[op.DatabaseID] {
+		return ErrOperationInProgress
+	}
+	select {
+	case <-ops.stopCh:
+		return ErrServiceStopped
+	default:
+	}
+
+	op.StartTime = time.Now()
+	op.UpdateTime = op.StartTime
+	ops.ops[op.DatabaseID] = op
+	ops.active[op.DatabaseID] = true
+	ops.wg.Add(1)
+
+	go func() {
+		var err error
+
+		defer func() {
+			if err != nil {
+				s.updateOperation(op, types.OperationFailed, err)
+			}
+
+			ops.Lock()
+			delete(ops.active, op.DatabaseID)
+			log.WithFields(log.Fields{
+				"db":    op.DatabaseID,
+				"type":  op.Type.String(),
+				"dead":  op.DeadNodes,
+				"new":   op.NewNodes,
+				"drain": op.DrainNodes,
+				"term":  op.Term,
+				"state": op.State.String(),
+			}).WithError(err).Info("database operation finished")
+			ops.Unlock()
+
+			ops.wg.Done()
+		}()
+
+		err = run(op)
+	}()
+
+	return
+}
+
+func (s *DBService) updateOperation(op *types.DatabaseOperation, state types.OperationState, err error) {
+	ops := s.operations()
+	ops.Lock()
+	defer ops.Unlock()
+
+	op.State = state
+	op.UpdateTime = time.Now()
+	if err != nil {
+		op.Error = err.Error()
+	}
+}
+
+func (s *DBService) getOperation(op *types.DatabaseOperation) (o types.DatabaseOperation) {
+	ops := s.operations()
+	ops.RLock()
+	defer ops.RUnlock()
+	return copyOperation(op)
+}
+
+func (s *DBService) setPeers(op *types.DatabaseOperation, term uint64, newNodes []proto.NodeID) {
+	ops := s.operations()
+	ops.Lock()
+	defer ops.Unlock()
+
+	op.Term = term
+	for _, nodeID := range newNodes {
+		op.NewNodes = append(op.NewNodes, types.ReplicaProgress{NodeID: nodeID})
+	}
+}
+
+func copyOperation(op *types.DatabaseOperation) (o types.DatabaseOperation) {
+	o = *op
+	o.DeadNodes = append([]proto.NodeID(nil), op.DeadNodes...)
+	o.NewNodes = append([]types.ReplicaProgress(nil), op.NewNodes...)
+	o.DrainNodes = append([]proto.NodeID(nil), op.DrainNodes...)
+	return
+}
+
+// planUpdate chooses the peers to keep, drain and add for the new resource meta. The peers are
+// kept in order with the leader first, the dead peers and the peers without enough resources for
+// the new resource meta are removed.
+func (s *DBService) planUpdate(
+	op *types.DatabaseOperation, instance types.ServiceInstance, resourceMeta types.ResourceMeta,
+	drainNodes []proto.NodeID,
+) (survivors, newNodes []proto.NodeID, err error) {
+	drain := make(map[proto.NodeID]bool)
+	for _, nodeID := range drainNodes {
+		if _, found := instance.Peers.Find(nodeID); !found {
+			err = ErrNotDatabasePeer
+			return
+		}
+		drain[nodeID] = true
+	}
+
+	for _, nodeID := range leaderFirst(instance.Peers) {
+		switch {
+		case s.isDead(nodeID):
+			op.DeadNodes = append(op.DeadNodes, nodeID)
+		case drain[nodeID], len(survivors) >= int(resourceMeta.Node),
+			s.checkGrowth(nodeID, instance.ResourceMeta, resourceMeta) != "":
+			op.DrainNodes = append(op.DrainNodes, nodeID)
+		default:
+			survivors = append(survivors, nodeID)
+		}
+	}
+	if len(survivors) == 0 {
+		err = ErrNoSurvivingPeer
+		return
+	}
+
+	if count := int(resourceMeta.Node) - len(survivors); count > 0 {
+		if newNodes, _, err = s.placeReplicas(
+			op.DatabaseID, resourceMeta, count, instance.Peers.Servers); err != nil {
+			return
+		}
+	}
+
+	for _, nodeID := range newNodes {
+		op.NewNodes = append(op.NewNodes, types.ReplicaProgress{NodeID: nodeID})
+	}
+
+	return
+}
+
+// checkGrowth checks whether the peer has enough resources for the increased memory and space
+// requirement, returns the reason if it doesn't. Peers without collected metrics are kept.
+func (s *DBService) checkGrowth(
+	nodeID proto.NodeID, oldMeta, newMeta types.ResourceMeta) (reason string) {
+	var growth types.ResourceMeta
+	if newMeta.Memory > oldMeta.Memory {
+		growth.Memory = newMeta.Memory - oldMeta.Memory
+	}
+	if newMeta.Space > oldMeta.Space {
+		growth.Space = newMeta.Space - oldMeta.Space
+	}
+	if growth.Memory == 0 && growth.Space == 0 {
+		return
+	}
+
+	node, err := s.Consistent.GetNode(string(nodeID))
+	if err != nil {
+		return
+	}
+	nodeMetric, ok := s.NodeMetrics.GetMetrics([]proto.NodeID{nodeID})[nodeID]
+	if !ok {
+		return
+	}
+
+	return s.nodeResource(node, nodeMetric, growth).Reason
+}
+
+// updateDatabase moves the database to the planned peers. The new peers join the current peers
+// and catch up with the leader first, the removed peers are dropped only after that.
+func (s *DBService) updateDatabase(
+	op *types.DatabaseOperation, instance types.ServiceInstance, resourceMeta types.ResourceMeta,
+	survivors, newNodes []proto.NodeID,
+) (err error) {
+	dead := make(map[proto.NodeID]bool)
+	for _, nodeID := range op.DeadNodes {
+		dead[nodeID] = true
+	}
+	var existing []proto.NodeID
+	for _, nodeID := range leaderFirst(instance.Peers) {
+		if !dead[nodeID] {
+			existing = append(existing, nodeID)
+		}
+	}
+
+	term := instance.Peers.Term
+
+	if len(newNodes) > 0 {
+		// join the new peers to the current peers
+		joined := instance
+		if joined.Peers, err = s.buildPeers(
+			term+1, append(append([]proto.NodeID{}, existing...), newNodes...)); err != nil {
+			return
+		}
+		term = joined.Peers.Term
+		s.setPeers(op, term, nil)
+
+		if err = s.addReplicas(op, joined, existing, newNodes); err != nil {
+			return
+		}
+
+		if err = s.waitSynced(op); err != nil {
+			return
+		}
+	}
+
+	// apply the final peers and resource meta
+	updated := instance
+	updated.ResourceMeta = resourceMeta
+	servers := append(append([]proto.NodeID{}, survivors...), newNodes...)
+	if updated.Peers, err = s.buildPeers(term+1, servers); err != nil {
+		return
+	}
+	s.setPeers(op, updated.Peers.Term, nil)
+	s.updateOperation(op, types.OperationUpdating, nil)
+
+	if err = s.updatePeers(updated, servers); err != nil {
+		return
+	}
+
+	if len(op.DrainNodes) > 0 {
+		s.updateOperation(op, types.OperationDraining, nil)
+		if dropErr := s.dropReplicas(op.DatabaseID, op.DrainNodes); dropErr != nil {
+			// the drained peers are not serving the database any more
+			log.WithFields(log.Fields{
+				"db":    op.DatabaseID,
+				"drain": op.DrainNodes,
+			}).WithError(dropErr).Warning("drop database on drained peers failed")
+		}
+	}
+
+	s.updateOperation(op, types.OperationDone, nil)
+
+	return
+}
+
+// dropReplicas drops the database on the removed peers.
+func (s *DBService) dropReplicas(dbID proto.DatabaseID, nodes []proto.NodeID) (err error) {
+	var privateKey asymmetric.Signer
+	if privateKey, err = kms.GetLocalSigner(); err != nil {
+		return
+	}
+
+	dropReq := new(types.UpdateService)
+	dropReq.Header.Op = types.DropDB
+	dropReq.Header.Instance = types.ServiceInstance{
+		DatabaseID: dbID,
+	}
+	if err = dropReq.Sign(privateKey); err != nil {
+		return
+	}
+
+	return s.batchSendSingleSvcReq(dropReq, nodes)
+}
+
+// addReplicas deploys the database to the new peers and updates the existing peers to accept
+// them, the new peers start to sync state from the leader.
+func (s *DBService) addReplicas(
+	op *types.DatabaseOperation, instance types.ServiceInstance, existing, newNodes []proto.NodeID,
+) (err error) {
+	var privateKey asymmetric.Signer
+	if privateKey, err = kms.GetLocalSigner(); err != nil {
+		return
+	}
+
+	s.updateOperation(op, types.OperationDeploying, nil)
+
+	replicateReq := new(types.UpdateService)
+	replicateReq.Header.Op = types.ReplicateDB
+	replicateReq.Header.Instance = instance
+	if err = replicateReq.Sign(privateKey); err != nil {
+		return
+	}
+
+	rollbackReq := new(types.UpdateService)
+	rollbackReq.Header.Op = types.DropDB
+	rollbackReq.Header.Instance = types.ServiceInstance{
+		DatabaseID: instance.DatabaseID,
+	}
+	if err = rollbackReq.Sign(privateKey); err != nil {
+		return
+	}
+
+	if err = s.batchSendSvcReq(replicateReq, rollbackReq, newNodes); err != nil {
+		return
+	}
+
+	s.updateOperation(op, types.OperationUpdating, nil)
+
+	if err = s.updatePeers(instance, existing); err != nil {
+		s.batchSendSingleSvcReq(rollbackReq, newNodes)
+		return
+	}
+
+	return
+}
+
+// updatePeers sends the new peers and resource meta to the database peers and saves them to the
+// service map.
+func (s *DBService) updatePeers(instance types.ServiceInstance, nodes []proto.NodeID) (err error) {
+	var privateKey asymmetric.Signer
+	if privateKey, err = kms.GetLocalSigner(); err != nil {
+		return
+	}
+
+	updateReq := new(types.UpdateService)
+	updateReq.Header.Op = types.UpdateDB
+	updateReq.Header.Instance = instance
+	if err = updateReq.Sign(privateKey); err != nil {
+		return
+	}
+
+	if err = s.batchSendSingleSvcReq(updateReq, nodes); err != nil {
+		return
+	}
+
+	if err = s.ServiceMap.Set(instance); err != nil {
+		// critical error
+		// TODO(xq262144): critical error recover
+		return
+	}
+
+	return
+}
+
+// waitSynced polls the state sync progress of the new peers until all of them catch up with the
+// leader.
+func (s *DBService) waitSynced(op *types.DatabaseOperation) (err error) {
+	s.updateOperation(op, types.OperationSyncing, nil)
+
+	ops := s.operations()
+	timeout := time.After(s.syncTimeout())
+	ticker := time.NewTicker(s.syncCheckInterval())
+	defer ticker.Stop()
+
+	for {
+		if s.pollSyncStatus(op) {
+			return
+		}
+
+		select {
+		case <-ops.stopCh:
+			return ErrServiceStopped
+		case <-timeout:
+			return ErrSyncTimeout
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollSyncStatus queries the state sync progress of the new peers, returns true if all of them
+// are synced.
+func (s *DBService) pollSyncStatus(op *types.DatabaseOperation) (synced bool) {
+	ops := s.operations()
+	snapshot := s.getOperation(op)
+	synced = true
+
+	for i, p := range snapshot.NewNodes {
+		if p.Synced {
+			continue
+		}
+
+		req := &types.SyncStatusRequest{DatabaseID: op.DatabaseID}
+		resp := &types.SyncStatusResponse{}
+		err := rpc.NewCaller().CallNode(p.NodeID, route.DBSSyncStatus.String(), req, resp)
+
+		ops.Lock()
+		if err == nil {
+			op.NewNodes[i].Index = resp.Index
+			op.NewNodes[i].Synced = !resp.Syncing
+			op.Error = resp.Error
+		} else {
+			op.Error = err.Error()
+		}
+		op.UpdateTime = time.Now()
+		synced = synced && op.NewNodes[i].Synced
+		ops.Unlock()
+	}
+
+	return
+}
+
+func (s *DBService) syncCheckInterval() time.Duration {
+	if s.SyncCheckInterval > 0 {
+		return s.SyncCheckInterval
+	}
+	return DefaultSyncCheckInterval
+}
+
+func (s *DBService) syncTimeout() time.Duration {
+	if s.SyncTimeout > 0 {
+		return s.SyncTimeout
+	}
+	return DefaultSyncTimeout
+}
+
+// leaderFirst returns the servers of peers with the leader first.
+func leaderFirst(peers *proto.Peers) (servers []proto.NodeID) {
+	servers = make([]proto.NodeID, 0, len(peers.Servers))
+	if _, found := peers.Find(peers.Leader); found {
+		servers = append(servers, peers.Leader)
+	}
+	for _, nodeID := range peers.Servers {
+		if nodeID != peers.Leader {
+			servers = append(servers, nodeID)
+		}
+	}
+	return
+}
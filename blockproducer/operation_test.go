@@ -0,0 +1,185 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/metric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPlanUpdate(t *testing.T) {
+	Convey("test database update planning", t, func() {
+		s := &DBService{
+			NodeMetrics: &metric.NodeMetricMap{},
+		}
+		instance := types.ServiceInstance{
+			DatabaseID: "db",
+			Peers: &proto.Peers{
+				PeersHeader: proto.PeersHeader{
+					Term:    1,
+					Leader:  "node2",
+					Servers: []proto.NodeID{"node1", "node2", "node3"},
+				},
+			},
+			ResourceMeta: types.ResourceMeta{Node: 3},
+		}
+		So(leaderFirst(instance.Peers), ShouldResemble, []proto.NodeID{"node2", "node1", "node3"})
+
+		// decrease peers, the leader is kept
+		op := &types.DatabaseOperation{DatabaseID: "db"}
+		survivors, newNodes, err := s.planUpdate(op, instance, types.ResourceMeta{Node: 2}, nil)
+		So(err, ShouldBeNil)
+		So(survivors, ShouldResemble, []proto.NodeID{"node2", "node1"})
+		So(newNodes, ShouldBeEmpty)
+		So(op.DrainNodes, ShouldResemble, []proto.NodeID{"node3"})
+
+		// drain the leader
+		op = &types.DatabaseOperation{DatabaseID: "db"}
+		survivors, newNodes, err = s.planUpdate(
+			op, instance, types.ResourceMeta{Node: 2}, []proto.NodeID{"node2"})
+		So(err, ShouldBeNil)
+		So(survivors, ShouldResemble, []proto.NodeID{"node1", "node3"})
+		So(newNodes, ShouldBeEmpty)
+		So(op.DrainNodes, ShouldResemble, []proto.NodeID{"node2"})
+
+		// drain a node not serving the database
+		op = &types.DatabaseOperation{DatabaseID: "db"}
+		_, _, err = s.planUpdate(op, instance, types.ResourceMeta{Node: 2}, []proto.NodeID{"node4"})
+		So(err, ShouldEqual, ErrNotDatabasePeer)
+
+		// drain all the peers
+		op = &types.DatabaseOperation{DatabaseID: "db"}
+		_, _, err = s.planUpdate(op, instance, types.ResourceMeta{Node: 3}, instance.Peers.Servers)
+		So(err, ShouldEqual, ErrNoSurvivingPeer)
+
+		// dead peers are removed
+		s.StartHealthMonitor(time.Minute, time.Hour)
+		defer s.Stop()
+		s.health.dead["node1"] = time.Now()
+		op = &types.DatabaseOperation{DatabaseID: "db"}
+		survivors, newNodes, err = s.planUpdate(op, instance, types.ResourceMeta{Node: 1}, nil)
+		So(err, ShouldBeNil)
+		So(survivors, ShouldResemble, []proto.NodeID{"node2"})
+		So(newNodes, ShouldBeEmpty)
+		So(op.DeadNodes, ShouldResemble, []proto.NodeID{"node1"})
+		So(op.DrainNodes, ShouldResemble, []proto.NodeID{"node3"})
+
+		// no resource growth, the peers are kept without metrics
+		So(s.checkGrowth("node1", instance.ResourceMeta, types.ResourceMeta{Node: 1}), ShouldBeEmpty)
+	})
+}
+
+func TestStartOperation(t *testing.T) {
+	Convey("test database operation tracking", t, func() {
+		s := &DBService{}
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		op := &types.DatabaseOperation{DatabaseID: "db", Type: types.OperationUpdate}
+		err := s.startOperation(op, func(op *types.DatabaseOperation) error {
+			s.updateOperation(op, types.OperationSyncing, nil)
+			close(started)
+			<-release
+			return errors.New("sync failed")
+		})
+		So(err, ShouldBeNil)
+		<-started
+
+		// one operation at a time
+		err = s.startOperation(&types.DatabaseOperation{DatabaseID: "db"},
+			func(op *types.DatabaseOperation) error { return nil })
+		So(err, ShouldEqual, ErrOperationInProgress)
+
+		resp := &types.DatabaseOperationsResponse{}
+		So(s.GetDatabaseOperations(&types.DatabaseOperationsRequest{DatabaseID: "db"}, resp), ShouldBeNil)
+		So(resp.DeadNodes, ShouldBeEmpty)
+		So(resp.Operations, ShouldHaveLength, 1)
+		So(resp.Operations[0].State, ShouldEqual, types.OperationSyncing)
+
+		close(release)
+		s.Stop()
+
+		resp = &types.DatabaseOperationsResponse{}
+		So(s.GetDatabaseOperations(&types.DatabaseOperationsRequest{}, resp), ShouldBeNil)
+		So(resp.Operations, ShouldHaveLength, 1)
+		So(resp.Operations[0].State, ShouldEqual, types.OperationFailed)
+		So(resp.Operations[0].Error, ShouldEqual, "sync failed")
+
+		// stopped
+		err = s.startOperation(&types.DatabaseOperation{DatabaseID: "db"},
+			func(op *types.DatabaseOperation) error { return nil })
+		So(err, ShouldEqual, ErrServiceStopped)
+	})
+}
+
+func TestUpdateDatabaseOwner(t *testing.T) {
+	Convey("test update database ownership check", t, func() {
+		ownerPriv, ownerPub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		otherPriv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		owner, err := crypto.PubKeyHash(ownerPub)
+		So(err, ShouldBeNil)
+
+		s := &DBService{
+			ServiceMap: &DBServiceMap{
+				dbMap: map[proto.DatabaseID]types.ServiceInstance{
+					"db": {
+						DatabaseID: "db",
+						Peers: &proto.Peers{
+							PeersHeader: proto.PeersHeader{
+								Leader:  "node1",
+								Servers: []proto.NodeID{"node1"},
+							},
+						},
+						ResourceMeta: types.ResourceMeta{Node: 1},
+						Owner:        owner,
+					},
+				},
+				nodeMap: make(map[proto.NodeID]map[proto.DatabaseID]bool),
+				persist: &stubDBMetaPersistence{},
+			},
+			NodeMetrics: &metric.NodeMetricMap{},
+		}
+
+		// signed by other account
+		req := new(types.UpdateDatabaseRequest)
+		req.SetNodeID(&proto.RawNodeID{})
+		req.Header.DatabaseID = "db"
+		req.Header.ResourceMeta = types.ResourceMeta{Node: 2}
+		req.Header.DrainNodes = []proto.NodeID{"node1"}
+		So(req.Sign(otherPriv), ShouldBeNil)
+		err = s.UpdateDatabase(req, new(types.UpdateDatabaseResponse))
+		So(err, ShouldEqual, ErrDatabaseOwnerNotMatch)
+
+		// signed by owner, fails on resource meta after the ownership check
+		req = new(types.UpdateDatabaseRequest)
+		req.SetNodeID(&proto.RawNodeID{})
+		req.Header.DatabaseID = "db"
+		So(req.Sign(ownerPriv), ShouldBeNil)
+		err = s.UpdateDatabase(req, new(types.UpdateDatabaseResponse))
+		So(err, ShouldEqual, ErrInvalidResourceMeta)
+	})
+}
@@ -0,0 +1,323 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/CovenantSQL/CovenantSQL/metric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// AntiAffinity defines how the replicas of a database are spread across miners.
+type AntiAffinity int
+
+const (
+	// AntiAffinityNone allows replicas of a database on the same host.
+	AntiAffinityNone AntiAffinity = iota
+	// AntiAffinityHost places replicas of a database on distinct hosts.
+	AntiAffinityHost
+	// AntiAffinitySubnet places replicas of a database in distinct /24 IPv4 or /64 IPv6 subnets.
+	AntiAffinitySubnet
+)
+
+var (
+	// MetricKeyAvailSpace enumerates possible available filesystem space metric keys.
+	MetricKeyAvailSpace = []string{
+		"node_filesystem_avail_bytes",
+	}
+	// MetricKeyLoadAvg15 enumerates possible 15 minutes load average metric keys.
+	MetricKeyLoadAvg15 = []string{
+		"node_load15",
+	}
+	// MetricKeyCPUCount enumerates possible cpu count metric keys.
+	MetricKeyCPUCount = []string{
+		"node_cpu_count",
+	}
+)
+
+// ParseAntiAffinity parses the anti-affinity config: none, host or subnet.
+func ParseAntiAffinity(s string) (a AntiAffinity, err error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		a = AntiAffinityNone
+	case "host":
+		a = AntiAffinityHost
+	case "subnet":
+		a = AntiAffinitySubnet
+	default:
+		err = ErrInvalidAntiAffinity
+	}
+	return
+}
+
+// key returns the anti-affinity key of the node address.
+func (a AntiAffinity) key(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if a == AntiAffinitySubnet {
+		if ip := net.ParseIP(host); ip != nil {
+			if ip4 := ip.To4(); ip4 != nil {
+				return ip4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+			}
+			return ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+		}
+	}
+	return host
+}
+
+// placeNodes chooses the miners to serve the database by the resources they report, the
+// resources already reserved by other databases and the anti-affinity policy. The miner with
+// the most available memory comes first. All the candidates of the last round are returned
+// for capacity planning.
+func (s *DBService) placeNodes(dbID proto.DatabaseID, resourceMeta types.ResourceMeta) (
+	allocated []proto.NodeID, candidates []types.NodeResource, err error,
+) {
+	if resourceMeta.Node <= 0 {
+		err = ErrDatabaseAllocation
+		return
+	}
+
+	return s.placeReplicas(dbID, resourceMeta, int(resourceMeta.Node), nil)
+}
+
+// placeReplicas chooses count more miners to serve the database besides the existing peers,
+// the anti-affinity policy also applies to the existing peers.
+func (s *DBService) placeReplicas(
+	dbID proto.DatabaseID, resourceMeta types.ResourceMeta, count int, existing []proto.NodeID,
+) (
+	allocated []proto.NodeID, candidates []types.NodeResource, err error,
+) {
+	curRange := count + len(existing)
+	excludeNodes := make(map[proto.NodeID]bool)
+	usedHosts := make(map[string]bool)
+
+	for _, nodeID := range existing {
+		excludeNodes[nodeID] = true
+		if node, err := s.Consistent.GetNode(string(nodeID)); err == nil {
+			usedHosts[s.AntiAffinity.key(node.Addr)] = true
+		}
+	}
+
+	if !s.includeBPNodesForAllocation {
+		// add block producer nodes to exclude node list
+		for _, nodeID := range route.GetBPs() {
+			excludeNodes[nodeID] = true
+		}
+	}
+
+	rolesFilter := []proto.ServerRole{
+		proto.Miner,
+	}
+	if s.includeBPNodesForAllocation {
+		rolesFilter = append(rolesFilter, proto.Leader, proto.Follower)
+	}
+
+	for i := 0; i != s.AllocationRounds; i++ {
+		log.WithField("round", i).Debug("try allocation node")
+
+		var nodes, filtered []proto.Node
+		if nodes, err = s.Consistent.GetNeighborsEx(
+			string(dbID), curRange, proto.ServerRoles(rolesFilter)); err != nil {
+			return
+		}
+		nodeIDs := make([]proto.NodeID, 0, len(nodes))
+		for _, node := range nodes {
+			if !excludeNodes[node.ID] && !s.isDead(node.ID) {
+				filtered = append(filtered, node)
+				nodeIDs = append(nodeIDs, node.ID)
+			}
+		}
+
+		log.WithFields(log.Fields{
+			"nodeCount":  len(nodeIDs),
+			"totalCount": len(nodes),
+			"nodes":      nodeIDs,
+		}).Debug("found nodes to dispatch")
+
+		if len(nodeIDs) < count {
+			continue
+		}
+
+		// check node resource status
+		metrics := s.NodeMetrics.GetMetrics(nodeIDs)
+		candidates = candidates[:0]
+		var eligible []types.NodeResource
+
+		for j := range filtered {
+			nodeMetric, ok := metrics[filtered[j].ID]
+			if !ok {
+				// may be reported later
+				candidates = append(candidates, types.NodeResource{
+					NodeID: filtered[j].ID,
+					Host:   s.AntiAffinity.key(filtered[j].Addr),
+					Reason: "metric not collected",
+				})
+				continue
+			}
+			r := s.nodeResource(&filtered[j], nodeMetric, resourceMeta)
+			if r.Reason != "" {
+				log.WithFields(log.Fields{
+					"node":   r.NodeID,
+					"reason": r.Reason,
+				}).Debug("node resource doesn't meet requirement")
+				excludeNodes[r.NodeID] = true
+			} else {
+				eligible = append(eligible, r)
+			}
+			candidates = append(candidates, r)
+		}
+
+		if allocated = pickNodes(eligible, count, s.AntiAffinity, usedHosts); allocated != nil {
+			return
+		}
+
+		curRange += count
+	}
+
+	// allocation failed
+	err = ErrDatabaseAllocation
+	return
+}
+
+// nodeResource collects the resources of the node and checks them against the requirement,
+// the reason is set if the node can't serve the database.
+func (s *DBService) nodeResource(
+	node *proto.Node, nodeMetric metric.MetricMap, resourceMeta types.ResourceMeta,
+) (r types.NodeResource) {
+	var err error
+	r.NodeID = node.ID
+	r.Host = s.AntiAffinity.key(node.Addr)
+	r.ReservedMemory, r.ReservedSpace, r.Databases = s.ServiceMap.GetReserved(node.ID)
+
+	// memory is always required
+	if r.FreeMemory, err = s.getMetric(nodeMetric, MetricKeyFreeMemory); err != nil {
+		r.Reason = "memory metric not collected"
+		return
+	}
+	if resourceMeta.Memory >= subReserved(r.FreeMemory, r.ReservedMemory) {
+		r.Reason = "insufficient memory"
+		return
+	}
+
+	// the largest filesystem is supposed to hold the databases
+	var spaces []float64
+	if spaces, err = getMetricValues(nodeMetric, MetricKeyAvailSpace); err == nil {
+		for _, v := range spaces {
+			if uint64(v) > r.AvailSpace {
+				r.AvailSpace = uint64(v)
+			}
+		}
+	} else if resourceMeta.Space > 0 {
+		r.Reason = "filesystem metric not collected"
+		return
+	}
+	if resourceMeta.Space > 0 && resourceMeta.Space > subReserved(r.AvailSpace, r.ReservedSpace) {
+		r.Reason = "insufficient space"
+		return
+	}
+
+	var loads, cpus []float64
+	if loads, err = getMetricValues(nodeMetric, MetricKeyLoadAvg15); err == nil {
+		if cpus, err = getMetricValues(nodeMetric, MetricKeyCPUCount); err == nil && cpus[0] > 0 {
+			r.LoadAvgPerCPU = loads[0] / cpus[0]
+		}
+	}
+	if resourceMeta.LoadAvgPerCPU > 0 {
+		if err != nil {
+			r.Reason = "loadavg metric not collected"
+			return
+		}
+		if r.LoadAvgPerCPU > float64(resourceMeta.LoadAvgPerCPU) {
+			r.Reason = "load average too high"
+			return
+		}
+	}
+	return
+}
+
+// pickNodes picks count nodes with the most available memory, at most one node is picked from
+// each anti-affinity key, keys in usedHosts are skipped. Returns nil if there are not enough nodes.
+func pickNodes(
+	eligible []types.NodeResource, count int, antiAffinity AntiAffinity, usedHosts map[string]bool,
+) (picked []proto.NodeID) {
+	sort.SliceStable(eligible, func(i, j int) bool {
+		return subReserved(eligible[i].FreeMemory, eligible[i].ReservedMemory) >
+			subReserved(eligible[j].FreeMemory, eligible[j].ReservedMemory)
+	})
+	var (
+		hosts  = make(map[string]bool)
+		result = make([]proto.NodeID, 0, count)
+	)
+	for host := range usedHosts {
+		hosts[host] = true
+	}
+	for _, r := range eligible {
+		if len(result) == count {
+			break
+		}
+		if antiAffinity != AntiAffinityNone {
+			if hosts[r.Host] {
+				continue
+			}
+			hosts[r.Host] = true
+		}
+		result = append(result, r.NodeID)
+	}
+	if len(result) < count {
+		return
+	}
+	return result
+}
+
+func subReserved(total, reserved uint64) uint64 {
+	if total < reserved {
+		return 0
+	}
+	return total - reserved
+}
+
+// getMetricValues returns values of all the series of the first collected metric key.
+func getMetricValues(nodeMetric metric.MetricMap, keys []string) (values []float64, err error) {
+	for _, key := range keys {
+		rawMetric, ok := nodeMetric[key]
+		if !ok || rawMetric == nil || len(rawMetric.GetMetric()) == 0 {
+			continue
+		}
+		for _, m := range rawMetric.GetMetric() {
+			switch rawMetric.GetType() {
+			case dto.MetricType_GAUGE:
+				values = append(values, m.GetGauge().GetValue())
+			case dto.MetricType_COUNTER:
+				values = append(values, m.GetCounter().GetValue())
+			}
+		}
+		if len(values) > 0 {
+			return
+		}
+	}
+	err = ErrMetricNotCollected
+	return
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/metric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	pb "github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func gaugeFamily(values ...float64) *dto.MetricFamily {
+	f := &dto.MetricFamily{
+		Type: dto.MetricType_GAUGE.Enum(),
+	}
+	for _, v := range values {
+		f.Metric = append(f.Metric, &dto.Metric{Gauge: &dto.Gauge{Value: pb.Float64(v)}})
+	}
+	return f
+}
+
+func TestAntiAffinity(t *testing.T) {
+	Convey("test anti-affinity parse and key", t, func() {
+		a, err := ParseAntiAffinity("")
+		So(err, ShouldBeNil)
+		So(a, ShouldEqual, AntiAffinityNone)
+		a, err = ParseAntiAffinity("Host")
+		So(err, ShouldBeNil)
+		So(a, ShouldEqual, AntiAffinityHost)
+		a, err = ParseAntiAffinity("subnet")
+		So(err, ShouldBeNil)
+		So(a, ShouldEqual, AntiAffinitySubnet)
+		_, err = ParseAntiAffinity("rack")
+		So(err, ShouldEqual, ErrInvalidAntiAffinity)
+
+		So(AntiAffinityHost.key("10.0.1.2:2120"), ShouldEqual, "10.0.1.2")
+		So(AntiAffinityHost.key("miner.local"), ShouldEqual, "miner.local")
+		So(AntiAffinitySubnet.key("10.0.1.2:2120"), ShouldEqual, "10.0.1.0/24")
+		So(AntiAffinitySubnet.key("10.0.1.200:2120"), ShouldEqual, "10.0.1.0/24")
+		So(AntiAffinitySubnet.key("[2001:db8::1]:2120"), ShouldEqual, "2001:db8::/64")
+		So(AntiAffinitySubnet.key("miner.local:2120"), ShouldEqual, "miner.local")
+	})
+}
+
+func TestPickNodes(t *testing.T) {
+	Convey("test pick nodes", t, func() {
+		eligible := []types.NodeResource{
+			{NodeID: "a", Host: "h1", FreeMemory: 100},
+			{NodeID: "b", Host: "h1", FreeMemory: 300},
+			{NodeID: "c", Host: "h2", FreeMemory: 400, ReservedMemory: 350},
+			{NodeID: "d", Host: "h3", FreeMemory: 200},
+		}
+
+		So(pickNodes(eligible, 2, AntiAffinityNone, nil), ShouldResemble, []proto.NodeID{"b", "d"})
+		So(pickNodes(eligible, 3, AntiAffinityHost, nil), ShouldResemble, []proto.NodeID{"b", "d", "c"})
+		So(pickNodes(eligible, 4, AntiAffinityHost, nil), ShouldBeNil)
+		So(pickNodes(eligible, 4, AntiAffinityNone, nil), ShouldHaveLength, 4)
+
+		usedHosts := map[string]bool{"h1": true}
+		So(pickNodes(eligible, 2, AntiAffinityHost, usedHosts), ShouldResemble, []proto.NodeID{"d", "c"})
+		So(pickNodes(eligible, 3, AntiAffinityHost, usedHosts), ShouldBeNil)
+		So(pickNodes(eligible, 2, AntiAffinityNone, usedHosts), ShouldResemble, []proto.NodeID{"b", "d"})
+	})
+}
+
+func TestNodeResource(t *testing.T) {
+	Convey("test node resource", t, func() {
+		s := &DBService{
+			ServiceMap: &DBServiceMap{
+				dbMap: map[proto.DatabaseID]types.ServiceInstance{
+					"db1": {DatabaseID: "db1", ResourceMeta: types.ResourceMeta{Memory: 400, Space: 1000}},
+					"db2": {DatabaseID: "db2", ResourceMeta: types.ResourceMeta{Memory: 100, Space: 500}},
+				},
+				nodeMap: map[proto.NodeID]map[proto.DatabaseID]bool{
+					"node": {"db1": true, "db2": true},
+				},
+			},
+			AntiAffinity: AntiAffinityHost,
+		}
+		node := &proto.Node{ID: "node", Addr: "10.0.0.1:2120"}
+		nodeMetric := metric.MetricMap{
+			"node_memory_MemFree_bytes":   gaugeFamily(1000),
+			"node_filesystem_avail_bytes": gaugeFamily(2000, 5000),
+			"node_load15":                 gaugeFamily(3),
+			"node_cpu_count":              gaugeFamily(4),
+		}
+
+		r := s.nodeResource(node, nodeMetric, types.ResourceMeta{Memory: 100})
+		So(r.Reason, ShouldBeEmpty)
+		So(r.Host, ShouldEqual, "10.0.0.1")
+		So(r.FreeMemory, ShouldEqual, 1000)
+		So(r.ReservedMemory, ShouldEqual, 500)
+		So(r.AvailSpace, ShouldEqual, 5000)
+		So(r.ReservedSpace, ShouldEqual, 1500)
+		So(r.Databases, ShouldEqual, 2)
+		So(r.LoadAvgPerCPU, ShouldAlmostEqual, 0.75)
+
+		r = s.nodeResource(node, nodeMetric, types.ResourceMeta{Memory: 500})
+		So(r.Reason, ShouldEqual, "insufficient memory")
+		r = s.nodeResource(node, nodeMetric, types.ResourceMeta{Memory: 100, Space: 4000})
+		So(r.Reason, ShouldEqual, "insufficient space")
+		r = s.nodeResource(node, nodeMetric, types.ResourceMeta{Memory: 100, Space: 3000})
+		So(r.Reason, ShouldBeEmpty)
+
+		delete(nodeMetric, "node_cpu_count")
+		r = s.nodeResource(node, nodeMetric, types.ResourceMeta{Memory: 100})
+		So(r.Reason, ShouldBeEmpty)
+		r = s.nodeResource(node, nodeMetric, types.ResourceMeta{Memory: 100, LoadAvgPerCPU: 1})
+		So(r.Reason, ShouldEqual, "loadavg metric not collected")
+
+		delete(nodeMetric, "node_memory_MemFree_bytes")
+		r = s.nodeResource(node, nodeMetric, types.ResourceMeta{Memory: 100})
+		So(r.Reason, ShouldEqual, "memory metric not collected")
+	})
+}
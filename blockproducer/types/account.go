@@ -17,7 +17,10 @@
 package types
 
 import (
+	"time"
+
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 )
 
@@ -71,4 +74,24 @@ type Account struct {
 	CovenantCoinBalance uint64
 	Rating              float64
 	NextNonce           pi.AccountNonce
+	// PublicKey is the rotated account key, nil if the key was never rotated. PreviousKey
+	// is still accepted until PreviousKeyExpire.
+	PublicKey         *asymmetric.PublicKey
+	PreviousKey       *asymmetric.PublicKey
+	PreviousKeyExpire time.Time
+	// MultiSigPolicy is the signing policy of a multi-signature account, transactions of
+	// such an account must carry enough signatures of the policy keys.
+	MultiSigPolicy *MultiSigPolicy
+}
+
+// IsKeyAccepted returns if transactions of the account signed by key are accepted at the
+// given time. Any key is accepted if the account key was never rotated.
+func (a *Account) IsKeyAccepted(key *asymmetric.PublicKey, now time.Time) bool {
+	if a.PublicKey == nil {
+		return true
+	}
+	if a.PublicKey.IsEqual(key) {
+		return true
+	}
+	return a.PreviousKey != nil && a.PreviousKey.IsEqual(key) && now.Before(a.PreviousKeyExpire)
 }
@@ -10,31 +10,81 @@ import (
 func (z *Account) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 5
-	o = append(o, 0x85, 0x85)
+	// map header, size 9
+	o = append(o, 0x89, 0x89)
+	if z.MultiSigPolicy == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.MultiSigPolicy.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x89)
+	if z.PublicKey == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.PublicKey.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x89)
+	if z.PreviousKey == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.PreviousKey.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x89)
 	o = hsp.AppendFloat64(o, z.Rating)
-	o = append(o, 0x85)
+	o = append(o, 0x89)
 	if oTemp, err := z.NextNonce.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x85)
+	o = append(o, 0x89)
 	if oTemp, err := z.Address.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x85)
+	o = append(o, 0x89)
+	o = hsp.AppendTime(o, z.PreviousKeyExpire)
+	o = append(o, 0x89)
 	o = hsp.AppendUint64(o, z.StableCoinBalance)
-	o = append(o, 0x85)
+	o = append(o, 0x89)
 	o = hsp.AppendUint64(o, z.CovenantCoinBalance)
 	return
 }
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *Account) Msgsize() (s int) {
-	s = 1 + 7 + hsp.Float64Size + 10 + z.NextNonce.Msgsize() + 8 + z.Address.Msgsize() + 18 + hsp.Uint64Size + 20 + hsp.Uint64Size
+	s = 1 + 15
+	if z.MultiSigPolicy == nil {
+		s += hsp.NilSize
+	} else {
+		s += z.MultiSigPolicy.Msgsize()
+	}
+	s += 10
+	if z.PublicKey == nil {
+		s += hsp.NilSize
+	} else {
+		s += z.PublicKey.Msgsize()
+	}
+	s += 12
+	if z.PreviousKey == nil {
+		s += hsp.NilSize
+	} else {
+		s += z.PreviousKey.Msgsize()
+	}
+	s += 7 + hsp.Float64Size + 10 + z.NextNonce.Msgsize() + 8 + z.Address.Msgsize() + 18 + hsp.TimeSize + 18 + hsp.Uint64Size + 20 + hsp.Uint64Size
 	return
 }
 
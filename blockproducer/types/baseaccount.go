@@ -56,7 +56,7 @@ func (b *BaseAccount) Hash() (h hash.Hash) {
 }
 
 // Sign implements interfaces/Transaction.Sign.
-func (b *BaseAccount) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (b *BaseAccount) Sign(signer asymmetric.Signer) (err error) {
 	return
 }
 
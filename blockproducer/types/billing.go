@@ -69,7 +69,7 @@ func NewBilling(header *BillingHeader) *Billing {
 }
 
 // Sign implements interfaces/Transaction.Sign.
-func (tb *Billing) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (tb *Billing) Sign(signer asymmetric.Signer) (err error) {
 	return tb.DefaultHashSignVerifierImpl.Sign(&tb.BillingHeader, signer)
 }
 
@@ -59,7 +59,7 @@ func (br *BillingRequest) PackRequestHeader() (h *hash.Hash, err error) {
 }
 
 // SignRequestHeader first computes the hash of BillingRequestHeader, then signs the request.
-func (br *BillingRequest) SignRequestHeader(signer *asymmetric.PrivateKey, calcHash bool) (
+func (br *BillingRequest) SignRequestHeader(signer asymmetric.Signer, calcHash bool) (
 	signee *asymmetric.PublicKey, signature *asymmetric.Signature, err error) {
 	if calcHash {
 		if _, err = br.PackRequestHeader(); err != nil {
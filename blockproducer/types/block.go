@@ -74,7 +74,7 @@ func (b *Block) GetTxHashes() []*hash.Hash {
 }
 
 // PackAndSignBlock computes block's hash and sign it.
-func (b *Block) PackAndSignBlock(signer *asymmetric.PrivateKey) error {
+func (b *Block) PackAndSignBlock(signer asymmetric.Signer) error {
 	hs := b.GetTxHashes()
 
 	b.SignedHeader.MerkleRoot = *merkle.NewMerkle(hs).GetRoot()
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// DropDatabaseHeader defines the database drop transaction header.
+type DropDatabaseHeader struct {
+	Owner      proto.AccountAddress
+	Nonce      pi.AccountNonce
+	DatabaseID proto.DatabaseID
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (h *DropDatabaseHeader) GetAccountAddress() proto.AccountAddress {
+	return h.Owner
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (h *DropDatabaseHeader) GetAccountNonce() pi.AccountNonce {
+	return h.Nonce
+}
+
+// DropDatabase defines the database drop transaction.
+type DropDatabase struct {
+	DropDatabaseHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+	// MultiSig holds the signatures if the owner is a multi-signature account.
+	MultiSig *MultiSig
+}
+
+// NewDropDatabase returns new instance.
+func NewDropDatabase(header *DropDatabaseHeader) *DropDatabase {
+	return &DropDatabase{
+		DropDatabaseHeader:   *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeDropDatabase),
+	}
+}
+
+// NewMultiSigDropDatabase returns new instance owned by the multi-signature account of policy.
+func NewMultiSigDropDatabase(header *DropDatabaseHeader, policy *MultiSigPolicy) *DropDatabase {
+	dd := NewDropDatabase(header)
+	dd.MultiSig = NewMultiSig(policy)
+	return dd
+}
+
+// Sign implements interfaces/Transaction.Sign, a multi-signature database drop is partially
+// signed by each signer.
+func (dd *DropDatabase) Sign(signer asymmetric.Signer) (err error) {
+	if dd.MultiSig != nil {
+		return signMultiSig(&dd.DropDatabaseHeader, dd.MultiSig, &dd.DefaultHashSignVerifierImpl, signer)
+	}
+	return dd.DefaultHashSignVerifierImpl.Sign(&dd.DropDatabaseHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (dd *DropDatabase) Verify() error {
+	if dd.MultiSig != nil {
+		return verifyMultiSig(&dd.DropDatabaseHeader, dd.MultiSig, &dd.DefaultHashSignVerifierImpl, dd.Owner)
+	}
+	return dd.DefaultHashSignVerifierImpl.Verify(&dd.DropDatabaseHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeDropDatabase, (*DropDatabase)(nil))
+}
@@ -36,4 +36,21 @@ var (
 
 	// ErrBillingNotMatch indicates that the billing request doesn't match the local result.
 	ErrBillingNotMatch = errors.New("billing request doesn't match")
+
+	// ErrKeyRotationAddressNotMatch indicates that the key rotation record doesn't belong to the
+	// transaction account.
+	ErrKeyRotationAddressNotMatch = errors.New("key rotation address doesn't match")
+
+	// ErrInvalidMultiSigPolicy indicates a malformed multi-signature policy.
+	ErrInvalidMultiSigPolicy = errors.New("invalid multi-signature policy")
+
+	// ErrMultiSigPolicyNotMatch indicates that the multi-signature policy doesn't match the
+	// transaction account.
+	ErrMultiSigPolicyNotMatch = errors.New("multi-signature policy doesn't match")
+
+	// ErrMultiSigUnknownSignee indicates a signature by a key out of the multi-signature policy.
+	ErrMultiSigUnknownSignee = errors.New("signee is not in the multi-signature policy")
+
+	// ErrMultiSigThreshold indicates that the transaction is not signed by enough keys.
+	ErrMultiSigThreshold = errors.New("not enough multi-signature signatures")
 )
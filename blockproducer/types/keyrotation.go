@@ -0,0 +1,90 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// KeyRotationHeader defines the account key rotation transaction header.
+type KeyRotationHeader struct {
+	Address  proto.AccountAddress
+	Nonce    pi.AccountNonce
+	Rotation kms.KeyRotation
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (h *KeyRotationHeader) GetAccountAddress() proto.AccountAddress {
+	return h.Address
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (h *KeyRotationHeader) GetAccountNonce() pi.AccountNonce {
+	return h.Nonce
+}
+
+// KeyRotation defines the account key rotation transaction, which registers the new key
+// of the rotation record as the account key. It must be signed by the old key.
+type KeyRotation struct {
+	KeyRotationHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewKeyRotation returns new instance.
+func NewKeyRotation(header *KeyRotationHeader) *KeyRotation {
+	return &KeyRotation{
+		KeyRotationHeader:    *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeKeyRotation),
+	}
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (kr *KeyRotation) Sign(signer asymmetric.Signer) (err error) {
+	return kr.DefaultHashSignVerifierImpl.Sign(&kr.KeyRotationHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (kr *KeyRotation) Verify() (err error) {
+	if err = kr.DefaultHashSignVerifierImpl.Verify(&kr.KeyRotationHeader); err != nil {
+		return
+	}
+	if err = kr.Rotation.Verify(); err != nil {
+		return
+	}
+	var addr proto.AccountAddress
+	if addr, err = kr.Rotation.Address(); err != nil {
+		return
+	}
+	if addr != kr.Address {
+		return ErrKeyRotationAddressNotMatch
+	}
+	if !kr.Signee.IsEqual(kr.Rotation.OldKey) {
+		return ErrSignVerification
+	}
+	return
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeKeyRotation, (*KeyRotation)(nil))
+}
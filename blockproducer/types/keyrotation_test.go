@@ -0,0 +1,78 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+	"time"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTxKeyRotation(t *testing.T) {
+	Convey("test tx key rotation", t, func() {
+		oldPriv, oldPub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		newPriv, newPub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		addr, err := crypto.PubKeyHash(oldPub)
+		So(err, ShouldBeNil)
+
+		r := kms.NewKeyRotation(&kms.KeyRotationHeader{
+			OriginalKey: oldPub,
+			OldKey:      oldPub,
+			NewKey:      newPub,
+			Timestamp:   time.Now(),
+			GracePeriod: time.Hour,
+		})
+		So(r.Sign(oldPriv, newPriv), ShouldBeNil)
+
+		kr := NewKeyRotation(&KeyRotationHeader{
+			Address:  addr,
+			Nonce:    1,
+			Rotation: *r,
+		})
+		So(kr.GetAccountAddress(), ShouldEqual, addr)
+		So(kr.GetAccountNonce(), ShouldEqual, 1)
+		So(kr.GetTransactionType(), ShouldEqual, pi.TransactionTypeKeyRotation)
+
+		So(kr.Sign(oldPriv), ShouldBeNil)
+		So(kr.Verify(), ShouldBeNil)
+
+		buf, err := utils.EncodeMsgPack(kr)
+		So(err, ShouldBeNil)
+		var dec pi.Transaction
+		So(utils.DecodeMsgPack(buf.Bytes(), &dec), ShouldBeNil)
+		So(dec.Verify(), ShouldBeNil)
+		So(dec.Hash(), ShouldEqual, kr.Hash())
+
+		// signed by the new key
+		So(kr.Sign(newPriv), ShouldBeNil)
+		So(kr.Verify(), ShouldEqual, ErrSignVerification)
+
+		// rotation of another account
+		kr.Address = proto.AccountAddress{0x1}
+		So(kr.Sign(oldPriv), ShouldBeNil)
+		So(kr.Verify(), ShouldEqual, ErrKeyRotationAddressNotMatch)
+	})
+}
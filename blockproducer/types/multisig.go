@@ -0,0 +1,219 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// MultiSigPolicy defines an M-of-N multi-signature account: the account address is the hash
+// of the policy, and transactions of the account must be signed by Threshold of PublicKeys.
+type MultiSigPolicy struct {
+	Threshold  uint32
+	PublicKeys []*asymmetric.PublicKey
+}
+
+// NewMultiSigPolicy returns a new multi-signature policy, the public keys are sorted so that
+// the account address doesn't depend on their order.
+func NewMultiSigPolicy(threshold uint32, keys []*asymmetric.PublicKey) (p *MultiSigPolicy, err error) {
+	p = &MultiSigPolicy{
+		Threshold:  threshold,
+		PublicKeys: make([]*asymmetric.PublicKey, len(keys)),
+	}
+	copy(p.PublicKeys, keys)
+	sort.Slice(p.PublicKeys, func(i, j int) bool {
+		return bytes.Compare(p.PublicKeys[i].Serialize(), p.PublicKeys[j].Serialize()) < 0
+	})
+	if err = p.Verify(); err != nil {
+		p = nil
+	}
+	return
+}
+
+// Verify checks the policy is well formed.
+func (p *MultiSigPolicy) Verify() (err error) {
+	if p.Threshold == 0 || int(p.Threshold) > len(p.PublicKeys) {
+		return ErrInvalidMultiSigPolicy
+	}
+	for i, k := range p.PublicKeys {
+		if k == nil {
+			return ErrInvalidMultiSigPolicy
+		}
+		// keys must be sorted without duplication
+		if i > 0 && bytes.Compare(p.PublicKeys[i-1].Serialize(), k.Serialize()) >= 0 {
+			return ErrInvalidMultiSigPolicy
+		}
+	}
+	return
+}
+
+// Address returns the account address of the policy.
+func (p *MultiSigPolicy) Address() (addr proto.AccountAddress, err error) {
+	var enc []byte
+	if enc, err = p.MarshalHash(); err != nil {
+		return
+	}
+	addr = proto.AccountAddress(hash.THashH(enc))
+	return
+}
+
+func (p *MultiSigPolicy) indexOf(key *asymmetric.PublicKey) int {
+	for i, k := range p.PublicKeys {
+		if k.IsEqual(key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// PartialSignature defines a signature of a multi-signature transaction by one of the keys.
+type PartialSignature struct {
+	Signee    *asymmetric.PublicKey
+	Signature *asymmetric.Signature
+}
+
+// MultiSig defines the signatures of a multi-signature account transaction.
+type MultiSig struct {
+	Policy     MultiSigPolicy
+	Signatures []*PartialSignature
+}
+
+// NewMultiSig returns a new multi-signature set without signatures.
+func NewMultiSig(policy *MultiSigPolicy) *MultiSig {
+	return &MultiSig{Policy: *policy}
+}
+
+// Sign adds the signature of the data hash by signer, which must be one of the policy keys.
+// A previous signature by the same key is replaced.
+func (m *MultiSig) Sign(h hash.Hash, signer asymmetric.Signer) (err error) {
+	var signee = signer.PubKey()
+	if m.Policy.indexOf(signee) < 0 {
+		return ErrMultiSigUnknownSignee
+	}
+	var sig *asymmetric.Signature
+	if sig, err = signer.Sign(h[:]); err != nil {
+		return
+	}
+	m.add(&PartialSignature{Signee: signee, Signature: sig})
+	return
+}
+
+func (m *MultiSig) add(ps *PartialSignature) {
+	for i, v := range m.Signatures {
+		if v.Signee.IsEqual(ps.Signee) {
+			m.Signatures[i] = ps
+			return
+		}
+	}
+	m.Signatures = append(m.Signatures, ps)
+	// keep signatures in policy key order for a stable hash
+	sort.Slice(m.Signatures, func(i, j int) bool {
+		return m.Policy.indexOf(m.Signatures[i].Signee) < m.Policy.indexOf(m.Signatures[j].Signee)
+	})
+}
+
+// Combine merges the signatures of other, which must be of the same policy.
+func (m *MultiSig) Combine(other *MultiSig) (err error) {
+	var addr, otherAddr proto.AccountAddress
+	if addr, err = m.Policy.Address(); err != nil {
+		return
+	}
+	if otherAddr, err = other.Policy.Address(); err != nil {
+		return
+	}
+	if addr != otherAddr {
+		return ErrMultiSigPolicyNotMatch
+	}
+	for _, v := range other.Signatures {
+		if v == nil || m.Policy.indexOf(v.Signee) < 0 {
+			return ErrMultiSigUnknownSignee
+		}
+		m.add(v)
+	}
+	return
+}
+
+// Verify checks that the data hash is signed by at least Threshold distinct policy keys.
+func (m *MultiSig) Verify(h hash.Hash) (err error) {
+	if err = m.Policy.Verify(); err != nil {
+		return
+	}
+	var signed = make(map[int]bool)
+	for _, v := range m.Signatures {
+		if v == nil || v.Signature == nil {
+			return ErrSignVerification
+		}
+		var i = m.Policy.indexOf(v.Signee)
+		if i < 0 {
+			return ErrMultiSigUnknownSignee
+		}
+		if !v.Signature.Verify(h[:], v.Signee) {
+			return ErrSignVerification
+		}
+		signed[i] = true
+	}
+	if len(signed) < int(m.Policy.Threshold) {
+		return ErrMultiSigThreshold
+	}
+	return
+}
+
+// signMultiSig signs the header of a multi-signature transaction by one of the policy keys,
+// the data hash is kept in the default verifier without signee.
+func signMultiSig(
+	mh verifier.MarshalHasher, m *MultiSig, v *verifier.DefaultHashSignVerifierImpl,
+	signer asymmetric.Signer,
+) (err error) {
+	var enc []byte
+	if enc, err = mh.MarshalHash(); err != nil {
+		return
+	}
+	v.DataHash = hash.THashH(enc)
+	v.Signee, v.Signature = nil, nil
+	return m.Sign(v.DataHash, signer)
+}
+
+// verifyMultiSig verifies the header of a multi-signature transaction of account addr.
+func verifyMultiSig(
+	mh verifier.MarshalHasher, m *MultiSig, v *verifier.DefaultHashSignVerifierImpl,
+	addr proto.AccountAddress,
+) (err error) {
+	var enc []byte
+	if enc, err = mh.MarshalHash(); err != nil {
+		return
+	}
+	var h = hash.THashH(enc)
+	if !v.DataHash.IsEqual(&h) {
+		return ErrHashVerification
+	}
+	var policyAddr proto.AccountAddress
+	if policyAddr, err = m.Policy.Address(); err != nil {
+		return
+	}
+	if policyAddr != addr {
+		return ErrMultiSigPolicyNotMatch
+	}
+	return m.Verify(h)
+}
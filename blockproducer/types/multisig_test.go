@@ -0,0 +1,125 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMultiSig(t *testing.T) {
+	Convey("test multi-signature transactions", t, func() {
+		var (
+			privs = make([]*asymmetric.PrivateKey, 3)
+			pubs  = make([]*asymmetric.PublicKey, 3)
+			err   error
+		)
+		for i := range privs {
+			privs[i], pubs[i], err = asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+		}
+		_, other, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+
+		_, err = NewMultiSigPolicy(0, pubs)
+		So(err, ShouldEqual, ErrInvalidMultiSigPolicy)
+		_, err = NewMultiSigPolicy(4, pubs)
+		So(err, ShouldEqual, ErrInvalidMultiSigPolicy)
+		_, err = NewMultiSigPolicy(1, []*asymmetric.PublicKey{pubs[0], pubs[0]})
+		So(err, ShouldEqual, ErrInvalidMultiSigPolicy)
+
+		policy, err := NewMultiSigPolicy(2, pubs)
+		So(err, ShouldBeNil)
+		addr, err := policy.Address()
+		So(err, ShouldBeNil)
+
+		// address doesn't depend on key order
+		reversed, err := NewMultiSigPolicy(2, []*asymmetric.PublicKey{pubs[2], pubs[1], pubs[0]})
+		So(err, ShouldBeNil)
+		raddr, err := reversed.Address()
+		So(err, ShouldBeNil)
+		So(raddr, ShouldEqual, addr)
+
+		Convey("transfer should be signed by threshold keys", func() {
+			tr := NewMultiSigTransfer(&TransferHeader{
+				Sender:   addr,
+				Receiver: proto.AccountAddress{0x1},
+				Nonce:    1,
+				Amount:   100,
+			}, policy)
+			So(tr.Sign(privs[0]), ShouldBeNil)
+			So(tr.Verify(), ShouldEqual, ErrMultiSigThreshold)
+
+			// partially signed copies are combined offline
+			buf, err := utils.EncodeMsgPack(tr)
+			So(err, ShouldBeNil)
+			var dec pi.Transaction
+			So(utils.DecodeMsgPack(buf.Bytes(), &dec), ShouldBeNil)
+			part := dec.(*pi.TransactionWrapper).Unwrap().(*Transfer)
+			So(part.Sign(privs[2]), ShouldBeNil)
+			So(tr.MultiSig.Combine(part.MultiSig), ShouldBeNil)
+			So(tr.MultiSig.Signatures, ShouldHaveLength, 2)
+			So(tr.Verify(), ShouldBeNil)
+			So(part.Hash(), ShouldEqual, tr.Hash())
+
+			// signature by the same key is replaced
+			So(tr.Sign(privs[0]), ShouldBeNil)
+			So(tr.MultiSig.Signatures, ShouldHaveLength, 2)
+
+			// unknown signee
+			So(tr.Sign(privs[0]), ShouldBeNil)
+			tr.MultiSig.Signatures[0].Signee = other
+			So(tr.Verify(), ShouldEqual, ErrMultiSigUnknownSignee)
+		})
+		Convey("drop database should be signed by threshold keys", func() {
+			dd := NewMultiSigDropDatabase(&DropDatabaseHeader{
+				Owner:      addr,
+				Nonce:      1,
+				DatabaseID: proto.DatabaseID("db"),
+			}, policy)
+			So(dd.GetTransactionType(), ShouldEqual, pi.TransactionTypeDropDatabase)
+			So(dd.Sign(privs[1]), ShouldBeNil)
+			So(dd.Sign(privs[2]), ShouldBeNil)
+			So(dd.Verify(), ShouldBeNil)
+
+			// signatures of another policy
+			other, err := NewMultiSigPolicy(1, pubs[:2])
+			So(err, ShouldBeNil)
+			So(dd.MultiSig.Combine(NewMultiSig(other)), ShouldEqual, ErrMultiSigPolicyNotMatch)
+
+			// owner is not the policy address
+			dd.Owner = proto.AccountAddress{0x1}
+			So(dd.Sign(privs[1]), ShouldBeNil)
+			So(dd.Sign(privs[2]), ShouldBeNil)
+			So(dd.Verify(), ShouldEqual, ErrMultiSigPolicyNotMatch)
+		})
+		Convey("single signed drop database", func() {
+			dd := NewDropDatabase(&DropDatabaseHeader{
+				Owner:      addr,
+				Nonce:      1,
+				DatabaseID: proto.DatabaseID("db"),
+			})
+			So(dd.Sign(privs[0]), ShouldBeNil)
+			So(dd.Verify(), ShouldBeNil)
+		})
+	})
+}
@@ -37,6 +37,8 @@ type Transfer struct {
 	TransferHeader
 	pi.TransactionTypeMixin
 	verifier.DefaultHashSignVerifierImpl
+	// MultiSig holds the signatures if the sender is a multi-signature account.
+	MultiSig *MultiSig
 }
 
 // NewTransfer returns new instance.
@@ -57,13 +59,27 @@ func (t *Transfer) GetAccountNonce() pi.AccountNonce {
 	return t.Nonce
 }
 
-// Sign implements interfaces/Transaction.Sign.
-func (t *Transfer) Sign(signer *asymmetric.PrivateKey) (err error) {
+// NewMultiSigTransfer returns new instance sent from the multi-signature account of policy.
+func NewMultiSigTransfer(header *TransferHeader, policy *MultiSigPolicy) *Transfer {
+	t := NewTransfer(header)
+	t.MultiSig = NewMultiSig(policy)
+	return t
+}
+
+// Sign implements interfaces/Transaction.Sign, a multi-signature transfer is partially
+// signed by each signer.
+func (t *Transfer) Sign(signer asymmetric.Signer) (err error) {
+	if t.MultiSig != nil {
+		return signMultiSig(&t.TransferHeader, t.MultiSig, &t.DefaultHashSignVerifierImpl, signer)
+	}
 	return t.DefaultHashSignVerifierImpl.Sign(&t.TransferHeader, signer)
 }
 
 // Verify implements interfaces/Transaction.Verify.
 func (t *Transfer) Verify() (err error) {
+	if t.MultiSig != nil {
+		return verifyMultiSig(&t.TransferHeader, t.MultiSig, &t.DefaultHashSignVerifierImpl, t.Sender)
+	}
 	return t.DefaultHashSignVerifierImpl.Verify(&t.TransferHeader)
 }
 
@@ -47,6 +47,7 @@ var (
 	testDataDir       string
 	testAddress1Nonce pi.AccountNonce
 	testPrivKey       *asymmetric.PrivateKey
+	testPrivKey2      *asymmetric.PrivateKey
 )
 
 const (
@@ -178,7 +179,7 @@ func generateRandomBlockWithTransactions(parent hash.Hash, tbs []pi.Transaction)
 			Amount:   1,
 		},
 	)
-	if err = tr.Sign(priv); err != nil {
+	if err = tr.Sign(testPrivKey); err != nil {
 		return
 	}
 	b.Transactions = append(b.Transactions, tr)
@@ -466,6 +467,16 @@ func setup() {
 	if testPrivKey, _, err = asymmetric.GenSecp256k1KeyPair(); err != nil {
 		panic(err)
 	}
+	if testPrivKey2, _, err = asymmetric.GenSecp256k1KeyPair(); err != nil {
+		panic(err)
+	}
+	// Single signed transactions must be signed by the key of the sender address
+	if testAddress1, err = crypto.PubKeyHash(testPrivKey.PubKey()); err != nil {
+		panic(err)
+	}
+	if testAddress2, err = crypto.PubKeyHash(testPrivKey2.PubKey()); err != nil {
+		panic(err)
+	}
 
 	// Create temp dir for test data
 	if testDataDir, err = ioutil.TempDir("", "covenantsql"); err != nil {
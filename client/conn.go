@@ -31,6 +31,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/CovenantSQL/CovenantSQL/utils/trace"
 	"github.com/pkg/errors"
 )
 
@@ -40,7 +41,7 @@ type conn struct {
 
 	queries     []types.Query
 	localNodeID proto.NodeID
-	privKey     *asymmetric.PrivateKey
+	privKey     asymmetric.Signer
 
 	inTransaction bool
 	closed        int32
@@ -64,8 +65,8 @@ func newConn(cfg *Config) (c *conn, err error) {
 	}
 
 	// get local private key
-	var privKey *asymmetric.PrivateKey
-	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var privKey asymmetric.Signer
+	if privKey, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 
@@ -246,7 +247,7 @@ func (c *conn) ExecContext(ctx context.Context, query string, args []driver.Name
 	sq := convertQuery(query, args)
 
 	var affectedRows, lastInsertID int64
-	if affectedRows, lastInsertID, _, err = c.addQuery(types.WriteQuery, sq); err != nil {
+	if affectedRows, lastInsertID, _, err = c.addQuery(ctx, types.WriteQuery, sq); err != nil {
 		return
 	}
 
@@ -267,7 +268,7 @@ func (c *conn) QueryContext(ctx context.Context, query string, args []driver.Nam
 
 	// TODO(xq262144): make use of the ctx argument
 	sq := convertQuery(query, args)
-	_, _, rows, err = c.addQuery(types.ReadQuery, sq)
+	_, _, rows, err = c.addQuery(ctx, types.ReadQuery, sq)
 
 	return
 }
@@ -289,7 +290,7 @@ func (c *conn) Commit() (err error) {
 
 	if len(c.queries) > 0 {
 		// send query
-		if _, _, _, err = c.sendQuery(types.WriteQuery, c.queries); err != nil {
+		if _, _, _, err = c.sendQuery(context.Background(), types.WriteQuery, c.queries); err != nil {
 			return
 		}
 	}
@@ -319,7 +320,7 @@ func (c *conn) Rollback() error {
 	return nil
 }
 
-func (c *conn) addQuery(queryType types.QueryType, query *types.Query) (affectedRows int64, lastInsertID int64, rows driver.Rows, err error) {
+func (c *conn) addQuery(ctx context.Context, queryType types.QueryType, query *types.Query) (affectedRows int64, lastInsertID int64, rows driver.Rows, err error) {
 	if c.inTransaction {
 		// check query type, enqueue query
 		if queryType == types.ReadQuery {
@@ -344,10 +345,10 @@ func (c *conn) addQuery(queryType types.QueryType, query *types.Query) (affected
 		"args":    query.Args,
 	}).Debug("execute query")
 
-	return c.sendQuery(queryType, []types.Query{*query})
+	return c.sendQuery(ctx, queryType, []types.Query{*query})
 }
 
-func (c *conn) sendQuery(queryType types.QueryType, queries []types.Query) (affectedRows int64, lastInsertID int64, rows driver.Rows, err error) {
+func (c *conn) sendQuery(ctx context.Context, queryType types.QueryType, queries []types.Query) (affectedRows int64, lastInsertID int64, rows driver.Rows, err error) {
 	var uc *pconn // peer connection used to execute the queries
 
 	uc = c.leader
@@ -363,6 +364,14 @@ func (c *conn) sendQuery(queryType types.QueryType, queries []types.Query) (affe
 	connID, seqNo := allocateConnAndSeq()
 	defer putBackConn(connID)
 
+	ctx, span := trace.StartSpan(ctx, "client.sendQuery")
+	span.SetAttribute("database", c.dbID)
+	span.SetAttribute("type", queryType)
+	span.SetAttribute("count", len(queries))
+	defer func() {
+		span.End(err)
+	}()
+
 	defer func() {
 		log.WithFields(log.Fields{
 			"count":  len(queries),
@@ -394,6 +403,7 @@ func (c *conn) sendQuery(queryType types.QueryType, queries []types.Query) (affe
 	if err = req.Sign(c.privKey); err != nil {
 		return
 	}
+	trace.Inject(ctx, &req.Envelope)
 
 	var response types.Response
 	if err = uc.pCaller.Call(route.DBSQuery.String(), req, &response); err != nil {
@@ -35,6 +35,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/CovenantSQL/CovenantSQL/utils/trace"
 	"github.com/pkg/errors"
 )
 
@@ -102,6 +103,13 @@ func Init(configFile string, masterKey []byte) (err error) {
 		return
 	}
 
+	// start tracing of the queries
+	if conf.GConf.Tracing != nil {
+		if err = trace.Start("cql-client", conf.GConf.Tracing); err != nil {
+			return
+		}
+	}
+
 	// ping block producer to register node
 	if err = registerNode(); err != nil {
 		return
@@ -124,8 +132,8 @@ func Create(meta ResourceMeta) (dsn string, err error) {
 
 	req := new(types.CreateDatabaseRequest)
 	req.Header.ResourceMeta = types.ResourceMeta(meta)
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var privateKey asymmetric.Signer
+	if privateKey, err = kms.GetLocalSigner(); err != nil {
 		err = errors.Wrap(err, "get local private key failed")
 		return
 	}
@@ -151,6 +159,149 @@ func Create(meta ResourceMeta) (dsn string, err error) {
 	return
 }
 
+// Plan dry runs the database placement on block producer, returns the miners would be allocated
+// and the resource of all candidate miners, allocated is empty if the database can't be placed.
+func Plan(meta ResourceMeta) (allocated []proto.NodeID, candidates []types.NodeResource, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	req := new(types.PlanDatabaseRequest)
+	req.ResourceMeta = types.ResourceMeta(meta)
+	res := new(types.PlanDatabaseResponse)
+	if err = requestBP(route.BPDBPlanDatabase, req, res); err != nil {
+		err = errors.Wrap(err, "call BPDB.PlanDatabase failed")
+		return
+	}
+
+	allocated = res.Nodes
+	candidates = res.Candidates
+
+	return
+}
+
+// Update sends update database operation to block producer, the resource meta and peers of the
+// database are changed in background, the peers in drainNodes are replaced by new peers. The
+// progress of the operation can be checked with Operations.
+func Update(dsn string, meta ResourceMeta, drainNodes ...proto.NodeID) (op types.DatabaseOperation, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var cfg *Config
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+
+	req := new(types.UpdateDatabaseRequest)
+	req.Header.DatabaseID = proto.DatabaseID(cfg.DatabaseID)
+	req.Header.ResourceMeta = types.ResourceMeta(meta)
+	req.Header.DrainNodes = drainNodes
+	var privateKey asymmetric.Signer
+	if privateKey, err = kms.GetLocalSigner(); err != nil {
+		err = errors.Wrap(err, "get local private key failed")
+		return
+	}
+	if err = req.Sign(privateKey); err != nil {
+		err = errors.Wrap(err, "sign request failed")
+		return
+	}
+	res := new(types.UpdateDatabaseResponse)
+	if err = requestBP(route.BPDBUpdateDatabase, req, res); err != nil {
+		err = errors.Wrap(err, "call BPDB.UpdateDatabase failed")
+		return
+	}
+
+	op = res.Operation
+
+	return
+}
+
+// Operations returns the dead miners and the peers operations progress of the database,
+// operations of all databases are returned if dsn is empty.
+func Operations(dsn string) (deadNodes []proto.NodeID, ops []types.DatabaseOperation, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	req := new(types.DatabaseOperationsRequest)
+	if dsn != "" {
+		var cfg *Config
+		if cfg, err = ParseDSN(dsn); err != nil {
+			return
+		}
+		req.DatabaseID = proto.DatabaseID(cfg.DatabaseID)
+	}
+	res := new(types.DatabaseOperationsResponse)
+	if err = requestBP(route.BPDBGetDatabaseOperations, req, res); err != nil {
+		err = errors.Wrap(err, "call BPDB.GetDatabaseOperations failed")
+		return
+	}
+
+	deadNodes = res.DeadNodes
+	ops = res.Operations
+
+	return
+}
+
+// QueryStats returns the query pattern statistics of every peer of the database, the
+// statistics are sorted by total latency in descending order. The peers failed to answer
+// are returned in nodeErrs with their errors, err is set only if the peers are unknown.
+func QueryStats(dsn string) (
+	stats map[proto.NodeID][]types.QueryStat, nodeErrs map[proto.NodeID]error, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var cfg *Config
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+
+	dbID := proto.DatabaseID(cfg.DatabaseID)
+	var privateKey asymmetric.Signer
+	if privateKey, err = kms.GetLocalSigner(); err != nil {
+		err = errors.Wrap(err, "get local private key failed")
+		return
+	}
+	var peers *proto.Peers
+	if peers, err = cacheGetPeers(dbID, privateKey); err != nil {
+		err = errors.Wrap(err, "get database peers failed")
+		return
+	}
+
+	var (
+		caller = rpc.NewCaller()
+		wg     sync.WaitGroup
+		lock   sync.Mutex
+	)
+	stats = make(map[proto.NodeID][]types.QueryStat, len(peers.Servers))
+	nodeErrs = make(map[proto.NodeID]error)
+	for _, node := range peers.Servers {
+		wg.Add(1)
+		go func(node proto.NodeID) {
+			defer wg.Done()
+			req := &types.QueryStatsRequest{DatabaseID: dbID}
+			res := new(types.QueryStatsResponse)
+			errCall := caller.CallNode(node, route.DBSQueryStats.String(), req, res)
+			lock.Lock()
+			defer lock.Unlock()
+			if errCall != nil {
+				nodeErrs[node] = errors.Wrap(errCall, "call DBS.QueryStats failed")
+				return
+			}
+			stats[node] = res.Stats
+		}(node)
+	}
+	wg.Wait()
+
+	return
+}
+
 // Drop send drop database operation to block producer.
 func Drop(dsn string) (err error) {
 	if atomic.LoadUint32(&driverInitialized) == 0 {
@@ -165,8 +316,8 @@ func Drop(dsn string) (err error) {
 
 	req := new(types.DropDatabaseRequest)
 	req.Header.DatabaseID = proto.DatabaseID(cfg.DatabaseID)
-	var privateKey *asymmetric.PrivateKey
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var privateKey asymmetric.Signer
+	if privateKey, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 	if err = req.Sign(privateKey); err != nil {
@@ -257,8 +408,8 @@ func registerNode() (err error) {
 }
 
 func runPeerListUpdater() (err error) {
-	var privKey *asymmetric.PrivateKey
-	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+	var privKey asymmetric.Signer
+	if privKey, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 
@@ -267,6 +418,8 @@ func runPeerListUpdater() (err error) {
 	}
 
 	go func() {
+		registeredAt := time.Now()
+
 		for {
 			if atomic.LoadUint32(&peersUpdaterRunning) == 0 {
 				return
@@ -301,6 +454,15 @@ func runPeerListUpdater() (err error) {
 
 			wg.Wait()
 
+			// publish the signed node record before it expires
+			if time.Since(registeredAt) >= rpc.DefaultNodeRecordRefreshInterval {
+				if err := registerNode(); err != nil {
+					log.WithError(err).Warning("refresh node record failed")
+				} else {
+					registeredAt = time.Now()
+				}
+			}
+
 			time.Sleep(PeersUpdateInterval)
 		}
 	}()
@@ -312,7 +474,7 @@ func stopPeersUpdater() {
 	atomic.StoreUint32(&peersUpdaterRunning, 0)
 }
 
-func cacheGetPeers(dbID proto.DatabaseID, privKey *asymmetric.PrivateKey) (peers *proto.Peers, err error) {
+func cacheGetPeers(dbID proto.DatabaseID, privKey asymmetric.Signer) (peers *proto.Peers, err error) {
 	var ok bool
 	var rawPeers interface{}
 	var cacheHit bool
@@ -335,7 +497,7 @@ func cacheGetPeers(dbID proto.DatabaseID, privKey *asymmetric.PrivateKey) (peers
 	return getPeers(dbID, privKey)
 }
 
-func getPeers(dbID proto.DatabaseID, privKey *asymmetric.PrivateKey) (peers *proto.Peers, err error) {
+func getPeers(dbID proto.DatabaseID, privKey asymmetric.Signer) (peers *proto.Peers, err error) {
 	req := new(types.GetDatabaseRequest)
 	req.Header.DatabaseID = dbID
 
@@ -21,7 +21,9 @@ import (
 	"sync/atomic"
 	"testing"
 
+	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -83,6 +85,32 @@ func TestDrop(t *testing.T) {
 	})
 }
 
+func TestUpdate(t *testing.T) {
+	Convey("test update", t, func() {
+		var stopTestService func()
+		var err error
+		stopTestService, _, err = startTestService()
+		So(err, ShouldBeNil)
+		defer stopTestService()
+
+		var op types.DatabaseOperation
+		op, err = Update("covenantsql://db", ResourceMeta{Node: 2}, "node1")
+		So(err, ShouldBeNil)
+		So(op.DatabaseID, ShouldEqual, "db")
+		So(op.DrainNodes, ShouldResemble, []proto.NodeID{"node1"})
+
+		var ops []types.DatabaseOperation
+		_, ops, err = Operations("covenantsql://db")
+		So(err, ShouldBeNil)
+		So(ops, ShouldHaveLength, 1)
+		So(ops[0].DatabaseID, ShouldEqual, "db")
+		So(ops[0].State, ShouldEqual, types.OperationDone)
+
+		_, err = Update("invalid dsn", ResourceMeta{Node: 2})
+		So(err, ShouldNotBeNil)
+	})
+}
+
 func TestGetCovenantCoinBalance(t *testing.T) {
 	Convey("test get covenant coin balance", t, func() {
 		var stopTestService func()
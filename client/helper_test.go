@@ -77,6 +77,29 @@ func (s *stubBPDBService) DropDatabase(req *types.DropDatabaseRequest, resp *typ
 	return
 }
 
+func (s *stubBPDBService) UpdateDatabase(req *types.UpdateDatabaseRequest, resp *types.UpdateDatabaseResponse) (err error) {
+	if err = req.Verify(); err != nil {
+		return
+	}
+	resp.Operation = types.DatabaseOperation{
+		DatabaseID: req.Header.DatabaseID,
+		Type:       types.OperationUpdate,
+		DrainNodes: req.Header.DrainNodes,
+	}
+	return
+}
+
+func (s *stubBPDBService) GetDatabaseOperations(req *types.DatabaseOperationsRequest, resp *types.DatabaseOperationsResponse) (err error) {
+	resp.Operations = []types.DatabaseOperation{
+		{
+			DatabaseID: req.DatabaseID,
+			Type:       types.OperationUpdate,
+			State:      types.OperationDone,
+		},
+	}
+	return
+}
+
 func (s *stubBPDBService) GetDatabase(req *types.GetDatabaseRequest, resp *types.GetDatabaseResponse) (err error) {
 	if resp.Header.InstanceMeta, err = s.getInstanceMeta(req.Header.DatabaseID); err != nil {
 		return
@@ -21,7 +21,10 @@ import (
 	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/auth"
 	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/config"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 )
@@ -34,6 +37,9 @@ func init() {
 	adminRoutes.Use(adminPrivilegeChecker)
 	adminRoutes.HandleFunc("/create", api.CreateDatabase).Methods("POST")
 	adminRoutes.HandleFunc("/drop", api.DropDatabase).Methods("DELETE")
+	adminRoutes.HandleFunc("/apikey", api.ListAPIKeys).Methods("GET")
+	adminRoutes.HandleFunc("/apikey", api.IssueAPIKey).Methods("POST")
+	adminRoutes.HandleFunc("/apikey", api.RevokeAPIKey).Methods("DELETE")
 }
 
 func adminPrivilegeChecker(next http.Handler) http.Handler {
@@ -111,3 +117,147 @@ func (a *adminAPI) DropDatabase(rw http.ResponseWriter, r *http.Request) {
 		"data":    map[string]interface{}{},
 	})
 }
+
+// IssueAPIKey defines issue api key admin API.
+func (a *adminAPI) IssueAPIKey(rw http.ResponseWriter, r *http.Request) {
+	store := getAuthStore(rw)
+	if store == nil {
+		return
+	}
+
+	var err error
+	key := &auth.APIKey{
+		Name:            r.FormValue("name"),
+		ReadOnly:        r.FormValue("readonly") == "true",
+		CertFingerprint: strings.ToLower(strings.Replace(r.FormValue("cert_fingerprint"), ":", "", -1)),
+	}
+
+	defer func() {
+		log.WithFields(log.Fields{
+			"key":  key.ID,
+			"name": key.Name,
+		}).WithError(err).Debug("issue api key")
+	}()
+
+	if databases := r.FormValue("databases"); databases != "" {
+		for _, dbID := range strings.Split(databases, ",") {
+			if dbID = strings.TrimSpace(dbID); !dbIDRegex.MatchString(dbID) {
+				sendResponse(http.StatusBadRequest, false, "Invalid database id", nil, rw)
+				return
+			}
+			key.Databases = append(key.Databases, dbID)
+		}
+	}
+
+	if v := r.FormValue("rate"); v != "" {
+		if key.RateLimit, err = strconv.ParseFloat(v, 64); err != nil || key.RateLimit < 0 {
+			sendResponse(http.StatusBadRequest, false, "Invalid rate limit supplied", nil, rw)
+			return
+		}
+	}
+	if v := r.FormValue("burst"); v != "" {
+		if key.RateBurst, err = strconv.Atoi(v); err != nil || key.RateBurst < 0 {
+			sendResponse(http.StatusBadRequest, false, "Invalid rate burst supplied", nil, rw)
+			return
+		}
+	}
+	if v := r.FormValue("daily_queries"); v != "" {
+		if key.DailyQueries, err = strconv.ParseUint(v, 10, 64); err != nil {
+			sendResponse(http.StatusBadRequest, false, "Invalid daily queries quota supplied", nil, rw)
+			return
+		}
+	}
+	if v := r.FormValue("daily_bytes"); v != "" {
+		if key.DailyBytes, err = strconv.ParseUint(v, 10, 64); err != nil {
+			sendResponse(http.StatusBadRequest, false, "Invalid daily bytes quota supplied", nil, rw)
+			return
+		}
+	}
+
+	var token string
+	if token, err = store.Issue(key); err != nil {
+		sendResponse(http.StatusInternalServerError, false, err, nil, rw)
+		return
+	}
+
+	sendResponse(http.StatusCreated, true, nil, map[string]interface{}{
+		"id":  key.ID,
+		"key": token,
+	}, rw)
+}
+
+// RevokeAPIKey defines revoke api key admin API.
+func (a *adminAPI) RevokeAPIKey(rw http.ResponseWriter, r *http.Request) {
+	store := getAuthStore(rw)
+	if store == nil {
+		return
+	}
+
+	id := r.FormValue("id")
+	err := store.Revoke(id)
+
+	log.WithField("key", id).WithError(err).Debug("revoke api key")
+
+	if err == auth.ErrKeyNotFound {
+		sendResponse(http.StatusNotFound, false, err, nil, rw)
+		return
+	} else if err != nil {
+		sendResponse(http.StatusInternalServerError, false, err, nil, rw)
+		return
+	}
+
+	sendResponse(http.StatusOK, true, nil, map[string]interface{}{}, rw)
+}
+
+// ListAPIKeys defines list api keys with today usage admin API.
+func (a *adminAPI) ListAPIKeys(rw http.ResponseWriter, r *http.Request) {
+	store := getAuthStore(rw)
+	if store == nil {
+		return
+	}
+
+	keys, err := store.List()
+	if err != nil {
+		sendResponse(http.StatusInternalServerError, false, err, nil, rw)
+		return
+	}
+
+	now := time.Now()
+	result := make([]map[string]interface{}, 0, len(keys))
+
+	for _, key := range keys {
+		var usage *auth.Usage
+		if usage, err = store.GetUsage(key.ID, now); err != nil {
+			sendResponse(http.StatusInternalServerError, false, err, nil, rw)
+			return
+		}
+
+		result = append(result, map[string]interface{}{
+			"id":               key.ID,
+			"name":             key.Name,
+			"cert_fingerprint": key.CertFingerprint,
+			"databases":        key.Databases,
+			"readonly":         key.ReadOnly,
+			"rate":             key.RateLimit,
+			"burst":            key.RateBurst,
+			"daily_queries":    key.DailyQueries,
+			"daily_bytes":      key.DailyBytes,
+			"created":          key.Created,
+			"revoked":          key.Revoked,
+			"used_queries":     usage.Queries,
+			"used_bytes":       usage.Bytes,
+		})
+	}
+
+	sendResponse(http.StatusOK, true, nil, map[string]interface{}{
+		"keys": result,
+	}, rw)
+}
+
+func getAuthStore(rw http.ResponseWriter) *auth.Store {
+	store := config.GetConfig().AuthStore
+	if store == nil {
+		sendResponse(http.StatusNotImplemented, false, "Api key store is not configured", nil, rw)
+	}
+	return store
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/auth"
+	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/config"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// apiKeyContextKey defines the request context key of authenticated api key.
+type apiKeyContextKey struct{}
+
+func init() {
+	GetV1Router().Use(apiKeyChecker)
+	GetV2Router().Use(apiKeyChecker)
+}
+
+// apiKeyChecker authenticates api key from request header or client certificate,
+// applies rate limits and quotas, and records the usage after request is served.
+func apiKeyChecker(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		store := config.GetConfig().AuthStore
+		if store == nil {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		key, err := lookupAPIKey(store, r)
+		if err != nil {
+			sendResponse(http.StatusUnauthorized, false, err, nil, rw)
+			return
+		}
+		if key == nil {
+			// fallback to certificate privileges
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		if err = store.Acquire(key); err != nil {
+			log.WithField("key", key.ID).WithError(err).Debug("api key throttled")
+			sendResponse(http.StatusTooManyRequests, false, err, nil, rw)
+			return
+		}
+
+		cw := &countingResponseWriter{ResponseWriter: rw}
+		next.ServeHTTP(cw, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+
+		if err = store.Record(key.ID, cw.written); err != nil {
+			log.WithField("key", key.ID).WithError(err).Warning("record api key usage failed")
+		}
+	})
+}
+
+func lookupAPIKey(store *auth.Store, r *http.Request) (key *auth.APIKey, err error) {
+	token := r.Header.Get("X-API-Key")
+	if token == "" {
+		if authz := r.Header.Get("Authorization"); strings.HasPrefix(authz, "Bearer ") {
+			token = strings.TrimSpace(strings.TrimPrefix(authz, "Bearer "))
+		}
+	}
+
+	if token != "" {
+		return store.Authenticate(token)
+	}
+
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return
+	}
+
+	if key, err = store.GetByCert(r.TLS.PeerCertificates[0]); err == auth.ErrKeyNotFound {
+		err = nil
+	}
+
+	return
+}
+
+func getAPIKey(r *http.Request) *auth.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey{}).(*auth.APIKey)
+	return key
+}
+
+// checkPrivilege checks the database access privilege using api key scope if presents,
+// or the certificate privileges otherwise.
+func checkPrivilege(rw http.ResponseWriter, r *http.Request, dbID string, write bool) bool {
+	if key := getAPIKey(r); key != nil {
+		if err := key.CheckDatabase(dbID, write); err != nil {
+			sendResponse(http.StatusForbidden, false, err, nil, rw)
+			return false
+		}
+		return true
+	}
+
+	if write && !hasWritePrivilege(r) {
+		// forbidden
+		sendResponse(http.StatusForbidden, false, nil, nil, rw)
+		return false
+	}
+
+	return true
+}
+
+// countingResponseWriter counts the response body bytes for byte quota.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	written uint64
+}
+
+func (w *countingResponseWriter) Write(p []byte) (n int, err error) {
+	n, err = w.ResponseWriter.Write(p)
+	w.written += uint64(n)
+	return
+}
+
+// Flush implements the http.Flusher interface for streaming response.
+func (w *countingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,28 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import "github.com/pkg/errors"
+
+var (
+	// ErrInvalidArgs defines error on args not being json array or object.
+	ErrInvalidArgs = errors.New("args should be an array or an object")
+	// ErrInvalidArgValue defines error on unsupported arg value type.
+	ErrInvalidArgValue = errors.New("arg value should be number, string, boolean or null")
+	// ErrEmptyBatch defines error on batch request without queries.
+	ErrEmptyBatch = errors.New("empty batch queries")
+)
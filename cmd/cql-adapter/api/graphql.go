@@ -0,0 +1,129 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/config"
+	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/graphql"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+const (
+	// graphQLSchemaCheckInterval defines the interval to verify cached schema against database.
+	graphQLSchemaCheckInterval = 10 * time.Second
+)
+
+var (
+	// graphQLSchemas caches generated graphql schemas of databases.
+	graphQLSchemas = graphql.NewSchemaCache(graphQLSchemaCheckInterval)
+)
+
+func init() {
+	var api graphQLAPI
+
+	// add routes
+	graphQLRoutes := GetV1Router().PathPrefix("/graphql").Subrouter()
+	graphQLRoutes.Use(graphQLEnabledChecker)
+	graphQLRoutes.HandleFunc("", api.Query).Methods("POST")
+	graphQLRoutes.HandleFunc("/schema", api.Schema).Methods("GET")
+}
+
+func graphQLEnabledChecker(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !config.GetConfig().EnableGraphQL {
+			sendResponse(http.StatusNotFound, false, "GraphQL is not enabled", nil, rw)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// graphQLAPI defines graphql query and mutation generated from database schema.
+type graphQLAPI struct{}
+
+// Query defines graphql query and mutation api.
+func (a *graphQLAPI) Query(rw http.ResponseWriter, r *http.Request) {
+	dbID := getDatabaseID(rw, r)
+	if dbID == "" {
+		return
+	}
+
+	var req graphql.Request
+	dec := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxV2RequestSize))
+	dec.UseNumber()
+	if err := dec.Decode(&req); err != nil {
+		sendGraphQLError(http.StatusBadRequest, err, rw)
+		return
+	}
+
+	exec, err := graphql.Prepare(&req)
+	if err != nil {
+		sendGraphQLError(http.StatusBadRequest, err, rw)
+		return
+	}
+
+	if !checkPrivilege(rw, r, dbID, exec.IsMutation()) {
+		return
+	}
+
+	storageInstance := config.GetConfig().StorageInstance
+	schema, err := graphQLSchemas.Get(storageInstance, dbID)
+	if err != nil {
+		sendGraphQLError(http.StatusInternalServerError, err, rw)
+		return
+	}
+
+	log.WithField("db", dbID).WithField("query", req.Query).Info("got graphql query")
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(exec.Execute(storageInstance, dbID, schema))
+}
+
+// Schema defines api returning the generated schema in graphql schema definition language.
+func (a *graphQLAPI) Schema(rw http.ResponseWriter, r *http.Request) {
+	dbID := getDatabaseID(rw, r)
+	if dbID == "" {
+		return
+	}
+
+	if !checkPrivilege(rw, r, dbID, false) {
+		return
+	}
+
+	schema, err := graphQLSchemas.Get(config.GetConfig().StorageInstance, dbID)
+	if err != nil {
+		sendResponse(http.StatusInternalServerError, false, err, nil, rw)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte(schema.SDL()))
+}
+
+func sendGraphQLError(code int, err error, rw http.ResponseWriter) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(&graphql.Response{
+		Errors: []*graphql.Error{{Message: err.Error()}},
+	})
+}
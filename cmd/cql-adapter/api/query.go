@@ -17,7 +17,6 @@
 package api
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/config"
@@ -47,6 +46,10 @@ func (a *queryAPI) Query(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !checkPrivilege(rw, r, dbID, false) {
+		return
+	}
+
 	log.WithField("db", dbID).WithField("query", query).Info("got query")
 
 	assoc := r.FormValue("assoc")
@@ -61,11 +64,7 @@ func (a *queryAPI) Query(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	// assign names to empty columns
-	for i, c := range columns {
-		if c == "" {
-			columns[i] = fmt.Sprintf("_c%d", i)
-		}
-	}
+	columns = fillColumnNames(columns)
 
 	if assoc == "" {
 		sendResponse(http.StatusOK, true, nil, map[string]interface{}{
@@ -98,34 +97,6 @@ func (a *queryAPI) Query(rw http.ResponseWriter, r *http.Request) {
 
 // Exec defines write query for database.
 func (a *queryAPI) Write(rw http.ResponseWriter, r *http.Request) {
-	// check privilege
-	hasPrivilege := false
-	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
-		cert := r.TLS.PeerCertificates[0]
-
-		for _, privilegedCert := range config.GetConfig().WriteCertificates {
-			if cert.Equal(privilegedCert) {
-				hasPrivilege = true
-				break
-			}
-		}
-
-		if !hasPrivilege {
-			for _, privilegedCert := range config.GetConfig().AdminCertificates {
-				if cert.Equal(privilegedCert) {
-					hasPrivilege = true
-					break
-				}
-			}
-		}
-	}
-
-	// forbidden
-	if !hasPrivilege {
-		sendResponse(http.StatusForbidden, false, nil, nil, rw)
-		return
-	}
-
 	query := buildQuery(rw, r)
 	if query == "" {
 		return
@@ -136,6 +107,11 @@ func (a *queryAPI) Write(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// check privilege
+	if !checkPrivilege(rw, r, dbID, true) {
+		return
+	}
+
 	log.WithField("db", dbID).WithField("query", query).Info("got exec")
 
 	var err error
@@ -146,6 +122,8 @@ func (a *queryAPI) Write(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	graphQLSchemas.InvalidateOnDDL(dbID, query)
+
 	sendResponse(http.StatusOK, true, nil, map[string]interface{}{
 		"last_insert_id": lastInsertID,
 		"affected_rows":  affectedRows,
@@ -0,0 +1,341 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/config"
+	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/storage"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxV2RequestSize defines the max json request body size of v2 api.
+	maxV2RequestSize = 32 << 20
+	// ndjsonContentType defines the content type of streaming response.
+	ndjsonContentType = "application/x-ndjson"
+	// ndjsonFlushRows defines the row count between two flushes of streaming response.
+	ndjsonFlushRows = 100
+)
+
+func init() {
+	var api queryV2API
+
+	// add routes
+	GetV2Router().HandleFunc("/query", api.Query).Methods("POST")
+	GetV2Router().HandleFunc("/exec", api.Exec).Methods("POST")
+	GetV2Router().HandleFunc("/batch", api.Batch).Methods("POST")
+}
+
+// queryV2API defines json api with bind arguments, atomic batch and streaming results.
+type queryV2API struct{}
+
+// v2Statement defines a single query pattern with positional or named args.
+//
+// Positional args are supplied as json array, named args are supplied as json object,
+// the name could be prefixed with one of ":", "@" or "$" as sqlite does.
+type v2Statement struct {
+	Query string          `json:"query"`
+	Args  json.RawMessage `json:"args,omitempty"`
+}
+
+// v2QueryRequest defines the request body of query/exec api.
+type v2QueryRequest struct {
+	v2Statement
+	Database string `json:"database"`
+	Stream   bool   `json:"stream,omitempty"`
+}
+
+// v2BatchRequest defines the request body of batch api.
+type v2BatchRequest struct {
+	Database string        `json:"database"`
+	Queries  []v2Statement `json:"queries"`
+}
+
+// Query defines read query with args for database.
+func (a *queryV2API) Query(rw http.ResponseWriter, r *http.Request) {
+	var req v2QueryRequest
+	if !decodeV2Request(rw, r, &req) {
+		return
+	}
+
+	dbID := getV2DatabaseID(rw, r, req.Database)
+	if dbID == "" {
+		return
+	}
+
+	if !checkPrivilege(rw, r, dbID, false) {
+		return
+	}
+
+	q, err := buildV2Query(&req.v2Statement)
+	if err != nil {
+		sendResponse(http.StatusBadRequest, false, err, nil, rw)
+		return
+	}
+
+	log.WithField("db", dbID).WithField("query", q.Pattern).Info("got v2 query")
+
+	if req.Stream || strings.Contains(r.Header.Get("Accept"), ndjsonContentType) {
+		streamQuery(rw, config.GetConfig().StorageInstance, dbID, q)
+		return
+	}
+
+	var columns, types []string
+	var rows [][]interface{}
+	if columns, types, rows, err = config.GetConfig().StorageInstance.Query(dbID, q.Pattern, q.Args...); err != nil {
+		sendResponse(http.StatusInternalServerError, false, err, nil, rw)
+		return
+	}
+
+	sendResponse(http.StatusOK, true, nil, map[string]interface{}{
+		"types":   types,
+		"columns": fillColumnNames(columns),
+		"rows":    rows,
+	}, rw)
+}
+
+// Exec defines write query with args for database.
+func (a *queryV2API) Exec(rw http.ResponseWriter, r *http.Request) {
+	var req v2QueryRequest
+	if !decodeV2Request(rw, r, &req) {
+		return
+	}
+
+	dbID := getV2DatabaseID(rw, r, req.Database)
+	if dbID == "" {
+		return
+	}
+
+	if !checkPrivilege(rw, r, dbID, true) {
+		return
+	}
+
+	q, err := buildV2Query(&req.v2Statement)
+	if err != nil {
+		sendResponse(http.StatusBadRequest, false, err, nil, rw)
+		return
+	}
+
+	log.WithField("db", dbID).WithField("query", q.Pattern).Info("got v2 exec")
+
+	var affectedRows, lastInsertID int64
+	if affectedRows, lastInsertID, err = config.GetConfig().StorageInstance.Exec(dbID, q.Pattern, q.Args...); err != nil {
+		sendResponse(http.StatusInternalServerError, false, err, nil, rw)
+		return
+	}
+
+	graphQLSchemas.InvalidateOnDDL(dbID, q.Pattern)
+
+	sendResponse(http.StatusOK, true, nil, map[string]interface{}{
+		"last_insert_id": lastInsertID,
+		"affected_rows":  affectedRows,
+	}, rw)
+}
+
+// Batch defines atomic multi write queries for database, all queries are sent in one write request.
+func (a *queryV2API) Batch(rw http.ResponseWriter, r *http.Request) {
+	var req v2BatchRequest
+	if !decodeV2Request(rw, r, &req) {
+		return
+	}
+
+	dbID := getV2DatabaseID(rw, r, req.Database)
+	if dbID == "" {
+		return
+	}
+
+	if !checkPrivilege(rw, r, dbID, true) {
+		return
+	}
+
+	if len(req.Queries) == 0 {
+		sendResponse(http.StatusBadRequest, false, ErrEmptyBatch, nil, rw)
+		return
+	}
+
+	queries := make([]storage.Query, 0, len(req.Queries))
+	for i := range req.Queries {
+		q, err := buildV2Query(&req.Queries[i])
+		if err != nil {
+			sendResponse(http.StatusBadRequest, false, errors.Wrapf(err, "query #%d", i), nil, rw)
+			return
+		}
+		queries = append(queries, *q)
+	}
+
+	log.WithField("db", dbID).WithField("count", len(queries)).Info("got v2 batch")
+
+	if err := config.GetConfig().StorageInstance.ExecBatch(dbID, queries); err != nil {
+		sendResponse(http.StatusInternalServerError, false, err, nil, rw)
+		return
+	}
+
+	for _, q := range queries {
+		graphQLSchemas.InvalidateOnDDL(dbID, q.Pattern)
+	}
+
+	sendResponse(http.StatusOK, true, nil, map[string]interface{}{
+		"count": len(queries),
+	}, rw)
+}
+
+// streamQuery writes query result as newline delimited json,
+// the first line contains columns and types, each following line contains a row.
+func streamQuery(rw http.ResponseWriter, st storage.Storage, dbID string, q *storage.Query) {
+	var (
+		headerSent bool
+		rowCount   int
+		enc        = json.NewEncoder(rw)
+		flusher, _ = rw.(http.Flusher)
+	)
+
+	err := st.QueryEach(dbID, q.Pattern, q.Args,
+		func(columns []string, types []string) error {
+			rw.Header().Set("Content-Type", ndjsonContentType)
+			rw.WriteHeader(http.StatusOK)
+			headerSent = true
+			return enc.Encode(map[string]interface{}{
+				"types":   types,
+				"columns": fillColumnNames(columns),
+			})
+		},
+		func(row []interface{}) (err error) {
+			if err = enc.Encode(row); err != nil {
+				return
+			}
+			if rowCount++; flusher != nil && rowCount%ndjsonFlushRows == 0 {
+				flusher.Flush()
+			}
+			return
+		},
+	)
+
+	if err != nil {
+		log.WithField("db", dbID).WithField("rows", rowCount).WithError(err).Warning("stream query failed")
+
+		if !headerSent {
+			sendResponse(http.StatusInternalServerError, false, err, nil, rw)
+			return
+		}
+
+		// status code is already sent, report error in trailing line
+		enc.Encode(map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+func decodeV2Request(rw http.ResponseWriter, r *http.Request, req interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxV2RequestSize))
+	if err := dec.Decode(req); err != nil {
+		sendResponse(http.StatusBadRequest, false, errors.Wrap(err, "decode request failed"), nil, rw)
+		return false
+	}
+
+	return true
+}
+
+func getV2DatabaseID(rw http.ResponseWriter, r *http.Request, database string) string {
+	if database != "" {
+		return validateDatabaseID(database, rw)
+	}
+
+	return getDatabaseID(rw, r)
+}
+
+func buildV2Query(stmt *v2Statement) (q *storage.Query, err error) {
+	if stmt.Query == "" {
+		err = errors.New("missing query")
+		return
+	}
+
+	q = &storage.Query{
+		Pattern: stmt.Query,
+	}
+
+	q.Args, err = parseV2Args(stmt.Args)
+	return
+}
+
+func parseV2Args(raw json.RawMessage) (args []interface{}, err error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var v interface{}
+	if err = dec.Decode(&v); err != nil {
+		return
+	}
+
+	switch vs := v.(type) {
+	case []interface{}:
+		args = make([]interface{}, len(vs))
+		for i, arg := range vs {
+			if args[i], err = convertV2Arg(arg); err != nil {
+				return
+			}
+		}
+	case map[string]interface{}:
+		names := make([]string, 0, len(vs))
+		for name := range vs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		args = make([]interface{}, 0, len(vs))
+		for _, name := range names {
+			var arg interface{}
+			if arg, err = convertV2Arg(vs[name]); err != nil {
+				return
+			}
+			args = append(args, sql.Named(strings.TrimLeft(name, ":@$"), arg))
+		}
+	default:
+		err = ErrInvalidArgs
+	}
+
+	return
+}
+
+func convertV2Arg(v interface{}) (arg interface{}, err error) {
+	switch tv := v.(type) {
+	case json.Number:
+		if i, convErr := tv.Int64(); convErr == nil {
+			arg = i
+		} else {
+			arg, err = tv.Float64()
+		}
+	case string, bool, nil:
+		arg = tv
+	default:
+		err = ErrInvalidArgValue
+	}
+
+	return
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/storage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseV2Args(t *testing.T) {
+	Convey("test v2 args parsing", t, func() {
+		cases := []struct {
+			name string
+			raw  string
+			args []interface{}
+			err  error
+		}{
+			{name: "empty", raw: ""},
+			{name: "null", raw: "null"},
+			{
+				name: "positional",
+				raw:  `[1, 1.5, "a", true, null, 9007199254740993]`,
+				args: []interface{}{int64(1), 1.5, "a", true, nil, int64(9007199254740993)},
+			},
+			{
+				name: "named sorted with prefixes trimmed",
+				raw:  `{"$c": null, ":a": 1, "@b": "x", "d": false}`,
+				args: []interface{}{
+					sql.Named("c", nil), sql.Named("a", int64(1)), sql.Named("b", "x"), sql.Named("d", false),
+				},
+			},
+			{name: "scalar", raw: `1`, err: ErrInvalidArgs},
+			{name: "string", raw: `"a"`, err: ErrInvalidArgs},
+			{name: "nested array", raw: `[[1]]`, err: ErrInvalidArgValue},
+			{name: "nested object", raw: `{"a": {"b": 1}}`, err: ErrInvalidArgValue},
+			{name: "mixing named in positional", raw: `[1, {"a": 2}]`, err: ErrInvalidArgValue},
+			{name: "mixing positional in named", raw: `{"a": [1]}`, err: ErrInvalidArgValue},
+		}
+
+		for _, c := range cases {
+			Convey(c.name, func() {
+				args, err := parseV2Args(json.RawMessage(c.raw))
+				So(err, ShouldEqual, c.err)
+				if c.err == nil {
+					So(args, ShouldResemble, c.args)
+				}
+			})
+		}
+
+		Convey("malformed", func() {
+			_, err := parseV2Args(json.RawMessage(`[1,`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestConvertV2Arg(t *testing.T) {
+	Convey("test v2 arg conversion", t, func() {
+		cases := []struct {
+			v   interface{}
+			arg interface{}
+			err error
+		}{
+			{v: json.Number("42"), arg: int64(42)},
+			{v: json.Number("-1"), arg: int64(-1)},
+			{v: json.Number("1e3"), arg: float64(1000)},
+			{v: json.Number("0.25"), arg: 0.25},
+			{v: "s", arg: "s"},
+			{v: false, arg: false},
+			{v: nil, arg: nil},
+			{v: float64(1), err: ErrInvalidArgValue},
+			{v: []interface{}{}, err: ErrInvalidArgValue},
+			{v: map[string]interface{}{}, err: ErrInvalidArgValue},
+		}
+
+		for _, c := range cases {
+			arg, err := convertV2Arg(c.v)
+			So(err, ShouldEqual, c.err)
+			So(arg, ShouldResemble, c.arg)
+		}
+
+		_, err := convertV2Arg(json.Number("1x"))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestStreamQuery(t *testing.T) {
+	Convey("test ndjson streaming query", t, func() {
+		dir, err := ioutil.TempDir("", "adapter_api")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		st, err := storage.NewSQLite3Storage(dir)
+		So(err, ShouldBeNil)
+		dbID, err := st.Create(1)
+		So(err, ShouldBeNil)
+		err = st.ExecBatch(dbID, []storage.Query{
+			{Pattern: "CREATE TABLE t (id INTEGER, v TEXT)"},
+			{Pattern: "INSERT INTO t VALUES (1, 'a'), (2, 'b'), (3, 'c')"},
+		})
+		So(err, ShouldBeNil)
+
+		readLines := func(rec *httptest.ResponseRecorder) (lines []map[string]interface{}, rows [][]interface{}) {
+			scanner := bufio.NewScanner(rec.Body)
+			for scanner.Scan() {
+				var v interface{}
+				So(json.Unmarshal(scanner.Bytes(), &v), ShouldBeNil)
+				switch tv := v.(type) {
+				case map[string]interface{}:
+					lines = append(lines, tv)
+				case []interface{}:
+					rows = append(rows, tv)
+				}
+			}
+			return
+		}
+
+		Convey("header and rows", func() {
+			rec := httptest.NewRecorder()
+			streamQuery(rec, st, dbID, &storage.Query{
+				Pattern: "SELECT id, v, NULL FROM t WHERE id >= ? ORDER BY id",
+				Args:    []interface{}{int64(2)},
+			})
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(rec.Header().Get("Content-Type"), ShouldEqual, ndjsonContentType)
+			lines, rows := readLines(rec)
+			So(lines, ShouldHaveLength, 1)
+			So(lines[0]["columns"], ShouldResemble, []interface{}{"id", "v", "NULL"})
+			So(lines[0]["types"], ShouldHaveLength, 3)
+			So(rows, ShouldResemble, [][]interface{}{{float64(2), "b", nil}, {float64(3), "c", nil}})
+		})
+
+		Convey("trailing error line", func() {
+			// integer overflow is raised on stepping the third row, rows are scanned in rowid order
+			rec := httptest.NewRecorder()
+			streamQuery(rec, st, dbID, &storage.Query{
+				Pattern: "SELECT CASE WHEN id = 3 THEN abs(-9223372036854775807 - 1) ELSE id END FROM t",
+			})
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			lines, rows := readLines(rec)
+			So(rows, ShouldResemble, [][]interface{}{{float64(1)}, {float64(2)}})
+			So(lines, ShouldHaveLength, 2)
+			So(lines[0], ShouldContainKey, "columns")
+			So(lines[1]["error"], ShouldContainSubstring, "overflow")
+		})
+
+		Convey("error before header", func() {
+			rec := httptest.NewRecorder()
+			streamQuery(rec, st, dbID, &storage.Query{Pattern: "SELECT * FROM not_exists"})
+			So(rec.Code, ShouldEqual, http.StatusInternalServerError)
+			So(rec.Header().Get("Content-Type"), ShouldNotEqual, ndjsonContentType)
+			lines, rows := readLines(rec)
+			So(rows, ShouldBeEmpty)
+			So(lines, ShouldHaveLength, 1)
+			So(lines[0]["success"], ShouldBeFalse)
+		})
+	})
+}
@@ -27,6 +27,8 @@ var (
 	router = mux.NewRouter()
 	// v1Router defines router with api v1 prefix.
 	v1Router = router.PathPrefix("/v1").Subrouter()
+	// v2Router defines router with api v2 prefix.
+	v2Router = router.PathPrefix("/v2").Subrouter()
 )
 
 // GetRouter returns global server routes.
@@ -39,6 +41,11 @@ func GetV1Router() *mux.Router {
 	return v1Router
 }
 
+// GetV2Router returns server route with /v2 prefix.
+func GetV2Router() *mux.Router {
+	return v2Router
+}
+
 func init() {
 	GetRouter().HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
 		sendResponse(http.StatusOK, true, nil, nil, rw)
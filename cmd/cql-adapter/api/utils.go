@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+
+	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/config"
 )
 
 var (
@@ -51,6 +53,28 @@ func validateDatabaseID(dbID string, rw http.ResponseWriter) string {
 	return dbID
 }
 
+func hasWritePrivilege(r *http.Request) bool {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return false
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+
+	for _, privilegedCert := range config.GetConfig().WriteCertificates {
+		if cert.Equal(privilegedCert) {
+			return true
+		}
+	}
+
+	for _, privilegedCert := range config.GetConfig().AdminCertificates {
+		if cert.Equal(privilegedCert) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func buildQuery(rw http.ResponseWriter, r *http.Request) string {
 	// TODO(xq262144), support partial query and big query using application/octet-stream content-type
 	if query := r.FormValue("query"); query != "" {
@@ -61,6 +85,17 @@ func buildQuery(rw http.ResponseWriter, r *http.Request) string {
 	return ""
 }
 
+// assign names to empty columns.
+func fillColumnNames(columns []string) []string {
+	for i, c := range columns {
+		if c == "" {
+			columns[i] = fmt.Sprintf("_c%d", i)
+		}
+	}
+
+	return columns
+}
+
 func sendResponse(code int, success bool, msg interface{}, data interface{}, rw http.ResponseWriter) {
 	msgStr := "ok"
 	if msg != nil {
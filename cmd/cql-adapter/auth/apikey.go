@@ -0,0 +1,134 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// APIKey defines the access scope and limits of an issued key.
+type APIKey struct {
+	// ID is the public part of the key token, used as identity in logs and admin api.
+	ID string
+	// SecretHash is the sha256 digest of the secret part of the key token.
+	SecretHash []byte
+	// CertFingerprint binds the key to a client certificate identity, optional.
+	CertFingerprint string
+	Name            string
+	// Databases limits the key to the listed databases, empty for all databases.
+	Databases []string
+	ReadOnly  bool
+	// RateLimit is the allowed requests per second, 0 for no limit.
+	RateLimit float64
+	// RateBurst is the max burst requests allowed by rate limiter.
+	RateBurst int
+	// DailyQueries is the max query count per UTC day, 0 for no limit. Each request counts as
+	// one query, including the batch and multi-operation GraphQL requests.
+	DailyQueries uint64
+	// DailyBytes is the max response bytes per UTC day, 0 for no limit.
+	DailyBytes uint64
+	Created    time.Time
+	Revoked    bool
+}
+
+// Usage defines the daily usage of an api key.
+type Usage struct {
+	Queries uint64
+	Bytes   uint64
+}
+
+// CheckDatabase checks if the key could access the database with specified privilege.
+func (k *APIKey) CheckDatabase(dbID string, write bool) error {
+	if write && k.ReadOnly {
+		return ErrWriteNotPermitted
+	}
+
+	if len(k.Databases) == 0 {
+		return nil
+	}
+
+	for _, d := range k.Databases {
+		if d == dbID {
+			return nil
+		}
+	}
+
+	return ErrDatabaseNotPermitted
+}
+
+// CheckQuota checks if the daily usage exceeds the key quota.
+func (k *APIKey) CheckQuota(u *Usage) error {
+	if k.DailyQueries > 0 && u.Queries >= k.DailyQueries {
+		return ErrQuotaExceeded
+	}
+	if k.DailyBytes > 0 && u.Bytes >= k.DailyBytes {
+		return ErrQuotaExceeded
+	}
+
+	return nil
+}
+
+// CertFingerprint returns the identity fingerprint of a client certificate.
+func CertFingerprint(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(digest[:])
+}
+
+// limiter defines a token bucket rate limiter.
+type limiter struct {
+	sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return &limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+func (l *limiter) allow(now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+
+	l.tokens--
+	return true
+}
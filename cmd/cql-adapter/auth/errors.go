@@ -0,0 +1,38 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import "github.com/pkg/errors"
+
+var (
+	// ErrInvalidKey defines error on malformed or unknown api key.
+	ErrInvalidKey = errors.New("invalid api key")
+	// ErrKeyRevoked defines error on using a revoked api key.
+	ErrKeyRevoked = errors.New("api key revoked")
+	// ErrKeyNotFound defines error on api key not exists.
+	ErrKeyNotFound = errors.New("api key not found")
+	// ErrDuplicateCertificate defines error on binding a certificate already bound to another key.
+	ErrDuplicateCertificate = errors.New("certificate already bound to another key")
+	// ErrDatabaseNotPermitted defines error on accessing database out of key scope.
+	ErrDatabaseNotPermitted = errors.New("database not permitted for api key")
+	// ErrWriteNotPermitted defines error on sending write query using read-only key.
+	ErrWriteNotPermitted = errors.New("write not permitted for api key")
+	// ErrRateLimited defines error on exceeding request rate limit.
+	ErrRateLimited = errors.New("rate limit exceeded")
+	// ErrQuotaExceeded defines error on exceeding daily query or byte quota.
+	ErrQuotaExceeded = errors.New("daily quota exceeded")
+)
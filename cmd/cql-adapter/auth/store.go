@@ -0,0 +1,320 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	bolt "github.com/coreos/bbolt"
+)
+
+const (
+	keyIDLen     = 8
+	keySecretLen = 32
+	dayLayout    = "20060102"
+)
+
+// Bucket stores api keys and usages as follows
+/*
+[root]
+  |
+  |--[key]
+  |    |---> [id] => APIKey
+  |     \--> [id] => APIKey
+  |
+  |--[cert]
+  |    |---> [fingerprint] => id
+  |     \--> [fingerprint] => id
+  |
+   \-[usage]
+       |---> [id/yyyymmdd] => queries+bytes
+        \--> [id/yyyymmdd] => queries+bytes
+*/
+
+var (
+	// bolt db buckets
+	keyBucket   = []byte("key")
+	certBucket  = []byte("cert")
+	usageBucket = []byte("usage")
+)
+
+// Store defines the persistent api key store with in-memory rate limiters.
+type Store struct {
+	db       *bolt.DB
+	limiters sync.Map // map[string]*limiter
+}
+
+// NewStore opens or creates the api key store file.
+func NewStore(path string) (s *Store, err error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return
+	}
+
+	if err = db.Update(func(tx *bolt.Tx) (err error) {
+		if _, err = tx.CreateBucketIfNotExists(keyBucket); err != nil {
+			return
+		}
+		if _, err = tx.CreateBucketIfNotExists(certBucket); err != nil {
+			return
+		}
+		_, err = tx.CreateBucketIfNotExists(usageBucket)
+		return
+	}); err != nil {
+		db.Close()
+		return
+	}
+
+	s = &Store{db: db}
+	return
+}
+
+// Close closes the store.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Issue saves a new api key with the specified scope and limits, the returned token is shown only once.
+func (s *Store) Issue(key *APIKey) (token string, err error) {
+	id := make([]byte, keyIDLen)
+	secret := make([]byte, keySecretLen)
+	if _, err = rand.Read(id); err != nil {
+		return
+	}
+	if _, err = rand.Read(secret); err != nil {
+		return
+	}
+
+	secretHash := sha256.Sum256(secret)
+	key.ID = hex.EncodeToString(id)
+	key.SecretHash = secretHash[:]
+	key.Created = time.Now().UTC()
+	key.Revoked = false
+
+	if err = s.db.Update(func(tx *bolt.Tx) (err error) {
+		if key.CertFingerprint != "" {
+			cb := tx.Bucket(certBucket)
+			if cb.Get([]byte(key.CertFingerprint)) != nil {
+				return ErrDuplicateCertificate
+			}
+			if err = cb.Put([]byte(key.CertFingerprint), []byte(key.ID)); err != nil {
+				return
+			}
+		}
+		return putKey(tx, key)
+	}); err != nil {
+		return
+	}
+
+	token = key.ID + "." + hex.EncodeToString(secret)
+	return
+}
+
+// Revoke revokes the api key, the key record is kept for auditing.
+func (s *Store) Revoke(id string) (err error) {
+	err = s.db.Update(func(tx *bolt.Tx) (err error) {
+		var key *APIKey
+		if key, err = getKey(tx, id); err != nil {
+			return
+		}
+		if key.CertFingerprint != "" {
+			if err = tx.Bucket(certBucket).Delete([]byte(key.CertFingerprint)); err != nil {
+				return
+			}
+		}
+		key.Revoked = true
+		return putKey(tx, key)
+	})
+	if err == nil {
+		s.limiters.Delete(id)
+	}
+	return
+}
+
+// Get returns the api key by id.
+func (s *Store) Get(id string) (key *APIKey, err error) {
+	err = s.db.View(func(tx *bolt.Tx) (err error) {
+		key, err = getKey(tx, id)
+		return
+	})
+	return
+}
+
+// List returns all api keys including revoked ones.
+func (s *Store) List() (keys []*APIKey, err error) {
+	keys = make([]*APIKey, 0)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(keyBucket).ForEach(func(k, v []byte) (err error) {
+			var key *APIKey
+			if err = utils.DecodeMsgPack(v, &key); err != nil {
+				return
+			}
+			keys = append(keys, key)
+			return
+		})
+	})
+	return
+}
+
+// Authenticate returns the valid api key matching the token.
+func (s *Store) Authenticate(token string) (key *APIKey, err error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		err = ErrInvalidKey
+		return
+	}
+
+	var secret []byte
+	if secret, err = hex.DecodeString(parts[1]); err != nil {
+		err = ErrInvalidKey
+		return
+	}
+
+	if key, err = s.Get(parts[0]); err != nil {
+		if err == ErrKeyNotFound {
+			err = ErrInvalidKey
+		}
+		return
+	}
+
+	secretHash := sha256.Sum256(secret)
+	if subtle.ConstantTimeCompare(secretHash[:], key.SecretHash) != 1 {
+		key = nil
+		err = ErrInvalidKey
+		return
+	}
+
+	if key.Revoked {
+		key = nil
+		err = ErrKeyRevoked
+	}
+
+	return
+}
+
+// GetByCert returns the api key bound to the client certificate, ErrKeyNotFound is returned if not bound.
+func (s *Store) GetByCert(cert *x509.Certificate) (key *APIKey, err error) {
+	err = s.db.View(func(tx *bolt.Tx) (err error) {
+		id := tx.Bucket(certBucket).Get([]byte(CertFingerprint(cert)))
+		if id == nil {
+			return ErrKeyNotFound
+		}
+		key, err = getKey(tx, string(id))
+		return
+	})
+	if err == nil && key.Revoked {
+		key = nil
+		err = ErrKeyRevoked
+	}
+	return
+}
+
+// Acquire checks the rate limit and daily quota before serving a request of the key,
+// the request is counted in the daily usage in the same transaction as the quota check,
+// so concurrent requests could not exceed the quota. A request is counted as one query,
+// including the v2 batch and the GraphQL request with multiple operations.
+func (s *Store) Acquire(key *APIKey) (err error) {
+	now := time.Now().UTC()
+
+	if key.RateLimit > 0 {
+		l, _ := s.limiters.LoadOrStore(key.ID, newLimiter(key.RateLimit, key.RateBurst))
+		if !l.(*limiter).allow(now) {
+			return ErrRateLimited
+		}
+	}
+
+	usageKey := getUsageKey(key.ID, now)
+
+	return s.db.Update(func(tx *bolt.Tx) (err error) {
+		ub := tx.Bucket(usageBucket)
+		u := decodeUsage(ub.Get(usageKey))
+		if err = key.CheckQuota(u); err != nil {
+			return
+		}
+		u.Queries++
+		return ub.Put(usageKey, encodeUsage(u))
+	})
+}
+
+// Record adds the served response bytes to the daily usage of the key, the query of the
+// request is already counted by Acquire.
+func (s *Store) Record(id string, bytes uint64) error {
+	usageKey := getUsageKey(id, time.Now().UTC())
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		ub := tx.Bucket(usageBucket)
+		u := decodeUsage(ub.Get(usageKey))
+		u.Bytes += bytes
+		return ub.Put(usageKey, encodeUsage(u))
+	})
+}
+
+// GetUsage returns the usage of the key in the UTC day of the specified time.
+func (s *Store) GetUsage(id string, day time.Time) (u *Usage, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		u = decodeUsage(tx.Bucket(usageBucket).Get(getUsageKey(id, day)))
+		return nil
+	})
+	return
+}
+
+func getKey(tx *bolt.Tx, id string) (key *APIKey, err error) {
+	v := tx.Bucket(keyBucket).Get([]byte(id))
+	if v == nil {
+		err = ErrKeyNotFound
+		return
+	}
+	err = utils.DecodeMsgPack(v, &key)
+	return
+}
+
+func putKey(tx *bolt.Tx, key *APIKey) (err error) {
+	enc, err := utils.EncodeMsgPack(key)
+	if err != nil {
+		return
+	}
+	return tx.Bucket(keyBucket).Put([]byte(key.ID), enc.Bytes())
+}
+
+func getUsageKey(id string, day time.Time) []byte {
+	return []byte(id + "/" + day.UTC().Format(dayLayout))
+}
+
+func encodeUsage(u *Usage) (data []byte) {
+	data = make([]byte, 16)
+	binary.BigEndian.PutUint64(data[:8], u.Queries)
+	binary.BigEndian.PutUint64(data[8:], u.Bytes)
+	return
+}
+
+func decodeUsage(data []byte) (u *Usage) {
+	u = &Usage{}
+	if len(data) == 16 {
+		u.Queries = binary.BigEndian.Uint64(data[:8])
+		u.Bytes = binary.BigEndian.Uint64(data[8:])
+	}
+	return
+}
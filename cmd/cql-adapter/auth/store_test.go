@@ -0,0 +1,144 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStore(t *testing.T) {
+	Convey("test api key store", t, func() {
+		dir, err := ioutil.TempDir("", "adapter_auth")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		s, err := NewStore(filepath.Join(dir, "auth.db"))
+		So(err, ShouldBeNil)
+		defer s.Close()
+
+		cert := &x509.Certificate{Raw: []byte("test certificate")}
+		key := &APIKey{
+			Name:            "reader",
+			Databases:       []string{"db1"},
+			ReadOnly:        true,
+			DailyQueries:    2,
+			CertFingerprint: CertFingerprint(cert),
+		}
+		token, err := s.Issue(key)
+		So(err, ShouldBeNil)
+		So(token, ShouldStartWith, key.ID+".")
+
+		// duplicate certificate binding
+		_, err = s.Issue(&APIKey{CertFingerprint: key.CertFingerprint})
+		So(err, ShouldEqual, ErrDuplicateCertificate)
+
+		// authenticate
+		k, err := s.Authenticate(token)
+		So(err, ShouldBeNil)
+		So(k.Name, ShouldEqual, "reader")
+		_, err = s.Authenticate(token + "00")
+		So(err, ShouldEqual, ErrInvalidKey)
+		_, err = s.Authenticate("invalid")
+		So(err, ShouldEqual, ErrInvalidKey)
+		k, err = s.GetByCert(cert)
+		So(err, ShouldBeNil)
+		So(k.ID, ShouldEqual, key.ID)
+		_, err = s.GetByCert(&x509.Certificate{Raw: []byte("other")})
+		So(err, ShouldEqual, ErrKeyNotFound)
+
+		// scope
+		So(k.CheckDatabase("db1", false), ShouldBeNil)
+		So(k.CheckDatabase("db1", true), ShouldEqual, ErrWriteNotPermitted)
+		So(k.CheckDatabase("db2", false), ShouldEqual, ErrDatabaseNotPermitted)
+
+		// quota
+		So(s.Acquire(k), ShouldBeNil)
+		So(s.Record(k.ID, 100), ShouldBeNil)
+		So(s.Acquire(k), ShouldBeNil)
+		So(s.Record(k.ID, 100), ShouldBeNil)
+		So(s.Acquire(k), ShouldEqual, ErrQuotaExceeded)
+		u, err := s.GetUsage(k.ID, time.Now())
+		So(err, ShouldBeNil)
+		So(u.Queries, ShouldEqual, 2)
+		So(u.Bytes, ShouldEqual, 200)
+
+		// revoke
+		So(s.Revoke(k.ID), ShouldBeNil)
+		_, err = s.Authenticate(token)
+		So(err, ShouldEqual, ErrKeyRevoked)
+		_, err = s.GetByCert(cert)
+		So(err, ShouldEqual, ErrKeyNotFound)
+		So(s.Revoke("unknown"), ShouldEqual, ErrKeyNotFound)
+
+		keys, err := s.List()
+		So(err, ShouldBeNil)
+		So(keys, ShouldHaveLength, 1)
+		So(keys[0].Revoked, ShouldBeTrue)
+	})
+
+	Convey("test concurrent quota acquire", t, func() {
+		dir, err := ioutil.TempDir("", "adapter_auth")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		s, err := NewStore(filepath.Join(dir, "auth.db"))
+		So(err, ShouldBeNil)
+		defer s.Close()
+
+		key := &APIKey{Name: "burst", DailyQueries: 10}
+		_, err = s.Issue(key)
+		So(err, ShouldBeNil)
+
+		var (
+			wg       sync.WaitGroup
+			accepted int32
+		)
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if s.Acquire(key) == nil {
+					atomic.AddInt32(&accepted, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		So(accepted, ShouldEqual, 10)
+		u, err := s.GetUsage(key.ID, time.Now())
+		So(err, ShouldBeNil)
+		So(u.Queries, ShouldEqual, 10)
+	})
+
+	Convey("test rate limiter", t, func() {
+		l := newLimiter(1, 2)
+		now := time.Now()
+		So(l.allow(now), ShouldBeTrue)
+		So(l.allow(now), ShouldBeTrue)
+		So(l.allow(now), ShouldBeFalse)
+		So(l.allow(now.Add(time.Second)), ShouldBeTrue)
+		So(l.allow(now.Add(time.Second)), ShouldBeFalse)
+	})
+}
@@ -26,6 +26,7 @@ import (
 	"sync"
 
 	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/auth"
 	"github.com/CovenantSQL/CovenantSQL/cmd/cql-adapter/storage"
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
@@ -62,6 +63,13 @@ type Config struct {
 	StorageDriver   string          `yaml:"StorageDriver"` // sqlite3 or covenantsql
 	StorageRoot     string          `yaml:"StorageRoot"`
 	StorageInstance storage.Storage `yaml:"-"`
+
+	// graphql server mode
+	EnableGraphQL bool `yaml:"GraphQL"`
+
+	// api key store config, api key authorization is disabled if empty
+	AuthStorePath string      `yaml:"AuthStore"`
+	AuthStore     *auth.Store `yaml:"-"`
 }
 
 type confWrapper struct {
@@ -177,6 +185,15 @@ func LoadConfig(configPath string, password string) (config *Config, err error)
 		return
 	}
 
+	// load api key store
+	if config.AuthStorePath != "" {
+		authStorePath := filepath.Join(workingRoot, config.AuthStorePath)
+		if config.AuthStore, err = auth.NewStore(authStorePath); err != nil {
+			log.WithError(err).Error("open api key store failed")
+			return
+		}
+	}
+
 	currentConfigLock.Lock()
 	currentConfig = config
 	currentConfigLock.Unlock()
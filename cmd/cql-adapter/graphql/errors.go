@@ -0,0 +1,28 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import "github.com/pkg/errors"
+
+var (
+	// ErrSyntax defines error on invalid graphql document.
+	ErrSyntax = errors.New("graphql syntax error")
+	// ErrInvalidRequest defines error on request not matching generated schema.
+	ErrInvalidRequest = errors.New("invalid graphql request")
+	// ErrInvalidArgument defines error on invalid field argument.
+	ErrInvalidArgument = errors.New("invalid graphql argument")
+)
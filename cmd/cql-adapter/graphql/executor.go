@@ -0,0 +1,868 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	insertPrefix = "insert_"
+	updatePrefix = "update_"
+	deletePrefix = "delete_"
+)
+
+var comparisonOps = map[string]string{
+	"_eq":    "=",
+	"_neq":   "<>",
+	"_gt":    ">",
+	"_gte":   ">=",
+	"_lt":    "<",
+	"_lte":   "<=",
+	"_like":  "LIKE",
+	"_nlike": "NOT LIKE",
+}
+
+// Request defines the graphql request body.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Response defines the graphql response body.
+type Response struct {
+	Data   interface{} `json:"data"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Error defines a graphql error.
+type Error struct {
+	Message string   `json:"message"`
+	Path    []string `json:"path,omitempty"`
+}
+
+// Execution defines a prepared graphql operation.
+type Execution struct {
+	doc  *Document
+	op   *Operation
+	vars map[string]interface{}
+}
+
+// Prepare parses the request and selects the operation to execute.
+func Prepare(req *Request) (e *Execution, err error) {
+	var doc *Document
+	if doc, err = Parse(req.Query); err != nil {
+		return
+	}
+
+	e = &Execution{
+		doc:  doc,
+		vars: make(map[string]interface{}),
+	}
+
+	if req.OperationName == "" {
+		if len(doc.Operations) > 1 {
+			err = errors.Wrap(ErrInvalidRequest, "operation name is required for multiple operations")
+			return
+		}
+		e.op = doc.Operations[0]
+	} else {
+		for _, op := range doc.Operations {
+			if op.Name == req.OperationName {
+				e.op = op
+				break
+			}
+		}
+		if e.op == nil {
+			err = errors.Wrapf(ErrInvalidRequest, "operation %q not found", req.OperationName)
+			return
+		}
+	}
+
+	// apply variable default values and supplied values
+	for name, def := range e.op.Variables {
+		if v, ok := req.Variables[name]; ok {
+			e.vars[name] = normalizeJSONValue(v)
+		} else if def != nil {
+			if e.vars[name], err = e.resolve(def); err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// IsMutation reports whether the operation is a mutation.
+func (e *Execution) IsMutation() bool {
+	return e.op.Type == "mutation"
+}
+
+// Execute executes the operation against the schema of the database.
+func (e *Execution) Execute(q Querier, dbID string, s *Schema) (resp *Response) {
+	resp = &Response{}
+	data := &orderedMap{}
+	resp.Data = data
+
+	typeName := "Query"
+	if e.IsMutation() {
+		typeName = "Mutation"
+	}
+
+	fields, err := e.collectFields(e.op.Selections, make(map[string]bool))
+	if err != nil {
+		resp.Errors = append(resp.Errors, &Error{Message: err.Error()})
+		resp.Data = nil
+		return
+	}
+
+	// fields are resolved serially, required by mutation and harmless to query
+	for _, f := range fields {
+		var v interface{}
+		if f.Name == "__typename" {
+			v = typeName
+		} else if e.IsMutation() {
+			v, err = e.resolveMutation(q, dbID, s, f)
+		} else {
+			v, err = e.resolveQuery(q, dbID, s, f)
+		}
+		if err != nil {
+			resp.Errors = append(resp.Errors, &Error{Message: err.Error(), Path: []string{f.ResponseKey()}})
+			v = nil
+		}
+		data.set(f.ResponseKey(), v)
+	}
+
+	return
+}
+
+// collectFields flattens fragments and applies @include/@skip directives.
+func (e *Execution) collectFields(selections []Selection, visited map[string]bool) (fields []*Field, err error) {
+	for _, sel := range selections {
+		var include bool
+		switch s := sel.(type) {
+		case *Field:
+			if include, err = e.shouldInclude(s.Directives); err != nil {
+				return
+			}
+			if include {
+				fields = append(fields, s)
+			}
+		case *FragmentSpread:
+			if include, err = e.shouldInclude(s.Directives); err != nil || !include {
+				continue
+			}
+			if visited[s.Name] {
+				continue
+			}
+			frag, ok := e.doc.Fragments[s.Name]
+			if !ok {
+				err = errors.Wrapf(ErrInvalidRequest, "fragment %q not found", s.Name)
+				return
+			}
+			visited[s.Name] = true
+			var sub []*Field
+			if sub, err = e.collectFields(frag.Selections, visited); err != nil {
+				return
+			}
+			fields = append(fields, sub...)
+		case *InlineFragment:
+			if include, err = e.shouldInclude(s.Directives); err != nil || !include {
+				continue
+			}
+			var sub []*Field
+			if sub, err = e.collectFields(s.Selections, visited); err != nil {
+				return
+			}
+			fields = append(fields, sub...)
+		}
+	}
+
+	return
+}
+
+func (e *Execution) shouldInclude(directives []*Directive) (include bool, err error) {
+	include = true
+	for _, d := range directives {
+		if d.Name != "include" && d.Name != "skip" {
+			continue
+		}
+		var v interface{}
+		if v, err = e.resolve(d.Arguments["if"]); err != nil {
+			return
+		}
+		cond, ok := v.(bool)
+		if !ok {
+			err = errors.Wrapf(ErrInvalidArgument, "@%s requires boolean if argument", d.Name)
+			return
+		}
+		if (d.Name == "include" && !cond) || (d.Name == "skip" && cond) {
+			include = false
+		}
+	}
+	return
+}
+
+func (e *Execution) resolveQuery(q Querier, dbID string, s *Schema, f *Field) (result interface{}, err error) {
+	if f.Name == "__schema" || f.Name == "__type" {
+		err = errors.Wrap(ErrInvalidRequest, "introspection query is not supported, use the schema api instead")
+		return
+	}
+
+	t := s.Table(f.Name)
+	if t == nil {
+		err = errors.Wrapf(ErrInvalidRequest, "unknown table %q", f.Name)
+		return
+	}
+
+	args, err := e.resolveArguments(f.Arguments)
+	if err != nil {
+		return
+	}
+
+	fields, err := e.collectFields(f.Selections, make(map[string]bool))
+	if err != nil {
+		return
+	}
+	if len(fields) == 0 {
+		err = errors.Wrapf(ErrInvalidRequest, "selection of table %q is required", t.Name)
+		return
+	}
+
+	// build selected columns
+	var columns []*Column
+	colIndex := make(map[string]int)
+	for _, sub := range fields {
+		if sub.Name == "__typename" {
+			continue
+		}
+		c := t.Column(sub.Name)
+		if c == nil {
+			err = errors.Wrapf(ErrInvalidRequest, "unknown column %q of table %q", sub.Name, t.Name)
+			return
+		}
+		if _, ok := colIndex[c.Name]; !ok {
+			colIndex[c.Name] = len(columns)
+			columns = append(columns, c)
+		}
+	}
+
+	query, queryArgs, err := buildSelect(t, columns, args)
+	if err != nil {
+		return
+	}
+
+	var rows [][]interface{}
+	if _, _, rows, err = q.Query(dbID, query, queryArgs...); err != nil {
+		return
+	}
+
+	list := make([]interface{}, 0, len(rows))
+	for _, row := range rows {
+		obj := &orderedMap{}
+		for _, sub := range fields {
+			if sub.Name == "__typename" {
+				obj.set(sub.ResponseKey(), t.Name)
+				continue
+			}
+			i := colIndex[sub.Name]
+			var v interface{}
+			if i < len(row) {
+				v = convertResult(columns[i], row[i])
+			}
+			obj.set(sub.ResponseKey(), v)
+		}
+		list = append(list, obj)
+	}
+
+	result = list
+	return
+}
+
+func (e *Execution) resolveMutation(q Querier, dbID string, s *Schema, f *Field) (result interface{}, err error) {
+	var (
+		t         *Table
+		query     string
+		queryArgs []interface{}
+	)
+
+	args, err := e.resolveArguments(f.Arguments)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(f.Name, insertPrefix):
+		if t = s.Table(strings.TrimPrefix(f.Name, insertPrefix)); t != nil {
+			query, queryArgs, err = buildInsert(t, args["objects"])
+		}
+	case strings.HasPrefix(f.Name, updatePrefix):
+		if t = s.Table(strings.TrimPrefix(f.Name, updatePrefix)); t != nil {
+			query, queryArgs, err = buildUpdate(t, args)
+		}
+	case strings.HasPrefix(f.Name, deletePrefix):
+		if t = s.Table(strings.TrimPrefix(f.Name, deletePrefix)); t != nil {
+			query, queryArgs, err = buildDelete(t, args)
+		}
+	}
+	if t == nil {
+		err = errors.Wrapf(ErrInvalidRequest, "unknown mutation %q", f.Name)
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	fields, err := e.collectFields(f.Selections, make(map[string]bool))
+	if err != nil {
+		return
+	}
+
+	var affectedRows, lastInsertID int64
+	if affectedRows, lastInsertID, err = q.Exec(dbID, query, queryArgs...); err != nil {
+		return
+	}
+
+	obj := &orderedMap{}
+	for _, sub := range fields {
+		switch sub.Name {
+		case "affected_rows":
+			obj.set(sub.ResponseKey(), affectedRows)
+		case "last_insert_id":
+			obj.set(sub.ResponseKey(), lastInsertID)
+		case "__typename":
+			obj.set(sub.ResponseKey(), "mutation_response")
+		default:
+			err = errors.Wrapf(ErrInvalidRequest, "unknown field %q of mutation_response", sub.Name)
+			return
+		}
+	}
+
+	result = obj
+	return
+}
+
+func (e *Execution) resolveArguments(args map[string]Value) (resolved map[string]interface{}, err error) {
+	resolved = make(map[string]interface{}, len(args))
+	for name, v := range args {
+		if resolved[name], err = e.resolve(v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// resolve replaces variables and enums in literal value to plain values.
+func (e *Execution) resolve(v Value) (result interface{}, err error) {
+	switch tv := v.(type) {
+	case Variable:
+		return e.vars[string(tv)], nil
+	case EnumValue:
+		return string(tv), nil
+	case []Value:
+		list := make([]interface{}, len(tv))
+		for i, item := range tv {
+			if list[i], err = e.resolve(item); err != nil {
+				return
+			}
+		}
+		return list, nil
+	case map[string]Value:
+		obj := make(map[string]interface{}, len(tv))
+		for k, item := range tv {
+			if obj[k], err = e.resolve(item); err != nil {
+				return
+			}
+		}
+		return obj, nil
+	default:
+		return tv, nil
+	}
+}
+
+func buildSelect(t *Table, columns []*Column, args map[string]interface{}) (query string, queryArgs []interface{}, err error) {
+	var b strings.Builder
+
+	b.WriteString("SELECT ")
+	if len(columns) == 0 {
+		b.WriteString("1")
+	}
+	for i, c := range columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(quoteIdent(c.Name))
+	}
+	b.WriteString(" FROM ")
+	b.WriteString(quoteIdent(t.Name))
+
+	if where, ok := args["where"]; ok && where != nil {
+		var clause string
+		if clause, queryArgs, err = buildWhere(t, where); err != nil {
+			return
+		}
+		b.WriteString(" WHERE ")
+		b.WriteString(clause)
+	}
+
+	if orderBy, ok := args["order_by"]; ok && orderBy != nil {
+		var clause string
+		if clause, err = buildOrderBy(t, orderBy); err != nil {
+			return
+		}
+		if clause != "" {
+			b.WriteString(" ORDER BY ")
+			b.WriteString(clause)
+		}
+	}
+
+	limit, hasLimit := args["limit"]
+	offset, hasOffset := args["offset"]
+	if hasLimit && limit != nil {
+		if _, ok := limit.(int64); !ok {
+			err = errors.Wrap(ErrInvalidArgument, "limit should be Int")
+			return
+		}
+		b.WriteString(" LIMIT ?")
+		queryArgs = append(queryArgs, limit)
+	} else if hasOffset && offset != nil {
+		b.WriteString(" LIMIT -1")
+	}
+	if hasOffset && offset != nil {
+		if _, ok := offset.(int64); !ok {
+			err = errors.Wrap(ErrInvalidArgument, "offset should be Int")
+			return
+		}
+		b.WriteString(" OFFSET ?")
+		queryArgs = append(queryArgs, offset)
+	}
+
+	query = b.String()
+	return
+}
+
+func buildInsert(t *Table, objects interface{}) (query string, queryArgs []interface{}, err error) {
+	var list []interface{}
+	switch tv := objects.(type) {
+	case []interface{}:
+		list = tv
+	case map[string]interface{}:
+		list = []interface{}{tv}
+	}
+	if len(list) == 0 {
+		err = errors.Wrap(ErrInvalidArgument, "objects is required")
+		return
+	}
+
+	// all objects should have the same columns to be inserted in single statement
+	var names []string
+	for i, item := range list {
+		obj, ok := item.(map[string]interface{})
+		if !ok || len(obj) == 0 {
+			err = errors.Wrapf(ErrInvalidArgument, "objects[%d] should be non-empty object", i)
+			return
+		}
+		keys := sortedKeys(obj)
+		if i == 0 {
+			names = keys
+			for _, name := range names {
+				if t.Column(name) == nil {
+					err = errors.Wrapf(ErrInvalidArgument, "unknown column %q of table %q", name, t.Name)
+					return
+				}
+			}
+		} else if strings.Join(keys, ",") != strings.Join(names, ",") {
+			err = errors.Wrapf(ErrInvalidArgument, "objects[%d] should have the same fields as objects[0]", i)
+			return
+		}
+		for _, name := range names {
+			var v interface{}
+			if v, err = scalarArg(obj[name]); err != nil {
+				return
+			}
+			queryArgs = append(queryArgs, v)
+		}
+	}
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+	placeholder := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ") + ")"
+	values := strings.TrimSuffix(strings.Repeat(placeholder+", ", len(list)), ", ")
+
+	query = fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", quoteIdent(t.Name), strings.Join(quoted, ", "), values)
+	return
+}
+
+func buildUpdate(t *Table, args map[string]interface{}) (query string, queryArgs []interface{}, err error) {
+	set, ok := args["_set"].(map[string]interface{})
+	if !ok || len(set) == 0 {
+		err = errors.Wrap(ErrInvalidArgument, "_set is required")
+		return
+	}
+	if _, ok = args["where"]; !ok {
+		err = errors.Wrap(ErrInvalidArgument, "where is required")
+		return
+	}
+
+	assigns := make([]string, 0, len(set))
+	for _, name := range sortedKeys(set) {
+		if t.Column(name) == nil {
+			err = errors.Wrapf(ErrInvalidArgument, "unknown column %q of table %q", name, t.Name)
+			return
+		}
+		var v interface{}
+		if v, err = scalarArg(set[name]); err != nil {
+			return
+		}
+		assigns = append(assigns, quoteIdent(name)+" = ?")
+		queryArgs = append(queryArgs, v)
+	}
+
+	clause, whereArgs, err := buildWhere(t, args["where"])
+	if err != nil {
+		return
+	}
+
+	query = fmt.Sprintf("UPDATE %s SET %s WHERE %s", quoteIdent(t.Name), strings.Join(assigns, ", "), clause)
+	queryArgs = append(queryArgs, whereArgs...)
+	return
+}
+
+func buildDelete(t *Table, args map[string]interface{}) (query string, queryArgs []interface{}, err error) {
+	if _, ok := args["where"]; !ok {
+		err = errors.Wrap(ErrInvalidArgument, "where is required")
+		return
+	}
+
+	clause, queryArgs, err := buildWhere(t, args["where"])
+	if err != nil {
+		return
+	}
+
+	query = fmt.Sprintf("DELETE FROM %s WHERE %s", quoteIdent(t.Name), clause)
+	return
+}
+
+// buildWhere compiles bool expression such as {_or: [{id: {_eq: 1}}, {name: {_like: "a%"}}]} to sql.
+func buildWhere(t *Table, exp interface{}) (clause string, args []interface{}, err error) {
+	if exp == nil {
+		return "1", nil, nil
+	}
+
+	obj, ok := exp.(map[string]interface{})
+	if !ok {
+		err = errors.Wrapf(ErrInvalidArgument, "%s_bool_exp should be object", t.Name)
+		return
+	}
+
+	var conds []string
+	for _, key := range sortedKeys(obj) {
+		var (
+			cond     string
+			condArgs []interface{}
+		)
+
+		switch key {
+		case "_and", "_or":
+			list, ok := obj[key].([]interface{})
+			if !ok {
+				err = errors.Wrapf(ErrInvalidArgument, "%s should be list", key)
+				return
+			}
+			if len(list) == 0 {
+				continue
+			}
+			parts := make([]string, 0, len(list))
+			for _, item := range list {
+				var part string
+				var partArgs []interface{}
+				if part, partArgs, err = buildWhere(t, item); err != nil {
+					return
+				}
+				parts = append(parts, part)
+				condArgs = append(condArgs, partArgs...)
+			}
+			sep := " AND "
+			if key == "_or" {
+				sep = " OR "
+			}
+			cond = "(" + strings.Join(parts, sep) + ")"
+		case "_not":
+			if cond, condArgs, err = buildWhere(t, obj[key]); err != nil {
+				return
+			}
+			cond = "NOT " + cond
+		default:
+			c := t.Column(key)
+			if c == nil {
+				err = errors.Wrapf(ErrInvalidArgument, "unknown column %q of table %q", key, t.Name)
+				return
+			}
+			if cond, condArgs, err = buildComparison(c, obj[key]); err != nil {
+				return
+			}
+		}
+
+		conds = append(conds, cond)
+		args = append(args, condArgs...)
+	}
+
+	if len(conds) == 0 {
+		return "1", args, nil
+	}
+
+	clause = "(" + strings.Join(conds, " AND ") + ")"
+	return
+}
+
+func buildComparison(c *Column, exp interface{}) (clause string, args []interface{}, err error) {
+	obj, ok := exp.(map[string]interface{})
+	if !ok {
+		err = errors.Wrapf(ErrInvalidArgument, "%s_comparison_exp of column %q should be object", c.Scalar, c.Name)
+		return
+	}
+
+	col := quoteIdent(c.Name)
+	var conds []string
+
+	for _, op := range sortedKeys(obj) {
+		v := obj[op]
+
+		switch op {
+		case "_is_null":
+			isNull, ok := v.(bool)
+			if !ok {
+				err = errors.Wrapf(ErrInvalidArgument, "_is_null of column %q should be Boolean", c.Name)
+				return
+			}
+			if isNull {
+				conds = append(conds, col+" IS NULL")
+			} else {
+				conds = append(conds, col+" IS NOT NULL")
+			}
+		case "_in", "_nin":
+			list, ok := v.([]interface{})
+			if !ok {
+				err = errors.Wrapf(ErrInvalidArgument, "%s of column %q should be list", op, c.Name)
+				return
+			}
+			if len(list) == 0 {
+				// empty set matches nothing for _in and everything for _nin
+				if op == "_in" {
+					conds = append(conds, "0")
+				} else {
+					conds = append(conds, "1")
+				}
+				continue
+			}
+			for _, item := range list {
+				var arg interface{}
+				if arg, err = scalarArg(item); err != nil {
+					return
+				}
+				args = append(args, arg)
+			}
+			sqlOp := " IN ("
+			if op == "_nin" {
+				sqlOp = " NOT IN ("
+			}
+			conds = append(conds, col+sqlOp+strings.TrimSuffix(strings.Repeat("?, ", len(list)), ", ")+")")
+		default:
+			sqlOp, ok := comparisonOps[op]
+			if !ok {
+				err = errors.Wrapf(ErrInvalidArgument, "unknown operator %q of column %q", op, c.Name)
+				return
+			}
+			if v == nil && (op == "_eq" || op == "_neq") {
+				if op == "_eq" {
+					conds = append(conds, col+" IS NULL")
+				} else {
+					conds = append(conds, col+" IS NOT NULL")
+				}
+				continue
+			}
+			var arg interface{}
+			if arg, err = scalarArg(v); err != nil {
+				return
+			}
+			conds = append(conds, col+" "+sqlOp+" ?")
+			args = append(args, arg)
+		}
+	}
+
+	if len(conds) == 0 {
+		return "1", args, nil
+	}
+
+	clause = "(" + strings.Join(conds, " AND ") + ")"
+	return
+}
+
+func buildOrderBy(t *Table, exp interface{}) (clause string, err error) {
+	var list []interface{}
+	switch tv := exp.(type) {
+	case []interface{}:
+		list = tv
+	case map[string]interface{}:
+		list = []interface{}{tv}
+	default:
+		err = errors.Wrap(ErrInvalidArgument, "order_by should be object or list of objects")
+		return
+	}
+
+	var parts []string
+	for _, item := range list {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			err = errors.Wrap(ErrInvalidArgument, "order_by should be object or list of objects")
+			return
+		}
+		// keys of a single object are applied in name order, use list to specify the order
+		for _, name := range sortedKeys(obj) {
+			if t.Column(name) == nil {
+				err = errors.Wrapf(ErrInvalidArgument, "unknown column %q of table %q", name, t.Name)
+				return
+			}
+			switch dir := fmt.Sprint(obj[name]); dir {
+			case "asc":
+				parts = append(parts, quoteIdent(name)+" ASC")
+			case "desc":
+				parts = append(parts, quoteIdent(name)+" DESC")
+			default:
+				err = errors.Wrapf(ErrInvalidArgument, "invalid order %q of column %q", dir, name)
+				return
+			}
+		}
+	}
+
+	clause = strings.Join(parts, ", ")
+	return
+}
+
+func scalarArg(v interface{}) (arg interface{}, err error) {
+	switch v.(type) {
+	case nil, bool, int64, float64, string:
+		arg = v
+	default:
+		err = errors.Wrap(ErrInvalidArgument, "value should be scalar")
+	}
+	return
+}
+
+func convertResult(c *Column, v interface{}) interface{} {
+	if c.Scalar == ScalarBoolean {
+		switch tv := v.(type) {
+		case int64:
+			return tv != 0
+		case string:
+			return tv != "" && tv != "0" && strings.ToLower(tv) != "false"
+		}
+	}
+	return v
+}
+
+// normalizeJSONValue converts json decoded variables to values accepted by executor.
+func normalizeJSONValue(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case json.Number:
+		if i, err := tv.Int64(); err == nil {
+			return i
+		}
+		f, _ := tv.Float64()
+		return f
+	case float64:
+		if tv == float64(int64(tv)) {
+			return int64(tv)
+		}
+		return tv
+	case []interface{}:
+		for i, item := range tv {
+			tv[i] = normalizeJSONValue(item)
+		}
+		return tv
+	case map[string]interface{}:
+		for k, item := range tv {
+			tv[k] = normalizeJSONValue(item)
+		}
+		return tv
+	default:
+		return tv
+	}
+}
+
+func quoteIdent(name string) string {
+	// names are validated against schema, quote anyway to avoid conflicts with keywords
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func sortedKeys(obj map[string]interface{}) (keys []string) {
+	keys = make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// orderedMap keeps the field order of selection set in json output.
+type orderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (m *orderedMap) set(key string, value interface{}) {
+	if m.values == nil {
+		m.values = make(map[string]interface{})
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(m.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeQuerier struct {
+	tables  map[string][][]interface{} // table name to PRAGMA table_info rows
+	queries []string
+	args    [][]interface{}
+	rows    [][]interface{}
+}
+
+func (f *fakeQuerier) Query(dbID string, query string, args ...interface{}) (
+	columns []string, types []string, rows [][]interface{}, err error) {
+	f.queries = append(f.queries, query)
+	f.args = append(f.args, args)
+
+	switch {
+	case strings.Contains(query, "sqlite_master"):
+		for name := range f.tables {
+			rows = append(rows, []interface{}{name, "CREATE TABLE " + name})
+		}
+	case strings.HasPrefix(query, "PRAGMA table_info"):
+		columns = []string{"cid", "name", "type", "notnull", "dflt_value", "pk"}
+		rows = f.tables[strings.Trim(strings.TrimPrefix(query, "PRAGMA table_info("), `")`)]
+	default:
+		rows = f.rows
+	}
+
+	return
+}
+
+func (f *fakeQuerier) Exec(dbID string, query string, args ...interface{}) (affectedRows int64, lastInsertID int64, err error) {
+	f.queries = append(f.queries, query)
+	f.args = append(f.args, args)
+	return 2, 10, nil
+}
+
+func (f *fakeQuerier) last() (string, []interface{}) {
+	return f.queries[len(f.queries)-1], f.args[len(f.args)-1]
+}
+
+func newFakeQuerier() *fakeQuerier {
+	return &fakeQuerier{
+		tables: map[string][][]interface{}{
+			"users": {
+				{int64(0), "id", "INTEGER", int64(1), nil, int64(1)},
+				{int64(1), "name", "TEXT", int64(0), nil, int64(0)},
+				{int64(2), "active", "BOOLEAN", int64(0), nil, int64(0)},
+				{int64(3), "bad-name", "TEXT", int64(0), nil, int64(0)},
+			},
+		},
+	}
+}
+
+func execute(q *fakeQuerier, s *Schema, query string, vars string) (string, *Execution) {
+	req := &Request{Query: query}
+	if vars != "" {
+		dec := json.NewDecoder(strings.NewReader(vars))
+		dec.UseNumber()
+		So(dec.Decode(&req.Variables), ShouldBeNil)
+	}
+	e, err := Prepare(req)
+	So(err, ShouldBeNil)
+	out, err := json.Marshal(e.Execute(q, "db", s))
+	So(err, ShouldBeNil)
+	return string(out), e
+}
+
+func TestSchema(t *testing.T) {
+	Convey("test schema introspection", t, func() {
+		q := newFakeQuerier()
+		s, err := LoadSchema(q, "db")
+		So(err, ShouldBeNil)
+		So(s.Tables, ShouldHaveLength, 1)
+		users := s.Table("users")
+		So(users, ShouldNotBeNil)
+		So(users.Columns, ShouldHaveLength, 3)
+		So(users.Column("id").Scalar, ShouldEqual, ScalarInt)
+		So(users.Column("id").PrimaryKey, ShouldBeTrue)
+		So(users.Column("active").Scalar, ShouldEqual, ScalarBoolean)
+		So(users.Column("bad-name"), ShouldBeNil)
+		So(q.queries, ShouldContain, `PRAGMA table_info("users")`)
+
+		sdl := s.SDL()
+		So(sdl, ShouldContainSubstring, "type users {\n  id: Int!\n  name: String\n  active: Boolean\n}")
+		So(sdl, ShouldContainSubstring, "insert_users(objects: [users_input!]!): mutation_response")
+
+		So(IsDDL("  create table a (id int)"), ShouldBeTrue)
+		So(IsDDL("ALTER TABLE a ADD b"), ShouldBeTrue)
+		So(IsDDL("INSERT INTO created VALUES (1)"), ShouldBeFalse)
+	})
+
+	Convey("test schema cache", t, func() {
+		q := newFakeQuerier()
+		c := NewSchemaCache(time.Hour)
+		s1, err := c.Get(q, "db")
+		So(err, ShouldBeNil)
+		s2, err := c.Get(q, "db")
+		So(err, ShouldBeNil)
+		So(s2, ShouldEqual, s1)
+
+		c.InvalidateOnDDL("db", "SELECT 1")
+		s2, _ = c.Get(q, "db")
+		So(s2, ShouldEqual, s1)
+
+		c.InvalidateOnDDL("db", "CREATE TABLE t (id INT)")
+		s2, _ = c.Get(q, "db")
+		So(s2, ShouldNotEqual, s1)
+
+		// detect schema change after check interval
+		c = NewSchemaCache(0)
+		s1, _ = c.Get(q, "db")
+		s2, _ = c.Get(q, "db")
+		So(s2, ShouldEqual, s1)
+		q.tables["posts"] = [][]interface{}{{int64(0), "id", "INT", int64(0), nil, int64(0)}}
+		s2, _ = c.Get(q, "db")
+		So(s2, ShouldNotEqual, s1)
+		So(s2.Table("posts"), ShouldNotBeNil)
+	})
+}
+
+func TestExecute(t *testing.T) {
+	Convey("test query", t, func() {
+		q := newFakeQuerier()
+		s, err := LoadSchema(q, "db")
+		So(err, ShouldBeNil)
+
+		q.rows = [][]interface{}{{"alice", int64(1), int64(1)}}
+		out, e := execute(q, s, `
+			query Users($name: String, $limit: Int = 10) {
+				__typename
+				list: users(
+					where: {_or: [{name: {_like: $name}}, {id: {_in: [1, 2]}}], active: {_eq: true}},
+					order_by: [{id: desc}], limit: $limit, offset: 5) {
+					...userFields
+					id @include(if: true)
+					hidden: id @skip(if: true)
+				}
+			}
+			fragment userFields on users { name active }`, `{"name": "a%"}`)
+		So(e.IsMutation(), ShouldBeFalse)
+		So(out, ShouldEqual, `{"data":{"__typename":"Query","list":[{"name":"alice","active":true,"id":1}]}}`)
+
+		query, args := q.last()
+		So(query, ShouldEqual, `SELECT "name", "active", "id" FROM "users" WHERE `+
+			`(((("name" LIKE ?)) OR (("id" IN (?, ?)))) AND ("active" = ?)) ORDER BY "id" DESC LIMIT ? OFFSET ?`)
+		So(args, ShouldResemble, []interface{}{"a%", int64(1), int64(2), true, int64(10), int64(5)})
+
+		// errors
+		out, _ = execute(q, s, `{ unknown { id } }`, "")
+		So(out, ShouldContainSubstring, `unknown table \"unknown\"`)
+		out, _ = execute(q, s, `{ users(where: {id: {_bad: 1}}) { id } }`, "")
+		So(out, ShouldContainSubstring, `unknown operator`)
+		out, _ = execute(q, s, `{ users { password } }`, "")
+		So(out, ShouldContainSubstring, `unknown column`)
+	})
+
+	Convey("test mutation", t, func() {
+		q := newFakeQuerier()
+		s, err := LoadSchema(q, "db")
+		So(err, ShouldBeNil)
+
+		out, e := execute(q, s, `mutation {
+			insert_users(objects: [{id: 1, name: "a"}, {id: 2, name: "b"}]) { affected_rows last_insert_id }
+		}`, "")
+		So(e.IsMutation(), ShouldBeTrue)
+		So(out, ShouldEqual, `{"data":{"insert_users":{"affected_rows":2,"last_insert_id":10}}}`)
+		query, args := q.last()
+		So(query, ShouldEqual, `INSERT INTO "users" ("id", "name") VALUES (?, ?), (?, ?)`)
+		So(args, ShouldResemble, []interface{}{int64(1), "a", int64(2), "b"})
+
+		execute(q, s, `mutation { update_users(where: {id: {_eq: 1}}, _set: {name: "c"}) { affected_rows } }`, "")
+		query, args = q.last()
+		So(query, ShouldEqual, `UPDATE "users" SET "name" = ? WHERE (("id" = ?))`)
+		So(args, ShouldResemble, []interface{}{"c", int64(1)})
+
+		execute(q, s, `mutation { delete_users(where: {name: {_is_null: true}}) { affected_rows } }`, "")
+		query, args = q.last()
+		So(query, ShouldEqual, `DELETE FROM "users" WHERE (("name" IS NULL))`)
+		So(args, ShouldBeEmpty)
+
+		out, _ = execute(q, s, `mutation { delete_users { affected_rows } }`, "")
+		So(out, ShouldContainSubstring, "where is required")
+		out, _ = execute(q, s, `mutation { insert_users(objects: [{id: 1}, {name: "a"}]) { affected_rows } }`, "")
+		So(out, ShouldContainSubstring, "same fields")
+	})
+
+	Convey("test parse errors", t, func() {
+		_, err := Parse(`{ users { id }`)
+		So(err, ShouldNotBeNil)
+		_, err = Parse(`subscription { users { id } }`)
+		So(err, ShouldNotBeNil)
+		_, err = Parse(`{ users(where: {name: {_eq: "unterminated}}) { id } }`)
+		So(err, ShouldNotBeNil)
+		_, err = Prepare(&Request{Query: `query a { users { id } } query b { users { id } }`})
+		So(err, ShouldNotBeNil)
+		_, err = Prepare(&Request{Query: `query a { users { id } } query b { users { id } }`, OperationName: "b"})
+		So(err, ShouldBeNil)
+
+		doc, err := Parse(`{ users(where: {name: {_eq: "a\"bA"}}, limit: -1, f: 1.5e3) { id } }`)
+		So(err, ShouldBeNil)
+		args := doc.Operations[0].Selections[0].(*Field).Arguments
+		So(args["where"], ShouldResemble, map[string]Value{"name": map[string]Value{"_eq": `a"bA`}})
+		So(args["limit"], ShouldEqual, int64(-1))
+		So(args["f"], ShouldEqual, 1500.0)
+	})
+}
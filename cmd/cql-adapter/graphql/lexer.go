@@ -0,0 +1,241 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+// lexer splits graphql document to tokens, ignored tokens such as whitespace, commas and comments are skipped.
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) next() (t token, err error) {
+	l.skipIgnored()
+
+	t.pos = l.pos
+	if l.pos >= len(l.src) {
+		t.kind = tokenEOF
+		return
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case c == '.':
+		if !strings.HasPrefix(l.src[l.pos:], "...") {
+			err = l.errorf("unexpected character %q", c)
+			return
+		}
+		l.pos += 3
+		t.kind, t.value = tokenPunct, "..."
+	case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+		l.pos++
+		t.kind, t.value = tokenPunct, string(c)
+	case c == '_' || isLetter(c):
+		start := l.pos
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		t.kind, t.value = tokenName, l.src[start:l.pos]
+	case c == '-' || isDigit(c):
+		t, err = l.readNumber()
+	case c == '"':
+		t.kind = tokenString
+		if strings.HasPrefix(l.src[l.pos:], `"""`) {
+			t.value, err = l.readBlockString()
+		} else {
+			t.value, err = l.readString()
+		}
+	default:
+		err = l.errorf("unexpected character %q", c)
+	}
+
+	return
+}
+
+func (l *lexer) skipIgnored() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; c {
+		case ' ', '\t', '\n', '\r', ',':
+			l.pos++
+		case '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			if strings.HasPrefix(l.src[l.pos:], "\ufeff") {
+				l.pos += len("\ufeff")
+				continue
+			}
+			return
+		}
+	}
+}
+
+func (l *lexer) readNumber() (t token, err error) {
+	start := l.pos
+	t.pos = start
+	t.kind = tokenInt
+
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	if !l.readDigits() {
+		err = l.errorf("invalid number")
+		return
+	}
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		t.kind = tokenFloat
+		l.pos++
+		if !l.readDigits() {
+			err = l.errorf("invalid number")
+			return
+		}
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		t.kind = tokenFloat
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		if !l.readDigits() {
+			err = l.errorf("invalid number")
+			return
+		}
+	}
+
+	t.value = l.src[start:l.pos]
+	return
+}
+
+func (l *lexer) readDigits() bool {
+	start := l.pos
+	for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+		l.pos++
+	}
+	return l.pos > start
+}
+
+func (l *lexer) readString() (s string, err error) {
+	var b strings.Builder
+	l.pos++ // opening quote
+
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			s = b.String()
+			return
+		case '\n', '\r':
+			err = l.errorf("unterminated string")
+			return
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				err = l.errorf("unterminated string")
+				return
+			}
+			l.pos++
+			switch e := l.src[l.pos]; e {
+			case '"', '\\', '/':
+				b.WriteByte(e)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if l.pos+5 > len(l.src) {
+					err = l.errorf("invalid unicode escape")
+					return
+				}
+				var r uint64
+				if r, err = strconv.ParseUint(l.src[l.pos+1:l.pos+5], 16, 32); err != nil {
+					err = l.errorf("invalid unicode escape")
+					return
+				}
+				b.WriteRune(rune(r))
+				l.pos += 4
+			default:
+				err = l.errorf("invalid escape character %q", e)
+				return
+			}
+			l.pos++
+		default:
+			r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+			b.WriteRune(r)
+			l.pos += size
+		}
+	}
+
+	err = l.errorf("unterminated string")
+	return
+}
+
+func (l *lexer) readBlockString() (s string, err error) {
+	l.pos += 3 // opening quotes
+
+	end := strings.Index(l.src[l.pos:], `"""`)
+	if end < 0 {
+		err = l.errorf("unterminated block string")
+		return
+	}
+
+	s = l.src[l.pos : l.pos+end]
+	l.pos += end + 3
+	return
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return errors.Wrapf(ErrSyntax, "position %d: "+format, append([]interface{}{l.pos}, args...)...)
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,521 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Document defines a parsed graphql executable document.
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation defines a query or mutation operation.
+type Operation struct {
+	Type       string // query or mutation
+	Name       string
+	Variables  map[string]Value // variable name to default value
+	Selections []Selection
+}
+
+// Fragment defines a named fragment.
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	Selections    []Selection
+}
+
+// Selection defines one of *Field, *FragmentSpread or *InlineFragment.
+type Selection interface{}
+
+// Field defines a field selection.
+type Field struct {
+	Alias      string
+	Name       string
+	Arguments  map[string]Value
+	Directives []*Directive
+	Selections []Selection
+}
+
+// ResponseKey returns the alias or the name of the field.
+func (f *Field) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// FragmentSpread defines a named fragment spread selection.
+type FragmentSpread struct {
+	Name       string
+	Directives []*Directive
+}
+
+// InlineFragment defines an inline fragment selection.
+type InlineFragment struct {
+	TypeCondition string
+	Directives    []*Directive
+	Selections    []Selection
+}
+
+// Directive defines a directive such as @include(if: $var).
+type Directive struct {
+	Name      string
+	Arguments map[string]Value
+}
+
+// Value defines a literal value, it is one of nil, bool, int64, float64, string,
+// EnumValue, Variable, []Value or map[string]Value.
+type Value interface{}
+
+// EnumValue defines an enum literal value.
+type EnumValue string
+
+// Variable defines a variable reference value.
+type Variable string
+
+type parser struct {
+	lex lexer
+	tok token
+}
+
+// Parse parses graphql executable document.
+func Parse(src string) (doc *Document, err error) {
+	p := &parser{lex: lexer{src: src}}
+	if err = p.advance(); err != nil {
+		return
+	}
+
+	doc = &Document{
+		Fragments: make(map[string]*Fragment),
+	}
+
+	for p.tok.kind != tokenEOF {
+		switch {
+		case p.peek(tokenPunct, "{"):
+			var op *Operation
+			if op, err = p.parseShorthandQuery(); err != nil {
+				return
+			}
+			doc.Operations = append(doc.Operations, op)
+		case p.peek(tokenName, "query"), p.peek(tokenName, "mutation"):
+			var op *Operation
+			if op, err = p.parseOperation(); err != nil {
+				return
+			}
+			doc.Operations = append(doc.Operations, op)
+		case p.peek(tokenName, "fragment"):
+			var frag *Fragment
+			if frag, err = p.parseFragment(); err != nil {
+				return
+			}
+			doc.Fragments[frag.Name] = frag
+		default:
+			err = p.unexpected()
+			return
+		}
+	}
+
+	if len(doc.Operations) == 0 {
+		err = errors.Wrap(ErrSyntax, "no operation found")
+	}
+
+	return
+}
+
+func (p *parser) advance() (err error) {
+	p.tok, err = p.lex.next()
+	return
+}
+
+func (p *parser) peek(kind tokenKind, value string) bool {
+	return p.tok.kind == kind && p.tok.value == value
+}
+
+func (p *parser) expect(kind tokenKind, value string) (err error) {
+	if !p.peek(kind, value) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+func (p *parser) expectName() (name string, err error) {
+	if p.tok.kind != tokenName {
+		err = p.unexpected()
+		return
+	}
+	name = p.tok.value
+	err = p.advance()
+	return
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokenEOF {
+		return errors.Wrapf(ErrSyntax, "position %d: unexpected end of document", p.tok.pos)
+	}
+	return errors.Wrapf(ErrSyntax, "position %d: unexpected %q", p.tok.pos, p.tok.value)
+}
+
+func (p *parser) parseShorthandQuery() (op *Operation, err error) {
+	op = &Operation{Type: "query"}
+	op.Selections, err = p.parseSelectionSet()
+	return
+}
+
+func (p *parser) parseOperation() (op *Operation, err error) {
+	op = &Operation{Type: p.tok.value}
+	if err = p.advance(); err != nil {
+		return
+	}
+
+	if p.tok.kind == tokenName {
+		op.Name = p.tok.value
+		if err = p.advance(); err != nil {
+			return
+		}
+	}
+
+	if p.peek(tokenPunct, "(") {
+		if op.Variables, err = p.parseVariableDefinitions(); err != nil {
+			return
+		}
+	}
+
+	// operation directives are not supported by the generated schema, parse and ignore
+	if _, err = p.parseDirectives(); err != nil {
+		return
+	}
+
+	op.Selections, err = p.parseSelectionSet()
+	return
+}
+
+func (p *parser) parseVariableDefinitions() (vars map[string]Value, err error) {
+	vars = make(map[string]Value)
+
+	if err = p.expect(tokenPunct, "("); err != nil {
+		return
+	}
+
+	for !p.peek(tokenPunct, ")") {
+		if err = p.expect(tokenPunct, "$"); err != nil {
+			return
+		}
+		var name string
+		if name, err = p.expectName(); err != nil {
+			return
+		}
+		if err = p.expect(tokenPunct, ":"); err != nil {
+			return
+		}
+		if err = p.skipType(); err != nil {
+			return
+		}
+
+		var def Value
+		if p.peek(tokenPunct, "=") {
+			if err = p.advance(); err != nil {
+				return
+			}
+			if def, err = p.parseValue(true); err != nil {
+				return
+			}
+		}
+		vars[name] = def
+	}
+
+	err = p.advance()
+	return
+}
+
+// skipType skips the variable type, value types are checked while building sql.
+func (p *parser) skipType() (err error) {
+	if p.peek(tokenPunct, "[") {
+		if err = p.advance(); err != nil {
+			return
+		}
+		if err = p.skipType(); err != nil {
+			return
+		}
+		if err = p.expect(tokenPunct, "]"); err != nil {
+			return
+		}
+	} else if _, err = p.expectName(); err != nil {
+		return
+	}
+
+	if p.peek(tokenPunct, "!") {
+		err = p.advance()
+	}
+
+	return
+}
+
+func (p *parser) parseFragment() (frag *Fragment, err error) {
+	if err = p.advance(); err != nil {
+		return
+	}
+
+	frag = &Fragment{}
+	if frag.Name, err = p.expectName(); err != nil {
+		return
+	}
+	if err = p.expect(tokenName, "on"); err != nil {
+		return
+	}
+	if frag.TypeCondition, err = p.expectName(); err != nil {
+		return
+	}
+	if _, err = p.parseDirectives(); err != nil {
+		return
+	}
+
+	frag.Selections, err = p.parseSelectionSet()
+	return
+}
+
+func (p *parser) parseSelectionSet() (selections []Selection, err error) {
+	if err = p.expect(tokenPunct, "{"); err != nil {
+		return
+	}
+
+	for !p.peek(tokenPunct, "}") {
+		var sel Selection
+		if p.peek(tokenPunct, "...") {
+			sel, err = p.parseFragmentSelection()
+		} else {
+			sel, err = p.parseField()
+		}
+		if err != nil {
+			return
+		}
+		selections = append(selections, sel)
+	}
+
+	err = p.advance()
+	return
+}
+
+func (p *parser) parseFragmentSelection() (sel Selection, err error) {
+	if err = p.advance(); err != nil {
+		return
+	}
+
+	if p.tok.kind == tokenName && p.tok.value != "on" {
+		spread := &FragmentSpread{Name: p.tok.value}
+		if err = p.advance(); err != nil {
+			return
+		}
+		spread.Directives, err = p.parseDirectives()
+		sel = spread
+		return
+	}
+
+	inline := &InlineFragment{}
+	if p.peek(tokenName, "on") {
+		if err = p.advance(); err != nil {
+			return
+		}
+		if inline.TypeCondition, err = p.expectName(); err != nil {
+			return
+		}
+	}
+	if inline.Directives, err = p.parseDirectives(); err != nil {
+		return
+	}
+	inline.Selections, err = p.parseSelectionSet()
+	sel = inline
+	return
+}
+
+func (p *parser) parseField() (field *Field, err error) {
+	field = &Field{}
+	if field.Name, err = p.expectName(); err != nil {
+		return
+	}
+
+	if p.peek(tokenPunct, ":") {
+		if err = p.advance(); err != nil {
+			return
+		}
+		field.Alias = field.Name
+		if field.Name, err = p.expectName(); err != nil {
+			return
+		}
+	}
+
+	if p.peek(tokenPunct, "(") {
+		if field.Arguments, err = p.parseArguments(); err != nil {
+			return
+		}
+	}
+
+	if field.Directives, err = p.parseDirectives(); err != nil {
+		return
+	}
+
+	if p.peek(tokenPunct, "{") {
+		field.Selections, err = p.parseSelectionSet()
+	}
+
+	return
+}
+
+func (p *parser) parseArguments() (args map[string]Value, err error) {
+	args = make(map[string]Value)
+
+	if err = p.expect(tokenPunct, "("); err != nil {
+		return
+	}
+
+	for !p.peek(tokenPunct, ")") {
+		var name string
+		if name, err = p.expectName(); err != nil {
+			return
+		}
+		if err = p.expect(tokenPunct, ":"); err != nil {
+			return
+		}
+		if args[name], err = p.parseValue(false); err != nil {
+			return
+		}
+	}
+
+	err = p.advance()
+	return
+}
+
+func (p *parser) parseDirectives() (directives []*Directive, err error) {
+	for p.peek(tokenPunct, "@") {
+		if err = p.advance(); err != nil {
+			return
+		}
+
+		d := &Directive{}
+		if d.Name, err = p.expectName(); err != nil {
+			return
+		}
+		if p.peek(tokenPunct, "(") {
+			if d.Arguments, err = p.parseArguments(); err != nil {
+				return
+			}
+		}
+		directives = append(directives, d)
+	}
+
+	return
+}
+
+func (p *parser) parseValue(constant bool) (v Value, err error) {
+	t := p.tok
+
+	switch t.kind {
+	case tokenPunct:
+		switch t.value {
+		case "$":
+			if constant {
+				return nil, p.unexpected()
+			}
+			if err = p.advance(); err != nil {
+				return
+			}
+			var name string
+			if name, err = p.expectName(); err != nil {
+				return
+			}
+			return Variable(name), nil
+		case "[":
+			return p.parseList(constant)
+		case "{":
+			return p.parseObject(constant)
+		}
+		return nil, p.unexpected()
+	case tokenInt:
+		if v, err = strconv.ParseInt(t.value, 10, 64); err != nil {
+			return nil, errors.Wrapf(ErrSyntax, "position %d: invalid int %q", t.pos, t.value)
+		}
+	case tokenFloat:
+		if v, err = strconv.ParseFloat(t.value, 64); err != nil {
+			return nil, errors.Wrapf(ErrSyntax, "position %d: invalid float %q", t.pos, t.value)
+		}
+	case tokenString:
+		v = t.value
+	case tokenName:
+		switch t.value {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		default:
+			v = EnumValue(t.value)
+		}
+	default:
+		return nil, p.unexpected()
+	}
+
+	err = p.advance()
+	return
+}
+
+func (p *parser) parseList(constant bool) (v Value, err error) {
+	if err = p.advance(); err != nil {
+		return
+	}
+
+	list := make([]Value, 0)
+	for !p.peek(tokenPunct, "]") {
+		var item Value
+		if item, err = p.parseValue(constant); err != nil {
+			return
+		}
+		list = append(list, item)
+	}
+
+	err = p.advance()
+	v = list
+	return
+}
+
+func (p *parser) parseObject(constant bool) (v Value, err error) {
+	if err = p.advance(); err != nil {
+		return
+	}
+
+	obj := make(map[string]Value)
+	for !p.peek(tokenPunct, "}") {
+		var name string
+		if name, err = p.expectName(); err != nil {
+			return
+		}
+		if err = p.expect(tokenPunct, ":"); err != nil {
+			return
+		}
+		if obj[name], err = p.parseValue(constant); err != nil {
+			return
+		}
+	}
+
+	err = p.advance()
+	v = obj
+	return
+}
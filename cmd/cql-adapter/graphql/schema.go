@@ -0,0 +1,341 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package graphql
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+const (
+	// ScalarInt defines the graphql Int scalar.
+	ScalarInt = "Int"
+	// ScalarFloat defines the graphql Float scalar.
+	ScalarFloat = "Float"
+	// ScalarString defines the graphql String scalar.
+	ScalarString = "String"
+	// ScalarBoolean defines the graphql Boolean scalar.
+	ScalarBoolean = "Boolean"
+)
+
+var (
+	nameRegex = regexp.MustCompile("^[_a-zA-Z][_a-zA-Z0-9]*$")
+	ddlRegex  = regexp.MustCompile("(?i)^\\s*(CREATE|ALTER|DROP)\\s")
+)
+
+// Querier defines the storage operations used by graphql executor, implemented by storage.Storage.
+type Querier interface {
+	// Query for result.
+	Query(dbID string, query string, args ...interface{}) (columns []string, types []string, rows [][]interface{}, err error)
+	// Exec for update.
+	Exec(dbID string, query string, args ...interface{}) (affectedRows int64, lastInsertID int64, err error)
+}
+
+// Column defines a table column exposed as graphql field.
+type Column struct {
+	Name       string
+	DeclType   string
+	Scalar     string
+	NotNull    bool
+	PrimaryKey bool
+}
+
+// Table defines a database table exposed as graphql object type.
+type Table struct {
+	Name    string
+	Columns []*Column
+	columns map[string]*Column
+}
+
+// Column returns the column by name.
+func (t *Table) Column(name string) *Column {
+	return t.columns[name]
+}
+
+// Schema defines the graphql schema generated from database tables.
+type Schema struct {
+	Tables      []*Table
+	tables      map[string]*Table
+	fingerprint [sha256.Size]byte
+	loaded      time.Time
+}
+
+// Table returns the table by name.
+func (s *Schema) Table(name string) *Table {
+	return s.tables[name]
+}
+
+// IsDDL reports whether the query may change the database schema.
+func IsDDL(query string) bool {
+	return ddlRegex.MatchString(query)
+}
+
+// LoadSchema introspects database tables using sqlite_master and PRAGMA table_info.
+func LoadSchema(q Querier, dbID string) (s *Schema, err error) {
+	var rows [][]interface{}
+	if _, _, rows, err = q.Query(dbID,
+		"SELECT name, sql FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name"); err != nil {
+		return
+	}
+
+	s = &Schema{
+		tables:      make(map[string]*Table),
+		fingerprint: schemaFingerprint(rows),
+		loaded:      time.Now(),
+	}
+
+	for _, row := range rows {
+		if len(row) < 1 {
+			continue
+		}
+		name := fmt.Sprint(row[0])
+		if !nameRegex.MatchString(name) || strings.HasPrefix(name, "__") {
+			log.WithFields(log.Fields{"db": dbID, "table": name}).Debug("skip table with invalid graphql name")
+			continue
+		}
+
+		var t *Table
+		if t, err = loadTable(q, dbID, name); err != nil {
+			return
+		}
+		if len(t.Columns) > 0 {
+			s.Tables = append(s.Tables, t)
+			s.tables[name] = t
+		}
+	}
+
+	return
+}
+
+func loadTable(q Querier, dbID string, name string) (t *Table, err error) {
+	var columns []string
+	var rows [][]interface{}
+	if columns, _, rows, err = q.Query(dbID, fmt.Sprintf("PRAGMA table_info(%s)", quoteIdent(name))); err != nil {
+		return
+	}
+
+	idx := make(map[string]int, len(columns))
+	for i, c := range columns {
+		idx[c] = i
+	}
+
+	t = &Table{
+		Name:    name,
+		columns: make(map[string]*Column),
+	}
+
+	for _, row := range rows {
+		col := &Column{
+			Name:       fmt.Sprint(getField(row, idx, "name")),
+			DeclType:   fmt.Sprint(getField(row, idx, "type")),
+			NotNull:    fmt.Sprint(getField(row, idx, "notnull")) == "1",
+			PrimaryKey: fmt.Sprint(getField(row, idx, "pk")) != "0",
+		}
+		if !nameRegex.MatchString(col.Name) || strings.HasPrefix(col.Name, "__") {
+			log.WithFields(log.Fields{"db": dbID, "table": name, "column": col.Name}).Debug(
+				"skip column with invalid graphql name")
+			continue
+		}
+		col.Scalar = scalarOf(col.DeclType)
+		t.Columns = append(t.Columns, col)
+		t.columns[col.Name] = col
+	}
+
+	return
+}
+
+func getField(row []interface{}, idx map[string]int, name string) interface{} {
+	if i, ok := idx[name]; ok && i < len(row) {
+		return row[i]
+	}
+	return nil
+}
+
+// scalarOf maps the declared column type to graphql scalar using sqlite type affinity rules.
+func scalarOf(declType string) string {
+	t := strings.ToUpper(declType)
+	switch {
+	case strings.Contains(t, "BOOL"):
+		return ScalarBoolean
+	case strings.Contains(t, "INT"):
+		return ScalarInt
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return ScalarString
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"),
+		strings.Contains(t, "NUMERIC"), strings.Contains(t, "DECIMAL"):
+		return ScalarFloat
+	default:
+		return ScalarString
+	}
+}
+
+func schemaFingerprint(rows [][]interface{}) [sha256.Size]byte {
+	h := sha256.New()
+	for _, row := range rows {
+		for _, v := range row {
+			fmt.Fprintf(h, "%v\x00", v)
+		}
+	}
+
+	var fp [sha256.Size]byte
+	copy(fp[:], h.Sum(nil))
+	return fp
+}
+
+// SDL returns the schema definition language representation of the generated schema.
+func (s *Schema) SDL() string {
+	var b strings.Builder
+
+	b.WriteString("enum order_by {\n  asc\n  desc\n}\n\n")
+	b.WriteString("type mutation_response {\n  affected_rows: Int!\n  last_insert_id: Int!\n}\n\n")
+	for _, scalar := range []string{ScalarInt, ScalarFloat, ScalarString, ScalarBoolean} {
+		fmt.Fprintf(&b, "input %s_comparison_exp {\n", scalar)
+		for _, op := range []string{"_eq", "_neq", "_gt", "_gte", "_lt", "_lte"} {
+			fmt.Fprintf(&b, "  %s: %s\n", op, scalar)
+		}
+		fmt.Fprintf(&b, "  _in: [%s!]\n  _nin: [%s!]\n", scalar, scalar)
+		if scalar == ScalarString {
+			b.WriteString("  _like: String\n  _nlike: String\n")
+		}
+		b.WriteString("  _is_null: Boolean\n}\n\n")
+	}
+
+	for _, t := range s.Tables {
+		fmt.Fprintf(&b, "type %s {\n", t.Name)
+		for _, c := range t.Columns {
+			nonNull := ""
+			if c.NotNull {
+				nonNull = "!"
+			}
+			fmt.Fprintf(&b, "  %s: %s%s\n", c.Name, c.Scalar, nonNull)
+		}
+		b.WriteString("}\n\n")
+
+		fmt.Fprintf(&b, "input %s_bool_exp {\n", t.Name)
+		fmt.Fprintf(&b, "  _and: [%s_bool_exp!]\n  _or: [%s_bool_exp!]\n  _not: %s_bool_exp\n", t.Name, t.Name, t.Name)
+		for _, c := range t.Columns {
+			fmt.Fprintf(&b, "  %s: %s_comparison_exp\n", c.Name, c.Scalar)
+		}
+		b.WriteString("}\n\n")
+
+		fmt.Fprintf(&b, "input %s_order_by {\n", t.Name)
+		for _, c := range t.Columns {
+			fmt.Fprintf(&b, "  %s: order_by\n", c.Name)
+		}
+		b.WriteString("}\n\n")
+
+		fmt.Fprintf(&b, "input %s_input {\n", t.Name)
+		for _, c := range t.Columns {
+			fmt.Fprintf(&b, "  %s: %s\n", c.Name, c.Scalar)
+		}
+		b.WriteString("}\n\n")
+	}
+
+	b.WriteString("type Query {\n")
+	for _, t := range s.Tables {
+		fmt.Fprintf(&b, "  %s(where: %s_bool_exp, order_by: [%s_order_by!], limit: Int, offset: Int): [%s!]!\n",
+			t.Name, t.Name, t.Name, t.Name)
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("type Mutation {\n")
+	for _, t := range s.Tables {
+		fmt.Fprintf(&b, "  insert_%s(objects: [%s_input!]!): mutation_response\n", t.Name, t.Name)
+		fmt.Fprintf(&b, "  update_%s(where: %s_bool_exp!, _set: %s_input!): mutation_response\n", t.Name, t.Name, t.Name)
+		fmt.Fprintf(&b, "  delete_%s(where: %s_bool_exp!): mutation_response\n", t.Name, t.Name)
+	}
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// SchemaCache caches generated schemas of databases, the schema is regenerated after DDL is detected.
+type SchemaCache struct {
+	lock          sync.Mutex
+	schemas       map[string]*Schema
+	checkInterval time.Duration
+}
+
+// NewSchemaCache returns a schema cache, cached schema is verified against sqlite_master
+// after checkInterval to detect DDL not sent through adapter.
+func NewSchemaCache(checkInterval time.Duration) *SchemaCache {
+	return &SchemaCache{
+		schemas:       make(map[string]*Schema),
+		checkInterval: checkInterval,
+	}
+}
+
+// Get returns the cached schema or loads the schema of the database.
+func (c *SchemaCache) Get(q Querier, dbID string) (s *Schema, err error) {
+	c.lock.Lock()
+	s = c.schemas[dbID]
+	fresh := s != nil && time.Since(s.loaded) < c.checkInterval
+	c.lock.Unlock()
+
+	if fresh {
+		return
+	}
+
+	if s != nil {
+		// check if sqlite_master is changed
+		var rows [][]interface{}
+		if _, _, rows, err = q.Query(dbID,
+			"SELECT name, sql FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name"); err != nil {
+			return
+		}
+		if schemaFingerprint(rows) == s.fingerprint {
+			c.lock.Lock()
+			s.loaded = time.Now()
+			c.lock.Unlock()
+			return
+		}
+		log.WithField("db", dbID).Info("database schema changed, regenerate graphql schema")
+	}
+
+	if s, err = LoadSchema(q, dbID); err != nil {
+		return
+	}
+
+	c.lock.Lock()
+	c.schemas[dbID] = s
+	c.lock.Unlock()
+
+	return
+}
+
+// Invalidate drops the cached schema of the database.
+func (c *SchemaCache) Invalidate(dbID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.schemas, dbID)
+}
+
+// InvalidateOnDDL drops the cached schema of the database if any of the queries is DDL.
+func (c *SchemaCache) InvalidateOnDDL(dbID string, queries ...string) {
+	for _, q := range queries {
+		if IsDDL(q) {
+			c.Invalidate(dbID)
+			return
+		}
+	}
+}
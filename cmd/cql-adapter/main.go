@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/metric"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	"golang.org/x/sys/unix"
 )
@@ -36,12 +37,14 @@ var (
 	version     = "unknown"
 	configFile  string
 	password    string
+	metricWeb   string
 	showVersion bool
 )
 
 func init() {
 	flag.StringVar(&configFile, "config", "./config.yaml", "config file for adapter")
 	flag.StringVar(&password, "password", "", "master key password")
+	flag.StringVar(&metricWeb, "metric-web", "", "Address to serve prometheus metrics on /metrics, default not started")
 	flag.BoolVar(&asymmetric.BypassSignature, "bypassSignature", false,
 		"Disable signature sign and verify, for testing")
 	flag.BoolVar(&showVersion, "version", false, "Show version information and exit")
@@ -65,6 +68,12 @@ func main() {
 		return
 	}
 
+	if len(metricWeb) > 0 {
+		if _, err = metric.StartMetricWeb(metricWeb); err != nil {
+			log.WithError(err).Fatal("start metric web failed")
+		}
+	}
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, unix.SIGTERM)
 
@@ -56,7 +56,7 @@ func (s *CovenantSQLStorage) Drop(dbID string) (err error) {
 }
 
 // Query implements the Storage abstraction interface.
-func (s *CovenantSQLStorage) Query(dbID string, query string) (columns []string, types []string, result [][]interface{}, err error) {
+func (s *CovenantSQLStorage) Query(dbID string, query string, args ...interface{}) (columns []string, types []string, result [][]interface{}, err error) {
 	var conn *sql.DB
 	if conn, err = s.getConn(dbID); err != nil {
 		return
@@ -64,35 +64,39 @@ func (s *CovenantSQLStorage) Query(dbID string, query string) (columns []string,
 	defer conn.Close()
 
 	var rows *sql.Rows
-	if rows, err = conn.Query(query); err != nil {
+	if rows, err = conn.Query(query, args...); err != nil {
 		return
 	}
 	defer rows.Close()
 
-	if columns, err = rows.Columns(); err != nil {
+	if columns, types, err = readColumns(rows); err != nil {
 		return
 	}
 
-	var colTypes []*sql.ColumnType
+	result, err = readAllRows(rows)
+	return
+}
 
-	if colTypes, err = rows.ColumnTypes(); err != nil {
+// QueryEach implements the Storage abstraction interface.
+func (s *CovenantSQLStorage) QueryEach(dbID string, query string, args []interface{}, header HeaderFunc, row RowFunc) (err error) {
+	var conn *sql.DB
+	if conn, err = s.getConn(dbID); err != nil {
 		return
 	}
+	defer conn.Close()
 
-	types = make([]string, len(colTypes))
-
-	for i, c := range colTypes {
-		if c != nil {
-			types[i] = c.DatabaseTypeName()
-		}
+	var rows *sql.Rows
+	if rows, err = conn.Query(query, args...); err != nil {
+		return
 	}
+	defer rows.Close()
 
-	result, err = readAllRows(rows)
+	err = eachRow(rows, header, row)
 	return
 }
 
 // Exec implements the Storage abstraction interface.
-func (s *CovenantSQLStorage) Exec(dbID string, query string) (affectedRows int64, lastInsertID int64, err error) {
+func (s *CovenantSQLStorage) Exec(dbID string, query string, args ...interface{}) (affectedRows int64, lastInsertID int64, err error) {
 	var conn *sql.DB
 	if conn, err = s.getConn(dbID); err != nil {
 		return
@@ -100,7 +104,7 @@ func (s *CovenantSQLStorage) Exec(dbID string, query string) (affectedRows int64
 	defer conn.Close()
 
 	var result sql.Result
-	result, err = conn.Exec(query)
+	result, err = conn.Exec(query, args...)
 
 	if err == nil {
 		affectedRows, _ = result.RowsAffected()
@@ -110,6 +114,19 @@ func (s *CovenantSQLStorage) Exec(dbID string, query string) (affectedRows int64
 	return
 }
 
+// ExecBatch implements the Storage abstraction interface.
+func (s *CovenantSQLStorage) ExecBatch(dbID string, queries []Query) (err error) {
+	var conn *sql.DB
+	if conn, err = s.getConn(dbID); err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// covenantsql driver packs all queries in transaction to single write request on commit
+	err = execBatch(conn, queries)
+	return
+}
+
 func (s *CovenantSQLStorage) getConn(dbID string) (db *sql.DB, err error) {
 	cfg := client.NewConfig()
 	cfg.DatabaseID = dbID
@@ -74,7 +74,7 @@ func (s *SQLite3Storage) Drop(dbID string) (err error) {
 }
 
 // Query implements the Storage abstraction interface.
-func (s *SQLite3Storage) Query(dbID string, query string) (columns []string, types []string, result [][]interface{}, err error) {
+func (s *SQLite3Storage) Query(dbID string, query string, args ...interface{}) (columns []string, types []string, result [][]interface{}, err error) {
 	var conn *sql.DB
 	if conn, err = s.getConn(dbID, true); err != nil {
 		return
@@ -88,35 +88,45 @@ func (s *SQLite3Storage) Query(dbID string, query string) (columns []string, typ
 	defer tx.Rollback()
 
 	var rows *sql.Rows
-	if rows, err = tx.Query(query); err != nil {
+	if rows, err = tx.Query(query, args...); err != nil {
 		return
 	}
 	defer rows.Close()
 
-	if columns, err = rows.Columns(); err != nil {
+	if columns, types, err = readColumns(rows); err != nil {
 		return
 	}
 
-	var colTypes []*sql.ColumnType
+	result, err = readAllRows(rows)
+	return
+}
 
-	if colTypes, err = rows.ColumnTypes(); err != nil {
+// QueryEach implements the Storage abstraction interface.
+func (s *SQLite3Storage) QueryEach(dbID string, query string, args []interface{}, header HeaderFunc, row RowFunc) (err error) {
+	var conn *sql.DB
+	if conn, err = s.getConn(dbID, true); err != nil {
 		return
 	}
+	defer conn.Close()
 
-	types = make([]string, len(colTypes))
+	var tx *sql.Tx
+	if tx, err = conn.Begin(); err != nil {
+		return
+	}
+	defer tx.Rollback()
 
-	for i, c := range colTypes {
-		if c != nil {
-			types[i] = c.DatabaseTypeName()
-		}
+	var rows *sql.Rows
+	if rows, err = tx.Query(query, args...); err != nil {
+		return
 	}
+	defer rows.Close()
 
-	result, err = readAllRows(rows)
+	err = eachRow(rows, header, row)
 	return
 }
 
 // Exec implements the Storage abstraction interface.
-func (s *SQLite3Storage) Exec(dbID string, query string) (affectedRows int64, lastInsertID int64, err error) {
+func (s *SQLite3Storage) Exec(dbID string, query string, args ...interface{}) (affectedRows int64, lastInsertID int64, err error) {
 	var conn *sql.DB
 	if conn, err = s.getConn(dbID, false); err != nil {
 		return
@@ -124,7 +134,7 @@ func (s *SQLite3Storage) Exec(dbID string, query string) (affectedRows int64, la
 	defer conn.Close()
 
 	var result sql.Result
-	result, err = conn.Exec(query)
+	result, err = conn.Exec(query, args...)
 
 	affectedRows, _ = result.RowsAffected()
 	lastInsertID, _ = result.LastInsertId()
@@ -132,6 +142,18 @@ func (s *SQLite3Storage) Exec(dbID string, query string) (affectedRows int64, la
 	return
 }
 
+// ExecBatch implements the Storage abstraction interface.
+func (s *SQLite3Storage) ExecBatch(dbID string, queries []Query) (err error) {
+	var conn *sql.DB
+	if conn, err = s.getConn(dbID, false); err != nil {
+		return
+	}
+	defer conn.Close()
+
+	err = execBatch(conn, queries)
+	return
+}
+
 func (s *SQLite3Storage) getConn(dbID string, readonly bool) (db *sql.DB, err error) {
 	dbFile := filepath.Join(s.rootDir, dbID+".db3")
 	dbDSN := fmt.Sprintf("file:%s?_journal_mode=WAL&_synchronous=NORMAL", dbFile)
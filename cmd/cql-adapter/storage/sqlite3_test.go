@@ -0,0 +1,110 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSQLite3Storage(t *testing.T) {
+	Convey("test sqlite3 storage", t, func() {
+		dir, err := ioutil.TempDir("", "adapter_storage")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		s, err := NewSQLite3Storage(dir)
+		So(err, ShouldBeNil)
+		dbID, err := s.Create(1)
+		So(err, ShouldBeNil)
+		defer s.Drop(dbID)
+
+		_, _, err = s.Exec(dbID, "CREATE TABLE t (id INTEGER PRIMARY KEY, v TEXT)")
+		So(err, ShouldBeNil)
+
+		Convey("batch should be applied atomically", func() {
+			err = s.ExecBatch(dbID, []Query{
+				{Pattern: "INSERT INTO t VALUES (?, ?)", Args: []interface{}{int64(1), "a"}},
+				{Pattern: "INSERT INTO t VALUES (:id, :v)", Args: []interface{}{sql.Named("id", int64(2)), sql.Named("v", "b")}},
+			})
+			So(err, ShouldBeNil)
+			_, _, rows, err := s.Query(dbID, "SELECT id, v FROM t ORDER BY id")
+			So(err, ShouldBeNil)
+			So(rows, ShouldResemble, [][]interface{}{{int64(1), "a"}, {int64(2), "b"}})
+
+			// duplicate primary key in the last query rolls back the whole batch
+			err = s.ExecBatch(dbID, []Query{
+				{Pattern: "INSERT INTO t VALUES (?, ?)", Args: []interface{}{int64(3), "c"}},
+				{Pattern: "UPDATE t SET v = ? WHERE id = ?", Args: []interface{}{"x", int64(1)}},
+				{Pattern: "INSERT INTO t VALUES (?, ?)", Args: []interface{}{int64(2), "d"}},
+			})
+			So(err, ShouldNotBeNil)
+			_, _, rows, err = s.Query(dbID, "SELECT id, v FROM t ORDER BY id")
+			So(err, ShouldBeNil)
+			So(rows, ShouldResemble, [][]interface{}{{int64(1), "a"}, {int64(2), "b"}})
+		})
+
+		Convey("query each should send header before rows", func() {
+			_, _, err = s.Exec(dbID, "INSERT INTO t VALUES (1, 'a'), (2, 'b'), (3, 'c')")
+			So(err, ShouldBeNil)
+
+			var (
+				columns []string
+				rows    [][]interface{}
+			)
+			err = s.QueryEach(dbID, "SELECT id, v FROM t WHERE id > ? ORDER BY id", []interface{}{int64(1)},
+				func(c []string, types []string) error {
+					So(rows, ShouldBeEmpty)
+					columns = c
+					return nil
+				},
+				func(row []interface{}) error {
+					rows = append(rows, row)
+					return nil
+				},
+			)
+			So(err, ShouldBeNil)
+			So(columns, ShouldResemble, []string{"id", "v"})
+			So(rows, ShouldResemble, [][]interface{}{{int64(2), "b"}, {int64(3), "c"}})
+
+			// callback error stops the iteration
+			errStop := errors.New("stop")
+			rows = nil
+			err = s.QueryEach(dbID, "SELECT id FROM t", nil,
+				func([]string, []string) error { return nil },
+				func(row []interface{}) error {
+					rows = append(rows, row)
+					return errStop
+				},
+			)
+			So(err, ShouldEqual, errStop)
+			So(rows, ShouldHaveLength, 1)
+
+			// readonly connection rejects writes
+			err = s.QueryEach(dbID, "INSERT INTO t VALUES (4, 'd')", nil,
+				func([]string, []string) error { return nil },
+				func([]interface{}) error { return nil },
+			)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -28,11 +28,27 @@ type Storage interface {
 	// Drop operation.
 	Drop(dbID string) (err error)
 	// Query for result.
-	Query(dbID string, query string) (columns []string, types []string, rows [][]interface{}, err error)
+	Query(dbID string, query string, args ...interface{}) (columns []string, types []string, rows [][]interface{}, err error)
+	// QueryEach for result row by row.
+	QueryEach(dbID string, query string, args []interface{}, header HeaderFunc, row RowFunc) (err error)
 	// Exec for update.
-	Exec(dbID string, query string) (affectedRows int64, lastInsertID int64, err error)
+	Exec(dbID string, query string, args ...interface{}) (affectedRows int64, lastInsertID int64, err error)
+	// ExecBatch for atomic multi-query update.
+	ExecBatch(dbID string, queries []Query) (err error)
 }
 
+// Query defines a query pattern with bind arguments, named arguments are wrapped using sql.Named.
+type Query struct {
+	Pattern string
+	Args    []interface{}
+}
+
+// HeaderFunc defines the callback receiving result columns before any rows.
+type HeaderFunc func(columns []string, types []string) error
+
+// RowFunc defines the callback receiving each result row.
+type RowFunc func(row []interface{}) error
+
 // golang does trick convert, use rowScanner to return the original result type in sqlite3 driver
 type rowScanner struct {
 	fieldCnt int
@@ -85,6 +101,72 @@ func (s *rowScanner) ScanArgs() []interface{} {
 	return s.scanArgs
 }
 
+func readColumns(rows *sql.Rows) (columns []string, types []string, err error) {
+	if columns, err = rows.Columns(); err != nil {
+		return
+	}
+
+	var colTypes []*sql.ColumnType
+
+	if colTypes, err = rows.ColumnTypes(); err != nil {
+		return
+	}
+
+	types = make([]string, len(colTypes))
+
+	for i, c := range colTypes {
+		if c != nil {
+			types[i] = c.DatabaseTypeName()
+		}
+	}
+
+	return
+}
+
+func eachRow(rows *sql.Rows, header HeaderFunc, row RowFunc) (err error) {
+	var columns, types []string
+	if columns, types, err = readColumns(rows); err != nil {
+		return
+	}
+
+	if err = header(columns, types); err != nil {
+		return
+	}
+
+	rs := newRowScanner(len(columns))
+
+	for rows.Next() {
+		if err = rows.Scan(rs.ScanArgs()...); err != nil {
+			return
+		}
+
+		if err = row(rs.GetRow()); err != nil {
+			return
+		}
+	}
+
+	err = rows.Err()
+
+	return
+}
+
+func execBatch(conn *sql.DB, queries []Query) (err error) {
+	var tx *sql.Tx
+	if tx, err = conn.Begin(); err != nil {
+		return
+	}
+
+	for _, q := range queries {
+		if _, err = tx.Exec(q.Pattern, q.Args...); err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
 func readAllRows(rows *sql.Rows) (result [][]interface{}, err error) {
 	var columns []string
 	if columns, err = rows.Columns(); err != nil {
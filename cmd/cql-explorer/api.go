@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
@@ -34,6 +35,10 @@ import (
 
 var (
 	apiTimeout = time.Second * 10
+
+	// defaultPageSize and maxPageSize define the page size of the paginated apis.
+	defaultPageSize = 20
+	maxPageSize     = 100
 )
 
 func sendResponse(code int, success bool, msg interface{}, data interface{}, rw http.ResponseWriter) {
@@ -79,6 +84,51 @@ func getUintFromVars(field string, r *http.Request) (value uint32, err error) {
 	return
 }
 
+func getPageFromQuery(r *http.Request) (q pageQuery, err error) {
+	q.page, q.size = 1, defaultPageSize
+	query := r.URL.Query()
+
+	if pageStr := query.Get("page"); pageStr != "" {
+		if q.page, err = strconv.Atoi(pageStr); err != nil || q.page < 1 {
+			err = ErrBadRequest
+			return
+		}
+	}
+
+	if sizeStr := query.Get("size"); sizeStr != "" {
+		if q.size, err = strconv.Atoi(sizeStr); err != nil || q.size < 1 || q.size > maxPageSize {
+			err = ErrBadRequest
+			return
+		}
+	}
+
+	if beforeStr := query.Get("before"); beforeStr != "" {
+		var before txRef
+		if before, err = parseTxRef(beforeStr); err != nil {
+			return
+		}
+		q.before = &before
+	}
+
+	return
+}
+
+func formatPage(q pageQuery, total int, next *txRef) (page map[string]interface{}) {
+	page = map[string]interface{}{
+		"size":  q.size,
+		"total": total,
+	}
+	if q.before != nil {
+		page["before"] = q.before.String()
+	} else {
+		page["page"] = q.page
+	}
+	if next != nil {
+		page["next"] = next.String()
+	}
+	return
+}
+
 type explorerAPI struct {
 	service *Service
 }
@@ -163,6 +213,129 @@ func (a *explorerAPI) GetTxByHash(rw http.ResponseWriter, r *http.Request) {
 	sendResponse(200, true, nil, a.formatTx(count, height, tx), rw)
 }
 
+func (a *explorerAPI) GetTxsByAddress(rw http.ResponseWriter, r *http.Request) {
+	addr, err := a.getAddress(r)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	q, err := getPageFromQuery(r)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	txs, total, next, err := a.service.getTxsByAddress(addr, q)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	sendResponse(200, true, nil, a.formatTxList(q, total, next, txs), rw)
+}
+
+func (a *explorerAPI) GetTxsByDatabase(rw http.ResponseWriter, r *http.Request) {
+	dbID := proto.DatabaseID(mux.Vars(r)["db"])
+	if dbID == "" {
+		sendError(ErrBadRequest, rw)
+		return
+	}
+
+	q, err := getPageFromQuery(r)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	txs, total, next, err := a.service.getTxsByDatabase(dbID, q)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	sendResponse(200, true, nil, a.formatTxList(q, total, next, txs), rw)
+}
+
+func (a *explorerAPI) GetTxsByType(rw http.ResponseWriter, r *http.Request) {
+	txType, err := a.getTxType(r)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	q, err := getPageFromQuery(r)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	txs, total, next, err := a.service.getTxsByType(txType, q)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	sendResponse(200, true, nil, a.formatTxList(q, total, next, txs), rw)
+}
+
+func (a *explorerAPI) GetBalanceHistory(rw http.ResponseWriter, r *http.Request) {
+	addr, err := a.getAddress(r)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	q, err := getPageFromQuery(r)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	records, total, next, err := a.service.getBalanceHistory(addr, q)
+	if err != nil {
+		sendError(err, rw)
+		return
+	}
+
+	history := make([]map[string]interface{}, 0, len(records))
+	for _, rec := range records {
+		history = append(history, map[string]interface{}{
+			"height":           rec.Height,
+			"count":            rec.Count,
+			"tx":               rec.TxHash.String(),
+			"type":             rec.TxType.String(),
+			"timestamp":        a.formatTime(rec.Timestamp),
+			"stable_balance":   rec.After.Stable,
+			"covenant_balance": rec.After.Covenant,
+			"stable_change":    int64(rec.After.Stable - rec.Before.Stable),
+			"covenant_change":  int64(rec.After.Covenant - rec.Before.Covenant),
+		})
+	}
+
+	data := formatPage(q, total, next)
+	data["history"] = history
+	sendResponse(200, true, nil, data, rw)
+}
+
+func (a *explorerAPI) formatTxList(q pageQuery, total int, next *txRef, txs []*indexedTx) map[string]interface{} {
+	list := make([]map[string]interface{}, 0, len(txs))
+
+	for _, t := range txs {
+		if res := a.formatRawTx(t.tx); res != nil {
+			res["hash"] = t.tx.Hash().String()
+			res["height"] = t.height
+			res["count"] = t.count
+			res["timestamp"] = a.formatTime(t.ts)
+			list = append(list, res)
+		}
+	}
+
+	data := formatPage(q, total, next)
+	data["txs"] = list
+	return data
+}
+
 func (a *explorerAPI) formatTime(t time.Time) float64 {
 	return float64(t.UnixNano()) / 1e6
 }
@@ -289,6 +462,37 @@ func (a *explorerAPI) getHash(r *http.Request) (h *hash.Hash, err error) {
 	return hash.NewHashFromStr(hStr)
 }
 
+func (a *explorerAPI) getAddress(r *http.Request) (addr proto.AccountAddress, err error) {
+	var h *hash.Hash
+	if h, err = hash.NewHashFromStr(mux.Vars(r)["addr"]); err != nil {
+		err = ErrBadRequest
+		return
+	}
+	addr = proto.AccountAddress(*h)
+	return
+}
+
+func (a *explorerAPI) getTxType(r *http.Request) (t pi.TransactionType, err error) {
+	typeStr := mux.Vars(r)["type"]
+
+	// accept both the type name and the type number
+	for t = 0; t < pi.TransactionTypeNumber; t++ {
+		if strings.EqualFold(t.String(), typeStr) {
+			return
+		}
+	}
+
+	var typeUint uint64
+	if typeUint, err = strconv.ParseUint(typeStr, 10, 32); err != nil ||
+		typeUint >= uint64(pi.TransactionTypeNumber) {
+		err = ErrBadRequest
+		return
+	}
+
+	t = pi.TransactionType(typeUint)
+	return
+}
+
 func startAPI(service *Service, listenAddr string) (server *http.Server, err error) {
 	router := mux.NewRouter()
 	router.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
@@ -304,6 +508,10 @@ func startAPI(service *Service, listenAddr string) (server *http.Server, err err
 	v1Router.HandleFunc("/block/{hash}", api.GetBlockByHash).Methods("GET")
 	v1Router.HandleFunc("/count/{count:[0-9]+}", api.GetBlockByCount).Methods("GET")
 	v1Router.HandleFunc("/head", api.GetHighestBlock).Methods("GET")
+	v1Router.HandleFunc("/address/{addr}/txs", api.GetTxsByAddress).Methods("GET")
+	v1Router.HandleFunc("/address/{addr}/balances", api.GetBalanceHistory).Methods("GET")
+	v1Router.HandleFunc("/db/{db}/txs", api.GetTxsByDatabase).Methods("GET")
+	v1Router.HandleFunc("/type/{type}/txs", api.GetTxsByType).Methods("GET")
 
 	server = &http.Server{
 		Addr:         listenAddr,
@@ -0,0 +1,589 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// indexVersion is increased if the secondary indexes are changed, the indexes are rebuilt
+// from the synced blocks on version mismatch.
+const indexVersion uint32 = 2
+
+var (
+	// secondary index keys, the transaction indexes are suffixed by the block count and the
+	// transaction index in block
+	addrIndexPrefix      = []byte("ADDR_")
+	typeIndexPrefix      = []byte("TYPE_")
+	dbIndexPrefix        = []byte("DB_")
+	balancePrefix        = []byte("BALANCE_")
+	balanceHistoryPrefix = []byte("BALHIST_")
+	// indexCountPrefix keys the entries count of each index, updated in the same batch
+	indexCountPrefix = []byte("COUNT_")
+	indexVersionKey  = []byte("INDEX_VERSION")
+)
+
+// txRef refers to the index-th transaction of the block at count.
+type txRef struct {
+	count uint32
+	index uint32
+}
+
+func (r txRef) bytes() []byte {
+	return append(uint32ToBytes(r.count), uint32ToBytes(r.index)...)
+}
+
+func txRefFromBytes(data []byte) txRef {
+	return txRef{count: bytesToUint32(data[:4]), index: bytesToUint32(data[4:8])}
+}
+
+// String returns the cursor form "count,index" of the transaction reference.
+func (r txRef) String() string {
+	return fmt.Sprintf("%d,%d", r.count, r.index)
+}
+
+// parseTxRef parses the transaction reference from the cursor form "count,index".
+func parseTxRef(s string) (r txRef, err error) {
+	var (
+		fields = strings.Split(s, ",")
+		v      uint64
+	)
+	if len(fields) != 2 {
+		err = ErrBadRequest
+		return
+	}
+	if v, err = strconv.ParseUint(fields[0], 10, 32); err != nil {
+		err = ErrBadRequest
+		return
+	}
+	r.count = uint32(v)
+	if v, err = strconv.ParseUint(fields[1], 10, 32); err != nil {
+		err = ErrBadRequest
+		return
+	}
+	r.index = uint32(v)
+	return
+}
+
+// pageQuery defines a page of the index entries in reverse order, the entries older than the
+// before cursor are listed if it's set, page is ignored then.
+type pageQuery struct {
+	page   int
+	size   int
+	before *txRef
+}
+
+// accountBalance defines the balance of an account.
+type accountBalance struct {
+	Stable   uint64
+	Covenant uint64
+}
+
+func (b *accountBalance) bytes() (data []byte) {
+	data = make([]byte, 16)
+	binary.BigEndian.PutUint64(data[:8], b.Stable)
+	binary.BigEndian.PutUint64(data[8:], b.Covenant)
+	return
+}
+
+// balanceRecord defines a balance change of an account applied by a transaction.
+type balanceRecord struct {
+	Count     uint32
+	Height    uint32
+	Index     uint32
+	TxHash    hash.Hash
+	TxType    pi.TransactionType
+	Timestamp time.Time
+	Before    accountBalance
+	After     accountBalance
+}
+
+func addrIndexKey(addr proto.AccountAddress) (key []byte) {
+	key = append(key, addrIndexPrefix...)
+	key = append(key, addr[:]...)
+	return
+}
+
+func typeIndexKey(t pi.TransactionType) (key []byte) {
+	key = append(key, typeIndexPrefix...)
+	key = append(key, t.Bytes()...)
+	return
+}
+
+func dbIndexKey(dbID proto.DatabaseID) (key []byte) {
+	key = append(key, dbIndexPrefix...)
+	key = append(key, dbID...)
+	// terminate the variable length database id to avoid matching the ids sharing prefix
+	key = append(key, 0)
+	return
+}
+
+func balanceKey(addr proto.AccountAddress) (key []byte) {
+	key = append(key, balancePrefix...)
+	key = append(key, addr[:]...)
+	return
+}
+
+func balanceHistoryKey(addr proto.AccountAddress) (key []byte) {
+	key = append(key, balanceHistoryPrefix...)
+	key = append(key, addr[:]...)
+	return
+}
+
+func indexCountKey(prefix []byte) (key []byte) {
+	key = append(key, indexCountPrefix...)
+	key = append(key, prefix...)
+	return
+}
+
+// txAddresses returns the accounts involved in the transaction as sender or receiver.
+func txAddresses(t pi.Transaction) (addrs []proto.AccountAddress) {
+	switch tx := t.(type) {
+	case *pt.Transfer:
+		addrs = append(addrs, tx.Sender, tx.Receiver)
+	case *pt.Billing:
+		addrs = append(addrs, tx.Producer)
+		for _, r := range tx.Receivers {
+			if r != nil {
+				addrs = append(addrs, *r)
+			}
+		}
+	case *pi.TransactionWrapper:
+		return txAddresses(tx.Unwrap())
+	default:
+		addrs = append(addrs, t.GetAccountAddress())
+	}
+
+	// remove duplicates
+	var (
+		uniq = addrs[:0]
+		seen = make(map[proto.AccountAddress]bool, len(addrs))
+	)
+	for _, a := range addrs {
+		if !seen[a] {
+			seen[a] = true
+			uniq = append(uniq, a)
+		}
+	}
+	return uniq
+}
+
+// txDatabaseID returns the database the transaction applies to, or empty.
+func txDatabaseID(t pi.Transaction) proto.DatabaseID {
+	switch tx := t.(type) {
+	case *pt.Billing:
+		return tx.BillingRequest.Header.DatabaseID
+	case *pt.DropDatabase:
+		return tx.DatabaseID
+	case *pi.TransactionWrapper:
+		return txDatabaseID(tx.Unwrap())
+	}
+	return ""
+}
+
+// blockIndexer builds the secondary indexes of the transactions in a block.
+type blockIndexer struct {
+	s        *Service
+	batch    *leveldb.Batch
+	balances map[proto.AccountAddress]*accountBalance
+	counts   map[string]uint32
+}
+
+func newBlockIndexer(s *Service, batch *leveldb.Batch) *blockIndexer {
+	return &blockIndexer{
+		s:        s,
+		batch:    batch,
+		balances: make(map[proto.AccountAddress]*accountBalance),
+		counts:   make(map[string]uint32),
+	}
+}
+
+// put adds the entry of the transaction to the index with prefix and increases the entries
+// count of the index.
+func (bi *blockIndexer) put(prefix []byte, ref txRef, value []byte) (err error) {
+	count, ok := bi.counts[string(prefix)]
+	if !ok {
+		if count, err = bi.s.getIndexCount(prefix); err != nil {
+			return
+		}
+	}
+	count++
+	bi.counts[string(prefix)] = count
+	bi.batch.Put(append(append([]byte(nil), prefix...), ref.bytes()...), value)
+	bi.batch.Put(indexCountKey(prefix), uint32ToBytes(count))
+	return
+}
+
+func (bi *blockIndexer) indexBlock(c uint32, h uint32, b *pt.Block) (err error) {
+	for i, t := range b.Transactions {
+		if t == nil {
+			continue
+		}
+		if err = bi.indexTransaction(txRef{count: c, index: uint32(i)}, h, b.Timestamp(), t); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (bi *blockIndexer) indexTransaction(
+	ref txRef, h uint32, ts time.Time, t pi.Transaction) (err error,
+) {
+	txHash := t.Hash()
+
+	for _, addr := range txAddresses(t) {
+		if err = bi.put(addrIndexKey(addr), ref, txHash[:]); err != nil {
+			return
+		}
+	}
+	if err = bi.put(typeIndexKey(t.GetTransactionType()), ref, txHash[:]); err != nil {
+		return
+	}
+	if dbID := txDatabaseID(t); dbID != "" {
+		if err = bi.put(dbIndexKey(dbID), ref, txHash[:]); err != nil {
+			return
+		}
+	}
+
+	// apply the balance changes
+	record := func(addr proto.AccountAddress, apply func(b *accountBalance)) (err error) {
+		var balance *accountBalance
+		if balance, err = bi.getBalance(addr); err != nil {
+			return
+		}
+		r := &balanceRecord{
+			Count:     ref.count,
+			Height:    h,
+			Index:     ref.index,
+			TxHash:    txHash,
+			TxType:    t.GetTransactionType(),
+			Timestamp: ts,
+			Before:    *balance,
+		}
+		apply(balance)
+		r.After = *balance
+		var buf *bytes.Buffer
+		if buf, err = utils.EncodeMsgPack(r); err != nil {
+			return
+		}
+		bi.batch.Put(balanceKey(addr), balance.bytes())
+		return bi.put(balanceHistoryKey(addr), ref, buf.Bytes())
+	}
+
+	switch tx := unwrapTx(t).(type) {
+	case *pt.Transfer:
+		if tx.Sender == tx.Receiver || tx.Amount == 0 {
+			return
+		}
+		if err = record(tx.Sender, func(b *accountBalance) {
+			b.Stable = saturatingSub(b.Stable, tx.Amount)
+		}); err != nil {
+			return
+		}
+		err = record(tx.Receiver, func(b *accountBalance) {
+			b.Stable += tx.Amount
+		})
+	case *pt.Billing:
+		// merge the incomes of the same receiver, one balance record per account
+		var (
+			receivers []proto.AccountAddress
+			incomes   = make(map[proto.AccountAddress]*accountBalance)
+		)
+		for i, r := range tx.Receivers {
+			if r == nil || i >= len(tx.Fees) || i >= len(tx.Rewards) {
+				continue
+			}
+			income, ok := incomes[*r]
+			if !ok {
+				income = &accountBalance{}
+				incomes[*r] = income
+				receivers = append(receivers, *r)
+			}
+			income.Covenant += tx.Fees[i]
+			income.Stable += tx.Rewards[i]
+		}
+		for _, r := range receivers {
+			income := incomes[r]
+			if err = record(r, func(b *accountBalance) {
+				b.Covenant += income.Covenant
+				b.Stable += income.Stable
+			}); err != nil {
+				return
+			}
+		}
+	case *pt.BaseAccount:
+		err = record(tx.Address, func(b *accountBalance) {
+			b.Stable = tx.StableCoinBalance
+			b.Covenant = tx.CovenantCoinBalance
+		})
+	}
+
+	return
+}
+
+func (bi *blockIndexer) getBalance(addr proto.AccountAddress) (b *accountBalance, err error) {
+	var ok bool
+	if b, ok = bi.balances[addr]; ok {
+		return
+	}
+	if b, err = bi.s.getBalance(addr); err != nil {
+		return
+	}
+	bi.balances[addr] = b
+	return
+}
+
+func (s *Service) getIndexCount(prefix []byte) (count uint32, err error) {
+	var data []byte
+	if data, err = s.db.Get(indexCountKey(prefix), nil); err != nil {
+		if err == leveldb.ErrNotFound {
+			err = nil
+		}
+		return
+	}
+	if len(data) == 4 {
+		count = bytesToUint32(data)
+	}
+	return
+}
+
+func (s *Service) getBalance(addr proto.AccountAddress) (b *accountBalance, err error) {
+	var data []byte
+	b = &accountBalance{}
+	if data, err = s.db.Get(balanceKey(addr), nil); err != nil {
+		if err == leveldb.ErrNotFound {
+			err = nil
+		}
+		return
+	}
+	if len(data) == 16 {
+		b.Stable = binary.BigEndian.Uint64(data[:8])
+		b.Covenant = binary.BigEndian.Uint64(data[8:])
+	}
+	return
+}
+
+// checkIndexes rebuilds the secondary indexes from the synced blocks if the indexes are
+// missing or outdated.
+func (s *Service) checkIndexes() (err error) {
+	var data []byte
+	if data, err = s.db.Get(indexVersionKey, nil); err == nil && len(data) == 4 &&
+		bytesToUint32(data) == indexVersion {
+		return
+	} else if err != nil && err != leveldb.ErrNotFound {
+		return
+	}
+	err = nil
+
+	log.Info("rebuild explorer transaction indexes")
+
+	// drop the outdated indexes
+	for _, prefix := range [][]byte{
+		addrIndexPrefix, typeIndexPrefix, dbIndexPrefix, balancePrefix, balanceHistoryPrefix,
+		indexCountPrefix,
+	} {
+		batch := new(leveldb.Batch)
+		it := s.db.NewIterator(util.BytesPrefix(prefix), nil)
+		for it.Next() {
+			batch.Delete(append([]byte(nil), it.Key()...))
+		}
+		it.Release()
+		if err = it.Error(); err != nil {
+			return
+		}
+		if err = s.db.Write(batch, nil); err != nil {
+			return
+		}
+	}
+
+	// index the synced blocks in order
+	var count int
+	it := s.db.NewIterator(util.BytesPrefix(blockKeyPrefix), nil)
+	for it.Next() {
+		var (
+			key   = it.Key()[len(blockKeyPrefix):]
+			c     = bytesToUint32(key[:4])
+			h     = bytesToUint32(key[4:8])
+			b     *pt.Block
+			batch = new(leveldb.Batch)
+			ierr  error
+		)
+		if ierr = utils.DecodeMsgPack(it.Value(), &b); ierr != nil {
+			err = ierr
+			break
+		}
+		if ierr = newBlockIndexer(s, batch).indexBlock(c, h, b); ierr != nil {
+			err = ierr
+			break
+		}
+		if ierr = s.db.Write(batch, nil); ierr != nil {
+			err = ierr
+			break
+		}
+		count++
+	}
+	it.Release()
+	if err != nil {
+		return
+	}
+	if err = it.Error(); err != nil {
+		return
+	}
+
+	log.WithField("blocks", count).Info("rebuilt explorer transaction indexes")
+
+	return s.db.Put(indexVersionKey, uint32ToBytes(indexVersion), nil)
+}
+
+// listIndex iterates the index entries with prefix in reverse order, fn is called for the
+// entries in the page. total is the entries count of the index, next is the cursor of the
+// last entry listed if the page is full.
+func (s *Service) listIndex(prefix []byte, q pageQuery, fn func(key []byte, value []byte) error) (
+	total int, next *txRef, err error,
+) {
+	var count uint32
+	if count, err = s.getIndexCount(prefix); err != nil {
+		return
+	}
+	total = int(count)
+
+	var (
+		it = s.db.NewIterator(util.BytesPrefix(prefix), nil)
+		ok bool
+	)
+	if q.before != nil {
+		// seek to the cursor and step back to the older entries
+		if it.Seek(append(append([]byte(nil), prefix...), q.before.bytes()...)) {
+			ok = it.Prev()
+		} else {
+			ok = it.Last()
+		}
+	} else {
+		ok = it.Last()
+		for skip := (q.page - 1) * q.size; ok && skip > 0; skip-- {
+			ok = it.Prev()
+		}
+	}
+	for n := 0; ok && n < q.size; ok, n = it.Prev(), n+1 {
+		key := it.Key()[len(prefix):]
+		if err = fn(key, it.Value()); err != nil {
+			break
+		}
+		if n == q.size-1 {
+			ref := txRefFromBytes(key)
+			next = &ref
+		}
+	}
+	it.Release()
+	if err != nil {
+		return
+	}
+	err = it.Error()
+	return
+}
+
+// indexedTx defines a transaction loaded from the secondary indexes.
+type indexedTx struct {
+	tx     pi.Transaction
+	count  uint32
+	height uint32
+	ts     time.Time
+}
+
+func (s *Service) listTxs(prefix []byte, q pageQuery) (txs []*indexedTx, total int, next *txRef, err error) {
+	type block struct {
+		b      *pt.Block
+		height uint32
+	}
+	blocks := make(map[uint32]*block)
+	total, next, err = s.listIndex(prefix, q, func(key []byte, _ []byte) (err error) {
+		ref := txRefFromBytes(key)
+		blk, ok := blocks[ref.count]
+		if !ok {
+			blk = &block{}
+			if blk.b, _, blk.height, err = s.getBlockByCount(ref.count); err != nil {
+				return
+			}
+			blocks[ref.count] = blk
+		}
+		if blk.b == nil || int(ref.index) >= len(blk.b.Transactions) {
+			return ErrNotFound
+		}
+		txs = append(txs, &indexedTx{
+			tx:     blk.b.Transactions[ref.index],
+			count:  ref.count,
+			height: blk.height,
+			ts:     blk.b.Timestamp(),
+		})
+		return
+	})
+	return
+}
+
+func (s *Service) getTxsByAddress(addr proto.AccountAddress, q pageQuery) ([]*indexedTx, int, *txRef, error) {
+	return s.listTxs(addrIndexKey(addr), q)
+}
+
+func (s *Service) getTxsByType(t pi.TransactionType, q pageQuery) ([]*indexedTx, int, *txRef, error) {
+	return s.listTxs(typeIndexKey(t), q)
+}
+
+func (s *Service) getTxsByDatabase(dbID proto.DatabaseID, q pageQuery) ([]*indexedTx, int, *txRef, error) {
+	return s.listTxs(dbIndexKey(dbID), q)
+}
+
+func (s *Service) getBalanceHistory(addr proto.AccountAddress, q pageQuery) (
+	records []*balanceRecord, total int, next *txRef, err error,
+) {
+	total, next, err = s.listIndex(balanceHistoryKey(addr), q, func(_ []byte, value []byte) (err error) {
+		var r *balanceRecord
+		if err = utils.DecodeMsgPack(value, &r); err != nil {
+			return
+		}
+		records = append(records, r)
+		return
+	})
+	return
+}
+
+func unwrapTx(t pi.Transaction) pi.Transaction {
+	if w, ok := t.(*pi.TransactionWrapper); ok {
+		return unwrapTx(w.Unwrap())
+	}
+	return t
+}
+
+func saturatingSub(a, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+	return a - b
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+func testBlock(signer asymmetric.Signer, txs ...pi.Transaction) *pt.Block {
+	for _, tx := range txs {
+		So(tx.Sign(signer), ShouldBeNil)
+	}
+	return &pt.Block{
+		SignedHeader: pt.SignedHeader{
+			Header: pt.Header{Timestamp: time.Now().UTC()},
+		},
+		Transactions: txs,
+	}
+}
+
+func txTypes(txs []*indexedTx) (types []pi.TransactionType) {
+	for _, t := range txs {
+		types = append(types, unwrapTx(t.tx).GetTransactionType())
+	}
+	return
+}
+
+func TestIndex(t *testing.T) {
+	Convey("index the transactions of processed blocks", t, func() {
+		db, err := leveldb.Open(storage.NewMemStorage(), nil)
+		So(err, ShouldBeNil)
+		defer db.Close()
+		s := &Service{db: db}
+		So(s.checkIndexes(), ShouldBeNil)
+
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		var (
+			a1 = proto.AccountAddress{0x1}
+			a2 = proto.AccountAddress{0x2}
+			a3 = proto.AccountAddress{0x3}
+		)
+		billing := pt.NewBilling(pt.NewBillingHeader(1,
+			&pt.BillingRequest{Header: pt.BillingRequestHeader{DatabaseID: "db1"}},
+			a3, []*proto.AccountAddress{&a2, &a2, &a1}, []uint64{1, 2, 3}, []uint64{4, 5, 6}))
+		blocks := []*pt.Block{
+			testBlock(priv,
+				pt.NewBaseAccount(&pt.Account{Address: a1, StableCoinBalance: 100, CovenantCoinBalance: 10}),
+				pt.NewBaseAccount(&pt.Account{Address: a2})),
+			testBlock(priv,
+				pt.NewTransfer(&pt.TransferHeader{Sender: a1, Receiver: a2, Nonce: 1, Amount: 30}),
+				pt.NewTransfer(&pt.TransferHeader{Sender: a1, Receiver: a3, Nonce: 2, Amount: 20})),
+			testBlock(priv, billing),
+		}
+		for i, b := range blocks {
+			So(s.processBlock(uint32(i), uint32(i), b), ShouldBeNil)
+		}
+
+		check := func() {
+			// address, type and database listings
+			txs, total, next, err := s.getTxsByAddress(a1, pageQuery{page: 1, size: 10})
+			So(err, ShouldBeNil)
+			So(total, ShouldEqual, 4)
+			So(next, ShouldBeNil)
+			So(txTypes(txs), ShouldResemble, []pi.TransactionType{
+				pi.TransactionTypeBilling, pi.TransactionTypeTransfer,
+				pi.TransactionTypeTransfer, pi.TransactionTypeBaseAccount,
+			})
+			txs, total, _, err = s.getTxsByAddress(a3, pageQuery{page: 1, size: 10})
+			So(err, ShouldBeNil)
+			So(total, ShouldEqual, 2)
+			So(txs, ShouldHaveLength, 2)
+			txs, total, _, err = s.getTxsByType(pi.TransactionTypeTransfer, pageQuery{page: 1, size: 10})
+			So(err, ShouldBeNil)
+			So(total, ShouldEqual, 2)
+			So(txs[0].count, ShouldEqual, 1)
+			txs, total, _, err = s.getTxsByDatabase("db1", pageQuery{page: 1, size: 10})
+			So(err, ShouldBeNil)
+			So(total, ShouldEqual, 1)
+			So(txs[0].tx.Hash(), ShouldEqual, billing.Hash())
+			txs, total, _, err = s.getTxsByDatabase("db", pageQuery{page: 1, size: 10})
+			So(err, ShouldBeNil)
+			So(total, ShouldEqual, 0)
+			So(txs, ShouldBeEmpty)
+
+			// balance history from base account, transfer and billing
+			records, total, _, err := s.getBalanceHistory(a1, pageQuery{page: 1, size: 10})
+			So(err, ShouldBeNil)
+			So(total, ShouldEqual, 4)
+			So(records[0].After, ShouldResemble, accountBalance{Stable: 56, Covenant: 13})
+			So(records[0].Before, ShouldResemble, accountBalance{Stable: 50, Covenant: 10})
+			So(records[3].After, ShouldResemble, accountBalance{Stable: 100, Covenant: 10})
+
+			// duplicate billing receivers are merged in one record
+			records, total, _, err = s.getBalanceHistory(a2, pageQuery{page: 1, size: 10})
+			So(err, ShouldBeNil)
+			So(total, ShouldEqual, 3)
+			So(records[0].TxType, ShouldEqual, pi.TransactionTypeBilling)
+			So(records[0].After, ShouldResemble, accountBalance{Stable: 39, Covenant: 3})
+			b, err := s.getBalance(a2)
+			So(err, ShouldBeNil)
+			So(*b, ShouldResemble, accountBalance{Stable: 39, Covenant: 3})
+			b, err = s.getBalance(a3)
+			So(err, ShouldBeNil)
+			So(*b, ShouldResemble, accountBalance{Stable: 20})
+
+			// reverse pagination by page and cursor
+			txs, total, next, err = s.getTxsByAddress(a1, pageQuery{page: 2, size: 1})
+			So(err, ShouldBeNil)
+			So(total, ShouldEqual, 4)
+			So(txs, ShouldHaveLength, 1)
+			So(txs[0].count, ShouldEqual, 1)
+			So(next, ShouldResemble, &txRef{count: 1, index: 1})
+			txs, _, next, err = s.getTxsByAddress(a1, pageQuery{size: 2, before: next})
+			So(err, ShouldBeNil)
+			So(txTypes(txs), ShouldResemble, []pi.TransactionType{
+				pi.TransactionTypeTransfer, pi.TransactionTypeBaseAccount,
+			})
+			So(next, ShouldResemble, &txRef{count: 0, index: 0})
+			txs, _, next, err = s.getTxsByAddress(a1, pageQuery{size: 2, before: next})
+			So(err, ShouldBeNil)
+			So(txs, ShouldBeEmpty)
+			So(next, ShouldBeNil)
+			txs, _, _, err = s.getTxsByAddress(a1, pageQuery{size: 10, before: &txRef{count: 9}})
+			So(err, ShouldBeNil)
+			So(txs, ShouldHaveLength, 4)
+			records, _, next, err = s.getBalanceHistory(a1, pageQuery{page: 4, size: 1})
+			So(err, ShouldBeNil)
+			So(records, ShouldHaveLength, 1)
+			So(records[0].TxType, ShouldEqual, pi.TransactionTypeBaseAccount)
+			So(next, ShouldResemble, &txRef{count: 0, index: 0})
+		}
+		check()
+
+		// the indexes are rebuilt from the blocks on version mismatch
+		So(db.Put(indexVersionKey, uint32ToBytes(indexVersion-1), nil), ShouldBeNil)
+		So(db.Put(append(addrIndexKey(a1), txRef{count: 9}.bytes()...), nil, nil), ShouldBeNil)
+		So(s.checkIndexes(), ShouldBeNil)
+		data, err := db.Get(indexVersionKey, nil)
+		So(err, ShouldBeNil)
+		So(bytesToUint32(data), ShouldEqual, indexVersion)
+		check()
+	})
+
+	Convey("parse transaction reference cursor", t, func() {
+		r, err := parseTxRef("12,3")
+		So(err, ShouldBeNil)
+		So(r, ShouldResemble, txRef{count: 12, index: 3})
+		So(r.String(), ShouldEqual, "12,3")
+		for _, s := range []string{"", "12", "a,1", "1,-1", "1,2,3"} {
+			_, err = parseTxRef(s)
+			So(err, ShouldEqual, ErrBadRequest)
+		}
+	})
+}
@@ -100,6 +100,10 @@ func (s *Service) start() (err error) {
 		return ErrStopped
 	}
 
+	if err = s.checkIndexes(); err != nil {
+		return
+	}
+
 	if err = s.getSubscriptionCheckpoint(); err != nil {
 		return
 	}
@@ -191,7 +195,7 @@ func (s *Service) getTxByHash(h *hash.Hash) (tx pi.Transaction, c uint32, height
 	txKey = append(txKey, h[:]...)
 
 	var bCountData []byte
-	if bCountData, err = s.db.Get(txKeyPrefix, nil); err != nil {
+	if bCountData, err = s.db.Get(txKey, nil); err != nil {
 		if err == leveldb.ErrNotFound {
 			err = ErrNotFound
 		}
@@ -339,22 +343,33 @@ func (s *Service) processBlock(c uint32, h uint32, b *pt.Block) (err error) {
 		"count":  c,
 	}).Info("process new block")
 
-	if err = s.saveTransactions(c, b.Transactions); err != nil {
+	// save block, transactions and the indexes atomically
+	batch := new(leveldb.Batch)
+
+	if err = s.saveTransactions(batch, c, b.Transactions); err != nil {
+		return
+	}
+
+	if err = newBlockIndexer(s, batch).indexBlock(c, h, b); err != nil {
+		return
+	}
+
+	if err = s.saveBlock(batch, c, h, b); err != nil {
 		return
 	}
 
-	err = s.saveBlock(c, h, b)
+	err = s.db.Write(batch, nil)
 
 	return
 }
 
-func (s *Service) saveTransactions(c uint32, txs []pi.Transaction) (err error) {
+func (s *Service) saveTransactions(batch *leveldb.Batch, c uint32, txs []pi.Transaction) (err error) {
 	if txs == nil || len(txs) == 0 {
 		return
 	}
 
 	for _, t := range txs {
-		if err = s.saveTransaction(c, t); err != nil {
+		if err = s.saveTransaction(batch, c, t); err != nil {
 			return
 		}
 	}
@@ -362,7 +377,7 @@ func (s *Service) saveTransactions(c uint32, txs []pi.Transaction) (err error) {
 	return
 }
 
-func (s *Service) saveTransaction(c uint32, tx pi.Transaction) (err error) {
+func (s *Service) saveTransaction(batch *leveldb.Batch, c uint32, tx pi.Transaction) (err error) {
 	if tx == nil {
 		return ErrNilTransaction
 	}
@@ -375,12 +390,12 @@ func (s *Service) saveTransaction(c uint32, tx pi.Transaction) (err error) {
 	txKey = append(txKey, txHash[:]...)
 	txData := uint32ToBytes(c)
 
-	err = s.db.Put(txKey, txData, nil)
+	batch.Put(txKey, txData)
 
 	return
 }
 
-func (s *Service) saveBlock(c uint32, h uint32, b *pt.Block) (err error) {
+func (s *Service) saveBlock(batch *leveldb.Batch, c uint32, h uint32, b *pt.Block) (err error) {
 	if b == nil {
 		return ErrNilBlock
 	}
@@ -408,15 +423,9 @@ func (s *Service) saveBlock(c uint32, h uint32, b *pt.Block) (err error) {
 	bHeightKey = append(bHeightKey, blockHeightPrefix...)
 	bHeightKey = append(bHeightKey, hBytes...)
 
-	if err = s.db.Put(bKey, buf.Bytes(), nil); err != nil {
-		return
-	}
-
-	if err = s.db.Put(bHashKey, cBytes, nil); err != nil {
-		return
-	}
-
-	err = s.db.Put(bHeightKey, cBytes, nil)
+	batch.Put(bKey, buf.Bytes())
+	batch.Put(bHashKey, cBytes)
+	batch.Put(bHeightKey, cBytes)
 
 	return
 }
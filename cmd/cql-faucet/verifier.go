@@ -68,7 +68,7 @@ type Verifier struct {
 	contentRequired []string
 	urlRequired     string
 	vaultAddress    proto.AccountAddress
-	privateKey      *asymmetric.PrivateKey
+	privateKey      asymmetric.Signer
 	publicKey       *asymmetric.PublicKey
 
 	// persistence
@@ -93,7 +93,7 @@ func NewVerifier(cfg *Config, p *Persistence) (v *Verifier, err error) {
 		return
 	}
 
-	if v.privateKey, err = kms.GetLocalPrivateKey(); err != nil {
+	if v.privateKey, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 
@@ -35,9 +35,7 @@ package main
 
 import (
 	"fmt"
-	"strings"
-
-	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"sort"
 )
 
 // BlockSize is the size of each data block. It must not
@@ -51,6 +49,18 @@ func min(a, b uint64) uint64 {
 	return b
 }
 
+func max(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// numBlocks returns the number of blocks holding 'size' bytes.
+func numBlocks(size uint64) int {
+	return int((size + BlockSize - 1) / BlockSize)
+}
+
 // blockRange describes a range of blocks.
 // If the first and last block are the same, the effective data range
 // will be: [startOffset, lastLength)
@@ -108,14 +118,8 @@ func shrink(e sqlExecutor, inodeID, from, to uint64) error {
 		return nil
 	}
 
-	// There is something to delete.
-	// TODO(marc): would it be better to pass the block IDs?
-	delStmt := `DELETE FROM fs_BLOCK WHERE id = ? AND block >= ?`
-	if _, err := e.Exec(delStmt, inodeID, deleteFrom); err != nil {
-		return err
-	}
-
-	return nil
+	// There is something to delete, release the chunks as well.
+	return deleteBlocks(e, inodeID, deleteFrom, maxBlockIndex)
 }
 
 // grow resizes the data to a larger length.
@@ -147,47 +151,27 @@ func grow(e sqlExecutor, inodeID, from, to uint64) error {
 		return nil
 	}
 
-	// Build the sql statement and blocks to insert.
-	// We don't share this functionality with 'write' because we can repeat empty blocks.
-	// This would be shorter if we weren't trying to be efficient.
+	// Build the blocks to insert.
+	// Empty blocks share the same chunk, so a full block is only sent once.
 	// TODO(marc): this would also be better if we supported sparse files.
-	paramStrings := []string{}
-	params := []interface{}{}
-	count := 1 // placeholder count starts at 1.
+	blocks := [][]byte{}
 	if insertFrom != insertTo {
-		// We have full blocks. Only send a full block once.
+		// We have full blocks.
+		full := make([]byte, BlockSize, BlockSize)
 		for i := insertFrom; i < insertTo; i++ {
-			params = append(params, make([]byte, BlockSize, BlockSize))
+			blocks = append(blocks, full)
 		}
-		count++
-	}
-
-	// Go over all blocks that are certainly full.
-	for i := insertFrom; i < insertTo; i++ {
-		paramStrings = append(paramStrings, fmt.Sprintf("(%d, %d, ?)", inodeID, i))
 	}
 
 	// Check the last block.
 	if addRange.lastLength > 0 {
 		// Not empty, write it. It can't be a full block, because we
 		// would have an empty block right after.
-		params = append(params, make([]byte, addRange.lastLength, addRange.lastLength))
-		paramStrings = append(paramStrings, fmt.Sprintf("(%d, %d, ?)",
-			inodeID, addRange.last))
-		count++
-	}
-
-	if len(paramStrings) == 0 {
-		// We had only one block, and it was empty. Nothing do to.
-		return nil
-	}
-
-	insStmt := fmt.Sprintf(`INSERT INTO fs_block VALUES %s`, strings.Join(paramStrings, ","))
-	if _, err := e.Exec(insStmt, params...); err != nil {
-		return err
+		blocks = append(blocks, make([]byte, addRange.lastLength, addRange.lastLength))
 	}
 
-	return nil
+	// We had only one block, and it was empty: nothing to do.
+	return insertBlocks(e, inodeID, insertFrom, blocks)
 }
 
 // read returns the data [from, to).
@@ -318,35 +302,22 @@ func write(e sqlExecutor, inodeID, originalSize, offset uint64, data []byte) err
 		return nil
 	}
 
-	paramStrings := []string{}
-	params := []interface{}{}
-	count := 1 // placeholder count starts at 1.
-
+	blocks := [][]byte{}
 	for i := lastBlock + 1; i <= writeTo; i++ {
 		if len(data) == 0 {
 			panic(fmt.Sprintf("reached end of data, but still have %d blocks to write",
 				writeTo-i))
 		}
 		toWrite := min(BlockSize, uint64(len(data)))
-		blockData := data[:toWrite]
+		blocks = append(blocks, data[:toWrite])
 		data = data[toWrite:]
-		paramStrings = append(paramStrings, fmt.Sprintf("(%d, %d, ?)",
-			inodeID, i))
-		params = append(params, blockData)
-		count++
 	}
 
 	if len(data) != 0 {
 		panic(fmt.Sprintf("processed all blocks, but still have %d of data to write", len(data)))
 	}
 
-	insStmt := fmt.Sprintf(`INSERT INTO fs_block VALUES %s`, strings.Join(paramStrings, ","))
-	log.Warn(insStmt, params)
-	if _, err := e.Exec(insStmt, params...); err != nil {
-		return err
-	}
-
-	return nil
+	return insertBlocks(e, inodeID, lastBlock+1, blocks)
 }
 
 // resize changes the size of the data for the inode with id 'inodeID'
@@ -359,3 +330,42 @@ func resizeBlocks(e sqlExecutor, inodeID, from, to uint64) error {
 	}
 	return nil
 }
+
+// writeBlocks commits whole blocks for the inode with id 'inodeID' and
+// resizes its data from 'from' to 'to' bytes. 'blocks' holds the full
+// content of each modified block, and must include every block past 'from'.
+// Unlike write, no data is read back, so it can be used within a transaction.
+func writeBlocks(e sqlExecutor, inodeID, from, to uint64, blocks map[int][]byte) error {
+	oldBlocks, newBlocks := numBlocks(from), numBlocks(to)
+	if newBlocks < oldBlocks {
+		if err := deleteBlocks(e, inodeID, newBlocks, maxBlockIndex); err != nil {
+			return err
+		}
+	}
+
+	indexes := make([]int, 0, len(blocks))
+	for i := range blocks {
+		if i < newBlocks {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+
+	inserts := [][]byte{}
+	for _, i := range indexes {
+		if i < oldBlocks {
+			if err := updateBlockData(e, inodeID, i, blocks[i]); err != nil {
+				return err
+			}
+			continue
+		}
+		inserts = append(inserts, blocks[i])
+	}
+
+	if newBlocks > oldBlocks && len(inserts) != newBlocks-oldBlocks {
+		return fmt.Errorf("missing blocks, expected %d new blocks, got %d",
+			newBlocks-oldBlocks, len(inserts))
+	}
+
+	return insertBlocks(e, inodeID, oldBlocks, inserts)
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import "sync"
+
+// maxBufferedBytes is the amount of written data buffered by a node before
+// it is flushed to the database without waiting for Fsync or Release.
+const maxBufferedBytes = 4 << 20 // 4MB
+
+// readAheadSize is the amount of data fetched past a sequential read.
+const readAheadSize = 64 * BlockSize
+
+// pendingOp is a buffered modification of the file data: either 'data'
+// written at 'offset', or a resize to 'size'.
+type pendingOp struct {
+	resize bool
+	offset uint64
+	data   []byte
+	size   uint64
+}
+
+// writeBuffer holds the modifications of a file not yet committed to
+// fs_block. Reads overlay the ops on top of the persisted data, flushes
+// turn them into whole blocks written in a single transaction.
+type writeBuffer struct {
+	// baseSize is the size of the data persisted in fs_block.
+	baseSize uint64
+	ops      []pendingOp
+	bytes    int
+}
+
+// write buffers 'data' at 'offset'. Sequential writes are merged into a single op.
+func (b *writeBuffer) write(offset uint64, data []byte) {
+	b.bytes += len(data)
+	if l := len(b.ops); l > 0 {
+		last := &b.ops[l-1]
+		if !last.resize && last.offset+uint64(len(last.data)) == offset {
+			last.data = append(last.data, data...)
+			return
+		}
+	}
+	// The request buffer is reused by fuse, always copy.
+	b.ops = append(b.ops, pendingOp{offset: offset, data: append([]byte(nil), data...)})
+}
+
+// resize buffers a size change to 'size'.
+func (b *writeBuffer) resize(size uint64) {
+	b.ops = append(b.ops, pendingOp{resize: true, size: size})
+}
+
+// overlay applies the buffered ops to 'data', which holds the
+// persisted file data starting at 'offset'.
+func (b *writeBuffer) overlay(offset uint64, data []byte) {
+	end := offset + uint64(len(data))
+	for _, op := range b.ops {
+		if op.resize {
+			// Data past a truncation reads back as zeros if the file grows again.
+			if op.size < end {
+				from := op.size
+				if from < offset {
+					from = offset
+				}
+				for i := range data[from-offset:] {
+					data[from-offset+uint64(i)] = 0
+				}
+			}
+			continue
+		}
+		opEnd := op.offset + uint64(len(op.data))
+		if opEnd <= offset || op.offset >= end {
+			continue
+		}
+		if op.offset >= offset {
+			copy(data[op.offset-offset:], op.data)
+		} else {
+			copy(data, op.data[offset-op.offset:])
+		}
+	}
+}
+
+// covers returns true if a single buffered write overwrites [from, to).
+func (b *writeBuffer) covers(from, to uint64) bool {
+	for _, op := range b.ops {
+		if !op.resize && op.offset <= from && op.offset+uint64(len(op.data)) >= to {
+			return true
+		}
+	}
+	return false
+}
+
+// blocks returns the full content of every block modified by the buffered
+// ops for a file of final size 'size'. Blocks past the persisted data are
+// always included. 'base' is called to fetch the persisted content of
+// partially modified blocks.
+func (b *writeBuffer) blocks(size uint64, base func(block int) ([]byte, error)) (map[int][]byte, error) {
+	written := make(map[int]bool)
+	dirty := make(map[int]bool)
+	mark := func(set map[int]bool, from, to uint64) {
+		for i := int(from / BlockSize); i < numBlocks(to); i++ {
+			set[i] = true
+		}
+	}
+
+	cur := b.baseSize
+	for _, op := range b.ops {
+		if op.resize {
+			// Truncated blocks are rewritten and grown blocks are zero-filled.
+			mark(dirty, min(cur, op.size), max(cur, op.size))
+			cur = op.size
+			continue
+		}
+		end := op.offset + uint64(len(op.data))
+		mark(written, op.offset, end)
+		// Writing past the end of file zero-fills the hole.
+		mark(dirty, min(cur, op.offset), end)
+		if end > cur {
+			cur = end
+		}
+	}
+
+	persistedBlocks := numBlocks(b.baseSize)
+	lastBlock := numBlocks(size)
+	zero := make([]byte, BlockSize)
+	result := make(map[int][]byte, len(dirty))
+	for i := range dirty {
+		if i >= lastBlock {
+			// Deleted by the resize.
+			continue
+		}
+		start := uint64(i) * BlockSize
+		length := min(BlockSize, size-start)
+		if i >= persistedBlocks && !written[i] {
+			// Hole, nothing to overlay.
+			result[i] = zero[:length]
+			continue
+		}
+
+		data := make([]byte, length)
+		if i < persistedBlocks && !b.covers(start, start+length) {
+			orig, err := base(i)
+			if err != nil {
+				return nil, err
+			}
+			copy(data, orig)
+		}
+		b.overlay(start, data)
+		result[i] = data
+	}
+	return result, nil
+}
+
+// readAhead keeps the persisted data fetched past the last sequential read.
+type readAhead struct {
+	offset uint64
+	data   []byte
+	// next is the offset expected by the next sequential read.
+	next uint64
+}
+
+// get returns the cached data [from, to) if available.
+func (r *readAhead) get(from, to uint64) ([]byte, bool) {
+	if from >= r.offset && to <= r.offset+uint64(len(r.data)) {
+		return r.data[from-r.offset : to-r.offset], true
+	}
+	return nil, false
+}
+
+// nodeCache tracks the nodes referenced by the kernel, so that all names of
+// an inode share the same Node along with its buffered data.
+type nodeCache struct {
+	sync.Mutex
+	nodes map[uint64]*Node
+}
+
+func newNodeCache() *nodeCache {
+	return &nodeCache{nodes: make(map[uint64]*Node)}
+}
+
+// get returns the live node with id 'id', or nil.
+func (c *nodeCache) get(id uint64) *Node {
+	c.Lock()
+	defer c.Unlock()
+	return c.nodes[id]
+}
+
+// add registers 'node' unless a live node with the same ID exists,
+// and returns the live node.
+func (c *nodeCache) add(node *Node) *Node {
+	c.Lock()
+	defer c.Unlock()
+	if live, ok := c.nodes[node.ID]; ok {
+		return live
+	}
+	c.nodes[node.ID] = node
+	return node
+}
+
+// remove unregisters 'node'.
+func (c *nodeCache) remove(node *Node) {
+	c.Lock()
+	defer c.Unlock()
+	if c.nodes[node.ID] == node {
+		delete(c.nodes, node.ID)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/golang/snappy"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+)
+
+// Block data is stored once per content in the `chunk` table, keyed by the
+// hash of the uncompressed data. Blocks reference chunks by hash and each
+// chunk counts its references, a chunk is deleted with its last reference.
+// All reference counting is done by write statements only, so it can be
+// used within transactions.
+
+// Chunk codecs, stored along with each chunk.
+const (
+	codecNone   = 0
+	codecSnappy = 1
+)
+
+// codecNames maps the -compress flag values to codecs.
+var codecNames = map[string]int{
+	"none":   codecNone,
+	"snappy": codecSnappy,
+}
+
+// chunkCodec is the codec used to store new chunks. Compressed data is only
+// kept if smaller than the original, so codecs are chosen per chunk.
+var chunkCodec = codecNone
+
+// maxBlockIndex is the upper bound of block index ranges.
+const maxBlockIndex = math.MaxInt32
+
+// encodeChunk returns the stored form of 'data' and its codec.
+func encodeChunk(data []byte) (int, []byte) {
+	if chunkCodec == codecSnappy {
+		if encoded := snappy.Encode(nil, data); len(encoded) < len(data) {
+			return codecSnappy, encoded
+		}
+	}
+	return codecNone, data
+}
+
+// decodeChunk returns the block data of a stored chunk.
+func decodeChunk(codec int, data []byte) ([]byte, error) {
+	switch codec {
+	case codecNone:
+		return data, nil
+	case codecSnappy:
+		return snappy.Decode(nil, data)
+	default:
+		return nil, fmt.Errorf("unknown chunk codec %d", codec)
+	}
+}
+
+// acquireChunks stores the chunks of 'blocks' and adds one reference per
+// block. Returns the chunk hashes, in the same order as 'blocks'.
+func acquireChunks(e sqlExecutor, blocks [][]byte) ([][]byte, error) {
+	const insertChunk = `INSERT OR IGNORE INTO fs_chunk VALUES (?, 0, ?, ?)`
+	const refChunk = `UPDATE fs_chunk SET refs = refs + ? WHERE hash = ?`
+
+	hashes := make([][]byte, len(blocks))
+	refs := make(map[hash.Hash]int)
+	var order []hash.Hash
+	for i, data := range blocks {
+		h := hash.THashH(data)
+		hashes[i] = h.CloneBytes()
+		if refs[h] == 0 {
+			order = append(order, h)
+			codec, encoded := encodeChunk(data)
+			if _, err := e.Exec(insertChunk, hashes[i], codec, encoded); err != nil {
+				return nil, err
+			}
+		}
+		refs[h]++
+	}
+
+	// Identical blocks only send their data once.
+	for _, h := range order {
+		if _, err := e.Exec(refChunk, refs[h], h.CloneBytes()); err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
+
+// releaseChunks drops the chunk references of blocks [from, to] of the inode
+// with id 'inodeID', and deletes the unreferenced chunks. The blocks must be
+// deleted or updated by the caller.
+func releaseChunks(e sqlExecutor, inodeID uint64, from, to int) error {
+	const unrefChunks = `
+UPDATE fs_chunk SET refs = refs - (
+  SELECT COUNT(block) FROM fs_block
+  WHERE fs_block.hash = fs_chunk.hash AND id = ? AND block >= ? AND block <= ?
+)
+WHERE hash IN (SELECT hash FROM fs_block WHERE id = ? AND block >= ? AND block <= ?)`
+	const deleteChunks = `
+DELETE FROM fs_chunk WHERE refs <= 0 AND
+  hash IN (SELECT hash FROM fs_block WHERE id = ? AND block >= ? AND block <= ?)`
+
+	if _, err := e.Exec(unrefChunks, inodeID, from, to, inodeID, from, to); err != nil {
+		return err
+	}
+	if _, err := e.Exec(deleteChunks, inodeID, from, to); err != nil {
+		return err
+	}
+	return nil
+}
+
+// insertBlocks inserts consecutive blocks starting at block index 'from'.
+func insertBlocks(e sqlExecutor, inodeID uint64, from int, blocks [][]byte) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	hashes, err := acquireChunks(e, blocks)
+	if err != nil {
+		return err
+	}
+
+	paramStrings := make([]string, 0, len(blocks))
+	params := make([]interface{}, 0, len(blocks))
+	for i, h := range hashes {
+		paramStrings = append(paramStrings, fmt.Sprintf("(%d, %d, ?)", inodeID, from+i))
+		params = append(params, h)
+	}
+
+	insStmt := fmt.Sprintf(`INSERT INTO fs_block (id, block, hash) VALUES %s`,
+		strings.Join(paramStrings, ","))
+	if _, err := e.Exec(insStmt, params...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// deleteBlocks deletes blocks [from, to] of the inode with id 'inodeID'.
+func deleteBlocks(e sqlExecutor, inodeID uint64, from, to int) error {
+	if err := releaseChunks(e, inodeID, from, to); err != nil {
+		return err
+	}
+	delStmt := `DELETE FROM fs_block WHERE id = ? AND block >= ? AND block <= ?`
+	if _, err := e.Exec(delStmt, inodeID, from, to); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+func getChunkRefs(t *testing.T, data []byte) (refs int) {
+	h := hash.THashH(data)
+	err := db.QueryRow(`SELECT refs FROM fs_chunk WHERE hash = ?`, h.CloneBytes()).Scan(&refs)
+	if err != nil {
+		t.Logf("chunk not found: %v", err)
+		return 0
+	}
+	return
+}
+
+func TestChunkCodec(t *testing.T) {
+	defer func(codec int) { chunkCodec = codec }(chunkCodec)
+
+	compressible := make([]byte, BlockSize)
+	rng, _ := NewPseudoRand()
+	random := RandBytes(rng, BlockSize)
+
+	chunkCodec = codecNone
+	if codec, encoded := encodeChunk(compressible); codec != codecNone || !bytes.Equal(encoded, compressible) {
+		t.Errorf("unexpected encoding with codec none: %d", codec)
+	}
+
+	chunkCodec = codecSnappy
+	codec, encoded := encodeChunk(compressible)
+	if codec != codecSnappy || len(encoded) >= len(compressible) {
+		t.Errorf("expected compressed chunk, got codec %d and %d bytes", codec, len(encoded))
+	}
+	decoded, err := decodeChunk(codec, encoded)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !bytes.Equal(decoded, compressible) {
+		t.Errorf("decoded data mismatch")
+	}
+
+	// Incompressible data is stored as is.
+	if codec, _ := encodeChunk(random); codec != codecNone {
+		t.Errorf("expected uncompressed chunk, got codec %d", codec)
+	}
+	if _, err := decodeChunk(100, encoded); err == nil {
+		t.Errorf("expected unknown codec error")
+	}
+}
+
+func TestChunkDedup(t *testing.T) {
+	defer func(codec int) { chunkCodec = codec }(chunkCodec)
+	chunkCodec = codecSnappy
+
+	rng, _ := NewPseudoRand()
+	block := RandBytes(rng, BlockSize)
+	data := append(append([]byte{}, block...), block...)
+	id1, id2 := uint64(100), uint64(200)
+	empty := make([]byte, BlockSize)
+	// Other tests may reference the empty chunk.
+	emptyRefs := getChunkRefs(t, empty)
+
+	// Identical blocks of two files share one chunk.
+	if err := write(db, id1, 0, 0, data); err != nil {
+		log.Fatal(err)
+	}
+	if err := write(db, id2, 0, 0, block); err != nil {
+		log.Fatal(err)
+	}
+	if refs := getChunkRefs(t, block); refs != 3 {
+		t.Errorf("expected 3 refs, got %d", refs)
+	}
+
+	// Grown blocks are zero-filled and share the empty chunk.
+	if err := grow(db, id2, BlockSize, BlockSize*4); err != nil {
+		log.Fatal(err)
+	}
+	if refs := getChunkRefs(t, empty); refs != emptyRefs+3 {
+		t.Errorf("expected %d refs to the empty chunk, got %d", emptyRefs+3, refs)
+	}
+	readData, err := read(db, id2, 0, BlockSize*4)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !bytes.Equal(readData[:BlockSize], block) || !bytes.Equal(readData[BlockSize:], make([]byte, BlockSize*3)) {
+		t.Errorf("read data mismatch")
+	}
+
+	// Overwriting a block moves its reference.
+	other := RandBytes(rng, BlockSize)
+	if err := write(db, id1, BlockSize*2, BlockSize, other); err != nil {
+		log.Fatal(err)
+	}
+	if refs := getChunkRefs(t, block); refs != 2 {
+		t.Errorf("expected 2 refs, got %d", refs)
+	}
+	if refs := getChunkRefs(t, other); refs != 1 {
+		t.Errorf("expected 1 ref, got %d", refs)
+	}
+
+	// Shrinking releases references, unreferenced chunks are deleted.
+	if err := shrink(db, id1, BlockSize*2, BlockSize); err != nil {
+		log.Fatal(err)
+	}
+	if refs := getChunkRefs(t, other); refs != 0 {
+		t.Errorf("expected chunk to be deleted, got %d refs", refs)
+	}
+	if err := deleteInode(db, id2); err != nil {
+		log.Fatal(err)
+	}
+	if refs := getChunkRefs(t, empty); refs != emptyRefs {
+		t.Errorf("expected %d refs to the empty chunk, got %d", emptyRefs, refs)
+	}
+	if refs := getChunkRefs(t, block); refs != 1 {
+		t.Errorf("expected 1 ref, got %d", refs)
+	}
+	if err := deleteInode(db, id1); err != nil {
+		log.Fatal(err)
+	}
+	if refs := getChunkRefs(t, block); refs != 0 {
+		t.Errorf("expected chunk to be deleted, got %d refs", refs)
+	}
+}
@@ -36,6 +36,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"math"
 	"os"
 	"syscall"
 	"time"
@@ -67,22 +68,69 @@ CREATE TABLE IF NOT EXISTS fs_block (
   id    INT,
   block INT,
   data  BYTES,
+  hash  BYTES,
   PRIMARY KEY (id, block)
 );
+
+CREATE TABLE IF NOT EXISTS fs_chunk (
+  hash  BYTES PRIMARY KEY,
+  refs  INT,
+  codec INT,
+  data  BYTES
+);
+
+CREATE TABLE IF NOT EXISTS fs_xattr (
+  id    INT,
+  name  STRING,
+  value BYTES,
+  PRIMARY KEY (id, name)
+);
 `
 )
 
 var _ fs.FS = &CFS{}               // Root
 var _ fs.FSInodeGenerator = &CFS{} // GenerateInode
+var _ fs.FSStatfser = &CFS{}       // Statfs
+
+// Maximum length of a file name.
+const maxNameLength = 255
 
 // CFS implements a filesystem on top of cockroach.
 type CFS struct {
 	db *sql.DB
+	// nodes holds the nodes referenced by the kernel.
+	nodes *nodeCache
+	// capacity is the size reported by statfs, the database size is used if smaller.
+	capacity uint64
+}
+
+// newCFS returns a filesystem stored in 'db'.
+func newCFS(db *sql.DB, capacity uint64) CFS {
+	return CFS{
+		db:       db,
+		nodes:    newNodeCache(),
+		capacity: capacity,
+	}
 }
 
 func initSchema(db *sql.DB) error {
-	_, err := db.Exec(fsSchema)
-	return err
+	if _, err := db.Exec(fsSchema); err != nil {
+		return err
+	}
+
+	// Blocks of filesystems created before deduplication hold their data
+	// inline, add the chunk reference column.
+	var hasHash int
+	const checkColumn = `SELECT COUNT(name) FROM pragma_table_info('fs_block') WHERE name = 'hash'`
+	if err := db.QueryRow(checkColumn).Scan(&hasHash); err != nil {
+		return err
+	}
+	if hasHash == 0 {
+		if _, err := db.Exec(`ALTER TABLE fs_block ADD COLUMN hash BYTES`); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // create inserts a new node.
@@ -103,46 +151,58 @@ func (cfs CFS) create(ctx context.Context, parentID uint64, name string, node *N
 		}
 		return nil
 	})
+	if err == nil {
+		cfs.nodes.add(node)
+	}
 	return err
 }
 
 // remove removes a node give its name and its parent ID.
 // If 'checkChildren' is true, fails if the node has children.
+// The inode is deleted along with its last link.
 func (cfs CFS) remove(ctx context.Context, parentID uint64, name string, checkChildren bool) error {
-	const lookupSQL = `SELECT id FROM fs_namespace WHERE (parentID, name) = (?, ?)`
 	const deleteNamespace = `DELETE FROM fs_namespace WHERE (parentID, name) = (?, ?)`
-	const deleteInode = `DELETE FROM fs_inode WHERE id = ?`
-	const deleteBlock = `DELETE FROM fs_block WHERE id = ?`
-	// Start by looking up the node ID.
-	var id uint64
-	if err := cfs.db.QueryRow(lookupSQL, parentID, name).Scan(&id); err != nil {
+	// Start by looking up the node.
+	node, err := cfs.resolve(parentID, name)
+	if err != nil {
 		return err
 	}
 	// Check if there are any children.
 	if checkChildren {
-		if err := checkIsEmpty(cfs.db, id); err != nil {
+		if err := checkIsEmpty(cfs.db, node.ID); err != nil {
 			return err
 		}
 	}
 
-	err := client.ExecuteTx(ctx, cfs.db, nil /* txopts */, func(tx *sql.Tx) error {
-		// Delete all entries.
-		if _, err := tx.Exec(deleteNamespace, parentID, name); err != nil {
-			return err
-		}
-		if _, err := tx.Exec(deleteInode, id); err != nil {
-			return err
-		}
-		if _, err := tx.Exec(deleteBlock, id); err != nil {
-			return err
-		}
-		return nil
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	return node.unlinkLocked(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(deleteNamespace, parentID, name)
+		return err
 	})
-	return err
 }
 
+// lookup returns the node 'parentID/name' to be referenced by the kernel.
 func (cfs CFS) lookup(parentID uint64, name string) (*Node, error) {
-	return getInode(cfs.db, parentID, name)
+	node, err := cfs.resolve(parentID, name)
+	if err != nil {
+		return nil, err
+	}
+	return cfs.nodes.add(node), nil
+}
+
+// resolve returns the live node of 'parentID/name' if the kernel references
+// it, or the node loaded from the database otherwise.
+func (cfs CFS) resolve(parentID uint64, name string) (*Node, error) {
+	node, err := getInode(cfs.db, parentID, name)
+	if err != nil {
+		return nil, err
+	}
+	if live := cfs.nodes.get(node.ID); live != nil {
+		return live, nil
+	}
+	node.cfs = cfs
+	return node, nil
 }
 
 // list returns the children of the node with id 'parentID'.
@@ -199,7 +259,7 @@ func validateRename(e sqlExecutor, source, destination *Node) error {
 }
 
 // rename moves 'oldParentID/oldName' to 'newParentID/newName'.
-// If 'newParentID/newName' already exists, it is deleted.
+// If 'newParentID/newName' already exists, its link is dropped.
 // See NOTE on node.go:Rename.
 func (cfs CFS) rename(
 	ctx context.Context, oldParentID, newParentID uint64, oldName, newName string,
@@ -211,7 +271,6 @@ func (cfs CFS) rename(
 	const deleteNamespace = `DELETE FROM fs_namespace WHERE (parentID, name) = (?, ?)`
 	const insertNamespace = `INSERT INTO fs_namespace VALUES (?, ?, ?)`
 	const updateNamespace = `UPDATE fs_namespace SET id = ? WHERE (parentID, name) = (?, ?)`
-	const deleteInode = `DELETE FROM fs_inode WHERE id = ?`
 
 	// Lookup source inode.
 	srcObject, err := getInode(cfs.db, oldParentID, oldName)
@@ -220,46 +279,65 @@ func (cfs CFS) rename(
 	}
 
 	// Lookup destination inode.
-	destObject, err := getInode(cfs.db, newParentID, newName)
+	destObject, err := cfs.resolve(newParentID, newName)
 	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
 
+	if destObject != nil && destObject.ID == srcObject.ID {
+		// Both names are links to the same inode: nothing to do.
+		return nil
+	}
+
 	// Check that the rename is allowed.
 	if err := validateRename(cfs.db, srcObject, destObject); err != nil {
 		return err
 	}
 
-	err = client.ExecuteTx(ctx, cfs.db, nil /* txopts */, func(tx *sql.Tx) error {
-		// At this point we know the following:
-		// - srcObject is not nil
-		// - destObject may be nil. If not, its inode can be deleted.
-		if destObject == nil {
-			// No new object: use INSERT.
-			if _, err := tx.Exec(deleteNamespace, oldParentID, oldName); err != nil {
-				return err
-			}
-
-			if _, err := tx.Exec(insertNamespace, newParentID, newName, srcObject.ID); err != nil {
-				return err
-			}
-		} else {
-			// Destination exists.
+	if destObject == nil {
+		// No new object: use INSERT.
+		return client.ExecuteTx(ctx, cfs.db, nil /* txopts */, func(tx *sql.Tx) error {
 			if _, err := tx.Exec(deleteNamespace, oldParentID, oldName); err != nil {
 				return err
 			}
+			_, err := tx.Exec(insertNamespace, newParentID, newName, srcObject.ID)
+			return err
+		})
+	}
 
-			if _, err := tx.Exec(updateNamespace, srcObject.ID, newParentID, newName); err != nil {
-				return err
-			}
-
-			if _, err := tx.Exec(deleteInode, destObject.ID); err != nil {
-				return err
-			}
+	// Destination exists: point it to the source and drop its link to
+	// the old inode, which is deleted if it was the last one.
+	destObject.mu.Lock()
+	defer destObject.mu.Unlock()
+	return destObject.unlinkLocked(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(deleteNamespace, oldParentID, oldName); err != nil {
+			return err
 		}
-		return nil
+		_, err := tx.Exec(updateNamespace, srcObject.ID, newParentID, newName)
+		return err
 	})
-	return err
+}
+
+// Statfs reports the filesystem usage based on the size of the database.
+func (cfs CFS) Statfs(_ context.Context, _ *fuse.StatfsRequest, resp *fuse.StatfsResponse) error {
+	stats, err := getDBStats(cfs.db)
+	if err != nil {
+		return err
+	}
+
+	used := uint64(numBlocks((stats.pageCount - stats.freePages) * stats.pageSize))
+	total := max(used, cfs.capacity/BlockSize)
+
+	resp.Blocks = total
+	resp.Bfree = total - used
+	resp.Bavail = resp.Bfree
+	// The root node is not persisted.
+	resp.Files = stats.inodes + 1
+	resp.Ffree = math.MaxUint32
+	resp.Bsize = BlockSize
+	resp.Frsize = BlockSize
+	resp.Namelen = maxNameLength
+	return nil
 }
 
 // Root returns the filesystem's root node.
@@ -38,7 +38,9 @@
 // themselves in the `inode` table.
 //
 // Data blocks are stored in the `block` table, indexed by inode ID
-// and block number.
+// and block number. Block content is deduplicated: each distinct block
+// is stored once in the `chunk` table, keyed by its hash, optionally
+// compressed and reference counted by the blocks using it.
 //
 // Basic functionality is implemented, including:
 // - mk/rm directory
@@ -46,6 +48,13 @@
 // - read/write files
 // - rename
 // - symlinks
+// - hard links (inodes count their links)
+// - chmod
+// - extended attributes, stored in the `fs_xattr` table
+// - statfs, reporting the database size
+//
+// Writes are buffered per inode and flushed in a single transaction on
+// fsync or close, sequential reads fetch the following blocks ahead.
 //
 // WARNING: concurrent access on a single mount is fine. However,
 // behavior is undefined (read broken) when mounted more than once at the
@@ -53,13 +62,12 @@
 // may work on out of date information.
 //
 // One caveat of the implemented features is that handles are not
-// reference counted so if an inode is deleted, all open file descriptors
-// pointing to it become invalid.
+// reference counted so if the last link of an inode is deleted, all open
+// file descriptors pointing to it become invalid.
 //
 // Some TODOs (definitely not a comprehensive list):
-// - support basic attributes (mode, timestamps)
-// - support other types: hard links
-// - add ref counting (and handle open/release)
+// - support timestamps
+// - add ref counting of open handles
 // - sparse files: don't store empty blocks
 // - sparse files 2: keep track of holes
 
@@ -88,16 +96,26 @@ var usage = func() {
 
 func main() {
 	var config, dsn, mountPoint, password string
+	var capacity uint64
+	var compress string
 
 	flag.StringVar(&config, "config", "./conf/config.yaml", "config file path")
 	flag.StringVar(&mountPoint, "mount", "./", "dir to mount")
 	flag.StringVar(&dsn, "dsn", "", "database url")
 	flag.StringVar(&password, "password", "", "master key password for covenantsql")
+	flag.Uint64Var(&capacity, "capacity", 0, "filesystem size in bytes reported by statfs, database size if smaller")
+	flag.StringVar(&compress, "compress", "none", "compression of new blocks: none or snappy")
 	flag.Usage = usage
 	flag.Parse()
 
 	log.SetLevel(log.DebugLevel)
 
+	codec, ok := codecNames[compress]
+	if !ok {
+		log.Fatalf("unknown compression: %s", compress)
+	}
+	chunkCodec = codec
+
 	err := client.Init(config, []byte(password))
 	if err != nil {
 		log.Fatal(err)
@@ -118,7 +136,7 @@ func main() {
 		log.Fatal(err)
 	}
 
-	cfs := CFS{db}
+	cfs := newCFS(db, capacity)
 	// Mount filesystem.
 	c, err := fuse.Mount(
 		mountPoint,
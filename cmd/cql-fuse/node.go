@@ -63,8 +63,15 @@ var _ fs.NodeFsyncer = &Node{}        // Fsync
 var _ fs.NodeRenamer = &Node{}        // Rename
 var _ fs.NodeSymlinker = &Node{}      // Symlink
 var _ fs.NodeReadlinker = &Node{}     // Readlink
-
-// Default permissions: we don't have any right now.
+var _ fs.NodeLinker = &Node{}         // Link
+var _ fs.NodeForgetter = &Node{}      // Forget
+var _ fs.HandleReleaser = &Node{}     // Release
+var _ fs.NodeGetxattrer = &Node{}     // Getxattr
+var _ fs.NodeListxattrer = &Node{}    // Listxattr
+var _ fs.NodeSetxattrer = &Node{}     // Setxattr
+var _ fs.NodeRemovexattrer = &Node{}  // Removexattr
+
+// Default permissions of new nodes.
 const defaultPerms = 0755
 
 // All permissions.
@@ -76,33 +83,53 @@ const maxSize = math.MaxUint64
 // Maximum length of a symlink target.
 const maxSymlinkTargetLength = 4096
 
+// Maximum length of an extended attribute name and value.
+const (
+	maxXattrNameLength = 255
+	maxXattrSize       = 64 << 10
+)
+
+// Flags of setxattr(2), not exposed by the syscall package on all platforms.
+const (
+	xattrCreate  = 0x1
+	xattrReplace = 0x2
+)
+
 // Node implements the Node interface.
-// ID, Mode, and SymlinkTarget are currently immutable after node creation.
-// Size (for files only) is protected by mu.
+// ID and SymlinkTarget are immutable after node creation.
+// Mode, NLinks and Size are protected by mu.
 type Node struct {
 	cfs CFS
 	// ID is a unique ID allocated at node creation time.
 	ID uint64
-	// Used for type only, permissions are ignored.
+	// Type and permission bits.
 	Mode os.FileMode
 	// SymlinkTarget is the path a symlink points to.
 	SymlinkTarget string
+	// NLinks is the number of hard links, zero for nodes created before
+	// hard links were supported.
+	NLinks uint32
 
 	// Other fields to add:
-	// nLinks: number of hard links
 	// openFDs: number of open file descriptors
 	// timestamps (probably just ctime and mtime)
 
 	// Implicit fields:
 	// numBlocks: number of 512b blocks
 	// blocksize: preferred block size
-	// mode bits: permissions
 
 	// For regular files only.
 	// Data blocks are addressed by inode number and offset.
 	// Any op accessing Size and blocks must lock 'mu'.
 	mu   sync.RWMutex
 	Size uint64
+
+	// buf holds writes not yet flushed to the database, nil if clean.
+	buf *writeBuffer
+	// ra holds the data read ahead of sequential reads.
+	ra readAhead
+	// unlinked is set once the last link is removed.
+	unlinked bool
 }
 
 // convenience functions to query the mode.
@@ -118,6 +145,23 @@ func (n *Node) isSymlink() bool {
 	return n.Mode&os.ModeSymlink != 0
 }
 
+// links returns the number of hard links to the node.
+func (n *Node) links() uint32 {
+	if n.NLinks == 0 {
+		return 1
+	}
+	return n.NLinks
+}
+
+// buffer returns the write buffer, it must be created before changing the size.
+// Requires n.mu to be held.
+func (n *Node) buffer() *writeBuffer {
+	if n.buf == nil {
+		n.buf = &writeBuffer{baseSize: n.Size}
+	}
+	return n.buf
+}
+
 // toJSON returns the json-encoded string for this node.
 func (n *Node) toJSON() string {
 	ret, err := json.Marshal(n)
@@ -129,6 +173,9 @@ func (n *Node) toJSON() string {
 
 // Attr fills attr with the standard metadata for the node.
 func (n *Node) Attr(_ context.Context, a *fuse.Attr) error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
 	a.Inode = n.ID
 	a.Mode = n.Mode
 	// Does preferred block size make sense on things other
@@ -136,8 +183,7 @@ func (n *Node) Attr(_ context.Context, a *fuse.Attr) error {
 	a.BlockSize = BlockSize
 
 	if n.isRegular() {
-		n.mu.RLock()
-		defer n.mu.RUnlock()
+		a.Nlink = n.links()
 		a.Size = n.Size
 
 		// Blocks is the number of 512 byte blocks, regardless of
@@ -150,52 +196,44 @@ func (n *Node) Attr(_ context.Context, a *fuse.Attr) error {
 	return nil
 }
 
-// Setattr modifies node metadata. This includes changing the size.
+// Setattr modifies node metadata. This includes changing the size and the permissions.
+// Size changes are buffered until the next flush, permissions are persisted right away.
 func (n *Node) Setattr(
 	ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse,
 ) error {
-	if !req.Valid.Size() {
-		// We can exit early since only setting the size is implemented.
+	if !req.Valid.Size() && !req.Valid.Mode() {
+		// We can exit early since only setting the size and mode is implemented.
 		return nil
 	}
 
-	if !n.isRegular() {
-		// Setting the size is only available on regular files.
-		return fuse.Errno(syscall.EINVAL)
-	}
+	if req.Valid.Size() {
+		if !n.isRegular() {
+			// Setting the size is only available on regular files.
+			return fuse.Errno(syscall.EINVAL)
+		}
 
-	if req.Size > maxSize {
-		// Too big.
-		return fuse.Errno(syscall.EFBIG)
+		if req.Size > maxSize {
+			// Too big.
+			return fuse.Errno(syscall.EFBIG)
+		}
 	}
 
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
-	if req.Size == n.Size {
-		// Nothing to do.
-		return nil
+	if req.Valid.Size() && req.Size != n.Size {
+		n.buffer().resize(req.Size)
+		n.Size = req.Size
 	}
 
-	// Store the current size in case we need to rollback.
-	originalSize := n.Size
-
-	// Wrap everything inside a transaction.
-	err := client.ExecuteTx(ctx, n.cfs.db, nil /* txopts */, func(tx *sql.Tx) error {
-		// Resize blocks as needed.
-		if err := resizeBlocks(tx, n.ID, n.Size, req.Size); err != nil {
+	if req.Valid.Mode() {
+		// Store the current mode in case we need to rollback.
+		originalMode := n.Mode
+		n.Mode = n.Mode&^os.ModePerm | req.Mode&os.ModePerm
+		if err := n.flushLocked(ctx, nil); err != nil {
+			n.Mode = originalMode
 			return err
 		}
-
-		n.Size = req.Size
-		return updateNode(tx, n)
-	})
-
-	if err != nil {
-		// Reset our size.
-		log.Print(err)
-		n.Size = originalSize
-		return err
 	}
 	return nil
 }
@@ -217,7 +255,6 @@ func (n *Node) Lookup(_ context.Context, name string) (fs.Node, error) {
 		}
 		return nil, err
 	}
-	node.cfs = n.cfs
 	return node, nil
 }
 
@@ -284,6 +321,7 @@ func (n *Node) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 }
 
 // Write writes data to 'n'. It may overwrite existing data, or grow it.
+// Data is buffered until Fsync or Release, or until the buffer is full.
 func (n *Node) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
 	if !n.isRegular() {
 		return fuse.Errno(syscall.EINVAL)
@@ -303,32 +341,16 @@ func (n *Node) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.Wri
 		return fuse.Errno(syscall.EFBIG)
 	}
 
-	// Store the current size in case we need to rollback.
-	originalSize := n.Size
-
-	// Wrap everything inside a transaction.
-	err := client.ExecuteTx(ctx, n.cfs.db, nil /* txopts */, func(tx *sql.Tx) error {
-
-		// Update blocks. They will be added as needed.
-		if err := write(tx, n.ID, n.Size, uint64(req.Offset), req.Data); err != nil {
+	if n.buf != nil && n.buf.bytes+len(req.Data) > maxBufferedBytes {
+		// Make room for this write.
+		if err := n.flushLocked(ctx, nil); err != nil {
 			return err
 		}
+	}
 
-		if newSize > originalSize {
-			// This was an append, commit the size change.
-			n.Size = newSize
-			if err := updateNode(tx, n); err != nil {
-				return err
-			}
-		}
-		return nil
-	})
-
-	if err != nil {
-		// Reset our size.
-		log.Print(err)
-		n.Size = originalSize
-		return err
+	n.buffer().write(uint64(req.Offset), req.Data)
+	if newSize > n.Size {
+		n.Size = newSize
 	}
 
 	// We always write everything.
@@ -351,8 +373,9 @@ func (n *Node) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadR
 	}
 	offset := uint64(req.Offset)
 
-	n.mu.RLock()
-	defer n.mu.RUnlock()
+	// Read-ahead state is updated, take the write lock.
+	n.mu.Lock()
+	defer n.mu.Unlock()
 	if offset >= n.Size {
 		// Beyond end of file.
 		return nil
@@ -363,26 +386,168 @@ func (n *Node) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadR
 		return nil
 	}
 
-	data, err := read(n.cfs.db, n.ID, offset, to)
+	persistedSize := n.Size
+	if n.buf != nil {
+		persistedSize = n.buf.baseSize
+	}
+
+	data := make([]byte, to-offset)
+	if offset < persistedSize {
+		persisted, err := n.readPersisted(offset, min(to, persistedSize), persistedSize)
+		if err != nil {
+			return err
+		}
+		copy(data, persisted)
+	}
+	if n.buf != nil {
+		n.buf.overlay(offset, data)
+	}
+	resp.Data = data
+	return nil
+}
+
+// readPersisted returns the data [from, to) stored in the database, which holds
+// 'size' bytes. Sequential reads fetch up to readAheadSize more bytes.
+// The returned slice must not be modified. Requires n.mu to be held.
+func (n *Node) readPersisted(from, to, size uint64) ([]byte, error) {
+	sequential := from == n.ra.next
+	n.ra.next = to
+	if data, ok := n.ra.get(from, to); ok {
+		return data, nil
+	}
+
+	end := to
+	if sequential {
+		end = min(size, to+readAheadSize)
+	}
+	data, err := read(n.cfs.db, n.ID, from, end)
 	if err != nil {
+		return nil, err
+	}
+	if end > to {
+		n.ra.offset, n.ra.data = from, data
+	}
+	return data[:to-from], nil
+}
+
+// flushLocked commits the buffered data and the node descriptor in a single
+// transaction, along with the statements executed by 'fn' if not nil.
+// Requires n.mu to be held.
+func (n *Node) flushLocked(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if n.unlinked {
+		// Nothing left to write to.
+		n.buf = nil
+		return nil
+	}
+
+	var blocks map[int][]byte
+	if n.buf != nil {
+		// Partially modified blocks are fetched first: reads are not
+		// allowed within transactions.
+		var err error
+		blocks, err = n.buf.blocks(n.Size, func(block int) ([]byte, error) {
+			return getBlockData(n.cfs.db, n.ID, block)
+		})
+		if err != nil {
+			log.Print(err)
+			return err
+		}
+	}
+
+	err := client.ExecuteTx(ctx, n.cfs.db, nil /* txopts */, func(tx *sql.Tx) error {
+		if fn != nil {
+			if err := fn(tx); err != nil {
+				return err
+			}
+		}
+		if n.buf != nil {
+			if err := writeBlocks(tx, n.ID, n.buf.baseSize, n.Size, blocks); err != nil {
+				return err
+			}
+		}
+		return updateNode(tx, n)
+	})
+
+	if err != nil {
+		// Keep the buffer for the next attempt.
+		log.Print(err)
 		return err
 	}
-	resp.Data = data
+
+	n.buf = nil
+	// Persisted data changed, drop the read-ahead cache.
+	n.ra.data = nil
 	return nil
 }
 
-// Fsync is a noop for us, we always push writes to the DB. We do need to implement it though.
-func (n *Node) Fsync(_ context.Context, _ *fuse.FsyncRequest) error {
+// flush commits the buffered data if any.
+func (n *Node) flush(ctx context.Context) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.buf == nil {
+		return nil
+	}
+	return n.flushLocked(ctx, nil)
+}
+
+// unlinkLocked drops one link to the node in a single transaction, along with
+// the statements executed by 'fn' to remove the name pointing to it.
+// The inode is deleted together with its last link.
+// Requires n.mu to be held.
+func (n *Node) unlinkLocked(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if !n.isDir() && n.links() > 1 {
+		// Other names still refer to the inode.
+		originalLinks := n.NLinks
+		n.NLinks = n.links() - 1
+		if err := n.flushLocked(ctx, fn); err != nil {
+			n.NLinks = originalLinks
+			return err
+		}
+		return nil
+	}
+
+	err := client.ExecuteTx(ctx, n.cfs.db, nil /* txopts */, func(tx *sql.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return deleteInode(tx, n.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	n.unlinked = true
+	n.buf = nil
+	n.ra.data = nil
 	return nil
 }
 
+// Fsync flushes the buffered writes to the DB in a single transaction.
+func (n *Node) Fsync(ctx context.Context, _ *fuse.FsyncRequest) error {
+	return n.flush(ctx)
+}
+
+// Release flushes the buffered writes when a file handle is closed.
+func (n *Node) Release(ctx context.Context, _ *fuse.ReleaseRequest) error {
+	return n.flush(ctx)
+}
+
+// Forget is called when the kernel drops its last reference to the node.
+func (n *Node) Forget() {
+	if err := n.flush(context.Background()); err != nil {
+		log.Printf("flush on forget failed, id: %d, err: %v", n.ID, err)
+	}
+	n.cfs.nodes.remove(n)
+}
+
 // Rename renames 'req.OldName' to 'req.NewName', optionally moving it to 'newDir'.
-// If req.NewName exists, it is deleted. It is assumed that it cannot be a directory.
-// NOTE: we do not keep track of opens, so we delete existing destinations right away.
+// If req.NewName exists, its link is dropped. It is assumed that it cannot be a directory.
+// NOTE: we count hard links but not opens, so we delete the inode of existing
+// destinations along with their last link right away.
 // This means that anyone holding an open file descriptor on the destination will fail
 // when trying to use it.
-// To properly handle this, we need to count references (including inode -> inode refs,
-// and open handles) and delete the inode only when it reaches zero.
+// To properly handle this, we need to count open handles too and delete the inode
+// only when both reach zero.
 func (n *Node) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
 	newNode, ok := newDir.(*Node)
 	if !ok {
@@ -419,3 +584,104 @@ func (n *Node) Readlink(_ context.Context, req *fuse.ReadlinkRequest) (string, e
 	}
 	return n.SymlinkTarget, nil
 }
+
+// Link creates a new name 'req.NewName' in the receiver node, which must be a
+// directory, for the existing node 'old'. Both names share the same inode.
+func (n *Node) Link(ctx context.Context, req *fuse.LinkRequest, old fs.Node) (fs.Node, error) {
+	if !n.isDir() {
+		return nil, fuse.Errno(syscall.ENOTDIR)
+	}
+	target, ok := old.(*Node)
+	if !ok {
+		return nil, fmt.Errorf("old is not a Node: %v", old)
+	}
+	if target.isDir() {
+		// Hard links to directories are not allowed.
+		return nil, fuse.Errno(syscall.EPERM)
+	}
+	if _, err := getInode(n.cfs.db, n.ID, req.NewName); err == nil {
+		return nil, fuse.EEXIST
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	const insertNamespace = `INSERT INTO fs_namespace VALUES (?, ?, ?)`
+
+	target.mu.Lock()
+	defer target.mu.Unlock()
+
+	// Store the current link count in case we need to rollback.
+	originalLinks := target.NLinks
+	target.NLinks = target.links() + 1
+	err := target.flushLocked(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(insertNamespace, n.ID, req.NewName, target.ID)
+		return err
+	})
+	if err != nil {
+		target.NLinks = originalLinks
+		return nil, err
+	}
+	return target, nil
+}
+
+// Getxattr gets an extended attribute by the given name from the node.
+func (n *Node) Getxattr(
+	_ context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse,
+) error {
+	value, err := getXattr(n.cfs.db, n.ID, req.Name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fuse.ErrNoXattr
+		}
+		return err
+	}
+	resp.Xattr = value
+	return nil
+}
+
+// Listxattr lists the extended attributes recorded for the node.
+func (n *Node) Listxattr(
+	_ context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse,
+) error {
+	names, err := listXattrs(n.cfs.db, n.ID)
+	if err != nil {
+		return err
+	}
+	resp.Append(names...)
+	return nil
+}
+
+// Setxattr sets an extended attribute with the given name and value for the node.
+func (n *Node) Setxattr(_ context.Context, req *fuse.SetxattrRequest) error {
+	if len(req.Name) > maxXattrNameLength {
+		return fuse.Errno(syscall.ERANGE)
+	}
+	if len(req.Xattr) > maxXattrSize {
+		return fuse.Errno(syscall.E2BIG)
+	}
+
+	_, err := getXattr(n.cfs.db, n.ID, req.Name)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	exists := err == nil
+	if req.Flags&xattrCreate != 0 && exists {
+		return fuse.EEXIST
+	}
+	if req.Flags&xattrReplace != 0 && !exists {
+		return fuse.ErrNoXattr
+	}
+	return setXattr(n.cfs.db, n.ID, req.Name, req.Xattr, exists)
+}
+
+// Removexattr removes an extended attribute for the name.
+func (n *Node) Removexattr(_ context.Context, req *fuse.RemovexattrRequest) error {
+	removed, err := removeXattr(n.cfs.db, n.ID, req.Name)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return fuse.ErrNoXattr
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"testing"
+
+	"bazil.org/fuse"
+
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+func TestWriteBuffer(t *testing.T) {
+	persisted := bytes.Repeat([]byte{1}, BlockSize*2+100)
+	base := func(block int) ([]byte, error) {
+		start := block * BlockSize
+		end := int(min(uint64(len(persisted)), uint64(start+BlockSize)))
+		return persisted[start:end], nil
+	}
+
+	b := &writeBuffer{baseSize: uint64(len(persisted))}
+	b.write(10, []byte{2, 2})
+	b.write(12, []byte{3})
+	if len(b.ops) != 1 {
+		t.Fatalf("sequential writes not merged: %d ops", len(b.ops))
+	}
+	// Truncate in the middle of the first block, then grow again.
+	b.resize(100)
+	b.resize(BlockSize * 3)
+	b.write(BlockSize*4, []byte{4})
+
+	expected := make([]byte, BlockSize*4+1)
+	copy(expected, persisted[:100])
+	copy(expected[10:], []byte{2, 2, 3})
+	expected[BlockSize*4] = 4
+
+	data := make([]byte, len(persisted))
+	copy(data, persisted)
+	b.overlay(0, data)
+	if !bytes.Equal(data, expected[:len(persisted)]) {
+		t.Errorf("overlay mismatch")
+	}
+
+	blocks, err := b.blocks(uint64(len(expected)), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 5 {
+		t.Fatalf("expected 5 blocks, got %d", len(blocks))
+	}
+	for i, data := range blocks {
+		start := i * BlockSize
+		end := int(min(uint64(len(expected)), uint64(start+BlockSize)))
+		if !bytes.Equal(data, expected[start:end]) {
+			t.Errorf("block %d mismatch", i)
+		}
+	}
+}
+
+func readNode(n *Node) ([]byte, error) {
+	resp := &fuse.ReadResponse{}
+	err := n.Read(context.Background(), &fuse.ReadRequest{Size: int(n.Size)}, resp)
+	return resp.Data, err
+}
+
+func TestNodeWriteBack(t *testing.T) {
+	ctx := context.Background()
+	cfs := newCFS(db, 0)
+	root, _ := cfs.Root()
+
+	fn, _, err := root.(*Node).Create(ctx, &fuse.CreateRequest{Name: "writeback"}, &fuse.CreateResponse{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	file := fn.(*Node)
+
+	rng, _ := NewPseudoRand()
+	data := RandBytes(rng, BlockSize*3+100)
+	for offset := 0; offset < len(data); offset += 1000 {
+		end := offset + 1000
+		if end > len(data) {
+			end = len(data)
+		}
+		req := &fuse.WriteRequest{Offset: int64(offset), Data: data[offset:end]}
+		if err := file.Write(ctx, req, &fuse.WriteResponse{}); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Nothing is written before the flush.
+	if blocks, err := getBlocks(db, file.ID); err != nil {
+		log.Fatal(err)
+	} else if len(blocks) != 0 {
+		t.Errorf("expected no blocks before fsync, got %d", len(blocks))
+	}
+	if readData, err := readNode(file); err != nil {
+		log.Fatal(err)
+	} else if !bytes.Equal(readData, data) {
+		t.Errorf("buffered read mismatch")
+	}
+
+	if err := file.Fsync(ctx, &fuse.FsyncRequest{}); err != nil {
+		log.Fatal(err)
+	}
+	if verboseData, err := getAllBlocks(db, file.ID); err != nil {
+		log.Fatal(err)
+	} else if !bytes.Equal(verboseData, data) {
+		t.Errorf("flushed data mismatch")
+	}
+
+	// Sequential reads are served from the read-ahead cache.
+	resp := &fuse.ReadResponse{}
+	if err := file.Read(ctx, &fuse.ReadRequest{Offset: 0, Size: 100}, resp); err != nil {
+		log.Fatal(err)
+	}
+	if len(file.ra.data) != len(data) {
+		t.Errorf("expected %d bytes read ahead, got %d", len(data), len(file.ra.data))
+	}
+	if err := file.Read(ctx, &fuse.ReadRequest{Offset: 100, Size: 100}, resp); err != nil {
+		log.Fatal(err)
+	}
+	if !bytes.Equal(resp.Data, data[100:200]) {
+		t.Errorf("read-ahead data mismatch")
+	}
+
+	// Truncate, overwrite and grow, flushed on release.
+	setattr := &fuse.SetattrRequest{Valid: fuse.SetattrSize, Size: BlockSize + 10}
+	if err := file.Setattr(ctx, setattr, &fuse.SetattrResponse{}); err != nil {
+		log.Fatal(err)
+	}
+	data = data[:BlockSize+10]
+	part := RandBytes(rng, 500)
+	if err := file.Write(ctx, &fuse.WriteRequest{Offset: BlockSize * 2, Data: part}, &fuse.WriteResponse{}); err != nil {
+		log.Fatal(err)
+	}
+	data = append(data, make([]byte, BlockSize-10)...)
+	data = append(data, part...)
+	if err := file.Release(ctx, &fuse.ReleaseRequest{}); err != nil {
+		log.Fatal(err)
+	}
+	if verboseData, err := getAllBlocks(db, file.ID); err != nil {
+		log.Fatal(err)
+	} else if !bytes.Equal(verboseData, data) {
+		t.Errorf("released data mismatch")
+	}
+
+	node, err := getInode(db, rootNodeID, "writeback")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if node.Size != uint64(len(data)) {
+		t.Errorf("expected size %d, got %d", len(data), node.Size)
+	}
+
+	// Chmod is persisted.
+	setattr = &fuse.SetattrRequest{Valid: fuse.SetattrMode, Mode: 0600}
+	if err := file.Setattr(ctx, setattr, &fuse.SetattrResponse{}); err != nil {
+		log.Fatal(err)
+	}
+	if node, err = getInode(db, rootNodeID, "writeback"); err != nil {
+		log.Fatal(err)
+	}
+	if node.Mode != 0600 {
+		t.Errorf("expected mode 0600, got %v", node.Mode)
+	}
+}
+
+func TestNodeLink(t *testing.T) {
+	ctx := context.Background()
+	cfs := newCFS(db, 0)
+	rn, _ := cfs.Root()
+	root := rn.(*Node)
+
+	fn, _, err := root.Create(ctx, &fuse.CreateRequest{Name: "link-a"}, &fuse.CreateResponse{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	file := fn.(*Node)
+	if err := file.Write(ctx, &fuse.WriteRequest{Data: []byte("hello")}, &fuse.WriteResponse{}); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, err := root.Link(ctx, &fuse.LinkRequest{NewName: "link-b"}, file); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := root.Link(ctx, &fuse.LinkRequest{NewName: "link-b"}, file); err != fuse.EEXIST {
+		t.Errorf("expected EEXIST, got %v", err)
+	}
+
+	// Both names share the node and its data.
+	other, err := root.Lookup(ctx, "link-b")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if other != file {
+		t.Errorf("lookup returned a different node")
+	}
+	attr := &fuse.Attr{}
+	file.Attr(ctx, attr)
+	if attr.Nlink != 2 {
+		t.Errorf("expected 2 links, got %d", attr.Nlink)
+	}
+
+	// Dropping the first name keeps the data.
+	if err := root.Remove(ctx, &fuse.RemoveRequest{Name: "link-a"}); err != nil {
+		log.Fatal(err)
+	}
+	node, err := getInode(db, rootNodeID, "link-b")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if node.NLinks != 1 || node.Size != 5 {
+		t.Errorf("unexpected inode after unlink: %+v", node)
+	}
+	if readData, err := readNode(file); err != nil {
+		log.Fatal(err)
+	} else if string(readData) != "hello" {
+		t.Errorf("mismatch: %s", readData)
+	}
+
+	// Dropping the last name deletes the inode.
+	if err := root.Remove(ctx, &fuse.RemoveRequest{Name: "link-b"}); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := getInode(db, rootNodeID, "link-b"); err != sql.ErrNoRows {
+		t.Errorf("expected no inode, got %v", err)
+	}
+	if blocks, err := getBlocks(db, file.ID); err != nil {
+		log.Fatal(err)
+	} else if len(blocks) != 0 {
+		t.Errorf("expected blocks to be deleted, got %d", len(blocks))
+	}
+}
+
+func TestNodeXattr(t *testing.T) {
+	ctx := context.Background()
+	cfs := newCFS(db, 0)
+	rn, _ := cfs.Root()
+
+	fn, _, err := rn.(*Node).Create(ctx, &fuse.CreateRequest{Name: "xattr"}, &fuse.CreateResponse{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	file := fn.(*Node)
+
+	set := func(name, value string, flags uint32) error {
+		return file.Setxattr(ctx, &fuse.SetxattrRequest{Name: name, Xattr: []byte(value), Flags: flags})
+	}
+	if err := set("user.a", "1", xattrCreate); err != nil {
+		log.Fatal(err)
+	}
+	if err := set("user.a", "2", xattrCreate); err != fuse.EEXIST {
+		t.Errorf("expected EEXIST, got %v", err)
+	}
+	if err := set("user.b", "2", xattrReplace); err != fuse.ErrNoXattr {
+		t.Errorf("expected ErrNoXattr, got %v", err)
+	}
+	if err := set("user.a", "3", 0); err != nil {
+		log.Fatal(err)
+	}
+	if err := set("user.b", "4", 0); err != nil {
+		log.Fatal(err)
+	}
+
+	getResp := &fuse.GetxattrResponse{}
+	if err := file.Getxattr(ctx, &fuse.GetxattrRequest{Name: "user.a"}, getResp); err != nil {
+		log.Fatal(err)
+	}
+	if string(getResp.Xattr) != "3" {
+		t.Errorf("expected 3, got %s", getResp.Xattr)
+	}
+
+	listResp := &fuse.ListxattrResponse{}
+	if err := file.Listxattr(ctx, &fuse.ListxattrRequest{}, listResp); err != nil {
+		log.Fatal(err)
+	}
+	if string(listResp.Xattr) != "user.a\x00user.b\x00" {
+		t.Errorf("unexpected list: %q", listResp.Xattr)
+	}
+
+	if err := file.Removexattr(ctx, &fuse.RemovexattrRequest{Name: "user.a"}); err != nil {
+		log.Fatal(err)
+	}
+	if err := file.Removexattr(ctx, &fuse.RemovexattrRequest{Name: "user.a"}); err != fuse.ErrNoXattr {
+		t.Errorf("expected ErrNoXattr, got %v", err)
+	}
+	if err := file.Getxattr(ctx, &fuse.GetxattrRequest{Name: "user.a"}, getResp); err != fuse.ErrNoXattr {
+		t.Errorf("expected ErrNoXattr, got %v", err)
+	}
+}
+
+func TestStatfs(t *testing.T) {
+	cfs := newCFS(db, 1<<30)
+	resp := &fuse.StatfsResponse{}
+	if err := cfs.Statfs(context.Background(), &fuse.StatfsRequest{}, resp); err != nil {
+		log.Fatal(err)
+	}
+	if resp.Blocks != (1<<30)/BlockSize || resp.Bfree == 0 || resp.Bfree >= resp.Blocks {
+		t.Errorf("unexpected block usage: %v", resp)
+	}
+	if resp.Files == 0 || resp.Bsize != BlockSize {
+		t.Errorf("unexpected statfs: %v", resp)
+	}
+}
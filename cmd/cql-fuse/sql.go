@@ -90,20 +90,45 @@ UPDATE fs_inode SET inode = ? WHERE id = ?;
 	return nil
 }
 
+// selectBlocks selects the block index and data of blocks along with their chunk.
+// Blocks written before deduplication keep their data inline and have no chunk.
+const selectBlocks = `
+SELECT fs_block.block, fs_block.data, fs_chunk.codec, fs_chunk.data
+FROM fs_block LEFT JOIN fs_chunk ON fs_block.hash = fs_chunk.hash`
+
+// blockData returns the data of a block given its inline data and its chunk.
+func blockData(inline []byte, codec sql.NullInt64, chunk []byte) ([]byte, error) {
+	if !codec.Valid {
+		return inline, nil
+	}
+	return decodeChunk(int(codec.Int64), chunk)
+}
+
 // getBlockData returns the block data for a single block.
 func getBlockData(e sqlExecutor, inodeID uint64, block int) ([]byte, error) {
-	var data []byte
-	const sql = `SELECT data FROM fs_block WHERE id = ? AND block = ?`
-	if err := e.QueryRow(sql, inodeID, block).Scan(&data); err != nil {
+	var index int
+	var inline, chunk []byte
+	var codec sql.NullInt64
+	const sql = selectBlocks + ` WHERE fs_block.id = ? AND fs_block.block = ?`
+	if err := e.QueryRow(sql, inodeID, block).Scan(&index, &inline, &codec, &chunk); err != nil {
 		return nil, err
 	}
-	return data, nil
+	return blockData(inline, codec, chunk)
 }
 
 // updateBlockData overwrites the data for a single block.
+// The new chunk is referenced before the previous one is released,
+// so rewriting identical data never deletes the chunk.
 func updateBlockData(e sqlExecutor, inodeID uint64, block int, data []byte) error {
-	const sql = `UPDATE fs_block SET data = ? WHERE (id, block) = (?, ?)`
-	if _, err := e.Exec(sql, data, inodeID, block); err != nil {
+	hashes, err := acquireChunks(e, [][]byte{data})
+	if err != nil {
+		return err
+	}
+	if err := releaseChunks(e, inodeID, block, block); err != nil {
+		return err
+	}
+	const sql = `UPDATE fs_block SET data = NULL, hash = ? WHERE (id, block) = (?, ?)`
+	if _, err := e.Exec(sql, hashes[0], inodeID, block); err != nil {
 		return err
 	}
 	return nil
@@ -117,7 +142,7 @@ type blockInfo struct {
 // getBlocks fetches all the blocks for a given inode and returns
 // a list of blockInfo objects.
 func getBlocks(e sqlExecutor, inodeID uint64) ([]blockInfo, error) {
-	stmt := `SELECT block, data FROM fs_block WHERE id = ?`
+	stmt := selectBlocks + ` WHERE fs_block.id = ? ORDER BY fs_block.block`
 	rows, err := e.Query(stmt, inodeID)
 	if err != nil {
 		return nil, err
@@ -128,7 +153,8 @@ func getBlocks(e sqlExecutor, inodeID uint64) ([]blockInfo, error) {
 // getBlocksBetween fetches blocks with IDs [start, end] for a given inode
 // and returns a list of blockInfo objects.
 func getBlocksBetween(e sqlExecutor, inodeID uint64, start, end int) ([]blockInfo, error) {
-	stmt := `SELECT block, data FROM fs_block WHERE id = ? AND block >= ? AND block <= ?`
+	stmt := selectBlocks + ` WHERE fs_block.id = ? AND fs_block.block >= ? AND fs_block.block <= ?
+ORDER BY fs_block.block`
 	rows, err := e.Query(stmt, inodeID, start, end)
 	if err != nil {
 		return nil, err
@@ -140,9 +166,16 @@ func buildBlockInfos(rows *sql.Rows) ([]blockInfo, error) {
 	var results []blockInfo
 	for rows.Next() {
 		b := blockInfo{}
-		if err := rows.Scan(&b.block, &b.data); err != nil {
+		var inline, chunk []byte
+		var codec sql.NullInt64
+		if err := rows.Scan(&b.block, &inline, &codec, &chunk); err != nil {
+			return nil, err
+		}
+		data, err := blockData(inline, codec, chunk)
+		if err != nil {
 			return nil, err
 		}
+		b.data = data
 		results = append(results, b)
 	}
 	if err := rows.Err(); err != nil {
@@ -151,3 +184,100 @@ func buildBlockInfos(rows *sql.Rows) ([]blockInfo, error) {
 
 	return results, nil
 }
+
+// deleteInode deletes the inode with id 'inodeID' along with its data
+// blocks and extended attributes.
+func deleteInode(e sqlExecutor, inodeID uint64) error {
+	if err := deleteBlocks(e, inodeID, 0, maxBlockIndex); err != nil {
+		return err
+	}
+	for _, stmt := range []string{
+		`DELETE FROM fs_inode WHERE id = ?`,
+		`DELETE FROM fs_xattr WHERE id = ?`,
+	} {
+		if _, err := e.Exec(stmt, inodeID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getXattr returns the value of an extended attribute.
+// If not found, error will be sql.ErrNoRows.
+func getXattr(e sqlExecutor, inodeID uint64, name string) ([]byte, error) {
+	var value []byte
+	const sql = `SELECT value FROM fs_xattr WHERE (id, name) = (?, ?)`
+	if err := e.QueryRow(sql, inodeID, name).Scan(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// setXattr inserts or overwrites an extended attribute.
+func setXattr(e sqlExecutor, inodeID uint64, name string, value []byte, exists bool) error {
+	stmt := `INSERT INTO fs_xattr VALUES (?, ?, ?)`
+	args := []interface{}{inodeID, name, value}
+	if exists {
+		stmt = `UPDATE fs_xattr SET value = ? WHERE (id, name) = (?, ?)`
+		args = []interface{}{value, inodeID, name}
+	}
+	if _, err := e.Exec(stmt, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// listXattrs returns the names of the extended attributes of an inode.
+func listXattrs(e sqlExecutor, inodeID uint64) ([]string, error) {
+	rows, err := e.Query(`SELECT name FROM fs_xattr WHERE id = ? ORDER BY name`, inodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// removeXattr deletes an extended attribute, returns false if it does not exist.
+func removeXattr(e sqlExecutor, inodeID uint64, name string) (bool, error) {
+	res, err := e.Exec(`DELETE FROM fs_xattr WHERE (id, name) = (?, ?)`, inodeID, name)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// dbStats describes the space used by the database.
+type dbStats struct {
+	pageSize  uint64
+	pageCount uint64
+	freePages uint64
+	inodes    uint64
+}
+
+// getDBStats returns the database page usage and the number of inodes.
+func getDBStats(e sqlExecutor) (stats dbStats, err error) {
+	for _, q := range []struct {
+		sql  string
+		dest *uint64
+	}{
+		{`PRAGMA page_size`, &stats.pageSize},
+		{`PRAGMA page_count`, &stats.pageCount},
+		{`PRAGMA freelist_count`, &stats.freePages},
+		{`SELECT COUNT(id) FROM fs_inode`, &stats.inodes},
+	} {
+		if err = e.QueryRow(q.sql).Scan(q.dest); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/worker"
+	"github.com/CovenantSQL/CovenantSQL/xenomint"
 	"github.com/pkg/errors"
 )
 
@@ -44,10 +45,17 @@ func startDBMS(server *rpc.Server) (dbms *worker.DBMS, err error) {
 		return
 	}
 
+	if err = xenomint.SetSlowQueryLog(
+		conf.GConf.Miner.SlowQueryLogFile, conf.GConf.Miner.SlowQueryThreshold); err != nil {
+		err = errors.Wrap(err, "open slow query log failed")
+		return
+	}
+
 	cfg := &worker.DBMSConfig{
-		RootDir:       conf.GConf.Miner.RootDir,
-		Server:        server,
-		MaxReqTimeGap: conf.GConf.Miner.MaxReqTimeGap,
+		RootDir:          conf.GConf.Miner.RootDir,
+		Server:           server,
+		MaxReqTimeGap:    conf.GConf.Miner.MaxReqTimeGap,
+		MaxQueryPatterns: conf.GConf.Miner.MaxQueryPatterns,
 	}
 
 	if dbms, err = worker.NewDBMS(cfg); err != nil {
@@ -63,9 +71,9 @@ func startDBMS(server *rpc.Server) (dbms *worker.DBMS, err error) {
 	// add test fixture database
 	if conf.GConf.Miner.IsTestMode {
 		// in test mode
-		var privKey *asymmetric.PrivateKey
+		var privKey asymmetric.Signer
 
-		if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+		if privKey, err = kms.GetLocalSigner(); err != nil {
 			err = errors.Wrap(err, "get local private key failed")
 			return
 		}
@@ -39,6 +39,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/CovenantSQL/CovenantSQL/utils/trace"
 	"github.com/CovenantSQL/CovenantSQL/worker"
 	graphite "github.com/cyberdelia/go-metrics-graphite"
 	metrics "github.com/rcrowley/go-metrics"
@@ -76,6 +77,7 @@ var (
 	memProfile     string
 	profileServer  string
 	metricGraphite string
+	metricWeb      string
 	traceFile      string
 
 	// other
@@ -100,6 +102,7 @@ func init() {
 	flag.StringVar(&cpuProfile, "cpu-profile", "", "Path to file for CPU profiling information")
 	flag.StringVar(&memProfile, "mem-profile", "", "Path to file for memory profiling information")
 	flag.StringVar(&metricGraphite, "metricGraphiteServer", "", "Metric graphite server to push metrics")
+	flag.StringVar(&metricWeb, "metric-web", "", "Address to serve prometheus metrics on /metrics, default not started")
 	flag.StringVar(&traceFile, "traceFile", "", "trace profile")
 
 	flag.Usage = func() {
@@ -184,6 +187,19 @@ func main() {
 		}()
 	}
 
+	if conf.GConf.Tracing != nil {
+		if err = trace.Start(name, conf.GConf.Tracing); err != nil {
+			log.WithError(err).Fatal("start tracing failed")
+		}
+		defer trace.Stop()
+	}
+
+	if len(metricWeb) > 0 {
+		if _, err = metric.StartMetricWeb(metricWeb); err != nil {
+			log.WithError(err).Fatal("start metric web failed")
+		}
+	}
+
 	// start metric collector
 	go func() {
 		mc := metric.NewCollectClient()
@@ -227,6 +243,11 @@ func main() {
 	go func() {
 		server.Serve()
 	}()
+
+	// join the kademlia routing
+	go rpc.RunRoutingRefresh(rpc.DefaultRoutingRefreshInterval, stopCh)
+	// publish the signed node record before it expires
+	go rpc.RunNodeRecordRefresh(rpc.DefaultNodeRecordRefreshInterval, stopCh)
 	defer func() {
 		server.Listener.Close()
 		server.Stop()
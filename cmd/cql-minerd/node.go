@@ -56,6 +56,19 @@ func initNode() (server *rpc.Server, err error) {
 	// init kms routing
 	route.InitKMS(conf.GConf.PubKeyStoreFile)
 
+	if err = route.InitACL(); err != nil {
+		log.WithError(err).Error("init acl policy failed")
+		return
+	}
+
+	// init kademlia routing table
+	var localNodeID proto.NodeID
+	if localNodeID, err = kms.GetLocalNodeID(); err != nil {
+		log.WithError(err).Error("get local node id failed")
+		return
+	}
+	route.InitRoutingTable(localNodeID.ToRawNodeID())
+
 	err = registerNodeToBP(15 * time.Second)
 	if err != nil {
 		log.Fatalf("register node to BP failed: %v", err)
@@ -79,7 +92,11 @@ func createServer(privateKeyPath, pubKeyStorePath string, masterKey []byte, list
 		return
 	}
 
-	err = server.InitRPCServer(listenAddr, privateKeyPath, masterKey)
+	if err = server.InitRPCServer(listenAddr, privateKeyPath, masterKey); err != nil {
+		return
+	}
+
+	err = server.RegisterService(route.KademliaRPCName, route.NewKademliaService())
 
 	return
 }
@@ -29,6 +29,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/metric"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
@@ -43,6 +44,7 @@ var (
 	configFile    string
 	dbID          string
 	listenAddr    string
+	metricWeb     string
 	resetPosition string
 	showVersion   bool
 )
@@ -55,6 +57,7 @@ func init() {
 		"Disable signature sign and verify, for testing")
 	flag.StringVar(&resetPosition, "reset", "", "reset subscribe position")
 	flag.StringVar(&listenAddr, "listen", "127.0.0.1:4663", "listen address for http explorer api")
+	flag.StringVar(&metricWeb, "metric-web", "", "Address to serve prometheus metrics on /metrics, default not started")
 }
 
 func main() {
@@ -98,10 +101,19 @@ func main() {
 		log.WithError(err).Fatal("start explorer api failed")
 	}
 
+	if len(metricWeb) > 0 {
+		if _, err = metric.StartMetricWeb(metricWeb); err != nil {
+			log.WithError(err).Fatal("start metric web failed")
+		}
+	}
+
 	// register node
 	if err = registerNode(); err != nil {
 		log.WithError(err).Fatal("register node failed")
 	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go rpc.RunNodeRecordRefresh(rpc.DefaultNodeRecordRefreshInterval, stopCh)
 
 	// start subscription
 	var cfg *Config
@@ -482,7 +482,7 @@ func (s *Service) getUpstream(dbID proto.DatabaseID) (instance *types.ServiceIns
 		return
 	}
 
-	privateKey, err := kms.GetLocalPrivateKey()
+	privateKey, err := kms.GetLocalSigner()
 	if err != nil {
 		return
 	}
@@ -37,6 +37,8 @@ type adapterConfig struct {
 	WriteCerts        []string `yaml:"WriteCerts"`
 	StorageDriver     string   `yaml:"StorageDriver"`
 	StorageRoot       string   `yaml:"StorageRoot"`
+	GraphQL           bool     `yaml:"GraphQL"`
+	AuthStore         string   `yaml:"AuthStore"`
 }
 
 var (
@@ -50,6 +52,8 @@ var (
 		WriteCerts:        []string{},
 		StorageDriver:     "covenantsql",
 		StorageRoot:       "",
+		GraphQL:           false,
+		AuthStore:         "",
 	}
 )
 
@@ -146,6 +150,23 @@ func (c *adapterConfig) readStorageRoot() {
 	}
 }
 
+func (c *adapterConfig) readGraphQL() {
+	enableGraphQL := readDataFromStdin("GraphQL (default: %v) (y/n): ", c.GraphQL)
+	switch enableGraphQL {
+	case "y", "Y":
+		c.GraphQL = true
+	case "n", "N":
+		c.GraphQL = false
+	}
+}
+
+func (c *adapterConfig) readAuthStore() {
+	newAuthStore := readDataFromStdin("AuthStore (default: %v)", c.AuthStore)
+	if newAuthStore != "" {
+		c.AuthStore = newAuthStore
+	}
+}
+
 func (c *adapterConfig) loadFromExistingConfig(rawConfig yaml.MapSlice) {
 	if rawConfig == nil {
 		return
@@ -216,6 +237,8 @@ func (c *adapterConfig) readAllConfig() {
 
 	c.readStorageDriver()
 	c.readStorageRoot()
+	c.readGraphQL()
+	c.readAuthStore()
 }
 
 func readDataFromStdin(prompt string, values ...interface{}) (s string) {
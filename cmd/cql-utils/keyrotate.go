@@ -0,0 +1,186 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	bp "github.com/CovenantSQL/CovenantSQL/blockproducer"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+var (
+	newPrivateKeyFile string
+	rotateGracePeriod time.Duration
+	rotateNodeKey     bool
+)
+
+func init() {
+	flag.StringVar(&newPrivateKeyFile, "new-private", "private.key.new", "new private key file to generate for keyrotate")
+	flag.DurationVar(&rotateGracePeriod, "grace", 24*time.Hour, "period in which the old key is still accepted for keyrotate")
+	flag.BoolVar(&rotateNodeKey, "node", true, "rotate the node key along with the account key for keyrotate")
+}
+
+func runKeyRotate() {
+	if rotateGracePeriod < 0 || rotateGracePeriod > kms.MaxKeyRotationGracePeriod {
+		log.WithField("max", kms.MaxKeyRotationGracePeriod).Fatal("invalid grace period")
+	}
+	if _, err := os.Stat(newPrivateKeyFile); err == nil {
+		log.WithField("file", newPrivateKeyFile).Fatal("new private key file already exists")
+	}
+
+	masterKey, err := readMasterKey()
+	if err != nil {
+		log.WithError(err).Fatal("read master key failed")
+	}
+	if err = client.Init(configFile, []byte(masterKey)); err != nil {
+		log.WithError(err).Fatal("init rpc client failed")
+	}
+
+	oldKey, err := kms.GetLocalPrivateKey()
+	if err != nil {
+		log.WithError(err).Fatal("get local private key failed")
+	}
+	newKey, _, err := asymmetric.GenSecp256k1KeyPair()
+	if err != nil {
+		log.WithError(err).Fatal("generate key pair failed")
+	}
+
+	// The original key of a rotated account is required to find the account.
+	originalKey := oldKey.PubKey()
+	if publicKeyHex != "" {
+		publicKeyBytes, err := hex.DecodeString(publicKeyHex)
+		if err != nil {
+			log.WithError(err).Fatal("error converting hex")
+		}
+		if originalKey, err = asymmetric.ParsePubKey(publicKeyBytes); err != nil {
+			log.WithError(err).Fatal("error converting public key")
+		}
+	}
+
+	header := &kms.KeyRotationHeader{
+		OriginalKey: originalKey,
+		OldKey:      oldKey.PubKey(),
+		NewKey:      newKey.PubKey(),
+		Timestamp:   time.Now().UTC(),
+		GracePeriod: rotateGracePeriod,
+	}
+	if rotateNodeKey {
+		nodeID := conf.GConf.ThisNodeID
+		nonce, err := kms.GetLocalNonce()
+		if err != nil {
+			log.WithError(err).Fatal("get local node nonce failed")
+		}
+		header.NodeID = &nodeID
+		header.Nonce = *nonce
+	}
+
+	// The original key of a rotated identity is kept in its latest rotation record.
+	if prev, err := findKeyRotation(header); err == nil {
+		header.OriginalKey = prev.OriginalKey
+	}
+
+	rotation := kms.NewKeyRotation(header)
+	if err = rotation.Sign(oldKey, newKey); err != nil {
+		log.WithError(err).Fatal("sign key rotation failed")
+	}
+	if err = rotation.Verify(); err != nil {
+		log.WithError(err).Fatal("verify key rotation failed")
+	}
+
+	// Save the new key before publishing the rotation, it can't be recovered otherwise.
+	if err = kms.SavePrivateKey(newPrivateKeyFile, newKey, []byte(masterKey)); err != nil {
+		log.WithError(err).Fatal("save new private key failed")
+	}
+
+	// Register the rotation to the public keystore of all block producers.
+	for _, bpNodeID := range route.GetBPs() {
+		req := &route.RotateKeyReq{Rotation: rotation}
+		resp := &route.RotateKeyResp{}
+		if err = rpc.NewCaller().CallNode(bpNodeID, route.DHTRotateKey.String(), req, resp); err != nil {
+			log.WithField("bp", bpNodeID).WithError(err).Fatal("register key rotation failed")
+		}
+	}
+
+	// Register the rotation to the account on the block producer chain, skipped if the account
+	// doesn't exist yet.
+	addr, err := rotation.Address()
+	if err != nil {
+		log.WithError(err).Fatal("get account address failed")
+	}
+	nonceReq := &bp.NextAccountNonceReq{Addr: addr}
+	nonceResp := &bp.NextAccountNonceResp{}
+	if err = requestBP(route.MCCNextAccountNonce.String(), nonceReq, nonceResp); err != nil {
+		log.WithError(err).Warning("allocate account nonce failed, account key rotation skipped")
+	} else {
+		req := &bp.AddTxReq{}
+		resp := &bp.AddTxResp{}
+		req.Tx = pt.NewKeyRotation(&pt.KeyRotationHeader{
+			Address:  addr,
+			Nonce:    nonceResp.Nonce,
+			Rotation: *rotation,
+		})
+		if err = req.Tx.Sign(oldKey); err != nil {
+			log.WithError(err).Fatal("sign key rotation transaction failed")
+		}
+		if err = requestBP(route.MCCAddTx.String(), req, resp); err != nil {
+			log.WithError(err).Fatal("send key rotation transaction failed")
+		}
+	}
+
+	walletAddr, _ := crypto.PubKey2Addr(rotation.OriginalKey, crypto.TestNet)
+	fmt.Printf("Key rotated, wallet address: %s\n", walletAddr)
+	fmt.Printf("New private key file: %s\n", newPrivateKeyFile)
+	fmt.Printf("New public key's hex: %s\n", hex.EncodeToString(newKey.PubKey().Serialize()))
+	fmt.Printf("The old key is accepted until: %s\n", header.Timestamp.Add(header.GracePeriod).Format(time.RFC3339))
+	fmt.Println("Peers reach the node with the new key from then on, replace the private key file of the node with the new one at that time.")
+}
+
+func findKeyRotation(header *kms.KeyRotationHeader) (r *kms.KeyRotation, err error) {
+	id, err := header.Identity()
+	if err != nil {
+		return
+	}
+	req := &route.FindKeyRotationReq{ID: id}
+	resp := &route.FindKeyRotationResp{}
+	if err = requestBP(route.DHTFindKeyRotation.String(), req, resp); err != nil {
+		return
+	}
+	r = resp.Rotation
+	return
+}
+
+func requestBP(method string, req interface{}, resp interface{}) (err error) {
+	var bpNodeID proto.NodeID
+	if bpNodeID, err = rpc.GetCurrentBP(); err != nil {
+		return
+	}
+	return rpc.NewCaller().CallNode(bpNodeID, method, req, resp)
+}
@@ -18,13 +18,23 @@ package main
 
 import (
 	"encoding/hex"
+	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 )
 
+var (
+	migrateKeyFile bool
+)
+
+func init() {
+	flag.BoolVar(&migrateKeyFile, "migrate", false, "upgrade the legacy private key file in place for keytool")
+}
+
 func runKeytool() {
 	masterKey, err := readMasterKey()
 	if err != nil {
@@ -32,10 +42,30 @@ func runKeytool() {
 		os.Exit(1)
 	}
 
+	if migrateKeyFile {
+		migrated, err := kms.MigratePrivateKey(privateKeyFile, []byte(masterKey))
+		if err != nil {
+			log.WithError(err).Fatal("migrate private key failed")
+		}
+		if migrated {
+			fmt.Printf("Private key file %s upgraded to version %d\n", privateKeyFile, kms.KeystoreVersion)
+		} else {
+			fmt.Printf("Private key file %s is up to date\n", privateKeyFile)
+		}
+	}
+
 	privateKey, err := kms.LoadPrivateKey(privateKeyFile, []byte(masterKey))
 	if err != nil {
-		log.WithError(err).Error("load private key failed")
+		log.WithError(err).Fatal("load private key failed")
 	}
 
+	if ks, err := kms.LoadKeystore(privateKeyFile); err == nil {
+		fmt.Printf("Key file version: %d\n", ks.Version)
+		if ks.Version == kms.KeystoreVersion {
+			fmt.Printf("Key file created at: %s\n", ks.CreatedAt.Format(time.RFC3339))
+		} else {
+			fmt.Println("Upgrade the legacy key file with -migrate")
+		}
+	}
 	fmt.Printf("Public key's hex: %s\n", hex.EncodeToString(privateKey.PubKey().Serialize()))
 }
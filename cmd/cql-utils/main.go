@@ -41,7 +41,7 @@ const name = "cql-utils"
 func init() {
 	log.SetLevel(log.InfoLevel)
 
-	flag.StringVar(&tool, "tool", "", "tool type, miner, keygen, keytool, rpc, nonce, confgen, addrgen, adapterconfgen")
+	flag.StringVar(&tool, "tool", "", "tool type, miner, keygen, keytool, keyrotate, multisig, signer, rpc, nonce, confgen, addrgen, adapterconfgen, seedlist")
 	flag.StringVar(&publicKeyHex, "public", "", "public key hex string to mine node id/nonce")
 	flag.StringVar(&privateKeyFile, "private", "private.key", "private key file to generate/show")
 	flag.StringVar(&configFile, "config", "config.yaml", "config file to use")
@@ -79,6 +79,20 @@ func main() {
 			os.Exit(1)
 		}
 		runKeytool()
+	case "keyrotate":
+		if configFile == "" {
+			log.Error("config file path is required for keyrotate")
+			os.Exit(1)
+		}
+		runKeyRotate()
+	case "multisig":
+		runMultiSig()
+	case "signer":
+		if privateKeyFile == "" {
+			log.Error("privateKey path is required for signer")
+			os.Exit(1)
+		}
+		runSigner()
 	case "rpc":
 		runRPC()
 	case "nonce":
@@ -93,6 +107,12 @@ func main() {
 			os.Exit(1)
 		}
 		runAddrgen()
+	case "seedlist":
+		if privateKeyFile == "" {
+			log.Error("privateKey path is required for seedlist")
+			os.Exit(1)
+		}
+		runSeedList()
 	default:
 		flag.Usage()
 		os.Exit(1)
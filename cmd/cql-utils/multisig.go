@@ -0,0 +1,238 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	bp "github.com/CovenantSQL/CovenantSQL/blockproducer"
+	pi "github.com/CovenantSQL/CovenantSQL/blockproducer/interfaces"
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
+	"github.com/CovenantSQL/CovenantSQL/client"
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+var (
+	multiSigOp        string
+	multiSigKeys      string
+	multiSigThreshold uint
+	multiSigTxType    string
+	multiSigReceiver  string
+	multiSigAmount    uint64
+	multiSigDatabase  string
+	multiSigNonce     uint64
+	multiSigIn        string
+	multiSigOut       string
+)
+
+func init() {
+	flag.StringVar(&multiSigOp, "multisig-op", "", "multisig operation: address, build, sign, combine, send")
+	flag.StringVar(&multiSigKeys, "multisig-keys", "", "comma separated public key hex strings of the multisig account")
+	flag.UintVar(&multiSigThreshold, "multisig-threshold", 1, "number of signatures required by the multisig account")
+	flag.StringVar(&multiSigTxType, "multisig-tx", "transfer", "multisig transaction type to build: transfer, dropdb")
+	flag.StringVar(&multiSigReceiver, "receiver", "", "receiver wallet address of the multisig transfer")
+	flag.Uint64Var(&multiSigAmount, "amount", 0, "amount of the multisig transfer")
+	flag.StringVar(&multiSigDatabase, "database", "", "database id to drop by the multisig transaction")
+	flag.Uint64Var(&multiSigNonce, "nonce", 0, "account nonce of the multisig transaction")
+	flag.StringVar(&multiSigIn, "in", "", "comma separated multisig transaction files to sign/combine/send")
+	flag.StringVar(&multiSigOut, "out", "multisig.tx", "multisig transaction file to write")
+}
+
+func runMultiSig() {
+	switch multiSigOp {
+	case "address":
+		policy := loadMultiSigPolicy()
+		addr, err := policy.Address()
+		if err != nil {
+			log.WithError(err).Fatal("get multisig address failed")
+		}
+		fmt.Printf("multisig wallet address: %s\n", crypto.Hash2Addr(addr, crypto.TestNet))
+	case "build":
+		buildMultiSigTx()
+	case "sign":
+		signMultiSigTx()
+	case "combine":
+		combineMultiSigTx()
+	case "send":
+		sendMultiSigTx()
+	default:
+		log.WithField("op", multiSigOp).Fatal("unknown multisig operation")
+	}
+}
+
+func loadMultiSigPolicy() (policy *pt.MultiSigPolicy) {
+	var keys []*asymmetric.PublicKey
+	for _, v := range strings.Split(multiSigKeys, ",") {
+		keyBytes, err := hex.DecodeString(strings.TrimSpace(v))
+		if err != nil {
+			log.WithError(err).Fatal("error converting hex")
+		}
+		key, err := asymmetric.ParsePubKey(keyBytes)
+		if err != nil {
+			log.WithError(err).Fatal("error converting public key")
+		}
+		keys = append(keys, key)
+	}
+	policy, err := pt.NewMultiSigPolicy(uint32(multiSigThreshold), keys)
+	if err != nil {
+		log.WithError(err).Fatal("invalid multisig policy")
+	}
+	return
+}
+
+func buildMultiSigTx() {
+	policy := loadMultiSigPolicy()
+	addr, err := policy.Address()
+	if err != nil {
+		log.WithError(err).Fatal("get multisig address failed")
+	}
+	var tx pi.Transaction
+	switch multiSigTxType {
+	case "transfer":
+		_, receiver, err := crypto.Addr2Hash(multiSigReceiver)
+		if err != nil {
+			log.WithError(err).Fatal("invalid receiver address")
+		}
+		tx = pt.NewMultiSigTransfer(&pt.TransferHeader{
+			Sender:   addr,
+			Receiver: receiver,
+			Nonce:    pi.AccountNonce(multiSigNonce),
+			Amount:   multiSigAmount,
+		}, policy)
+	case "dropdb":
+		if multiSigDatabase == "" {
+			log.Fatal("database id is required to build dropdb transaction")
+		}
+		tx = pt.NewMultiSigDropDatabase(&pt.DropDatabaseHeader{
+			Owner:      addr,
+			Nonce:      pi.AccountNonce(multiSigNonce),
+			DatabaseID: proto.DatabaseID(multiSigDatabase),
+		}, policy)
+	default:
+		log.WithField("type", multiSigTxType).Fatal("unknown multisig transaction type")
+	}
+	writeMultiSigTx(tx)
+}
+
+func signMultiSigTx() {
+	txs := readMultiSigTxs()
+	masterKey, err := readMasterKey()
+	if err != nil {
+		log.WithError(err).Fatal("read master key failed")
+	}
+	key, err := kms.LoadPrivateKey(privateKeyFile, []byte(masterKey))
+	if err != nil {
+		log.WithError(err).Fatal("load private key failed")
+	}
+	if err = txs[0].Sign(key); err != nil {
+		log.WithError(err).Fatal("sign multisig transaction failed")
+	}
+	writeMultiSigTx(txs[0])
+}
+
+func combineMultiSigTx() {
+	txs := readMultiSigTxs()
+	ms := multiSigOf(txs[0])
+	for _, v := range txs[1:] {
+		if v.Hash() != txs[0].Hash() {
+			log.Fatal("multisig transactions to combine are not the same")
+		}
+		if err := ms.Combine(multiSigOf(v)); err != nil {
+			log.WithError(err).Fatal("combine multisig transaction failed")
+		}
+	}
+	writeMultiSigTx(txs[0])
+	if err := txs[0].Verify(); err != nil {
+		fmt.Printf("multisig transaction is not complete yet: %v\n", err)
+	}
+}
+
+func sendMultiSigTx() {
+	txs := readMultiSigTxs()
+	if err := txs[0].Verify(); err != nil {
+		log.WithError(err).Fatal("verify multisig transaction failed")
+	}
+	masterKey, err := readMasterKey()
+	if err != nil {
+		log.WithError(err).Fatal("read master key failed")
+	}
+	if err = client.Init(configFile, []byte(masterKey)); err != nil {
+		log.WithError(err).Fatal("init rpc client failed")
+	}
+	req := &bp.AddTxReq{Tx: txs[0]}
+	resp := &bp.AddTxResp{}
+	if err = requestBP(route.MCCAddTx.String(), req, resp); err != nil {
+		log.WithError(err).Fatal("send multisig transaction failed")
+	}
+	fmt.Printf("multisig transaction sent: %s\n", txs[0].Hash().String())
+}
+
+func readMultiSigTxs() (txs []pi.Transaction) {
+	if multiSigIn == "" {
+		log.Fatal("multisig transaction file is required")
+	}
+	for _, v := range strings.Split(multiSigIn, ",") {
+		enc, err := ioutil.ReadFile(v)
+		if err != nil {
+			log.WithField("file", v).WithError(err).Fatal("read multisig transaction failed")
+		}
+		var tx pi.Transaction
+		if err = utils.DecodeMsgPack(enc, &tx); err != nil {
+			log.WithField("file", v).WithError(err).Fatal("decode multisig transaction failed")
+		}
+		if w, ok := tx.(*pi.TransactionWrapper); ok {
+			tx = w.Unwrap()
+		}
+		if multiSigOf(tx) == nil {
+			log.WithField("file", v).Fatal("not a multisig transaction")
+		}
+		txs = append(txs, tx)
+	}
+	return
+}
+
+func writeMultiSigTx(tx pi.Transaction) {
+	enc, err := utils.EncodeMsgPack(tx)
+	if err != nil {
+		log.WithError(err).Fatal("encode multisig transaction failed")
+	}
+	if err = ioutil.WriteFile(multiSigOut, enc.Bytes(), 0600); err != nil {
+		log.WithField("file", multiSigOut).WithError(err).Fatal("write multisig transaction failed")
+	}
+	fmt.Printf("multisig transaction %s with %d signature(s) written to %s\n",
+		tx.GetTransactionType(), len(multiSigOf(tx).Signatures), multiSigOut)
+}
+
+func multiSigOf(tx pi.Transaction) *pt.MultiSig {
+	switch t := tx.(type) {
+	case *pt.Transfer:
+		return t.MultiSig
+	case *pt.DropDatabase:
+		return t.MultiSig
+	}
+	return nil
+}
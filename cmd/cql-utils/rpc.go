@@ -52,7 +52,7 @@ var (
 )
 
 type canSign interface {
-	Sign(signer *asymmetric.PrivateKey) error
+	Sign(signer asymmetric.Signer) error
 }
 
 func init() {
@@ -117,8 +117,8 @@ func checkAndSign(req interface{}) (err error) {
 	}
 
 	if canSignObj, ok := req.(canSign); ok {
-		var privKey *asymmetric.PrivateKey
-		if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+		var privKey asymmetric.Signer
+		if privKey, err = kms.GetLocalSigner(); err != nil {
 			return
 		}
 		if err = canSignObj.Sign(privKey); err != nil {
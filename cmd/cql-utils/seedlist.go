@@ -0,0 +1,75 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+var (
+	seedListFile string
+)
+
+func init() {
+	flag.StringVar(&seedListFile, "seed-list", "seed.list", "signed block producer seed list file to generate")
+}
+
+func runSeedList() {
+	cfg, err := conf.LoadConfig(configFile)
+	if err != nil {
+		log.WithError(err).Fatal("load config file failed")
+	}
+	masterKey, err := readMasterKey()
+	if err != nil {
+		log.WithError(err).Fatal("read master key failed")
+	}
+	key, err := kms.LoadPrivateKey(privateKeyFile, []byte(masterKey))
+	if err != nil {
+		log.WithError(err).Fatal("load private key failed")
+	}
+
+	l := &route.SeedList{
+		SeedListHeader: route.SeedListHeader{
+			Timestamp: time.Now().UTC(),
+		},
+	}
+	for _, n := range cfg.KnownNodes {
+		if n.Role == proto.Leader || n.Role == proto.Follower {
+			l.Nodes = append(l.Nodes, n)
+		}
+	}
+	if len(l.Nodes) == 0 {
+		log.Fatal("no block producer found in known nodes")
+	}
+	if err = l.Sign(key); err != nil {
+		log.WithError(err).Fatal("sign seed list failed")
+	}
+	if err = route.SaveSeedList(seedListFile, l); err != nil {
+		log.WithError(err).Fatal("save seed list failed")
+	}
+	log.WithFields(log.Fields{
+		"file":  seedListFile,
+		"count": len(l.Nodes),
+	}).Info("seed list generated")
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"net"
+	"os"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+var (
+	signerSocket string
+)
+
+func init() {
+	flag.StringVar(&signerSocket, "signer-socket", "signer.sock", "unix socket to serve the external signer on")
+}
+
+func runSigner() {
+	masterKey, err := readMasterKey()
+	if err != nil {
+		log.WithError(err).Fatal("read master key failed")
+	}
+	key, err := kms.LoadPrivateKey(privateKeyFile, []byte(masterKey))
+	if err != nil {
+		log.WithError(err).Fatal("load private key failed")
+	}
+
+	// remove the socket left by a previous signer
+	os.Remove(signerSocket)
+	l, err := net.Listen("unix", signerSocket)
+	if err != nil {
+		log.WithError(err).Fatal("listen signer socket failed")
+	}
+	defer l.Close()
+	if err = os.Chmod(signerSocket, 0600); err != nil {
+		log.WithError(err).Fatal("chmod signer socket failed")
+	}
+
+	log.WithField("socket", signerSocket).Info("external signer started")
+	if err = kms.ServeSigner(l, key); err != nil {
+		log.WithError(err).Fatal("serve signer failed")
+	}
+}
@@ -26,8 +26,11 @@ import (
 	"os"
 	"os/user"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	sqlite3 "github.com/CovenantSQL/go-sqlite3-encrypt"
 	"github.com/xo/dburl"
@@ -39,6 +42,8 @@ import (
 
 	"github.com/CovenantSQL/CovenantSQL/client"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 )
 
@@ -60,6 +65,11 @@ var (
 	// DML variables
 	createDB   string // as a instance meta json string or simply a node count
 	dropDB     string // database id to drop
+	updateDB   string // database id to update
+	updateMeta string // as a instance meta json string or simply a node count
+	drainNodes string // comma separated node ids to move database off
+	dbStatus   string // database id to show operation status, "all" for all databases
+	queryStats string // database id to show query pattern statistics
 	getBalance bool   // get balance of current account
 )
 
@@ -189,9 +199,72 @@ func init() {
 	// DML flags
 	flag.StringVar(&createDB, "create", "", "create database, argument can be instance requirement json or simply a node count requirement")
 	flag.StringVar(&dropDB, "drop", "", "drop database, argument should be a database id (without covenantsql:// scheme is acceptable)")
+	flag.StringVar(&updateDB, "update", "", "update database, argument should be a database id (without covenantsql:// scheme is acceptable), used with -meta and -drain")
+	flag.StringVar(&updateMeta, "meta", "", "new instance requirement of database to update, argument can be instance requirement json or simply a node count requirement")
+	flag.StringVar(&drainNodes, "drain", "", "comma separated node ids to move database to update off")
+	flag.StringVar(&dbStatus, "status", "", "show peers operation status of database, argument should be a database id or \"all\"")
+	flag.StringVar(&queryStats, "query-stats", "", "show query pattern statistics of every database peer, argument should be a database id")
 	flag.BoolVar(&getBalance, "get-balance", false, "get balance of current account")
 }
 
+func toDSN(dbID string) string {
+	if _, err := client.ParseDSN(dbID); err != nil {
+		// not a dsn
+		cfg := client.NewConfig()
+		cfg.DatabaseID = dbID
+		return cfg.FormatDSN()
+	}
+	return dbID
+}
+
+func parseResourceMeta(desc string) (meta client.ResourceMeta, err error) {
+	if err = json.Unmarshal([]byte(desc), &meta); err != nil {
+		// not a instance json, try if it is a number describing node count
+		var nodeCnt uint64
+		if nodeCnt, err = strconv.ParseUint(desc, 10, 16); err != nil {
+			return
+		}
+		meta = client.ResourceMeta{Node: uint16(nodeCnt)}
+	}
+	return
+}
+
+func printOperation(op *types.DatabaseOperation) {
+	fmt.Printf("database: %s\n", op.DatabaseID)
+	fmt.Printf("  operation: %s, state: %s, term: %d\n", op.Type, op.State, op.Term)
+	if len(op.DeadNodes) > 0 {
+		fmt.Printf("  dead nodes: %v\n", op.DeadNodes)
+	}
+	for _, p := range op.NewNodes {
+		fmt.Printf("  new node: %s, synced: %v, index: %d\n", p.NodeID, p.Synced, p.Index)
+	}
+	if len(op.DrainNodes) > 0 {
+		fmt.Printf("  drain nodes: %v\n", op.DrainNodes)
+	}
+	if op.Error != "" {
+		fmt.Printf("  error: %s\n", op.Error)
+	}
+	fmt.Printf("  started: %s, updated: %s\n",
+		op.StartTime.Format(time.RFC3339), op.UpdateTime.Format(time.RFC3339))
+}
+
+func printQueryStats(nodeID proto.NodeID, stats []types.QueryStat) {
+	fmt.Printf("node: %s\n", nodeID)
+	if len(stats) == 0 {
+		fmt.Println("  no query")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  COUNT\tERRORS\tAVG\tMAX\tTOTAL\tROWS READ\tROWS WRITTEN\tQUERY")
+	for i := range stats {
+		s := &stats[i]
+		fmt.Fprintf(w, "  %d\t%d\t%s\t%s\t%s\t%d\t%d\t%s\n",
+			s.Count, s.Errors, s.AvgLatency(), s.MaxLatency, s.TotalLatency,
+			s.RowsRead, s.RowsWritten, s.Fingerprint)
+	}
+	w.Flush()
+}
+
 func main() {
 	flag.Parse()
 	if showVersion {
@@ -229,12 +302,7 @@ func main() {
 
 	if dropDB != "" {
 		// drop database
-		if _, err := client.ParseDSN(dropDB); err != nil {
-			// not a dsn
-			cfg := client.NewConfig()
-			cfg.DatabaseID = dropDB
-			dropDB = cfg.FormatDSN()
-		}
+		dropDB = toDSN(dropDB)
 
 		if err := client.Drop(dropDB); err != nil {
 			// drop database failed
@@ -247,22 +315,102 @@ func main() {
 		return
 	}
 
-	if createDB != "" {
-		// create database
-		// parse instance requirement
-		var meta client.ResourceMeta
+	if updateDB != "" {
+		// update database
+		updateDB = toDSN(updateDB)
 
-		if err := json.Unmarshal([]byte(createDB), &meta); err != nil {
-			// not a instance json, try if it is a number describing node count
-			nodeCnt, err := strconv.ParseUint(createDB, 10, 16)
-			if err != nil {
-				// still failing
-				log.WithField("db", createDB).Error("create database failed: invalid instance description")
-				os.Exit(-1)
-				return
+		meta, err := parseResourceMeta(updateMeta)
+		if err != nil {
+			log.WithField("db", updateDB).Error("update database failed: invalid instance description")
+			os.Exit(-1)
+			return
+		}
+
+		var nodes []proto.NodeID
+		for _, nodeID := range strings.Split(drainNodes, ",") {
+			if nodeID = strings.TrimSpace(nodeID); nodeID != "" {
+				nodes = append(nodes, proto.NodeID(nodeID))
 			}
+		}
 
-			meta = client.ResourceMeta{Node: uint16(nodeCnt)}
+		op, err := client.Update(updateDB, meta, nodes...)
+		if err != nil {
+			log.WithField("db", updateDB).WithError(err).Error("update database failed")
+			os.Exit(-1)
+			return
+		}
+
+		log.Infof("update database %#v started, check progress with -status", updateDB)
+		printOperation(&op)
+		return
+	}
+
+	if dbStatus != "" {
+		// show database operations
+		target := ""
+		if dbStatus != "all" {
+			target = toDSN(dbStatus)
+		}
+
+		deadNodes, ops, err := client.Operations(target)
+		if err != nil {
+			log.WithField("db", dbStatus).WithError(err).Error("get database operations failed")
+			os.Exit(-1)
+			return
+		}
+
+		if len(deadNodes) > 0 {
+			fmt.Printf("dead nodes: %v\n", deadNodes)
+		}
+		if len(ops) == 0 {
+			fmt.Println("no database operation")
+		}
+		for i := range ops {
+			printOperation(&ops[i])
+		}
+		return
+	}
+
+	if queryStats != "" {
+		// show query pattern statistics
+		queryStats = toDSN(queryStats)
+
+		stats, nodeErrs, err := client.QueryStats(queryStats)
+		if err != nil {
+			log.WithField("db", queryStats).WithError(err).Error("get query stats failed")
+			os.Exit(-1)
+			return
+		}
+
+		nodes := make([]string, 0, len(stats)+len(nodeErrs))
+		for nodeID := range stats {
+			nodes = append(nodes, string(nodeID))
+		}
+		for nodeID := range nodeErrs {
+			nodes = append(nodes, string(nodeID))
+		}
+		sort.Strings(nodes)
+		for _, nodeID := range nodes {
+			if err, ok := nodeErrs[proto.NodeID(nodeID)]; ok {
+				fmt.Printf("node: %s\n  error: %v\n", nodeID, err)
+				continue
+			}
+			printQueryStats(proto.NodeID(nodeID), stats[proto.NodeID(nodeID)])
+		}
+		if len(stats) == 0 {
+			os.Exit(-1)
+		}
+		return
+	}
+
+	if createDB != "" {
+		// create database
+		// parse instance requirement
+		meta, err := parseResourceMeta(createDB)
+		if err != nil {
+			log.WithField("db", createDB).Error("create database failed: invalid instance description")
+			os.Exit(-1)
+			return
 		}
 
 		dsn, err := client.Create(meta)
@@ -39,6 +39,10 @@ import (
 const (
 	// CmdSet is the command to set node
 	CmdSet = "set"
+	// CmdSetRecord is the command to set signed node record
+	CmdSetRecord = "set_record"
+	// CmdDelNode is the command to del node
+	CmdDelNode = "del_node"
 	// CmdSetDatabase is the command to set database
 	CmdSetDatabase = "set_database"
 	// CmdDeleteDatabase is the command to del database
@@ -52,9 +56,11 @@ type LocalStorage struct {
 }
 
 type compiledLog struct {
-	cmdType   string
-	queries   []storage.Query
-	nodeToSet *proto.Node
+	cmdType     string
+	queries     []storage.Query
+	nodeToSet   *proto.Node
+	recordToSet *proto.NodeRecord
+	nodeToDel   proto.NodeID
 }
 
 func initStorage(dbFile string) (stor *LocalStorage, err error) {
@@ -70,6 +76,9 @@ func initStorage(dbFile string) (stor *LocalStorage, err error) {
 		{
 			Pattern: "CREATE TABLE IF NOT EXISTS `databases` (`id` TEXT NOT NULL PRIMARY KEY, `meta` BLOB);",
 		},
+		{
+			Pattern: "CREATE TABLE IF NOT EXISTS `dht_records` (`id` TEXT NOT NULL PRIMARY KEY, `record` BLOB);",
+		},
 	})
 	if err != nil {
 		wd, _ := os.Getwd()
@@ -130,6 +139,33 @@ func (s *LocalStorage) Commit(req interface{}) (_ interface{}, err error) {
 		return
 	}
 
+	if cl.recordToSet != nil {
+		err = route.SetNodeRecordAddrCache(cl.recordToSet)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"id":   cl.recordToSet.Node.ID,
+				"addr": cl.recordToSet.Node.Addr,
+			}).WithError(err).Error("set node record addr cache failed")
+		}
+		err = kms.SetNode(&cl.recordToSet.Node)
+		if err != nil {
+			log.WithField("node", cl.recordToSet.Node).WithError(err).Error("kms set node failed")
+		}
+
+		if s.consistent != nil {
+			s.consistent.AddRecordCache(*cl.recordToSet)
+		}
+	}
+
+	if cl.nodeToDel != "" {
+		if err = kms.DelNode(cl.nodeToDel); err != nil {
+			log.WithField("node", cl.nodeToDel).WithError(err).Error("kms del node failed")
+		}
+		if s.consistent != nil {
+			s.consistent.RemoveCache(cl.nodeToDel)
+		}
+	}
+
 	if cl.nodeToSet != nil {
 		err = route.SetNodeAddrCache(cl.nodeToSet.ID.ToRawNodeID(), cl.nodeToSet.Addr)
 		if err != nil {
@@ -178,9 +214,67 @@ func (s *LocalStorage) compileLog(payload *KayakPayload) (result *compiledLog, e
 						sql.Named("", payload.Data),
 					},
 				},
+				{
+					// the unsigned node replaces the signed record
+					Pattern: "DELETE FROM `dht_records` WHERE `id` = ?;",
+					Args: []sql.NamedArg{
+						sql.Named("", nodeToSet.ID),
+					},
+				},
 			},
 			nodeToSet: &nodeToSet,
 		}
+	case CmdSetRecord:
+		var recordToSet proto.NodeRecord
+		if err = utils.DecodeMsgPack(payload.Data, &recordToSet); err != nil {
+			log.WithError(err).Error("compileLog: unmarshal node record from payload failed")
+			return
+		}
+		var nodeBuf *bytes.Buffer
+		if nodeBuf, err = utils.EncodeMsgPack(recordToSet.Node); err != nil {
+			log.WithError(err).Error("compileLog: marshal node of record failed")
+			return
+		}
+		result = &compiledLog{
+			cmdType: payload.Command,
+			queries: []storage.Query{
+				{
+					Pattern: "INSERT OR REPLACE INTO `dht` (`id`, `node`) VALUES (?, ?);",
+					Args: []sql.NamedArg{
+						sql.Named("", recordToSet.Node.ID),
+						sql.Named("", nodeBuf.Bytes()),
+					},
+				},
+				{
+					Pattern: "INSERT OR REPLACE INTO `dht_records` (`id`, `record`) VALUES (?, ?);",
+					Args: []sql.NamedArg{
+						sql.Named("", recordToSet.Node.ID),
+						sql.Named("", payload.Data),
+					},
+				},
+			},
+			recordToSet: &recordToSet,
+		}
+	case CmdDelNode:
+		nodeToDel := proto.NodeID(payload.Data)
+		result = &compiledLog{
+			cmdType: payload.Command,
+			queries: []storage.Query{
+				{
+					Pattern: "DELETE FROM `dht` WHERE `id` = ?;",
+					Args: []sql.NamedArg{
+						sql.Named("", nodeToDel),
+					},
+				},
+				{
+					Pattern: "DELETE FROM `dht_records` WHERE `id` = ?;",
+					Args: []sql.NamedArg{
+						sql.Named("", nodeToDel),
+					},
+				},
+			},
+			nodeToDel: nodeToDel,
+		}
 	case CmdSetDatabase:
 		var instance types.ServiceInstance
 		if err = utils.DecodeMsgPack(payload.Data, &instance); err != nil {
@@ -281,9 +375,38 @@ func (s *KayakKVServer) SetNode(node *proto.Node) (err error) {
 	return
 }
 
+// SetNodeRecord implements consistent.Persistence
+func (s *KayakKVServer) SetNodeRecord(record *proto.NodeRecord) (err error) {
+	recordBuf, err := utils.EncodeMsgPack(record)
+	if err != nil {
+		log.WithError(err).Error("marshal node record failed")
+		return
+	}
+	payload := &KayakPayload{
+		Command: CmdSetRecord,
+		Data:    recordBuf.Bytes(),
+	}
+
+	_, _, err = s.Runtime.Apply(context.Background(), payload)
+	if err != nil {
+		log.Errorf("Apply set node record failed: %#v\nPayload:\n	%#v", err, payload)
+	}
+
+	return
+}
+
 // DelNode implements consistent.Persistence
 func (s *KayakKVServer) DelNode(nodeID proto.NodeID) (err error) {
-	// no need to del node currently
+	payload := &KayakPayload{
+		Command: CmdDelNode,
+		Data:    []byte(nodeID),
+	}
+
+	_, _, err = s.Runtime.Apply(context.Background(), payload)
+	if err != nil {
+		log.Errorf("Apply del node failed: %#v\nPayload:\n	%#v", err, payload)
+	}
+
 	return
 }
 
@@ -453,3 +576,42 @@ func (s *KayakKVServer) GetAllNodeInfo() (nodes []proto.Node, err error) {
 	}
 	return
 }
+
+// GetAllNodeRecords implements consistent.Persistence
+func (s *KayakKVServer) GetAllNodeRecords() (records []proto.NodeRecord, err error) {
+	var result [][]interface{}
+	query := "SELECT `record` FROM `dht_records`;"
+	_, _, result, err = s.KVStorage.Query(context.Background(), []storage.Query{
+		{
+			Pattern: query,
+		},
+	})
+	if err != nil {
+		log.WithField("query", query).WithError(err).Error("query failed")
+		return
+	}
+
+	records = make([]proto.NodeRecord, 0, len(result))
+
+	for _, r := range result {
+		if len(r) == 0 {
+			continue
+		}
+		recordBytes, ok := r[0].([]byte)
+		if !ok {
+			continue
+		}
+
+		var record proto.NodeRecord
+		if err = utils.DecodeMsgPack(recordBytes, &record); err != nil {
+			log.WithError(err).Error("unmarshal node record failed")
+			continue
+		}
+		records = append(records, record)
+	}
+
+	if len(records) > 0 {
+		err = nil
+	}
+	return
+}
@@ -77,6 +77,11 @@ func runNode(nodeID proto.NodeID, listenAddr string) (err error) {
 		return
 	}
 
+	if err = route.InitACL(); err != nil {
+		log.WithError(err).Error("init acl policy failed")
+		return
+	}
+
 	var server *rpc.Server
 
 	// create server
@@ -126,6 +131,32 @@ func runNode(nodeID proto.NodeID, listenAddr string) (err error) {
 		return
 	}
 
+	// prune the expired node records from DHT
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go dht.RunRecordPruner(route.DefaultRecordPruneInterval, stopCh)
+
+	// block producers serve the kademlia routing as the bootstrap nodes
+	log.Info("register kademlia service rpc")
+	route.InitRoutingTable(nodeID.ToRawNodeID())
+	if err = server.RegisterService(route.KademliaRPCName, route.NewKademliaService()); err != nil {
+		log.WithError(err).Error("register kademlia service failed")
+		return
+	}
+
+	// answer the bootstrap discovery queries from the local network
+	for _, p := range conf.GConf.DNSSeed.Providers {
+		if p == route.MulticastBootstrapProvider {
+			log.Info("serve multicast bootstrap discovery")
+			if err = route.ServeMulticast(
+				conf.GConf.DNSSeed.MulticastAddr, rpc.LocalNodeRecord, stopCh); err != nil {
+				log.WithError(err).Error("serve multicast bootstrap discovery failed")
+				return
+			}
+			break
+		}
+	}
+
 	// init metrics
 	log.Info("register metric service rpc")
 	metricService := metric.NewCollectServer()
@@ -145,6 +176,12 @@ func runNode(nodeID proto.NodeID, listenAddr string) (err error) {
 		log.WithError(err).Error("init block producer db service failed")
 		return
 	}
+	defer dbService.Stop()
+	if conf.GConf.BP.MinerDeadTimeout > 0 && peers.Leader == nodeID {
+		// Only the leader judges the miner liveness and starts repairs, the metrics are not
+		// replicated, so the followers would see different miners dead and race the repairs.
+		dbService.StartHealthMonitor(conf.GConf.BP.MinerDeadTimeout, bp.DefaultHealthCheckInterval)
+	}
 
 	// init main chain service
 	log.Info("register main chain service rpc")
@@ -252,11 +289,18 @@ func initDBService(kvServer *KayakKVServer, metricService *metric.CollectServer)
 		return
 	}
 
+	var antiAffinity bp.AntiAffinity
+	if antiAffinity, err = bp.ParseAntiAffinity(conf.GConf.BP.AntiAffinity); err != nil {
+		log.WithError(err).Error("parse database placement anti-affinity failed")
+		return
+	}
+
 	dbService = &bp.DBService{
 		AllocationRounds: bp.DefaultAllocationRounds, //
 		ServiceMap:       serviceMap,
 		Consistent:       kvServer.KVStorage.consistent,
 		NodeMetrics:      &metricService.NodeMetric,
+		AntiAffinity:     antiAffinity,
 	}
 
 	return
@@ -26,9 +26,9 @@ import (
 )
 
 func initNodePeers(nodeID proto.NodeID, publicKeystorePath string) (nodes *[]proto.Node, peers *proto.Peers, thisNode *proto.Node, err error) {
-	privateKey, err := kms.GetLocalPrivateKey()
+	privateKey, err := kms.GetLocalSigner()
 	if err != nil {
-		log.WithError(err).Fatal("get local private key failed")
+		log.WithError(err).Fatal("get local signer failed")
 	}
 
 	peers = &proto.Peers{
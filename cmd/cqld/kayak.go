@@ -40,5 +40,5 @@ func NewKayakService(server *rpc.Server, serviceName string, rt *kayak.Runtime)
 
 // Call handles kayak call.
 func (s *KayakService) Call(req *kt.RPCRequest, _ *interface{}) (err error) {
-	return s.rt.FollowerApply(req.Log)
+	return s.rt.FollowerApplyWithContext(req.GetContext(), req.Log)
 }
@@ -27,8 +27,10 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/metric"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/CovenantSQL/CovenantSQL/utils/trace"
 )
 
 const logo = `
@@ -50,6 +52,7 @@ var (
 	// profile
 	cpuProfile string
 	memProfile string
+	metricWeb  string
 
 	// other
 	noLogo      bool
@@ -73,6 +76,7 @@ func init() {
 
 	flag.StringVar(&cpuProfile, "cpu-profile", "", "Path to file for CPU profiling information")
 	flag.StringVar(&memProfile, "mem-profile", "", "Path to file for memory profiling information")
+	flag.StringVar(&metricWeb, "metric-web", "", "Address to serve prometheus metrics on /metrics, default not started")
 
 	flag.BoolVar(&clientMode, "client", false, "run as client")
 	flag.StringVar(&clientOperation, "operation", "FindNeighbor", "client operation")
@@ -137,6 +141,19 @@ func main() {
 		return
 	}
 
+	if conf.GConf.Tracing != nil {
+		if err := trace.Start(name, conf.GConf.Tracing); err != nil {
+			log.WithError(err).Fatal("start tracing failed")
+		}
+		defer trace.Stop()
+	}
+
+	if len(metricWeb) > 0 {
+		if _, err := metric.StartMetricWeb(metricWeb); err != nil {
+			log.WithError(err).Fatal("start metric web failed")
+		}
+	}
+
 	if err := runNode(conf.GConf.ThisNodeID, conf.GConf.ListenAddr); err != nil {
 		log.WithError(err).Fatal("run kayak failed")
 	}
@@ -26,6 +26,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/CovenantSQL/CovenantSQL/utils/trace"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -82,6 +83,11 @@ type BPInfo struct {
 	ChainFileName string `yaml:"ChainFileName"`
 	// BPGenesis is the genesis block filed
 	BPGenesis BPGenesisInfo `yaml:"BPGenesisInfo,omitempty"`
+	// AntiAffinity is the replica anti-affinity policy of database placement: none, host or subnet
+	AntiAffinity string `yaml:"AntiAffinity,omitempty"`
+	// MinerDeadTimeout is the metric upload silence to mark a miner dead and replace it in the
+	// databases it serves, checked by the leader block producer only, disabled if not set
+	MinerDeadTimeout time.Duration `yaml:"MinerDeadTimeout,omitempty"`
 }
 
 // MinerDatabaseFixture config.
@@ -101,15 +107,80 @@ type MinerInfo struct {
 	MaxReqTimeGap         time.Duration `yaml:"MaxReqTimeGap,omitempty"`
 	MetricCollectInterval time.Duration `yaml:"MetricCollectInterval,omitempty"`
 
+	// query statistics config, statements which take longer than SlowQueryThreshold are
+	// appended to SlowQueryLogFile if set.
+	MaxQueryPatterns   int           `yaml:"MaxQueryPatterns,omitempty"`
+	SlowQueryLogFile   string        `yaml:"SlowQueryLogFile,omitempty"`
+	SlowQueryThreshold time.Duration `yaml:"SlowQueryThreshold,omitempty"`
+
 	// when test mode, fixture database config is used.
 	IsTestMode   bool                    `yaml:"IsTestMode,omitempty"`
 	TestFixtures []*MinerDatabaseFixture `yaml:"TestFixtures,omitempty"`
 }
 
-// DNSSeed defines seed DNS info.
+// DNSSeed defines seed DNS info and the bootstrap providers to discover block producers.
 type DNSSeed struct {
 	EnforcedDNSSEC bool     `yaml:"EnforcedDNSSEC"`
 	DNSServers     []string `yaml:"DNSServers"`
+
+	// Providers are the bootstrap providers tried in order until one succeeds: dns, file or
+	// multicast, only dns is used if not set.
+	Providers []string `yaml:"Providers,omitempty"`
+	// SeedFile is the signed seed list file of the file provider.
+	SeedFile string `yaml:"SeedFile,omitempty"`
+	// TrustedKeys are the public keys accepted to sign the seed list.
+	TrustedKeys []*asymmetric.PublicKey `yaml:"TrustedKeys,omitempty"`
+	// MulticastAddr is the LAN multicast group of the multicast provider.
+	MulticastAddr string `yaml:"MulticastAddr,omitempty"`
+	// MulticastTimeout is the time to wait for the block producers to reply.
+	MulticastTimeout time.Duration `yaml:"MulticastTimeout,omitempty"`
+}
+
+// RateLimit defines a token bucket rate limit.
+type RateLimit struct {
+	// Rate is the number of calls allowed per second.
+	Rate float64 `yaml:"Rate"`
+	// Burst is the number of calls allowed at once.
+	Burst int `yaml:"Burst"`
+}
+
+// RPCLimits defines the resource limits of the RPC server, a zero value disables the limit.
+type RPCLimits struct {
+	// MaxSessionsPerNode limits the connections from a single remote node, anonymous
+	// connections are limited per remote IP.
+	MaxSessionsPerNode int `yaml:"MaxSessionsPerNode,omitempty"`
+	// MaxStreamsPerSession limits the concurrent streams of a connection.
+	MaxStreamsPerSession int `yaml:"MaxStreamsPerSession,omitempty"`
+	// MaxConcurrentCalls limits the concurrent calls of the server, calls to the
+	// PriorityMethods are not counted nor limited.
+	MaxConcurrentCalls int `yaml:"MaxConcurrentCalls,omitempty"`
+	// PriorityMethods lists the methods served regardless of the server load, such as
+	// "Kayak.Call", a "Service.*" pattern matches all methods of the service.
+	PriorityMethods []string `yaml:"PriorityMethods,omitempty"`
+	// MethodRateLimits maps service methods to their rate limit.
+	MethodRateLimits map[string]RateLimit `yaml:"MethodRateLimits,omitempty"`
+}
+
+// ACLRule defines a rule of the RPC access policy, empty criteria match any call.
+type ACLRule struct {
+	// Effect is "allow" or "deny".
+	Effect string `yaml:"Effect"`
+	// Roles of the caller: Anonymous, BlockProducer, Miner, Client or Unknown.
+	Roles []string `yaml:"Roles,omitempty"`
+	// NodeIDs limits the rule to these callers, ExceptNodeIDs excludes callers from it.
+	NodeIDs       []proto.NodeID `yaml:"NodeIDs,omitempty"`
+	ExceptNodeIDs []proto.NodeID `yaml:"ExceptNodeIDs,omitempty"`
+	// Databases limits the rule to calls targeting these databases.
+	Databases []proto.DatabaseID `yaml:"Databases,omitempty"`
+	// Methods are "Service.Method" names, a "Service.*" pattern matches all methods of
+	// the service and "*" any method.
+	Methods []string `yaml:"Methods,omitempty"`
+}
+
+// ACLPolicy defines the RPC access policy, the first rule matching a call decides and calls
+// matching no rule are denied.
+type ACLPolicy struct {
+	Rules []ACLRule `yaml:"Rules"`
 }
 
 // Config holds all the config read from yaml config file.
@@ -126,6 +197,29 @@ type Config struct {
 	ValidDNSKeys    map[string]string `yaml:"ValidDNSKeys"` // map[DNSKEY]domain
 	// Check By BP DHT.Ping
 	MinNodeIDDifficulty int `yaml:"MinNodeIDDifficulty"`
+	// MinerNodeIDDifficulty and BPNodeIDDifficulty are the stricter NodeID difficulties
+	// required from miners and block producers, checked on connection accept.
+	MinerNodeIDDifficulty int `yaml:"MinerNodeIDDifficulty,omitempty"`
+	BPNodeIDDifficulty    int `yaml:"BPNodeIDDifficulty,omitempty"`
+	// MinETLSVersion is the lowest ETLS version accepted from and used with peers,
+	// set to 2 once all nodes are upgraded to disable the v1 fallback.
+	MinETLSVersion int `yaml:"MinETLSVersion,omitempty"`
+	// MaxETLSVersion is the highest ETLS version accepted from and used with peers,
+	// set to 1 on upgraded nodes while nodes without ETLS v2 are still running.
+	MaxETLSVersion int `yaml:"MaxETLSVersion,omitempty"`
+	// RPCLimits overrides the default limits of the RPC server.
+	RPCLimits *RPCLimits `yaml:"RPCLimits,omitempty"`
+	// ACL overrides the default RPC access policy, ACLPolicyFile takes precedence and
+	// is reloaded on change. Denied calls are appended to ACLAuditLogFile if set.
+	ACL             *ACLPolicy `yaml:"ACL,omitempty"`
+	ACLPolicyFile   string     `yaml:"ACLPolicyFile,omitempty"`
+	ACLAuditLogFile string     `yaml:"ACLAuditLogFile,omitempty"`
+	// SignerSocket is the unix socket of an external signer process holding the private
+	// key, PrivateKeyFile is not loaded if set.
+	SignerSocket string `yaml:"SignerSocket,omitempty"`
+	// Tracing enables the distributed tracing, spans are exported to the file or the
+	// collector endpoint.
+	Tracing *trace.Config `yaml:"Tracing,omitempty"`
 
 	DNSSeed DNSSeed `yaml:"DNSSeed"`
 
@@ -162,6 +256,10 @@ func LoadConfig(configPath string) (config *Config, err error) {
 		config.PrivateKeyFile = path.Join(configDir, config.PrivateKeyFile)
 	}
 
+	if config.SignerSocket != "" && !path.IsAbs(config.SignerSocket) {
+		config.SignerSocket = path.Join(configDir, config.SignerSocket)
+	}
+
 	if !path.IsAbs(config.DHTFileName) {
 		config.DHTFileName = path.Join(configDir, config.DHTFileName)
 	}
@@ -177,5 +275,17 @@ func LoadConfig(configPath string) (config *Config, err error) {
 	if config.Miner != nil && !path.IsAbs(config.Miner.RootDir) {
 		config.Miner.RootDir = path.Join(configDir, config.Miner.RootDir)
 	}
+
+	if config.Miner != nil && config.Miner.SlowQueryLogFile != "" && !path.IsAbs(config.Miner.SlowQueryLogFile) {
+		config.Miner.SlowQueryLogFile = path.Join(configDir, config.Miner.SlowQueryLogFile)
+	}
+
+	if config.ACLPolicyFile != "" && !path.IsAbs(config.ACLPolicyFile) {
+		config.ACLPolicyFile = path.Join(configDir, config.ACLPolicyFile)
+	}
+
+	if config.ACLAuditLogFile != "" && !path.IsAbs(config.ACLAuditLogFile) {
+		config.ACLAuditLogFile = path.Join(configDir, config.ACLAuditLogFile)
+	}
 	return
 }
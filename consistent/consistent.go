@@ -37,6 +37,7 @@ import (
 	"sort"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
@@ -61,6 +62,12 @@ var (
 	ErrEmptyCircle = errors.New("empty circle")
 	// ErrKeyNotFound is the error returned when no key in circle
 	ErrKeyNotFound = errors.New("node key not found")
+	// ErrStaleNodeRecord is the error returned when the node record is not newer than the stored one.
+	ErrStaleNodeRecord = errors.New("node record is not newer than the stored one")
+	// ErrNodeRecordExpired is the error returned when adding an expired node record.
+	ErrNodeRecordExpired = errors.New("node record expired")
+	// ErrNodeRecordInFuture is the error returned when adding a node record signed in the future.
+	ErrNodeRecordInFuture = errors.New("node record timestamp is in the future")
 )
 
 // Consistent holds the information about the members of the consistent hash circle.
@@ -68,6 +75,8 @@ type Consistent struct {
 	// TODO(auxten): do not store node info on circle, just put node id as value
 	// and put node info into kms
 	circle map[proto.NodeKey]*proto.Node
+	// records holds the node records, the nodes added without a record never expire
+	records map[proto.NodeID]*proto.NodeRecord
 	//members          map[proto.NodeID]proto.Node
 	sortedHashes     NodeKeys
 	NumberOfReplicas int
@@ -93,6 +102,7 @@ func InitConsistent(storePath string, persistImpl Persistence, initBP bool) (c *
 		//TODO(auxten): reduce NumberOfReplicas
 		NumberOfReplicas: 20,
 		circle:           make(map[proto.NodeKey]*proto.Node),
+		records:          make(map[proto.NodeID]*proto.NodeRecord),
 		persist:          persistImpl,
 	}
 
@@ -121,6 +131,16 @@ func InitConsistent(storePath string, persistImpl Persistence, initBP bool) (c *
 		}
 	}
 
+	// the expired records are loaded as well and removed by the next PruneExpired
+	records, err := c.persist.GetAllNodeRecords()
+	if err != nil {
+		log.WithError(err).Error("get all node records failed")
+		return
+	}
+	for _, r := range records {
+		c.AddRecordCache(r)
+	}
+
 	return
 }
 
@@ -138,6 +158,59 @@ func (c *Consistent) Add(node proto.Node) (err error) {
 	return c.add(node)
 }
 
+// AddRecord inserts the node of a verified node record in the consistent hash, the record is
+// stored only if it's newer than the stored one.
+func (c *Consistent) AddRecord(record *proto.NodeRecord) (err error) {
+	log.WithFields(log.Fields{
+		"node": record.Node,
+		"seq":  record.Seq,
+	}).Debug("add node record to consistent ring")
+	now := time.Now()
+	if record.IsInFuture(now) {
+		return ErrNodeRecordInFuture
+	}
+	if record.IsExpired(now) {
+		return ErrNodeRecordExpired
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if prev, err := c.GetNodeRecord(record.Node.ID); err == nil && !record.IsNewerThan(prev) {
+		return ErrStaleNodeRecord
+	}
+	if err = c.persist.SetNodeRecord(record); err != nil {
+		log.WithField("node", record.Node).WithError(err).Error("set node record failed")
+		return
+	}
+
+	c.AddRecordCache(*record)
+	return
+}
+
+// AddUnsigned inserts a node in the consistent hash with an unsigned record, the node expires
+// ttl later like a node with a signed record and is removed by PruneExpired. The unsigned
+// record has sequence 0, it's superseded by any later signed record of the node.
+func (c *Consistent) AddUnsigned(node proto.Node, ttl time.Duration) (err error) {
+	log.WithField("node", node).Debug("add unsigned node to consistent ring")
+	record := &proto.NodeRecord{
+		NodeRecordHeader: proto.NodeRecordHeader{
+			Node:      node,
+			Timestamp: time.Now().UTC(),
+			TTL:       ttl,
+		},
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if err = c.persist.SetNodeRecord(record); err != nil {
+		log.WithField("node", node).WithError(err).Error("set unsigned node record failed")
+		return
+	}
+
+	c.AddRecordCache(*record)
+	return
+}
+
 // Remove removes an node from the hash.
 func (c *Consistent) Remove(nodeID proto.NodeID) (err error) {
 	c.Lock()
@@ -185,17 +258,34 @@ func (c *Consistent) add(node proto.Node) (err error) {
 	return
 }
 
-// AddCache only adds c.circle skips persist.
+// AddCache only adds c.circle skips persist, the signed record of the node is dropped as the
+// node is set without a record.
 func (c *Consistent) AddCache(node proto.Node) {
 	c.cacheLock.Lock()
 	defer c.cacheLock.Unlock()
 
+	delete(c.records, node.ID)
+	c.addCache(node)
+}
+
+// AddRecordCache only adds the node record to c.circle skips persist.
+func (c *Consistent) AddRecordCache(record proto.NodeRecord) {
+	c.cacheLock.Lock()
+	defer c.cacheLock.Unlock()
+
+	c.records[record.Node.ID] = &record
+	c.addCache(record.Node)
+}
+
+// need c.cacheLock.Lock() before calling
+func (c *Consistent) addCache(node proto.Node) {
+	if _, exists := c.circle[hashKey(c.nodeKey(node.ID, 0))]; !exists {
+		c.count++
+	}
 	for i := 0; i < c.NumberOfReplicas; i++ {
 		c.circle[hashKey(c.nodeKey(node.ID, i))] = &node
 	}
 	c.updateSortedHashes()
-	c.count++
-	return
 }
 
 // RemoveCache removes an node from the hash cache.
@@ -203,19 +293,51 @@ func (c *Consistent) RemoveCache(nodeID proto.NodeID) {
 	c.cacheLock.Lock()
 	defer c.cacheLock.Unlock()
 
+	if _, exists := c.circle[hashKey(c.nodeKey(nodeID, 0))]; !exists {
+		return
+	}
 	for i := 0; i < c.NumberOfReplicas; i++ {
 		delete(c.circle, hashKey(c.nodeKey(nodeID, i)))
 	}
+	delete(c.records, nodeID)
 	c.updateSortedHashes()
 	c.count--
 }
 
+// PruneExpired removes the nodes whose records are expired at the time, returns the
+// removed node ids. The node is kept if the persistence fails to delete it, e.g. on a kayak
+// follower, which is removed later by the replicated deletion.
+func (c *Consistent) PruneExpired(now time.Time) (pruned []proto.NodeID) {
+	c.Lock()
+	defer c.Unlock()
+
+	var expired []proto.NodeID
+	c.cacheLock.RLock()
+	for id, r := range c.records {
+		if r.IsExpired(now) {
+			expired = append(expired, id)
+		}
+	}
+	c.cacheLock.RUnlock()
+
+	for _, id := range expired {
+		if err := c.persist.DelNode(id); err != nil {
+			log.WithField("node", id).WithError(err).Warning("del expired node failed")
+			continue
+		}
+		c.RemoveCache(id)
+		pruned = append(pruned, id)
+	}
+	return
+}
+
 // ResetCache removes all node from the hash cache.
 func (c *Consistent) ResetCache() {
 	c.cacheLock.Lock()
 	defer c.cacheLock.Unlock()
 
 	c.circle = make(map[proto.NodeKey]*proto.Node)
+	c.records = make(map[proto.NodeID]*proto.NodeRecord)
 	c.count = 0
 	c.sortedHashes = NodeKeys{}
 }
@@ -249,6 +371,19 @@ func (c *Consistent) GetNode(name string) (*proto.Node, error) {
 	return nil, ErrKeyNotFound
 }
 
+// GetNodeRecord returns the node record by its node id, the record is unsigned if the node is
+// added by AddUnsigned.
+func (c *Consistent) GetNodeRecord(nodeID proto.NodeID) (*proto.NodeRecord, error) {
+	c.cacheLock.RLock()
+	defer c.cacheLock.RUnlock()
+
+	r, ok := c.records[nodeID]
+	if ok {
+		return r, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
 func (c *Consistent) search(key proto.NodeKey) (i int) {
 	f := func(x int) bool {
 		//return c.sortedHashes[x] > key
@@ -98,6 +98,141 @@ func TestAdd(t *testing.T) {
 	}
 }
 
+func TestAddRecord(t *testing.T) {
+	kms.Unittest = true
+	os.Remove(testStorePath)
+	kms.ResetBucket()
+	kms.ResetNodeRecords()
+
+	x, _ := InitConsistent(testStorePath, new(KMSStorage), false)
+	defer os.Remove(testStorePath)
+	now := time.Now()
+	record := &NodeRecord{
+		NodeRecordHeader: NodeRecordHeader{
+			Node:      NewNodeFromString("0000000000000000000000000000000000000000000000000000000000000000"),
+			Seq:       2,
+			Timestamp: now,
+			TTL:       time.Minute,
+		},
+	}
+	if err := x.AddRecord(record); err != nil {
+		t.Fatal(err)
+	}
+	CheckNum(len(x.circle), x.NumberOfReplicas, t)
+	CheckNum(int(x.count), 1, t)
+
+	// older or equal sequence is rejected
+	stale := *record
+	stale.Node.Addr = "stale"
+	if err := x.AddRecord(&stale); err != ErrStaleNodeRecord {
+		t.Errorf("expected stale record error, got %v", err)
+	}
+	stale.Seq = 1
+	if err := x.AddRecord(&stale); err != ErrStaleNodeRecord {
+		t.Errorf("expected stale record error, got %v", err)
+	}
+
+	// expired record is rejected
+	expired := *record
+	expired.Seq = 3
+	expired.Timestamp = now.Add(-2 * time.Minute)
+	if err := x.AddRecord(&expired); err != ErrNodeRecordExpired {
+		t.Errorf("expected expired record error, got %v", err)
+	}
+
+	// record signed in the future is rejected
+	future := *record
+	future.Seq = 3
+	future.Timestamp = now.Add(MaxNodeRecordClockSkew + time.Hour)
+	if err := x.AddRecord(&future); err != ErrNodeRecordInFuture {
+		t.Errorf("expected future record error, got %v", err)
+	}
+
+	newer := *record
+	newer.Seq = 3
+	newer.Node.Addr = "newer"
+	if err := x.AddRecord(&newer); err != nil {
+		t.Fatal(err)
+	}
+	CheckNum(int(x.count), 1, t)
+	if n, err := x.GetNode(string(record.Node.ID)); err != nil || n.Addr != "newer" {
+		t.Errorf("expected newer address, got %v %v", n, err)
+	}
+
+	// the persisted records are loaded
+	records, err := kms.GetAllNodeRecords()
+	if err != nil || len(records) != 1 || records[0].Seq != 3 {
+		t.Errorf("unexpected persisted records %v %v", records, err)
+	}
+
+	// nodes without record never expire
+	x.Add(NewNodeFromString("3333333333333333333333333333333333333333333333333333333333333333"))
+	if pruned := x.PruneExpired(now.Add(time.Second)); len(pruned) != 0 {
+		t.Errorf("unexpected pruned nodes %v", pruned)
+	}
+	pruned := x.PruneExpired(now.Add(time.Hour))
+	if len(pruned) != 1 || pruned[0] != record.Node.ID {
+		t.Errorf("unexpected pruned nodes %v", pruned)
+	}
+	CheckNum(len(x.circle), x.NumberOfReplicas, t)
+	CheckNum(int(x.count), 1, t)
+	if _, err := x.GetNodeRecord(record.Node.ID); err != ErrKeyNotFound {
+		t.Errorf("expected record removed, got %v", err)
+	}
+	if records, _ := kms.GetAllNodeRecords(); len(records) != 0 {
+		t.Errorf("expected persisted record removed, got %v", records)
+	}
+}
+
+func TestAddUnsigned(t *testing.T) {
+	kms.Unittest = true
+	os.Remove(testStorePath)
+	kms.ResetBucket()
+	kms.ResetNodeRecords()
+
+	x, _ := InitConsistent(testStorePath, new(KMSStorage), false)
+	defer os.Remove(testStorePath)
+	now := time.Now()
+	node := NewNodeFromString("0000000000000000000000000000000000000000000000000000000000000000")
+	if err := x.AddUnsigned(node, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	CheckNum(int(x.count), 1, t)
+	if r, err := x.GetNodeRecord(node.ID); err != nil || r.IsSigned() {
+		t.Errorf("expected unsigned record, got %v %v", r, err)
+	}
+	if records, _ := kms.GetAllNodeRecords(); len(records) != 1 {
+		t.Errorf("expected persisted unsigned record, got %v", records)
+	}
+
+	// unsigned node expires like a signed record
+	if pruned := x.PruneExpired(now.Add(time.Second)); len(pruned) != 0 {
+		t.Errorf("unexpected pruned nodes %v", pruned)
+	}
+	pruned := x.PruneExpired(now.Add(time.Hour))
+	if len(pruned) != 1 || pruned[0] != node.ID {
+		t.Errorf("unexpected pruned nodes %v", pruned)
+	}
+	CheckNum(int(x.count), 0, t)
+
+	// signed record supersedes the unsigned one
+	x.AddUnsigned(node, time.Minute)
+	record := &NodeRecord{
+		NodeRecordHeader: NodeRecordHeader{
+			Node:      node,
+			Seq:       1,
+			Timestamp: now,
+			TTL:       time.Minute,
+		},
+	}
+	if err := x.AddRecord(record); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := x.GetNodeRecord(node.ID); err != nil || r.Seq != 1 {
+		t.Errorf("expected signed record, got %v %v", r, err)
+	}
+}
+
 func TestRemove(t *testing.T) {
 	kms.Unittest = true
 	os.Remove(testStorePath)
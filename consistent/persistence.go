@@ -26,9 +26,11 @@ import (
 type Persistence interface {
 	Init(storePath string, initNode []proto.Node) (err error)
 	SetNode(node *proto.Node) (err error)
+	SetNodeRecord(record *proto.NodeRecord) (err error)
 	DelNode(nodeID proto.NodeID) (err error)
 	Reset() error
 	GetAllNodeInfo() (nodes []proto.Node, err error)
+	GetAllNodeRecords() (records []proto.NodeRecord, err error)
 }
 
 // KMSStorage implements Persistence
@@ -41,17 +43,34 @@ func (s *KMSStorage) Init(storePath string, initNodes []proto.Node) (err error)
 
 // SetNode implements Persistence interface
 func (s *KMSStorage) SetNode(node *proto.Node) (err error) {
-	return kms.SetNode(node)
+	if err = kms.SetNode(node); err != nil {
+		return
+	}
+	return kms.DelNodeRecord(node.ID)
+}
+
+// SetNodeRecord implements Persistence interface
+func (s *KMSStorage) SetNodeRecord(record *proto.NodeRecord) (err error) {
+	if err = kms.SetNode(&record.Node); err != nil {
+		return
+	}
+	return kms.SetNodeRecord(record)
 }
 
 // DelNode implements Persistence interface
 func (s *KMSStorage) DelNode(nodeID proto.NodeID) (err error) {
-	return kms.DelNode(nodeID)
+	if err = kms.DelNode(nodeID); err != nil {
+		return
+	}
+	return kms.DelNodeRecord(nodeID)
 }
 
 // Reset implements Persistence interface
 func (s *KMSStorage) Reset() (err error) {
-	return kms.ResetBucket()
+	if err = kms.ResetBucket(); err != nil {
+		return
+	}
+	return kms.ResetNodeRecords()
 }
 
 // GetAllNodeInfo implements Persistence interface
@@ -74,3 +93,8 @@ func (s *KMSStorage) GetAllNodeInfo() (nodes []proto.Node, err error) {
 	}
 	return
 }
+
+// GetAllNodeRecords implements Persistence interface
+func (s *KMSStorage) GetAllNodeRecords() (records []proto.NodeRecord, err error) {
+	return kms.GetAllNodeRecords()
+}
@@ -0,0 +1,26 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package asymmetric
+
+// Signer is the interface implemented by an object that signs hashes with a private key, the key
+// itself may be kept outside of the process by an external signer.
+type Signer interface {
+	PubKey() *PublicKey
+	Sign(hash []byte) (*Signature, error)
+}
+
+var _ Signer = (*PrivateKey)(nil)
@@ -22,6 +22,7 @@ package etls
 import (
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/proto"
@@ -33,17 +34,64 @@ type CryptoConn struct {
 	net.Conn
 	*Cipher
 	NodeID *proto.RawNodeID
+
+	isClient      bool
+	needHandshake bool
+	minVersion    int
+	maxVersion    int
+	handshakeOnce sync.Once
+	handshakeErr  error
+	version       int
+	record        *recordLayer
 }
 
-// NewConn returns a new CryptoConn
+// NewConn returns a new CryptoConn speaking ETLS v1
 func NewConn(c net.Conn, cipher *Cipher, nodeID *proto.RawNodeID) *CryptoConn {
 	return &CryptoConn{
-		Conn:   c,
-		Cipher: cipher,
-		NodeID: nodeID,
+		Conn:    c,
+		Cipher:  cipher,
+		NodeID:  nodeID,
+		version: Version1,
+	}
+}
+
+// NewClientConn returns a new client side CryptoConn speaking ETLS 'version'.
+func NewClientConn(c net.Conn, cipher *Cipher, nodeID *proto.RawNodeID, version int) *CryptoConn {
+	if version < Version2 {
+		return NewConn(c, cipher, nodeID)
+	}
+	return &CryptoConn{
+		Conn:          c,
+		Cipher:        cipher,
+		NodeID:        nodeID,
+		isClient:      true,
+		needHandshake: true,
+	}
+}
+
+// NewServerConn returns a new server side CryptoConn, the ETLS version is detected from
+// the first bytes sent by the client. Clients older than 'minVersion' are rejected, v2
+// clients are sent an explicit version reject if 'maxVersion' is 1.
+func NewServerConn(c net.Conn, cipher *Cipher, nodeID *proto.RawNodeID, minVersion int, maxVersion int) *CryptoConn {
+	return &CryptoConn{
+		Conn:          c,
+		Cipher:        cipher,
+		NodeID:        nodeID,
+		needHandshake: true,
+		minVersion:    minVersion,
+		maxVersion:    maxVersion,
 	}
 }
 
+// Version runs the handshake if needed and returns the negotiated ETLS version,
+// or 0 if the handshake failed.
+func (c *CryptoConn) Version() int {
+	if c.Handshake() != nil {
+		return 0
+	}
+	return c.version
+}
+
 // Dial connects to a address with a Cipher
 // address should be in the form of host:port
 func Dial(network, address string, cipher *Cipher) (c *CryptoConn, err error) {
@@ -62,8 +110,14 @@ func (c *CryptoConn) RawRead(b []byte) (n int, err error) {
 	return c.Conn.Read(b)
 }
 
-// Read iv and Encrypted data
+// Read iv and Encrypted data, or the next v2 record
 func (c *CryptoConn) Read(b []byte) (n int, err error) {
+	if err = c.Handshake(); err != nil {
+		return
+	}
+	if c.record != nil {
+		return c.record.read(c.Conn, b)
+	}
 	if c.decStream == nil {
 		iv := make([]byte, c.info.ivLen)
 		if _, err = io.ReadFull(c.Conn, iv); err != nil {
@@ -95,8 +149,14 @@ func (c *CryptoConn) RawWrite(b []byte) (n int, err error) {
 	return c.Conn.Read(b)
 }
 
-// Write iv and Encrypted data
+// Write iv and Encrypted data, or v2 records
 func (c *CryptoConn) Write(b []byte) (n int, err error) {
+	if err = c.Handshake(); err != nil {
+		return
+	}
+	if c.record != nil {
+		return c.record.write(c.Conn, b)
+	}
 	var iv []byte
 	if c.encStream == nil {
 		iv, err = c.initEncrypt()
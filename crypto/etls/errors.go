@@ -0,0 +1,34 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package etls
+
+import "errors"
+
+var (
+	// ErrHandshakeFailed indicates the peers failed to agree on the session keys,
+	// usually because they don't share the same static key.
+	ErrHandshakeFailed = errors.New("etls handshake failed")
+	// ErrVersionNotSupported indicates the peer doesn't speak the requested ETLS version.
+	ErrVersionNotSupported = errors.New("etls version not supported by peer")
+	// ErrRecordTooLarge indicates a record length exceeding the protocol limit.
+	ErrRecordTooLarge = errors.New("etls record too large")
+	// ErrRecordAuthFailed indicates a record failed the AEAD authentication, the
+	// data is tampered, reordered or replayed.
+	ErrRecordAuthFailed = errors.New("etls record authentication failed")
+	// ErrSequenceOverflow indicates the record sequence number is exhausted.
+	ErrSequenceOverflow = errors.New("etls record sequence overflow")
+)
@@ -0,0 +1,228 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package etls
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+)
+
+// ETLS protocol versions.
+const (
+	// Version1 is the AES-CFB stream keyed by the static ECDH secret of the node keys.
+	Version1 = 1
+	// Version2 adds an ephemeral ECDH exchange for forward secrecy and the AEAD record layer.
+	Version2 = 2
+)
+
+// ETLS v2 handshake:
+//
+//   client -> server: magic | client ephemeral public key
+//   server -> client: magic | server ephemeral public key | finished
+//
+// The magic takes the place of the v1 IV, a v2 server receiving anything else treats
+// it as the IV of a v1 client. A server limited to v1 answers the hello with the reject
+// magic, which is reported to the client as ErrVersionNotSupported and is the only case
+// a client falls back to v1. Transport errors during the handshake are returned as is,
+// so a peer dropping the connection could not downgrade the session. Nodes predating
+// v2 never send the reject, peers are limited to v1 by MaxETLSVersion until all nodes
+// are upgraded.
+//
+// Session keys are derived from the static key, the ephemeral ECDH secret and the
+// hash of the handshake messages. The finished MAC proves the server owns the same
+// static key, so a client never sends data to a server without the node key.
+
+const (
+	// ephPubKeyLen is the length of a compressed secp256k1 public key.
+	ephPubKeyLen = 33
+	// finishedLen is the length of the HMAC-SHA256 finished message.
+	finishedLen = sha256.Size
+	// sessionKeyLen is the AES-256 key length of each direction.
+	sessionKeyLen = 32
+	// handshakeTimeout bounds the client and server handshakes.
+	handshakeTimeout = 10 * time.Second
+)
+
+var (
+	// v2Magic opens the v2 client hello, it is the same length as the v1 IV.
+	v2Magic = []byte("\x00\x00CQL-ETLS-V2\x00\x00\x00")
+	// v2Reject is sent instead of the server hello by servers limited to v1.
+	v2Reject = []byte("\x00\x00CQL-ETLS-RJ\x00\x00\x00")
+)
+
+// sessionKeys are the traffic keys of a v2 session.
+type sessionKeys struct {
+	clientKey   []byte
+	serverKey   []byte
+	clientSalt  []byte
+	serverSalt  []byte
+	finishedKey []byte
+}
+
+func deriveSessionKeys(staticKey, ephSecret, transcript []byte) *sessionKeys {
+	hSuite := &hash.HashSuite{
+		HashLen:  hash.HashBSize,
+		HashFunc: hash.DoubleHashB,
+	}
+	transcriptHash := sha256.Sum256(transcript)
+	raw := make([]byte, 0, len(staticKey)+len(ephSecret)+len(transcriptHash))
+	raw = append(raw, staticKey...)
+	raw = append(raw, ephSecret...)
+	raw = append(raw, transcriptHash[:]...)
+
+	m := KeyDerivation(raw, 3*sessionKeyLen+2*nonceSaltLen, hSuite)
+	k := &sessionKeys{}
+	k.clientKey, m = m[:sessionKeyLen], m[sessionKeyLen:]
+	k.serverKey, m = m[:sessionKeyLen], m[sessionKeyLen:]
+	k.clientSalt, m = m[:nonceSaltLen], m[nonceSaltLen:]
+	k.serverSalt, m = m[:nonceSaltLen], m[nonceSaltLen:]
+	k.finishedKey = m
+	return k
+}
+
+func (k *sessionKeys) finished(transcript []byte) []byte {
+	mac := hmac.New(sha256.New, k.finishedKey)
+	mac.Write(transcript)
+	return mac.Sum(nil)
+}
+
+// Handshake runs the ETLS handshake if it has not yet been run. Read and Write call it
+// automatically, clients may call it right after dial to detect the peer version.
+func (c *CryptoConn) Handshake() error {
+	if !c.needHandshake {
+		return nil
+	}
+	c.handshakeOnce.Do(func() {
+		if c.isClient {
+			c.handshakeErr = c.clientHandshake()
+		} else {
+			c.handshakeErr = c.serverHandshake()
+		}
+	})
+	return c.handshakeErr
+}
+
+func (c *CryptoConn) clientHandshake() (err error) {
+	priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+	if err != nil {
+		return
+	}
+	hello := make([]byte, 0, len(v2Magic)+ephPubKeyLen)
+	hello = append(hello, v2Magic...)
+	hello = append(hello, pub.Serialize()...)
+
+	c.Conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer c.Conn.SetDeadline(time.Time{})
+
+	if _, err = c.Conn.Write(hello); err != nil {
+		return
+	}
+	resp := make([]byte, len(v2Magic)+ephPubKeyLen+finishedLen)
+	if _, err = io.ReadFull(c.Conn, resp[:len(v2Magic)]); err != nil {
+		return
+	}
+	if bytes.Equal(resp[:len(v2Magic)], v2Reject) {
+		return ErrVersionNotSupported
+	}
+	if !bytes.Equal(resp[:len(v2Magic)], v2Magic) {
+		return ErrHandshakeFailed
+	}
+	if _, err = io.ReadFull(c.Conn, resp[len(v2Magic):]); err != nil {
+		return
+	}
+	serverHello := resp[:len(v2Magic)+ephPubKeyLen]
+	peerPub, err := asymmetric.ParsePubKey(serverHello[len(v2Magic):])
+	if err != nil {
+		return errors.Wrap(ErrHandshakeFailed, err.Error())
+	}
+
+	transcript := append(hello, serverHello...)
+	keys := deriveSessionKeys(c.key, asymmetric.GenECDHSharedSecret(priv, peerPub), transcript)
+	if !hmac.Equal(keys.finished(transcript), resp[len(serverHello):]) {
+		return ErrHandshakeFailed
+	}
+	if c.record, err = newRecordLayer(keys, true); err != nil {
+		return
+	}
+	c.version = Version2
+	return
+}
+
+func (c *CryptoConn) serverHandshake() (err error) {
+	c.Conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer c.Conn.SetDeadline(time.Time{})
+
+	head := make([]byte, c.info.ivLen)
+	if _, err = io.ReadFull(c.Conn, head); err != nil {
+		return
+	}
+	if !bytes.Equal(head, v2Magic) {
+		if c.minVersion > Version1 {
+			return ErrVersionNotSupported
+		}
+		// A v1 client, the head is the IV of its CFB stream.
+		if err = c.initDecrypt(head); err != nil {
+			return
+		}
+		c.iv = head
+		c.version = Version1
+		return
+	}
+
+	if c.maxVersion == Version1 {
+		// Tell the client explicitly, so it falls back to v1.
+		c.Conn.Write(v2Reject)
+		return ErrVersionNotSupported
+	}
+
+	hello := make([]byte, len(v2Magic)+ephPubKeyLen)
+	copy(hello, head)
+	if _, err = io.ReadFull(c.Conn, hello[len(v2Magic):]); err != nil {
+		return
+	}
+	peerPub, err := asymmetric.ParsePubKey(hello[len(v2Magic):])
+	if err != nil {
+		return errors.Wrap(ErrHandshakeFailed, err.Error())
+	}
+	priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+	if err != nil {
+		return
+	}
+
+	resp := make([]byte, 0, len(v2Magic)+ephPubKeyLen+finishedLen)
+	resp = append(resp, v2Magic...)
+	resp = append(resp, pub.Serialize()...)
+	transcript := append(hello, resp...)
+	keys := deriveSessionKeys(c.key, asymmetric.GenECDHSharedSecret(priv, peerPub), transcript)
+	resp = append(resp, keys.finished(transcript)...)
+	if _, err = c.Conn.Write(resp); err != nil {
+		return
+	}
+	if c.record, err = newRecordLayer(keys, false); err != nil {
+		return
+	}
+	c.version = Version2
+	return
+}
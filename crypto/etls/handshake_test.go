@@ -0,0 +1,215 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package etls
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func echoServer(handler CipherHandler) (l *CryptoListener, err error) {
+	if l, err = NewCryptoListener("tcp", "127.0.0.1:0", handler); err != nil {
+		return
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				// CryptoConn embeds the raw conn, avoid its ReaderFrom in io.Copy
+				buf := make([]byte, 4096)
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+					if _, err = conn.Write(buf[:n]); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return
+}
+
+func serverHandler(minVersion int, maxVersion int) CipherHandler {
+	return func(conn net.Conn) (*CryptoConn, error) {
+		return NewServerConn(conn, NewCipher([]byte(pass)), nil, minVersion, maxVersion), nil
+	}
+}
+
+func dialVersion(addr string, key string, version int) (c *CryptoConn, err error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return
+	}
+	c = NewClientConn(conn, NewCipher([]byte(key)), nil, version)
+	return
+}
+
+func echo(c *CryptoConn, data []byte) (out []byte, err error) {
+	if _, err = c.Write(data); err != nil {
+		return
+	}
+	out = make([]byte, len(data))
+	_, err = io.ReadFull(c, out)
+	return
+}
+
+func TestHandshake(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), maxRecordPayload/4)
+
+	Convey("v2 server accepts v1 and v2 clients", t, func() {
+		l, err := echoServer(serverHandler(Version1, Version2))
+		So(err, ShouldBeNil)
+		defer l.Close()
+
+		c, err := dialVersion(l.Addr().String(), pass, Version2)
+		So(err, ShouldBeNil)
+		So(c.Handshake(), ShouldBeNil)
+		So(c.Version(), ShouldEqual, Version2)
+		out, err := echo(c, data)
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, data)
+		c.Close()
+
+		c, err = dialVersion(l.Addr().String(), pass, Version1)
+		So(err, ShouldBeNil)
+		So(c.Version(), ShouldEqual, Version1)
+		out, err = echo(c, data)
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, data)
+		c.Close()
+	})
+
+	Convey("v2 server rejects v1 clients with min version 2", t, func() {
+		l, err := echoServer(serverHandler(Version2, Version2))
+		So(err, ShouldBeNil)
+		defer l.Close()
+
+		c, err := dialVersion(l.Addr().String(), pass, Version1)
+		So(err, ShouldBeNil)
+		_, err = echo(c, data)
+		So(err, ShouldNotBeNil)
+		c.Close()
+	})
+
+	Convey("v2 client falls back on explicit reject only", t, func() {
+		l, err := echoServer(serverHandler(Version1, Version1))
+		So(err, ShouldBeNil)
+		defer l.Close()
+
+		c, err := dialVersion(l.Addr().String(), pass, Version2)
+		So(err, ShouldBeNil)
+		So(c.Handshake(), ShouldEqual, ErrVersionNotSupported)
+		c.Close()
+
+		c, err = dialVersion(l.Addr().String(), pass, Version1)
+		So(err, ShouldBeNil)
+		out, err := echo(c, data)
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, data)
+		c.Close()
+	})
+
+	Convey("v2 client does not downgrade on dropped connection", t, func() {
+		l, err := NewCryptoListener("tcp", "127.0.0.1:0", simpleCipherHandler)
+		So(err, ShouldBeNil)
+		defer l.Close()
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// v1 server fails to decode the hello and drops the connection
+			buf := make([]byte, 16)
+			conn.Read(buf)
+			conn.Close()
+		}()
+
+		c, err := dialVersion(l.Addr().String(), pass, Version2)
+		So(err, ShouldBeNil)
+		err = c.Handshake()
+		So(err, ShouldNotBeNil)
+		So(errors.Cause(err), ShouldNotEqual, ErrVersionNotSupported)
+		c.Close()
+	})
+
+	Convey("v2 key mismatch", t, func() {
+		l, err := echoServer(serverHandler(Version1, Version2))
+		So(err, ShouldBeNil)
+		defer l.Close()
+
+		c, err := dialVersion(l.Addr().String(), "1234", Version2)
+		So(err, ShouldBeNil)
+		So(c.Handshake(), ShouldEqual, ErrHandshakeFailed)
+		_, err = c.Write(data)
+		So(err, ShouldEqual, ErrHandshakeFailed)
+		c.Close()
+	})
+}
+
+func TestRecordLayer(t *testing.T) {
+	Convey("tampered, replayed and oversized records are rejected", t, func() {
+		keys := deriveSessionKeys([]byte("static"), []byte("ephemeral"), []byte("transcript"))
+		client, err := newRecordLayer(keys, true)
+		So(err, ShouldBeNil)
+		server, err := newRecordLayer(keys, false)
+		So(err, ShouldBeNil)
+
+		buf := &bytes.Buffer{}
+		_, err = client.write(buf, []byte("hello"))
+		So(err, ShouldBeNil)
+		record := append([]byte{}, buf.Bytes()...)
+		out := make([]byte, 5)
+		_, err = server.read(buf, out)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, "hello")
+
+		// replay
+		_, err = server.read(bytes.NewReader(record), out)
+		So(err, ShouldEqual, ErrRecordAuthFailed)
+
+		// tamper
+		_, err = client.write(buf, []byte("world"))
+		So(err, ShouldBeNil)
+		tampered := buf.Bytes()
+		tampered[len(tampered)-1] ^= 1
+		server.in.seq = 1
+		_, err = server.read(buf, out)
+		So(err, ShouldEqual, ErrRecordAuthFailed)
+
+		// wrong direction
+		_, err = client.write(buf, []byte("again"))
+		So(err, ShouldBeNil)
+		_, err = client.read(buf, out)
+		So(err, ShouldEqual, ErrRecordAuthFailed)
+
+		_, err = server.read(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff}), out)
+		So(err, ShouldEqual, ErrRecordTooLarge)
+	})
+}
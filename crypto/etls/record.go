@@ -0,0 +1,162 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package etls
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+const (
+	// recordHeaderLen is the length of the big-endian record length prefix.
+	recordHeaderLen = 4
+	// maxRecordPayload is the max plaintext size of a single record.
+	maxRecordPayload = 16 << 10
+	// nonceSaltLen is the length of the implicit nonce part derived in handshake,
+	// the rest of the 12 bytes GCM nonce is the record sequence number.
+	nonceSaltLen = 4
+)
+
+// recordDirection keeps the AEAD state of one direction of the connection.
+type recordDirection struct {
+	aead cipher.AEAD
+	salt []byte
+	seq  uint64
+}
+
+func newRecordDirection(key, salt []byte) (d *recordDirection, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return
+	}
+	d = &recordDirection{aead: aead, salt: salt}
+	return
+}
+
+// nextNonce returns the nonce of the current record and advances the sequence.
+func (d *recordDirection) nextNonce() (nonce []byte, err error) {
+	if d.seq == math.MaxUint64 {
+		return nil, ErrSequenceOverflow
+	}
+	nonce = make([]byte, d.aead.NonceSize())
+	copy(nonce, d.salt)
+	binary.BigEndian.PutUint64(nonce[nonceSaltLen:], d.seq)
+	d.seq++
+	return
+}
+
+// recordLayer implements the ETLS v2 framing: each record is a 4 bytes length
+// followed by the AES-256-GCM sealed payload. The nonce is built from the
+// sequence number, so dropped, reordered or replayed records fail to open.
+type recordLayer struct {
+	in      *recordDirection
+	out     *recordDirection
+	pending []byte
+}
+
+func newRecordLayer(keys *sessionKeys, isClient bool) (r *recordLayer, err error) {
+	var clientDir, serverDir *recordDirection
+	if clientDir, err = newRecordDirection(keys.clientKey, keys.clientSalt); err != nil {
+		return
+	}
+	if serverDir, err = newRecordDirection(keys.serverKey, keys.serverSalt); err != nil {
+		return
+	}
+	if isClient {
+		r = &recordLayer{in: serverDir, out: clientDir}
+	} else {
+		r = &recordLayer{in: clientDir, out: serverDir}
+	}
+	return
+}
+
+// seal appends the record of 'plain' to 'dst', 'plain' must not exceed maxRecordPayload.
+func (r *recordLayer) seal(dst, plain []byte) (out []byte, err error) {
+	nonce, err := r.out.nextNonce()
+	if err != nil {
+		return
+	}
+	start := len(dst)
+	out = append(dst, make([]byte, recordHeaderLen)...)
+	binary.BigEndian.PutUint32(out[start:], uint32(len(plain)+r.out.aead.Overhead()))
+	// The length header is authenticated along with the payload.
+	out = r.out.aead.Seal(out, nonce, plain, out[start:start+recordHeaderLen])
+	return
+}
+
+// readRecord reads and opens the next record from 'rd'.
+func (r *recordLayer) readRecord(rd io.Reader) (plain []byte, err error) {
+	header := make([]byte, recordHeaderLen)
+	if _, err = io.ReadFull(rd, header); err != nil {
+		return
+	}
+	length := int(binary.BigEndian.Uint32(header))
+	if length < r.in.aead.Overhead() || length > maxRecordPayload+r.in.aead.Overhead() {
+		return nil, ErrRecordTooLarge
+	}
+	sealed := make([]byte, length)
+	if _, err = io.ReadFull(rd, sealed); err != nil {
+		return
+	}
+	nonce, err := r.in.nextNonce()
+	if err != nil {
+		return
+	}
+	if plain, err = r.in.aead.Open(sealed[:0], nonce, sealed, header); err != nil {
+		return nil, ErrRecordAuthFailed
+	}
+	return
+}
+
+// read fills 'b' with the buffered plaintext, reading a new record if needed.
+func (r *recordLayer) read(rd io.Reader, b []byte) (n int, err error) {
+	for len(r.pending) == 0 {
+		if r.pending, err = r.readRecord(rd); err != nil {
+			return
+		}
+	}
+	n = copy(b, r.pending)
+	r.pending = r.pending[n:]
+	return
+}
+
+// write seals 'b' into records and writes them with a single call to 'w'.
+func (r *recordLayer) write(w io.Writer, b []byte) (n int, err error) {
+	overhead := recordHeaderLen + r.out.aead.Overhead()
+	buf := make([]byte, 0, len(b)+(len(b)/maxRecordPayload+1)*overhead)
+	for start := 0; start < len(b); start += maxRecordPayload {
+		end := start + maxRecordPayload
+		if end > len(b) {
+			end = len(b)
+		}
+		if buf, err = r.seal(buf, b[start:end]); err != nil {
+			return
+		}
+	}
+	if _, err = w.Write(buf); err != nil {
+		return
+	}
+	n = len(b)
+	return
+}
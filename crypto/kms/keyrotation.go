@@ -0,0 +1,315 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"errors"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	mine "github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	bolt "github.com/coreos/bbolt"
+)
+
+//go:generate hsp
+
+const (
+	// kmsRotationBucketName is the boltdb bucket name of key rotation records
+	kmsRotationBucketName = "kms-rotation"
+	// MaxKeyRotationClockSkew is the tolerated clock skew of key rotation timestamps.
+	MaxKeyRotationClockSkew = 5 * time.Minute
+	// MaxKeyRotationGracePeriod is the longest period the old key is accepted for.
+	MaxKeyRotationGracePeriod = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrInvalidKeyRotation indicates the key rotation record is malformed
+	ErrInvalidKeyRotation = errors.New("invalid key rotation")
+	// ErrKeyRotationSignee indicates the key rotation is not signed by the current key
+	ErrKeyRotationSignee = errors.New("key rotation not signed by the current key")
+	// ErrKeyRotationNewKeySignature indicates the new key signature does not match
+	ErrKeyRotationNewKeySignature = errors.New("key rotation new key signature not match")
+	// ErrKeyRotationOutdated indicates the key rotation is not newer than the stored one
+	ErrKeyRotationOutdated = errors.New("key rotation outdated")
+	// ErrKeyRotationInFuture indicates the key rotation timestamp is beyond the clock skew
+	ErrKeyRotationInFuture = errors.New("key rotation timestamp in the future")
+)
+
+// KeyRotationHeader defines the content of a key rotation record. The identity is the
+// NodeID if set, or the account address of the original key otherwise.
+type KeyRotationHeader struct {
+	// NodeID and Nonce are the node identity, which is bound to OriginalKey by proof of work.
+	// NodeID is nil for account key rotations.
+	NodeID *proto.NodeID
+	Nonce  mine.Uint256
+	// OriginalKey is the key the identity was created with.
+	OriginalKey *asymmetric.PublicKey
+	// OldKey is the key currently registered for the identity, NewKey replaces it.
+	OldKey *asymmetric.PublicKey
+	NewKey *asymmetric.PublicKey
+	// OldKey is still accepted until Timestamp + GracePeriod.
+	Timestamp   time.Time
+	GracePeriod time.Duration
+}
+
+// KeyRotation defines a key rotation record, signed by both the old and the new key.
+type KeyRotation struct {
+	KeyRotationHeader
+	NewKeySignature *asymmetric.Signature
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewKeyRotation returns a new unsigned key rotation record.
+func NewKeyRotation(header *KeyRotationHeader) *KeyRotation {
+	return &KeyRotation{
+		KeyRotationHeader: *header,
+	}
+}
+
+// Identity returns the identity of the key rotation record.
+func (h *KeyRotationHeader) Identity() (id string, err error) {
+	if !h.NodeID.IsEmpty() {
+		id = string(*h.NodeID)
+		return
+	}
+	var addr proto.AccountAddress
+	if addr, err = h.Address(); err != nil {
+		return
+	}
+	id = addr.String()
+	return
+}
+
+// Address returns the account address of the identity.
+func (h *KeyRotationHeader) Address() (addr proto.AccountAddress, err error) {
+	if h.OriginalKey == nil {
+		err = ErrInvalidKeyRotation
+		return
+	}
+	return crypto.PubKeyHash(h.OriginalKey)
+}
+
+// AcceptedKeys returns the keys accepted for the identity at the given time.
+func (h *KeyRotationHeader) AcceptedKeys(now time.Time) (keys []*asymmetric.PublicKey) {
+	keys = append(keys, h.NewKey)
+	if now.Before(h.Timestamp.Add(h.GracePeriod)) {
+		keys = append(keys, h.OldKey)
+	}
+	return
+}
+
+// IsKeyAccepted returns if the key is accepted for the identity at the given time.
+func (h *KeyRotationHeader) IsKeyAccepted(key *asymmetric.PublicKey, now time.Time) bool {
+	if key == nil {
+		return false
+	}
+	for _, k := range h.AcceptedKeys(now) {
+		if k.IsEqual(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveKey returns the key the identity is reached with at the given time. The node keeps
+// its old private key until it's replaced by the operator in the grace period, so peers keep
+// deriving the ETLS secret from the old key until the grace period ends.
+func (h *KeyRotationHeader) ActiveKey(now time.Time) *asymmetric.PublicKey {
+	if now.Before(h.Timestamp.Add(h.GracePeriod)) {
+		return h.OldKey
+	}
+	return h.NewKey
+}
+
+// Sign signs the key rotation record with the old and the new private key.
+func (r *KeyRotation) Sign(oldKey, newKey *asymmetric.PrivateKey) (err error) {
+	if err = r.DefaultHashSignVerifierImpl.Sign(&r.KeyRotationHeader, oldKey); err != nil {
+		return
+	}
+	r.NewKeySignature, err = newKey.Sign(r.DataHash[:])
+	return
+}
+
+// Verify verifies the signatures and the identity of the key rotation record, the grace
+// period is capped and the timestamp could not be in the future.
+func (r *KeyRotation) Verify() (err error) {
+	if r.OriginalKey == nil || r.OldKey == nil || r.NewKey == nil || r.NewKeySignature == nil {
+		return ErrInvalidKeyRotation
+	}
+	if r.OldKey.IsEqual(r.NewKey) || r.GracePeriod < 0 || r.GracePeriod > MaxKeyRotationGracePeriod {
+		return ErrInvalidKeyRotation
+	}
+	if r.Timestamp.After(time.Now().Add(MaxKeyRotationClockSkew)) {
+		return ErrKeyRotationInFuture
+	}
+	if !r.NodeID.IsEmpty() && !IsIDPubNonceValid(r.NodeID.ToRawNodeID(), &r.Nonce, r.OriginalKey) {
+		return ErrNodeIDKeyNonceNotMatch
+	}
+	if err = r.DefaultHashSignVerifierImpl.Verify(&r.KeyRotationHeader); err != nil {
+		return
+	}
+	if !r.Signee.IsEqual(r.OldKey) {
+		return ErrKeyRotationSignee
+	}
+	if !r.NewKeySignature.Verify(r.DataHash[:], r.NewKey) {
+		return ErrKeyRotationNewKeySignature
+	}
+	return
+}
+
+// Follows returns if the key rotation record can be applied after prev, which is the
+// latest record of the same identity, or nil if the key was never rotated.
+func (r *KeyRotation) Follows(prev *KeyRotation) (err error) {
+	if prev == nil {
+		if !r.OldKey.IsEqual(r.OriginalKey) {
+			return ErrKeyRotationSignee
+		}
+		return
+	}
+	if prev.NodeID.IsEmpty() != r.NodeID.IsEmpty() || !prev.OriginalKey.IsEqual(r.OriginalKey) {
+		return ErrInvalidKeyRotation
+	}
+	if !r.OldKey.IsEqual(prev.NewKey) {
+		return ErrKeyRotationSignee
+	}
+	if !r.Timestamp.After(prev.Timestamp) {
+		return ErrKeyRotationOutdated
+	}
+	return
+}
+
+// GetKeyRotation gets the latest key rotation record of the identity, which is a NodeID
+// or an account address string. Returns ErrKeyNotFound if the key was never rotated.
+func GetKeyRotation(id string) (r *KeyRotation, err error) {
+	pksLock.Lock()
+	defer pksLock.Unlock()
+	if pks == nil || pks.db == nil {
+		return nil, ErrPKSNotInitialized
+	}
+
+	err = pks.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(kmsRotationBucketName))
+		if bucket == nil {
+			return ErrBucketNotInitialized
+		}
+		byteVal := bucket.Get([]byte(id))
+		if byteVal == nil {
+			return ErrKeyNotFound
+		}
+		return utils.DecodeMsgPack(byteVal, &r)
+	})
+	return
+}
+
+// SetKeyRotation verifies the key rotation record and stores it if it follows the latest
+// record of the identity. The node is reached with the old key until the grace period ends,
+// see ActiveKey.
+func SetKeyRotation(r *KeyRotation) (err error) {
+	if r == nil {
+		return ErrInvalidKeyRotation
+	}
+	if err = r.Verify(); err != nil {
+		return
+	}
+	var id string
+	if id, err = r.Identity(); err != nil {
+		return
+	}
+	buf, err := utils.EncodeMsgPack(r)
+	if err != nil {
+		return
+	}
+
+	pksLock.Lock()
+	defer pksLock.Unlock()
+	if pks == nil || pks.db == nil {
+		return ErrPKSNotInitialized
+	}
+	var applied bool
+	err = pks.db.Update(func(tx *bolt.Tx) (err error) {
+		bucket := tx.Bucket([]byte(kmsRotationBucketName))
+		if bucket == nil {
+			return ErrBucketNotInitialized
+		}
+		var prev *KeyRotation
+		if byteVal := bucket.Get([]byte(id)); byteVal != nil {
+			if err = utils.DecodeMsgPack(byteVal, &prev); err != nil {
+				return
+			}
+			if prev.DataHash.IsEqual(&r.DataHash) {
+				applied = true
+				return
+			}
+		}
+		if err = r.Follows(prev); err != nil {
+			return
+		}
+		if err = bucket.Put([]byte(id), buf.Bytes()); err != nil {
+			return
+		}
+		if r.NodeID.IsEmpty() {
+			return
+		}
+		// register the unknown node, so it could be found by the rotated NodeID
+		nodes := tx.Bucket(pks.bucket)
+		if nodes == nil {
+			return ErrBucketNotInitialized
+		}
+		if nodes.Get([]byte(*r.NodeID)) != nil {
+			return
+		}
+		nodeBuf, err := utils.EncodeMsgPack(&proto.Node{
+			ID:        *r.NodeID,
+			Nonce:     r.Nonce,
+			PublicKey: r.OldKey,
+		})
+		if err != nil {
+			return
+		}
+		return nodes.Put([]byte(*r.NodeID), nodeBuf.Bytes())
+	})
+	if err != nil {
+		log.WithError(err).Error("set key rotation failed")
+		return
+	}
+	if !applied {
+		log.WithFields(log.Fields{
+			"id":    id,
+			"grace": r.GracePeriod,
+		}).Info("key rotated")
+	}
+	return
+}
+
+// IsNodeKeyValid returns if the key is valid for the node: the node key is bound to the
+// NodeID by proof of work, unless it was rotated, then the keys accepted by the latest
+// rotation record are valid.
+func IsNodeKeyValid(id *proto.RawNodeID, nonce *mine.Uint256, key *asymmetric.PublicKey) bool {
+	if key == nil || id == nil || nonce == nil {
+		return false
+	}
+	r, err := GetKeyRotation(id.String())
+	if err != nil {
+		return IsIDPubNonceValid(id, nonce, key)
+	}
+	return r.Nonce == *nonce && r.IsKeyAccepted(key, time.Now())
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	mine "github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKeyRotation(t *testing.T) {
+	Convey("Given a node identity and a key rotation record", t, func() {
+		pks = nil
+		os.Remove(dbFile)
+		defer os.Remove(dbFile)
+		So(InitPublicKeyStore(dbFile, nil), ShouldBeNil)
+
+		origPriv, origPub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		newPriv, newPub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		nonce := mine.Uint256{A: 1}
+		nodeHash := mine.HashBlock(origPub.Serialize(), nonce)
+		nodeID := proto.NodeID(nodeHash.String())
+		rawNodeID := nodeID.ToRawNodeID()
+		So(setNode(&proto.Node{ID: nodeID, PublicKey: origPub, Nonce: nonce}), ShouldBeNil)
+
+		r := NewKeyRotation(&KeyRotationHeader{
+			NodeID:      &nodeID,
+			Nonce:       nonce,
+			OriginalKey: origPub,
+			OldKey:      origPub,
+			NewKey:      newPub,
+			Timestamp:   time.Now().Add(-10 * time.Minute),
+			GracePeriod: time.Hour,
+		})
+		So(r.Sign(origPriv, newPriv), ShouldBeNil)
+		So(r.Verify(), ShouldBeNil)
+
+		Convey("The record should be rejected if tampered", func() {
+			r.GracePeriod = 2 * time.Hour
+			So(r.Verify(), ShouldNotBeNil)
+			r.GracePeriod = time.Hour
+			r.NewKeySignature, err = origPriv.Sign(r.DataHash[:])
+			So(err, ShouldBeNil)
+			So(r.Verify(), ShouldEqual, ErrKeyRotationNewKeySignature)
+			So(SetKeyRotation(r), ShouldNotBeNil)
+		})
+		Convey("The record should be rejected if the grace period or timestamp is out of bound", func() {
+			r.GracePeriod = MaxKeyRotationGracePeriod + time.Second
+			So(r.Sign(origPriv, newPriv), ShouldBeNil)
+			So(r.Verify(), ShouldEqual, ErrInvalidKeyRotation)
+			r.GracePeriod = time.Hour
+			r.Timestamp = time.Now().Add(MaxKeyRotationClockSkew + time.Minute)
+			So(r.Sign(origPriv, newPriv), ShouldBeNil)
+			So(r.Verify(), ShouldEqual, ErrKeyRotationInFuture)
+			So(SetKeyRotation(r), ShouldEqual, ErrKeyRotationInFuture)
+		})
+		Convey("The record should be rejected if not signed by the old key", func() {
+			So(r.Sign(newPriv, newPriv), ShouldBeNil)
+			So(r.Verify(), ShouldEqual, ErrKeyRotationSignee)
+		})
+		Convey("The new key should replace the node key after the grace period", func() {
+			So(IsNodeKeyValid(rawNodeID, &nonce, origPub), ShouldBeTrue)
+			So(IsNodeKeyValid(rawNodeID, &nonce, newPub), ShouldBeFalse)
+			So(SetKeyRotation(r), ShouldBeNil)
+			// idempotent
+			So(SetKeyRotation(r), ShouldBeNil)
+
+			// the node is reached with the old key in the grace period
+			pub, err := GetPublicKey(nodeID)
+			So(err, ShouldBeNil)
+			So(pub.IsEqual(origPub), ShouldBeTrue)
+			So(r.ActiveKey(r.Timestamp.Add(2*time.Hour)).IsEqual(newPub), ShouldBeTrue)
+			So(IsNodeKeyValid(rawNodeID, &nonce, newPub), ShouldBeTrue)
+			So(IsNodeKeyValid(rawNodeID, &nonce, origPub), ShouldBeTrue)
+			So(r.IsKeyAccepted(origPub, r.Timestamp.Add(2*time.Hour)), ShouldBeFalse)
+			So(r.IsKeyAccepted(newPub, r.Timestamp.Add(2*time.Hour)), ShouldBeTrue)
+			So(SetNode(&proto.Node{ID: nodeID, PublicKey: newPub, Nonce: nonce}), ShouldBeNil)
+
+			Convey("A following rotation should be signed by the current key", func() {
+				thirdPriv, thirdPub, err := asymmetric.GenSecp256k1KeyPair()
+				So(err, ShouldBeNil)
+				next := NewKeyRotation(&KeyRotationHeader{
+					NodeID:      &nodeID,
+					Nonce:       nonce,
+					OriginalKey: origPub,
+					OldKey:      origPub,
+					NewKey:      thirdPub,
+					Timestamp:   r.Timestamp.Add(time.Minute),
+				})
+				So(next.Sign(origPriv, thirdPriv), ShouldBeNil)
+				So(SetKeyRotation(next), ShouldEqual, ErrKeyRotationSignee)
+
+				next.OldKey = newPub
+				next.Timestamp = r.Timestamp
+				So(next.Sign(newPriv, thirdPriv), ShouldBeNil)
+				So(SetKeyRotation(next), ShouldEqual, ErrKeyRotationOutdated)
+
+				next.Timestamp = r.Timestamp.Add(time.Minute)
+				So(next.Sign(newPriv, thirdPriv), ShouldBeNil)
+				So(SetKeyRotation(next), ShouldBeNil)
+				// no grace period for the previous keys
+				pub, err = GetPublicKey(nodeID)
+				So(err, ShouldBeNil)
+				So(pub.IsEqual(thirdPub), ShouldBeTrue)
+				So(IsNodeKeyValid(rawNodeID, &nonce, thirdPub), ShouldBeTrue)
+				So(IsNodeKeyValid(rawNodeID, &nonce, newPub), ShouldBeFalse)
+				So(IsNodeKeyValid(rawNodeID, &nonce, origPub), ShouldBeFalse)
+			})
+		})
+		Convey("An unknown node should be registered with the old key", func() {
+			So(DelNode(nodeID), ShouldBeNil)
+			So(SetKeyRotation(r), ShouldBeNil)
+			node, err := GetNodeInfo(nodeID)
+			So(err, ShouldBeNil)
+			So(node.Nonce, ShouldResemble, nonce)
+			So(node.PublicKey.IsEqual(origPub), ShouldBeTrue)
+		})
+		Convey("Account key rotation should be keyed by address", func() {
+			r.NodeID = nil
+			So(r.Sign(origPriv, newPriv), ShouldBeNil)
+			So(SetKeyRotation(r), ShouldBeNil)
+			addr, err := r.Address()
+			So(err, ShouldBeNil)
+			stored, err := GetKeyRotation(addr.String())
+			So(err, ShouldBeNil)
+			So(stored.NewKey.IsEqual(newPub), ShouldBeTrue)
+			_, err = GetKeyRotation(string(nodeID))
+			So(err, ShouldEqual, ErrKeyNotFound)
+		})
+	})
+}
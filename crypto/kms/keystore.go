@@ -0,0 +1,231 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// KeystoreVersion is the current private key file format version, the legacy format
+	// encrypted by symmetric.EncryptWithPassword has no version and is regarded as 1.
+	KeystoreVersion = 2
+	// legacyKeystoreVersion is the version of the binary key file format.
+	legacyKeystoreVersion = 1
+
+	keystoreKDFScrypt    = "scrypt"
+	keystoreCipherAESGCM = "aes-256-gcm"
+	keystoreSaltSize     = 32
+	keystoreKeySize      = 32
+)
+
+var (
+	// KeystoreScryptN is the scrypt CPU/memory cost of new key files.
+	KeystoreScryptN = 1 << 15
+	// KeystoreScryptR is the scrypt block size of new key files.
+	KeystoreScryptR = 8
+	// KeystoreScryptP is the scrypt parallelization of new key files.
+	KeystoreScryptP = 1
+	// MaxKeystoreScryptN is the highest scrypt CPU/memory cost accepted from key files.
+	MaxKeystoreScryptN = 1 << 20
+
+	// ErrKeystoreVersion indicates the key file version is not supported.
+	ErrKeystoreVersion = errors.New("unsupported key file version")
+	// ErrKeystoreDecrypt indicates the key file can't be decrypted by the master key.
+	ErrKeystoreDecrypt = errors.New("decrypt key file failed, wrong master key?")
+)
+
+// KeystoreKDFParams defines the key derivation parameters of a key file.
+type KeystoreKDFParams struct {
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt []byte `json:"salt"`
+}
+
+// Keystore defines the versioned private key file, the private key is encrypted by an AEAD
+// cipher with the key derived from the master key, the metadata is authenticated as well.
+type Keystore struct {
+	Version    int               `json:"version"`
+	Address    string            `json:"address"`
+	CreatedAt  time.Time         `json:"created_at"`
+	KDF        string            `json:"kdf"`
+	KDFParams  KeystoreKDFParams `json:"kdf_params"`
+	Cipher     string            `json:"cipher"`
+	Nonce      []byte            `json:"nonce"`
+	CipherText []byte            `json:"cipher_text"`
+}
+
+// additionalData returns the metadata authenticated along with the private key.
+func (ks *Keystore) additionalData() []byte {
+	return []byte(fmt.Sprintf("%d:%s:%d:%s:%s",
+		ks.Version, ks.Address, ks.CreatedAt.UnixNano(), ks.KDF, ks.Cipher))
+}
+
+func (ks *Keystore) aead(masterKey []byte) (aead cipher.AEAD, err error) {
+	if ks.KDF != keystoreKDFScrypt || ks.Cipher != keystoreCipherAESGCM {
+		return nil, ErrKeystoreVersion
+	}
+	var (
+		p   = ks.KDFParams
+		key []byte
+	)
+	if p.N > MaxKeystoreScryptN || p.R <= 0 || p.P <= 0 {
+		return nil, ErrKeystoreVersion
+	}
+	if key, err = scrypt.Key(masterKey, p.Salt, p.N, p.R, p.P, keystoreKeySize); err != nil {
+		return
+	}
+	var block cipher.Block
+	if block, err = aes.NewCipher(key); err != nil {
+		return
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewKeystore encrypts the private key by the master key in the current key file format.
+func NewKeystore(key *asymmetric.PrivateKey, masterKey []byte) (ks *Keystore, err error) {
+	ks = &Keystore{
+		Version:   KeystoreVersion,
+		CreatedAt: time.Now().UTC(),
+		KDF:       keystoreKDFScrypt,
+		KDFParams: KeystoreKDFParams{
+			N:    KeystoreScryptN,
+			R:    KeystoreScryptR,
+			P:    KeystoreScryptP,
+			Salt: make([]byte, keystoreSaltSize),
+		},
+		Cipher: keystoreCipherAESGCM,
+	}
+	addr, err := crypto.PubKeyHash(key.PubKey())
+	if err != nil {
+		return nil, err
+	}
+	ks.Address = addr.String()
+	if _, err = io.ReadFull(rand.Reader, ks.KDFParams.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := ks.aead(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	ks.Nonce = make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, ks.Nonce); err != nil {
+		return nil, err
+	}
+	ks.CipherText = aead.Seal(nil, ks.Nonce, key.Serialize(), ks.additionalData())
+	return
+}
+
+// PrivateKey decrypts the private key by the master key and checks it against the address.
+func (ks *Keystore) PrivateKey(masterKey []byte) (key *asymmetric.PrivateKey, err error) {
+	if ks.Version != KeystoreVersion {
+		return nil, ErrKeystoreVersion
+	}
+	aead, err := ks.aead(masterKey)
+	if err != nil {
+		return
+	}
+	if len(ks.Nonce) != aead.NonceSize() {
+		return nil, ErrKeystoreDecrypt
+	}
+	plain, err := aead.Open(nil, ks.Nonce, ks.CipherText, ks.additionalData())
+	if err != nil {
+		return nil, ErrKeystoreDecrypt
+	}
+	if len(plain) != asymmetric.PrivateKeyBytesLen {
+		return nil, ErrNotKeyFile
+	}
+	key, _ = asymmetric.PrivKeyFromBytes(plain)
+	addr, err := crypto.PubKeyHash(key.PubKey())
+	if err != nil {
+		return nil, err
+	}
+	if addr.String() != ks.Address {
+		return nil, ErrHashNotMatch
+	}
+	return
+}
+
+// LoadKeystore reads the metadata of the key file, the legacy format has version 1 only.
+func LoadKeystore(keyFilePath string) (ks *Keystore, err error) {
+	content, err := ioutil.ReadFile(keyFilePath)
+	if err != nil {
+		return
+	}
+	ks = parseKeystore(content)
+	return
+}
+
+// parseKeystore detects the key file format by the explicit version field, the content is
+// regarded as the legacy binary format if it isn't a JSON object with a version.
+func parseKeystore(content []byte) (ks *Keystore) {
+	ks = &Keystore{}
+	if err := json.Unmarshal(content, ks); err != nil || ks.Version <= legacyKeystoreVersion {
+		return &Keystore{Version: legacyKeystoreVersion}
+	}
+	return
+}
+
+// MigratePrivateKey upgrades the legacy key file in place to the current format, returns
+// false if the file is of the current format already.
+func MigratePrivateKey(keyFilePath string, masterKey []byte) (migrated bool, err error) {
+	var ks *Keystore
+	if ks, err = LoadKeystore(keyFilePath); err != nil {
+		return
+	}
+	if ks.Version != legacyKeystoreVersion {
+		return
+	}
+	var key *asymmetric.PrivateKey
+	if key, err = LoadPrivateKey(keyFilePath, masterKey); err != nil {
+		return
+	}
+	var info os.FileInfo
+	if info, err = os.Stat(keyFilePath); err != nil {
+		return
+	}
+	// write to a temp file and rename, the key file is never left half written
+	tmpPath := keyFilePath + ".migrate"
+	os.Remove(tmpPath)
+	if err = SavePrivateKey(tmpPath, key, masterKey); err != nil {
+		return
+	}
+	if err = os.Chmod(tmpPath, info.Mode().Perm()); err != nil {
+		os.Remove(tmpPath)
+		return
+	}
+	if err = os.Rename(tmpPath, keyFilePath); err != nil {
+		os.Remove(tmpPath)
+		return
+	}
+	migrated = true
+	return
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/symmetric"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const keystorePath = "./.testkeystore"
+
+func TestKeystore(t *testing.T) {
+	Convey("Given a private key saved in the versioned format", t, func() {
+		defer os.Remove(keystorePath)
+		pk, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		So(SavePrivateKey(keystorePath, pk, []byte(password)), ShouldBeNil)
+
+		ks, err := LoadKeystore(keystorePath)
+		So(err, ShouldBeNil)
+		So(ks.Version, ShouldEqual, KeystoreVersion)
+		addr, err := crypto.PubKeyHash(pk.PubKey())
+		So(err, ShouldBeNil)
+		So(ks.Address, ShouldEqual, addr.String())
+		So(ks.KDFParams.Salt, ShouldHaveLength, keystoreSaltSize)
+
+		Convey("The private key should be loaded with the master key", func() {
+			lk, err := LoadPrivateKey(keystorePath, []byte(password))
+			So(err, ShouldBeNil)
+			So(string(lk.Serialize()), ShouldEqual, string(pk.Serialize()))
+			_, err = LoadPrivateKey(keystorePath, []byte("wrong"))
+			So(err, ShouldEqual, ErrKeystoreDecrypt)
+		})
+		Convey("The salt should be random", func() {
+			other, err := NewKeystore(pk, []byte(password))
+			So(err, ShouldBeNil)
+			So(other.KDFParams.Salt, ShouldNotResemble, ks.KDFParams.Salt)
+			So(other.CipherText, ShouldNotResemble, ks.CipherText)
+		})
+		Convey("The metadata should be authenticated", func() {
+			ks.CreatedAt = ks.CreatedAt.Add(1)
+			_, err := ks.PrivateKey([]byte(password))
+			So(err, ShouldEqual, ErrKeystoreDecrypt)
+		})
+		Convey("Unknown versions should be rejected", func() {
+			ks.Version = KeystoreVersion + 1
+			enc, err := json.Marshal(ks)
+			So(err, ShouldBeNil)
+			So(os.Chmod(keystorePath, 0600), ShouldBeNil)
+			So(ioutil.WriteFile(keystorePath, enc, 0600), ShouldBeNil)
+			_, err = LoadPrivateKey(keystorePath, []byte(password))
+			So(err, ShouldEqual, ErrKeystoreVersion)
+		})
+	})
+	Convey("Given a private key saved in the legacy format", t, func() {
+		defer os.Remove(keystorePath)
+		pk, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		enc, err := symmetric.EncryptWithPassword(
+			append(hash.DoubleHashB(pk.Serialize()), pk.Serialize()...), []byte(password))
+		So(err, ShouldBeNil)
+		So(ioutil.WriteFile(keystorePath, enc, 0400), ShouldBeNil)
+
+		ks, err := LoadKeystore(keystorePath)
+		So(err, ShouldBeNil)
+		So(ks.Version, ShouldEqual, 1)
+		lk, err := LoadPrivateKey(keystorePath, []byte(password))
+		So(err, ShouldBeNil)
+		So(string(lk.Serialize()), ShouldEqual, string(pk.Serialize()))
+
+		Convey("The key file should be migrated in place", func() {
+			_, err := MigratePrivateKey(keystorePath, []byte("wrong"))
+			So(err, ShouldNotBeNil)
+			migrated, err := MigratePrivateKey(keystorePath, []byte(password))
+			So(err, ShouldBeNil)
+			So(migrated, ShouldBeTrue)
+			ks, err := LoadKeystore(keystorePath)
+			So(err, ShouldBeNil)
+			So(ks.Version, ShouldEqual, KeystoreVersion)
+			info, err := os.Stat(keystorePath)
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0400))
+			lk, err := LoadPrivateKey(keystorePath, []byte(password))
+			So(err, ShouldBeNil)
+			So(string(lk.Serialize()), ShouldEqual, string(pk.Serialize()))
+
+			migrated, err = MigratePrivateKey(keystorePath, []byte(password))
+			So(err, ShouldBeNil)
+			So(migrated, ShouldBeFalse)
+		})
+	})
+	Convey("Given a legacy key file starting like a JSON object", t, func() {
+		defer os.Remove(keystorePath)
+		pk, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		var enc []byte
+		for len(enc) == 0 || enc[0] != '{' {
+			enc, err = symmetric.EncryptWithPassword(
+				append(hash.DoubleHashB(pk.Serialize()), pk.Serialize()...), []byte(password))
+			So(err, ShouldBeNil)
+		}
+		So(ioutil.WriteFile(keystorePath, enc, 0600), ShouldBeNil)
+
+		ks, err := LoadKeystore(keystorePath)
+		So(err, ShouldBeNil)
+		So(ks.Version, ShouldEqual, 1)
+		lk, err := LoadPrivateKey(keystorePath, []byte(password))
+		So(err, ShouldBeNil)
+		So(string(lk.Serialize()), ShouldEqual, string(pk.Serialize()))
+		migrated, err := MigratePrivateKey(keystorePath, []byte(password))
+		So(err, ShouldBeNil)
+		So(migrated, ShouldBeTrue)
+		lk, err = LoadPrivateKey(keystorePath, []byte(password))
+		So(err, ShouldBeNil)
+		So(string(lk.Serialize()), ShouldEqual, string(pk.Serialize()))
+	})
+}
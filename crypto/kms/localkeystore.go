@@ -30,6 +30,7 @@ import (
 type LocalKeyStore struct {
 	isSet     bool
 	private   *asymmetric.PrivateKey
+	signer    asymmetric.Signer
 	public    *asymmetric.PublicKey
 	nodeID    []byte
 	nodeNonce *mine.Uint256
@@ -76,6 +77,18 @@ func SetLocalKeyPair(private *asymmetric.PrivateKey, public *asymmetric.PublicKe
 	localKey.public = public
 }
 
+// SetLocalSigner sets an external signer instead of the private key, this is a one time thing
+func SetLocalSigner(signer asymmetric.Signer) {
+	localKey.Lock()
+	defer localKey.Unlock()
+	if localKey.isSet {
+		return
+	}
+	localKey.isSet = true
+	localKey.signer = signer
+	localKey.public = signer.PubKey()
+}
+
 // SetLocalNodeIDNonce sets private and public key, this is a one time thing
 func SetLocalNodeIDNonce(rawNodeID []byte, nonce *mine.Uint256) {
 	localKey.Lock()
@@ -156,3 +169,33 @@ func GetLocalPrivateKey() (private *asymmetric.PrivateKey, err error) {
 	//log.Debugf("###getting private key from###\n%s\n###getting private  key end###\n", buf[:count])
 	return
 }
+
+// GetLocalSigner gets local signer, which is the external signer if set or the local private key
+func GetLocalSigner() (signer asymmetric.Signer, err error) {
+	localKey.RLock()
+	defer localKey.RUnlock()
+	if localKey.signer != nil {
+		signer = localKey.signer
+	} else if localKey.private != nil {
+		signer = localKey.private
+	} else {
+		err = ErrNilField
+	}
+	return
+}
+
+// GenLocalSharedSecret generates the ECDH shared secret of the local key and publicKey
+func GenLocalSharedSecret(publicKey *asymmetric.PublicKey) (secret []byte, err error) {
+	localKey.RLock()
+	private, signer := localKey.private, localKey.signer
+	localKey.RUnlock()
+	if private != nil {
+		secret = asymmetric.GenECDHSharedSecret(private, publicKey)
+		return
+	}
+	if g, ok := signer.(sharedSecretGenerator); ok {
+		return g.GenSharedSecret(publicKey)
+	}
+	err = ErrNilField
+	return
+}
@@ -48,6 +48,13 @@ func TestLocalKeyStore(t *testing.T) {
 		So(bytes.Compare(gotPrivate.Serialize(), privKey1.Serialize()), ShouldBeZeroValue)
 		So(gotPublic.IsEqual(pubKey1), ShouldBeTrue)
 		So(gotPrivate.PubKey().IsEqual(pubKey1), ShouldBeTrue)
+		gotSigner, err := GetLocalSigner()
+		So(err, ShouldBeNil)
+		So(gotSigner.PubKey().IsEqual(pubKey1), ShouldBeTrue)
+		_, remotePub, _ := asymmetric.GenSecp256k1KeyPair()
+		secret, err := GenLocalSharedSecret(remotePub)
+		So(err, ShouldBeNil)
+		So(secret, ShouldResemble, asymmetric.GenECDHSharedSecret(privKey1, remotePub))
 	})
 	Convey("set and get key", t, func() {
 		initLocalKeyStore()
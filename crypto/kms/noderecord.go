@@ -0,0 +1,149 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	bolt "github.com/coreos/bbolt"
+)
+
+const (
+	// kmsRecordBucketName is the boltdb bucket name of signed node records
+	kmsRecordBucketName = "kms-record"
+)
+
+// GetNodeRecord gets the signed node record of the node.
+func GetNodeRecord(id proto.NodeID) (record *proto.NodeRecord, err error) {
+	pksLock.Lock()
+	defer pksLock.Unlock()
+	if pks == nil || pks.db == nil {
+		return nil, ErrPKSNotInitialized
+	}
+
+	err = pks.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(kmsRecordBucketName))
+		if bucket == nil {
+			return ErrBucketNotInitialized
+		}
+		byteVal := bucket.Get([]byte(id))
+		if byteVal == nil {
+			return ErrKeyNotFound
+		}
+		return utils.DecodeMsgPack(byteVal, &record)
+	})
+	return
+}
+
+// GetAllNodeRecords gets all the signed node records in store.
+func GetAllNodeRecords() (records []proto.NodeRecord, err error) {
+	pksLock.Lock()
+	defer pksLock.Unlock()
+	if pks == nil || pks.db == nil {
+		return nil, ErrPKSNotInitialized
+	}
+
+	err = pks.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(kmsRecordBucketName))
+		if bucket == nil {
+			return ErrBucketNotInitialized
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var record proto.NodeRecord
+			if err := utils.DecodeMsgPack(v, &record); err != nil {
+				// this may happen, just continue
+				log.WithField("node", string(k)).WithError(err).Error("decode node record failed")
+				return nil
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	return
+}
+
+// SetNodeRecord stores the signed node record, the record should be verified by the caller.
+func SetNodeRecord(record *proto.NodeRecord) (err error) {
+	if record == nil {
+		return ErrNilNode
+	}
+	buf, err := utils.EncodeMsgPack(record)
+	if err != nil {
+		return
+	}
+
+	pksLock.Lock()
+	defer pksLock.Unlock()
+	if pks == nil || pks.db == nil {
+		return ErrPKSNotInitialized
+	}
+
+	err = pks.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(kmsRecordBucketName))
+		if bucket == nil {
+			return ErrBucketNotInitialized
+		}
+		return bucket.Put([]byte(record.Node.ID), buf.Bytes())
+	})
+	if err != nil {
+		log.WithError(err).Error("set node record failed")
+	}
+	return
+}
+
+// DelNodeRecord removes the signed node record of the node.
+func DelNodeRecord(id proto.NodeID) (err error) {
+	pksLock.Lock()
+	defer pksLock.Unlock()
+	if pks == nil || pks.db == nil {
+		return ErrPKSNotInitialized
+	}
+
+	err = pks.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(kmsRecordBucketName))
+		if bucket == nil {
+			return ErrBucketNotInitialized
+		}
+		return bucket.Delete([]byte(id))
+	})
+	if err != nil {
+		log.WithError(err).Error("del node record failed")
+	}
+	return
+}
+
+// ResetNodeRecords removes all the signed node records.
+func ResetNodeRecords() (err error) {
+	pksLock.Lock()
+	defer pksLock.Unlock()
+	if pks == nil || pks.db == nil {
+		return ErrPKSNotInitialized
+	}
+
+	err = pks.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(kmsRecordBucketName)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		_, err := tx.CreateBucket([]byte(kmsRecordBucketName))
+		return err
+	})
+	if err != nil {
+		log.WithError(err).Error("reset node records failed")
+	}
+	return
+}
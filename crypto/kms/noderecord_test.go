@@ -0,0 +1,67 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNodeRecord(t *testing.T) {
+	Convey("Given an initialized public keystore", t, func() {
+		pks = nil
+		os.Remove(dbFile)
+		defer os.Remove(dbFile)
+		So(InitPublicKeyStore(dbFile, nil), ShouldBeNil)
+
+		record := &proto.NodeRecord{
+			NodeRecordHeader: proto.NodeRecordHeader{
+				Node:      proto.Node{ID: "0000000000000000000000000000000000000000000000000000000000000001"},
+				Seq:       1,
+				Timestamp: time.Now(),
+				TTL:       time.Hour,
+			},
+		}
+		_, err := GetNodeRecord(record.Node.ID)
+		So(err, ShouldEqual, ErrKeyNotFound)
+		So(SetNodeRecord(nil), ShouldEqual, ErrNilNode)
+
+		So(SetNodeRecord(record), ShouldBeNil)
+		stored, err := GetNodeRecord(record.Node.ID)
+		So(err, ShouldBeNil)
+		So(stored.Seq, ShouldEqual, 1)
+		So(stored.TTL, ShouldEqual, time.Hour)
+
+		records, err := GetAllNodeRecords()
+		So(err, ShouldBeNil)
+		So(records, ShouldHaveLength, 1)
+
+		So(DelNodeRecord(record.Node.ID), ShouldBeNil)
+		_, err = GetNodeRecord(record.Node.ID)
+		So(err, ShouldEqual, ErrKeyNotFound)
+
+		So(SetNodeRecord(record), ShouldBeNil)
+		So(ResetNodeRecords(), ShouldBeNil)
+		records, err = GetAllNodeRecords()
+		So(err, ShouldBeNil)
+		So(records, ShouldBeEmpty)
+	})
+}
@@ -18,6 +18,7 @@ package kms
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"os"
@@ -36,8 +37,8 @@ var (
 	ErrHashNotMatch = errors.New("private key hash not match")
 )
 
-// LoadPrivateKey loads private key from keyFilePath, and verifies the hash
-// head
+// LoadPrivateKey loads private key from keyFilePath, both the versioned key file format and
+// the legacy one are supported
 func LoadPrivateKey(keyFilePath string, masterKey []byte) (key *asymmetric.PrivateKey, err error) {
 	fileContent, err := ioutil.ReadFile(keyFilePath)
 	if err != nil {
@@ -45,6 +46,17 @@ func LoadPrivateKey(keyFilePath string, masterKey []byte) (key *asymmetric.Priva
 		return
 	}
 
+	if ks := parseKeystore(fileContent); ks.Version != legacyKeystoreVersion {
+		if key, err = ks.PrivateKey(masterKey); err != nil {
+			log.WithField("path", keyFilePath).WithError(err).Error("decrypt private key error")
+		}
+		return
+	}
+	return loadLegacyPrivateKey(fileContent, masterKey)
+}
+
+// loadLegacyPrivateKey decrypts the legacy key file content, and verifies the hash head
+func loadLegacyPrivateKey(fileContent []byte, masterKey []byte) (key *asymmetric.PrivateKey, err error) {
 	decData, err := symmetric.DecryptWithPassword(fileContent, masterKey)
 	if err != nil {
 		log.Error("decrypt private key error")
@@ -69,21 +81,25 @@ func LoadPrivateKey(keyFilePath string, masterKey []byte) (key *asymmetric.Priva
 	return
 }
 
-// SavePrivateKey saves private key with its hash on the head to keyFilePath,
-// default perm is 0600
+// SavePrivateKey saves private key to keyFilePath in the versioned key file format,
+// default perm is 0400
 func SavePrivateKey(keyFilePath string, key *asymmetric.PrivateKey, masterKey []byte) (err error) {
-	serializedKey := key.Serialize()
-	keyHash := hash.DoubleHashB(serializedKey)
-	rawData := append(keyHash, serializedKey...)
-	encKey, err := symmetric.EncryptWithPassword(rawData, masterKey)
+	ks, err := NewKeystore(key, masterKey)
+	if err != nil {
+		return
+	}
+	encKey, err := json.MarshalIndent(ks, "", "  ")
 	if err != nil {
 		return
 	}
 	return ioutil.WriteFile(keyFilePath, encKey, 0400)
 }
 
-// InitLocalKeyPair initializes local private key
+// InitLocalKeyPair initializes local private key, or the external signer if configured
 func InitLocalKeyPair(privateKeyPath string, masterKey []byte) (err error) {
+	if conf.GConf != nil && conf.GConf.SignerSocket != "" {
+		return InitLocalSigner(conf.GConf.SignerSocket)
+	}
 	var privateKey *asymmetric.PrivateKey
 	var publicKey *asymmetric.PublicKey
 	initLocalKeyStore()
@@ -23,6 +23,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
@@ -129,6 +130,14 @@ func InitPublicKeyStore(dbPath string, initNodes []proto.Node) (err error) {
 			log.WithError(err).Error("could not create bucket")
 			return err
 		}
+		if _, err := tx.CreateBucketIfNotExists([]byte(kmsRotationBucketName)); err != nil {
+			log.WithError(err).Error("could not create key rotation bucket")
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists([]byte(kmsRecordBucketName)); err != nil {
+			log.WithError(err).Error("could not create node record bucket")
+			return err
+		}
 		return nil // return from Update func
 	})
 	if err != nil {
@@ -168,6 +177,14 @@ func GetPublicKey(id proto.NodeID) (publicKey *asymmetric.PublicKey, err error)
 // GetNodeInfo gets node info of given id
 // Returns an error if the id was not found
 func GetNodeInfo(id proto.NodeID) (nodeInfo *proto.Node, err error) {
+	if nodeInfo, err = getNode(id); err != nil {
+		log.WithError(err).Error("get node info failed")
+	}
+	return
+}
+
+// getNode gets node info of given id without logging
+func getNode(id proto.NodeID) (nodeInfo *proto.Node, err error) {
 	pksLock.Lock()
 	defer pksLock.Unlock()
 	if pks == nil || pks.db == nil {
@@ -183,13 +200,22 @@ func GetNodeInfo(id proto.NodeID) (nodeInfo *proto.Node, err error) {
 		if byteVal == nil {
 			return ErrKeyNotFound
 		}
-		err = utils.DecodeMsgPack(byteVal, &nodeInfo)
+		if err := utils.DecodeMsgPack(byteVal, &nodeInfo); err != nil {
+			return err
+		}
+		// the node key follows the latest rotation of the node
+		if rotations := tx.Bucket([]byte(kmsRotationBucketName)); rotations != nil {
+			if byteVal = rotations.Get([]byte(id)); byteVal != nil {
+				var r *KeyRotation
+				if err := utils.DecodeMsgPack(byteVal, &r); err != nil {
+					return err
+				}
+				nodeInfo.PublicKey = r.ActiveKey(time.Now())
+			}
+		}
 		log.Debugf("get node info: %#v", nodeInfo)
-		return err // return from View func
+		return nil // return from View func
 	})
-	if err != nil {
-		log.WithError(err).Error("get node info failed")
-	}
 	return
 }
 
@@ -229,13 +255,13 @@ func SetPublicKey(id proto.NodeID, nonce mine.Uint256, publicKey *asymmetric.Pub
 	return SetNode(nodeInfo)
 }
 
-// SetNode verifies nonce and sets {proto.Node.ID: proto.Node}
+// SetNode verifies the node key and sets {proto.Node.ID: proto.Node}
 func SetNode(nodeInfo *proto.Node) (err error) {
 	if nodeInfo == nil {
 		return ErrNilNode
 	}
 	if !Unittest {
-		if !IsIDPubNonceValid(nodeInfo.ID.ToRawNodeID(), &nodeInfo.Nonce, nodeInfo.PublicKey) {
+		if !IsNodeKeyValid(nodeInfo.ID.ToRawNodeID(), &nodeInfo.Nonce, nodeInfo.PublicKey) {
 			return ErrNodeIDKeyNonceNotMatch
 		}
 	}
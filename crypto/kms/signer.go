@@ -0,0 +1,221 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// The external signer protocol is JSON-RPC over a unix socket, keys and signatures are
+// serialized as in the public key store.
+const (
+	signerServiceName = "Signer"
+)
+
+var (
+	// ErrSignerUnavailable indicates that the external signer can't be reached.
+	ErrSignerUnavailable = errors.New("external signer unavailable")
+)
+
+// SignerPublicKeyReq defines the external signer public key request.
+type SignerPublicKeyReq struct{}
+
+// SignerPublicKeyResp defines the external signer public key response.
+type SignerPublicKeyResp struct {
+	PublicKey []byte
+}
+
+// SignerSignReq defines the external signer sign request.
+type SignerSignReq struct {
+	Hash []byte
+}
+
+// SignerSignResp defines the external signer sign response.
+type SignerSignResp struct {
+	Signature []byte
+}
+
+// SignerSharedSecretReq defines the external signer ECDH request.
+type SignerSharedSecretReq struct {
+	PublicKey []byte
+}
+
+// SignerSharedSecretResp defines the external signer ECDH response.
+type SignerSharedSecretResp struct {
+	Secret []byte
+}
+
+// sharedSecretGenerator is implemented by signers which also do the ECDH key exchange of the
+// RPC sessions, so that the private key is not needed in process at all.
+type sharedSecretGenerator interface {
+	GenSharedSecret(publicKey *asymmetric.PublicKey) ([]byte, error)
+}
+
+// SocketSigner defines a signer which forwards sign requests to an external signer process
+// over a unix socket.
+type SocketSigner struct {
+	sync.Mutex
+	path   string
+	public *asymmetric.PublicKey
+	client *rpc.Client
+}
+
+// NewSocketSigner connects the external signer listening on the unix socket path.
+func NewSocketSigner(path string) (s *SocketSigner, err error) {
+	s = &SocketSigner{path: path}
+	var resp SignerPublicKeyResp
+	if err = s.call("PublicKey", &SignerPublicKeyReq{}, &resp); err != nil {
+		s = nil
+		return
+	}
+	if s.public, err = asymmetric.ParsePubKey(resp.PublicKey); err != nil {
+		s = nil
+	}
+	return
+}
+
+// PubKey implements asymmetric.Signer.PubKey.
+func (s *SocketSigner) PubKey() *asymmetric.PublicKey {
+	return s.public
+}
+
+// Sign implements asymmetric.Signer.Sign.
+func (s *SocketSigner) Sign(hash []byte) (sig *asymmetric.Signature, err error) {
+	var resp SignerSignResp
+	if err = s.call("Sign", &SignerSignReq{Hash: hash}, &resp); err != nil {
+		return
+	}
+	if sig, err = asymmetric.ParseSignature(resp.Signature); err != nil {
+		return
+	}
+	// never trust the external signer blindly
+	if !sig.Verify(hash, s.public) {
+		sig, err = nil, ErrSignerUnavailable
+	}
+	return
+}
+
+// GenSharedSecret generates the ECDH shared secret with publicKey by the external signer.
+func (s *SocketSigner) GenSharedSecret(publicKey *asymmetric.PublicKey) (secret []byte, err error) {
+	var resp SignerSharedSecretResp
+	if err = s.call("SharedSecret", &SignerSharedSecretReq{PublicKey: publicKey.Serialize()}, &resp); err != nil {
+		return
+	}
+	secret = resp.Secret
+	return
+}
+
+// Close closes the connection to the external signer.
+func (s *SocketSigner) Close() (err error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.client != nil {
+		err = s.client.Close()
+		s.client = nil
+	}
+	return
+}
+
+func (s *SocketSigner) call(method string, req, resp interface{}) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	// reconnect once if the signer process was restarted
+	for i := 0; i < 2; i++ {
+		if s.client == nil {
+			var conn net.Conn
+			if conn, err = net.Dial("unix", s.path); err != nil {
+				log.WithField("path", s.path).WithError(err).Error("connect external signer failed")
+				return ErrSignerUnavailable
+			}
+			s.client = jsonrpc.NewClient(conn)
+		}
+		if err = s.client.Call(signerServiceName+"."+method, req, resp); err != rpc.ErrShutdown {
+			return
+		}
+		s.client.Close()
+		s.client = nil
+	}
+	return
+}
+
+// SignerService defines the service of an external signer process holding the private key.
+type SignerService struct {
+	key *asymmetric.PrivateKey
+}
+
+// PublicKey returns the public key of the signer.
+func (s *SignerService) PublicKey(req *SignerPublicKeyReq, resp *SignerPublicKeyResp) (err error) {
+	resp.PublicKey = s.key.PubKey().Serialize()
+	return
+}
+
+// Sign signs the hash by the private key.
+func (s *SignerService) Sign(req *SignerSignReq, resp *SignerSignResp) (err error) {
+	var sig *asymmetric.Signature
+	if sig, err = s.key.Sign(req.Hash); err != nil {
+		return
+	}
+	resp.Signature = sig.Serialize()
+	return
+}
+
+// SharedSecret generates the ECDH shared secret with the public key.
+func (s *SignerService) SharedSecret(req *SignerSharedSecretReq, resp *SignerSharedSecretResp) (err error) {
+	var pub *asymmetric.PublicKey
+	if pub, err = asymmetric.ParsePubKey(req.PublicKey); err != nil {
+		return
+	}
+	resp.Secret = asymmetric.GenECDHSharedSecret(s.key, pub)
+	return
+}
+
+// ServeSigner serves the external signer of key on the listener until it's closed. The
+// listener should be a unix socket accessible by the node process only.
+func ServeSigner(l net.Listener, key *asymmetric.PrivateKey) (err error) {
+	var server = rpc.NewServer()
+	if err = server.RegisterName(signerServiceName, &SignerService{key: key}); err != nil {
+		return
+	}
+	for {
+		var conn net.Conn
+		if conn, err = l.Accept(); err != nil {
+			return
+		}
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// InitLocalSigner initializes the local key store with the external signer listening on the
+// unix socket path, the local private key is left unset.
+func InitLocalSigner(path string) (err error) {
+	var signer *SocketSigner
+	initLocalKeyStore()
+	if signer, err = NewSocketSigner(path); err != nil {
+		log.WithField("path", path).WithError(err).Error("init external signer failed")
+		return
+	}
+	log.Debugf("\n### Public Key ###\n%#x\n### Public Key ###\n", signer.PubKey().Serialize())
+	SetLocalSigner(signer)
+	return
+}
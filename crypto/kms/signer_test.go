@@ -0,0 +1,77 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSocketSigner(t *testing.T) {
+	Convey("Given an external signer on a unix socket", t, func() {
+		dir, err := ioutil.TempDir("", "signer")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		socket := path.Join(dir, "signer.sock")
+		l, err := net.Listen("unix", socket)
+		So(err, ShouldBeNil)
+		defer l.Close()
+		key, pub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		go ServeSigner(l, key)
+
+		signer, err := NewSocketSigner(socket)
+		So(err, ShouldBeNil)
+		defer signer.Close()
+		So(signer.PubKey().IsEqual(pub), ShouldBeTrue)
+
+		Convey("The hash should be signed by the external key", func() {
+			h := hash.THashH([]byte("hash"))
+			sig, err := signer.Sign(h[:])
+			So(err, ShouldBeNil)
+			So(sig.Verify(h[:], pub), ShouldBeTrue)
+
+			// reconnect after the connection is closed
+			So(signer.Close(), ShouldBeNil)
+			sig, err = signer.Sign(h[:])
+			So(err, ShouldBeNil)
+			So(sig.Verify(h[:], pub), ShouldBeTrue)
+		})
+		Convey("Only hashes should be signed", func() {
+			_, err := signer.Sign([]byte("not a hash"))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("The shared secret should match the key exchange", func() {
+			remote, remotePub, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			secret, err := signer.GenSharedSecret(remotePub)
+			So(err, ShouldBeNil)
+			So(secret, ShouldResemble, asymmetric.GenECDHSharedSecret(remote, pub))
+		})
+	})
+	Convey("The signer should be unavailable if not started", t, func() {
+		_, err := NewSocketSigner(path.Join(os.TempDir(), "no-such-signer.sock"))
+		So(err, ShouldEqual, ErrSignerUnavailable)
+	})
+}
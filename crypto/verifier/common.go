@@ -33,7 +33,7 @@ type MarshalHasher interface {
 // MarshalHasher, can be signed by a private key and verified later.
 type HashSignVerifier interface {
 	Hash() hash.Hash
-	Sign(MarshalHasher, *ca.PrivateKey) error
+	Sign(MarshalHasher, ca.Signer) error
 	Verify(MarshalHasher) error
 }
 
@@ -50,7 +50,7 @@ func (i *DefaultHashSignVerifierImpl) Hash() hash.Hash {
 }
 
 // Sign implements HashSignVerifier.Sign.
-func (i *DefaultHashSignVerifierImpl) Sign(mh MarshalHasher, signer *ca.PrivateKey) (err error) {
+func (i *DefaultHashSignVerifierImpl) Sign(mh MarshalHasher, signer ca.Signer) (err error) {
 	var enc []byte
 	if enc, err = mh.MarshalHash(); err != nil {
 		return
@@ -46,7 +46,7 @@ type MockObject struct {
 	HSV DefaultHashSignVerifierImpl
 }
 
-func (o *MockObject) Sign(signer *asymmetric.PrivateKey) error {
+func (o *MockObject) Sign(signer asymmetric.Signer) error {
 	return o.HSV.Sign(&o.MockHeader, signer)
 }
 
@@ -54,6 +54,26 @@ func (o *MockObject) Verify() error {
 	return o.HSV.Verify(&o.MockHeader)
 }
 
+// MockSigner signs with an in-memory key and records the signed hashes, standing for an
+// external signer.
+type MockSigner struct {
+	key    *asymmetric.PrivateKey
+	hashes [][]byte
+	err    error
+}
+
+func (s *MockSigner) PubKey() *asymmetric.PublicKey {
+	return s.key.PubKey()
+}
+
+func (s *MockSigner) Sign(hash []byte) (*asymmetric.Signature, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.hashes = append(s.hashes, hash)
+	return s.key.Sign(hash)
+}
+
 func TestDefaultHashSignVerifierImpl(t *testing.T) {
 	Convey("Given a dummy object and a pair of keys", t, func() {
 		var (
@@ -99,3 +119,29 @@ func TestDefaultHashSignVerifierImpl(t *testing.T) {
 		})
 	})
 }
+
+func TestDefaultHashSignVerifierImplWithSigner(t *testing.T) {
+	Convey("Given a dummy object and a mock signer", t, func() {
+		var (
+			obj          = &MockObject{}
+			priv, _, err = asymmetric.GenSecp256k1KeyPair()
+			signer       = &MockSigner{key: priv}
+		)
+		So(err, ShouldBeNil)
+		Convey("The object should be signed by the signer", func() {
+			err = obj.Sign(signer)
+			So(err, ShouldBeNil)
+			So(obj.Verify(), ShouldBeNil)
+			So(obj.HSV.Signee.IsEqual(priv.PubKey()), ShouldBeTrue)
+			So(signer.hashes, ShouldHaveLength, 1)
+			h := hash.THashH(MockHash)
+			So(signer.hashes[0], ShouldResemble, h[:])
+		})
+		Convey("The signer error should be returned", func() {
+			signer.err = errors.New("signer unavailable")
+			err = obj.Sign(signer)
+			So(err, ShouldEqual, signer.err)
+			So(obj.HSV.Signature, ShouldBeNil)
+		})
+	})
+}
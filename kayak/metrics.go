@@ -0,0 +1,88 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kayak
+
+import (
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// applyPhases maps the timing fields of the leader apply log to the phase names.
+	applyPhases = map[string]string{
+		"lp": "leader_prepare",
+		"fp": "follower_prepare",
+		"lr": "leader_rollback",
+		"fr": "follower_rollback",
+		"eq": "commit_enqueue",
+		"dq": "commit_dequeue",
+		"lc": "leader_commit",
+		"fc": "follower_commit",
+		"dc": "db_exec",
+	}
+
+	applyLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "covenantsql",
+		Subsystem: "kayak",
+		Name:      "apply_duration_seconds",
+		Help:      "Duration of the kayak leader apply from prepare to commit or rollback.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"instance_id", "result"})
+	applyPhaseLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "covenantsql",
+		Subsystem: "kayak",
+		Name:      "apply_phase_duration_seconds",
+		Help:      "Duration of each phase of the kayak leader apply.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16),
+	}, []string{"instance_id", "phase"})
+)
+
+func init() {
+	prometheus.MustRegister(applyLatency, applyPhaseLatency)
+}
+
+// recordApply records the timing fields of a leader apply, the durations are in nanoseconds.
+func recordApply(instanceID string, fields log.Fields, err error) {
+	for k, v := range fields {
+		d, ok := v.(int64)
+		if !ok {
+			continue
+		}
+		if phase, ok := applyPhases[k]; ok {
+			applyPhaseLatency.WithLabelValues(instanceID, phase).Observe(
+				time.Duration(d).Seconds())
+		} else if k == "t" {
+			result := "succ"
+			if err != nil {
+				result = "fail"
+			}
+			applyLatency.WithLabelValues(instanceID, result).Observe(time.Duration(d).Seconds())
+		}
+	}
+}
+
+// forgetApply removes the apply series of the kayak instance.
+func forgetApply(instanceID string) {
+	for _, result := range []string{"succ", "fail"} {
+		applyLatency.DeleteLabelValues(instanceID, result)
+	}
+	for _, phase := range applyPhases {
+		applyPhaseLatency.DeleteLabelValues(instanceID, phase)
+	}
+}
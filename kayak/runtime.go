@@ -30,6 +30,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/CovenantSQL/CovenantSQL/utils/trace"
 	"github.com/pkg/errors"
 )
 
@@ -144,33 +145,17 @@ func NewRuntime(cfg *kt.RuntimeConfig) (rt *Runtime, err error) {
 		return
 	}
 
-	followers := make([]proto.NodeID, 0, len(peers.Servers))
-	exists := false
-	var role proto.ServerRole
-
-	for _, v := range peers.Servers {
-		if !v.IsEqual(&peers.Leader) {
-			followers = append(followers, v)
-		}
-
-		if v.IsEqual(&cfg.NodeID) {
-			exists = true
-			if v.IsEqual(&peers.Leader) {
-				role = proto.Leader
-			} else {
-				role = proto.Follower
-			}
-		}
-	}
-
-	if !exists {
-		err = errors.Wrapf(kt.ErrNotInPeer, "node %v not in peers %v", cfg.NodeID, peers)
+	var (
+		role      proto.ServerRole
+		followers []proto.NodeID
+	)
+	if role, followers, err = resolvePeers(peers, cfg.NodeID); err != nil {
 		return
 	}
 
 	// calculate fan-out count according to threshold and peers info
-	minPreparedFollowers := int(math.Max(math.Ceil(cfg.PrepareThreshold*float64(len(peers.Servers))), 1) - 1)
-	minCommitFollowers := int(math.Max(math.Ceil(cfg.CommitThreshold*float64(len(peers.Servers))), 1) - 1)
+	minPreparedFollowers := minFollowers(cfg.PrepareThreshold, peers)
+	minCommitFollowers := minFollowers(cfg.CommitThreshold, peers)
 
 	rt = &Runtime{
 		// indexes
@@ -239,6 +224,7 @@ func (r *Runtime) Shutdown() (err error) {
 		close(r.stopCh)
 	}
 	r.wg.Wait()
+	forgetApply(r.instanceID)
 
 	return
 }
@@ -251,6 +237,8 @@ func (r *Runtime) Apply(ctx context.Context, req interface{}) (result interface{
 	var tmStart, tmLeaderPrepare, tmFollowerPrepare, tmCommitEnqueue, tmLeaderRollback,
 		tmRollback, tmCommitDequeue, tmLeaderCommit, tmCommit time.Time
 	var dbCost time.Duration
+	var phaseCtx context.Context
+	var applySpan, phaseSpan *trace.Span
 
 	defer func() {
 		fields := log.Fields{
@@ -289,6 +277,12 @@ func (r *Runtime) Apply(ctx context.Context, req interface{}) (result interface{
 			fields["t"] = tmRollback.Sub(tmStart).Nanoseconds()
 		}
 		log.WithFields(fields).WithError(err).Info("kayak leader apply")
+		if !tmStart.IsZero() {
+			recordApply(r.instanceID, fields, err)
+		}
+		applySpan.SetAttribute("index", logIndex)
+		phaseSpan.End(err)
+		applySpan.End(err)
 	}()
 
 	r.peersLock.RLock()
@@ -301,6 +295,8 @@ func (r *Runtime) Apply(ctx context.Context, req interface{}) (result interface{
 	}
 
 	tmStart = time.Now()
+	ctx, applySpan = trace.StartSpan(ctx, "kayak.Apply")
+	applySpan.SetAttribute("instance", r.instanceID)
 
 	// check prepare in leader
 	if err = r.doCheck(req); err != nil {
@@ -317,11 +313,13 @@ func (r *Runtime) Apply(ctx context.Context, req interface{}) (result interface{
 
 	// create prepare request
 	var prepareLog *kt.Log
+	_, phaseSpan = trace.StartChildSpan(ctx, "kayak.leaderPrepare")
 	if prepareLog, err = r.leaderLogPrepare(encBuf); err != nil {
 		// serve error, leader could not write logs, change leader in block producer
 		// TODO(): CHANGE LEADER
 		return
 	}
+	phaseSpan.End(nil)
 
 	// Leader pending map handling.
 	r.markPendingPrepare(prepareLog.Index)
@@ -330,7 +328,8 @@ func (r *Runtime) Apply(ctx context.Context, req interface{}) (result interface{
 	tmLeaderPrepare = time.Now()
 
 	// send prepare to all nodes
-	prepareTracker := r.rpc(prepareLog, r.minPreparedFollowers)
+	phaseCtx, phaseSpan = trace.StartChildSpan(ctx, "kayak.followerPrepare")
+	prepareTracker := r.rpc(phaseCtx, prepareLog, r.minPreparedFollowers)
 	prepareCtx, prepareCtxCancelFunc := context.WithTimeout(ctx, r.prepareTimeout)
 	defer prepareCtxCancelFunc()
 	prepareErrors, prepareDone, _ := prepareTracker.get(prepareCtx)
@@ -346,8 +345,10 @@ func (r *Runtime) Apply(ctx context.Context, req interface{}) (result interface{
 	}
 
 	tmFollowerPrepare = time.Now()
+	phaseSpan.End(nil)
 
-	commitFuture = r.leaderCommitResult(ctx, req, prepareLog)
+	phaseCtx, phaseSpan = trace.StartChildSpan(ctx, "kayak.commit")
+	commitFuture = r.leaderCommitResult(phaseCtx, req, prepareLog)
 
 	tmCommitEnqueue = time.Now()
 
@@ -386,6 +387,9 @@ func (r *Runtime) Apply(ctx context.Context, req interface{}) (result interface{
 	return
 
 ROLLBACK:
+	phaseSpan.End(err)
+	phaseCtx, phaseSpan = trace.StartChildSpan(ctx, "kayak.rollback")
+
 	// rollback local
 	var rollbackLog *kt.Log
 	var logErr error
@@ -398,7 +402,7 @@ ROLLBACK:
 	tmLeaderRollback = time.Now()
 
 	// async send rollback to all nodes
-	r.rpc(rollbackLog, 0)
+	r.rpc(phaseCtx, rollbackLog, 0)
 
 	tmRollback = time.Now()
 
@@ -407,6 +411,12 @@ ROLLBACK:
 
 // FollowerApply defines entry for follower node.
 func (r *Runtime) FollowerApply(l *kt.Log) (err error) {
+	return r.FollowerApplyWithContext(context.Background(), l)
+}
+
+// FollowerApplyWithContext defines entry for follower node with context, which carries the
+// trace of the leader.
+func (r *Runtime) FollowerApplyWithContext(ctx context.Context, l *kt.Log) (err error) {
 	if l == nil {
 		err = errors.Wrap(kt.ErrInvalidLog, "log is nil")
 		return
@@ -414,12 +424,18 @@ func (r *Runtime) FollowerApply(l *kt.Log) (err error) {
 
 	var tmStart, tmEnd time.Time
 
+	ctx, span := trace.StartChildSpan(ctx, "kayak.followerApply")
+	span.SetAttribute("instance", r.instanceID)
+	span.SetAttribute("type", l.Type)
+	span.SetAttribute("index", l.Index)
+
 	defer func() {
 		log.WithFields(log.Fields{
 			"t": l.Type.String(),
 			"i": l.Index,
 			"c": tmEnd.Sub(tmStart).Nanoseconds(),
 		}).WithError(err).Info("kayak follower apply")
+		span.End(err)
 	}()
 
 	r.peersLock.RLock()
@@ -438,7 +454,7 @@ func (r *Runtime) FollowerApply(l *kt.Log) (err error) {
 	case kt.LogRollback:
 		err = r.followerRollback(l)
 	case kt.LogCommit:
-		err = r.followerCommit(l)
+		err = r.followerCommit(ctx, l)
 	case kt.LogBarrier:
 		// support barrier for log truncation and peer update
 		fallthrough
@@ -456,9 +472,141 @@ func (r *Runtime) FollowerApply(l *kt.Log) (err error) {
 
 // UpdatePeers defines entry for peers update logic.
 func (r *Runtime) UpdatePeers(peers *proto.Peers) (err error) {
+	if peers == nil {
+		err = errors.Wrap(kt.ErrInvalidConfig, "nil peers")
+		return
+	}
+
+	// verify peers
+	if err = peers.Verify(); err != nil {
+		err = errors.Wrap(err, "verify peers during kayak update failed")
+		return
+	}
+
 	r.peersLock.Lock()
 	defer r.peersLock.Unlock()
 
+	if peers.Term < r.peers.Term {
+		err = errors.Wrapf(kt.ErrStalePeers, "term %v is older than current term %v", peers.Term, r.peers.Term)
+		return
+	}
+
+	var (
+		role      proto.ServerRole
+		followers []proto.NodeID
+	)
+	if role, followers, err = resolvePeers(peers, r.nodeID); err != nil {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"instance": r.instanceID,
+		"term":     peers.Term,
+		"leader":   peers.Leader,
+		"role":     role.String(),
+	}).Info("kayak update peers")
+
+	r.peers = peers
+	r.role = role
+	r.followers = followers
+	r.minPreparedFollowers = minFollowers(r.prepareThreshold, peers)
+	r.minCommitFollowers = minFollowers(r.commitThreshold, peers)
+
+	return
+}
+
+// Peers returns current peers.
+func (r *Runtime) Peers() *proto.Peers {
+	r.peersLock.RLock()
+	defer r.peersLock.RUnlock()
+
+	return r.peers
+}
+
+// Fetch returns at most limit logs from the specified index for a peer to catch up, the
+// requester must be in current peers.
+func (r *Runtime) Fetch(requester proto.NodeID, index uint64, limit int) (logs []*kt.Log, err error) {
+	r.peersLock.RLock()
+	defer r.peersLock.RUnlock()
+
+	exists := false
+	for _, s := range r.peers.Servers {
+		if s.IsEqual(&requester) {
+			exists = true
+			break
+		}
+	}
+	if !exists {
+		err = errors.Wrapf(kt.ErrNotInPeer, "node %v not in peers of term %v", requester, r.peers.Term)
+		return
+	}
+
+	r.nextIndexLock.Lock()
+	nextIndex := r.nextIndex
+	r.nextIndexLock.Unlock()
+
+	for i := index; i < nextIndex && len(logs) < limit; i++ {
+		var l *kt.Log
+		if l, err = r.wal.Get(i); err != nil {
+			if len(logs) > 0 {
+				// return logs read so far
+				err = nil
+				return
+			}
+			err = errors.Wrapf(err, "read log %v failed", i)
+			return
+		}
+		logs = append(logs, l)
+	}
+
+	return
+}
+
+// Replay applies a log fetched from another peer to catch up with the peers, the request
+// payload is not checked again since the log is already accepted by the peers. Logs must be
+// replayed in index order, logs already exist in wal are skipped.
+func (r *Runtime) Replay(l *kt.Log) (err error) {
+	if l == nil {
+		err = errors.Wrap(kt.ErrInvalidLog, "log is nil")
+		return
+	}
+
+	if exists, _ := r.wal.Get(l.Index); exists != nil {
+		// already received from leader
+		return
+	}
+
+	r.peersLock.RLock()
+	defer r.peersLock.RUnlock()
+
+	if r.role == proto.Leader {
+		err = kt.ErrNotFollower
+		return
+	}
+
+	switch l.Type {
+	case kt.LogPrepare:
+		if err = r.wal.Write(l); err != nil {
+			err = errors.Wrap(err, "write replay prepare log failed")
+			return
+		}
+		r.markPendingPrepare(l.Index)
+	case kt.LogRollback:
+		err = r.followerRollback(l)
+	case kt.LogCommit:
+		err = r.followerCommit(context.Background(), l)
+	case kt.LogBarrier:
+		fallthrough
+	case kt.LogNoop:
+		err = r.followerNoop(l)
+	default:
+		err = errors.Wrapf(kt.ErrInvalidLog, "invalid log type: %v", l.Type)
+	}
+
+	if err == nil {
+		r.updateNextIndex(l)
+	}
+
 	return
 }
 
@@ -527,7 +675,7 @@ func (r *Runtime) followerRollback(l *kt.Log) (err error) {
 	return
 }
 
-func (r *Runtime) followerCommit(l *kt.Log) (err error) {
+func (r *Runtime) followerCommit(ctx context.Context, l *kt.Log) (err error) {
 	var prepareLog *kt.Log
 	var lastCommit uint64
 	if lastCommit, prepareLog, err = r.getPrepareLog(l); err != nil {
@@ -541,7 +689,8 @@ func (r *Runtime) followerCommit(l *kt.Log) (err error) {
 		return
 	}
 
-	cResult := <-r.followerCommitResult(context.Background(), l, prepareLog, lastCommit)
+	// commit should never be canceled, but the trace is continued
+	cResult := <-r.followerCommitResult(trace.Detach(ctx), l, prepareLog, lastCommit)
 	if cResult != nil {
 		err = cResult.err
 	}
@@ -686,14 +835,14 @@ func (r *Runtime) leaderDoCommit(req *commitReq) (dbCost time.Duration, tracker
 
 	// not wrapping underlying handler commit error
 	tmStartDB := time.Now()
-	result, err = r.sh.Commit(req.data)
+	result, err = r.handlerCommit(req)
 	dbCost = time.Now().Sub(tmStartDB)
 
 	// mark last commit
 	atomic.StoreUint64(&r.lastCommit, l.Index)
 
 	// send commit
-	tracker = r.rpc(l, r.minCommitFollowers)
+	tracker = r.rpc(req.ctx, l, r.minCommitFollowers)
 
 	// TODO(): text log for rpc errors
 
@@ -710,12 +859,17 @@ func (r *Runtime) followerDoCommit(req *commitReq) (err error) {
 
 	// check for last commit availability
 	myLastCommit := atomic.LoadUint64(&r.lastCommit)
-	if req.lastCommit != myLastCommit {
+	if req.lastCommit > myLastCommit {
 		// TODO(): need counter for retries, infinite commit re-order would cause troubles
 		go func(req *commitReq) {
 			r.commitCh <- req
 		}(req)
 		return
+	} else if req.lastCommit < myLastCommit {
+		// committed by a replayed log or by the leader during replay
+		err = errors.Wrap(kt.ErrInvalidLog, "log already committed")
+		req.result <- &commitResult{err: err}
+		return
 	}
 
 	// write log first
@@ -725,7 +879,7 @@ func (r *Runtime) followerDoCommit(req *commitReq) (err error) {
 	}
 
 	// do commit, not wrapping underlying handler commit error
-	_, err = r.sh.Commit(req.data)
+	_, err = r.handlerCommit(req)
 
 	// mark last commit
 	atomic.StoreUint64(&r.lastCommit, req.log.Index)
@@ -735,6 +889,18 @@ func (r *Runtime) followerDoCommit(req *commitReq) (err error) {
 	return
 }
 
+// handlerCommit commits the request by the underlying handler, the trace context is passed
+// to the request payload implementing proto.EnvelopeAPI.
+func (r *Runtime) handlerCommit(req *commitReq) (result interface{}, err error) {
+	ctx, span := trace.StartChildSpan(req.ctx, "kayak.handlerCommit")
+	if e, ok := req.data.(proto.EnvelopeAPI); ok && span != nil {
+		e.SetContext(ctx)
+	}
+	result, err = r.sh.Commit(req.data)
+	span.End(err)
+	return
+}
+
 func (r *Runtime) getPrepareLog(l *kt.Log) (lastCommitIndex uint64, pl *kt.Log, err error) {
 	var prepareIndex uint64
 
@@ -886,14 +1052,49 @@ func (r *Runtime) errorSummary(errs map[proto.NodeID]error) error {
 	return errors.Wrapf(kt.ErrPrepareFailed, "fail on nodes: %v", failNodes)
 }
 
+// resolvePeers returns the role of the node and the followers in peers.
+func resolvePeers(peers *proto.Peers, nodeID proto.NodeID) (
+	role proto.ServerRole, followers []proto.NodeID, err error,
+) {
+	followers = make([]proto.NodeID, 0, len(peers.Servers))
+	exists := false
+
+	for _, v := range peers.Servers {
+		if !v.IsEqual(&peers.Leader) {
+			followers = append(followers, v)
+		}
+
+		if v.IsEqual(&nodeID) {
+			exists = true
+			if v.IsEqual(&peers.Leader) {
+				role = proto.Leader
+			} else {
+				role = proto.Follower
+			}
+		}
+	}
+
+	if !exists {
+		err = errors.Wrapf(kt.ErrNotInPeer, "node %v not in peers %v", nodeID, peers)
+	}
+
+	return
+}
+
+// minFollowers returns the min follower count to satisfy the threshold.
+func minFollowers(threshold float64, peers *proto.Peers) int {
+	return int(math.Max(math.Ceil(threshold*float64(len(peers.Servers))), 1) - 1)
+}
+
 /// rpc related
-func (r *Runtime) rpc(l *kt.Log, minCount int) (tracker *rpcTracker) {
+func (r *Runtime) rpc(ctx context.Context, l *kt.Log, minCount int) (tracker *rpcTracker) {
 	req := &kt.RPCRequest{
 		Instance: r.instanceID,
 		Log:      l,
 	}
 
 	tracker = newTracker(r, req, minCount)
+	tracker.ctx = ctx
 	tracker.send()
 
 	// TODO(): track this rpc
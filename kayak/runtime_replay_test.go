@@ -0,0 +1,179 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kayak_test
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/kayak"
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	kl "github.com/CovenantSQL/CovenantSQL/kayak/wal"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type memHandler struct {
+	sync.Mutex
+	committed []string
+}
+
+func (h *memHandler) EncodePayload(request interface{}) (data []byte, err error) {
+	var buf *bytes.Buffer
+	if buf, err = utils.EncodeMsgPack(request); err != nil {
+		return
+	}
+	data = buf.Bytes()
+	return
+}
+
+func (h *memHandler) DecodePayload(data []byte) (request interface{}, err error) {
+	var s string
+	if err = utils.DecodeMsgPack(data, &s); err != nil {
+		return
+	}
+	request = s
+	return
+}
+
+func (h *memHandler) Check(request interface{}) (err error) {
+	if _, ok := request.(string); !ok {
+		err = errors.New("invalid data")
+	}
+	return
+}
+
+func (h *memHandler) Commit(request interface{}) (result interface{}, err error) {
+	h.Lock()
+	defer h.Unlock()
+	h.committed = append(h.committed, request.(string))
+	return
+}
+
+func (h *memHandler) getCommitted() []string {
+	h.Lock()
+	defer h.Unlock()
+	return append([]string(nil), h.committed...)
+}
+
+type directCaller struct {
+	rt *kayak.Runtime
+}
+
+func (c *directCaller) Call(method string, req interface{}, resp interface{}) (err error) {
+	return c.rt.FollowerApply(req.(*kt.RPCRequest).Log)
+}
+
+func TestRuntimeCatchUp(t *testing.T) {
+	Convey("new peer catches up by replaying logs of leader", t, func() {
+		node1 := proto.NodeID("000005aa62048f85da4ae9698ed59c14ec0d48a88a07c15a32265634e7e64ade")
+		node2 := proto.NodeID("000005f4f22c06f76c43c4f48d5a7ec1309cc94030cbf9ebae814172884ac8b5")
+		privKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+
+		peers1 := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Term:    1,
+				Leader:  node1,
+				Servers: []proto.NodeID{node1},
+			},
+		}
+		err = peers1.Sign(privKey)
+		So(err, ShouldBeNil)
+		peers2 := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Term:    2,
+				Leader:  node1,
+				Servers: []proto.NodeID{node1, node2},
+			},
+		}
+		err = peers2.Sign(privKey)
+		So(err, ShouldBeNil)
+
+		newRuntime := func(h kt.Handler, peers *proto.Peers, nodeID proto.NodeID) *kayak.Runtime {
+			rt, err := kayak.NewRuntime(&kt.RuntimeConfig{
+				Handler:          h,
+				PrepareThreshold: 1.0,
+				CommitThreshold:  1.0,
+				PrepareTimeout:   time.Second,
+				CommitTimeout:    10 * time.Second,
+				Peers:            peers,
+				Wal:              kl.NewMemWal(),
+				NodeID:           nodeID,
+				ServiceName:      "Test",
+				MethodName:       "Call",
+			})
+			So(err, ShouldBeNil)
+			So(rt.Start(), ShouldBeNil)
+			return rt
+		}
+
+		h1, h2 := &memHandler{}, &memHandler{}
+		rt1 := newRuntime(h1, peers1, node1)
+		defer rt1.Shutdown()
+
+		for _, q := range []string{"q1", "q2", "q3"} {
+			_, _, err = rt1.Apply(context.Background(), q)
+			So(err, ShouldBeNil)
+		}
+
+		// not a peer yet
+		_, err = rt1.Fetch(node2, 0, 100)
+		So(errors.Cause(err), ShouldEqual, kt.ErrNotInPeer)
+
+		rt2 := newRuntime(h2, peers2, node2)
+		defer rt2.Shutdown()
+		rt1.SetCaller(node2, &directCaller{rt: rt2})
+
+		err = rt1.UpdatePeers(peers2)
+		So(err, ShouldBeNil)
+		err = rt1.UpdatePeers(peers1)
+		So(errors.Cause(err), ShouldEqual, kt.ErrStalePeers)
+
+		logs, err := rt1.Fetch(node2, 0, 4)
+		So(err, ShouldBeNil)
+		So(logs, ShouldHaveLength, 4)
+		more, err := rt1.Fetch(node2, 4, 4)
+		So(err, ShouldBeNil)
+		So(more, ShouldHaveLength, 2)
+		logs = append(logs, more...)
+
+		for _, l := range logs {
+			So(rt2.Replay(l), ShouldBeNil)
+		}
+		// replayed logs are skipped
+		So(rt2.Replay(logs[0]), ShouldBeNil)
+		So(h2.getCommitted(), ShouldResemble, []string{"q1", "q2", "q3"})
+
+		// new logs are sent to the new peer directly
+		_, _, err = rt1.Apply(context.Background(), "q4")
+		So(err, ShouldBeNil)
+		So(h2.getCommitted(), ShouldResemble, []string{"q1", "q2", "q3", "q4"})
+		So(h1.getCommitted(), ShouldResemble, h2.getCommitted())
+
+		// leader can't replay logs
+		So(rt1.Replay(logs[0]), ShouldBeNil)
+		err = rt1.Replay(&kt.Log{LogHeader: kt.LogHeader{Index: 100, Type: kt.LogNoop}})
+		So(err, ShouldEqual, kt.ErrNotFollower)
+	})
+}
@@ -21,7 +21,9 @@ import (
 	"sync"
 	"sync/atomic"
 
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/trace"
 )
 
 // rpcTracker defines the rpc call tracker
@@ -29,6 +31,8 @@ import (
 type rpcTracker struct {
 	// related runtime
 	r *Runtime
+	// context carrying the trace of the rpc
+	ctx context.Context
 	// target nodes, a copy of current followers
 	nodes []proto.NodeID
 	// rpc method
@@ -62,6 +66,7 @@ func newTracker(r *Runtime, req interface{}, minCount int) (t *rpcTracker) {
 
 	t = &rpcTracker{
 		r:        r,
+		ctx:      context.Background(),
 		nodes:    nodes,
 		method:   r.rpcMethod,
 		req:      req,
@@ -89,7 +94,19 @@ func (t *rpcTracker) send() {
 }
 
 func (t *rpcTracker) callSingle(idx int) {
-	err := t.r.getCaller(t.nodes[idx]).Call(t.method, t.req, nil)
+	req := t.req
+	ctx, span := trace.StartChildSpan(t.ctx, "kayak.followerRPC")
+	if rpcReq, ok := t.req.(*kt.RPCRequest); ok && span != nil {
+		// copy the request to carry the span of each follower
+		traced := *rpcReq
+		trace.Inject(ctx, &traced.Envelope)
+		req = &traced
+		span.SetAttribute("node", t.nodes[idx])
+		span.SetAttribute("type", rpcReq.Log.Type)
+		span.SetAttribute("index", rpcReq.Log.Index)
+	}
+	err := t.r.getCaller(t.nodes[idx]).Call(t.method, req, nil)
+	span.End(err)
 	defer t.wg.Done()
 	t.errLock.Lock()
 	defer t.errLock.Unlock()
@@ -35,4 +35,6 @@ var (
 	ErrNeedRecovery = errors.New("need recovery")
 	// ErrInvalidConfig represents invalid kayak runtime config.
 	ErrInvalidConfig = errors.New("invalid runtime config")
+	// ErrStalePeers represents the updating peers is older than current peers.
+	ErrStalePeers = errors.New("stale peers")
 )
@@ -24,3 +24,16 @@ type RPCRequest struct {
 	Instance string
 	Log      *Log
 }
+
+// FetchRequest defines the log fetch request entity for a peer to catch up.
+type FetchRequest struct {
+	proto.Envelope
+	Instance string
+	Index    uint64
+	Limit    int
+}
+
+// FetchResponse defines the log fetch response entity.
+type FetchResponse struct {
+	Logs []*Log
+}
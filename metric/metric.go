@@ -22,6 +22,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/version"
+	metrics "github.com/rcrowley/go-metrics"
 )
 
 const (
@@ -42,7 +43,10 @@ const (
 )
 
 func init() {
-	prometheus.MustRegister(version.NewCollector("CovenantSQL"))
+	prometheus.MustRegister(
+		version.NewCollector("CovenantSQL"),
+		NewGoMetricsCollector(GoMetricsNamespace, metrics.DefaultRegistry),
+	)
 }
 
 // StartMetricCollector starts collector registered in NewNodeCollector()
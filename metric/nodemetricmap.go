@@ -18,6 +18,7 @@ package metric
 
 import (
 	"sync"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
@@ -37,6 +38,23 @@ type FilterFunc func(key proto.NodeID, value MetricMap) bool
 // NodeMetricMap is sync.Map version of map[proto.NodeID]MetricMap.
 type NodeMetricMap struct {
 	sync.Map // map[proto.NodeID]MetricMap
+
+	lastSeen sync.Map // map[proto.NodeID]time.Time
+}
+
+// Update stores the node metrics and records the time of upload.
+func (nmm *NodeMetricMap) Update(nodeID proto.NodeID, metrics MetricMap) {
+	nmm.Store(nodeID, metrics)
+	nmm.lastSeen.Store(nodeID, time.Now())
+}
+
+// LastSeen returns the last time the node uploaded metrics.
+func (nmm *NodeMetricMap) LastSeen(nodeID proto.NodeID) (t time.Time, ok bool) {
+	var v interface{}
+	if v, ok = nmm.lastSeen.Load(nodeID); ok {
+		t, ok = v.(time.Time)
+	}
+	return
 }
 
 // FilterNode return node id slice make filterFunc return true.
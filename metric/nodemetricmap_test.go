@@ -18,6 +18,7 @@ package metric
 
 import (
 	"testing"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
@@ -76,6 +77,17 @@ func TestCollectServer_FilterNode(t *testing.T) {
 		ids2 := nmm.FilterNode(filterFalse)
 		So(len(ids2), ShouldEqual, 0)
 	})
+	Convey("node last seen", t, func() {
+		nmm := NodeMetricMap{}
+		_, ok := nmm.LastSeen(proto.NodeID("node1"))
+		So(ok, ShouldBeFalse)
+		before := time.Now()
+		nmm.Update(proto.NodeID("node1"), MetricMap{})
+		seen, ok := nmm.LastSeen(proto.NodeID("node1"))
+		So(ok, ShouldBeTrue)
+		So(seen, ShouldHappenOnOrAfter, before)
+		So(nmm.GetMetrics([]proto.NodeID{"node1"}), ShouldContainKey, proto.NodeID("node1"))
+	})
 	Convey("filter metrics", t, func() {
 		cc := NewCollectClient()
 		mfs, _ := cc.Registry.Gather()
@@ -0,0 +1,166 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metric
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+const (
+	// GoMetricsNamespace defines the namespace of the go-metrics bridged to prometheus.
+	GoMetricsNamespace = "covenantsql"
+	// MetricsPath defines the http path to serve the prometheus metrics.
+	MetricsPath = "/metrics"
+)
+
+var (
+	goMetricsQuantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+)
+
+// GoMetricsCollector defines the prometheus collector which exports the metrics registered
+// in a go-metrics registry, the metric names are sanitized and prefixed by the namespace.
+type GoMetricsCollector struct {
+	namespace string
+	registry  metrics.Registry
+}
+
+// NewGoMetricsCollector returns a new GoMetricsCollector of the go-metrics registry.
+func NewGoMetricsCollector(namespace string, registry metrics.Registry) *GoMetricsCollector {
+	return &GoMetricsCollector{
+		namespace: namespace,
+		registry:  registry,
+	}
+}
+
+// Describe implements prometheus.Collector.Describe, no description is sent as the metrics
+// of the registry are registered dynamically, which makes the collector an unchecked one.
+func (c *GoMetricsCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector.Collect.
+func (c *GoMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.registry.Each(func(name string, i interface{}) {
+		var fqName = goMetricsName(c.namespace, name)
+		switch m := i.(type) {
+		case metrics.Counter:
+			ch <- prometheus.MustNewConstMetric(
+				newGoMetricsDesc(fqName, name), prometheus.GaugeValue, float64(m.Count()))
+		case metrics.Gauge:
+			ch <- prometheus.MustNewConstMetric(
+				newGoMetricsDesc(fqName, name), prometheus.GaugeValue, float64(m.Value()))
+		case metrics.GaugeFloat64:
+			ch <- prometheus.MustNewConstMetric(
+				newGoMetricsDesc(fqName, name), prometheus.GaugeValue, m.Value())
+		case metrics.Meter:
+			ch <- prometheus.MustNewConstMetric(
+				newGoMetricsDesc(fqName+"_total", name), prometheus.CounterValue,
+				float64(m.Snapshot().Count()))
+		case metrics.Histogram:
+			s := m.Snapshot()
+			ch <- prometheus.MustNewConstSummary(
+				newGoMetricsDesc(fqName, name), uint64(s.Count()), float64(s.Sum()),
+				goMetricsSummary(s.Percentiles(goMetricsQuantiles), 1))
+		case metrics.Timer:
+			// timers record durations in nanoseconds
+			s := m.Snapshot()
+			ch <- prometheus.MustNewConstSummary(
+				newGoMetricsDesc(fqName+"_seconds", name), uint64(s.Count()),
+				float64(s.Sum())/float64(time.Second),
+				goMetricsSummary(s.Percentiles(goMetricsQuantiles), float64(time.Second)))
+		}
+	})
+}
+
+func newGoMetricsDesc(fqName, name string) *prometheus.Desc {
+	return prometheus.NewDesc(fqName, "go-metrics: "+name, nil, nil)
+}
+
+func goMetricsSummary(values []float64, unit float64) (quantiles map[float64]float64) {
+	quantiles = make(map[float64]float64, len(goMetricsQuantiles))
+	for i, q := range goMetricsQuantiles {
+		quantiles[q] = values[i] / unit
+	}
+	return
+}
+
+// goMetricsName converts a go-metrics name such as "rpc-client-latency-DBS.Query" to a valid
+// prometheus metric name by replacing the invalid characters with underscores.
+func goMetricsName(namespace, name string) string {
+	return prometheus.BuildFQName(namespace, "", strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, name))
+}
+
+// Handler returns the http handler serving the metrics of the gatherer in the format
+// negotiated with the scraper.
+func Handler(gatherer prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mfs, err := gatherer.Gather()
+		if err != nil {
+			// partial results are still served
+			log.WithError(err).Warning("gather metrics failed")
+			if len(mfs) == 0 {
+				http.Error(rw, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		contentType := expfmt.Negotiate(req.Header)
+		rw.Header().Set("Content-Type", string(contentType))
+		enc := expfmt.NewEncoder(rw, contentType)
+		for _, mf := range mfs {
+			if err = enc.Encode(mf); err != nil {
+				log.WithError(err).Warning("encode metrics failed")
+				return
+			}
+		}
+	})
+}
+
+// StartMetricWeb starts the http server serving the prometheus metrics on addr, including
+// the default prometheus registry, the go-metrics default registry and the node collectors.
+func StartMetricWeb(addr string) (server *http.Server, err error) {
+	var l net.Listener
+	if l, err = net.Listen("tcp", addr); err != nil {
+		return
+	}
+
+	gatherers := prometheus.Gatherers{prometheus.DefaultGatherer}
+	if reg := StartMetricCollector(); reg != nil {
+		gatherers = append(gatherers, reg)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, Handler(gatherers))
+	server = &http.Server{Addr: l.Addr().String(), Handler: mux}
+
+	go func() {
+		if err := server.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("serve metric web failed")
+		}
+	}()
+	log.WithField("addr", server.Addr).Info("metric web started")
+	return
+}
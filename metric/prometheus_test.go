@@ -0,0 +1,96 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metric
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metrics "github.com/rcrowley/go-metrics"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGoMetricsCollector(t *testing.T) {
+	Convey("test go-metrics bridged to prometheus", t, func() {
+		r := metrics.NewRegistry()
+		metrics.GetOrRegisterMeter("db-query-succ", r).Mark(3)
+		metrics.GetOrRegisterCounter("conn-count", r).Inc(2)
+		metrics.GetOrRegisterGauge("pending", r).Update(5)
+		metrics.GetOrRegisterTimer("rpc-client-latency-DBS.Query", r).Update(2 * time.Second)
+		metrics.GetOrRegisterHistogram("size", r, metrics.NewUniformSample(16)).Update(7)
+
+		reg := prometheus.NewRegistry()
+		So(reg.Register(NewGoMetricsCollector("test", r)), ShouldBeNil)
+		mfs, err := reg.Gather()
+		So(err, ShouldBeNil)
+
+		families := make(map[string]float64)
+		for _, mf := range mfs {
+			m := mf.GetMetric()[0]
+			switch {
+			case m.GetCounter() != nil:
+				families[mf.GetName()] = m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				families[mf.GetName()] = m.GetGauge().GetValue()
+			case m.GetSummary() != nil:
+				families[mf.GetName()] = m.GetSummary().GetSampleSum()
+			}
+		}
+		So(families, ShouldResemble, map[string]float64{
+			"test_db_query_succ_total":                  3,
+			"test_conn_count":                           2,
+			"test_pending":                              5,
+			"test_rpc_client_latency_DBS_Query_seconds": 2,
+			"test_size":                                 7,
+		})
+
+		srv := httptest.NewServer(Handler(reg))
+		defer srv.Close()
+		resp, err := http.Get(srv.URL)
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		So(err, ShouldBeNil)
+		So(string(body), ShouldContainSubstring, "test_db_query_succ_total 3")
+		So(string(body), ShouldContainSubstring, `test_rpc_client_latency_DBS_Query_seconds{quantile="0.5"} 2`)
+	})
+}
+
+func TestStartMetricWeb(t *testing.T) {
+	Convey("test metric web", t, func() {
+		server, err := StartMetricWeb("127.0.0.1:0")
+		So(err, ShouldBeNil)
+		So(server, ShouldNotBeNil)
+		defer server.Close()
+
+		metrics.GetOrRegisterMeter("test-metric-web", nil).Mark(1)
+		resp, err := http.Get("http://" + server.Addr + MetricsPath)
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		So(err, ShouldBeNil)
+		So(string(body), ShouldContainSubstring, "CovenantSQL_build_info")
+		So(string(body), ShouldContainSubstring, "covenantsql_test_metric_web_total 1")
+
+		_, err = StartMetricWeb("invalid address")
+		So(err, ShouldNotBeNil)
+	})
+}
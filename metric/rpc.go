@@ -95,7 +95,7 @@ func (cs *CollectServer) UploadMetrics(req *proto.UploadMetricsReq, resp *proto.
 	}
 	//log.Debugf("MetricFamily uploaded: %v, %v", reqNodeID, mfm)
 	if len(mfm) > 0 {
-		cs.NodeMetric.Store(reqNodeID, mfm)
+		cs.NodeMetric.Update(reqNodeID, mfm)
 	} else {
 		err = errors.New("no valid metric received")
 		log.Error(err)
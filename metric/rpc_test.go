@@ -62,6 +62,9 @@ func TestCollectClient_UploadMetrics(t *testing.T) {
 		err = cc.UploadMetrics(serverNodeID)
 		v, ok := cs.NodeMetric.Load(serverNodeID)
 		So(ok, ShouldBeTrue)
+		seen, ok := cs.NodeMetric.LastSeen(serverNodeID)
+		So(ok, ShouldBeTrue)
+		So(seen, ShouldHappenWithin, time.Minute, time.Now())
 		//log.Debugf("NodeMetric：%#v", v)
 
 		m, _ := v.(MetricMap)
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proto
+
+import (
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+)
+
+//go:generate hsp
+
+const (
+	// DefaultNodeRecordTTL defines the default time to live of a node record, the node should
+	// publish a new record before the old one expires.
+	DefaultNodeRecordTTL = time.Hour
+	// MaxNodeRecordTTL defines the max time to live of a node record accepted by the server,
+	// a larger TTL is capped to it.
+	MaxNodeRecordTTL = 24 * time.Hour
+	// MaxNodeRecordClockSkew defines the max clock skew of the node record timestamp, the record
+	// signed later than now plus the skew is rejected.
+	MaxNodeRecordClockSkew = 5 * time.Minute
+)
+
+// NodeRecordHeader defines the node address record content. A record with larger Seq
+// replaces the older one, the record expires TTL (capped to MaxNodeRecordTTL) after Timestamp.
+type NodeRecordHeader struct {
+	Node      Node
+	Seq       uint64
+	Timestamp time.Time
+	TTL       time.Duration
+}
+
+// NodeRecord defines the node address record signed by the node itself, the records are
+// exchanged between nodes in the kademlia routing.
+type NodeRecord struct {
+	NodeRecordHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Sign generates signature.
+func (r *NodeRecord) Sign(signer asymmetric.Signer) (err error) {
+	return r.DefaultHashSignVerifierImpl.Sign(&r.NodeRecordHeader, signer)
+}
+
+// Verify verify signature.
+func (r *NodeRecord) Verify() (err error) {
+	return r.DefaultHashSignVerifierImpl.Verify(&r.NodeRecordHeader)
+}
+
+// ExpireTime returns the expire time of the node record, the TTL is capped to MaxNodeRecordTTL.
+func (r *NodeRecord) ExpireTime() time.Time {
+	ttl := r.TTL
+	if ttl > MaxNodeRecordTTL {
+		ttl = MaxNodeRecordTTL
+	}
+	return r.Timestamp.Add(ttl)
+}
+
+// IsInFuture returns if the node record is signed later than the time plus
+// MaxNodeRecordClockSkew.
+func (r *NodeRecord) IsInFuture(now time.Time) bool {
+	return r.Timestamp.After(now.Add(MaxNodeRecordClockSkew))
+}
+
+// IsExpired returns if the node record is expired at the time, a record without TTL is always
+// expired.
+func (r *NodeRecord) IsExpired(now time.Time) bool {
+	return r.TTL <= 0 || !now.Before(r.ExpireTime())
+}
+
+// IsSigned returns if the node record carries a signature, the unsigned records are only set
+// by the server to expire the nodes registered without a record.
+func (r *NodeRecord) IsSigned() bool {
+	return r.Signee != nil && r.Signature != nil
+}
+
+// IsNewerThan returns if the node record supersedes the other record of the same node.
+func (r *NodeRecord) IsNewerThan(other *NodeRecord) bool {
+	return other == nil || r.Seq > other.Seq
+}
+
+// FindClosestReq is FindClosest RPC request, Record is the signed record of the caller which
+// is added to the routing table of the callee.
+type FindClosestReq struct {
+	Target NodeID
+	Count  int
+	Record *NodeRecord
+	Envelope
+}
+
+// FindClosestResp is FindClosest RPC response
+type FindClosestResp struct {
+	Records []NodeRecord
+	Envelope
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNodeRecord(t *testing.T) {
+	Convey("test node record expiration and sequence", t, func() {
+		now := time.Now()
+		r := &NodeRecord{
+			NodeRecordHeader: NodeRecordHeader{
+				Seq:       2,
+				Timestamp: now,
+				TTL:       time.Minute,
+			},
+		}
+		So(r.ExpireTime(), ShouldEqual, now.Add(time.Minute))
+		So(r.IsExpired(now), ShouldBeFalse)
+		So(r.IsExpired(now.Add(time.Minute)), ShouldBeTrue)
+
+		noTTL := &NodeRecord{NodeRecordHeader: NodeRecordHeader{Timestamp: now}}
+		So(noTTL.IsExpired(now), ShouldBeTrue)
+
+		// ttl is capped and future timestamp is detected
+		longTTL := &NodeRecord{NodeRecordHeader: NodeRecordHeader{Timestamp: now, TTL: 100 * MaxNodeRecordTTL}}
+		So(longTTL.ExpireTime(), ShouldEqual, now.Add(MaxNodeRecordTTL))
+		So(longTTL.IsExpired(now.Add(MaxNodeRecordTTL)), ShouldBeTrue)
+		So(r.IsInFuture(now), ShouldBeFalse)
+		So(r.IsInFuture(now.Add(-MaxNodeRecordClockSkew)), ShouldBeFalse)
+		So(r.IsInFuture(now.Add(-MaxNodeRecordClockSkew-time.Second)), ShouldBeTrue)
+
+		So(r.IsSigned(), ShouldBeFalse)
+		So(r.IsNewerThan(nil), ShouldBeTrue)
+		So(r.IsNewerThan(&NodeRecord{NodeRecordHeader: NodeRecordHeader{Seq: 1}}), ShouldBeTrue)
+		So(r.IsNewerThan(&NodeRecord{NodeRecordHeader: NodeRecordHeader{Seq: 2}}), ShouldBeFalse)
+
+		// seq, timestamp and ttl are signed
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		So(r.Sign(priv), ShouldBeNil)
+		So(r.IsSigned(), ShouldBeTrue)
+		So(r.Verify(), ShouldBeNil)
+		r.TTL = time.Hour
+		So(r.Verify(), ShouldNotBeNil)
+		r.TTL = time.Minute
+		r.Seq = 3
+		So(r.Verify(), ShouldNotBeNil)
+	})
+}
@@ -31,27 +31,37 @@ type EnvelopeAPI interface {
 	GetTTL() time.Duration
 	GetExpire() time.Duration
 	GetNodeID() *RawNodeID
+	GetTraceID() string
+	GetSpanID() string
 	GetContext() context.Context
 
 	SetVersion(string)
 	SetTTL(time.Duration)
 	SetExpire(time.Duration)
 	SetNodeID(*RawNodeID)
+	SetTraceID(string)
+	SetSpanID(string)
 	SetContext(context.Context)
 }
 
-// Envelope is the protocol header
+// Envelope is the protocol header, TraceID and SpanID propagate the trace context of the
+// caller as hex strings.
 type Envelope struct {
 	Version string          `json:"v"`
 	TTL     time.Duration   `json:"t"`
 	Expire  time.Duration   `json:"e"`
 	NodeID  *RawNodeID      `json:"id"`
+	TraceID string          `json:"tid,omitempty"`
+	SpanID  string          `json:"sid,omitempty"`
 	_ctx    context.Context `json:"-"`
 }
 
 // PingReq is Ping RPC request
 type PingReq struct {
 	Node Node
+	// Record is the node address record signed by the node, the signed record supersedes the
+	// unsigned Node.
+	Record *NodeRecord
 	Envelope
 }
 
@@ -97,8 +107,9 @@ type FindNodeReq struct {
 
 // FindNodeResp is FindNode RPC response
 type FindNodeResp struct {
-	Node *Node
-	Msg  string
+	Node   *Node
+	Record *NodeRecord
+	Msg    string
 	Envelope
 }
 
@@ -124,6 +135,16 @@ func (e *Envelope) GetNodeID() *RawNodeID {
 	return e.NodeID
 }
 
+// GetTraceID implements EnvelopeAPI.GetTraceID
+func (e *Envelope) GetTraceID() string {
+	return e.TraceID
+}
+
+// GetSpanID implements EnvelopeAPI.GetSpanID
+func (e *Envelope) GetSpanID() string {
+	return e.SpanID
+}
+
 // GetContext returns context from envelop which is set in server Accept
 func (e *Envelope) GetContext() context.Context {
 	if e._ctx == nil {
@@ -152,6 +173,16 @@ func (e *Envelope) SetNodeID(nodeID *RawNodeID) {
 	e.NodeID = nodeID
 }
 
+// SetTraceID implements EnvelopeAPI.SetTraceID
+func (e *Envelope) SetTraceID(traceID string) {
+	e.TraceID = traceID
+}
+
+// SetSpanID implements EnvelopeAPI.SetSpanID
+func (e *Envelope) SetSpanID(spanID string) {
+	e.SpanID = spanID
+}
+
 // SetContext set a ctx in envelope
 func (e *Envelope) SetContext(ctx context.Context) {
 	e._ctx = ctx
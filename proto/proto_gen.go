@@ -24,8 +24,8 @@ func (z DatabaseID) Msgsize() (s int) {
 func (z *Envelope) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 4
-	o = append(o, 0x84, 0x84)
+	// map header, size 6
+	o = append(o, 0x86, 0x86)
 	if z.NodeID == nil {
 		o = hsp.AppendNil(o)
 	} else {
@@ -35,11 +35,15 @@ func (z *Envelope) MarshalHash() (o []byte, err error) {
 			o = hsp.AppendBytes(o, oTemp)
 		}
 	}
-	o = append(o, 0x84)
+	o = append(o, 0x86)
 	o = hsp.AppendString(o, z.Version)
-	o = append(o, 0x84)
+	o = append(o, 0x86)
+	o = hsp.AppendString(o, z.TraceID)
+	o = append(o, 0x86)
+	o = hsp.AppendString(o, z.SpanID)
+	o = append(o, 0x86)
 	o = hsp.AppendInt64(o, int64(z.TTL))
-	o = append(o, 0x84)
+	o = append(o, 0x86)
 	o = hsp.AppendInt64(o, int64(z.Expire))
 	return
 }
@@ -52,7 +56,7 @@ func (z *Envelope) Msgsize() (s int) {
 	} else {
 		s += z.NodeID.Msgsize()
 	}
-	s += 8 + hsp.StringPrefixSize + len(z.Version) + 4 + hsp.Int64Size + 7 + hsp.Int64Size
+	s += 8 + hsp.StringPrefixSize + len(z.Version) + 8 + hsp.StringPrefixSize + len(z.TraceID) + 7 + hsp.StringPrefixSize + len(z.SpanID) + 4 + hsp.Int64Size + 7 + hsp.Int64Size
 	return
 }
 
@@ -162,8 +166,8 @@ func (z *FindNodeReq) Msgsize() (s int) {
 func (z *FindNodeResp) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 3
-	o = append(o, 0x83, 0x83)
+	// map header, size 4
+	o = append(o, 0x84, 0x84)
 	if z.Node == nil {
 		o = hsp.AppendNil(o)
 	} else {
@@ -173,13 +177,23 @@ func (z *FindNodeResp) MarshalHash() (o []byte, err error) {
 			o = hsp.AppendBytes(o, oTemp)
 		}
 	}
-	o = append(o, 0x83)
+	o = append(o, 0x84)
+	if z.Record == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.Record.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x84)
 	if oTemp, err := z.Envelope.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x83)
+	o = append(o, 0x84)
 	o = hsp.AppendString(o, z.Msg)
 	return
 }
@@ -192,6 +206,12 @@ func (z *FindNodeResp) Msgsize() (s int) {
 	} else {
 		s += z.Node.Msgsize()
 	}
+	s += 7
+	if z.Record == nil {
+		s += hsp.NilSize
+	} else {
+		s += z.Record.Msgsize()
+	}
 	s += 9 + z.Envelope.Msgsize() + 4 + hsp.StringPrefixSize + len(z.Msg)
 	return
 }
@@ -200,14 +220,24 @@ func (z *FindNodeResp) Msgsize() (s int) {
 func (z *PingReq) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 2
-	o = append(o, 0x82, 0x82)
+	// map header, size 3
+	o = append(o, 0x83, 0x83)
+	if z.Record == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.Record.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x83)
 	if oTemp, err := z.Envelope.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x82)
+	o = append(o, 0x83)
 	if oTemp, err := z.Node.MarshalHash(); err != nil {
 		return nil, err
 	} else {
@@ -218,7 +248,13 @@ func (z *PingReq) MarshalHash() (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *PingReq) Msgsize() (s int) {
-	s = 1 + 9 + z.Envelope.Msgsize() + 5 + z.Node.Msgsize()
+	s = 1 + 7
+	if z.Record == nil {
+		s += hsp.NilSize
+	} else {
+		s += z.Record.Msgsize()
+	}
+	s += 9 + z.Envelope.Msgsize() + 5 + z.Node.Msgsize()
 	return
 }
 
@@ -48,7 +48,7 @@ func (p *Peers) Clone() (copy Peers) {
 }
 
 // Sign generates signature.
-func (p *Peers) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (p *Peers) Sign(signer asymmetric.Signer) (err error) {
 	return p.DefaultHashSignVerifierImpl.Sign(&p.PeersHeader, signer)
 }
 
@@ -17,9 +17,7 @@
 package route
 
 import (
-	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
-	"github.com/CovenantSQL/CovenantSQL/utils/log"
 )
 
 /*
@@ -30,7 +28,7 @@ NOTE:
     1. PubKey is verified by ETLS with ECDH
 	1. For more about ETLS: https://github.com/CovenantSQL/research/wiki/ETLS(Enhanced-Transport-Layer-Security)
 
-ACLs:
+ACLs (enforced by DefaultACLPolicy unless overridden by the ACL config, see policy.go):
 	Client -> BP, Request for Allocating DB:
   		ACL: Open to world, add difficulty verification
    		Checking pledge should be done in the Server RPC implementation
@@ -50,11 +48,20 @@ ACLs:
    	Client -> Miner, SQL Query:
    		ACL: Open to Registered Client
 
+   	Client -> Miner, DBS.QueryStats():
+   		ACL: Open to Registered Client, only the normalized query patterns are returned
+
    	* -> BP, DHT.Ping():
   		ACL: Open to world, add difficulty verification
 
    	* -> BP, DHT.FindNode(), DHT.FindNeighbor():
   		ACL: Open to world
+
+   	* -> BP, DHT.RotateKey(), DHT.FindKeyRotation():
+  		ACL: Open to world, the rotation record is signed by the old and the new key
+
+   	* -> *, KAD.FindClosest():
+  		ACL: Open to registered nodes, the node records are signed by the nodes
 */
 
 // RemoteFunc defines the RPC Call name
@@ -67,6 +74,12 @@ const (
 	DHTFindNeighbor
 	// DHTFindNode gets node info
 	DHTFindNode
+	// DHTRotateKey registers a node or account key rotation record
+	DHTRotateKey
+	// DHTFindKeyRotation gets the latest key rotation record of a node or account
+	DHTFindKeyRotation
+	// KademliaFindClosest finds the closest node records from the kademlia routing table
+	KademliaFindClosest
 	// MetricUploadMetrics uploads node metrics
 	MetricUploadMetrics
 	// KayakCall is used by BP for data consistency
@@ -77,8 +90,14 @@ const (
 	DBSAck
 	// DBSDeploy is used by BP to create/drop/update database
 	DBSDeploy
+	// DBSSyncStatus is used by BP to query state sync progress of a new database replica
+	DBSSyncStatus
+	// DBSQueryStats is used by client to get the query pattern statistics of database
+	DBSQueryStats
 	// DBCCall is used by Miner for data consistency
 	DBCCall
+	// DBCFetch is used by Miner to fetch logs from database leader to catch up
+	DBCFetch
 	// BPDBCreateDatabase is used by client to create database
 	BPDBCreateDatabase
 	// BPDBDropDatabase is used by client to drop database
@@ -87,6 +106,12 @@ const (
 	BPDBGetDatabase
 	// BPDBGetNodeDatabases is used by miner to node residential databases
 	BPDBGetNodeDatabases
+	// BPDBPlanDatabase is used by client to dry run database placement
+	BPDBPlanDatabase
+	// BPDBUpdateDatabase is used by client to change the resource requirement or peers of database
+	BPDBUpdateDatabase
+	// BPDBGetDatabaseOperations is used by client to get progress of database peers operations
+	BPDBGetDatabaseOperations
 	// SQLCAdviseNewBlock is used by sqlchain to advise new block between adjacent node
 	SQLCAdviseNewBlock
 	// SQLCAdviseBinLog is usd by sqlchain to advise binlog between adjacent node
@@ -128,6 +153,8 @@ const (
 
 	// DHTRPCName defines the block producer dh-rpc service name
 	DHTRPCName = "DHT"
+	// KademliaRPCName defines the kademlia routing rpc name served by every node
+	KademliaRPCName = "KAD"
 	// BlockProducerRPCName defines main chain rpc name
 	BlockProducerRPCName = "MCC"
 	// SQLChainRPCName defines the sql chain rpc name
@@ -149,6 +176,12 @@ func (s RemoteFunc) String() string {
 		return "DHT.FindNeighbor"
 	case DHTFindNode:
 		return "DHT.FindNode"
+	case DHTRotateKey:
+		return "DHT.RotateKey"
+	case DHTFindKeyRotation:
+		return "DHT.FindKeyRotation"
+	case KademliaFindClosest:
+		return "KAD.FindClosest"
 	case MetricUploadMetrics:
 		return "Metric.UploadMetrics"
 	case KayakCall:
@@ -159,8 +192,14 @@ func (s RemoteFunc) String() string {
 		return "DBS.Ack"
 	case DBSDeploy:
 		return "DBS.Deploy"
+	case DBSSyncStatus:
+		return "DBS.SyncStatus"
+	case DBSQueryStats:
+		return "DBS.QueryStats"
 	case DBCCall:
 		return "DBC.Call"
+	case DBCFetch:
+		return "DBC.Fetch"
 	case BPDBCreateDatabase:
 		return "BPDB.CreateDatabase"
 	case BPDBDropDatabase:
@@ -169,6 +208,12 @@ func (s RemoteFunc) String() string {
 		return "BPDB.GetDatabase"
 	case BPDBGetNodeDatabases:
 		return "BPDB.GetNodeDatabases"
+	case BPDBPlanDatabase:
+		return "BPDB.PlanDatabase"
+	case BPDBUpdateDatabase:
+		return "BPDB.UpdateDatabase"
+	case BPDBGetDatabaseOperations:
+		return "BPDB.GetDatabaseOperations"
 	case SQLCAdviseNewBlock:
 		return "SQLC.AdviseNewBlock"
 	case SQLCAdviseBinLog:
@@ -211,39 +256,25 @@ func (s RemoteFunc) String() string {
 	return "Unknown"
 }
 
-// IsPermitted returns if the node is permitted to call the RPC func
+// IsPermitted returns if the node is permitted to call the RPC func according to the ACL policy.
 func IsPermitted(callerEnvelope *proto.Envelope, funcName RemoteFunc) (ok bool) {
-	callerETLSNodeID := callerEnvelope.GetNodeID()
-	// strict anonymous ETLS only used for Ping
-	// the envelope node id is set at NodeAwareServerCodec and CryptoListener.CHandler
-	// if callerETLSNodeID == nil here indicates that ETLS is not used, just ignore it
-	if callerETLSNodeID != nil {
-		if callerETLSNodeID.IsEqual(&kms.AnonymousRawNodeID.Hash) {
-			if funcName != DHTPing {
-				log.WithField("field", funcName).Warning("anonymous ETLS connection can not used")
-				return false
-			}
-		}
-	}
+	return IsMethodPermitted(callerEnvelope, funcName.String(), "")
+}
 
-	if !IsBPNodeID(callerETLSNodeID) {
-		// non BP
-		switch funcName {
-		// DHT related
-		case DHTPing, DHTFindNode, DHTFindNeighbor, MetricUploadMetrics:
-			return true
-			// Kayak related
-		case KayakCall:
-			return false
-			// DBSDeploy
-		case DBSDeploy:
-			return false
-		default:
-			// calling Unspecified RPC is forbidden
-			return false
-		}
-	}
+// IsPermittedOnDatabase returns if the node is permitted to call the RPC func on the database.
+func IsPermittedOnDatabase(callerEnvelope *proto.Envelope, funcName RemoteFunc, dbID proto.DatabaseID) (ok bool) {
+	return IsMethodPermitted(callerEnvelope, funcName.String(), dbID)
+}
 
-	// BP can call any RPC
-	return true
+// IsMethodPermitted returns if the node is permitted to call the RPC method, on database
+// 'dbID' if not empty. Denied calls are recorded in the audit log.
+func IsMethodPermitted(callerEnvelope *proto.Envelope, method string, dbID proto.DatabaseID) (ok bool) {
+	// the envelope node id is set at NodeAwareServerCodec and CryptoListener.CHandler
+	// if callerETLSNodeID == nil here indicates that ETLS is not used
+	call := newACLCall(callerEnvelope.GetNodeID(), method, dbID)
+	ok, rule := currentPolicy().check(call)
+	if !ok {
+		auditDenied(call, rule)
+	}
+	return
 }
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// aclAuditRecord is a line of the ACL audit log.
+type aclAuditRecord struct {
+	Time     time.Time        `json:"time"`
+	NodeID   proto.NodeID     `json:"node"`
+	Role     string           `json:"role"`
+	Method   string           `json:"method"`
+	Database proto.DatabaseID `json:"db,omitempty"`
+	// Rule is the index of the deny rule, -1 if no rule matched.
+	Rule int `json:"rule"`
+}
+
+var aclAudit struct {
+	sync.Mutex
+	file *os.File
+}
+
+// SetACLAuditLogFile appends the denied calls to the file at 'path' as json lines, an empty
+// path disables the audit log file.
+func SetACLAuditLogFile(path string) (err error) {
+	var file *os.File
+	if path != "" {
+		if file, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600); err != nil {
+			return
+		}
+	}
+	aclAudit.Lock()
+	defer aclAudit.Unlock()
+	if aclAudit.file != nil {
+		aclAudit.file.Close()
+	}
+	aclAudit.file = file
+	return
+}
+
+// auditDenied records the call denied by 'rule'.
+func auditDenied(c *aclCall, rule int) {
+	record := &aclAuditRecord{
+		Time:     time.Now().UTC(),
+		NodeID:   c.nodeID,
+		Role:     c.callerRole(),
+		Method:   c.method,
+		Database: c.database,
+		Rule:     rule,
+	}
+	log.WithFields(log.Fields{
+		"node":   record.NodeID,
+		"role":   record.Role,
+		"method": record.Method,
+		"db":     record.Database,
+		"rule":   record.Rule,
+	}).Warning("rpc call denied by acl")
+
+	aclAudit.Lock()
+	defer aclAudit.Unlock()
+	if aclAudit.file == nil {
+		return
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	if _, err = aclAudit.file.Write(append(data, '\n')); err != nil {
+		log.WithError(err).Error("write acl audit log failed")
+	}
+}
@@ -19,6 +19,7 @@ package route
 import (
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
@@ -45,12 +46,17 @@ var (
 
 	// ErrNilNodeID indicates we got nil node id
 	ErrNilNodeID = errors.New("nil node id")
+
+	// ErrNodeAddrExpired indicates the cached node addr from a node record is expired
+	ErrNodeAddrExpired = errors.New("node addr expired")
 )
 
 // Resolver does NodeID translation
 type Resolver struct {
 	cache     NodeIDAddressMap
 	bpNodeIDs NodeIDAddressMap
+	// expires holds the expire time of the addr cached from node records
+	expires map[proto.RawNodeID]time.Time
 	sync.RWMutex
 }
 
@@ -60,6 +66,7 @@ func initResolver() {
 		resolver = &Resolver{
 			cache:     make(NodeIDAddressMap),
 			bpNodeIDs: make(NodeIDAddressMap),
+			expires:   make(map[proto.RawNodeID]time.Time),
 		}
 		initBPNodeIDs()
 	})
@@ -81,9 +88,11 @@ func setResolveCache(initCache NodeIDAddressMap) {
 	resolver.Lock()
 	defer resolver.Unlock()
 	resolver.cache = initCache
+	resolver.expires = make(map[proto.RawNodeID]time.Time)
 }
 
-// GetNodeAddrCache gets node addr by node id, if cache missed try RPC
+// GetNodeAddrCache gets node addr by node id, if cache missed try RPC. The addr cached from a
+// node record is returned only before the record expires.
 func GetNodeAddrCache(id *proto.RawNodeID) (addr string, err error) {
 	initResolver()
 	if id == nil {
@@ -95,6 +104,9 @@ func GetNodeAddrCache(id *proto.RawNodeID) (addr string, err error) {
 	if !ok {
 		return "", ErrUnknownNodeID
 	}
+	if expire, ok := resolver.expires[*id]; ok && !time.Now().Before(expire) {
+		return "", ErrNodeAddrExpired
+	}
 	return
 }
 
@@ -106,6 +118,7 @@ func setNodeAddrCache(id *proto.RawNodeID, addr string) (err error) {
 	resolver.Lock()
 	defer resolver.Unlock()
 	resolver.cache[*id] = addr
+	delete(resolver.expires, *id)
 	return
 }
 
@@ -115,6 +128,21 @@ func SetNodeAddrCache(id *proto.RawNodeID, addr string) (err error) {
 	return setNodeAddrCache(id, addr)
 }
 
+// SetNodeRecordAddrCache sets node id and addr of the verified node record, the addr expires
+// with the record.
+func SetNodeRecordAddrCache(record *proto.NodeRecord) (err error) {
+	initResolver()
+	id := record.Node.ID.ToRawNodeID()
+	if id == nil {
+		return ErrNilNodeID
+	}
+	resolver.Lock()
+	defer resolver.Unlock()
+	resolver.cache[*id] = record.Node.Addr
+	resolver.expires[*id] = record.ExpireTime()
+	return
+}
+
 // initBPNodeIDs initializes BlockProducer route and map from config file and DNS Seed
 func initBPNodeIDs() (bpNodeIDs NodeIDAddressMap) {
 	// clear address map before init
@@ -127,15 +155,12 @@ func initBPNodeIDs() (bpNodeIDs NodeIDAddressMap) {
 
 	var BPNodes = make(IDNodeMap)
 
-	// ignore DNS seed in test mode
-	if !conf.GConf.IsTestMode {
-		dc := NewDNSClient()
-		var seedDomain = BPDomain
-		//seedDomain = TestBPDomain
+	// ignore DNS seed in test mode unless the bootstrap providers are configured explicitly
+	if !conf.GConf.IsTestMode || len(conf.GConf.DNSSeed.Providers) > 0 {
 		var err error
-		BPNodes, err = dc.GetBPFromDNSSeed(seedDomain)
+		BPNodes, err = GetBPFromProviders(&conf.GConf.DNSSeed)
 		if err != nil {
-			log.WithField("seed", seedDomain).WithError(err).Error("getting BP addr from DNS failed")
+			log.WithField("providers", conf.GConf.DNSSeed.Providers).WithError(err).Error("getting BP addr from bootstrap providers failed")
 			return
 		}
 	}
@@ -20,6 +20,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
@@ -61,6 +62,27 @@ func TestResolver(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(addr, ShouldEqual, addr)
 
+		// the addr of node record expires with the record
+		record := &proto.NodeRecord{
+			NodeRecordHeader: proto.NodeRecordHeader{
+				Node:      proto.Node{ID: nodeA.ToNodeID(), Addr: "record addr"},
+				Timestamp: time.Now(),
+				TTL:       time.Hour,
+			},
+		}
+		So(SetNodeRecordAddrCache(record), ShouldBeNil)
+		addr, err = GetNodeAddrCache(nodeA)
+		So(err, ShouldBeNil)
+		So(addr, ShouldEqual, "record addr")
+		record.Timestamp = time.Now().Add(-time.Hour)
+		So(SetNodeRecordAddrCache(record), ShouldBeNil)
+		_, err = GetNodeAddrCache(nodeA)
+		So(err, ShouldEqual, ErrNodeAddrExpired)
+		So(SetNodeAddrCache(nodeA, "static addr"), ShouldBeNil)
+		addr, err = GetNodeAddrCache(nodeA)
+		So(err, ShouldBeNil)
+		So(addr, ShouldEqual, "static addr")
+
 		So(IsBPNodeID(nil), ShouldBeFalse)
 
 		So(IsBPNodeID(nodeA), ShouldBeFalse)
@@ -0,0 +1,356 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+const (
+	// KBucketSize defines the max records count of a k-bucket, it's also the count of the
+	// closest nodes returned by a lookup.
+	KBucketSize = 16
+	// KademliaAlpha defines the concurrent queries count of an iterative lookup.
+	KademliaAlpha = 3
+
+	// kBucketCount defines the k-buckets count, one for each bit of the node id.
+	kBucketCount = hash.HashSize * 8
+	// maxNodeFailures defines the failures count to evict a node from the routing table.
+	maxNodeFailures = 3
+)
+
+var (
+	// ErrNodeRecordSignee indicates the node record is not signed by the node key.
+	ErrNodeRecordSignee = errors.New("node record is not signed by the node key")
+	// ErrNodeRecordKey indicates the node id, nonce and public key of the record don't match.
+	ErrNodeRecordKey = errors.New("node record id nonce public key not match")
+	// ErrNodeRecordDifficulty indicates the node id difficulty of the record is too low.
+	ErrNodeRecordDifficulty = errors.New("node record id difficulty too low")
+	// ErrNodeRecordExpired indicates the node record is expired.
+	ErrNodeRecordExpired = errors.New("node record expired")
+	// ErrNodeRecordInFuture indicates the node record timestamp is in the future.
+	ErrNodeRecordInFuture = errors.New("node record timestamp is in the future")
+
+	// routingTable holds the local routing table instance.
+	routingTable     *RoutingTable
+	routingTableLock sync.RWMutex
+)
+
+type bucketEntry struct {
+	id       proto.RawNodeID
+	record   proto.NodeRecord
+	lastSeen time.Time
+	failures int
+}
+
+// RoutingTable defines the kademlia routing table, the node records are kept in k-buckets by
+// the XOR distance of the node id to the local node id. Each bucket is ordered from the least
+// recently seen node to the most recently seen one.
+type RoutingTable struct {
+	sync.RWMutex
+	self    proto.RawNodeID
+	buckets [kBucketCount][]*bucketEntry
+}
+
+// NewRoutingTable returns a new routing table of the local node.
+func NewRoutingTable(self *proto.RawNodeID) *RoutingTable {
+	return &RoutingTable{
+		self: *self,
+	}
+}
+
+// InitRoutingTable initializes the local routing table of the node, the routing table is
+// removed if self is nil.
+func InitRoutingTable(self *proto.RawNodeID) {
+	routingTableLock.Lock()
+	defer routingTableLock.Unlock()
+	if self == nil {
+		routingTable = nil
+		return
+	}
+	routingTable = NewRoutingTable(self)
+}
+
+// GetRoutingTable returns the local routing table, nil if not initialized.
+func GetRoutingTable() *RoutingTable {
+	routingTableLock.RLock()
+	defer routingTableLock.RUnlock()
+	return routingTable
+}
+
+// Distance returns the XOR distance of the node ids.
+func Distance(a, b *proto.RawNodeID) (d hash.Hash) {
+	for i := range d {
+		d[i] = a.Hash[i] ^ b.Hash[i]
+	}
+	return
+}
+
+// CloserTo returns if node id a is closer to target than node id b.
+func CloserTo(target, a, b *proto.RawNodeID) bool {
+	da, db := Distance(target, a), Distance(target, b)
+	return bytes.Compare(da[:], db[:]) < 0
+}
+
+// bucketIndex returns the index of the k-bucket of node id, which is the length of the common
+// prefix with the local node id, -1 for the local node id.
+func (t *RoutingTable) bucketIndex(id *proto.RawNodeID) int {
+	d := Distance(&t.self, id)
+	for i, b := range d {
+		if b != 0 {
+			return i*8 + bits.LeadingZeros8(b)
+		}
+	}
+	return -1
+}
+
+func (t *RoutingTable) find(id *proto.RawNodeID) (bucket, index int) {
+	if bucket = t.bucketIndex(id); bucket < 0 {
+		return -1, -1
+	}
+	for i, e := range t.buckets[bucket] {
+		if e.id == *id {
+			return bucket, i
+		}
+	}
+	return bucket, -1
+}
+
+// Update adds the verified node record to the routing table or refreshes the existing one,
+// the stored record is kept if it's newer. The least recently seen node of a full bucket is
+// evicted only if it failed to respond or expired, the long-lived nodes are preferred.
+// Returns false if the node is not stored.
+func (t *RoutingTable) Update(record *proto.NodeRecord) (stored bool) {
+	id := record.Node.ID.ToRawNodeID()
+	if id == nil {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	bucket, index := t.find(id)
+	if bucket < 0 {
+		return
+	}
+	entries := t.buckets[bucket]
+	entry := &bucketEntry{
+		id:       *id,
+		record:   *record,
+		lastSeen: time.Now(),
+	}
+
+	switch {
+	case index >= 0:
+		if prev := &entries[index].record; !record.IsNewerThan(prev) {
+			entry.record = *prev
+		}
+		entries = append(entries[:index], entries[index+1:]...)
+	case len(entries) < KBucketSize:
+	case entries[0].failures > 0 || entries[0].record.IsExpired(entry.lastSeen):
+		log.WithFields(log.Fields{
+			"evicted": entries[0].record.Node.ID,
+			"node":    record.Node.ID,
+		}).Debug("evict failed node from routing table")
+		entries = entries[1:]
+	default:
+		return
+	}
+
+	t.buckets[bucket] = append(entries, entry)
+	return true
+}
+
+// Fail records a failed request to the node, the node is removed after maxNodeFailures
+// consecutive failures.
+func (t *RoutingTable) Fail(id *proto.RawNodeID) {
+	t.Lock()
+	defer t.Unlock()
+
+	bucket, index := t.find(id)
+	if index < 0 {
+		return
+	}
+	entry := t.buckets[bucket][index]
+	if entry.failures++; entry.failures >= maxNodeFailures {
+		t.remove(bucket, index)
+	}
+}
+
+// Remove removes the node from the routing table.
+func (t *RoutingTable) Remove(id *proto.RawNodeID) {
+	t.Lock()
+	defer t.Unlock()
+
+	if bucket, index := t.find(id); index >= 0 {
+		t.remove(bucket, index)
+	}
+}
+
+func (t *RoutingTable) remove(bucket, index int) {
+	entries := t.buckets[bucket]
+	t.buckets[bucket] = append(entries[:index], entries[index+1:]...)
+}
+
+// Get returns the unexpired node record from the routing table.
+func (t *RoutingTable) Get(id *proto.RawNodeID) (record proto.NodeRecord, ok bool) {
+	t.RLock()
+	defer t.RUnlock()
+
+	if bucket, index := t.find(id); index >= 0 {
+		record = t.buckets[bucket][index].record
+		ok = !record.IsExpired(time.Now())
+	}
+	return
+}
+
+// Closest returns at most count unexpired node records closest to the target by XOR distance.
+func (t *RoutingTable) Closest(target *proto.RawNodeID, count int) (records []proto.NodeRecord) {
+	now := time.Now()
+	t.RLock()
+	for _, entries := range t.buckets {
+		for _, e := range entries {
+			if !e.record.IsExpired(now) {
+				records = append(records, e.record)
+			}
+		}
+	}
+	t.RUnlock()
+
+	SortByDistance(target, records)
+	if len(records) > count {
+		records = records[:count]
+	}
+	return
+}
+
+// Len returns the records count of the routing table.
+func (t *RoutingTable) Len() (n int) {
+	t.RLock()
+	defer t.RUnlock()
+
+	for _, entries := range t.buckets {
+		n += len(entries)
+	}
+	return
+}
+
+// SortByDistance sorts the node records by the XOR distance to the target.
+func SortByDistance(target *proto.RawNodeID, records []proto.NodeRecord) {
+	distances := make(map[proto.NodeID]hash.Hash, len(records))
+	for _, r := range records {
+		if id := r.Node.ID.ToRawNodeID(); id != nil {
+			distances[r.Node.ID] = Distance(target, id)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		di, dj := distances[records[i].Node.ID], distances[records[j].Node.ID]
+		return bytes.Compare(di[:], dj[:]) < 0
+	})
+}
+
+// VerifyNodeRecord checks the signature, the timestamp and the expiration of the node record and
+// the node key binding.
+func VerifyNodeRecord(record *proto.NodeRecord) (err error) {
+	if err = record.Verify(); err != nil {
+		return
+	}
+	now := time.Now()
+	if record.IsInFuture(now) {
+		return ErrNodeRecordInFuture
+	}
+	if record.IsExpired(now) {
+		return ErrNodeRecordExpired
+	}
+	node := &record.Node
+	if record.Signee == nil || !record.Signee.IsEqual(node.PublicKey) {
+		return ErrNodeRecordSignee
+	}
+	if !kms.IsNodeKeyValid(node.ID.ToRawNodeID(), &node.Nonce, node.PublicKey) {
+		return ErrNodeRecordKey
+	}
+	if conf.GConf != nil && node.ID.Difficulty() < conf.GConf.MinNodeIDDifficulty {
+		return ErrNodeRecordDifficulty
+	}
+	return
+}
+
+// KademliaService is the kademlia routing RPC implementation served by every node.
+type KademliaService struct {
+	Table *RoutingTable
+}
+
+// NewKademliaService returns a new KademliaService with the local routing table.
+func NewKademliaService() *KademliaService {
+	return &KademliaService{
+		Table: GetRoutingTable(),
+	}
+}
+
+// FindClosest RPC returns the closest node records to the target from the local routing table,
+// the record of the caller is added to the routing table.
+func (s *KademliaService) FindClosest(req *proto.FindClosestReq, resp *proto.FindClosestResp) (err error) {
+	if !IsPermitted(&req.Envelope, KademliaFindClosest) {
+		err = fmt.Errorf("calling from node %s is not permitted", req.GetNodeID())
+		log.Error(err)
+		return
+	}
+
+	target := req.Target.ToRawNodeID()
+	if target == nil {
+		err = fmt.Errorf("invalid target node id: %s", req.Target)
+		return
+	}
+
+	if req.Record != nil {
+		recordID := req.Record.Node.ID.ToRawNodeID()
+		if recordID == nil {
+			err = fmt.Errorf("invalid node record id: %s", req.Record.Node.ID)
+			return
+		}
+		// the caller node id is empty on anonymous connections
+		if caller := req.GetNodeID(); caller != nil && *caller != (proto.RawNodeID{}) && *caller != *recordID {
+			err = fmt.Errorf("node record %s is not from the caller %s", req.Record.Node.ID, caller)
+			return
+		}
+		if err = VerifyNodeRecord(req.Record); err != nil {
+			err = fmt.Errorf("verify node record %s failed: %s", req.Record.Node.ID, err)
+			return
+		}
+		s.Table.Update(req.Record)
+		SetNodeRecordAddrCache(req.Record)
+	}
+
+	count := req.Count
+	if count <= 0 || count > KBucketSize {
+		count = KBucketSize
+	}
+	resp.Records = s.Table.Closest(target, count)
+	return
+}
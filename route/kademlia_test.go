@@ -0,0 +1,208 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func rawID(prefix ...byte) *proto.RawNodeID {
+	id := &proto.RawNodeID{}
+	copy(id.Hash[:], prefix)
+	return id
+}
+
+func testRecord(id *proto.RawNodeID) *proto.NodeRecord {
+	return &proto.NodeRecord{
+		NodeRecordHeader: proto.NodeRecordHeader{
+			Node:      proto.Node{ID: id.ToNodeID()},
+			Seq:       1,
+			Timestamp: time.Now(),
+			TTL:       time.Hour,
+		},
+	}
+}
+
+func signedRecord(addr string) (record *proto.NodeRecord, priv *asymmetric.PrivateKey) {
+	priv, pub, _ := asymmetric.GenSecp256k1KeyPair()
+	nonce := asymmetric.GetPubKeyNonce(pub, 1, 100*time.Millisecond, nil)
+	record = &proto.NodeRecord{
+		NodeRecordHeader: proto.NodeRecordHeader{
+			Node: proto.Node{
+				ID:        proto.NodeID(nonce.Hash.String()),
+				Addr:      addr,
+				PublicKey: pub,
+				Nonce:     nonce.Nonce,
+			},
+			Seq:       1,
+			Timestamp: time.Now(),
+			TTL:       time.Hour,
+		},
+	}
+	record.Sign(priv)
+	return
+}
+
+func TestRoutingTable(t *testing.T) {
+	Convey("test kademlia routing table", t, func() {
+		self := rawID()
+		table := NewRoutingTable(self)
+
+		So(table.bucketIndex(self), ShouldEqual, -1)
+		So(table.bucketIndex(rawID(0x80)), ShouldEqual, 0)
+		So(table.bucketIndex(rawID(0x01)), ShouldEqual, 7)
+		So(table.bucketIndex(rawID(0x00, 0x40)), ShouldEqual, 9)
+
+		// the local node is not stored
+		So(table.Update(testRecord(self)), ShouldBeFalse)
+		So(table.Len(), ShouldEqual, 0)
+
+		// fill the bucket 0
+		for i := 0; i < KBucketSize; i++ {
+			So(table.Update(testRecord(rawID(0x80, byte(i)))), ShouldBeTrue)
+		}
+		So(table.Len(), ShouldEqual, KBucketSize)
+
+		// full bucket keeps the long-lived nodes
+		newcomer := rawID(0x80, 0xff)
+		So(table.Update(testRecord(newcomer)), ShouldBeFalse)
+		_, ok := table.Get(newcomer)
+		So(ok, ShouldBeFalse)
+
+		// refresh an existing node moves it to the tail
+		So(table.Update(testRecord(rawID(0x80, 0))), ShouldBeTrue)
+		So(table.buckets[0][KBucketSize-1].id, ShouldResemble, *rawID(0x80, 0))
+
+		// the newer record of an existing node is kept
+		newer := testRecord(rawID(0x80, 0))
+		newer.Seq, newer.Node.Addr = 2, "newer"
+		So(table.Update(newer), ShouldBeTrue)
+		So(table.Update(testRecord(rawID(0x80, 0))), ShouldBeTrue)
+		stored, ok := table.Get(rawID(0x80, 0))
+		So(ok, ShouldBeTrue)
+		So(stored.Node.Addr, ShouldEqual, "newer")
+
+		// the failed least recently seen node is evicted
+		table.Fail(rawID(0x80, 1))
+		So(table.Update(testRecord(newcomer)), ShouldBeTrue)
+		_, ok = table.Get(rawID(0x80, 1))
+		So(ok, ShouldBeFalse)
+		_, ok = table.Get(newcomer)
+		So(ok, ShouldBeTrue)
+
+		// nodes are removed after max failures
+		for i := 0; i < maxNodeFailures; i++ {
+			table.Fail(newcomer)
+		}
+		_, ok = table.Get(newcomer)
+		So(ok, ShouldBeFalse)
+		So(table.Len(), ShouldEqual, KBucketSize-1)
+
+		table.Remove(rawID(0x80, 2))
+		So(table.Len(), ShouldEqual, KBucketSize-2)
+
+		// closest by xor distance
+		So(table.Update(testRecord(rawID(0x01))), ShouldBeTrue)
+		So(table.Update(testRecord(rawID(0x02))), ShouldBeTrue)
+		closest := table.Closest(rawID(0x03), 3)
+		So(closest, ShouldHaveLength, 3)
+		So(closest[0].Node.ID, ShouldEqual, rawID(0x02).ToNodeID())
+		So(closest[1].Node.ID, ShouldEqual, rawID(0x01).ToNodeID())
+		So(closest[2].Node.ID, ShouldEqual, rawID(0x80, 0x00).ToNodeID())
+
+		// the expired records are not returned
+		expired := testRecord(rawID(0x02))
+		expired.Seq, expired.TTL = 2, time.Nanosecond
+		So(table.Update(expired), ShouldBeTrue)
+		_, ok = table.Get(rawID(0x02))
+		So(ok, ShouldBeFalse)
+		closest = table.Closest(rawID(0x03), 3)
+		So(closest[0].Node.ID, ShouldEqual, rawID(0x01).ToNodeID())
+
+		So(CloserTo(rawID(0x03), rawID(0x02), rawID(0x01)), ShouldBeTrue)
+		So(Distance(rawID(0x03), rawID(0x01)), ShouldResemble, rawID(0x02).Hash)
+	})
+}
+
+func TestKademliaService(t *testing.T) {
+	Convey("test kademlia service", t, func() {
+		if conf.GConf != nil {
+			minDifficulty := conf.GConf.MinNodeIDDifficulty
+			conf.GConf.MinNodeIDDifficulty = 1
+			defer func() { conf.GConf.MinNodeIDDifficulty = minDifficulty }()
+		}
+
+		record, _ := signedRecord("127.0.0.1:1")
+		So(VerifyNodeRecord(record), ShouldBeNil)
+
+		// tampered address
+		tampered := *record
+		tampered.Node.Addr = "127.0.0.1:2"
+		So(VerifyNodeRecord(&tampered), ShouldNotBeNil)
+
+		// signed by other key
+		_, other := signedRecord("127.0.0.1:3")
+		forged := *record
+		forged.Sign(other)
+		So(VerifyNodeRecord(&forged), ShouldEqual, ErrNodeRecordSignee)
+
+		// expired
+		expired, priv := signedRecord("127.0.0.1:4")
+		expired.Timestamp = time.Now().Add(-2 * time.Hour)
+		expired.Sign(priv)
+		So(VerifyNodeRecord(expired), ShouldEqual, ErrNodeRecordExpired)
+
+		// signed in the future
+		future, priv := signedRecord("127.0.0.1:5")
+		future.Timestamp = time.Now().Add(proto.MaxNodeRecordClockSkew + time.Hour)
+		future.Sign(priv)
+		So(VerifyNodeRecord(future), ShouldEqual, ErrNodeRecordInFuture)
+
+		s := &KademliaService{
+			Table: NewRoutingTable(rawID()),
+		}
+		s.Table.Update(testRecord(rawID(0x01)))
+
+		req := &proto.FindClosestReq{
+			Target: rawID(0x02).ToNodeID(),
+			Count:  1,
+			Record: record,
+		}
+		req.SetNodeID(record.Node.ID.ToRawNodeID())
+		resp := new(proto.FindClosestResp)
+		So(s.FindClosest(req, resp), ShouldBeNil)
+		So(resp.Records, ShouldHaveLength, 1)
+		So(s.Table.Len(), ShouldEqual, 2)
+		stored, ok := s.Table.Get(record.Node.ID.ToRawNodeID())
+		So(ok, ShouldBeTrue)
+		So(stored.Node.Addr, ShouldEqual, "127.0.0.1:1")
+		addr, err := GetNodeAddrCache(record.Node.ID.ToRawNodeID())
+		So(err, ShouldBeNil)
+		So(addr, ShouldEqual, "127.0.0.1:1")
+
+		// the record must be from the caller
+		req.SetNodeID(&proto.RawNodeID{Hash: hash.Hash{0x01}})
+		So(s.FindClosest(req, new(proto.FindClosestResp)), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"net"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+const (
+	// DefaultMulticastAddr is the default LAN multicast group to discover block producers.
+	DefaultMulticastAddr = "239.255.67.81:4661"
+	// DefaultMulticastTimeout is the default time to wait for the block producers to reply.
+	DefaultMulticastTimeout = 2 * time.Second
+
+	// multicastQuery is the query packet sent to the multicast group.
+	multicastQuery = "CQL-BP-QUERY"
+	// maxMulticastPacketSize is the max size of a reply packet.
+	maxMulticastPacketSize = 8192
+)
+
+// MulticastProvider discovers the block producers on the LAN by multicast, the block producers
+// reply with their signed node records. It's intended for development clusters as any node on
+// the LAN can announce itself as a block producer.
+type MulticastProvider struct {
+	Addr    string
+	Timeout time.Duration
+}
+
+// NewMulticastProvider returns a new MulticastProvider, the defaults are used if not set.
+func NewMulticastProvider(addr string, timeout time.Duration) *MulticastProvider {
+	if addr == "" {
+		addr = DefaultMulticastAddr
+	}
+	if timeout <= 0 {
+		timeout = DefaultMulticastTimeout
+	}
+	return &MulticastProvider{
+		Addr:    addr,
+		Timeout: timeout,
+	}
+}
+
+// GetBPs implements BootstrapProvider.GetBPs.
+func (p *MulticastProvider) GetBPs() (BPNodes IDNodeMap, err error) {
+	var (
+		group *net.UDPAddr
+		conn  *net.UDPConn
+	)
+	if group, err = net.ResolveUDPAddr("udp4", p.Addr); err != nil {
+		return
+	}
+	if conn, err = net.ListenUDP("udp4", &net.UDPAddr{}); err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if _, err = conn.WriteToUDP([]byte(multicastQuery), group); err != nil {
+		return
+	}
+	if err = conn.SetReadDeadline(time.Now().Add(p.Timeout)); err != nil {
+		return
+	}
+
+	BPNodes = make(IDNodeMap)
+	buf := make([]byte, maxMulticastPacketSize)
+	for {
+		n, from, errRead := conn.ReadFromUDP(buf)
+		if errRead != nil {
+			if ne, ok := errRead.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			err = errRead
+			return
+		}
+		var record proto.NodeRecord
+		if errDec := utils.DecodeMsgPack(buf[:n], &record); errDec != nil {
+			log.WithField("from", from).WithError(errDec).Debug("decode multicast reply failed")
+			continue
+		}
+		if errVerify := VerifyNodeRecord(&record); errVerify != nil {
+			log.WithField("from", from).WithError(errVerify).Warning("verify multicast reply failed")
+			continue
+		}
+		if record.Node.Role != proto.Leader && record.Node.Role != proto.Follower {
+			continue
+		}
+		BPNodes[*record.Node.ID.ToRawNodeID()] = record.Node
+	}
+	return
+}
+
+// ServeMulticast answers the multicast queries with the record of the local block producer
+// until stopCh is closed.
+func ServeMulticast(
+	addr string, record func() (*proto.NodeRecord, error), stopCh <-chan struct{},
+) (err error) {
+	if addr == "" {
+		addr = DefaultMulticastAddr
+	}
+	var (
+		group *net.UDPAddr
+		conn  *net.UDPConn
+	)
+	if group, err = net.ResolveUDPAddr("udp4", addr); err != nil {
+		return
+	}
+	if conn, err = net.ListenMulticastUDP("udp4", nil, group); err != nil {
+		return
+	}
+
+	go func() {
+		<-stopCh
+		conn.Close()
+	}()
+
+	go func() {
+		buf := make([]byte, maxMulticastPacketSize)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				log.WithError(err).Debug("multicast responder stopped")
+				return
+			}
+			if string(buf[:n]) != multicastQuery {
+				continue
+			}
+			r, err := record()
+			if err != nil {
+				log.WithError(err).Error("get local node record failed")
+				continue
+			}
+			data, err := utils.EncodeMsgPack(r)
+			if err != nil {
+				log.WithError(err).Error("encode local node record failed")
+				continue
+			}
+			if _, err = conn.WriteToUDP(data.Bytes(), from); err != nil {
+				log.WithField("to", from).WithError(err).Warning("reply multicast query failed")
+			}
+		}
+	}()
+
+	return
+}
@@ -0,0 +1,340 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// ACL roles of the callers.
+const (
+	ACLRoleAnonymous     = "Anonymous"
+	ACLRoleBlockProducer = "BlockProducer"
+	ACLRoleMiner         = "Miner"
+	ACLRoleClient        = "Client"
+	ACLRoleUnknown       = "Unknown"
+)
+
+// ACL rule effects.
+const (
+	ACLAllow = "allow"
+	ACLDeny  = "deny"
+)
+
+// aclPolicyReloadInterval is the check interval of the policy file modifications.
+const aclPolicyReloadInterval = 10 * time.Second
+
+// DefaultACLPolicy is the policy used unless configured: anonymous connections may only
+// ping, block producers may call any RPC, other nodes may use the DHT and the kademlia
+// routing, upload metrics, query databases and get the query statistics of databases.
+var DefaultACLPolicy = conf.ACLPolicy{
+	Rules: []conf.ACLRule{
+		{Effect: ACLAllow, Roles: []string{ACLRoleAnonymous}, Methods: []string{DHTPing.String()}},
+		{Effect: ACLDeny, Roles: []string{ACLRoleAnonymous}},
+		{Effect: ACLAllow, Roles: []string{ACLRoleBlockProducer}},
+		{Effect: ACLAllow, Methods: []string{
+			DHTPing.String(), DHTFindNode.String(), DHTFindNeighbor.String(),
+			DHTRotateKey.String(), DHTFindKeyRotation.String(), KademliaFindClosest.String(),
+			MetricUploadMetrics.String(), DBSQuery.String(), DBSAck.String(), DBSQueryStats.String(),
+		}},
+	},
+}
+
+var (
+	// ErrInvalidACLPolicy indicates the ACL policy is malformed.
+	ErrInvalidACLPolicy = errors.New("invalid acl policy")
+
+	aclPolicy     atomic.Value
+	defaultPolicy *compiledPolicy
+	validACLRoles = map[string]bool{
+		ACLRoleAnonymous:     true,
+		ACLRoleBlockProducer: true,
+		ACLRoleMiner:         true,
+		ACLRoleClient:        true,
+		ACLRoleUnknown:       true,
+	}
+)
+
+func init() {
+	var err error
+	if defaultPolicy, err = compilePolicy(&DefaultACLPolicy); err != nil {
+		panic(err)
+	}
+}
+
+// compiledRule is an ACLRule indexed for matching.
+type compiledRule struct {
+	index         int
+	allow         bool
+	roles         map[string]bool
+	nodeIDs       map[proto.NodeID]bool
+	exceptNodeIDs map[proto.NodeID]bool
+	databases     map[proto.DatabaseID]bool
+	methods       []string
+	// nodeRoles is set if the rule matches roles of registered nodes.
+	nodeRoles bool
+}
+
+type compiledPolicy struct {
+	rules []*compiledRule
+}
+
+func compilePolicy(policy *conf.ACLPolicy) (p *compiledPolicy, err error) {
+	p = &compiledPolicy{}
+	for i, rule := range policy.Rules {
+		r := &compiledRule{index: i, methods: rule.Methods}
+		switch strings.ToLower(rule.Effect) {
+		case ACLAllow:
+			r.allow = true
+		case ACLDeny:
+		default:
+			err = errors.Wrapf(ErrInvalidACLPolicy, "rule %d: unknown effect %#v", i, rule.Effect)
+			return
+		}
+		if len(rule.Roles) > 0 {
+			r.roles = make(map[string]bool)
+			for _, role := range rule.Roles {
+				if !validACLRoles[role] {
+					err = errors.Wrapf(ErrInvalidACLPolicy, "rule %d: unknown role %#v", i, role)
+					return
+				}
+				r.roles[role] = true
+				r.nodeRoles = r.nodeRoles || role == ACLRoleMiner || role == ACLRoleClient || role == ACLRoleUnknown
+			}
+		}
+		if len(rule.NodeIDs) > 0 {
+			r.nodeIDs = make(map[proto.NodeID]bool)
+			for _, id := range rule.NodeIDs {
+				r.nodeIDs[id] = true
+			}
+		}
+		if len(rule.ExceptNodeIDs) > 0 {
+			r.exceptNodeIDs = make(map[proto.NodeID]bool)
+			for _, id := range rule.ExceptNodeIDs {
+				r.exceptNodeIDs[id] = true
+			}
+		}
+		if len(rule.Databases) > 0 {
+			r.databases = make(map[proto.DatabaseID]bool)
+			for _, db := range rule.Databases {
+				r.databases[db] = true
+			}
+		}
+		p.rules = append(p.rules, r)
+	}
+	return
+}
+
+// aclCall is a call checked against the policy, the caller role is resolved on demand.
+type aclCall struct {
+	rawNodeID *proto.RawNodeID
+	nodeID    proto.NodeID
+	method    string
+	database  proto.DatabaseID
+	role      string
+}
+
+func newACLCall(rawNodeID *proto.RawNodeID, method string, database proto.DatabaseID) (c *aclCall) {
+	c = &aclCall{rawNodeID: rawNodeID, method: method, database: database}
+	if rawNodeID != nil {
+		c.nodeID = proto.NodeID(rawNodeID.String())
+	}
+	return
+}
+
+// baseRole returns the role of the caller known without a key store lookup, or an
+// empty string for registered nodes.
+func (c *aclCall) baseRole() string {
+	switch {
+	case c.rawNodeID == nil:
+		return ACLRoleUnknown
+	case c.rawNodeID.IsEqual(&kms.AnonymousRawNodeID.Hash):
+		return ACLRoleAnonymous
+	case IsBPNodeID(c.rawNodeID):
+		return ACLRoleBlockProducer
+	}
+	return ""
+}
+
+// callerRole returns the role of the caller, nodes not using ETLS have an Unknown role.
+func (c *aclCall) callerRole() string {
+	if c.role != "" {
+		return c.role
+	}
+	if c.role = c.baseRole(); c.role == "" {
+		c.role = ACLRoleUnknown
+		if node, err := kms.GetNodeInfo(c.nodeID); err == nil {
+			switch node.Role {
+			case proto.Miner:
+				c.role = ACLRoleMiner
+			case proto.Client:
+				c.role = ACLRoleClient
+			}
+		}
+	}
+	return c.role
+}
+
+func matchACLMethod(patterns []string, method string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == method ||
+			(strings.HasSuffix(pattern, ".*") && strings.HasPrefix(method, pattern[:len(pattern)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *compiledRule) match(c *aclCall) bool {
+	if !matchACLMethod(r.methods, c.method) {
+		return false
+	}
+	if r.databases != nil && !r.databases[c.database] {
+		return false
+	}
+	if r.nodeIDs != nil && !r.nodeIDs[c.nodeID] {
+		return false
+	}
+	if r.exceptNodeIDs != nil && r.exceptNodeIDs[c.nodeID] {
+		return false
+	}
+	if r.roles != nil {
+		role := c.baseRole()
+		if role == "" {
+			// only look up the registered role if the rule may match it
+			if !r.nodeRoles {
+				return false
+			}
+			role = c.callerRole()
+		}
+		if !r.roles[role] {
+			return false
+		}
+	}
+	return true
+}
+
+// check returns if the call is allowed and the index of the deciding rule, -1 if no
+// rule matches.
+func (p *compiledPolicy) check(c *aclCall) (allowed bool, rule int) {
+	for _, r := range p.rules {
+		if r.match(c) {
+			return r.allow, r.index
+		}
+	}
+	return false, -1
+}
+
+func currentPolicy() *compiledPolicy {
+	if p, ok := aclPolicy.Load().(*compiledPolicy); ok {
+		return p
+	}
+	return defaultPolicy
+}
+
+// SetACLPolicy replaces the ACL policy, the current policy is kept if invalid.
+func SetACLPolicy(policy *conf.ACLPolicy) (err error) {
+	var p *compiledPolicy
+	if p, err = compilePolicy(policy); err != nil {
+		return
+	}
+	aclPolicy.Store(p)
+	return
+}
+
+// LoadACLPolicyFile loads and applies the ACL policy from the yaml file at 'path'.
+func LoadACLPolicyFile(path string) (err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	policy := &conf.ACLPolicy{}
+	if err = yaml.UnmarshalStrict(data, policy); err != nil {
+		err = errors.Wrapf(ErrInvalidACLPolicy, "parse %s: %v", path, err)
+		return
+	}
+	return SetACLPolicy(policy)
+}
+
+// WatchACLPolicyFile reloads the ACL policy file at 'path' once modified, until the
+// returned stop func is called. Invalid policies are logged and ignored.
+func WatchACLPolicyFile(path string, interval time.Duration) (stop func()) {
+	stopCh := make(chan struct{})
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+			if err = LoadACLPolicyFile(path); err != nil {
+				log.WithField("file", path).WithError(err).Error("reload acl policy failed")
+				continue
+			}
+			log.WithField("file", path).Info("acl policy reloaded")
+		}
+	}()
+	return func() { close(stopCh) }
+}
+
+// InitACL applies the ACL policy and audit log of the config, the policy file is watched
+// for changes.
+func InitACL() (err error) {
+	if conf.GConf == nil {
+		return
+	}
+	if conf.GConf.ACLAuditLogFile != "" {
+		if err = SetACLAuditLogFile(conf.GConf.ACLAuditLogFile); err != nil {
+			return
+		}
+	}
+	if conf.GConf.ACLPolicyFile != "" {
+		if err = LoadACLPolicyFile(conf.GConf.ACLPolicyFile); err != nil {
+			return
+		}
+		WatchACLPolicyFile(conf.GConf.ACLPolicyFile, aclPolicyReloadInterval)
+	} else if conf.GConf.ACL != nil {
+		err = SetACLPolicy(conf.GConf.ACL)
+	}
+	return
+}
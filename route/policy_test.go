@@ -0,0 +1,166 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+const policyKeyStorePath = "./policy.keystore"
+
+func TestACLPolicy(t *testing.T) {
+	os.Remove(policyKeyStorePath)
+	defer os.Remove(policyKeyStorePath)
+
+	_, testFile, _, _ := runtime.Caller(0)
+	confFile := filepath.Join(filepath.Dir(testFile), "../test/node_0/config.yaml")
+	conf.GConf, _ = conf.LoadConfig(confFile)
+	Once = sync.Once{}
+	InitKMS(policyKeyStorePath)
+	defer aclPolicy.Store(defaultPolicy)
+
+	kms.Unittest = true
+	miner := proto.NodeID("0000000000000000000000000000000000000000000000000000000000001111")
+	client := proto.NodeID("0000000000000000000000000000000000000000000000000000000000002222")
+	other := proto.NodeID("0000000000000000000000000000000000000000000000000000000000003333")
+	kms.SetNode(&proto.Node{ID: miner, Role: proto.Miner})
+	kms.SetNode(&proto.Node{ID: client, Role: proto.Client})
+
+	bpEnv := &proto.Envelope{NodeID: &conf.GConf.BP.RawNodeID}
+	minerEnv := &proto.Envelope{NodeID: miner.ToRawNodeID()}
+	clientEnv := &proto.Envelope{NodeID: client.ToRawNodeID()}
+	otherEnv := &proto.Envelope{NodeID: other.ToRawNodeID()}
+	anonymousEnv := &proto.Envelope{NodeID: kms.AnonymousRawNodeID}
+
+	Convey("caller roles should be resolved", t, func() {
+		So(newACLCall(bpEnv.NodeID, "", "").callerRole(), ShouldEqual, ACLRoleBlockProducer)
+		So(newACLCall(minerEnv.NodeID, "", "").callerRole(), ShouldEqual, ACLRoleMiner)
+		So(newACLCall(clientEnv.NodeID, "", "").callerRole(), ShouldEqual, ACLRoleClient)
+		So(newACLCall(otherEnv.NodeID, "", "").callerRole(), ShouldEqual, ACLRoleUnknown)
+		So(newACLCall(nil, "", "").callerRole(), ShouldEqual, ACLRoleUnknown)
+		So(newACLCall(anonymousEnv.NodeID, "", "").callerRole(), ShouldEqual, ACLRoleAnonymous)
+	})
+
+	Convey("default policy should keep the builtin rules", t, func() {
+		So(IsPermitted(anonymousEnv, DHTPing), ShouldBeTrue)
+		So(IsPermitted(anonymousEnv, DBSQuery), ShouldBeFalse)
+		So(IsPermitted(bpEnv, DBSDeploy), ShouldBeTrue)
+		So(IsPermitted(minerEnv, DBSDeploy), ShouldBeFalse)
+		So(IsPermittedOnDatabase(clientEnv, DBSQuery, "db"), ShouldBeTrue)
+		So(IsPermittedOnDatabase(clientEnv, DBSQueryStats, "db"), ShouldBeTrue)
+		So(IsPermitted(anonymousEnv, DBSQueryStats), ShouldBeFalse)
+		So(IsPermitted(minerEnv, MetricUploadMetrics), ShouldBeTrue)
+	})
+
+	Convey("custom policy should match all criteria", t, func() {
+		So(SetACLPolicy(&conf.ACLPolicy{Rules: []conf.ACLRule{
+			{Effect: "bogus"},
+		}}), ShouldNotBeNil)
+		So(SetACLPolicy(&conf.ACLPolicy{Rules: []conf.ACLRule{
+			{Effect: ACLAllow, Roles: []string{"Root"}},
+		}}), ShouldNotBeNil)
+
+		err := SetACLPolicy(&conf.ACLPolicy{Rules: []conf.ACLRule{
+			{Effect: ACLDeny, NodeIDs: []proto.NodeID{other}},
+			{Effect: ACLAllow, Roles: []string{ACLRoleBlockProducer}},
+			{
+				Effect:    ACLAllow,
+				Roles:     []string{ACLRoleClient},
+				Databases: []proto.DatabaseID{"db1"},
+				Methods:   []string{"DBS.*"},
+			},
+			{
+				Effect:        ACLAllow,
+				Roles:         []string{ACLRoleMiner, ACLRoleUnknown},
+				ExceptNodeIDs: []proto.NodeID{client},
+				Methods:       []string{"*"},
+			},
+		}})
+		So(err, ShouldBeNil)
+
+		So(IsPermitted(otherEnv, DHTPing), ShouldBeFalse)
+		So(IsPermitted(bpEnv, KayakCall), ShouldBeTrue)
+		So(IsPermittedOnDatabase(clientEnv, DBSQuery, "db1"), ShouldBeTrue)
+		So(IsPermittedOnDatabase(clientEnv, DBSAck, "db1"), ShouldBeTrue)
+		So(IsPermittedOnDatabase(clientEnv, DBSQuery, "db2"), ShouldBeFalse)
+		So(IsPermitted(clientEnv, DHTPing), ShouldBeFalse)
+		So(IsPermitted(minerEnv, KayakCall), ShouldBeTrue)
+		So(IsMethodPermitted(&proto.Envelope{}, "Any.Method", ""), ShouldBeTrue)
+		So(IsPermitted(anonymousEnv, DHTPing), ShouldBeFalse)
+	})
+
+	Convey("policy file should be reloaded and denied calls audited", t, func() {
+		dir, err := ioutil.TempDir("", "acl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		policyFile := filepath.Join(dir, "acl.yaml")
+		auditFile := filepath.Join(dir, "audit.log")
+
+		So(ioutil.WriteFile(policyFile, []byte("Rules:\n  - Effect: allow\n    Methods: [DHT.Ping]\n"), 0600), ShouldBeNil)
+		So(LoadACLPolicyFile(policyFile), ShouldBeNil)
+		So(SetACLAuditLogFile(auditFile), ShouldBeNil)
+		defer SetACLAuditLogFile("")
+		So(IsPermitted(minerEnv, DHTPing), ShouldBeTrue)
+		So(IsPermittedOnDatabase(minerEnv, DBSQuery, "db1"), ShouldBeFalse)
+
+		stop := WatchACLPolicyFile(policyFile, 10*time.Millisecond)
+		defer stop()
+		// invalid policies are ignored
+		So(ioutil.WriteFile(policyFile, []byte("Rules:\n  - Effect: maybe\n"), 0600), ShouldBeNil)
+		os.Chtimes(policyFile, time.Now(), time.Now().Add(time.Second))
+		time.Sleep(100 * time.Millisecond)
+		So(IsPermitted(minerEnv, DHTPing), ShouldBeTrue)
+
+		So(ioutil.WriteFile(policyFile, []byte("Rules:\n  - Effect: allow\n    Methods: [DBS.Query]\n"), 0600), ShouldBeNil)
+		os.Chtimes(policyFile, time.Now(), time.Now().Add(2*time.Second))
+		time.Sleep(100 * time.Millisecond)
+		So(IsPermittedOnDatabase(minerEnv, DBSQuery, "db1"), ShouldBeTrue)
+		So(IsPermitted(minerEnv, DHTPing), ShouldBeFalse)
+
+		f, err := os.Open(auditFile)
+		So(err, ShouldBeNil)
+		defer f.Close()
+		var records []aclAuditRecord
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var r aclAuditRecord
+			So(json.Unmarshal(scanner.Bytes(), &r), ShouldBeNil)
+			records = append(records, r)
+		}
+		So(records, ShouldHaveLength, 2)
+		So(records[0].NodeID, ShouldEqual, miner)
+		So(records[0].Role, ShouldEqual, ACLRoleMiner)
+		So(records[0].Method, ShouldEqual, DBSQuery.String())
+		So(records[0].Database, ShouldEqual, "db1")
+		So(records[0].Rule, ShouldEqual, -1)
+		So(records[1].Method, ShouldEqual, DHTPing.String())
+	})
+}
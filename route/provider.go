@@ -0,0 +1,159 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DNSBootstrapProvider is the name of the DNSSEC seed provider.
+	DNSBootstrapProvider = "dns"
+	// FileBootstrapProvider is the name of the signed seed list file provider.
+	FileBootstrapProvider = "file"
+	// MulticastBootstrapProvider is the name of the LAN multicast provider.
+	MulticastBootstrapProvider = "multicast"
+)
+
+var (
+	// ErrNoBootstrapProvider indicates no bootstrap provider discovered any block producer.
+	ErrNoBootstrapProvider = errors.New("no block producer discovered by bootstrap providers")
+
+	bootstrapProviders     = make(map[string]BootstrapProviderFactory)
+	bootstrapProvidersLock sync.RWMutex
+)
+
+// BootstrapProvider defines the source to discover the block producers on startup.
+type BootstrapProvider interface {
+	// GetBPs returns the block producer nodes.
+	GetBPs() (BPNodes IDNodeMap, err error)
+}
+
+// BootstrapProviderFactory creates the bootstrap provider from the seed config.
+type BootstrapProviderFactory func(seed *conf.DNSSeed) (BootstrapProvider, error)
+
+func init() {
+	RegisterBootstrapProvider(DNSBootstrapProvider, func(seed *conf.DNSSeed) (BootstrapProvider, error) {
+		return &DNSProvider{Domain: BPDomain}, nil
+	})
+	RegisterBootstrapProvider(FileBootstrapProvider, func(seed *conf.DNSSeed) (BootstrapProvider, error) {
+		if seed.SeedFile == "" {
+			return nil, errors.New("seed file is not configured")
+		}
+		if len(seed.TrustedKeys) == 0 {
+			return nil, errors.New("trusted keys of seed file are not configured")
+		}
+		return &FileProvider{Path: seed.SeedFile, TrustedKeys: seed.TrustedKeys}, nil
+	})
+	RegisterBootstrapProvider(MulticastBootstrapProvider, func(seed *conf.DNSSeed) (BootstrapProvider, error) {
+		return NewMulticastProvider(seed.MulticastAddr, seed.MulticastTimeout), nil
+	})
+}
+
+// RegisterBootstrapProvider registers the bootstrap provider factory by name, the existing one
+// of the same name is replaced.
+func RegisterBootstrapProvider(name string, factory BootstrapProviderFactory) {
+	bootstrapProvidersLock.Lock()
+	defer bootstrapProvidersLock.Unlock()
+	bootstrapProviders[name] = factory
+}
+
+// NewBootstrapProvider creates the registered bootstrap provider by name.
+func NewBootstrapProvider(name string, seed *conf.DNSSeed) (p BootstrapProvider, err error) {
+	bootstrapProvidersLock.RLock()
+	factory, ok := bootstrapProviders[name]
+	bootstrapProvidersLock.RUnlock()
+	if !ok {
+		err = fmt.Errorf("unknown bootstrap provider: %s", name)
+		return
+	}
+	return factory(seed)
+}
+
+// GetBPFromProviders discovers the block producers by the configured bootstrap providers in
+// order, the nodes of the first provider succeeded are returned.
+func GetBPFromProviders(seed *conf.DNSSeed) (BPNodes IDNodeMap, err error) {
+	names := seed.Providers
+	if len(names) == 0 {
+		names = []string{DNSBootstrapProvider}
+	}
+	for _, name := range names {
+		var p BootstrapProvider
+		if p, err = NewBootstrapProvider(name, seed); err != nil {
+			log.WithField("provider", name).WithError(err).Error("create bootstrap provider failed")
+			continue
+		}
+		if BPNodes, err = p.GetBPs(); err != nil {
+			log.WithField("provider", name).WithError(err).Warning("discover block producers failed")
+			continue
+		}
+		if len(BPNodes) == 0 {
+			log.WithField("provider", name).Warning("no block producer discovered")
+			continue
+		}
+		log.WithFields(log.Fields{
+			"provider": name,
+			"count":    len(BPNodes),
+		}).Info("block producers discovered")
+		return BPNodes, nil
+	}
+	err = errors.Wrap(ErrNoBootstrapProvider, fmt.Sprintf("providers: %v", names))
+	return
+}
+
+// DNSProvider discovers the block producers from the DNSSEC validated seed domain.
+type DNSProvider struct {
+	Domain string
+}
+
+// GetBPs implements BootstrapProvider.GetBPs.
+func (p *DNSProvider) GetBPs() (BPNodes IDNodeMap, err error) {
+	return NewDNSClient().GetBPFromDNSSeed(p.Domain)
+}
+
+// FileProvider discovers the block producers from a seed list file signed by a trusted key.
+type FileProvider struct {
+	Path        string
+	TrustedKeys []*asymmetric.PublicKey
+}
+
+// GetBPs implements BootstrapProvider.GetBPs.
+func (p *FileProvider) GetBPs() (BPNodes IDNodeMap, err error) {
+	var l *SeedList
+	if l, err = LoadSeedList(p.Path); err != nil {
+		return
+	}
+	if err = l.VerifyTrusted(p.TrustedKeys); err != nil {
+		return
+	}
+	BPNodes = make(IDNodeMap)
+	for _, n := range l.Nodes {
+		if n.Role != proto.Leader {
+			// the same as DNS seed, BP is follower by default
+			n.Role = proto.Follower
+		}
+		BPNodes[*n.ID.ToRawNodeID()] = n
+	}
+	return
+}
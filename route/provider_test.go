@@ -0,0 +1,181 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testBootstrapProvider struct {
+	nodes IDNodeMap
+	err   error
+}
+
+func (p *testBootstrapProvider) GetBPs() (IDNodeMap, error) {
+	return p.nodes, p.err
+}
+
+func testSeedNode(addr string) proto.Node {
+	_, pub, _ := asymmetric.GenSecp256k1KeyPair()
+	nonce := asymmetric.GetPubKeyNonce(pub, 1, 100*time.Millisecond, nil)
+	return proto.Node{
+		ID:        proto.NodeID(nonce.Hash.String()),
+		Addr:      addr,
+		PublicKey: pub,
+		Nonce:     nonce.Nonce,
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	Convey("test signed seed list file provider", t, func() {
+		dir, err := ioutil.TempDir("", "seedlist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "seed.list")
+
+		priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		_, other, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+
+		l := &SeedList{
+			SeedListHeader: SeedListHeader{
+				Nodes: []proto.Node{
+					testSeedNode("127.0.0.1:1"),
+					testSeedNode("127.0.0.1:2"),
+				},
+				Timestamp: time.Now().UTC(),
+			},
+		}
+		l.Nodes[0].Role = proto.Leader
+		So(l.Sign(priv), ShouldBeNil)
+		So(SaveSeedList(path, l), ShouldBeNil)
+
+		p := &FileProvider{Path: path, TrustedKeys: []*asymmetric.PublicKey{other}}
+		_, err = p.GetBPs()
+		So(err, ShouldEqual, ErrUntrustedSeedList)
+
+		p.TrustedKeys = append(p.TrustedKeys, pub)
+		nodes, err := p.GetBPs()
+		So(err, ShouldBeNil)
+		So(nodes, ShouldHaveLength, 2)
+		So(nodes[*l.Nodes[0].ID.ToRawNodeID()].Role, ShouldEqual, proto.Leader)
+		So(nodes[*l.Nodes[1].ID.ToRawNodeID()].Role, ShouldEqual, proto.Follower)
+		So(nodes[*l.Nodes[1].ID.ToRawNodeID()].Addr, ShouldEqual, "127.0.0.1:2")
+
+		// tampered address
+		l.Nodes[1].Addr = "127.0.0.1:3"
+		So(SaveSeedList(path, l), ShouldBeNil)
+		_, err = p.GetBPs()
+		So(err, ShouldNotBeNil)
+
+		// mismatched node key
+		l.Nodes[1].Addr = "127.0.0.1:2"
+		l.Nodes[1].PublicKey = other
+		So(l.Sign(priv), ShouldBeNil)
+		So(SaveSeedList(path, l), ShouldBeNil)
+		_, err = p.GetBPs()
+		So(err, ShouldNotBeNil)
+
+		l.Nodes = nil
+		So(l.Sign(priv), ShouldBeNil)
+		So(l.VerifyTrusted(p.TrustedKeys), ShouldEqual, ErrEmptySeedList)
+
+		_, err = (&FileProvider{Path: filepath.Join(dir, "not.exist")}).GetBPs()
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestGetBPFromProviders(t *testing.T) {
+	Convey("test bootstrap providers fallback", t, func() {
+		node := testSeedNode("127.0.0.1:1")
+		RegisterBootstrapProvider("test-fail", func(seed *conf.DNSSeed) (BootstrapProvider, error) {
+			return &testBootstrapProvider{err: errors.New("failed")}, nil
+		})
+		RegisterBootstrapProvider("test-empty", func(seed *conf.DNSSeed) (BootstrapProvider, error) {
+			return &testBootstrapProvider{}, nil
+		})
+		RegisterBootstrapProvider("test-ok", func(seed *conf.DNSSeed) (BootstrapProvider, error) {
+			return &testBootstrapProvider{nodes: IDNodeMap{*node.ID.ToRawNodeID(): node}}, nil
+		})
+
+		seed := &conf.DNSSeed{
+			Providers: []string{"test-unknown", "test-fail", "test-empty", FileBootstrapProvider, "test-ok"},
+		}
+		nodes, err := GetBPFromProviders(seed)
+		So(err, ShouldBeNil)
+		So(nodes, ShouldHaveLength, 1)
+
+		seed.Providers = []string{"test-fail", "test-empty"}
+		_, err = GetBPFromProviders(seed)
+		So(err, ShouldNotBeNil)
+
+		p, err := NewBootstrapProvider(MulticastBootstrapProvider, &conf.DNSSeed{})
+		So(err, ShouldBeNil)
+		So(p.(*MulticastProvider).Addr, ShouldEqual, DefaultMulticastAddr)
+		So(p.(*MulticastProvider).Timeout, ShouldEqual, DefaultMulticastTimeout)
+	})
+}
+
+func TestMulticastProvider(t *testing.T) {
+	Convey("test multicast discovery", t, func() {
+		if conf.GConf != nil {
+			minDifficulty := conf.GConf.MinNodeIDDifficulty
+			conf.GConf.MinNodeIDDifficulty = 1
+			defer func() { conf.GConf.MinNodeIDDifficulty = minDifficulty }()
+		}
+
+		addr := "239.255.67.81:14661"
+		bp, bpPriv := signedRecord("127.0.0.1:2")
+		bp.Node.Role = proto.Follower
+		So(bp.Sign(bpPriv), ShouldBeNil)
+
+		// record signed by a key other than the node key
+		_, priv := signedRecord("")
+		forged := *bp
+		forged.Node.Addr = "127.0.0.1:3"
+		So(forged.Sign(priv), ShouldBeNil)
+
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		if err := ServeMulticast(addr, func() (*proto.NodeRecord, error) { return bp, nil }, stopCh); err != nil {
+			SkipSo(err, ShouldBeNil)
+			return
+		}
+		ServeMulticast(addr, func() (*proto.NodeRecord, error) { return &forged, nil }, stopCh)
+
+		nodes, err := NewMulticastProvider(addr, 500*time.Millisecond).GetBPs()
+		So(err, ShouldBeNil)
+		if len(nodes) == 0 {
+			// multicast is not routed in the environment
+			SkipSo(nodes, ShouldNotBeEmpty)
+			return
+		}
+		So(nodes, ShouldHaveLength, 1)
+		So(nodes[*bp.Node.ID.ToRawNodeID()].Addr, ShouldEqual, "127.0.0.1:2")
+	})
+}
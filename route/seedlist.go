@@ -0,0 +1,108 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+)
+
+//go:generate hsp
+
+var (
+	// ErrEmptySeedList indicates the seed list contains no block producer.
+	ErrEmptySeedList = errors.New("empty seed list")
+	// ErrUntrustedSeedList indicates the seed list is not signed by a trusted key.
+	ErrUntrustedSeedList = errors.New("seed list is not signed by a trusted key")
+)
+
+// SeedListHeader defines the block producer seed list content.
+type SeedListHeader struct {
+	Nodes     []proto.Node
+	Timestamp time.Time
+}
+
+// SeedList defines the block producer seed list signed by a trusted key, which is distributed
+// as a file to the nodes can't access the DNS seed.
+type SeedList struct {
+	SeedListHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Sign generates signature.
+func (l *SeedList) Sign(signer asymmetric.Signer) (err error) {
+	return l.DefaultHashSignVerifierImpl.Sign(&l.SeedListHeader, signer)
+}
+
+// Verify verify signature.
+func (l *SeedList) Verify() (err error) {
+	return l.DefaultHashSignVerifierImpl.Verify(&l.SeedListHeader)
+}
+
+// VerifyTrusted checks the signature of the seed list is signed by one of the trusted keys,
+// and the node id, nonce and public key of each node match.
+func (l *SeedList) VerifyTrusted(trustedKeys []*asymmetric.PublicKey) (err error) {
+	if err = l.Verify(); err != nil {
+		return
+	}
+	trusted := false
+	for _, k := range trustedKeys {
+		if k != nil && l.Signee != nil && k.IsEqual(l.Signee) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return ErrUntrustedSeedList
+	}
+	if len(l.Nodes) == 0 {
+		return ErrEmptySeedList
+	}
+	for _, n := range l.Nodes {
+		if !kms.IsIDPubNonceValid(n.ID.ToRawNodeID(), &n.Nonce, n.PublicKey) {
+			return fmt.Errorf("seed node %s id pubkey nonce not match", n.ID)
+		}
+	}
+	return
+}
+
+// LoadSeedList reads the seed list file.
+func LoadSeedList(path string) (l *SeedList, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	err = utils.DecodeMsgPack(data, &l)
+	return
+}
+
+// SaveSeedList writes the seed list file.
+func SaveSeedList(path string, l *SeedList) (err error) {
+	buf, err := utils.EncodeMsgPack(l)
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
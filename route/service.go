@@ -18,6 +18,7 @@ package route
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/consistent"
@@ -26,6 +27,35 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 )
 
+// RotateKeyReq is RotateKey RPC request
+type RotateKeyReq struct {
+	Rotation *kms.KeyRotation
+	proto.Envelope
+}
+
+// RotateKeyResp is RotateKey RPC response
+type RotateKeyResp struct {
+	proto.Envelope
+}
+
+// FindKeyRotationReq is FindKeyRotation RPC request, ID is a NodeID or an account address.
+type FindKeyRotationReq struct {
+	ID string
+	proto.Envelope
+}
+
+// FindKeyRotationResp is FindKeyRotation RPC response
+type FindKeyRotationResp struct {
+	Rotation *kms.KeyRotation
+	proto.Envelope
+}
+
+const (
+	// DefaultRecordPruneInterval defines the default interval to prune the expired node records
+	// from DHT.
+	DefaultRecordPruneInterval = time.Minute
+)
+
 // DHTService is server side RPC implementation
 type DHTService struct {
 	Consistent *consistent.Consistent
@@ -68,6 +98,9 @@ func (DHT *DHTService) FindNode(req *proto.FindNodeReq, resp *proto.FindNodeResp
 		return
 	}
 	resp.Node = node
+	if record, err := DHT.Consistent.GetNodeRecord(req.ID); err == nil && record.IsSigned() {
+		resp.Record = record
+	}
 	return
 }
 
@@ -93,7 +126,9 @@ func (DHT *DHTService) FindNeighbor(req *proto.FindNeighborReq, resp *proto.Find
 	return
 }
 
-// Ping RPC adds PingReq.Node to DHT
+// Ping RPC adds PingReq.Record or PingReq.Node to DHT, the signed record is stored only if
+// it's newer than the stored one. The unsigned node can't replace an unexpired signed record,
+// it expires after DefaultNodeRecordTTL unless pinged again.
 func (DHT *DHTService) Ping(req *proto.PingReq, resp *proto.PingResp) (err error) {
 	log.Debugf("got req: %#v", req)
 	if !IsPermitted(&req.Envelope, DHTPing) {
@@ -102,8 +137,29 @@ func (DHT *DHTService) Ping(req *proto.PingReq, resp *proto.PingResp) (err error
 		return
 	}
 
+	if req.Record != nil {
+		if err = VerifyNodeRecord(req.Record); err != nil {
+			err = fmt.Errorf("node record %s verify failed: %s", req.Record.Node.ID, err)
+			log.Error(err)
+			return
+		}
+		if err = DHT.Consistent.AddRecord(req.Record); err != nil {
+			err = fmt.Errorf("DHT.Consistent.AddRecord %v failed: %s", req.Record.Node, err)
+		} else {
+			resp.Msg = "Pong"
+		}
+		return
+	}
+
+	if record, errGet := DHT.Consistent.GetNodeRecord(req.Node.ID); errGet == nil &&
+		record.IsSigned() && !record.IsExpired(time.Now()) {
+		err = fmt.Errorf("node: %s has signed record, unsigned node is rejected", req.Node.ID)
+		log.Error(err)
+		return
+	}
+
 	// Checking if ID Nonce Pubkey matched
-	if !kms.IsIDPubNonceValid(req.Node.ID.ToRawNodeID(), &req.Node.Nonce, req.Node.PublicKey) {
+	if !kms.IsNodeKeyValid(req.Node.ID.ToRawNodeID(), &req.Node.Nonce, req.Node.PublicKey) {
 		err = fmt.Errorf("node: %s nonce public key not match", req.Node.ID)
 		log.Error(err)
 		return
@@ -116,11 +172,75 @@ func (DHT *DHTService) Ping(req *proto.PingReq, resp *proto.PingResp) (err error
 		return
 	}
 
-	err = DHT.Consistent.Add(req.Node)
+	err = DHT.Consistent.AddUnsigned(req.Node, proto.DefaultNodeRecordTTL)
 	if err != nil {
-		err = fmt.Errorf("DHT.Consistent.Add %v failed: %s", req.Node, err)
+		err = fmt.Errorf("DHT.Consistent.AddUnsigned %v failed: %s", req.Node, err)
 	} else {
 		resp.Msg = "Pong"
 	}
 	return
 }
+
+// RotateKey RPC registers a key rotation record, the node key in DHT is replaced by the new key
+func (DHT *DHTService) RotateKey(req *RotateKeyReq, resp *RotateKeyResp) (err error) {
+	if !IsPermitted(&req.Envelope, DHTRotateKey) {
+		err = fmt.Errorf("calling RotateKey from node %s is not permitted", req.GetNodeID())
+		log.Error(err)
+		return
+	}
+	if err = kms.SetKeyRotation(req.Rotation); err != nil {
+		err = fmt.Errorf("set key rotation failed: %s", err)
+		log.Error(err)
+		return
+	}
+	if req.Rotation.NodeID.IsEmpty() {
+		return
+	}
+	node, err := DHT.Consistent.GetNode(string(*req.Rotation.NodeID))
+	if err != nil {
+		// not registered to DHT yet
+		err = nil
+		return
+	}
+	node.PublicKey = req.Rotation.NewKey
+	if err = DHT.Consistent.Add(*node); err != nil {
+		err = fmt.Errorf("DHT.Consistent.Add %v failed: %s", node, err)
+	}
+	return
+}
+
+// FindKeyRotation RPC returns the latest key rotation record of the requested node or account
+func (DHT *DHTService) FindKeyRotation(req *FindKeyRotationReq, resp *FindKeyRotationResp) (err error) {
+	if !IsPermitted(&req.Envelope, DHTFindKeyRotation) {
+		err = fmt.Errorf("calling FindKeyRotation from node %s is not permitted", req.GetNodeID())
+		log.Error(err)
+		return
+	}
+	if resp.Rotation, err = kms.GetKeyRotation(req.ID); err != nil {
+		err = fmt.Errorf("get key rotation of %s failed: %s", req.ID, err)
+	}
+	return
+}
+
+// PruneExpiredRecords removes the nodes whose records are expired from DHT.
+func (DHT *DHTService) PruneExpiredRecords() (pruned []proto.NodeID) {
+	if pruned = DHT.Consistent.PruneExpired(time.Now()); len(pruned) > 0 {
+		log.WithField("nodes", pruned).Info("pruned expired node records")
+	}
+	return
+}
+
+// RunRecordPruner prunes the expired node records every interval until stopCh is closed.
+func (DHT *DHTService) RunRecordPruner(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			DHT.PruneExpiredRecords()
+		}
+	}
+}
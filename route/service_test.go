@@ -267,3 +267,78 @@ func TestDHTService_Ping(t *testing.T) {
 	log.Debugf("respA2: %v", respA2)
 	rc.Close()
 }
+
+func TestDHTService_PingRecord(t *testing.T) {
+	Convey("test ping with signed node record", t, func() {
+		os.Remove(DHTStorePath + "2")
+		defer os.Remove(DHTStorePath + "2")
+		minDifficulty := conf.GConf.MinNodeIDDifficulty
+		conf.GConf.MinNodeIDDifficulty = 1
+		defer func() { conf.GConf.MinNodeIDDifficulty = minDifficulty }()
+
+		dht, err := NewDHTService(DHTStorePath+"2", new(consistent.KMSStorage), false)
+		So(err, ShouldBeNil)
+
+		record, priv := signedRecord("127.0.0.1:1")
+		So(dht.Ping(&PingReq{Record: record}, new(PingResp)), ShouldBeNil)
+		resp := new(FindNodeResp)
+		So(dht.FindNode(&FindNodeReq{ID: record.Node.ID}, resp), ShouldBeNil)
+		So(resp.Node.Addr, ShouldEqual, "127.0.0.1:1")
+		So(resp.Record, ShouldNotBeNil)
+		So(resp.Record.Seq, ShouldEqual, 1)
+
+		// unsigned node can't replace the signed record
+		unsigned := record.Node
+		unsigned.Addr = "127.0.0.1:2"
+		err = dht.Ping(&PingReq{Node: unsigned}, new(PingResp))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "has signed record")
+
+		// stale record is rejected
+		stale := *record
+		stale.Node.Addr = "127.0.0.1:3"
+		So(stale.Sign(priv), ShouldBeNil)
+		err = dht.Ping(&PingReq{Record: &stale}, new(PingResp))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, consistent.ErrStaleNodeRecord.Error())
+
+		// tampered record is rejected
+		stale.Seq = 2
+		So(dht.Ping(&PingReq{Record: &stale}, new(PingResp)), ShouldNotBeNil)
+
+		newer := *record
+		newer.Seq = 2
+		newer.Node.Addr = "127.0.0.1:4"
+		So(newer.Sign(priv), ShouldBeNil)
+		So(dht.Ping(&PingReq{Record: &newer}, new(PingResp)), ShouldBeNil)
+		resp = new(FindNodeResp)
+		So(dht.FindNode(&FindNodeReq{ID: record.Node.ID}, resp), ShouldBeNil)
+		So(resp.Node.Addr, ShouldEqual, "127.0.0.1:4")
+
+		// expired records are pruned
+		So(dht.PruneExpiredRecords(), ShouldBeEmpty)
+		pruned := dht.Consistent.PruneExpired(time.Now().Add(2 * time.Hour))
+		So(pruned, ShouldResemble, []NodeID{record.Node.ID})
+		So(dht.FindNode(&FindNodeReq{ID: record.Node.ID}, new(FindNodeResp)), ShouldNotBeNil)
+
+		// unsigned node is accepted after the signed record expires and expires as well
+		So(dht.Ping(&PingReq{Node: unsigned}, new(PingResp)), ShouldBeNil)
+		resp = new(FindNodeResp)
+		So(dht.FindNode(&FindNodeReq{ID: record.Node.ID}, resp), ShouldBeNil)
+		So(resp.Node.Addr, ShouldEqual, "127.0.0.1:2")
+		So(resp.Record, ShouldBeNil)
+		So(dht.Ping(&PingReq{Node: unsigned}, new(PingResp)), ShouldBeNil)
+		So(dht.PruneExpiredRecords(), ShouldBeEmpty)
+		pruned = dht.Consistent.PruneExpired(time.Now().Add(DefaultNodeRecordTTL))
+		So(pruned, ShouldResemble, []NodeID{record.Node.ID})
+		So(dht.FindNode(&FindNodeReq{ID: record.Node.ID}, new(FindNodeResp)), ShouldNotBeNil)
+
+		// signed record replaces the unsigned node regardless of the sequence
+		So(dht.Ping(&PingReq{Node: unsigned}, new(PingResp)), ShouldBeNil)
+		So(dht.Ping(&PingReq{Record: record}, new(PingResp)), ShouldBeNil)
+		resp = new(FindNodeResp)
+		So(dht.FindNode(&FindNodeReq{ID: record.Node.ID}, resp), ShouldBeNil)
+		So(resp.Node.Addr, ShouldEqual, "127.0.0.1:1")
+		So(resp.Record, ShouldNotBeNil)
+	})
+}
@@ -18,15 +18,22 @@
 package rpc
 
 import (
+	"context"
 	"net"
 	"net/rpc"
+	"reflect"
+	"sync"
+	"time"
 
+	"github.com/pkg/errors"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/crypto/etls"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
 	"github.com/CovenantSQL/CovenantSQL/proto"
-	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/CovenantSQL/CovenantSQL/utils/trace"
 	mux "github.com/xtaci/smux"
 )
 
@@ -42,16 +49,55 @@ var (
 	YamuxConfig *mux.Config
 	// DefaultDialer holds the default dialer of SessionPool
 	DefaultDialer func(nodeID proto.NodeID) (conn net.Conn, err error)
+	// etlsV1Peers maps the RawNodeID of peers rejecting ETLS v2 explicitly to the
+	// expiry time of the record, so they are not probed on each dial during a rollout.
+	etlsV1Peers sync.Map
 )
 
+// etlsV1PeerTTL is the time before a v1 peer is probed with ETLS v2 again.
+const etlsV1PeerTTL = 10 * time.Minute
+
 func init() {
 	YamuxConfig = mux.DefaultConfig()
 	DefaultDialer = dialToNode
 }
 
-// dial connects to a address with a Cipher
+// minETLSVersion returns the lowest ETLS version accepted by this node.
+func minETLSVersion() int {
+	if conf.GConf != nil && conf.GConf.MinETLSVersion > etls.Version1 {
+		return conf.GConf.MinETLSVersion
+	}
+	return etls.Version1
+}
+
+// maxETLSVersion returns the highest ETLS version accepted by this node.
+func maxETLSVersion() int {
+	if conf.GConf != nil && conf.GConf.MaxETLSVersion == etls.Version1 {
+		return etls.Version1
+	}
+	return etls.Version2
+}
+
+// peerETLSVersion returns the ETLS version to dial the node with.
+func peerETLSVersion(rawNodeID *proto.RawNodeID) int {
+	if minETLSVersion() >= etls.Version2 {
+		return etls.Version2
+	}
+	if maxETLSVersion() < etls.Version2 {
+		return etls.Version1
+	}
+	if expire, ok := etlsV1Peers.Load(*rawNodeID); ok {
+		if time.Now().Before(expire.(time.Time)) {
+			return etls.Version1
+		}
+		etlsV1Peers.Delete(*rawNodeID)
+	}
+	return etls.Version2
+}
+
+// dial connects to a address with a Cipher speaking ETLS 'version'
 // address should be in the form of host:port
-func dial(network, address string, remoteNodeID *proto.RawNodeID, cipher *etls.Cipher, isAnonymous bool) (c *etls.CryptoConn, err error) {
+func dial(network, address string, remoteNodeID *proto.RawNodeID, cipher *etls.Cipher, isAnonymous bool, version int) (c *etls.CryptoConn, err error) {
 	conn, err := net.Dial(network, address)
 	if err != nil {
 		log.WithField("addr", address).WithError(err).Error("connect to node failed")
@@ -82,7 +128,7 @@ func dial(network, address string, remoteNodeID *proto.RawNodeID, cipher *etls.C
 		return
 	}
 
-	c = etls.NewConn(conn, cipher, remoteNodeID)
+	c = etls.NewClientConn(conn, cipher, remoteNodeID, version)
 	return
 }
 
@@ -147,17 +193,36 @@ func dialToNodeEx(nodeID proto.NodeID, isAnonymous bool) (conn net.Conn, err err
 		return
 	}
 
-	cipher := etls.NewCipher(symmetricKey)
-	conn, err = dial("tcp", nodeAddr, rawNodeID, cipher, isAnonymous)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"target": rawNodeID.String(),
-			"addr":   nodeAddr,
-		}).WithError(err).Error("connect failed")
+	version := peerETLSVersion(rawNodeID)
+	for {
+		var c *etls.CryptoConn
+		c, err = dial("tcp", nodeAddr, rawNodeID, etls.NewCipher(symmetricKey), isAnonymous, version)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"target": rawNodeID.String(),
+				"addr":   nodeAddr,
+			}).WithError(err).Error("connect failed")
+			return
+		}
+		if err = c.Handshake(); err != nil {
+			c.Close()
+			if version > etls.Version1 && minETLSVersion() < etls.Version2 &&
+				errors.Cause(err) == etls.ErrVersionNotSupported {
+				// The peer rejected v2 explicitly, fallback to v1.
+				log.WithField("target", rawNodeID.String()).WithError(err).Info("fallback to etls v1")
+				etlsV1Peers.Store(*rawNodeID, time.Now().Add(etlsV1PeerTTL))
+				version = etls.Version1
+				continue
+			}
+			log.WithFields(log.Fields{
+				"target": rawNodeID.String(),
+				"addr":   nodeAddr,
+			}).WithError(err).Error("etls handshake failed")
+			return
+		}
+		conn = c
 		return
 	}
-
-	return
 }
 
 // NewClient returns a RPC client
@@ -194,14 +259,70 @@ func InitClientConn(conn net.Conn) (client *Client, err error) {
 		}
 	}
 	client.Conn = muxConn
-	client.Client = rpc.NewClientWithCodec(utils.GetMsgPackClientCodec(muxConn))
+	client.Client = rpc.NewClientWithCodec(newClientCodec(muxConn, clientCodecFor(conn.RemoteAddr().String())))
 	client.RemoteAddr = conn.RemoteAddr().String()
 
 	return client, nil
 }
 
+// Call invokes the named function, waits for it to complete, and returns its error status.
+func (c *Client) Call(method string, args interface{}, reply interface{}) error {
+	return c.CallWithContext(context.Background(), method, args, reply)
+}
+
+// CallWithContext invokes the named function, waits for it to complete or the context to
+// be done, and returns its error status. The remaining time of the context deadline is
+// sent with the request envelope. A cancelled call is abandoned, the late reply is decoded
+// into a private value and dropped, so the client keeps serving other calls. Calls
+// rejected by the server limits return ErrThrottled.
+func (c *Client) CallWithContext(ctx context.Context, method string, args interface{}, reply interface{}) (err error) {
+	start := time.Now()
+	defer func() {
+		recordClientCall(method, start, err)
+	}()
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if e, ok := args.(proto.EnvelopeAPI); ok {
+		if deadline, ok := ctx.Deadline(); ok {
+			e.SetExpire(time.Until(deadline))
+		}
+		// propagate the trace of the caller
+		trace.Inject(ctx, e)
+	}
+
+	if ctx.Done() == nil {
+		// never cancelled
+		err = c.Client.Call(method, args, reply)
+	} else {
+		// net/rpc can't abort a pending call, decode the reply into a private value which is
+		// copied to the caller reply only if the call is not abandoned
+		private := reply
+		if v := reflect.ValueOf(reply); v.Kind() == reflect.Ptr && !v.IsNil() {
+			private = reflect.New(v.Type().Elem()).Interface()
+		}
+		call := c.Go(method, args, private, make(chan *rpc.Call, 1))
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-call.Done:
+			if err = call.Error; err == nil && private != reply {
+				reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(private).Elem())
+			}
+		}
+	}
+	if serverErr, ok := err.(rpc.ServerError); ok && string(serverErr) == ErrThrottled.Error() {
+		err = ErrThrottled
+	}
+	return
+}
+
 // Close the client RPC connection
 func (c *Client) Close() {
 	log.WithField("addr", c.RemoteAddr).Debug("closing client")
 	c.Client.Close()
+	if stream, ok := c.Conn.(*mux.Stream); ok {
+		stream.Close()
+	}
 }
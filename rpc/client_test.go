@@ -20,6 +20,7 @@ import (
 	"net"
 	"testing"
 
+	"github.com/CovenantSQL/CovenantSQL/crypto/etls"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	mine "github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
 	. "github.com/smartystreets/goconvey/convey"
@@ -32,30 +33,30 @@ const pass = "abc"
 
 func TestDial(t *testing.T) {
 	Convey("dial error case", t, func() {
-		c, err := dial("tcp", "wrongaddr", nil, nil, false)
+		c, err := dial("tcp", "wrongaddr", nil, nil, false, etls.Version1)
 		So(c, ShouldBeNil)
 		So(err, ShouldNotBeNil)
 
 		var l net.Listener
 		l, _ = net.Listen("tcp", "127.0.0.1:0")
-		c, err = dial("tcp", l.Addr().String(), nil, nil, false)
+		c, err = dial("tcp", l.Addr().String(), nil, nil, false, etls.Version1)
 		So(c, ShouldBeNil)
 		So(err, ShouldNotBeNil)
 
 		kms.SetLocalNodeIDNonce([]byte(nodeID), nil)
-		c, err = dial("tcp", l.Addr().String(), nil, nil, false)
+		c, err = dial("tcp", l.Addr().String(), nil, nil, false, etls.Version1)
 		So(c, ShouldBeNil)
 		So(err, ShouldNotBeNil)
 
 		kms.SetLocalNodeIDNonce([]byte(nodeID), &mine.Uint256{A: 1, B: 1, C: 1, D: 1})
-		c, err = dial("tcp", l.Addr().String(), nil, nil, false)
+		c, err = dial("tcp", l.Addr().String(), nil, nil, false, etls.Version1)
 		So(c, ShouldNotBeNil)
 		So(err, ShouldBeNil)
 
 		go func() {
 			l.Accept()
 		}()
-		c, err = dial("tcp", l.Addr().String(), nil, nil, false)
+		c, err = dial("tcp", l.Addr().String(), nil, nil, false, etls.Version1)
 		So(c, ShouldNotBeNil)
 		So(err, ShouldBeNil)
 	})
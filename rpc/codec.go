@@ -19,8 +19,11 @@ package rpc
 import (
 	"context"
 	"net/rpc"
+	"sync"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/trace"
 )
 
 // NodeAwareServerCodec wraps normal rpc.ServerCodec and inject node id during request process
@@ -28,6 +31,27 @@ type NodeAwareServerCodec struct {
 	rpc.ServerCodec
 	NodeID *proto.RawNodeID
 	Ctx    context.Context
+
+	// trustTrace honors the sampling of the caller trace set in the request envelope.
+	trustTrace bool
+
+	// limiter admits the calls read, nil for unlimited.
+	limiter *serverLimiter
+	// writeLock serializes the responses written by net/rpc and the codec itself.
+	writeLock sync.Mutex
+
+	sync.Mutex
+	// reading is the seq of the request being read, net/rpc reads header and body
+	// of a request in sequence.
+	reading uint64
+	calls   map[uint64]*serverCall
+}
+
+// serverCall tracks a request until its response is written.
+type serverCall struct {
+	start   time.Time
+	cancel  context.CancelFunc
+	release func()
 }
 
 // NewNodeAwareServerCodec returns new NodeAwareServerCodec with normal rpc.ServerCode and proto.RawNodeID
@@ -36,7 +60,50 @@ func NewNodeAwareServerCodec(ctx context.Context, codec rpc.ServerCodec, nodeID
 		ServerCodec: codec,
 		NodeID:      nodeID,
 		Ctx:         ctx,
+		calls:       make(map[uint64]*serverCall),
+	}
+}
+
+// ReadRequestHeader override default rpc.ServerCodec behaviour and start tracking the request,
+// the requests rejected by the limiter are answered with ErrThrottled and skipped.
+func (nc *NodeAwareServerCodec) ReadRequestHeader(r *rpc.Request) (err error) {
+	var call *serverCall
+	for {
+		if err = nc.ServerCodec.ReadRequestHeader(r); err != nil {
+			return
+		}
+		call = &serverCall{start: time.Now()}
+		if nc.limiter == nil {
+			break
+		}
+		var limitErr error
+		if call.release, limitErr = nc.limiter.acquireCall(r.ServiceMethod, call.start); limitErr == nil {
+			break
+		}
+		if err = nc.reject(r, limitErr); err != nil {
+			return
+		}
+	}
+	nc.Lock()
+	defer nc.Unlock()
+	nc.reading = r.Seq
+	nc.calls[r.Seq] = call
+	return
+}
+
+// reject discards the body of request 'r' and answers with 'reason'.
+func (nc *NodeAwareServerCodec) reject(r *rpc.Request, reason error) (err error) {
+	if err = nc.ServerCodec.ReadRequestBody(nil); err != nil {
+		return
 	}
+	recordThrottledCall(r.ServiceMethod)
+	nc.writeLock.Lock()
+	defer nc.writeLock.Unlock()
+	return nc.ServerCodec.WriteResponse(&rpc.Response{
+		ServiceMethod: r.ServiceMethod,
+		Seq:           r.Seq,
+		Error:         reason.Error(),
+	}, struct{}{})
 }
 
 // ReadRequestBody override default rpc.ServerCodec behaviour and inject remote node id into request
@@ -54,9 +121,60 @@ func (nc *NodeAwareServerCodec) ReadRequestBody(body interface{}) (err error) {
 	if r, ok := body.(proto.EnvelopeAPI); ok {
 		// inject node id to rpc envelope
 		r.SetNodeID(nc.NodeID)
-		// inject context
-		r.SetContext(nc.Ctx)
+		// inject context, bounded by the remaining deadline of the caller
+		ctx := nc.Ctx
+		if expire := r.GetExpire(); expire > 0 {
+			nc.Lock()
+			if call, ok := nc.calls[nc.reading]; ok {
+				ctx, call.cancel = context.WithTimeout(ctx, expire)
+			}
+			nc.Unlock()
+		}
+		// continue the trace of the caller, the untrusted ones are sampled locally
+		if nc.trustTrace {
+			ctx = trace.Extract(ctx, r)
+		} else {
+			ctx = trace.ExtractUntrusted(ctx, r)
+		}
+		r.SetContext(ctx)
 	}
 
 	return
 }
+
+// WriteResponse override default rpc.ServerCodec behaviour and record the call metrics
+func (nc *NodeAwareServerCodec) WriteResponse(r *rpc.Response, body interface{}) (err error) {
+	nc.writeLock.Lock()
+	err = nc.ServerCodec.WriteResponse(r, body)
+	nc.writeLock.Unlock()
+
+	nc.Lock()
+	call, ok := nc.calls[r.Seq]
+	delete(nc.calls, r.Seq)
+	nc.Unlock()
+	if ok {
+		call.done()
+		recordServerCall(r.ServiceMethod, call.start, r.Error)
+	}
+	return
+}
+
+// Close releases the calls not answered and closes the codec.
+func (nc *NodeAwareServerCodec) Close() error {
+	nc.Lock()
+	for seq, call := range nc.calls {
+		call.done()
+		delete(nc.calls, seq)
+	}
+	nc.Unlock()
+	return nc.ServerCodec.Close()
+}
+
+func (c *serverCall) done() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.release != nil {
+		c.release()
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"context"
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/trace"
+	metrics "github.com/rcrowley/go-metrics"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type SleepReq struct {
+	proto.Envelope
+	Duration time.Duration
+}
+
+type SleepService struct {
+	deadlines chan time.Duration
+}
+
+func (s *SleepService) Sleep(req *SleepReq, rep *int) error {
+	ctx := req.GetContext()
+	if deadline, ok := ctx.Deadline(); ok {
+		s.deadlines <- time.Until(deadline)
+	} else {
+		s.deadlines <- 0
+	}
+	time.Sleep(req.Duration)
+	*rep = int(req.Duration / time.Millisecond)
+	return nil
+}
+
+func TestCallWithContext(t *testing.T) {
+	Convey("call with deadline", t, func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		service := &SleepService{deadlines: make(chan time.Duration, 10)}
+		server, err := NewServerWithService(ServiceMap{"Test": service})
+		So(err, ShouldBeNil)
+		server.SetListener(l)
+		go server.Serve()
+		defer server.Stop()
+
+		client, err := initClient(l.Addr().String())
+		So(err, ShouldBeNil)
+		rep := new(int)
+		So(client.Call("Test.Sleep", &SleepReq{Duration: time.Millisecond}, rep), ShouldBeNil)
+		So(<-service.deadlines, ShouldEqual, 0)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err = client.CallWithContext(ctx, "Test.Sleep", &SleepReq{Duration: 10 * time.Second}, rep)
+		So(err == context.DeadlineExceeded, ShouldBeTrue)
+		So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+
+		// the remaining deadline is propagated to the server
+		remaining := <-service.deadlines
+		So(remaining, ShouldBeGreaterThan, 0)
+		So(remaining, ShouldBeLessThanOrEqualTo, 200*time.Millisecond)
+
+		// only the cancelled call is abandoned, the client keeps working
+		So(client.Call("Test.Sleep", &SleepReq{}, rep), ShouldBeNil)
+		So(<-service.deadlines, ShouldEqual, 0)
+
+		// the late reply of an abandoned call is dropped
+		shortCtx, shortCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer shortCancel()
+		err = client.CallWithContext(shortCtx, "Test.Sleep", &SleepReq{Duration: 300 * time.Millisecond}, rep)
+		So(err == context.DeadlineExceeded, ShouldBeTrue)
+		<-service.deadlines
+		So(client.Call("Test.Sleep", &SleepReq{Duration: time.Millisecond}, rep), ShouldBeNil)
+		<-service.deadlines
+		So(*rep, ShouldEqual, 1)
+		time.Sleep(400 * time.Millisecond)
+		So(*rep, ShouldEqual, 1)
+
+		// canceled context fails without calling
+		err = client.CallWithContext(ctx, "Test.Sleep", &SleepReq{}, rep)
+		So(err == context.DeadlineExceeded, ShouldBeTrue)
+
+		timer, ok := metrics.Get(clientLatencyMetric + "Test.Sleep").(metrics.Timer)
+		So(ok, ShouldBeTrue)
+		So(timer.Count(), ShouldBeGreaterThanOrEqualTo, 3)
+		meter, ok := metrics.Get(clientErrorMetric + "Test.Sleep").(metrics.Meter)
+		So(ok, ShouldBeTrue)
+		So(meter.Count(), ShouldBeGreaterThanOrEqualTo, 2)
+		So(metrics.Get(serverLatencyMetric+"Test.Sleep") != nil, ShouldBeTrue)
+	})
+}
+
+// traceServerCodec reads requests carrying the trace context of the caller.
+type traceServerCodec struct {
+	rpc.ServerCodec
+}
+
+func (c *traceServerCodec) ReadRequestBody(body interface{}) error {
+	e := body.(proto.EnvelopeAPI)
+	e.SetTraceID("0123456789abcdef0123456789abcdef")
+	e.SetSpanID("0123456789abcdef")
+	return nil
+}
+
+func TestTraceTrust(t *testing.T) {
+	Convey("remote trace sampling is honored for trusted callers only", t, func() {
+		trace.Stop()
+		nodeID := &proto.RawNodeID{Hash: hash.Hash{0x1}}
+		defer remoteNodeCache.Delete(*nodeID)
+		So(isTraceTrusted(nil), ShouldBeFalse)
+		So(isTraceTrusted(nodeID), ShouldBeFalse)
+
+		remoteNodeCache.Store(*nodeID, &cachedNode{role: proto.Client, expire: time.Now().Add(nodeCacheTTL)})
+		So(isTraceTrusted(nodeID), ShouldBeFalse)
+		codec := NewNodeAwareServerCodec(context.Background(), &traceServerCodec{}, nodeID)
+		codec.trustTrace = isTraceTrusted(nodeID)
+		req := &SleepReq{}
+		So(codec.ReadRequestBody(req), ShouldBeNil)
+		sc := trace.SpanContextFromContext(req.GetContext())
+		So(sc.IsValid(), ShouldBeTrue)
+		So(sc.TraceID.String(), ShouldEqual, "0123456789abcdef0123456789abcdef")
+		// not sampled without a local tracer, the ids are kept for the callees
+		ctx, span := trace.StartSpan(req.GetContext(), "call")
+		So(span, ShouldBeNil)
+		So(trace.SpanContextFromContext(ctx).TraceID, ShouldEqual, sc.TraceID)
+
+		remoteNodeCache.Store(*nodeID, &cachedNode{role: proto.Miner, expire: time.Now().Add(nodeCacheTTL)})
+		So(isTraceTrusted(nodeID), ShouldBeTrue)
+		codec.trustTrace = isTraceTrusted(nodeID)
+		req = &SleepReq{}
+		So(codec.ReadRequestBody(req), ShouldBeNil)
+		sc = trace.SpanContextFromContext(req.GetContext())
+		So(sc.IsValid(), ShouldBeTrue)
+		So(sc.TraceID.String(), ShouldEqual, "0123456789abcdef0123456789abcdef")
+		_, span = trace.StartSpan(req.GetContext(), "call")
+		So(span, ShouldNotBeNil)
+		So(span.Context().TraceID, ShouldEqual, sc.TraceID)
+	})
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import "errors"
+
+var (
+	// ErrNodeIDNonceInvalid indicates the NodeID doesn't match the public key and nonce of the peer.
+	ErrNodeIDNonceInvalid = errors.New("node id nonce invalid")
+	// ErrNodeIDDifficultyTooLow indicates the NodeID difficulty is below the one required by the peer role.
+	ErrNodeIDDifficultyTooLow = errors.New("node id difficulty too low")
+	// ErrHandshakeRateLimited indicates the source IP failed too many handshakes recently.
+	ErrHandshakeRateLimited = errors.New("too many failed handshakes")
+	// ErrCodecNotSupported indicates the peer doesn't support the requested RPC codec,
+	// the request was not served and can be retried with msgpack.
+	ErrCodecNotSupported = errors.New("rpc codec not supported by peer")
+	// ErrThrottled indicates the call was rejected by the server limits without being
+	// served, it can be retried later.
+	ErrThrottled = errors.New("rpc call throttled by server")
+	// ErrTooManySessions indicates the remote node has too many sessions to the server.
+	ErrTooManySessions = errors.New("too many sessions")
+	// ErrNoKeyRotationSource indicates no block producer is available to fetch key rotation records from.
+	ErrNoKeyRotationSource = errors.New("no block producer to fetch key rotation from")
+	// ErrKeyRotationLookupThrottled indicates the key rotation lookup of the node failed recently.
+	ErrKeyRotationLookupThrottled = errors.New("key rotation lookup throttled")
+	// ErrNoRoutingTable indicates the local kademlia routing table is not initialized.
+	ErrNoRoutingTable = errors.New("routing table not initialized")
+)
@@ -0,0 +1,190 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+)
+
+var (
+	// MaxHandshakeFailures is the number of failed handshakes allowed from a source IP
+	// within HandshakeFailureWindow, the IP is then banned for HandshakeBanDuration.
+	MaxHandshakeFailures = 10
+	// HandshakeFailureWindow is the period failed handshakes are counted in.
+	HandshakeFailureWindow = time.Minute
+	// HandshakeBanDuration is the period handshakes from a banned IP are refused.
+	HandshakeBanDuration = 5 * time.Minute
+
+	failedHandshakes = newHandshakeLimiter()
+
+	// KeyRotationRetryInterval is the period a NodeID is not looked up again after
+	// its key rotation lookup failed.
+	KeyRotationRetryInterval = time.Minute
+
+	failedKeyRotations = newKeyRotationLookups()
+)
+
+// maxHandshakeLimiterEntries triggers the pruning of expired entries.
+const maxHandshakeLimiterEntries = 4096
+
+// handshakeFailures records the failed handshakes of a source IP.
+type handshakeFailures struct {
+	count       int
+	since       time.Time
+	bannedUntil time.Time
+}
+
+// handshakeLimiter bans the source IPs failing too many handshakes.
+type handshakeLimiter struct {
+	sync.Mutex
+	failures map[string]*handshakeFailures
+}
+
+func newHandshakeLimiter() *handshakeLimiter {
+	return &handshakeLimiter{failures: make(map[string]*handshakeFailures)}
+}
+
+// allow returns if handshakes from 'ip' are accepted.
+func (l *handshakeLimiter) allow(ip string, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+	f, ok := l.failures[ip]
+	return !ok || !now.Before(f.bannedUntil)
+}
+
+// fail records a failed handshake from 'ip'.
+func (l *handshakeLimiter) fail(ip string, now time.Time) {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.failures) >= maxHandshakeLimiterEntries {
+		l.prune(now)
+	}
+	f, ok := l.failures[ip]
+	if !ok {
+		f = &handshakeFailures{since: now}
+		l.failures[ip] = f
+	} else if now.Sub(f.since) > HandshakeFailureWindow {
+		f.count, f.since = 0, now
+	}
+	f.count++
+	if f.count >= MaxHandshakeFailures {
+		f.bannedUntil = now.Add(HandshakeBanDuration)
+		f.count = 0
+		f.since = now
+	}
+}
+
+// prune removes the entries neither counting failures nor banned.
+func (l *handshakeLimiter) prune(now time.Time) {
+	for ip, f := range l.failures {
+		if now.Sub(f.since) > HandshakeFailureWindow && !now.Before(f.bannedUntil) {
+			delete(l.failures, ip)
+		}
+	}
+}
+
+// keyRotationLookups caches the failed key rotation lookups, so peers presenting
+// unknown keys don't trigger a BP lookup on each connection.
+type keyRotationLookups struct {
+	sync.Mutex
+	failed map[proto.RawNodeID]time.Time
+}
+
+func newKeyRotationLookups() *keyRotationLookups {
+	return &keyRotationLookups{failed: make(map[proto.RawNodeID]time.Time)}
+}
+
+// allow returns if the key rotation of 'id' could be looked up.
+func (l *keyRotationLookups) allow(id *proto.RawNodeID, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+	failed, ok := l.failed[*id]
+	return !ok || now.Sub(failed) > KeyRotationRetryInterval
+}
+
+// fail records a failed key rotation lookup of 'id'.
+func (l *keyRotationLookups) fail(id *proto.RawNodeID, now time.Time) {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.failed) >= maxHandshakeLimiterEntries {
+		for k, failed := range l.failed {
+			if now.Sub(failed) > KeyRotationRetryInterval {
+				delete(l.failed, k)
+			}
+		}
+	}
+	l.failed[*id] = now
+}
+
+// remoteIP returns the IP part of the connection remote address.
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr()
+	if addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return addr.String()
+}
+
+// minNodeIDDifficulty returns the NodeID difficulty required from a node.
+func minNodeIDDifficulty(nodeID *proto.RawNodeID, role proto.ServerRole) (difficulty int) {
+	if conf.GConf == nil {
+		return
+	}
+	difficulty = conf.GConf.MinNodeIDDifficulty
+	var roleDifficulty int
+	if route.IsBPNodeID(nodeID) {
+		roleDifficulty = conf.GConf.BPNodeIDDifficulty
+	} else if role == proto.Miner {
+		roleDifficulty = conf.GConf.MinerNodeIDDifficulty
+	}
+	if roleDifficulty > difficulty {
+		difficulty = roleDifficulty
+	}
+	return
+}
+
+// verifyNodeID checks the NodeID is the proof of work of the public key and nonce, or the
+// public key is accepted by a key rotation record, and its difficulty is enough for the node role.
+func verifyNodeID(nodeID *proto.RawNodeID, nonce *cpuminer.Uint256,
+	publicKey *asymmetric.PublicKey, role proto.ServerRole) error {
+	if !kms.IsNodeKeyValid(nodeID, nonce, publicKey) {
+		// the key may be rotated, try the latest rotation record from BP
+		if err := SyncKeyRotation(nodeID); err != nil {
+			return ErrNodeIDNonceInvalid
+		}
+		if !kms.IsNodeKeyValid(nodeID, nonce, publicKey) {
+			failedKeyRotations.fail(nodeID, time.Now())
+			return ErrNodeIDNonceInvalid
+		}
+	}
+	if nodeID.Hash.Difficulty() < minNodeIDDifficulty(nodeID, role) {
+		return ErrNodeIDDifficultyTooLow
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHandshakeLimiter(t *testing.T) {
+	Convey("failed handshakes ban the source ip", t, func() {
+		l := newHandshakeLimiter()
+		now := time.Now()
+		for i := 0; i < MaxHandshakeFailures-1; i++ {
+			l.fail("1.1.1.1", now)
+		}
+		So(l.allow("1.1.1.1", now), ShouldBeTrue)
+
+		// failures out of the window are not counted
+		later := now.Add(HandshakeFailureWindow + time.Second)
+		l.fail("1.1.1.1", later)
+		So(l.allow("1.1.1.1", later), ShouldBeTrue)
+
+		for i := 0; i < MaxHandshakeFailures-1; i++ {
+			l.fail("1.1.1.1", later)
+		}
+		So(l.allow("1.1.1.1", later), ShouldBeFalse)
+		So(l.allow("2.2.2.2", later), ShouldBeTrue)
+		So(l.allow("1.1.1.1", later.Add(HandshakeBanDuration)), ShouldBeTrue)
+
+		l.prune(later.Add(HandshakeBanDuration))
+		So(l.failures, ShouldBeEmpty)
+	})
+}
+
+func TestVerifyNodeID(t *testing.T) {
+	Convey("node id nonce and difficulty are verified", t, func() {
+		defer func(c *conf.Config) { conf.GConf = c }(conf.GConf)
+		conf.GConf = &conf.Config{MinNodeIDDifficulty: 2, MinerNodeIDDifficulty: 256}
+
+		_, publicKey, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		_, otherKey, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		nonce := asymmetric.GetPubKeyNonce(publicKey, 4, 100*time.Millisecond, nil)
+		nodeID := &proto.RawNodeID{Hash: nonce.Hash}
+
+		So(verifyNodeID(nodeID, &nonce.Nonce, publicKey, proto.Client), ShouldBeNil)
+		So(verifyNodeID(nodeID, &nonce.Nonce, otherKey, proto.Client), ShouldEqual, ErrNodeIDNonceInvalid)
+		So(verifyNodeID(nodeID, &nonce.Nonce, publicKey, proto.Miner), ShouldEqual, ErrNodeIDDifficultyTooLow)
+
+		conf.GConf.MinNodeIDDifficulty = 256
+		So(verifyNodeID(nodeID, &nonce.Nonce, publicKey, proto.Client), ShouldEqual, ErrNodeIDDifficultyTooLow)
+	})
+}
+
+func TestGetVerifiedRemoteNode(t *testing.T) {
+	Convey("verified remote node is served from cache", t, func() {
+		_, publicKey, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		nonce := asymmetric.GetPubKeyNonce(publicKey, 4, 100*time.Millisecond, nil)
+		nodeID := &proto.RawNodeID{Hash: nonce.Hash}
+		defer remoteNodeCache.Delete(*nodeID)
+
+		remoteNodeCache.Store(*nodeID, &cachedNode{
+			publicKey: publicKey,
+			role:      proto.Miner,
+			expire:    time.Now().Add(nodeCacheTTL),
+		})
+		// lookup by value, not by the pointer stored
+		pub, role, err := getVerifiedRemoteNode(&proto.RawNodeID{Hash: nonce.Hash}, &nonce.Nonce)
+		So(err, ShouldBeNil)
+		So(pub.IsEqual(publicKey), ShouldBeTrue)
+		So(role, ShouldEqual, proto.Miner)
+	})
+}
+
+func TestKeyRotationLookups(t *testing.T) {
+	Convey("failed key rotation lookups are not retried within the interval", t, func() {
+		l := newKeyRotationLookups()
+		now := time.Now()
+		id := &proto.RawNodeID{}
+		So(l.allow(id, now), ShouldBeTrue)
+		l.fail(id, now)
+		So(l.allow(id, now.Add(KeyRotationRetryInterval/2)), ShouldBeFalse)
+		So(l.allow(&proto.RawNodeID{Hash: hash.Hash{0x1}}, now), ShouldBeTrue)
+		So(l.allow(id, now.Add(KeyRotationRetryInterval+time.Second)), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,319 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/rpc"
+	"reflect"
+	"sync"
+	"time"
+
+	hsp "github.com/CovenantSQL/HashStablePack/marshalhash"
+	"github.com/pkg/errors"
+
+	"github.com/CovenantSQL/CovenantSQL/utils"
+)
+
+// RPC codecs, selected by the client at the start of each stream.
+//
+// A stream starting with the codecPreamble byte, which msgpack never uses, is followed
+// by the codec id and acknowledged by the server with the same 2 bytes. Any other stream
+// is a legacy msgpack stream. Old servers fail to decode the preamble and close the
+// stream before serving any request, so clients can safely retry with msgpack.
+const (
+	// CodecMsgPack is the reflection based msgpack codec.
+	CodecMsgPack byte = iota
+	// CodecHSP frames messages with hsp, request and response types implementing
+	// hsp.Marshaler and hsp.Unmarshaler skip the reflection based encoding.
+	CodecHSP
+)
+
+const (
+	codecPreamble byte = 0xc1
+	// maxFrameSize limits the size of a single hsp codec message.
+	maxFrameSize = 256 << 20
+	// msgpackPeerTTL is the time before a peer found not supporting the hsp codec
+	// is tried again.
+	msgpackPeerTTL = 10 * time.Minute
+)
+
+var (
+	// DefaultCodec is the codec proposed by clients for new streams.
+	DefaultCodec = CodecHSP
+
+	// msgpackPeers maps the remote address of peers not supporting the hsp codec to
+	// the expiry time of the record.
+	msgpackPeers sync.Map
+)
+
+// clientCodecFor returns the codec to use with the peer at 'addr'.
+func clientCodecFor(addr string) byte {
+	if expire, ok := msgpackPeers.Load(addr); ok {
+		if time.Now().Before(expire.(time.Time)) {
+			return CodecMsgPack
+		}
+		msgpackPeers.Delete(addr)
+	}
+	return DefaultCodec
+}
+
+// newClientCodec returns the client codec 'codec' for the stream.
+func newClientCodec(conn net.Conn, codec byte) rpc.ClientCodec {
+	if codec == CodecHSP {
+		return &hspClientCodec{
+			hspCodec: newHSPCodec(conn),
+			addr:     conn.RemoteAddr().String(),
+		}
+	}
+	return utils.GetMsgPackClientCodec(conn)
+}
+
+// prefixConn replays the bytes consumed by the codec detection.
+type prefixConn struct {
+	net.Conn
+	prefix []byte
+}
+
+func (c *prefixConn) Read(b []byte) (n int, err error) {
+	if len(c.prefix) > 0 {
+		n = copy(b, c.prefix)
+		c.prefix = c.prefix[n:]
+		return
+	}
+	return c.Conn.Read(b)
+}
+
+// newServerCodec detects the codec selected by the client of the stream.
+func newServerCodec(conn net.Conn) (codec rpc.ServerCodec, err error) {
+	head := make([]byte, 2)
+	if _, err = io.ReadFull(conn, head[:1]); err != nil {
+		return
+	}
+	if head[0] != codecPreamble {
+		return utils.GetMsgPackServerCodec(&prefixConn{Conn: conn, prefix: head[:1]}), nil
+	}
+	if _, err = io.ReadFull(conn, head[1:]); err != nil {
+		return
+	}
+	if head[1] != CodecHSP {
+		err = errors.Wrapf(ErrCodecNotSupported, "codec %d", head[1])
+		return
+	}
+	if _, err = conn.Write(head); err != nil {
+		return
+	}
+	return &hspServerCodec{hspCodec: newHSPCodec(conn)}, nil
+}
+
+// hspCodec implements the framing shared by the hsp client and server codecs: each message
+// is a 4 bytes length followed by the hsp encoded header fields and body.
+type hspCodec struct {
+	conn io.ReadWriteCloser
+	r    *bufio.Reader
+	// body is the body of the last message read.
+	body     []byte
+	fastBody bool
+}
+
+func newHSPCodec(conn io.ReadWriteCloser) *hspCodec {
+	return &hspCodec{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// readFrame reads the next message.
+func (c *hspCodec) readFrame() (frame []byte, err error) {
+	var header [4]byte
+	if _, err = io.ReadFull(c.r, header[:]); err != nil {
+		return
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		err = errors.Errorf("rpc message too large: %d", size)
+		return
+	}
+	frame = make([]byte, size)
+	_, err = io.ReadFull(c.r, frame)
+	return
+}
+
+// readBody keeps the body of the message for the ReadXXXBody call.
+func (c *hspCodec) readBody(frame []byte) (err error) {
+	if c.fastBody, frame, err = hsp.ReadBoolBytes(frame); err != nil {
+		return
+	}
+	c.body, _, err = hsp.ReadBytesZC(frame)
+	return
+}
+
+// decodeBody decodes the body kept by readBody.
+func (c *hspCodec) decodeBody(body interface{}) (err error) {
+	data := c.body
+	c.body = nil
+	if body == nil {
+		return
+	}
+	if c.fastBody {
+		u, ok := hspUnmarshaler(body)
+		if !ok {
+			return errors.Errorf("%T does not support the hsp codec", body)
+		}
+		_, err = u.UnmarshalMsg(data)
+		return
+	}
+	return utils.DecodeMsgPack(data, body)
+}
+
+// hspUnmarshaler returns the hsp.Unmarshaler of body, a pointer to a nil pointer of an
+// unmarshaler type is allocated as msgpack does.
+func hspUnmarshaler(body interface{}) (u hsp.Unmarshaler, ok bool) {
+	if u, ok = body.(hsp.Unmarshaler); ok {
+		return
+	}
+	v := reflect.ValueOf(body)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Ptr {
+		return
+	}
+	if v = v.Elem(); v.IsNil() {
+		if !v.CanSet() {
+			return
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+	}
+	u, ok = v.Interface().(hsp.Unmarshaler)
+	return
+}
+
+// writeFrame writes the message with header 'fields' and 'body'.
+func (c *hspCodec) writeFrame(prefix []byte, fields func([]byte) []byte, body interface{}) (err error) {
+	frame := append(prefix, 0, 0, 0, 0)
+	start := len(frame)
+	frame = fields(frame)
+	if m, ok := body.(hsp.Marshaler); ok {
+		frame = hsp.AppendBool(frame, true)
+		var data []byte
+		if data, err = m.MarshalMsg(nil); err != nil {
+			return
+		}
+		frame = hsp.AppendBytes(frame, data)
+	} else {
+		frame = hsp.AppendBool(frame, false)
+		var buf *bytes.Buffer
+		if buf, err = utils.EncodeMsgPack(body); err != nil {
+			return
+		}
+		frame = hsp.AppendBytes(frame, buf.Bytes())
+	}
+	binary.BigEndian.PutUint32(frame[start-4:], uint32(len(frame)-start))
+	_, err = c.conn.Write(frame)
+	return
+}
+
+func (c *hspCodec) Close() error {
+	return c.conn.Close()
+}
+
+// hspClientCodec implements rpc.ClientCodec.
+type hspClientCodec struct {
+	*hspCodec
+	addr  string
+	hello bool
+	acked bool
+}
+
+func (c *hspClientCodec) WriteRequest(r *rpc.Request, body interface{}) error {
+	var prefix []byte
+	if !c.hello {
+		// net/rpc serializes the requests
+		prefix = []byte{codecPreamble, CodecHSP}
+		c.hello = true
+	}
+	return c.writeFrame(prefix, func(b []byte) []byte {
+		b = hsp.AppendString(b, r.ServiceMethod)
+		return hsp.AppendUint64(b, r.Seq)
+	}, body)
+}
+
+func (c *hspClientCodec) ReadResponseHeader(r *rpc.Response) (err error) {
+	if !c.acked {
+		ack := make([]byte, 2)
+		if _, err = io.ReadFull(c.r, ack); err != nil && err != io.EOF {
+			// the request may have been served, don't take it as an old peer
+			return
+		}
+		if err == io.EOF || ack[0] != codecPreamble || ack[1] != CodecHSP {
+			// the server closed the stream or answered without the ack, it doesn't support
+			// the codec, fallback to msgpack for a while
+			msgpackPeers.Store(c.addr, time.Now().Add(msgpackPeerTTL))
+			return ErrCodecNotSupported
+		}
+		c.acked = true
+	}
+	frame, err := c.readFrame()
+	if err != nil {
+		return
+	}
+	if r.ServiceMethod, frame, err = hsp.ReadStringBytes(frame); err != nil {
+		return
+	}
+	if r.Seq, frame, err = hsp.ReadUint64Bytes(frame); err != nil {
+		return
+	}
+	if r.Error, frame, err = hsp.ReadStringBytes(frame); err != nil {
+		return
+	}
+	return c.readBody(frame)
+}
+
+func (c *hspClientCodec) ReadResponseBody(body interface{}) error {
+	return c.decodeBody(body)
+}
+
+// hspServerCodec implements rpc.ServerCodec.
+type hspServerCodec struct {
+	*hspCodec
+}
+
+func (c *hspServerCodec) ReadRequestHeader(r *rpc.Request) (err error) {
+	frame, err := c.readFrame()
+	if err != nil {
+		return
+	}
+	if r.ServiceMethod, frame, err = hsp.ReadStringBytes(frame); err != nil {
+		return
+	}
+	if r.Seq, frame, err = hsp.ReadUint64Bytes(frame); err != nil {
+		return
+	}
+	return c.readBody(frame)
+}
+
+func (c *hspServerCodec) ReadRequestBody(body interface{}) error {
+	return c.decodeBody(body)
+}
+
+func (c *hspServerCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	// net/rpc serializes the responses
+	return c.writeFrame(nil, func(b []byte) []byte {
+		b = hsp.AppendString(b, r.ServiceMethod)
+		b = hsp.AppendUint64(b, r.Seq)
+		return hsp.AppendString(b, r.Error)
+	}, body)
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"net"
+	"net/rpc"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	mux "github.com/xtaci/smux"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+)
+
+type CodecService struct{}
+
+func (s *CodecService) Query(req *types.Request, res *types.Response) error {
+	res.Header.Request = req.Header
+	res.Header.RowCount = uint64(len(req.Payload.Queries))
+	for _, q := range req.Payload.Queries {
+		res.Payload.Rows = append(res.Payload.Rows, types.ResponseRow{Values: []interface{}{q.Pattern}})
+	}
+	return nil
+}
+
+// serveLegacy serves the streams of 'l' with the msgpack codec only, as older servers do.
+func serveLegacy(l net.Listener, service interface{}) {
+	server := rpc.NewServer()
+	server.RegisterName("Test", service)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			sess, err := mux.Server(conn, YamuxConfig)
+			if err != nil {
+				return
+			}
+			for {
+				stream, err := sess.AcceptStream()
+				if err != nil {
+					return
+				}
+				go server.ServeCodec(utils.GetMsgPackServerCodec(stream))
+			}
+		}()
+	}
+}
+
+func TestHSPCodec(t *testing.T) {
+	Convey("call with both codecs", t, func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		server, err := NewServerWithService(ServiceMap{"Test": NewTestService(), "Codec": &CodecService{}})
+		So(err, ShouldBeNil)
+		server.SetListener(l)
+		go server.Serve()
+		defer server.Stop()
+
+		defer func(codec byte) { DefaultCodec = codec }(DefaultCodec)
+		for i, codec := range []byte{CodecHSP, CodecMsgPack} {
+			DefaultCodec = codec
+			client, err := initClient(l.Addr().String())
+			So(err, ShouldBeNil)
+
+			// reflection encoded types
+			rep := new(TestRep)
+			So(client.Call("Test.IncCounter", &TestReq{Step: 10}, rep), ShouldBeNil)
+			So(rep.Ret, ShouldEqual, 10*(i+1))
+
+			// hsp encoded types
+			req := &types.Request{}
+			req.Header.SeqNo = 100
+			req.Payload.Queries = []types.Query{{Pattern: "SELECT 1"}, {Pattern: "SELECT 2"}}
+			res := &types.Response{}
+			So(client.Call("Codec.Query", req, res), ShouldBeNil)
+			So(res.Header.Request.SeqNo, ShouldEqual, 100)
+			So(res.Header.RowCount, ShouldEqual, 2)
+			So(res.Payload.Rows[1].Values[0], ShouldEqual, "SELECT 2")
+
+			// reply of pointer to nil pointer
+			var resPtr *types.Response
+			So(client.Call("Codec.Query", req, &resPtr), ShouldBeNil)
+			So(resPtr, ShouldNotBeNil)
+			So(resPtr.Header.RowCount, ShouldEqual, 2)
+			client.Close()
+		}
+	})
+
+	Convey("fallback to msgpack with legacy servers", t, func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer l.Close()
+		go serveLegacy(l, NewTestService())
+
+		addr := l.Addr().String()
+		So(clientCodecFor(addr), ShouldEqual, DefaultCodec)
+		client, err := initClient(addr)
+		So(err, ShouldBeNil)
+		rep := new(TestRep)
+		err = client.Call("Test.IncCounter", &TestReq{Step: 10}, rep)
+		So(err, ShouldEqual, ErrCodecNotSupported)
+		So(clientCodecFor(addr), ShouldEqual, CodecMsgPack)
+		client.Close()
+
+		client, err = initClient(addr)
+		So(err, ShouldBeNil)
+		So(client.Call("Test.IncCounter", &TestReq{Step: 10}, rep), ShouldBeNil)
+		So(rep.Ret, ShouldEqual, 10)
+		client.Close()
+		msgpackPeers.Delete(addr)
+	})
+
+	Convey("keep the codec on broken streams", t, func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer l.Close()
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			sess, err := mux.Server(conn, YamuxConfig)
+			if err != nil {
+				return
+			}
+			stream, err := sess.AcceptStream()
+			if err != nil {
+				return
+			}
+			// half of the ack, then the stream breaks
+			stream.Write([]byte{codecPreamble})
+			stream.Close()
+		}()
+
+		addr := l.Addr().String()
+		client, err := initClient(addr)
+		So(err, ShouldBeNil)
+		rep := new(TestRep)
+		err = client.Call("Test.IncCounter", &TestReq{Step: 10}, rep)
+		So(err, ShouldNotBeNil)
+		So(err, ShouldNotEqual, ErrCodecNotSupported)
+		So(clientCodecFor(addr), ShouldEqual, DefaultCodec)
+		client.Close()
+	})
+}
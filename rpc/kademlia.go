@@ -0,0 +1,273 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+const (
+	// DefaultRoutingRefreshInterval defines the default interval to refresh the routing table.
+	DefaultRoutingRefreshInterval = 10 * time.Minute
+)
+
+// LocalNodeRecord returns the node record of the local node signed by the local key.
+func LocalNodeRecord() (record *proto.NodeRecord, err error) {
+	var (
+		nodeID proto.NodeID
+		node   *proto.Node
+	)
+	if nodeID, err = kms.GetLocalNodeID(); err != nil {
+		return
+	}
+	if node, err = kms.GetNodeInfo(nodeID); err != nil {
+		return
+	}
+	return signNodeRecord(node)
+}
+
+// signNodeRecord signs the node record of the local node with DefaultNodeRecordTTL, the
+// current time in nanoseconds is used as the sequence number which increases across restarts.
+func signNodeRecord(node *proto.Node) (record *proto.NodeRecord, err error) {
+	var signer asymmetric.Signer
+	if signer, err = kms.GetLocalSigner(); err != nil {
+		return
+	}
+	now := time.Now().UTC()
+	record = &proto.NodeRecord{
+		NodeRecordHeader: proto.NodeRecordHeader{
+			Node:      *node,
+			Seq:       uint64(now.UnixNano()),
+			Timestamp: now,
+			TTL:       proto.DefaultNodeRecordTTL,
+		},
+	}
+	err = record.Sign(signer)
+	return
+}
+
+// findClosest asks the node for the closest node records to target, the local node record is
+// attached to let the node learn about the local node.
+func findClosest(
+	node proto.NodeID, target proto.NodeID, self *proto.NodeRecord,
+) (records []proto.NodeRecord, err error) {
+	req := &proto.FindClosestReq{
+		Target: target,
+		Count:  route.KBucketSize,
+		Record: self,
+	}
+	resp := new(proto.FindClosestResp)
+	if err = NewCaller().CallNode(node, route.KademliaFindClosest.String(), req, resp); err != nil {
+		return
+	}
+	records = resp.Records
+	return
+}
+
+// learnNodeRecord verifies the node record and stores it to the routing table, the address
+// cache and the public keystore.
+func learnNodeRecord(table *route.RoutingTable, record *proto.NodeRecord) (err error) {
+	if err = route.VerifyNodeRecord(record); err != nil {
+		log.WithField("node", record.Node.ID).WithError(err).Debug("drop invalid node record")
+		return
+	}
+	// the record may not be stored if the bucket is full, the address is cached anyway for
+	// the following queries
+	table.Update(record)
+	route.SetNodeRecordAddrCache(record)
+	if errSet := kms.SetNode(&record.Node); errSet != nil {
+		log.WithField("node", record.Node.ID).WithError(errSet).Debug("set node to kms failed")
+	}
+	return
+}
+
+// iterativeFind does the kademlia iterative lookup, KademliaAlpha nodes are queried
+// concurrently each round until the KBucketSize closest nodes are all queried or the target
+// is found. Returns the closest node records found.
+func iterativeFind(table *route.RoutingTable, target proto.NodeID) (closest []proto.NodeRecord) {
+	targetID := target.ToRawNodeID()
+	if targetID == nil {
+		return
+	}
+
+	self, err := LocalNodeRecord()
+	if err != nil {
+		log.WithError(err).Debug("build local node record failed")
+		self = nil
+	}
+
+	closest = table.Closest(targetID, route.KBucketSize)
+	queried := make(map[proto.NodeID]bool)
+	seen := make(map[proto.NodeID]bool)
+	for _, r := range closest {
+		seen[r.Node.ID] = true
+	}
+	if self != nil {
+		seen[self.Node.ID] = true
+	}
+
+	for {
+		var batch []proto.NodeRecord
+		for _, r := range closest {
+			if r.Node.ID == target {
+				return
+			}
+			if !queried[r.Node.ID] {
+				batch = append(batch, r)
+				if len(batch) == route.KademliaAlpha {
+					break
+				}
+			}
+		}
+		if len(batch) == 0 {
+			return
+		}
+
+		var (
+			wg      sync.WaitGroup
+			lock    sync.Mutex
+			failed  = make(map[proto.NodeID]bool)
+			results []proto.NodeRecord
+		)
+		for _, r := range batch {
+			queried[r.Node.ID] = true
+			wg.Add(1)
+			go func(node proto.NodeID) {
+				defer wg.Done()
+				records, err := findClosest(node, target, self)
+				lock.Lock()
+				defer lock.Unlock()
+				if err != nil {
+					failed[node] = true
+					return
+				}
+				results = append(results, records...)
+			}(r.Node.ID)
+		}
+		wg.Wait()
+
+		// drop the failed nodes, merge the new records
+		merged := closest[:0]
+		for _, r := range closest {
+			if failed[r.Node.ID] {
+				table.Fail(r.Node.ID.ToRawNodeID())
+				continue
+			}
+			merged = append(merged, r)
+		}
+		for i := range results {
+			r := &results[i]
+			if seen[r.Node.ID] {
+				continue
+			}
+			seen[r.Node.ID] = true
+			if learnNodeRecord(table, r) == nil {
+				merged = append(merged, *r)
+			}
+		}
+		route.SortByDistance(targetID, merged)
+		if len(merged) > route.KBucketSize {
+			merged = merged[:route.KBucketSize]
+		}
+		closest = merged
+	}
+}
+
+// LookupNode finds the node record from the local routing table, an iterative lookup is
+// performed if the node is not in the local routing table.
+func LookupNode(id *proto.RawNodeID) (record *proto.NodeRecord, err error) {
+	table := route.GetRoutingTable()
+	if table == nil {
+		err = ErrNoRoutingTable
+		return
+	}
+	if r, ok := table.Get(id); ok {
+		return &r, nil
+	}
+
+	target := id.ToNodeID()
+	for _, r := range iterativeFind(table, target) {
+		if r.Node.ID == target {
+			record = &r
+			return
+		}
+	}
+
+	err = route.ErrUnknownNodeID
+	return
+}
+
+// BootstrapRouting fills the local routing table from the block producers and looks up the
+// local node to populate the nearby buckets. The block producers are used only as the
+// entrance of the kademlia network.
+func BootstrapRouting() (err error) {
+	table := route.GetRoutingTable()
+	if table == nil {
+		return ErrNoRoutingTable
+	}
+
+	var self *proto.NodeRecord
+	if self, err = LocalNodeRecord(); err != nil {
+		return
+	}
+
+	for _, bp := range route.GetBPs() {
+		if bp == self.Node.ID {
+			continue
+		}
+		records, err := findClosest(bp, self.Node.ID, self)
+		if err != nil {
+			log.WithField("bp", bp).WithError(err).Debug("bootstrap routing from BP failed")
+			continue
+		}
+		for i := range records {
+			learnNodeRecord(table, &records[i])
+		}
+	}
+
+	iterativeFind(table, self.Node.ID)
+
+	log.WithField("nodes", table.Len()).Debug("routing table bootstrapped")
+
+	return
+}
+
+// RunRoutingRefresh bootstraps the routing table and refreshes it every interval until stopCh
+// is closed.
+func RunRoutingRefresh(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := BootstrapRouting(); err != nil {
+			log.WithError(err).Warning("refresh routing table failed")
+		}
+
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
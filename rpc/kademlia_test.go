@@ -0,0 +1,63 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLookupNode(t *testing.T) {
+	Convey("test kademlia lookup without routing table", t, func() {
+		target := &proto.RawNodeID{}
+		target.Hash[0] = 0x01
+
+		if route.GetRoutingTable() == nil {
+			_, err := LookupNode(target)
+			So(err, ShouldEqual, ErrNoRoutingTable)
+			So(BootstrapRouting(), ShouldEqual, ErrNoRoutingTable)
+		}
+
+		Convey("the local routing table is preferred", func() {
+			route.InitRoutingTable(&proto.RawNodeID{})
+			defer route.InitRoutingTable(nil)
+			record := &proto.NodeRecord{
+				NodeRecordHeader: proto.NodeRecordHeader{
+					Node:      proto.Node{ID: target.ToNodeID(), Addr: "127.0.0.1:1"},
+					Seq:       1,
+					Timestamp: time.Now(),
+					TTL:       time.Hour,
+				},
+			}
+			So(route.GetRoutingTable().Update(record), ShouldBeTrue)
+
+			found, err := LookupNode(target)
+			So(err, ShouldBeNil)
+			So(found.Node.Addr, ShouldEqual, "127.0.0.1:1")
+
+			// nothing to query in an empty routing table
+			other := &proto.RawNodeID{}
+			other.Hash[0] = 0x02
+			_, err = LookupNode(other)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+)
+
+// DefaultLimits are the RPC server limits used unless overridden by the RPCLimits config.
+var DefaultLimits = conf.RPCLimits{
+	MaxSessionsPerNode:   64,
+	MaxStreamsPerSession: 4096,
+	MaxConcurrentCalls:   4096,
+	// consensus and chain replication must keep working while queries flood
+	PriorityMethods: []string{"Kayak.Call", "SQLC.*"},
+}
+
+// configuredLimits returns the server limits from the config, or the default ones.
+func configuredLimits() *conf.RPCLimits {
+	if conf.GConf != nil && conf.GConf.RPCLimits != nil {
+		limits := *conf.GConf.RPCLimits
+		if limits.PriorityMethods == nil {
+			limits.PriorityMethods = DefaultLimits.PriorityMethods
+		}
+		return &limits
+	}
+	limits := DefaultLimits
+	return &limits
+}
+
+// matchMethod returns true if 'method' matches 'pattern', a "Service.*" pattern
+// matches all methods of the service.
+func matchMethod(pattern, method string) bool {
+	if strings.HasSuffix(pattern, ".*") {
+		return strings.HasPrefix(method, pattern[:len(pattern)-1])
+	}
+	return pattern == method
+}
+
+// tokenBucket implements the rate limit of a method.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit conf.RateLimit, now time.Time) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: limit.Rate, burst: burst, tokens: burst, last: now}
+}
+
+// take consumes a token if available.
+func (b *tokenBucket) take(now time.Time) bool {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// serverLimiter enforces the RPC server limits on sessions and calls, streams are
+// counted by each session.
+type serverLimiter struct {
+	limits *conf.RPCLimits
+
+	sync.Mutex
+	sessions map[string]int
+	calls    int
+	buckets  map[string]*tokenBucket
+}
+
+func newServerLimiter(limits *conf.RPCLimits) *serverLimiter {
+	l := &serverLimiter{
+		limits:   limits,
+		sessions: make(map[string]int),
+		buckets:  make(map[string]*tokenBucket),
+	}
+	now := time.Now()
+	for method, limit := range limits.MethodRateLimits {
+		l.buckets[method] = newTokenBucket(limit, now)
+	}
+	return l
+}
+
+// acquireSession registers a session of the remote 'key', returns false if the remote
+// has too many sessions.
+func (l *serverLimiter) acquireSession(key string) bool {
+	l.Lock()
+	defer l.Unlock()
+	if max := l.limits.MaxSessionsPerNode; max > 0 && l.sessions[key] >= max {
+		return false
+	}
+	l.sessions[key]++
+	return true
+}
+
+func (l *serverLimiter) releaseSession(key string) {
+	l.Lock()
+	defer l.Unlock()
+	if l.sessions[key]--; l.sessions[key] <= 0 {
+		delete(l.sessions, key)
+	}
+}
+
+// maxStreams returns the stream limit of a session, 0 for unlimited.
+func (l *serverLimiter) maxStreams() int {
+	return l.limits.MaxStreamsPerSession
+}
+
+// isPriority returns true if 'method' is served regardless of the server load.
+func (l *serverLimiter) isPriority(method string) bool {
+	for _, pattern := range l.limits.PriorityMethods {
+		if matchMethod(pattern, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// acquireCall admits a call to 'method', the returned release func must be called once
+// the call is done. Returns ErrThrottled if the call must be rejected.
+func (l *serverLimiter) acquireCall(method string, now time.Time) (release func(), err error) {
+	priority := l.isPriority(method)
+
+	l.Lock()
+	defer l.Unlock()
+	if !priority && l.limits.MaxConcurrentCalls > 0 && l.calls >= l.limits.MaxConcurrentCalls {
+		err = ErrThrottled
+		return
+	}
+	if b, ok := l.buckets[method]; ok && !b.take(now) {
+		err = ErrThrottled
+		return
+	}
+	if priority {
+		release = func() {}
+		return
+	}
+	l.calls++
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			l.Lock()
+			defer l.Unlock()
+			l.calls--
+		})
+	}
+	return
+}
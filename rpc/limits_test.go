@@ -0,0 +1,167 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	mux "github.com/xtaci/smux"
+)
+
+func TestServerLimiter(t *testing.T) {
+	Convey("limiter should enforce limits", t, func() {
+		now := time.Now()
+		l := newServerLimiter(&conf.RPCLimits{
+			MaxSessionsPerNode: 2,
+			MaxConcurrentCalls: 2,
+			PriorityMethods:    []string{"Kayak.Call", "SQLC.*"},
+			MethodRateLimits: map[string]conf.RateLimit{
+				"DBS.Query": {Rate: 10, Burst: 2},
+			},
+		})
+
+		So(l.acquireSession("a"), ShouldBeTrue)
+		So(l.acquireSession("a"), ShouldBeTrue)
+		So(l.acquireSession("a"), ShouldBeFalse)
+		So(l.acquireSession("b"), ShouldBeTrue)
+		l.releaseSession("a")
+		So(l.acquireSession("a"), ShouldBeTrue)
+
+		So(l.isPriority("Kayak.Call"), ShouldBeTrue)
+		So(l.isPriority("Kayak.Other"), ShouldBeFalse)
+		So(l.isPriority("SQLC.FetchBlock"), ShouldBeTrue)
+		So(l.isPriority("SQLCX.FetchBlock"), ShouldBeFalse)
+
+		// rate limit
+		r1, err := l.acquireCall("DBS.Query", now)
+		So(err, ShouldBeNil)
+		r1()
+		r1()
+		r2, err := l.acquireCall("DBS.Query", now)
+		So(err, ShouldBeNil)
+		r2()
+		_, err = l.acquireCall("DBS.Query", now)
+		So(err, ShouldEqual, ErrThrottled)
+		r3, err := l.acquireCall("DBS.Query", now.Add(200*time.Millisecond))
+		So(err, ShouldBeNil)
+		r3()
+
+		// concurrency limit, priority calls are not limited
+		r1, err = l.acquireCall("DBS.Ack", now)
+		So(err, ShouldBeNil)
+		r2, err = l.acquireCall("DBS.Ack", now)
+		So(err, ShouldBeNil)
+		_, err = l.acquireCall("DBS.Ack", now)
+		So(err, ShouldEqual, ErrThrottled)
+		for i := 0; i < 10; i++ {
+			_, err = l.acquireCall("Kayak.Call", now)
+			So(err, ShouldBeNil)
+		}
+		r1()
+		r3, err = l.acquireCall("DBS.Ack", now)
+		So(err, ShouldBeNil)
+		r2()
+		r3()
+		So(l.calls, ShouldEqual, 0)
+	})
+}
+
+func TestServerThrottle(t *testing.T) {
+	Convey("server should throttle calls", t, func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		service := &SleepService{deadlines: make(chan time.Duration, 100)}
+		server, err := NewServerWithService(ServiceMap{"Test": service, "Prio": service, "Counter": NewTestService()})
+		So(err, ShouldBeNil)
+		server.SetLimits(&conf.RPCLimits{
+			MaxStreamsPerSession: 3,
+			MaxConcurrentCalls:   1,
+			PriorityMethods:      []string{"Prio.*"},
+			MethodRateLimits: map[string]conf.RateLimit{
+				"Counter.IncCounter": {Rate: 0.001, Burst: 1},
+			},
+		})
+		server.SetListener(l)
+		go server.Serve()
+		defer server.Stop()
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		So(err, ShouldBeNil)
+		sess, err := mux.Client(conn, YamuxConfig)
+		So(err, ShouldBeNil)
+		defer sess.Close()
+		newClient := func() *Client {
+			stream, err := sess.OpenStream()
+			So(err, ShouldBeNil)
+			client, err := InitClientConn(stream)
+			So(err, ShouldBeNil)
+			return client
+		}
+		slow, fast, counter := newClient(), newClient(), newClient()
+
+		// the slow call holds the only call slot
+		slowCall := slow.Go("Test.Sleep", &SleepReq{Duration: 500 * time.Millisecond}, new(int), nil)
+		<-service.deadlines
+		rep := new(int)
+		So(fast.Call("Test.Sleep", &SleepReq{}, rep), ShouldEqual, ErrThrottled)
+		So(fast.Call("Prio.Sleep", &SleepReq{}, rep), ShouldBeNil)
+		<-service.deadlines
+		<-slowCall.Done
+		So(slowCall.Error, ShouldBeNil)
+		So(fast.Call("Test.Sleep", &SleepReq{}, rep), ShouldBeNil)
+		<-service.deadlines
+
+		// rate limit
+		So(counter.Call("Counter.IncCounter", &TestReq{Step: 1}, new(TestRep)), ShouldBeNil)
+		So(counter.Call("Counter.IncCounter", &TestReq{Step: 1}, new(TestRep)), ShouldEqual, ErrThrottled)
+
+		// stream limit
+		rejected := newClient()
+		So(rejected.Call("Prio.Sleep", &SleepReq{}, rep), ShouldEqual, ErrThrottled)
+		rejected.Close()
+		fast.Close()
+		time.Sleep(100 * time.Millisecond)
+		accepted := newClient()
+		So(accepted.Call("Prio.Sleep", &SleepReq{}, rep), ShouldBeNil)
+		<-service.deadlines
+	})
+}
+
+func TestSessionSlot(t *testing.T) {
+	Convey("session slot should move from the address to the node", t, func() {
+		l := newServerLimiter(&conf.RPCLimits{MaxSessionsPerNode: 1})
+		So(l.acquireSession("127.0.0.1"), ShouldBeTrue)
+		slot := &sessionSlot{limiter: l, key: "127.0.0.1"}
+		So(slot.move("node"), ShouldBeTrue)
+		So(slot.String(), ShouldEqual, "node")
+		// the address slot is free again
+		So(l.acquireSession("127.0.0.1"), ShouldBeTrue)
+
+		other := &sessionSlot{limiter: l, key: "127.0.0.1"}
+		So(other.move("node"), ShouldBeFalse)
+		So(other.String(), ShouldEqual, "127.0.0.1")
+		other.release()
+		slot.release()
+		So(l.acquireSession("node"), ShouldBeTrue)
+		So(l.acquireSession("127.0.0.1"), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// Metric names of RPC calls, suffixed by the method name.
+const (
+	clientLatencyMetric = "rpc-client-latency-"
+	clientErrorMetric   = "rpc-client-error-"
+	serverLatencyMetric = "rpc-server-latency-"
+	serverErrorMetric   = "rpc-server-error-"
+	// serverThrottledMetric counts the calls rejected by the server limits.
+	serverThrottledMetric = "rpc-server-throttled-"
+)
+
+// recordCall records the latency and failure of a call to 'method' in the default
+// metrics registry, the latency timer keeps the histogram of the call durations.
+func recordCall(latencyPrefix, errorPrefix, method string, start time.Time, failed bool) {
+	metrics.GetOrRegisterTimer(latencyPrefix+method, nil).UpdateSince(start)
+	if failed {
+		metrics.GetOrRegisterMeter(errorPrefix+method, nil).Mark(1)
+	}
+}
+
+func recordClientCall(method string, start time.Time, err error) {
+	recordCall(clientLatencyMetric, clientErrorMetric, method, start, err != nil)
+}
+
+func recordServerCall(method string, start time.Time, errMsg string) {
+	recordCall(serverLatencyMetric, serverErrorMetric, method, start, errMsg != "")
+}
+
+func recordThrottledCall(method string) {
+	metrics.GetOrRegisterMeter(serverThrottledMetric+method, nil).Mark(1)
+}
@@ -25,6 +25,7 @@ import (
 	"net/rpc"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/proto"
@@ -33,6 +34,12 @@ import (
 	mux "github.com/xtaci/smux"
 )
 
+const (
+	// DefaultNodeRecordRefreshInterval defines the default interval to publish a new node
+	// record to block producer before the old one expires.
+	DefaultNodeRecordRefreshInterval = proto.DefaultNodeRecordTTL / 3
+)
+
 var (
 	// ErrNoChiefBlockProducerAvailable defines failure on find chief block producer.
 	ErrNoChiefBlockProducerAvailable = errors.New("no chief block producer found")
@@ -85,14 +92,33 @@ func (c *PersistentCaller) initClient(isAnonymous bool) (err error) {
 
 // Call invokes the named function, waits for it to complete, and returns its error status.
 func (c *PersistentCaller) Call(method string, args interface{}, reply interface{}) (err error) {
+	return c.CallWithContext(context.Background(), method, args, reply)
+}
+
+// CallWithContext invokes the named function, waits for it to complete or context done,
+// and returns its error status. A cancelled call is abandoned, the client is kept.
+func (c *PersistentCaller) CallWithContext(
+	ctx context.Context, method string, args interface{}, reply interface{}) (err error) {
 	err = c.initClient(method == route.DHTPing.String())
 	if err != nil {
 		log.WithError(err).Error("init PersistentCaller client failed")
 		return
 	}
-	err = c.client.Call(method, args, reply)
+	err = c.client.CallWithContext(ctx, method, args, reply)
+	if err == ErrCodecNotSupported {
+		// the request was not served by the old peer, retry with msgpack
+		c.ResetClient(method)
+		if err = c.initClient(method == route.DHTPing.String()); err != nil {
+			log.WithError(err).Error("init PersistentCaller client failed")
+			return
+		}
+		err = c.client.CallWithContext(ctx, method, args, reply)
+	}
 	if err != nil {
-		if err == io.EOF ||
+		if err == ErrThrottled {
+			// the stream may be closed by the throttling server
+			c.ResetClient(method)
+		} else if err == io.EOF ||
 			err == io.ErrUnexpectedEOF ||
 			err == io.ErrClosedPipe ||
 			err == rpc.ErrShutdown ||
@@ -157,6 +183,15 @@ func (c *Caller) CallNode(
 
 // CallNodeWithContext invokes the named function, waits for it to complete or context timeout, and returns its error status.
 func (c *Caller) CallNodeWithContext(
+	ctx context.Context, node proto.NodeID, method string, args interface{}, reply interface{}) (err error) {
+	if err = c.callNode(ctx, node, method, args, reply); err == ErrCodecNotSupported {
+		// the request was not served by the old peer, retry with msgpack
+		err = c.callNode(ctx, node, method, args, reply)
+	}
+	return
+}
+
+func (c *Caller) callNode(
 	ctx context.Context, node proto.NodeID, method string, args interface{}, reply interface{}) (err error) {
 	conn, err := DialToNode(node, c.pool, method == route.DHTPing.String())
 	if err != nil {
@@ -181,16 +216,7 @@ func (c *Caller) CallNodeWithContext(
 
 	defer client.Close()
 
-	// TODO(xq262144): golang net/rpc does not support cancel in progress calls
-	ch := client.Go(method, args, reply, make(chan *rpc.Call, 1))
-
-	select {
-	case <-ctx.Done():
-		err = ctx.Err()
-	case call := <-ch.Done:
-		err = call.Error
-	}
-
+	err = client.CallWithContext(ctx, method, args, reply)
 	return
 }
 
@@ -199,7 +225,12 @@ func GetNodeAddr(id *proto.RawNodeID) (addr string, err error) {
 	addr, err = route.GetNodeAddrCache(id)
 	if err != nil {
 		log.WithField("target", id.String()).WithError(err).Info("get node addr from cache failed")
-		if err == route.ErrUnknownNodeID {
+		if err == route.ErrUnknownNodeID || err == route.ErrNodeAddrExpired {
+			// prefer the kademlia routing, the block producers are asked only if failed
+			if record, lookupErr := LookupNode(id); lookupErr == nil {
+				addr, err = record.Node.Addr, nil
+				return
+			}
 			BPs := route.GetBPs()
 			if len(BPs) == 0 {
 				log.Error("no available BP")
@@ -221,7 +252,7 @@ func GetNodeAddr(id *proto.RawNodeID) (addr string, err error) {
 				}).WithError(err).Error("call dht rpc failed")
 				return
 			}
-			route.SetNodeAddrCache(id, respFN.Node.Addr)
+			setNodeAddrFromDHT(id, respFN)
 			addr = respFN.Node.Addr
 		}
 	}
@@ -234,6 +265,15 @@ func GetNodeInfo(id *proto.RawNodeID) (nodeInfo *proto.Node, err error) {
 	if err != nil {
 		log.WithField("target", id.String()).WithError(err).Info("get node info from KMS failed")
 		if err == kms.ErrKeyNotFound {
+			if table := route.GetRoutingTable(); table != nil {
+				if record, ok := table.Get(id); ok {
+					nodeInfo, err = &record.Node, nil
+					if errSet := kms.SetNode(nodeInfo); errSet != nil {
+						log.WithError(errSet).Warning("set node to kms failed")
+					}
+					return
+				}
+			}
 			BPs := route.GetBPs()
 			if len(BPs) == 0 {
 				log.Error("no available BP")
@@ -255,11 +295,17 @@ func GetNodeInfo(id *proto.RawNodeID) (nodeInfo *proto.Node, err error) {
 				return
 			}
 			nodeInfo = respFN.Node
-			errSet := route.SetNodeAddrCache(id, nodeInfo.Addr)
+			errSet := setNodeAddrFromDHT(id, respFN)
 			if errSet != nil {
 				log.WithError(errSet).Warning("set node addr cache failed")
 			}
 			errSet = kms.SetNode(nodeInfo)
+			if errSet == kms.ErrNodeIDKeyNonceNotMatch {
+				// the key may be rotated
+				if errSet = SyncKeyRotation(id); errSet == nil {
+					errSet = kms.SetNode(nodeInfo)
+				}
+			}
 			if errSet != nil {
 				log.WithError(errSet).Warning("set node to kms failed")
 			}
@@ -268,13 +314,66 @@ func GetNodeInfo(id *proto.RawNodeID) (nodeInfo *proto.Node, err error) {
 	return
 }
 
-// PingBP Send DHT.Ping Request with Anonymous ETLS session.
+// setNodeAddrFromDHT caches the node addr of DHT.FindNode response, the addr of a verified
+// signed record expires with the record.
+func setNodeAddrFromDHT(id *proto.RawNodeID, resp *proto.FindNodeResp) (err error) {
+	if resp.Record != nil && resp.Record.Node.ID == resp.Node.ID {
+		if err = route.VerifyNodeRecord(resp.Record); err == nil {
+			return route.SetNodeRecordAddrCache(resp.Record)
+		}
+		log.WithField("node", resp.Node.ID).WithError(err).Warning("verify node record failed")
+	}
+	return route.SetNodeAddrCache(id, resp.Node.Addr)
+}
+
+// SyncKeyRotation fetches the latest key rotation record of the node from BP and stores it
+// to the local public keystore. A NodeID is not looked up again within KeyRotationRetryInterval
+// after a failed lookup.
+func SyncKeyRotation(id *proto.RawNodeID) (err error) {
+	if !failedKeyRotations.allow(id, time.Now()) {
+		return ErrKeyRotationLookupThrottled
+	}
+	BPs := route.GetBPs()
+	if len(BPs) == 0 || route.IsBPNodeID(id) {
+		return ErrNoKeyRotationSource
+	}
+	if localID, err := kms.GetLocalNodeID(); err == nil && route.IsBPNodeID(localID.ToRawNodeID()) {
+		// block producers hold the rotation records themselves
+		return ErrNoKeyRotationSource
+	}
+	var (
+		req  = &route.FindKeyRotationReq{ID: id.String()}
+		resp = new(route.FindKeyRotationResp)
+		bp   = BPs[rand.Intn(len(BPs))]
+	)
+	if err = NewCaller().CallNode(bp, route.DHTFindKeyRotation.String(), req, resp); err != nil {
+		log.WithFields(log.Fields{
+			"bpNode": bp,
+			"target": id.String(),
+		}).WithError(err).Debug("find key rotation failed")
+		failedKeyRotations.fail(id, time.Now())
+		return
+	}
+	if err = kms.SetKeyRotation(resp.Rotation); err != nil {
+		failedKeyRotations.fail(id, time.Now())
+	}
+	return
+}
+
+// PingBP Send DHT.Ping Request with Anonymous ETLS session, the local node is registered with
+// a signed node record.
 func PingBP(node *proto.Node, BPNodeID proto.NodeID) (err error) {
 	client := NewCaller()
 
 	req := &proto.PingReq{
 		Node: *node,
 	}
+	if localID, errID := kms.GetLocalNodeID(); errID == nil && localID == node.ID {
+		if req.Record, err = signNodeRecord(node); err != nil {
+			log.WithError(err).Error("sign local node record failed")
+			return
+		}
+	}
 
 	resp := new(proto.PingResp)
 	err = client.CallNode(BPNodeID, "DHT.Ping", req, resp)
@@ -287,6 +386,43 @@ func PingBP(node *proto.Node, BPNodeID proto.NodeID) (err error) {
 	return
 }
 
+// RunNodeRecordRefresh publishes a new signed record of the local node to the current block
+// producer every interval until stopCh is closed.
+func RunNodeRecordRefresh(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		var (
+			nodeID proto.NodeID
+			node   *proto.Node
+			bp     proto.NodeID
+			err    error
+		)
+		if nodeID, err = kms.GetLocalNodeID(); err != nil {
+			log.WithError(err).Error("get local node id failed")
+			continue
+		}
+		if node, err = kms.GetNodeInfo(nodeID); err != nil {
+			log.WithError(err).Error("get local node info failed")
+			continue
+		}
+		if bp, err = GetCurrentBP(); err != nil {
+			log.WithError(err).Warning("get current BP failed")
+			continue
+		}
+		if err = PingBP(node, bp); err != nil {
+			log.WithField("bp", bp).WithError(err).Warning("refresh node record failed")
+		}
+	}
+}
+
 // GetCurrentBP returns nearest hash distance block producer as current node chief block producer.
 func GetCurrentBP() (bpNodeID proto.NodeID, err error) {
 	currentBPLock.Lock()
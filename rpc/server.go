@@ -21,13 +21,17 @@ import (
 	"io"
 	"net"
 	"net/rpc"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/CovenantSQL/CovenantSQL/conf"
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/etls"
 	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
 	"github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
 	"github.com/CovenantSQL/CovenantSQL/proto"
-	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 	mux "github.com/xtaci/smux"
 )
@@ -41,6 +45,7 @@ type Server struct {
 	stopCh     chan interface{}
 	serviceMap ServiceMap
 	Listener   net.Listener
+	limiter    *serverLimiter
 }
 
 // NewServer return a new Server
@@ -49,9 +54,15 @@ func NewServer() *Server {
 		rpcServer:  rpc.NewServer(),
 		stopCh:     make(chan interface{}),
 		serviceMap: make(ServiceMap),
+		limiter:    newServerLimiter(configuredLimits()),
 	}
 }
 
+// SetLimits replaces the server limits, it must be called before Serve.
+func (s *Server) SetLimits(limits *conf.RPCLimits) {
+	s.limiter = newServerLimiter(limits)
+}
+
 // InitRPCServer load the private key, init the crypto transfer layer and register RPC
 // services.
 // IF ANY ERROR returned, please raise a FATAL
@@ -127,13 +138,29 @@ func (s *Server) handleConn(conn net.Conn) {
 		remoteNodeID = c.NodeID
 	}
 
-	sess, err := mux.Server(conn, YamuxConfig)
+	// The session is counted by address until the remote proves its NodeID
+	slot := &sessionSlot{limiter: s.limiter, key: remoteIP(conn)}
+	if !s.limiter.acquireSession(slot.key) {
+		log.WithField("remote", slot.key).Warning("too many sessions, connection refused")
+		return
+	}
+	defer slot.release()
+
+	var sessConn io.ReadWriteCloser = conn
+	if c, ok := conn.(*etls.CryptoConn); ok &&
+		remoteNodeID != nil && !remoteNodeID.IsEqual(&kms.AnonymousRawNodeID.Hash) {
+		sessConn = &verifiedConn{CryptoConn: c, slot: slot}
+	}
+
+	sess, err := mux.Server(sessConn, YamuxConfig)
 	if err != nil {
 		log.Error(err)
 		return
 	}
 	defer sess.Close()
 
+	var streams int32
+
 sessionLoop:
 	for {
 		select {
@@ -150,17 +177,117 @@ sessionLoop:
 				}
 				break sessionLoop
 			}
-			ctx, cancelFunc := context.WithCancel(context.Background())
+			if max := s.limiter.maxStreams(); max > 0 && atomic.LoadInt32(&streams) >= int32(max) {
+				log.WithField("remote", slot.String()).Debug("too many streams, stream rejected")
+				go rejectStream(muxConn)
+				continue
+			}
+			atomic.AddInt32(&streams, 1)
 			go func() {
-				<-muxConn.GetDieCh()
-				cancelFunc()
+				defer atomic.AddInt32(&streams, -1)
+				s.serveStream(muxConn, remoteNodeID)
 			}()
-			nodeAwareCodec := NewNodeAwareServerCodec(ctx, utils.GetMsgPackServerCodec(muxConn), remoteNodeID)
-			go s.rpcServer.ServeCodec(nodeAwareCodec)
 		}
 	}
 }
 
+// sessionSlot is the session slot of a connection in the server limiter.
+type sessionSlot struct {
+	limiter *serverLimiter
+	sync.Mutex
+	key string
+}
+
+// move takes a slot of 'key' and releases the current one, returns false if 'key' has too
+// many sessions.
+func (s *sessionSlot) move(key string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if !s.limiter.acquireSession(key) {
+		return false
+	}
+	s.limiter.releaseSession(s.key)
+	s.key = key
+	return true
+}
+
+func (s *sessionSlot) release() {
+	s.Lock()
+	defer s.Unlock()
+	s.limiter.releaseSession(s.key)
+}
+
+func (s *sessionSlot) String() string {
+	s.Lock()
+	defer s.Unlock()
+	return s.key
+}
+
+// verifiedConn moves the session slot to the remote NodeID once the first ETLS v2 record is
+// read. The handshake alone doesn't prove that the remote owns the NodeID key, only the
+// authenticated records do. ETLS v1 streams are not authenticated, so they keep the
+// address slot.
+type verifiedConn struct {
+	*etls.CryptoConn
+	slot *sessionSlot
+	once sync.Once
+	err  error
+}
+
+func (c *verifiedConn) Read(b []byte) (n int, err error) {
+	if n, err = c.CryptoConn.Read(b); err != nil || c.Version() < etls.Version2 {
+		return
+	}
+	c.once.Do(func() {
+		if !c.slot.move(c.NodeID.String()) {
+			log.WithField("remote", c.NodeID.String()).Warning("too many sessions, connection refused")
+			c.err = ErrTooManySessions
+		}
+	})
+	if c.err != nil {
+		n, err = 0, c.err
+	}
+	return
+}
+
+// serveStream serves the RPC requests of a stream with the codec selected by the client.
+func (s *Server) serveStream(muxConn *mux.Stream, remoteNodeID *proto.RawNodeID) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	go func() {
+		<-muxConn.GetDieCh()
+		cancelFunc()
+	}()
+	codec, err := newServerCodec(muxConn)
+	if err != nil {
+		log.WithField("remote", remoteNodeID).WithError(err).Debug("init stream codec failed")
+		muxConn.Close()
+		return
+	}
+	nodeAwareCodec := NewNodeAwareServerCodec(ctx, codec, remoteNodeID)
+	nodeAwareCodec.limiter = s.limiter
+	nodeAwareCodec.trustTrace = isTraceTrusted(remoteNodeID)
+	s.rpcServer.ServeCodec(nodeAwareCodec)
+}
+
+// rejectStreamTimeout bounds the wait for the first request of a rejected stream.
+const rejectStreamTimeout = 5 * time.Second
+
+// rejectStream answers the first request of the stream with ErrThrottled and closes it.
+func rejectStream(muxConn *mux.Stream) {
+	defer muxConn.Close()
+	muxConn.SetReadDeadline(time.Now().Add(rejectStreamTimeout))
+	codec, err := newServerCodec(muxConn)
+	if err != nil {
+		return
+	}
+	var r rpc.Request
+	if err = codec.ReadRequestHeader(&r); err != nil {
+		return
+	}
+	nodeAwareCodec := &NodeAwareServerCodec{ServerCodec: codec}
+	nodeAwareCodec.reject(&r, ErrThrottled)
+}
+
 // RegisterService with a Service name, used by Client RPC
 func (s *Server) RegisterService(name string, service interface{}) error {
 	return s.rpcServer.RegisterName(name, service)
@@ -174,31 +301,60 @@ func (s *Server) Stop() {
 	close(s.stopCh)
 }
 
+// handshakeHeaderTimeout bounds the read of the NodeID and nonce header.
+const handshakeHeaderTimeout = 10 * time.Second
+
 func handleCipher(conn net.Conn) (cryptoConn *etls.CryptoConn, err error) {
+	ip := remoteIP(conn)
+	if !failedHandshakes.allow(ip, time.Now()) {
+		conn.Close()
+		err = ErrHandshakeRateLimited
+		log.WithField("remote", ip).WithError(err).Debug("handshake refused")
+		return
+	}
+	defer func() {
+		if err != nil {
+			failedHandshakes.fail(ip, time.Now())
+			conn.Close()
+		}
+	}()
+
 	// NodeID + Uint256 Nonce
 	headerBuf := make([]byte, hash.HashBSize+32)
-	rCount, err := conn.Read(headerBuf)
-	if err != nil || rCount != hash.HashBSize+32 {
-		log.WithError(err).Error("read node header error")
+	conn.SetReadDeadline(time.Now().Add(handshakeHeaderTimeout))
+	_, err = io.ReadFull(conn, headerBuf)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		log.WithField("remote", ip).WithError(err).Error("read node header error")
 		return
 	}
 
 	// headerBuf len is hash.HashBSize, so there won't be any error
 	idHash, _ := hash.NewHash(headerBuf[:hash.HashBSize])
 	rawNodeID := &proto.RawNodeID{Hash: *idHash}
-	// TODO(auxten): compute the nonce and check difficulty
-	cpuminer.Uint256FromBytes(headerBuf[hash.HashBSize:])
+	// headerBuf nonce part is 32 bytes, so there won't be any error
+	nonce, _ := cpuminer.Uint256FromBytes(headerBuf[hash.HashBSize:])
 
-	symmetricKey, err := GetSharedSecretWith(
-		rawNodeID,
-		rawNodeID.IsEqual(&kms.AnonymousRawNodeID.Hash),
-	)
+	var symmetricKey []byte
+	if rawNodeID.IsEqual(&kms.AnonymousRawNodeID.Hash) {
+		symmetricKey, err = GetSharedSecretWith(rawNodeID, true)
+	} else {
+		var remotePublicKey *asymmetric.PublicKey
+		if remotePublicKey, _, err = getVerifiedRemoteNode(rawNodeID, nonce); err != nil {
+			log.WithFields(log.Fields{
+				"target": rawNodeID.String(),
+				"remote": ip,
+			}).WithError(err).Warning("node id verification failed")
+			return
+		}
+		symmetricKey, err = genSharedSecret(rawNodeID, remotePublicKey)
+	}
 	if err != nil {
 		log.WithField("target", rawNodeID.String()).WithError(err).Error("get shared secret")
 		return
 	}
 	cipher := etls.NewCipher(symmetricKey)
-	cryptoConn = etls.NewConn(conn, cipher, rawNodeID)
+	cryptoConn = etls.NewServerConn(conn, cipher, rawNodeID, minETLSVersion(), maxETLSVersion())
 
 	return
 }
@@ -19,16 +19,109 @@ package rpc
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/conf"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
+	"github.com/CovenantSQL/CovenantSQL/pow/cpuminer"
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
 )
 
-var symmetricKeyCache sync.Map
+// nodeCacheTTL is the expiry of the cached shared secrets and verified remote nodes,
+// so a rotated node key is picked up without restarting the node.
+const nodeCacheTTL = 10 * time.Minute
+
+var (
+	// symmetricKeyCache maps the RawNodeID to the *cachedSecret of the node.
+	symmetricKeyCache sync.Map
+	// remoteNodeCache maps the RawNodeID to the *cachedNode verified on accept.
+	remoteNodeCache sync.Map
+)
+
+type cachedSecret struct {
+	symmetricKey []byte
+	expire       time.Time
+}
+
+type cachedNode struct {
+	publicKey *asymmetric.PublicKey
+	role      proto.ServerRole
+	expire    time.Time
+}
+
+// getVerifiedRemoteNode returns the public key and role of the remote node verified
+// against the nonce, the verified node is cached to avoid a lookup per connection.
+func getVerifiedRemoteNode(nodeID *proto.RawNodeID, nonce *cpuminer.Uint256) (
+	publicKey *asymmetric.PublicKey, role proto.ServerRole, err error) {
+	if v, ok := remoteNodeCache.Load(*nodeID); ok {
+		node := v.(*cachedNode)
+		if time.Now().Before(node.expire) && kms.IsNodeKeyValid(nodeID, nonce, node.publicKey) {
+			return node.publicKey, node.role, nil
+		}
+		remoteNodeCache.Delete(*nodeID)
+	}
+
+	if publicKey, role, err = getRemoteNode(nodeID); err != nil {
+		return
+	}
+	if err = verifyNodeID(nodeID, nonce, publicKey, role); err != nil {
+		return
+	}
+	remoteNodeCache.Store(*nodeID, &cachedNode{
+		publicKey: publicKey,
+		role:      role,
+		expire:    time.Now().Add(nodeCacheTTL),
+	})
+	return
+}
+
+// isTraceTrusted returns whether the sampling of the span context sent by the remote node is
+// honored, only the block producers and miners verified on accept are trusted, as other callers
+// could force the sampling of every call regardless of the local sample rate. The traces of the
+// untrusted callers are continued too, but sampled by the local sample rate.
+func isTraceTrusted(nodeID *proto.RawNodeID) bool {
+	if nodeID == nil {
+		return false
+	}
+	v, ok := remoteNodeCache.Load(*nodeID)
+	if !ok {
+		return false
+	}
+	switch v.(*cachedNode).role {
+	case proto.Leader, proto.Follower, proto.Miner:
+		return true
+	}
+	return false
+}
+
+// getRemoteNode gets the public key and role of the remote node.
+func getRemoteNode(nodeID *proto.RawNodeID) (publicKey *asymmetric.PublicKey, role proto.ServerRole, err error) {
+	if route.IsBPNodeID(nodeID) {
+		publicKey = kms.BP.PublicKey
+		role = proto.Leader
+	} else if conf.RoleTag[0] == conf.BlockProducerBuildTag[0] {
+		var nodeInfo *proto.Node
+		nodeInfo, err = kms.GetNodeInfo(proto.NodeID(nodeID.String()))
+		if err != nil {
+			log.WithField("node", nodeID).WithError(err).Error("get public key locally failed")
+			return
+		}
+		publicKey, role = nodeInfo.PublicKey, nodeInfo.Role
+	} else {
+		// if non BP running and key not found, ask BlockProducer
+		var nodeInfo *proto.Node
+		nodeInfo, err = GetNodeInfo(nodeID)
+		if err != nil {
+			log.WithField("node", nodeID).WithError(err).Error("get public key failed")
+			return
+		}
+		publicKey, role = nodeInfo.PublicKey, nodeInfo.Role
+	}
+	return
+}
 
 // GetSharedSecretWith gets shared symmetric key with ECDH
 func GetSharedSecretWith(nodeID *proto.RawNodeID, isAnonymous bool) (symmetricKey []byte, err error) {
@@ -36,47 +129,45 @@ func GetSharedSecretWith(nodeID *proto.RawNodeID, isAnonymous bool) (symmetricKe
 		symmetricKey = []byte(`!&\\!qEyey*\cbLc,aKl`)
 		log.Debug("using anonymous ETLS")
 	} else {
-		symmetricKeyI, ok := symmetricKeyCache.Load(nodeID)
-		if ok {
-			symmetricKey, _ = symmetricKeyI.([]byte)
+		if v, ok := symmetricKeyCache.Load(*nodeID); ok && time.Now().Before(v.(*cachedSecret).expire) {
+			symmetricKey = v.(*cachedSecret).symmetricKey
 		} else {
 			var remotePublicKey *asymmetric.PublicKey
-			if route.IsBPNodeID(nodeID) {
-				remotePublicKey = kms.BP.PublicKey
-			} else if conf.RoleTag[0] == conf.BlockProducerBuildTag[0] {
-				remotePublicKey, err = kms.GetPublicKey(proto.NodeID(nodeID.String()))
-				if err != nil {
-					log.WithField("node", nodeID).WithError(err).Error("get public key locally failed")
-					return
-				}
-			} else {
-				// if non BP running and key not found, ask BlockProducer
-				var nodeInfo *proto.Node
-				nodeInfo, err = GetNodeInfo(nodeID)
-				if err != nil {
-					log.WithField("node", nodeID).WithError(err).Error("get public key failed")
-					return
-				}
-				remotePublicKey = nodeInfo.PublicKey
-			}
-
-			var localPrivateKey *asymmetric.PrivateKey
-			localPrivateKey, err = kms.GetLocalPrivateKey()
+			remotePublicKey, _, err = getRemoteNode(nodeID)
 			if err != nil {
-				log.WithError(err).Error("get local private key failed")
 				return
 			}
 
-			symmetricKey = asymmetric.GenECDHSharedSecret(localPrivateKey, remotePublicKey)
-			symmetricKeyCache.Store(nodeID, symmetricKey)
-			log.WithFields(log.Fields{
-				"node":       nodeID.String(),
-				"remotePub":  fmt.Sprintf("%#x", remotePublicKey.Serialize()),
-				"sessionKey": fmt.Sprintf("%#x", symmetricKey),
-			}).Debug("generated shared secret")
+			symmetricKey, err = genSharedSecret(nodeID, remotePublicKey)
 		}
 		//log.Debugf("ECDH for %s Public Key: %x, Private Key: %x Session Key: %x",
 		//	nodeID.ToNodeID(), remotePublicKey.Serialize(), localPrivateKey.Serialize(), symmetricKey)
 	}
 	return
 }
+
+// genSharedSecret generates and caches the shared symmetric key with the remote public key.
+func genSharedSecret(nodeID *proto.RawNodeID, remotePublicKey *asymmetric.PublicKey) (symmetricKey []byte, err error) {
+	if symmetricKey, err = kms.GenLocalSharedSecret(remotePublicKey); err != nil {
+		log.WithError(err).Error("generate local shared secret failed")
+		return
+	}
+	now := time.Now()
+	expire := now.Add(nodeCacheTTL)
+	if r, err := kms.GetKeyRotation(nodeID.String()); err == nil {
+		// the node key is switched when the grace period ends
+		if end := r.Timestamp.Add(r.GracePeriod); end.After(now) && end.Before(expire) {
+			expire = end
+		}
+	}
+	symmetricKeyCache.Store(*nodeID, &cachedSecret{
+		symmetricKey: symmetricKey,
+		expire:       expire,
+	})
+	log.WithFields(log.Fields{
+		"node":       nodeID.String(),
+		"remotePub":  fmt.Sprintf("%#x", remotePublicKey.Serialize()),
+		"sessionKey": fmt.Sprintf("%#x", symmetricKey),
+	}).Debug("generated shared secret")
+	return
+}
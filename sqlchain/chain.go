@@ -37,6 +37,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/CovenantSQL/CovenantSQL/utils/trace"
 	x "github.com/CovenantSQL/CovenantSQL/xenomint"
 	xi "github.com/CovenantSQL/CovenantSQL/xenomint/interfaces"
 	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
@@ -136,8 +137,8 @@ type Chain struct {
 
 	// Cached fileds, may need to renew some of this fields later.
 	//
-	// pk is the private key of the local miner.
-	pk *asymmetric.PrivateKey
+	// pk is the signer of the local miner.
+	pk asymmetric.Signer
 }
 
 // NewChain creates a new sql-chain struct.
@@ -190,10 +191,11 @@ func NewChainWithContext(ctx context.Context, c *Config) (chain *Chain, err erro
 	if state, err = x.NewState(c.Server, strg); err != nil {
 		return
 	}
+	state.InitQueryStats(c.DatabaseID, c.MaxQueryPatterns)
 
 	// Cache local private key
-	var pk *asymmetric.PrivateKey
-	if pk, err = kms.GetLocalPrivateKey(); err != nil {
+	var pk asymmetric.Signer
+	if pk, err = kms.GetLocalSigner(); err != nil {
 		err = errors.Wrap(err, "failed to cache private key")
 		return
 	}
@@ -266,10 +268,11 @@ func LoadChainWithContext(ctx context.Context, c *Config) (chain *Chain, err err
 	if xstate, err = x.NewState(c.Server, strg); err != nil {
 		return
 	}
+	xstate.InitQueryStats(c.DatabaseID, c.MaxQueryPatterns)
 
 	// Cache local private key
-	var pk *asymmetric.PrivateKey
-	if pk, err = kms.GetLocalPrivateKey(); err != nil {
+	var pk asymmetric.Signer
+	if pk, err = kms.GetLocalSigner(); err != nil {
 		err = errors.Wrap(err, "failed to cache private key")
 		return
 	}
@@ -469,6 +472,7 @@ func (c *Chain) pushBlock(b *types.Block) (err error) {
 	}
 	c.rt.setHead(st)
 	c.bi.addBlock(node)
+	headHeight.WithLabelValues(string(c.rt.databaseID)).Set(float64(st.Height))
 
 	// Keep track of the queries from the new block
 	var ierr error
@@ -547,7 +551,12 @@ func (c *Chain) produceBlockV2(now time.Time) (err error) {
 		frs []*types.Request
 		qts []*x.QueryTracker
 	)
-	if frs, qts, err = c.st.CommitEx(); err != nil {
+	ctx, span := trace.StartSpan(context.Background(), "sqlchain.produceBlock")
+	span.SetAttribute("database", c.rt.databaseID)
+	defer func() {
+		span.End(err)
+	}()
+	if frs, qts, err = c.st.CommitExWithContext(ctx); err != nil {
 		return
 	}
 	var block = &types.Block{
@@ -578,9 +587,16 @@ func (c *Chain) produceBlockV2(now time.Time) (err error) {
 		}
 	}
 	// Sign block
-	if err = block.PackAndSignBlock(c.pk); err != nil {
+	_, packSpan := trace.StartChildSpan(ctx, "sqlchain.packBlock")
+	err = block.PackAndSignBlock(c.pk)
+	packSpan.SetAttribute("queries", len(block.QueryTxs))
+	packSpan.SetAttribute("failed", len(block.FailedReqs))
+	packSpan.SetAttribute("acks", len(block.Acks))
+	packSpan.End(err)
+	if err != nil {
 		return
 	}
+	span.SetAttribute("block", block.BlockHash())
 	// Send to pending list
 	select {
 	case c.blocks <- block:
@@ -588,6 +604,7 @@ func (c *Chain) produceBlockV2(now time.Time) (err error) {
 		err = c.rt.ctx.Err()
 		return
 	}
+	recordBlockQueries(c.rt.databaseID, block)
 	log.WithFields(log.Fields{
 		"peer":            c.rt.getPeerInfoString(),
 		"time":            c.rt.getChainTimeString(),
@@ -623,9 +640,20 @@ func (c *Chain) produceBlockV2(now time.Time) (err error) {
 			wg.Add(1)
 			go func(id proto.NodeID) {
 				defer wg.Done()
-				resp := &MuxAdviseNewBlockResp{}
-				if err := c.cl.CallNodeWithContext(
-					c.rt.ctx, id, route.SQLCAdviseNewBlock.String(), req, resp,
+				adviseCtx, adviseSpan := trace.StartChildSpan(
+					trace.ContextWithSpanContext(c.rt.ctx, span.Context()), "sqlchain.adviseBlock")
+				adviseSpan.SetAttribute("node", id)
+				// copy the request to carry the span of each peer
+				var (
+					adviseReq = *req
+					resp      = &MuxAdviseNewBlockResp{}
+					err       error
+				)
+				defer func() {
+					adviseSpan.End(err)
+				}()
+				if err = c.cl.CallNodeWithContext(
+					adviseCtx, id, route.SQLCAdviseNewBlock.String(), &adviseReq, resp,
 				); err != nil {
 					log.WithFields(log.Fields{
 						"peer":            c.rt.getPeerInfoString(),
@@ -747,7 +775,10 @@ func (c *Chain) runCurrentTurn(now time.Time) {
 		return
 	}
 
-	if err := c.produceBlockV2(now); err != nil {
+	start := time.Now()
+	err := c.produceBlockV2(now)
+	recordBlockProduction(c.rt.databaseID, start, err)
+	if err != nil {
 		log.WithFields(log.Fields{
 			"peer":            c.rt.getPeerInfoString(),
 			"time":            c.rt.getChainTimeString(),
@@ -935,6 +966,7 @@ func (c *Chain) Stop() (err error) {
 		"peer": c.rt.getPeerInfoString(),
 		"time": c.rt.getChainTimeString(),
 	}).WithError(ierr).Debug("Chain state storage closed")
+	forgetBlockProduction(c.rt.databaseID)
 	return
 }
 
@@ -1381,6 +1413,11 @@ func (c *Chain) Query(req *types.Request) (resp *types.Response, err error) {
 	return
 }
 
+// QueryStats returns the query pattern statistics of local chain state.
+func (c *Chain) QueryStats() []types.QueryStat {
+	return c.st.QueryStats()
+}
+
 // Replay replays a write log from other peer to replicate storage state.
 func (c *Chain) Replay(req *types.Request, resp *types.Response) (err error) {
 	switch req.Header.QueryType {
@@ -48,6 +48,9 @@ type Config struct {
 
 	BlockCacheTTL int32
 
+	// MaxQueryPatterns sets the capacity of the query pattern statistics table.
+	MaxQueryPatterns int
+
 	// DBAccount info
 	TokenType    pt.TokenType
 	GasPrice     uint64
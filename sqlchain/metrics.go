@@ -0,0 +1,82 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	blockProduceCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "covenantsql",
+		Subsystem: "sqlchain",
+		Name:      "blocks_produced_total",
+		Help:      "Number of the blocks produced by the sql-chain peer.",
+	}, []string{"database", "result"})
+	blockProduceLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "covenantsql",
+		Subsystem: "sqlchain",
+		Name:      "block_produce_duration_seconds",
+		Help:      "Duration of producing and advising a block.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"database"})
+	blockQueryCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "covenantsql",
+		Subsystem: "sqlchain",
+		Name:      "block_queries_total",
+		Help:      "Number of the queries packed in the produced blocks.",
+	}, []string{"database"})
+	headHeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "covenantsql",
+		Subsystem: "sqlchain",
+		Name:      "head_height",
+		Help:      "Height of the sql-chain head block.",
+	}, []string{"database"})
+)
+
+func init() {
+	prometheus.MustRegister(blockProduceCount, blockProduceLatency, blockQueryCount, headHeight)
+}
+
+// recordBlockProduction records the result and latency of a block production.
+func recordBlockProduction(dbID proto.DatabaseID, start time.Time, err error) {
+	result := "succ"
+	if err != nil {
+		result = "fail"
+	}
+	blockProduceCount.WithLabelValues(string(dbID), result).Inc()
+	blockProduceLatency.WithLabelValues(string(dbID)).Observe(time.Since(start).Seconds())
+}
+
+// recordBlockQueries records the queries packed in the produced block.
+func recordBlockQueries(dbID proto.DatabaseID, b *types.Block) {
+	blockQueryCount.WithLabelValues(string(dbID)).Add(float64(len(b.QueryTxs)))
+}
+
+// forgetBlockProduction removes the sql-chain series of the database.
+func forgetBlockProduction(dbID proto.DatabaseID) {
+	for _, result := range []string{"succ", "fail"} {
+		blockProduceCount.DeleteLabelValues(string(dbID), result)
+	}
+	blockProduceLatency.DeleteLabelValues(string(dbID))
+	blockQueryCount.DeleteLabelValues(string(dbID))
+	headHeight.DeleteLabelValues(string(dbID))
+}
@@ -60,7 +60,7 @@ func (sh *SignedAckHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedAckHeader) Sign(signer *asymmetric.PrivateKey, verifyReqHeader bool) (err error) {
+func (sh *SignedAckHeader) Sign(signer asymmetric.Signer, verifyReqHeader bool) (err error) {
 	// Only used by ack worker, and ack.Header is verified before build ack
 	if verifyReqHeader {
 		// check original header signature
@@ -78,7 +78,7 @@ func (a *Ack) Verify() error {
 }
 
 // Sign the request.
-func (a *Ack) Sign(signer *asymmetric.PrivateKey, verifyReqHeader bool) (err error) {
+func (a *Ack) Sign(signer asymmetric.Signer, verifyReqHeader bool) (err error) {
 	// sign
 	return a.Header.Sign(signer, verifyReqHeader)
 }
@@ -47,7 +47,7 @@ type SignedHeader struct {
 }
 
 // Sign calls DefaultHashSignVerifierImpl to calculate header hash and sign it with signer.
-func (s *SignedHeader) Sign(signer *ca.PrivateKey) error {
+func (s *SignedHeader) Sign(signer ca.Signer) error {
 	return s.HSV.Sign(&s.Header, signer)
 }
 
@@ -109,7 +109,7 @@ func (b *Block) CalcNextID() (id uint64, ok bool) {
 }
 
 // PackAndSignBlock generates the signature for the Block from the given PrivateKey.
-func (b *Block) PackAndSignBlock(signer *ca.PrivateKey) (err error) {
+func (b *Block) PackAndSignBlock(signer ca.Signer) (err error) {
 	// Calculate merkle root
 	b.SignedHeader.MerkleRoot = b.computeMerkleRoot()
 	return b.SignedHeader.Sign(signer)
@@ -17,9 +17,12 @@
 package types
 
 import (
+	pt "github.com/CovenantSQL/CovenantSQL/blockproducer/types"
 	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
 	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
 	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/pkg/errors"
 )
 
 //go:generate hsp
@@ -27,6 +30,9 @@ import (
 // CreateDatabaseRequestHeader defines client create database rpc header.
 type CreateDatabaseRequestHeader struct {
 	ResourceMeta ResourceMeta
+	// OwnerPolicy makes the multi-signature account of the policy the database owner instead
+	// of the signee, the request must be signed by one of the policy keys.
+	OwnerPolicy *pt.MultiSigPolicy
 }
 
 // SignedCreateDatabaseRequestHeader defines signed client create database request header.
@@ -41,7 +47,7 @@ func (sh *SignedCreateDatabaseRequestHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedCreateDatabaseRequestHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedCreateDatabaseRequestHeader) Sign(signer asymmetric.Signer) (err error) {
 	return sh.DefaultHashSignVerifierImpl.Sign(&sh.CreateDatabaseRequestHeader, signer)
 }
 
@@ -57,7 +63,7 @@ func (r *CreateDatabaseRequest) Verify() error {
 }
 
 // Sign the request.
-func (r *CreateDatabaseRequest) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (r *CreateDatabaseRequest) Sign(signer asymmetric.Signer) (err error) {
 	// sign
 	return r.Header.Sign(signer)
 }
@@ -79,7 +85,7 @@ func (sh *SignedCreateDatabaseResponseHeader) Verify() (err error) {
 }
 
 // Sign the response.
-func (sh *SignedCreateDatabaseResponseHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedCreateDatabaseResponseHeader) Sign(signer asymmetric.Signer) (err error) {
 	return sh.DefaultHashSignVerifierImpl.Sign(&sh.CreateDatabaseResponseHeader, signer)
 }
 
@@ -95,7 +101,7 @@ func (r *CreateDatabaseResponse) Verify() error {
 }
 
 // Sign the response.
-func (r *CreateDatabaseResponse) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (r *CreateDatabaseResponse) Sign(signer asymmetric.Signer) (err error) {
 	// sign
 	return r.Header.Sign(signer)
 }
@@ -109,16 +115,47 @@ type DropDatabaseRequestHeader struct {
 type SignedDropDatabaseRequestHeader struct {
 	DropDatabaseRequestHeader
 	verifier.DefaultHashSignVerifierImpl
+	// MultiSig holds the signatures if the database owner is a multi-signature account.
+	MultiSig *pt.MultiSig
 }
 
-// Verify checks hash and signature in request header.
-func (sh *SignedDropDatabaseRequestHeader) Verify() (err error) {
-	return sh.DefaultHashSignVerifierImpl.Verify(&sh.DropDatabaseRequestHeader)
+// NewMultiSigDropDatabaseRequest returns a new drop database request of the database owned
+// by the multi-signature account of policy, it's partially signed by each signer.
+func NewMultiSigDropDatabaseRequest(header *DropDatabaseRequestHeader, policy *pt.MultiSigPolicy) *DropDatabaseRequest {
+	r := new(DropDatabaseRequest)
+	r.Header.DropDatabaseRequestHeader = *header
+	r.Header.MultiSig = pt.NewMultiSig(policy)
+	return r
 }
 
-// Sign the request.
-func (sh *SignedDropDatabaseRequestHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
-	return sh.DefaultHashSignVerifierImpl.Sign(&sh.DropDatabaseRequestHeader, signer)
+// Verify checks hash and signature in request header, or the signatures of the
+// multi-signature account.
+func (sh *SignedDropDatabaseRequestHeader) Verify() (err error) {
+	if sh.MultiSig == nil {
+		return sh.DefaultHashSignVerifierImpl.Verify(&sh.DropDatabaseRequestHeader)
+	}
+	var enc []byte
+	if enc, err = sh.DropDatabaseRequestHeader.MarshalHash(); err != nil {
+		return
+	}
+	if h := hash.THashH(enc); !sh.DataHash.IsEqual(&h) {
+		return errors.WithStack(verifier.ErrHashValueNotMatch)
+	}
+	return sh.MultiSig.Verify(sh.DataHash)
+}
+
+// Sign the request, a multi-signature request is partially signed by the signer.
+func (sh *SignedDropDatabaseRequestHeader) Sign(signer asymmetric.Signer) (err error) {
+	if sh.MultiSig == nil {
+		return sh.DefaultHashSignVerifierImpl.Sign(&sh.DropDatabaseRequestHeader, signer)
+	}
+	var enc []byte
+	if enc, err = sh.DropDatabaseRequestHeader.MarshalHash(); err != nil {
+		return
+	}
+	sh.DataHash = hash.THashH(enc)
+	sh.Signee, sh.Signature = nil, nil
+	return sh.MultiSig.Sign(sh.DataHash, signer)
 }
 
 // DropDatabaseRequest defines client drop database rpc request entity.
@@ -133,7 +170,7 @@ func (r *DropDatabaseRequest) Verify() error {
 }
 
 // Sign the request.
-func (r *DropDatabaseRequest) Sign(signer *asymmetric.PrivateKey) error {
+func (r *DropDatabaseRequest) Sign(signer asymmetric.Signer) error {
 	return r.Header.Sign(signer)
 }
 
@@ -157,7 +194,7 @@ func (sh *SignedGetDatabaseRequestHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedGetDatabaseRequestHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedGetDatabaseRequestHeader) Sign(signer asymmetric.Signer) (err error) {
 	return sh.DefaultHashSignVerifierImpl.Sign(&sh.GetDatabaseRequestHeader, signer)
 }
 
@@ -173,7 +210,7 @@ func (r *GetDatabaseRequest) Verify() error {
 }
 
 // Sign the request.
-func (r *GetDatabaseRequest) Sign(signer *asymmetric.PrivateKey) error {
+func (r *GetDatabaseRequest) Sign(signer asymmetric.Signer) error {
 	return r.Header.Sign(signer)
 }
 
@@ -194,7 +231,7 @@ func (sh *SignedGetDatabaseResponseHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedGetDatabaseResponseHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedGetDatabaseResponseHeader) Sign(signer asymmetric.Signer) (err error) {
 	return sh.DefaultHashSignVerifierImpl.Sign(&sh.GetDatabaseResponseHeader, signer)
 }
 
@@ -210,6 +247,6 @@ func (r *GetDatabaseResponse) Verify() (err error) {
 }
 
 // Sign the request.
-func (r *GetDatabaseResponse) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (r *GetDatabaseResponse) Sign(signer asymmetric.Signer) (err error) {
 	return r.Header.Sign(signer)
 }
@@ -12,8 +12,18 @@ func (z *CreateDatabaseRequest) MarshalHash() (o []byte, err error) {
 	o = hsp.Require(b, z.Msgsize())
 	// map header, size 2
 	// map header, size 2
-	// map header, size 1
-	o = append(o, 0x82, 0x82, 0x82, 0x82, 0x81, 0x81)
+	// map header, size 2
+	o = append(o, 0x82, 0x82, 0x82, 0x82, 0x82, 0x82)
+	if z.Header.CreateDatabaseRequestHeader.OwnerPolicy == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.Header.CreateDatabaseRequestHeader.OwnerPolicy.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x82)
 	if oTemp, err := z.Header.CreateDatabaseRequestHeader.ResourceMeta.MarshalHash(); err != nil {
 		return nil, err
 	} else {
@@ -36,7 +46,13 @@ func (z *CreateDatabaseRequest) MarshalHash() (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *CreateDatabaseRequest) Msgsize() (s int) {
-	s = 1 + 7 + 1 + 28 + 1 + 13 + z.Header.CreateDatabaseRequestHeader.ResourceMeta.Msgsize() + 28 + z.Header.DefaultHashSignVerifierImpl.Msgsize() + 9 + z.Envelope.Msgsize()
+	s = 1 + 7 + 1 + 28 + 1 + 12
+	if z.Header.CreateDatabaseRequestHeader.OwnerPolicy == nil {
+		s += hsp.NilSize
+	} else {
+		s += z.Header.CreateDatabaseRequestHeader.OwnerPolicy.Msgsize()
+	}
+	s += 13 + z.Header.CreateDatabaseRequestHeader.ResourceMeta.Msgsize() + 28 + z.Header.DefaultHashSignVerifierImpl.Msgsize() + 9 + z.Envelope.Msgsize()
 	return
 }
 
@@ -44,8 +60,18 @@ func (z *CreateDatabaseRequest) Msgsize() (s int) {
 func (z *CreateDatabaseRequestHeader) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 1
-	o = append(o, 0x81, 0x81)
+	// map header, size 2
+	o = append(o, 0x82, 0x82)
+	if z.OwnerPolicy == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.OwnerPolicy.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x82)
 	if oTemp, err := z.ResourceMeta.MarshalHash(); err != nil {
 		return nil, err
 	} else {
@@ -56,7 +82,13 @@ func (z *CreateDatabaseRequestHeader) MarshalHash() (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *CreateDatabaseRequestHeader) Msgsize() (s int) {
-	s = 1 + 13 + z.ResourceMeta.Msgsize()
+	s = 1 + 12
+	if z.OwnerPolicy == nil {
+		s += hsp.NilSize
+	} else {
+		s += z.OwnerPolicy.Msgsize()
+	}
+	s += 13 + z.ResourceMeta.Msgsize()
 	return
 }
 
@@ -119,15 +151,25 @@ func (z *DropDatabaseRequest) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
 	// map header, size 2
-	// map header, size 2
+	// map header, size 3
+	o = append(o, 0x82, 0x82, 0x83, 0x83)
+	if z.Header.MultiSig == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.Header.MultiSig.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
 	// map header, size 1
-	o = append(o, 0x82, 0x82, 0x82, 0x82, 0x81, 0x81)
+	o = append(o, 0x83, 0x81, 0x81)
 	if oTemp, err := z.Header.DropDatabaseRequestHeader.DatabaseID.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x82)
+	o = append(o, 0x83)
 	if oTemp, err := z.Header.DefaultHashSignVerifierImpl.MarshalHash(); err != nil {
 		return nil, err
 	} else {
@@ -144,7 +186,13 @@ func (z *DropDatabaseRequest) MarshalHash() (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *DropDatabaseRequest) Msgsize() (s int) {
-	s = 1 + 7 + 1 + 26 + 1 + 11 + z.Header.DropDatabaseRequestHeader.DatabaseID.Msgsize() + 28 + z.Header.DefaultHashSignVerifierImpl.Msgsize() + 9 + z.Envelope.Msgsize()
+	s = 1 + 7 + 1 + 9
+	if z.Header.MultiSig == nil {
+		s += hsp.NilSize
+	} else {
+		s += z.Header.MultiSig.Msgsize()
+	}
+	s += 26 + 1 + 11 + z.Header.DropDatabaseRequestHeader.DatabaseID.Msgsize() + 28 + z.Header.DefaultHashSignVerifierImpl.Msgsize() + 9 + z.Envelope.Msgsize()
 	return
 }
 
@@ -296,8 +344,18 @@ func (z *SignedCreateDatabaseRequestHeader) MarshalHash() (o []byte, err error)
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
 	// map header, size 2
-	// map header, size 1
-	o = append(o, 0x82, 0x82, 0x81, 0x81)
+	// map header, size 2
+	o = append(o, 0x82, 0x82, 0x82, 0x82)
+	if z.CreateDatabaseRequestHeader.OwnerPolicy == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.CreateDatabaseRequestHeader.OwnerPolicy.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
+	o = append(o, 0x82)
 	if oTemp, err := z.CreateDatabaseRequestHeader.ResourceMeta.MarshalHash(); err != nil {
 		return nil, err
 	} else {
@@ -314,7 +372,13 @@ func (z *SignedCreateDatabaseRequestHeader) MarshalHash() (o []byte, err error)
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *SignedCreateDatabaseRequestHeader) Msgsize() (s int) {
-	s = 1 + 28 + 1 + 13 + z.CreateDatabaseRequestHeader.ResourceMeta.Msgsize() + 28 + z.DefaultHashSignVerifierImpl.Msgsize()
+	s = 1 + 28 + 1 + 12
+	if z.CreateDatabaseRequestHeader.OwnerPolicy == nil {
+		s += hsp.NilSize
+	} else {
+		s += z.CreateDatabaseRequestHeader.OwnerPolicy.Msgsize()
+	}
+	s += 13 + z.CreateDatabaseRequestHeader.ResourceMeta.Msgsize() + 28 + z.DefaultHashSignVerifierImpl.Msgsize()
 	return
 }
 
@@ -349,15 +413,25 @@ func (z *SignedCreateDatabaseResponseHeader) Msgsize() (s int) {
 func (z *SignedDropDatabaseRequestHeader) MarshalHash() (o []byte, err error) {
 	var b []byte
 	o = hsp.Require(b, z.Msgsize())
-	// map header, size 2
+	// map header, size 3
+	o = append(o, 0x83, 0x83)
+	if z.MultiSig == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if oTemp, err := z.MultiSig.MarshalHash(); err != nil {
+			return nil, err
+		} else {
+			o = hsp.AppendBytes(o, oTemp)
+		}
+	}
 	// map header, size 1
-	o = append(o, 0x82, 0x82, 0x81, 0x81)
+	o = append(o, 0x83, 0x81, 0x81)
 	if oTemp, err := z.DropDatabaseRequestHeader.DatabaseID.MarshalHash(); err != nil {
 		return nil, err
 	} else {
 		o = hsp.AppendBytes(o, oTemp)
 	}
-	o = append(o, 0x82)
+	o = append(o, 0x83)
 	if oTemp, err := z.DefaultHashSignVerifierImpl.MarshalHash(); err != nil {
 		return nil, err
 	} else {
@@ -368,7 +442,13 @@ func (z *SignedDropDatabaseRequestHeader) MarshalHash() (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *SignedDropDatabaseRequestHeader) Msgsize() (s int) {
-	s = 1 + 26 + 1 + 11 + z.DropDatabaseRequestHeader.DatabaseID.Msgsize() + 28 + z.DefaultHashSignVerifierImpl.Msgsize()
+	s = 1 + 9
+	if z.MultiSig == nil {
+		s += hsp.NilSize
+	} else {
+		s += z.MultiSig.Msgsize()
+	}
+	s += 26 + 1 + 11 + z.DropDatabaseRequestHeader.DatabaseID.Msgsize() + 28 + z.DefaultHashSignVerifierImpl.Msgsize()
 	return
 }
 
@@ -44,6 +44,9 @@ type ServiceInstance struct {
 	Peers        *proto.Peers
 	ResourceMeta ResourceMeta
 	GenesisBlock *Block
+	// Owner is the account which created the database, it's kept out of the hash for
+	// compatibility with the instances signed before ownership was recorded.
+	Owner proto.AccountAddress `hspack:"-"`
 }
 
 // InitServiceResponseHeader defines worker service init response header.
@@ -68,7 +71,7 @@ func (sh *SignedInitServiceResponseHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedInitServiceResponseHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedInitServiceResponseHeader) Sign(signer asymmetric.Signer) (err error) {
 	return sh.DefaultHashSignVerifierImpl.Sign(&sh.InitServiceResponseHeader, signer)
 }
 
@@ -78,7 +81,7 @@ func (rs *InitServiceResponse) Verify() error {
 }
 
 // Sign the request.
-func (rs *InitServiceResponse) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (rs *InitServiceResponse) Sign(signer asymmetric.Signer) (err error) {
 	// sign
 	return rs.Header.Sign(signer)
 }
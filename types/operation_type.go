@@ -0,0 +1,142 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+// OperationType defines the type of a database peers operation.
+type OperationType int
+
+const (
+	// OperationRepair replaces the dead peers of a database.
+	OperationRepair OperationType = iota
+	// OperationUpdate changes the resource requirement or the peers of a database.
+	OperationUpdate
+)
+
+func (t OperationType) String() string {
+	switch t {
+	case OperationRepair:
+		return "Repair"
+	case OperationUpdate:
+		return "Update"
+	default:
+		return "Unknown"
+	}
+}
+
+// OperationState defines the state of a database peers operation.
+type OperationState int
+
+const (
+	// OperationAllocating indicates the new peers are being allocated.
+	OperationAllocating OperationState = iota
+	// OperationDeploying indicates the database is being deployed to the new peers.
+	OperationDeploying
+	// OperationUpdating indicates the existing peers are being updated to the new peers.
+	OperationUpdating
+	// OperationSyncing indicates the new peers are syncing state from the existing peers.
+	OperationSyncing
+	// OperationDraining indicates the removed peers are being dropped from the database.
+	OperationDraining
+	// OperationDone indicates the operation is finished.
+	OperationDone
+	// OperationFailed indicates the operation failed.
+	OperationFailed
+)
+
+func (s OperationState) String() string {
+	switch s {
+	case OperationAllocating:
+		return "Allocating"
+	case OperationDeploying:
+		return "Deploying"
+	case OperationUpdating:
+		return "Updating"
+	case OperationSyncing:
+		return "Syncing"
+	case OperationDraining:
+		return "Draining"
+	case OperationDone:
+		return "Done"
+	case OperationFailed:
+		return "Failed"
+	default:
+		return "Unknown"
+	}
+}
+
+// ReplicaProgress defines the state sync progress of a new peer.
+type ReplicaProgress struct {
+	NodeID proto.NodeID
+	Synced bool
+	// Index is the next kayak log index to replay.
+	Index uint64
+}
+
+// DatabaseOperation defines the progress of an operation changing the peers of a database.
+type DatabaseOperation struct {
+	DatabaseID proto.DatabaseID
+	Type       OperationType
+	DeadNodes  []proto.NodeID
+	NewNodes   []ReplicaProgress
+	DrainNodes []proto.NodeID
+	Term       uint64
+	State      OperationState
+	Error      string
+	StartTime  time.Time
+	UpdateTime time.Time
+}
+
+// DatabaseOperationsRequest defines the database operations request, operations of all the
+// databases are returned if DatabaseID is empty.
+type DatabaseOperationsRequest struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+}
+
+// DatabaseOperationsResponse defines the database operations response.
+type DatabaseOperationsResponse struct {
+	proto.Envelope
+	DeadNodes  []proto.NodeID
+	Operations []DatabaseOperation
+}
+
+// UpdateDatabaseResponse defines client update database rpc response entity.
+type UpdateDatabaseResponse struct {
+	proto.Envelope
+	Operation DatabaseOperation
+}
+
+// SyncStatusRequest defines the state sync status request of a database replica.
+type SyncStatusRequest struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+}
+
+// SyncStatusResponse defines the state sync status response of a database replica.
+type SyncStatusResponse struct {
+	proto.Envelope
+	Syncing bool
+	// Index is the next kayak log index to replay.
+	Index uint64
+	Error string
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+// NodeResource defines the resources of a miner considered by the database placement.
+type NodeResource struct {
+	NodeID proto.NodeID
+	// Host is the anti-affinity key of the miner, replicas of a database are never placed on
+	// miners of the same key unless anti-affinity is disabled.
+	Host           string
+	FreeMemory     uint64
+	AvailSpace     uint64
+	ReservedMemory uint64
+	ReservedSpace  uint64
+	LoadAvgPerCPU  float64
+	Databases      int
+	// Reason is why the miner can't serve the database, empty if it's eligible.
+	Reason string
+}
+
+// PlanDatabaseRequest defines the dry run database placement request for capacity planning.
+type PlanDatabaseRequest struct {
+	proto.Envelope
+	ResourceMeta ResourceMeta
+}
+
+// PlanDatabaseResponse defines the dry run database placement response, Nodes is empty if
+// the database can't be placed.
+type PlanDatabaseResponse struct {
+	proto.Envelope
+	Nodes      []proto.NodeID
+	Candidates []NodeResource
+}
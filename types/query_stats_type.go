@@ -0,0 +1,57 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+// QueryStat defines the execution statistics of a normalized query pattern.
+type QueryStat struct {
+	// Fingerprint is the query with literals and arguments replaced by "?".
+	Fingerprint  string
+	Count        uint64
+	Errors       uint64
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+	RowsRead     uint64
+	RowsWritten  uint64
+	LastSeen     time.Time
+}
+
+// AvgLatency returns the average latency of the query pattern.
+func (s *QueryStat) AvgLatency() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Count)
+}
+
+// QueryStatsRequest defines the query statistics request of a database replica.
+type QueryStatsRequest struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+}
+
+// QueryStatsResponse defines the query statistics response of a database replica, the
+// statistics are sorted by total latency in descending order.
+type QueryStatsResponse struct {
+	proto.Envelope
+	Stats []QueryStat
+}
@@ -0,0 +1,348 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/hash"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	hsp "github.com/CovenantSQL/HashStablePack/marshalhash"
+	"github.com/pkg/errors"
+)
+
+// MarshalMsg and UnmarshalMsg implement the zero-reflection encoding of the hot RPC types,
+// used by the hsp RPC codec instead of the reflection based msgpack.
+
+// MarshalMsg implements hsp.Marshaler.
+func (z *Request) MarshalMsg(b []byte) (o []byte, err error) {
+	o = appendEnvelope(b, &z.Envelope)
+	if o, err = appendSignedRequestHeader(o, &z.Header); err != nil {
+		return
+	}
+	o = hsp.AppendArrayHeader(o, uint32(len(z.Payload.Queries)))
+	for i := range z.Payload.Queries {
+		q := &z.Payload.Queries[i]
+		o = hsp.AppendString(o, q.Pattern)
+		o = hsp.AppendArrayHeader(o, uint32(len(q.Args)))
+		for j := range q.Args {
+			o = hsp.AppendString(o, q.Args[j].Name)
+			if o, err = hsp.AppendIntf(o, q.Args[j].Value); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements hsp.Unmarshaler.
+func (z *Request) UnmarshalMsg(b []byte) (o []byte, err error) {
+	if o, err = readEnvelope(b, &z.Envelope); err != nil {
+		return
+	}
+	if o, err = readSignedRequestHeader(o, &z.Header); err != nil {
+		return
+	}
+	var sz uint32
+	if sz, o, err = hsp.ReadArrayHeaderBytes(o); err != nil {
+		return
+	}
+	z.Payload.Queries = make([]Query, sz)
+	for i := range z.Payload.Queries {
+		q := &z.Payload.Queries[i]
+		if q.Pattern, o, err = hsp.ReadStringBytes(o); err != nil {
+			return
+		}
+		if sz, o, err = hsp.ReadArrayHeaderBytes(o); err != nil {
+			return
+		}
+		q.Args = make([]NamedArg, sz)
+		for j := range q.Args {
+			if q.Args[j].Name, o, err = hsp.ReadStringBytes(o); err != nil {
+				return
+			}
+			if q.Args[j].Value, o, err = hsp.ReadIntfBytes(o); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// MarshalMsg implements hsp.Marshaler.
+func (z *Response) MarshalMsg(b []byte) (o []byte, err error) {
+	h := &z.Header.ResponseHeader
+	if o, err = appendSignedRequestHeader(b, &h.Request); err != nil {
+		return
+	}
+	o = hsp.AppendString(o, string(h.NodeID))
+	o = hsp.AppendTime(o, h.Timestamp)
+	o = hsp.AppendUint64(o, h.RowCount)
+	o = hsp.AppendUint64(o, h.LogOffset)
+	o = hsp.AppendInt64(o, h.LastInsertID)
+	o = hsp.AppendInt64(o, h.AffectedRows)
+	o = hsp.AppendBytes(o, h.PayloadHash[:])
+	if o, err = appendVerifier(o, &z.Header.DefaultHashSignVerifierImpl); err != nil {
+		return
+	}
+
+	p := &z.Payload
+	o = appendStrings(o, p.Columns)
+	o = appendStrings(o, p.DeclTypes)
+	o = hsp.AppendArrayHeader(o, uint32(len(p.Rows)))
+	for i := range p.Rows {
+		o = hsp.AppendArrayHeader(o, uint32(len(p.Rows[i].Values)))
+		for _, v := range p.Rows[i].Values {
+			if o, err = hsp.AppendIntf(o, v); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// UnmarshalMsg implements hsp.Unmarshaler.
+func (z *Response) UnmarshalMsg(b []byte) (o []byte, err error) {
+	h := &z.Header.ResponseHeader
+	if o, err = readSignedRequestHeader(b, &h.Request); err != nil {
+		return
+	}
+	var s string
+	if s, o, err = hsp.ReadStringBytes(o); err != nil {
+		return
+	}
+	h.NodeID = proto.NodeID(s)
+	if h.Timestamp, o, err = readTime(o); err != nil {
+		return
+	}
+	if h.RowCount, o, err = hsp.ReadUint64Bytes(o); err != nil {
+		return
+	}
+	if h.LogOffset, o, err = hsp.ReadUint64Bytes(o); err != nil {
+		return
+	}
+	if h.LastInsertID, o, err = hsp.ReadInt64Bytes(o); err != nil {
+		return
+	}
+	if h.AffectedRows, o, err = hsp.ReadInt64Bytes(o); err != nil {
+		return
+	}
+	if o, err = readHash(o, &h.PayloadHash); err != nil {
+		return
+	}
+	if o, err = readVerifier(o, &z.Header.DefaultHashSignVerifierImpl); err != nil {
+		return
+	}
+
+	p := &z.Payload
+	if p.Columns, o, err = readStrings(o); err != nil {
+		return
+	}
+	if p.DeclTypes, o, err = readStrings(o); err != nil {
+		return
+	}
+	var sz uint32
+	if sz, o, err = hsp.ReadArrayHeaderBytes(o); err != nil {
+		return
+	}
+	p.Rows = make([]ResponseRow, sz)
+	for i := range p.Rows {
+		if sz, o, err = hsp.ReadArrayHeaderBytes(o); err != nil {
+			return
+		}
+		p.Rows[i].Values = make([]interface{}, sz)
+		for j := range p.Rows[i].Values {
+			if p.Rows[i].Values[j], o, err = hsp.ReadIntfBytes(o); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func appendEnvelope(b []byte, e *proto.Envelope) (o []byte) {
+	// NodeID is always set by the receiver from the connection.
+	o = hsp.AppendString(b, e.Version)
+	o = hsp.AppendInt64(o, int64(e.TTL))
+	o = hsp.AppendInt64(o, int64(e.Expire))
+	o = hsp.AppendString(o, e.TraceID)
+	o = hsp.AppendString(o, e.SpanID)
+	return
+}
+
+func readEnvelope(b []byte, e *proto.Envelope) (o []byte, err error) {
+	var v int64
+	if e.Version, o, err = hsp.ReadStringBytes(b); err != nil {
+		return
+	}
+	if v, o, err = hsp.ReadInt64Bytes(o); err != nil {
+		return
+	}
+	e.TTL = time.Duration(v)
+	if v, o, err = hsp.ReadInt64Bytes(o); err != nil {
+		return
+	}
+	e.Expire = time.Duration(v)
+	if e.TraceID, o, err = hsp.ReadStringBytes(o); err != nil {
+		return
+	}
+	e.SpanID, o, err = hsp.ReadStringBytes(o)
+	return
+}
+
+func appendSignedRequestHeader(b []byte, h *SignedRequestHeader) (o []byte, err error) {
+	o = hsp.AppendInt32(b, int32(h.QueryType))
+	o = hsp.AppendString(o, string(h.NodeID))
+	o = hsp.AppendString(o, string(h.DatabaseID))
+	o = hsp.AppendUint64(o, h.ConnectionID)
+	o = hsp.AppendUint64(o, h.SeqNo)
+	o = hsp.AppendTime(o, h.Timestamp)
+	o = hsp.AppendUint64(o, h.BatchCount)
+	o = hsp.AppendBytes(o, h.QueriesHash[:])
+	return appendVerifier(o, &h.DefaultHashSignVerifierImpl)
+}
+
+func readSignedRequestHeader(b []byte, h *SignedRequestHeader) (o []byte, err error) {
+	var (
+		qt int32
+		s  string
+	)
+	if qt, o, err = hsp.ReadInt32Bytes(b); err != nil {
+		return
+	}
+	h.QueryType = QueryType(qt)
+	if s, o, err = hsp.ReadStringBytes(o); err != nil {
+		return
+	}
+	h.NodeID = proto.NodeID(s)
+	if s, o, err = hsp.ReadStringBytes(o); err != nil {
+		return
+	}
+	h.DatabaseID = proto.DatabaseID(s)
+	if h.ConnectionID, o, err = hsp.ReadUint64Bytes(o); err != nil {
+		return
+	}
+	if h.SeqNo, o, err = hsp.ReadUint64Bytes(o); err != nil {
+		return
+	}
+	if h.Timestamp, o, err = readTime(o); err != nil {
+		return
+	}
+	if h.BatchCount, o, err = hsp.ReadUint64Bytes(o); err != nil {
+		return
+	}
+	if o, err = readHash(o, &h.QueriesHash); err != nil {
+		return
+	}
+	return readVerifier(o, &h.DefaultHashSignVerifierImpl)
+}
+
+func appendVerifier(b []byte, v *verifier.DefaultHashSignVerifierImpl) (o []byte, err error) {
+	var data []byte
+	o = hsp.AppendBytes(b, v.DataHash[:])
+	if v.Signee == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if data, err = v.Signee.MarshalBinary(); err != nil {
+			return
+		}
+		o = hsp.AppendBytes(o, data)
+	}
+	if v.Signature == nil {
+		o = hsp.AppendNil(o)
+	} else {
+		if data, err = v.Signature.MarshalBinary(); err != nil {
+			return
+		}
+		o = hsp.AppendBytes(o, data)
+	}
+	return
+}
+
+func readVerifier(b []byte, v *verifier.DefaultHashSignVerifierImpl) (o []byte, err error) {
+	var data []byte
+	if o, err = readHash(b, &v.DataHash); err != nil {
+		return
+	}
+	v.Signee, v.Signature = nil, nil
+	if hsp.NextType(o) == hsp.NilType {
+		o, err = hsp.ReadNilBytes(o)
+	} else if data, o, err = hsp.ReadBytesZC(o); err == nil {
+		v.Signee = new(asymmetric.PublicKey)
+		err = v.Signee.UnmarshalBinary(data)
+	}
+	if err != nil {
+		return
+	}
+	if hsp.NextType(o) == hsp.NilType {
+		o, err = hsp.ReadNilBytes(o)
+	} else if data, o, err = hsp.ReadBytesZC(o); err == nil {
+		v.Signature = new(asymmetric.Signature)
+		err = v.Signature.UnmarshalBinary(data)
+	}
+	return
+}
+
+func readTime(b []byte) (t time.Time, o []byte, err error) {
+	// zero times are encoded as nil
+	if hsp.NextType(b) == hsp.NilType {
+		o, err = hsp.ReadNilBytes(b)
+		return
+	}
+	if t, o, err = hsp.ReadTimeBytes(b); err != nil {
+		return
+	}
+	t = t.UTC()
+	return
+}
+
+func readHash(b []byte, h *hash.Hash) (o []byte, err error) {
+	var data []byte
+	if data, o, err = hsp.ReadBytesZC(b); err != nil {
+		return
+	}
+	if len(data) != hash.HashSize {
+		err = errors.Errorf("invalid hash length %d", len(data))
+		return
+	}
+	copy(h[:], data)
+	return
+}
+
+func appendStrings(b []byte, ss []string) (o []byte) {
+	o = hsp.AppendArrayHeader(b, uint32(len(ss)))
+	for _, s := range ss {
+		o = hsp.AppendString(o, s)
+	}
+	return
+}
+
+func readStrings(b []byte) (ss []string, o []byte, err error) {
+	var sz uint32
+	if sz, o, err = hsp.ReadArrayHeaderBytes(b); err != nil {
+		return
+	}
+	ss = make([]string, sz)
+	for i := range ss {
+		if ss[i], o, err = hsp.ReadStringBytes(o); err != nil {
+			return
+		}
+	}
+	return
+}
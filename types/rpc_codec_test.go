@@ -0,0 +1,191 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func buildCodecRequest(queries int) (req *Request) {
+	req = &Request{
+		Envelope: proto.Envelope{
+			Version: "v1",
+			Expire:  time.Second,
+			TraceID: "0123456789abcdef0123456789abcdef",
+			SpanID:  "0123456789abcdef",
+		},
+		Header: SignedRequestHeader{
+			RequestHeader: RequestHeader{
+				QueryType:    WriteQuery,
+				NodeID:       proto.NodeID("0000000000000000000000000000000000000000000000000000000000000000"),
+				DatabaseID:   proto.DatabaseID("db1"),
+				ConnectionID: uint64(1),
+				SeqNo:        uint64(2),
+				Timestamp:    time.Now().UTC(),
+			},
+		},
+	}
+	for i := 0; i < queries; i++ {
+		req.Payload.Queries = append(req.Payload.Queries, Query{
+			Pattern: "INSERT INTO test VALUES(?, ?)",
+			Args: []NamedArg{
+				{Name: "a", Value: int64(i)},
+				{Name: "b", Value: fmt.Sprintf("value %d", i)},
+			},
+		})
+	}
+	return
+}
+
+func buildCodecResponse(rows int) (res *Response) {
+	res = &Response{
+		Header: SignedResponseHeader{
+			ResponseHeader: ResponseHeader{
+				Request:      buildCodecRequest(1).Header,
+				NodeID:       proto.NodeID("0000000000000000000000000000000000000000000000000000000000000000"),
+				Timestamp:    time.Now().UTC(),
+				RowCount:     uint64(rows),
+				LogOffset:    1,
+				LastInsertID: 2,
+				AffectedRows: 3,
+			},
+		},
+		Payload: ResponsePayload{
+			Columns:   []string{"id", "name", "data"},
+			DeclTypes: []string{"INTEGER", "TEXT", "BLOB"},
+		},
+	}
+	for i := 0; i < rows; i++ {
+		res.Payload.Rows = append(res.Payload.Rows, ResponseRow{
+			Values: []interface{}{int64(i), fmt.Sprintf("name %d", i), []byte("data")},
+		})
+	}
+	return
+}
+
+func TestRPCCodec(t *testing.T) {
+	privKey, _ := getCommKeys()
+
+	Convey("request should survive hsp encoding", t, func() {
+		req := buildCodecRequest(2)
+		So(req.Sign(privKey), ShouldBeNil)
+
+		buf, err := req.MarshalMsg(nil)
+		So(err, ShouldBeNil)
+		decoded := &Request{}
+		rest, err := decoded.UnmarshalMsg(buf)
+		So(err, ShouldBeNil)
+		So(rest, ShouldBeEmpty)
+		So(decoded.Verify(), ShouldBeNil)
+		So(decoded.GetVersion(), ShouldEqual, "v1")
+		So(decoded.GetExpire(), ShouldEqual, time.Second)
+		So(decoded.GetTraceID(), ShouldEqual, req.GetTraceID())
+		So(decoded.GetSpanID(), ShouldEqual, req.GetSpanID())
+		So(decoded.Header.Timestamp, ShouldResemble, req.Header.Timestamp)
+		So(decoded.Payload.Queries, ShouldHaveLength, 2)
+		So(decoded.Payload.Queries[1].Args[0].Value, ShouldEqual, int64(1))
+		So(decoded.Payload.Queries[1].Args[1].Value, ShouldEqual, "value 1")
+
+		// truncated input
+		_, err = (&Request{}).UnmarshalMsg(buf[:len(buf)/2])
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("response should survive hsp encoding", t, func() {
+		res := buildCodecResponse(3)
+		So(res.Header.Request.Sign(privKey), ShouldBeNil)
+		So(res.Header.Sign(privKey), ShouldBeNil)
+
+		buf, err := res.MarshalMsg(nil)
+		So(err, ShouldBeNil)
+		decoded := &Response{}
+		rest, err := decoded.UnmarshalMsg(buf)
+		So(err, ShouldBeNil)
+		So(rest, ShouldBeEmpty)
+		So(decoded.Header.Verify(), ShouldBeNil)
+		So(decoded.Payload.Columns, ShouldResemble, res.Payload.Columns)
+		So(decoded.Payload.DeclTypes, ShouldResemble, res.Payload.DeclTypes)
+		So(decoded.Payload.Rows, ShouldHaveLength, 3)
+		So(decoded.Payload.Rows[2].Values[0], ShouldEqual, int64(2))
+		So(decoded.Payload.Rows[2].Values[2], ShouldResemble, []byte("data"))
+
+		// unsigned response
+		res = buildCodecResponse(0)
+		buf, err = res.MarshalMsg(nil)
+		So(err, ShouldBeNil)
+		decoded = &Response{}
+		_, err = decoded.UnmarshalMsg(buf)
+		So(err, ShouldBeNil)
+		So(decoded.Header.Signee, ShouldBeNil)
+		So(decoded.Header.Signature, ShouldBeNil)
+
+		// zero timestamps
+		res.Header.Timestamp = time.Time{}
+		res.Header.Request.Timestamp = time.Time{}
+		buf, err = res.MarshalMsg(nil)
+		So(err, ShouldBeNil)
+		decoded = &Response{}
+		_, err = decoded.UnmarshalMsg(buf)
+		So(err, ShouldBeNil)
+		So(decoded.Header.Timestamp.IsZero(), ShouldBeTrue)
+		So(decoded.Header.Request.Timestamp.IsZero(), ShouldBeTrue)
+	})
+}
+
+func BenchmarkRPCCodecMsgPack(b *testing.B) {
+	privKey, _ := getCommKeys()
+	res := buildCodecResponse(1000)
+	res.Header.Request.Sign(privKey)
+	res.Header.Sign(privKey)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, err := utils.EncodeMsgPack(res)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var decoded Response
+		if err = utils.DecodeMsgPack(buf.Bytes(), &decoded); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRPCCodecHSP(b *testing.B) {
+	privKey, _ := getCommKeys()
+	res := buildCodecResponse(1000)
+	res.Header.Request.Sign(privKey)
+	res.Header.Sign(privKey)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, err := res.MarshalMsg(nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var decoded Response
+		if _, err = decoded.UnmarshalMsg(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
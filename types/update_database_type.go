@@ -0,0 +1,66 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/CovenantSQL/CovenantSQL/crypto/asymmetric"
+	"github.com/CovenantSQL/CovenantSQL/crypto/verifier"
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+//go:generate hsp
+
+// UpdateDatabaseRequestHeader defines client update database rpc request header.
+type UpdateDatabaseRequestHeader struct {
+	DatabaseID proto.DatabaseID
+	// ResourceMeta is the new resource requirement, Node is the new peers count.
+	ResourceMeta ResourceMeta
+	// DrainNodes are the peers to move the database off.
+	DrainNodes []proto.NodeID
+}
+
+// SignedUpdateDatabaseRequestHeader defines signed client update database rpc request header.
+type SignedUpdateDatabaseRequestHeader struct {
+	UpdateDatabaseRequestHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Verify checks hash and signature in request header.
+func (sh *SignedUpdateDatabaseRequestHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.UpdateDatabaseRequestHeader)
+}
+
+// Sign the request.
+func (sh *SignedUpdateDatabaseRequestHeader) Sign(signer asymmetric.Signer) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.UpdateDatabaseRequestHeader, signer)
+}
+
+// UpdateDatabaseRequest defines client update database rpc request entity.
+type UpdateDatabaseRequest struct {
+	proto.Envelope
+	Header SignedUpdateDatabaseRequestHeader
+}
+
+// Verify checks hash and signature in request header.
+func (r *UpdateDatabaseRequest) Verify() error {
+	return r.Header.Verify()
+}
+
+// Sign the request.
+func (r *UpdateDatabaseRequest) Sign(signer asymmetric.Signer) error {
+	return r.Header.Sign(signer)
+}
@@ -34,6 +34,9 @@ const (
 	UpdateDB
 	// DropDB indicates drop database operation.
 	DropDB
+	// ReplicateDB indicates database replica creation on a new peer, the new peer syncs
+	// database state from the existing peers.
+	ReplicateDB
 )
 
 // UpdateServiceHeader defines service update header.
@@ -63,7 +66,7 @@ func (sh *SignedUpdateServiceHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedUpdateServiceHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedUpdateServiceHeader) Sign(signer asymmetric.Signer) (err error) {
 	return sh.DefaultHashSignVerifierImpl.Sign(&sh.UpdateServiceHeader, signer)
 }
 
@@ -73,7 +76,7 @@ func (s *UpdateService) Verify() error {
 }
 
 // Sign the request.
-func (s *UpdateService) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (s *UpdateService) Sign(signer asymmetric.Signer) (err error) {
 	// sign
 	return s.Header.Sign(signer)
 }
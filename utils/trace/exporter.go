@@ -0,0 +1,264 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultCollectorTimeout defines the timeout of exporting a batch to the collector.
+	DefaultCollectorTimeout = 5 * time.Second
+
+	// otlp span kind internal and status code error.
+	otlpSpanKindInternal = 1
+	otlpStatusCodeError  = 2
+	otlpScopeName        = "github.com/CovenantSQL/CovenantSQL"
+)
+
+// SpanData defines the finished span to export.
+type SpanData struct {
+	Name         string
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	Error        string
+}
+
+// Exporter defines the exporter of the finished spans.
+type Exporter interface {
+	ExportSpans(spans []*SpanData) error
+	Close() error
+}
+
+// FileExporter defines the exporter which appends the spans to a local file, each batch is
+// written as a line of otlp json.
+type FileExporter struct {
+	sync.Mutex
+	service string
+	file    *os.File
+}
+
+// NewFileExporter returns a new FileExporter appending to the file at path.
+func NewFileExporter(service, path string) (e *FileExporter, err error) {
+	var f *os.File
+	if f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		err = errors.Wrap(err, "open trace file failed")
+		return
+	}
+	e = &FileExporter{
+		service: service,
+		file:    f,
+	}
+	return
+}
+
+// ExportSpans implements Exporter.ExportSpans.
+func (e *FileExporter) ExportSpans(spans []*SpanData) (err error) {
+	var buf []byte
+	if buf, err = encodeOTLP(e.service, spans); err != nil {
+		return
+	}
+	e.Lock()
+	defer e.Unlock()
+	_, err = e.file.Write(append(buf, '\n'))
+	return
+}
+
+// Close implements Exporter.Close.
+func (e *FileExporter) Close() error {
+	e.Lock()
+	defer e.Unlock()
+	return e.file.Close()
+}
+
+// CollectorExporter defines the exporter which posts the spans to an otlp/http collector
+// endpoint such as http://127.0.0.1:4318/v1/traces.
+type CollectorExporter struct {
+	service  string
+	endpoint string
+	client   *http.Client
+}
+
+// NewCollectorExporter returns a new CollectorExporter posting to the endpoint.
+func NewCollectorExporter(service, endpoint string) *CollectorExporter {
+	return &CollectorExporter{
+		service:  service,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: DefaultCollectorTimeout},
+	}
+}
+
+// ExportSpans implements Exporter.ExportSpans.
+func (e *CollectorExporter) ExportSpans(spans []*SpanData) (err error) {
+	var buf []byte
+	if buf, err = encodeOTLP(e.service, spans); err != nil {
+		return
+	}
+	var resp *http.Response
+	if resp, err = e.client.Post(e.endpoint, "application/json", bytes.NewReader(buf)); err != nil {
+		err = errors.Wrap(err, "post spans to collector failed")
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err = errors.Errorf("collector responded with status %s", resp.Status)
+	}
+	return
+}
+
+// Close implements Exporter.Close.
+func (e *CollectorExporter) Close() error {
+	return nil
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func newOTLPKeyValue(key string, value interface{}) (kv otlpKeyValue) {
+	kv.Key = key
+	var str string
+	switch v := value.(type) {
+	case string:
+		str = v
+	case fmt.Stringer:
+		str = v.String()
+	case bool:
+		kv.Value.BoolValue = &v
+		return
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		// otlp json encodes 64 bits integers as strings
+		str = fmt.Sprint(v)
+		kv.Value.IntValue = &str
+		return
+	case float32:
+		f := float64(v)
+		kv.Value.DoubleValue = &f
+		return
+	case float64:
+		kv.Value.DoubleValue = &v
+		return
+	default:
+		str = fmt.Sprint(v)
+	}
+	kv.Value.StringValue = &str
+	return
+}
+
+func encodeOTLP(service string, spans []*SpanData) ([]byte, error) {
+	ss := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		ss[i] = otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		}
+		if s.ParentSpanID.IsValid() {
+			ss[i].ParentSpanID = s.ParentSpanID.String()
+		}
+		keys := make([]string, 0, len(s.Attributes))
+		for k := range s.Attributes {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ss[i].Attributes = append(ss[i].Attributes, newOTLPKeyValue(k, s.Attributes[k]))
+		}
+		if s.Error != "" {
+			ss[i].Status = otlpStatus{Code: otlpStatusCodeError, Message: s.Error}
+		}
+	}
+	return json.Marshal(&otlpTraces{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: []otlpKeyValue{newOTLPKeyValue("service.name", service)},
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{Name: otlpScopeName},
+						Spans: ss,
+					},
+				},
+			},
+		},
+	})
+}
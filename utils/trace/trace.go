@@ -0,0 +1,292 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package trace provides the distributed tracing of CovenantSQL, the trace and span ids are
+// compatible with the w3c trace context and opentelemetry, spans are exported in the otlp json
+// format to a local file or a collector endpoint.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+)
+
+var (
+	// ErrInvalidTraceID indicates the trace id is not a 32 characters hex string.
+	ErrInvalidTraceID = errors.New("invalid trace id")
+	// ErrInvalidSpanID indicates the span id is not a 16 characters hex string.
+	ErrInvalidSpanID = errors.New("invalid span id")
+)
+
+// TraceID defines the 16 bytes id shared by the spans of a trace.
+type TraceID [16]byte
+
+// String returns the hex string of the trace id.
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid returns whether the trace id is not all zero.
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// ParseTraceID parses the trace id from hex string.
+func ParseTraceID(s string) (t TraceID, err error) {
+	if len(s) != hex.EncodedLen(len(t)) {
+		err = ErrInvalidTraceID
+		return
+	}
+	if _, err = hex.Decode(t[:], []byte(s)); err != nil || !t.IsValid() {
+		t, err = TraceID{}, ErrInvalidTraceID
+	}
+	return
+}
+
+// SpanID defines the 8 bytes id of a span.
+type SpanID [8]byte
+
+// String returns the hex string of the span id.
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid returns whether the span id is not all zero.
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// ParseSpanID parses the span id from hex string.
+func ParseSpanID(str string) (s SpanID, err error) {
+	if len(str) != hex.EncodedLen(len(s)) {
+		err = ErrInvalidSpanID
+		return
+	}
+	if _, err = hex.Decode(s[:], []byte(str)); err != nil || !s.IsValid() {
+		s, err = SpanID{}, ErrInvalidSpanID
+	}
+	return
+}
+
+// sampling defines whether the spans continuing a span context are recorded.
+type sampling int
+
+const (
+	// sampled spans are recorded.
+	sampled sampling = iota
+	// sampleLocally is decided by the local sampler on the first span, for span contexts of
+	// untrusted callers.
+	sampleLocally
+	// notSampled span contexts only propagate the ids to the callees.
+	notSampled
+)
+
+// SpanContext defines the identity of a span propagated in context and across processes.
+type SpanContext struct {
+	TraceID  TraceID
+	SpanID   SpanID
+	sampling sampling
+}
+
+// IsValid returns whether the span context has both valid trace id and span id.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+type spanContextKey struct{}
+
+// SpanContextFromContext returns the span context carried by ctx.
+func SpanContextFromContext(ctx context.Context) (sc SpanContext) {
+	if ctx == nil {
+		return
+	}
+	sc, _ = ctx.Value(spanContextKey{}).(SpanContext)
+	return
+}
+
+// ContextWithSpanContext returns a copy of ctx carrying the span context.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// Detach returns a background context carrying the span context of ctx only, the spans
+// started with it continue the trace but are never canceled with ctx.
+func Detach(ctx context.Context) context.Context {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		return ContextWithSpanContext(context.Background(), sc)
+	}
+	return context.Background()
+}
+
+// Inject sets the span context of ctx to the rpc envelope.
+func Inject(ctx context.Context, e proto.EnvelopeAPI) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		e.SetTraceID(sc.TraceID.String())
+		e.SetSpanID(sc.SpanID.String())
+	}
+}
+
+// Extract returns a copy of ctx carrying the remote span context set in the rpc envelope,
+// ctx is returned as is if the envelope carries no valid span context. The spans continuing
+// it are always sampled.
+func Extract(ctx context.Context, e proto.EnvelopeAPI) context.Context {
+	return extract(ctx, e, sampled)
+}
+
+// ExtractUntrusted is like Extract, but the sampling of the spans continuing the remote span
+// context is decided by the local sampler, so the caller can't force the sampling of the
+// calls. The remote ids are propagated even if not sampled.
+func ExtractUntrusted(ctx context.Context, e proto.EnvelopeAPI) context.Context {
+	return extract(ctx, e, sampleLocally)
+}
+
+func extract(ctx context.Context, e proto.EnvelopeAPI, sm sampling) context.Context {
+	var (
+		sc  = SpanContext{sampling: sm}
+		err error
+	)
+	if sc.TraceID, err = ParseTraceID(e.GetTraceID()); err != nil {
+		return ctx
+	}
+	if sc.SpanID, err = ParseSpanID(e.GetSpanID()); err != nil {
+		return ctx
+	}
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// Span defines a timed operation of a trace, all the methods are safe to call on a nil span
+// which is returned when the trace is not sampled.
+type Span struct {
+	sync.Mutex
+	sc     SpanContext
+	parent SpanID
+	name   string
+	start  time.Time
+	attrs  map[string]interface{}
+	ended  bool
+}
+
+// StartSpan starts a span named name as a child of the span context carried by ctx, a new
+// trace is started if ctx carries none and the root span is sampled by the tracer. The child
+// of an untrusted remote span context is sampled like a root span, the decision is kept in
+// the returned context.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+	if parent.IsValid() {
+		switch parent.sampling {
+		case sampleLocally:
+			if !sampleRoot() {
+				parent.sampling = notSampled
+				return ContextWithSpanContext(ctx, parent), nil
+			}
+		case notSampled:
+			return ctx, nil
+		}
+	}
+	s := &Span{
+		sc:     SpanContext{TraceID: parent.TraceID},
+		parent: parent.SpanID,
+		name:   name,
+		start:  time.Now(),
+	}
+	if !parent.IsValid() {
+		if !sampleRoot() {
+			return ctx, nil
+		}
+		s.sc.TraceID = newTraceID()
+		s.parent = SpanID{}
+	}
+	s.sc.SpanID = newSpanID()
+	return ContextWithSpanContext(ctx, s.sc), s
+}
+
+// StartChildSpan starts a span named name only if ctx carries a span context, it never
+// starts a new trace.
+func StartChildSpan(ctx context.Context, name string) (context.Context, *Span) {
+	if !SpanContextFromContext(ctx).IsValid() {
+		return ctx, nil
+	}
+	return StartSpan(ctx, name)
+}
+
+// Context returns the span context of the span.
+func (s *Span) Context() (sc SpanContext) {
+	if s == nil {
+		return
+	}
+	return s.sc
+}
+
+// SetAttribute sets the attribute of the span, values of string, bool, integer and float
+// types are exported as is, others are formatted as strings.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]interface{})
+	}
+	s.attrs[key] = value
+}
+
+// End ends the span with the error of the operation, the span is exported only once.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	if s.ended {
+		s.Unlock()
+		return
+	}
+	s.ended = true
+	data := &SpanData{
+		Name:         s.name,
+		TraceID:      s.sc.TraceID,
+		SpanID:       s.sc.SpanID,
+		ParentSpanID: s.parent,
+		Start:        s.start,
+		End:          time.Now(),
+		Attributes:   s.attrs,
+	}
+	s.Unlock()
+	if err != nil {
+		data.Error = err.Error()
+	}
+	export(data)
+}
+
+func newTraceID() (t TraceID) {
+	for !t.IsValid() {
+		rand.Read(t[:])
+	}
+	return
+}
+
+func newSpanID() (s SpanID) {
+	for !s.IsValid() {
+		rand.Read(s[:])
+	}
+	return
+}
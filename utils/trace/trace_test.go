@@ -0,0 +1,168 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testExporter struct {
+	spans []*SpanData
+}
+
+func (e *testExporter) ExportSpans(spans []*SpanData) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *testExporter) Close() error {
+	return nil
+}
+
+func TestSpanContext(t *testing.T) {
+	Convey("test span context propagation", t, func() {
+		Stop()
+		ctx, span := StartSpan(context.Background(), "root")
+		So(span, ShouldBeNil)
+		So(SpanContextFromContext(ctx).IsValid(), ShouldBeFalse)
+		span.SetAttribute("k", "v")
+		span.End(nil)
+
+		StartWithExporter(&testExporter{}, 1)
+		defer Stop()
+		_, span = StartChildSpan(context.Background(), "child")
+		So(span, ShouldBeNil)
+
+		sc := SpanContext{TraceID: newTraceID(), SpanID: newSpanID()}
+		ctx = ContextWithSpanContext(context.Background(), sc)
+		var e proto.Envelope
+		Inject(ctx, &e)
+		So(e.TraceID, ShouldEqual, sc.TraceID.String())
+		So(e.SpanID, ShouldEqual, sc.SpanID.String())
+		So(SpanContextFromContext(Extract(context.Background(), &e)), ShouldResemble, sc)
+
+		// remote parent continues the trace even if tracing is not started locally
+		ctx, span = StartSpan(Extract(context.Background(), &e), "child")
+		So(span, ShouldNotBeNil)
+		So(span.Context().TraceID, ShouldEqual, sc.TraceID)
+		So(span.parent, ShouldEqual, sc.SpanID)
+		So(SpanContextFromContext(Detach(ctx)), ShouldResemble, span.Context())
+
+		// untrusted remote parent is sampled locally, the ids are propagated anyway
+		Stop()
+		ctx, span = StartSpan(ExtractUntrusted(context.Background(), &e), "child")
+		So(span, ShouldBeNil)
+		_, span = StartSpan(ctx, "grandchild")
+		So(span, ShouldBeNil)
+		var out proto.Envelope
+		Inject(ctx, &out)
+		So(out.TraceID, ShouldEqual, sc.TraceID.String())
+		So(out.SpanID, ShouldEqual, sc.SpanID.String())
+		StartWithExporter(&testExporter{}, 1)
+		ctx, span = StartSpan(ExtractUntrusted(context.Background(), &e), "child")
+		So(span, ShouldNotBeNil)
+		So(span.Context().TraceID, ShouldEqual, sc.TraceID)
+		So(span.parent, ShouldEqual, sc.SpanID)
+		_, span = StartSpan(ctx, "grandchild")
+		So(span, ShouldNotBeNil)
+
+		e.SpanID = "invalid"
+		So(SpanContextFromContext(Extract(context.Background(), &e)).IsValid(), ShouldBeFalse)
+		_, err := ParseTraceID(TraceID{}.String())
+		So(err, ShouldEqual, ErrInvalidTraceID)
+	})
+}
+
+func TestFileExporter(t *testing.T) {
+	Convey("test tracing to file", t, func() {
+		dir, err := ioutil.TempDir("", "trace")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "trace.json")
+
+		So(Start("test", &Config{}), ShouldEqual, ErrNoExporter)
+		So(Start("test", &Config{File: path}), ShouldBeNil)
+		ctx, root := StartSpan(context.Background(), "root")
+		So(root, ShouldNotBeNil)
+		_, child := StartSpan(ctx, "child")
+		child.SetAttribute("database", proto.DatabaseID("db"))
+		child.SetAttribute("count", 3)
+		child.End(errors.New("failed"))
+		root.End(nil)
+		root.End(nil)
+		Stop()
+
+		f, err := os.Open(path)
+		So(err, ShouldBeNil)
+		defer f.Close()
+		var spans []otlpSpan
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var traces otlpTraces
+			So(json.Unmarshal(scanner.Bytes(), &traces), ShouldBeNil)
+			So(*traces.ResourceSpans[0].Resource.Attributes[0].Value.StringValue, ShouldEqual, "test")
+			spans = append(spans, traces.ResourceSpans[0].ScopeSpans[0].Spans...)
+		}
+		So(spans, ShouldHaveLength, 2)
+		So(spans[0].Name, ShouldEqual, "child")
+		So(spans[0].TraceID, ShouldEqual, root.Context().TraceID.String())
+		So(spans[0].ParentSpanID, ShouldEqual, root.Context().SpanID.String())
+		So(spans[0].Status.Code, ShouldEqual, otlpStatusCodeError)
+		So(spans[0].Attributes, ShouldHaveLength, 2)
+		So(*spans[0].Attributes[0].Value.IntValue, ShouldEqual, "3")
+		So(*spans[0].Attributes[1].Value.StringValue, ShouldEqual, "db")
+		So(spans[1].Name, ShouldEqual, "root")
+		So(spans[1].ParentSpanID, ShouldBeEmpty)
+	})
+}
+
+func TestCollectorExporter(t *testing.T) {
+	Convey("test tracing to collector", t, func() {
+		received := make(chan otlpTraces, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			var traces otlpTraces
+			if err := json.NewDecoder(req.Body).Decode(&traces); err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			received <- traces
+		}))
+		defer srv.Close()
+
+		So(Start("test", &Config{Endpoint: srv.URL, File: "ignored"}), ShouldBeNil)
+		_, span := StartSpan(context.Background(), "root")
+		span.End(nil)
+		Stop()
+
+		traces := <-received
+		So(traces.ResourceSpans[0].ScopeSpans[0].Spans[0].Name, ShouldEqual, "root")
+
+		So(NewCollectorExporter("test", srv.URL+"/\x00").ExportSpans(nil), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultBatchSize defines the max spans exported in a batch.
+	DefaultBatchSize = 512
+	// DefaultFlushInterval defines the interval to export the pending spans.
+	DefaultFlushInterval = time.Second
+	// DefaultQueueSize defines the max pending spans, new spans are dropped if exceeded.
+	DefaultQueueSize = 4096
+)
+
+// ErrNoExporter indicates neither the trace file nor the collector endpoint is configured.
+var ErrNoExporter = errors.New("no trace exporter configured")
+
+// Config defines the tracing config.
+type Config struct {
+	// File is the path of the file to append the spans to in otlp json lines.
+	File string `yaml:"File,omitempty"`
+	// Endpoint is the otlp/http collector endpoint such as http://127.0.0.1:4318/v1/traces.
+	Endpoint string `yaml:"Endpoint,omitempty"`
+	// SampleRate is the ratio of the new traces sampled, all traces are sampled if not set. The
+	// traces continued from block producers and miners are always sampled, the rpc server starts
+	// new traces for the calls of clients.
+	SampleRate float64 `yaml:"SampleRate,omitempty"`
+}
+
+type tracer struct {
+	exporter   Exporter
+	sampleRate float64
+	spanCh     chan *SpanData
+	stopCh     chan struct{}
+	wg         sync.WaitGroup
+}
+
+var (
+	tracerLock    sync.RWMutex
+	currentTracer *tracer
+)
+
+// NewExporter returns the exporter of the config, the collector endpoint is preferred if
+// both the file and the endpoint are configured.
+func NewExporter(service string, cfg *Config) (e Exporter, err error) {
+	switch {
+	case cfg == nil:
+		err = ErrNoExporter
+	case cfg.Endpoint != "":
+		e = NewCollectorExporter(service, cfg.Endpoint)
+	case cfg.File != "":
+		e, err = NewFileExporter(service, cfg.File)
+	default:
+		err = ErrNoExporter
+	}
+	return
+}
+
+// Start starts tracing of the service with the config, the previous tracer is stopped.
+func Start(service string, cfg *Config) (err error) {
+	var e Exporter
+	if e, err = NewExporter(service, cfg); err != nil {
+		return
+	}
+	StartWithExporter(e, cfg.SampleRate)
+	log.WithFields(log.Fields{
+		"service":  service,
+		"file":     cfg.File,
+		"endpoint": cfg.Endpoint,
+	}).Info("tracing started")
+	return
+}
+
+// StartWithExporter starts tracing with the exporter, sampleRate in (0, 1) samples the new
+// traces randomly, others sample all.
+func StartWithExporter(e Exporter, sampleRate float64) {
+	if sampleRate <= 0 || sampleRate > 1 {
+		sampleRate = 1
+	}
+	t := &tracer{
+		exporter:   e,
+		sampleRate: sampleRate,
+		spanCh:     make(chan *SpanData, DefaultQueueSize),
+		stopCh:     make(chan struct{}),
+	}
+	t.wg.Add(1)
+	go t.run()
+
+	tracerLock.Lock()
+	prev := currentTracer
+	currentTracer = t
+	tracerLock.Unlock()
+	if prev != nil {
+		prev.stop()
+	}
+}
+
+// Stop stops tracing, the pending spans are exported before the exporter is closed.
+func Stop() {
+	tracerLock.Lock()
+	t := currentTracer
+	currentTracer = nil
+	tracerLock.Unlock()
+	if t != nil {
+		t.stop()
+	}
+}
+
+func sampleRoot() bool {
+	tracerLock.RLock()
+	defer tracerLock.RUnlock()
+	if currentTracer == nil {
+		return false
+	}
+	return currentTracer.sampleRate >= 1 || rand.Float64() < currentTracer.sampleRate
+}
+
+func export(s *SpanData) {
+	tracerLock.RLock()
+	defer tracerLock.RUnlock()
+	if currentTracer == nil {
+		return
+	}
+	select {
+	case currentTracer.spanCh <- s:
+	default:
+		log.WithField("span", s.Name).Debug("trace queue is full, span dropped")
+	}
+}
+
+func (t *tracer) run() {
+	defer t.wg.Done()
+	var (
+		batch = make([]*SpanData, 0, DefaultBatchSize)
+		tick  = time.NewTicker(DefaultFlushInterval)
+	)
+	defer tick.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.ExportSpans(batch); err != nil {
+			log.WithError(err).WithField("count", len(batch)).Warning("export spans failed")
+		}
+		batch = make([]*SpanData, 0, DefaultBatchSize)
+	}
+
+	for {
+		select {
+		case s := <-t.spanCh:
+			if batch = append(batch, s); len(batch) >= DefaultBatchSize {
+				flush()
+			}
+		case <-tick.C:
+			flush()
+		case <-t.stopCh:
+			// drain the queued spans
+			for {
+				select {
+				case s := <-t.spanCh:
+					if batch = append(batch, s); len(batch) >= DefaultBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *tracer) stop() {
+	close(t.stopCh)
+	t.wg.Wait()
+	if err := t.exporter.Close(); err != nil {
+		log.WithError(err).Warning("close trace exporter failed")
+	}
+}
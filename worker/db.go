@@ -22,6 +22,7 @@ import (
 
 	//"runtime/trace"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/crypto/kms"
@@ -67,6 +68,12 @@ type Database struct {
 	chain          *sqlchain.Chain
 	nodeID         proto.NodeID
 	mux            *DBKayakMuxService
+
+	// state sync of new replica
+	syncing    uint32
+	syncIndex  uint64
+	syncErr    atomic.Value // string
+	syncStopCh chan struct{}
 }
 
 // NewDatabase create a single database instance using config.
@@ -138,6 +145,8 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers, genesisBlock *types.Block) (
 		Period:   60 * time.Second,
 		Tick:     10 * time.Second,
 		QueryTTL: 10,
+
+		MaxQueryPatterns: cfg.MaxQueryPatterns,
 	}
 	if db.chain, err = sqlchain.NewChain(chainCfg); err != nil {
 		return
@@ -192,6 +201,11 @@ func (db *Database) UpdatePeers(peers *proto.Peers) (err error) {
 	return db.chain.UpdatePeers(peers)
 }
 
+// UpdateSpaceLimit changes the storage space limit of database, 0 for no limit.
+func (db *Database) UpdateSpaceLimit(limit uint64) {
+	atomic.StoreUint64(&db.cfg.SpaceLimit, limit)
+}
+
 // Query defines database query interface.
 func (db *Database) Query(request *types.Request) (response *types.Response, err error) {
 	// Just need to verify signature in db.saveAck
@@ -201,6 +215,10 @@ func (db *Database) Query(request *types.Request) (response *types.Response, err
 
 	switch request.Header.QueryType {
 	case types.ReadQuery:
+		if atomic.LoadUint32(&db.syncing) == 1 {
+			// state is not complete yet
+			return nil, ErrDatabaseSyncing
+		}
 		return db.chain.Query(request)
 	case types.WriteQuery:
 		return db.writeQuery(request)
@@ -210,6 +228,11 @@ func (db *Database) Query(request *types.Request) (response *types.Response, err
 	}
 }
 
+// QueryStats returns the query pattern statistics of the database.
+func (db *Database) QueryStats() []types.QueryStat {
+	return db.chain.QueryStats()
+}
+
 // Ack defines client response ack interface.
 func (db *Database) Ack(ack *types.Ack) (err error) {
 	// Just need to verify signature in db.saveAck
@@ -222,6 +245,15 @@ func (db *Database) Ack(ack *types.Ack) (err error) {
 
 // Shutdown stop database handles and stop service the database.
 func (db *Database) Shutdown() (err error) {
+	if db.syncStopCh != nil {
+		// stop state sync
+		select {
+		case <-db.syncStopCh:
+		default:
+			close(db.syncStopCh)
+		}
+	}
+
 	if db.kayakRuntime != nil {
 		// shutdown, stop kayak
 		if err = db.kayakRuntime.Shutdown(); err != nil {
@@ -256,6 +288,8 @@ func (db *Database) Shutdown() (err error) {
 		}
 	}
 
+	forgetQueries(db.dbID)
+
 	return
 }
 
@@ -278,7 +312,7 @@ func (db *Database) writeQuery(request *types.Request) (response *types.Response
 	//defer trace.StartRegion(ctx, "writeQueryRegion").End()
 
 	// check database size first, wal/kayak/chain database size is not included
-	if db.cfg.SpaceLimit > 0 {
+	if spaceLimit := atomic.LoadUint64(&db.cfg.SpaceLimit); spaceLimit > 0 {
 		path := filepath.Join(db.cfg.DataDir, StorageFileName)
 		var statInfo os.FileInfo
 		if statInfo, err = os.Stat(path); err != nil {
@@ -286,7 +320,7 @@ func (db *Database) writeQuery(request *types.Request) (response *types.Response
 				return
 			}
 		} else {
-			if uint64(statInfo.Size()) > db.cfg.SpaceLimit {
+			if uint64(statInfo.Size()) > spaceLimit {
 				// rejected
 				err = ErrSpaceLimitExceeded
 				return
@@ -32,4 +32,7 @@ type DBConfig struct {
 	MaxWriteTimeGap time.Duration
 	EncryptionKey   string
 	SpaceLimit      uint64
+
+	// MaxQueryPatterns is the capacity of the query pattern statistics table.
+	MaxQueryPatterns int
 }
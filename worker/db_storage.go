@@ -19,10 +19,10 @@ package worker
 import (
 	"bytes"
 	"container/list"
-	"context"
 
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils"
+	"github.com/CovenantSQL/CovenantSQL/utils/trace"
 	"github.com/pkg/errors"
 )
 
@@ -100,8 +100,8 @@ func (db *Database) Commit(rawReq interface{}) (result interface{}, err error) {
 		return
 	}
 
-	// reset context, commit should never be canceled
-	req.SetContext(context.Background())
+	// reset context, commit should never be canceled, but the trace is continued
+	req.SetContext(trace.Detach(req.GetContext()))
 
 	// execute
 	return db.chain.Query(req)
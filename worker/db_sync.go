@@ -0,0 +1,114 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"sync/atomic"
+	"time"
+
+	kt "github.com/CovenantSQL/CovenantSQL/kayak/types"
+	"github.com/CovenantSQL/CovenantSQL/route"
+	"github.com/CovenantSQL/CovenantSQL/rpc"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+const (
+	// SyncFetchLogs defines the logs to fetch in a single request during state sync.
+	SyncFetchLogs = 100
+
+	// SyncRetryInterval defines the interval to retry a failed state sync fetch.
+	SyncRetryInterval = time.Second
+)
+
+// startSync starts to sync state of the new replica from the leader.
+func (db *Database) startSync() {
+	atomic.StoreUint32(&db.syncing, 1)
+	db.syncStopCh = make(chan struct{})
+	go db.syncState()
+}
+
+// SyncStatus returns the state sync status of the database replica.
+func (db *Database) SyncStatus() (syncing bool, index uint64, syncErr string) {
+	syncing = atomic.LoadUint32(&db.syncing) == 1
+	index = atomic.LoadUint64(&db.syncIndex)
+	syncErr, _ = db.syncErr.Load().(string)
+	return
+}
+
+// syncState replays the kayak logs of the leader until the new replica catches up. The
+// leader serves the logs only after its peers are updated to include the new replica, all the
+// logs after that are sent to the new replica by the leader directly, so the replica is in
+// sync when the leader has no more logs to fetch.
+func (db *Database) syncState() {
+	defer atomic.StoreUint32(&db.syncing, 0)
+
+	caller := rpc.NewCaller()
+
+	for {
+		select {
+		case <-db.syncStopCh:
+			return
+		default:
+		}
+
+		index := atomic.LoadUint64(&db.syncIndex)
+		req := &kt.FetchRequest{
+			Instance: string(db.dbID),
+			Index:    index,
+			Limit:    SyncFetchLogs,
+		}
+		resp := &kt.FetchResponse{}
+		leader := db.kayakRuntime.Peers().Leader
+
+		err := caller.CallNode(leader, route.DBCFetch.String(), req, resp)
+		if err == nil {
+			for _, l := range resp.Logs {
+				if err = db.kayakRuntime.Replay(l); err != nil {
+					break
+				}
+				atomic.StoreUint64(&db.syncIndex, l.Index+1)
+			}
+		}
+
+		if err != nil {
+			// leader may not include this node in peers yet
+			log.WithFields(log.Fields{
+				"db":     db.dbID,
+				"leader": leader,
+				"index":  atomic.LoadUint64(&db.syncIndex),
+			}).WithError(err).Debug("sync database state failed")
+			db.syncErr.Store(err.Error())
+
+			select {
+			case <-db.syncStopCh:
+				return
+			case <-time.After(SyncRetryInterval):
+			}
+			continue
+		}
+
+		db.syncErr.Store("")
+
+		if len(resp.Logs) < SyncFetchLogs {
+			log.WithFields(log.Fields{
+				"db":    db.dbID,
+				"index": atomic.LoadUint64(&db.syncIndex),
+			}).Info("database state synced")
+			return
+		}
+	}
+}
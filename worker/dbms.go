@@ -206,13 +206,14 @@ func (dbms *DBMS) Create(instance *types.ServiceInstance, cleanup bool) (err err
 
 	// new db
 	dbCfg := &DBConfig{
-		DatabaseID:      instance.DatabaseID,
-		DataDir:         rootDir,
-		KayakMux:        dbms.kayakMux,
-		ChainMux:        dbms.chainMux,
-		MaxWriteTimeGap: dbms.cfg.MaxReqTimeGap,
-		EncryptionKey:   instance.ResourceMeta.EncryptionKey,
-		SpaceLimit:      instance.ResourceMeta.Space,
+		DatabaseID:       instance.DatabaseID,
+		DataDir:          rootDir,
+		KayakMux:         dbms.kayakMux,
+		ChainMux:         dbms.chainMux,
+		MaxWriteTimeGap:  dbms.cfg.MaxReqTimeGap,
+		EncryptionKey:    instance.ResourceMeta.EncryptionKey,
+		SpaceLimit:       instance.ResourceMeta.Space,
+		MaxQueryPatterns: dbms.cfg.MaxQueryPatterns,
 	}
 
 	if db, err = NewDatabase(dbCfg, instance.Peers, instance.GenesisBlock); err != nil {
@@ -243,7 +244,7 @@ func (dbms *DBMS) Drop(dbID proto.DatabaseID) (err error) {
 	return dbms.removeMeta(dbID)
 }
 
-// Update apply the new peers config to dbms.
+// Update apply the new peers config and resource limits to dbms.
 func (dbms *DBMS) Update(instance *types.ServiceInstance) (err error) {
 	var db *Database
 	var exists bool
@@ -253,7 +254,57 @@ func (dbms *DBMS) Update(instance *types.ServiceInstance) (err error) {
 	}
 
 	// update peers
-	return db.UpdatePeers(instance.Peers)
+	if err = db.UpdatePeers(instance.Peers); err != nil {
+		return
+	}
+
+	// update resource limits
+	db.UpdateSpaceLimit(instance.ResourceMeta.Space)
+
+	return
+}
+
+// Replicate add a new replica of existing database to the miner dbms, the replica syncs
+// database state from the leader.
+func (dbms *DBMS) Replicate(instance *types.ServiceInstance) (err error) {
+	if err = dbms.Create(instance, true); err != nil {
+		return
+	}
+
+	db, _ := dbms.getMeta(instance.DatabaseID)
+	db.startSync()
+
+	return
+}
+
+// SyncStatus returns the state sync status of the database replica.
+func (dbms *DBMS) SyncStatus(dbID proto.DatabaseID) (syncing bool, index uint64, syncErr string, err error) {
+	var db *Database
+	var exists bool
+
+	if db, exists = dbms.getMeta(dbID); !exists {
+		err = ErrNotExists
+		return
+	}
+
+	syncing, index, syncErr = db.SyncStatus()
+
+	return
+}
+
+// QueryStats returns the query pattern statistics of the database.
+func (dbms *DBMS) QueryStats(dbID proto.DatabaseID) (stats []types.QueryStat, err error) {
+	var db *Database
+	var exists bool
+
+	if db, exists = dbms.getMeta(dbID); !exists {
+		err = ErrNotExists
+		return
+	}
+
+	stats = db.QueryStats()
+
+	return
 }
 
 // Query handles query request in dbms.
@@ -32,4 +32,7 @@ type DBMSConfig struct {
 	RootDir       string
 	Server        *rpc.Server
 	MaxReqTimeGap time.Duration
+
+	// MaxQueryPatterns is the capacity of the query pattern statistics table of each database.
+	MaxQueryPatterns int
 }
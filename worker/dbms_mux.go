@@ -29,6 +29,9 @@ import (
 const (
 	// DBKayakMethodName defines the database kayak rpc method name.
 	DBKayakMethodName = "Call"
+
+	// MaxFetchLogs defines the max logs returned in a single fetch request.
+	MaxFetchLogs = 1000
 )
 
 // DBKayakMuxService defines a mux service for sqlchain kayak.
@@ -62,7 +65,24 @@ func (s *DBKayakMuxService) Call(req *kt.RPCRequest, _ *interface{}) (err error)
 	id := proto.DatabaseID(req.Instance)
 
 	if v, ok := s.serviceMap.Load(id); ok {
-		return v.(*kayak.Runtime).FollowerApply(req.Log)
+		return v.(*kayak.Runtime).FollowerApplyWithContext(req.GetContext(), req.Log)
+	}
+
+	return errors.Wrapf(ErrUnknownMuxRequest, "instance %v", req.Instance)
+}
+
+// Fetch handles kayak log fetch of a new peer to catch up.
+func (s *DBKayakMuxService) Fetch(req *kt.FetchRequest, resp *kt.FetchResponse) (err error) {
+	// treat req.Instance as DatabaseID
+	id := proto.DatabaseID(req.Instance)
+	limit := req.Limit
+	if limit <= 0 || limit > MaxFetchLogs {
+		limit = MaxFetchLogs
+	}
+
+	if v, ok := s.serviceMap.Load(id); ok {
+		resp.Logs, err = v.(*kayak.Runtime).Fetch(req.GetNodeID().ToNodeID(), req.Index, limit)
+		return
 	}
 
 	return errors.Wrapf(ErrUnknownMuxRequest, "instance %v", req.Instance)
@@ -19,10 +19,12 @@ package worker
 import (
 	//"context"
 	//"runtime/trace"
+	"time"
 
 	"github.com/CovenantSQL/CovenantSQL/route"
 	"github.com/CovenantSQL/CovenantSQL/rpc"
 	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/CovenantSQL/utils/trace"
 	"github.com/pkg/errors"
 	metrics "github.com/rcrowley/go-metrics"
 )
@@ -71,6 +73,26 @@ func (rpc *DBMSRPCService) Query(req *types.Request, res *types.Response) (err e
 		return
 	}
 
+	if !route.IsPermittedOnDatabase(&req.Envelope, route.DBSQuery, req.Header.DatabaseID) {
+		err = errors.Wrap(ErrInvalidRequest, "node not permitted for query request")
+		dbQueryFailCounter.Mark(1)
+		return
+	}
+
+	defer func(start time.Time) {
+		// check the database after query, the dropped database series are not recreated
+		_, served := rpc.dbms.getMeta(req.Header.DatabaseID)
+		recordQuery(req, served, start, err)
+	}(time.Now())
+
+	ctx, span := trace.StartSpan(req.GetContext(), "DBMS.Query")
+	span.SetAttribute("database", req.Header.DatabaseID)
+	span.SetAttribute("type", req.Header.QueryType)
+	defer func() {
+		span.End(err)
+	}()
+	req.SetContext(ctx)
+
 	var r *types.Response
 	if r, err = rpc.dbms.Query(req); err != nil {
 		dbQueryFailCounter.Mark(1)
@@ -100,6 +122,11 @@ func (rpc *DBMSRPCService) Ack(ack *types.Ack, _ *types.AckResponse) (err error)
 		return
 	}
 
+	if !route.IsPermittedOnDatabase(&ack.Envelope, route.DBSAck, ack.Header.Response.Request.DatabaseID) {
+		err = errors.Wrap(ErrInvalidRequest, "node not permitted for ack request")
+		return
+	}
+
 	// verification
 	err = rpc.dbms.Ack(ack)
 
@@ -127,7 +154,34 @@ func (rpc *DBMSRPCService) Deploy(req *types.UpdateService, _ *types.UpdateServi
 		err = rpc.dbms.Update(&req.Header.Instance)
 	case types.DropDB:
 		err = rpc.dbms.Drop(req.Header.Instance.DatabaseID)
+	case types.ReplicateDB:
+		err = rpc.dbms.Replicate(&req.Header.Instance)
+	}
+
+	return
+}
+
+// QueryStats rpc, called by client to get the query pattern statistics of database.
+func (rpc *DBMSRPCService) QueryStats(req *types.QueryStatsRequest, resp *types.QueryStatsResponse) (err error) {
+	if !route.IsPermittedOnDatabase(&req.Envelope, route.DBSQueryStats, req.DatabaseID) {
+		err = errors.Wrap(ErrInvalidRequest, "node not permitted for query stats request")
+		return
+	}
+
+	resp.Stats, err = rpc.dbms.QueryStats(req.DatabaseID)
+
+	return
+}
+
+// SyncStatus rpc, called by BP to query state sync progress of a new database replica.
+func (rpc *DBMSRPCService) SyncStatus(req *types.SyncStatusRequest, resp *types.SyncStatusResponse) (err error) {
+	// verify request node is block producer
+	if !route.IsPermitted(&req.Envelope, route.DBSSyncStatus) {
+		err = errors.Wrap(ErrInvalidRequest, "node not permitted for sync status request")
+		return
 	}
 
+	resp.Syncing, resp.Index, resp.Error, err = rpc.dbms.SyncStatus(req.DatabaseID)
+
 	return
 }
@@ -40,6 +40,9 @@ var (
 	// ErrSpaceLimitExceeded defines errors on disk space exceeding limit.
 	ErrSpaceLimitExceeded = errors.New("space limit exceeded")
 
+	// ErrDatabaseSyncing defines errors on reading a new replica which is still syncing state.
+	ErrDatabaseSyncing = errors.New("database replica is syncing")
+
 	// ErrUnknownMuxRequest indicates that the a multiplexing request endpoint is not found.
 	ErrUnknownMuxRequest = errors.New("unknown multiplexing request")
 )
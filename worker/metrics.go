@@ -0,0 +1,85 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// unknownDatabaseLabel is the database label of the queries on databases not served by the
+	// worker, which keeps the client supplied database ids out of the metric series.
+	unknownDatabaseLabel = "unknown"
+)
+
+var (
+	queryTypes = map[types.QueryType]string{
+		types.ReadQuery:  "read",
+		types.WriteQuery: "write",
+	}
+
+	dbQueryCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "covenantsql",
+		Subsystem: "db",
+		Name:      "queries_total",
+		Help:      "Number of the queries served by the database.",
+	}, []string{"database", "type", "result"})
+	dbQueryLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "covenantsql",
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Duration of the queries served by the database.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 18),
+	}, []string{"database", "type"})
+)
+
+func init() {
+	prometheus.MustRegister(dbQueryCount, dbQueryLatency)
+}
+
+// recordQuery records the result and latency of a query request on the database, the query
+// on a database not served by the worker is recorded with the unknown database label.
+func recordQuery(req *types.Request, served bool, start time.Time, err error) {
+	qt, ok := queryTypes[req.Header.QueryType]
+	if !ok {
+		return
+	}
+	dbID := unknownDatabaseLabel
+	if served {
+		dbID = string(req.Header.DatabaseID)
+	}
+	result := "succ"
+	if err != nil {
+		result = "fail"
+	}
+	dbQueryCount.WithLabelValues(dbID, qt, result).Inc()
+	dbQueryLatency.WithLabelValues(dbID, qt).Observe(time.Since(start).Seconds())
+}
+
+// forgetQueries removes the query series of the database.
+func forgetQueries(dbID proto.DatabaseID) {
+	for _, qt := range queryTypes {
+		for _, result := range []string{"succ", "fail"} {
+			dbQueryCount.DeleteLabelValues(string(dbID), qt, result)
+		}
+		dbQueryLatency.DeleteLabelValues(string(dbID), qt)
+	}
+}
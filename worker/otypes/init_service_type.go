@@ -79,7 +79,7 @@ func (sh *SignedInitServiceResponseHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedInitServiceResponseHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedInitServiceResponseHeader) Sign(signer asymmetric.Signer) (err error) {
 	// build hash
 	if err = buildHash(&sh.InitServiceResponseHeader, &sh.Hash); err != nil {
 		return
@@ -98,7 +98,7 @@ func (rs *InitServiceResponse) Verify() error {
 }
 
 // Sign the request.
-func (rs *InitServiceResponse) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (rs *InitServiceResponse) Sign(signer asymmetric.Signer) (err error) {
 	// sign
 	return rs.Header.Sign(signer)
 }
@@ -87,7 +87,7 @@ func (sh *SignedNoAckReportHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedNoAckReportHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedNoAckReportHeader) Sign(signer asymmetric.Signer) (err error) {
 	// verify original response
 	if err = sh.Response.Verify(); err != nil {
 		return
@@ -111,7 +111,7 @@ func (r *NoAckReport) Verify() error {
 }
 
 // Sign the request.
-func (r *NoAckReport) Sign(signer *asymmetric.PrivateKey) error {
+func (r *NoAckReport) Sign(signer asymmetric.Signer) error {
 	return r.Header.Sign(signer)
 }
 
@@ -135,7 +135,7 @@ func (sh *SignedAggrNoAckReportHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedAggrNoAckReportHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedAggrNoAckReportHeader) Sign(signer asymmetric.Signer) (err error) {
 	for _, r := range sh.Reports {
 		if err = r.Verify(); err != nil {
 			return
@@ -160,6 +160,6 @@ func (r *AggrNoAckReport) Verify() (err error) {
 }
 
 // Sign the request.
-func (r *AggrNoAckReport) Sign(signer *asymmetric.PrivateKey) error {
+func (r *AggrNoAckReport) Sign(signer asymmetric.Signer) error {
 	return r.Header.Sign(signer)
 }
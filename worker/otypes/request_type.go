@@ -112,7 +112,7 @@ func (sh *SignedRequestHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedRequestHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedRequestHeader) Sign(signer asymmetric.Signer) (err error) {
 	// compute hash
 	if err = buildHash(&sh.RequestHeader, &sh.Hash); err != nil {
 		return
@@ -140,7 +140,7 @@ func (r *Request) Verify() (err error) {
 }
 
 // Sign the request.
-func (r *Request) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (r *Request) Sign(signer asymmetric.Signer) (err error) {
 	// set query count
 	r.Header.BatchCount = uint64(len(r.Payload.Queries))
 
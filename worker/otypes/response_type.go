@@ -84,7 +84,7 @@ func (sh *SignedResponseHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedResponseHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedResponseHeader) Sign(signer asymmetric.Signer) (err error) {
 	// make sure original header is signed
 	if err = sh.Request.Verify(); err != nil {
 		err = errors.Wrapf(err, "SignedResponseHeader %v", sh)
@@ -114,7 +114,7 @@ func (sh *Response) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *Response) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *Response) Sign(signer asymmetric.Signer) (err error) {
 	// set rows count
 	sh.Header.RowCount = uint64(len(sh.Payload.Rows))
 
@@ -73,7 +73,7 @@ func (sh *SignedUpdateServiceHeader) Verify() (err error) {
 }
 
 // Sign the request.
-func (sh *SignedUpdateServiceHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (sh *SignedUpdateServiceHeader) Sign(signer asymmetric.Signer) (err error) {
 	// build hash
 	if err = buildHash(&sh.UpdateServiceHeader, &sh.Hash); err != nil {
 		return
@@ -92,7 +92,7 @@ func (s *UpdateService) Verify() error {
 }
 
 // Sign the request.
-func (s *UpdateService) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (s *UpdateService) Sign(signer asymmetric.Signer) (err error) {
 	// sign
 	return s.Header.Sign(signer)
 }
@@ -51,7 +51,7 @@ type blockNode struct {
 type Chain struct {
 	state *State
 	// Cached fields
-	priv *ca.PrivateKey
+	priv ca.Signer
 }
 
 // NewChain returns new chain instance.
@@ -59,7 +59,7 @@ func NewChain(filename string) (c *Chain, err error) {
 	var (
 		strg  xi.Storage
 		state *State
-		priv  *ca.PrivateKey
+		priv  ca.Signer
 	)
 	// generate empty nodeId
 	nodeID := proto.NodeID("0000000000000000000000000000000000000000000000000000000000000000")
@@ -71,7 +71,7 @@ func NewChain(filename string) (c *Chain, err error) {
 	if state, err = NewState(nodeID, strg); err != nil {
 		return
 	}
-	if priv, err = kms.GetLocalPrivateKey(); err != nil {
+	if priv, err = kms.GetLocalSigner(); err != nil {
 		return
 	}
 	c = &Chain{
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/utils/log"
+)
+
+// maxSlowQueryLength is the max length of the query recorded in the slow query log.
+const maxSlowQueryLength = 4096
+
+// slowQueryRecord is a line of the slow query log.
+type slowQueryRecord struct {
+	Time        time.Time        `json:"time"`
+	Database    proto.DatabaseID `json:"db,omitempty"`
+	Client      proto.NodeID     `json:"client"`
+	Type        string           `json:"type"`
+	Latency     float64          `json:"latency"` // in seconds
+	RowsRead    int64            `json:"rows_read"`
+	RowsWritten int64            `json:"rows_written"`
+	Fingerprint string           `json:"fingerprint"`
+	Query       string           `json:"query"`
+	Error       string           `json:"error,omitempty"`
+}
+
+var slowQueryLog struct {
+	sync.Mutex
+	file *os.File
+	// threshold is accessed atomically, 0 if the slow query log is disabled.
+	threshold int64
+}
+
+// SetSlowQueryLog appends the statements which take longer than 'threshold' to the file at
+// 'path' as json lines, an empty path or a non-positive threshold disables the slow query log.
+func SetSlowQueryLog(path string, threshold time.Duration) (err error) {
+	var file *os.File
+	if path != "" && threshold > 0 {
+		if file, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600); err != nil {
+			return
+		}
+	} else {
+		threshold = 0
+	}
+	slowQueryLog.Lock()
+	defer slowQueryLog.Unlock()
+	if slowQueryLog.file != nil {
+		slowQueryLog.file.Close()
+	}
+	slowQueryLog.file = file
+	atomic.StoreInt64(&slowQueryLog.threshold, int64(threshold))
+	return
+}
+
+func isSlowQuery(latency time.Duration) bool {
+	threshold := atomic.LoadInt64(&slowQueryLog.threshold)
+	return threshold > 0 && int64(latency) >= threshold
+}
+
+func logSlowQuery(record *slowQueryRecord) {
+	if len(record.Query) > maxSlowQueryLength {
+		record.Query = record.Query[:maxSlowQueryLength]
+	}
+	slowQueryLog.Lock()
+	defer slowQueryLog.Unlock()
+	if slowQueryLog.file == nil {
+		return
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	if _, err = slowQueryLog.file.Write(append(data, '\n')); err != nil {
+		log.WithError(err).Error("write slow query log failed")
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/CovenantSQL/CovenantSQL/proto"
 	"github.com/CovenantSQL/CovenantSQL/types"
 	"github.com/CovenantSQL/CovenantSQL/utils/log"
+	"github.com/CovenantSQL/CovenantSQL/utils/trace"
 	xi "github.com/CovenantSQL/CovenantSQL/xenomint/interfaces"
 	"github.com/CovenantSQL/sqlparser"
 	"github.com/pkg/errors"
@@ -41,6 +42,10 @@ type State struct {
 	closed bool
 	nodeID proto.NodeID
 
+	// query pattern statistics
+	databaseID proto.DatabaseID
+	stats      *queryStats
+
 	// TODO(leventeliu): Reload savepoint from last block on chain initialization, and rollback
 	// any ongoing transaction on exit.
 	//
@@ -58,6 +63,7 @@ func NewState(nodeID proto.NodeID, strg xi.Storage) (s *State, err error) {
 		nodeID: nodeID,
 		strg:   strg,
 		pool:   newPool(),
+		stats:  newQueryStats(DefaultMaxQueryPatterns),
 	}
 	if t.unc, err = t.strg.Writer().Begin(); err != nil {
 		return
@@ -98,6 +104,44 @@ func (s *State) getID() uint64 {
 	return atomic.LoadUint64(&s.current)
 }
 
+// InitQueryStats sets the database id of the slow query log records and the capacity of the
+// query pattern statistics table. This method is not safe for concurrency and should only be
+// called at initialization.
+func (s *State) InitQueryStats(dbID proto.DatabaseID, maxPatterns int) {
+	s.databaseID = dbID
+	s.stats = newQueryStats(maxPatterns)
+}
+
+// QueryStats returns the query pattern statistics sorted by total latency in descending order.
+func (s *State) QueryStats() []types.QueryStat {
+	return s.stats.list()
+}
+
+func (s *State) recordQuery(
+	req *types.Request, q *types.Query, latency time.Duration, rowsRead, rowsWritten int64, err error,
+) {
+	var fp = fingerprint(q.Pattern)
+	s.stats.record(fp, latency, rowsRead, rowsWritten, err != nil)
+	if !isSlowQuery(latency) {
+		return
+	}
+	record := &slowQueryRecord{
+		Time:        time.Now().UTC(),
+		Database:    s.databaseID,
+		Client:      req.Header.NodeID,
+		Type:        req.Header.QueryType.String(),
+		Latency:     latency.Seconds(),
+		RowsRead:    rowsRead,
+		RowsWritten: rowsWritten,
+		Fingerprint: fp,
+		Query:       q.Pattern,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	logSlowQuery(record)
+}
+
 // Close commits any ongoing transaction if needed and closes the underlying storage.
 func (s *State) Close(commit bool) (err error) {
 	if s.closed {
@@ -275,7 +319,10 @@ func (s *State) readWithContext(
 	)
 	// TODO(leventeliu): no need to run every read query here.
 	for i, v := range req.Payload.Queries {
-		if cnames, ctypes, data, ierr = readSingle(ctx, s.strg.DirtyReader(), &v); ierr != nil {
+		start := time.Now()
+		cnames, ctypes, data, ierr = readSingle(ctx, s.strg.DirtyReader(), &v)
+		s.recordQuery(req, &v, time.Since(start), int64(len(data)), 0, ierr)
+		if ierr != nil {
 			err = errors.Wrapf(ierr, "query at #%d failed", i)
 			// Add to failed pool list
 			s.pool.setFailed(req)
@@ -345,7 +392,10 @@ func (s *State) readTx(
 	}()
 
 	for i, v := range req.Payload.Queries {
-		if cnames, ctypes, data, ierr = readSingle(ctx, querier, &v); ierr != nil {
+		start := time.Now()
+		cnames, ctypes, data, ierr = readSingle(ctx, querier, &v)
+		s.recordQuery(req, &v, time.Since(start), int64(len(data)), 0, ierr)
+		if ierr != nil {
 			err = errors.Wrapf(ierr, "query at #%d failed", i)
 			// Add to failed pool list
 			s.pool.setFailed(req)
@@ -429,8 +479,12 @@ func (s *State) write(
 		defer s.Unlock()
 		savepoint = s.getID()
 		for i, v := range req.Payload.Queries {
-			var res sql.Result
+			var (
+				res   sql.Result
+				start = time.Now()
+			)
 			if res, ierr = s.writeSingle(ctx, &v); ierr != nil {
+				s.recordQuery(req, &v, time.Since(start), 0, 0, ierr)
 				err = errors.Wrapf(ierr, "execute at #%d failed", i)
 				// Add to failed pool list
 				s.pool.setFailed(req)
@@ -441,6 +495,7 @@ func (s *State) write(
 			curAffectedRows, _ = res.RowsAffected()
 			lastInsertID, _ = res.LastInsertId()
 			totalAffectedRows += curAffectedRows
+			s.recordQuery(req, &v, time.Since(start), 0, curAffectedRows, nil)
 		}
 		s.setSavepoint()
 		s.pool.enqueue(savepoint, query)
@@ -595,6 +650,11 @@ func (s *State) CommitEx() (failed []*types.Request, queries []*QueryTracker, er
 func (s *State) CommitExWithContext(
 	ctx context.Context) (failed []*types.Request, queries []*QueryTracker, err error,
 ) {
+	_, span := trace.StartChildSpan(ctx, "xenomint.CommitEx")
+	defer func() {
+		span.SetAttribute("queries", len(queries))
+		span.End(err)
+	}()
 	s.Lock()
 	defer s.Unlock()
 	if err = s.uncCommit(); err != nil {
@@ -647,6 +707,13 @@ func (s *State) Query(req *types.Request) (ref *QueryTracker, resp *types.Respon
 func (s *State) QueryWithContext(
 	ctx context.Context, req *types.Request) (ref *QueryTracker, resp *types.Response, err error,
 ) {
+	ctx, span := trace.StartChildSpan(ctx, "xenomint.Query")
+	span.SetAttribute("type", req.Header.QueryType)
+	span.SetAttribute("count", len(req.Payload.Queries))
+	defer func() {
+		span.End(err)
+	}()
+
 	switch req.Header.QueryType {
 	case types.ReadQuery:
 		return s.readTx(ctx, req)
@@ -677,7 +744,11 @@ func (s *State) ReplayWithContext(
 	case types.ReadQuery:
 		return
 	case types.WriteQuery:
-		return s.replay(ctx, req, resp)
+		ctx, span := trace.StartChildSpan(ctx, "xenomint.Replay")
+		span.SetAttribute("count", len(req.Payload.Queries))
+		err = s.replay(ctx, req, resp)
+		span.End(err)
+		return
 	default:
 		err = ErrInvalidRequest
 	}
@@ -0,0 +1,193 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"container/list"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/types"
+	"github.com/CovenantSQL/sqlparser"
+)
+
+const (
+	// DefaultMaxQueryPatterns defines the default capacity of the query pattern statistics
+	// table of a State, the least recently seen pattern is evicted if the table is full.
+	DefaultMaxQueryPatterns = 1000
+
+	// maxFingerprintLength is the max length of a query fingerprint, longer fingerprints are
+	// truncated.
+	maxFingerprintLength = 2048
+)
+
+// operators are the multi-char operators which are scanned without the token text.
+var operators = map[int]string{
+	sqlparser.LE:                 "<=",
+	sqlparser.GE:                 ">=",
+	sqlparser.NE:                 "!=",
+	sqlparser.NULL_SAFE_NOTEQUAL: "<>",
+	sqlparser.SHIFT_LEFT:         "<<",
+	sqlparser.SHIFT_RIGHT:        ">>",
+}
+
+// fingerprint normalizes the query pattern: literals and arguments are replaced by "?",
+// value lists are collapsed to a single "?", repeated value tuples such as (?), (?) are
+// collapsed to a single (?), keywords are upper-cased and the comments are stripped.
+func fingerprint(pattern string) string {
+	var (
+		tokenizer = sqlparser.NewStringTokenizer(pattern)
+		tokens    = make([]string, 0, 16)
+		length    int
+	)
+	for length < maxFingerprintLength {
+		typ, val := tokenizer.Scan()
+		var token string
+		switch typ {
+		case 0:
+			return joinTokens(tokens)
+		case sqlparser.LEX_ERROR:
+			// not a valid query, use the whitespace collapsed query instead
+			return truncate(strings.Join(strings.Fields(pattern), " "))
+		case sqlparser.COMMENT:
+			continue
+		case sqlparser.STRING, sqlparser.INTEGRAL, sqlparser.FLOAT, sqlparser.HEX, sqlparser.HEXNUM,
+			sqlparser.VALUE_ARG, sqlparser.LIST_ARG:
+			// collapse value list such as (?, ?, ?) to (?)
+			if n := len(tokens); n >= 2 && tokens[n-1] == "," && tokens[n-2] == "?" {
+				tokens = tokens[:n-1]
+				continue
+			}
+			token = "?"
+		case sqlparser.ID:
+			token = string(val)
+		default:
+			if val != nil {
+				token = strings.ToUpper(string(val))
+			} else if op, ok := operators[typ]; ok {
+				token = op
+			} else if typ < 256 {
+				token = string(rune(typ))
+			} else {
+				token = strings.ToUpper(sqlparser.KeywordString(typ))
+			}
+		}
+		// collapse repeated value tuples such as (?), (?) to (?)
+		if n := len(tokens); token == ")" && n >= 6 && tokens[n-1] == "?" && tokens[n-2] == "(" &&
+			tokens[n-3] == "," && tokens[n-4] == ")" && tokens[n-5] == "?" && tokens[n-6] == "(" {
+			tokens = tokens[:n-3]
+			continue
+		}
+		tokens = append(tokens, token)
+		length += len(token) + 1
+	}
+	return truncate(joinTokens(tokens))
+}
+
+func joinTokens(tokens []string) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 {
+			switch prev := tokens[i-1]; {
+			case t == "," || t == ")" || t == "." || t == ";":
+			case prev == "(" || prev == ".":
+			default:
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(t)
+	}
+	return b.String()
+}
+
+func truncate(s string) string {
+	if len(s) > maxFingerprintLength {
+		return s[:maxFingerprintLength]
+	}
+	return s
+}
+
+// queryStats is a bounded table of the query pattern statistics.
+type queryStats struct {
+	sync.Mutex
+	max     int
+	entries map[string]*list.Element
+	// lru holds the *types.QueryStat items, the most recently seen item is in front.
+	lru *list.List
+}
+
+func newQueryStats(max int) *queryStats {
+	if max <= 0 {
+		max = DefaultMaxQueryPatterns
+	}
+	return &queryStats{
+		max:     max,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (s *queryStats) record(
+	fp string, latency time.Duration, rowsRead, rowsWritten int64, failed bool,
+) {
+	s.Lock()
+	defer s.Unlock()
+	var stat *types.QueryStat
+	if e, ok := s.entries[fp]; ok {
+		s.lru.MoveToFront(e)
+		stat = e.Value.(*types.QueryStat)
+	} else {
+		if s.lru.Len() >= s.max {
+			last := s.lru.Back()
+			s.lru.Remove(last)
+			delete(s.entries, last.Value.(*types.QueryStat).Fingerprint)
+		}
+		stat = &types.QueryStat{Fingerprint: fp}
+		s.entries[fp] = s.lru.PushFront(stat)
+	}
+	stat.Count++
+	if failed {
+		stat.Errors++
+	}
+	stat.TotalLatency += latency
+	if latency > stat.MaxLatency {
+		stat.MaxLatency = latency
+	}
+	if rowsRead > 0 {
+		stat.RowsRead += uint64(rowsRead)
+	}
+	if rowsWritten > 0 {
+		stat.RowsWritten += uint64(rowsWritten)
+	}
+	stat.LastSeen = time.Now().UTC()
+}
+
+// list returns a copy of the statistics sorted by total latency in descending order.
+func (s *queryStats) list() (stats []types.QueryStat) {
+	s.Lock()
+	stats = make([]types.QueryStat, 0, s.lru.Len())
+	for e := s.lru.Front(); e != nil; e = e.Next() {
+		stats = append(stats, *e.Value.(*types.QueryStat))
+	}
+	s.Unlock()
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].TotalLatency > stats[j].TotalLatency
+	})
+	return
+}
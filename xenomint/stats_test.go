@@ -0,0 +1,156 @@
+/*
+ * Copyright 2018 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/CovenantSQL/CovenantSQL/proto"
+	"github.com/CovenantSQL/CovenantSQL/types"
+	xs "github.com/CovenantSQL/CovenantSQL/xenomint/sqlite"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFingerprint(t *testing.T) {
+	Convey("Given some queries with literals", t, func() {
+		So(fingerprint("select * from t1 where k = 1 and v = 'a'"),
+			ShouldEqual, "SELECT * FROM t1 WHERE k = ? AND v = ?")
+		So(fingerprint("SELECT *  FROM t1\n WHERE k = ? -- comment"),
+			ShouldEqual, "SELECT * FROM t1 WHERE k = ?")
+		So(fingerprint("INSERT INTO t1 (k, v) VALUES (1, 'a'), (2, 'b')"),
+			ShouldEqual, "INSERT INTO t1 (k, v) VALUES (?)")
+		So(fingerprint("INSERT INTO t1 (k, v) VALUES (1, 'a'), (2, 'b'), (3, 'c')"),
+			ShouldEqual, fingerprint("insert into t1 (k, v) values (4, 'd')"))
+		So(fingerprint("INSERT INTO t1 (k, v) VALUES (1, 'a'), (2, now())"),
+			ShouldEqual, "INSERT INTO t1 (k, v) VALUES (?), (?, now ())")
+		So(fingerprint("SELECT v FROM t1 WHERE k IN (1, 2, 3) AND k >= :k"),
+			ShouldEqual, "SELECT v FROM t1 WHERE k IN (?) AND k >= ?")
+		So(fingerprint("SELECT v FROM t1 WHERE k IN (4)"),
+			ShouldEqual, fingerprint("select v from t1 where k in (5, 6)"))
+		So(fingerprint("SELECT `t1`.`v` FROM `t1`"), ShouldEqual, "SELECT t1.v FROM t1")
+		So(len(fingerprint(fmt.Sprintf("SELECT %0*d", maxFingerprintLength*2, 0))),
+			ShouldBeLessThanOrEqualTo, maxFingerprintLength)
+	})
+}
+
+func TestQueryStats(t *testing.T) {
+	Convey("Given a bounded query stats table", t, func() {
+		var s = newQueryStats(2)
+		s.record("q1", time.Second, 10, 0, false)
+		s.record("q1", 3*time.Second, 5, 0, true)
+		s.record("q2", 5*time.Second, 0, 1, false)
+		stats := s.list()
+		So(stats, ShouldHaveLength, 2)
+		So(stats[0].Fingerprint, ShouldEqual, "q2")
+		So(stats[1].Fingerprint, ShouldEqual, "q1")
+		So(stats[1].Count, ShouldEqual, 2)
+		So(stats[1].Errors, ShouldEqual, 1)
+		So(stats[1].TotalLatency, ShouldEqual, 4*time.Second)
+		So(stats[1].MaxLatency, ShouldEqual, 3*time.Second)
+		So(stats[1].AvgLatency(), ShouldEqual, 2*time.Second)
+		So(stats[1].RowsRead, ShouldEqual, 15)
+		So(stats[0].RowsWritten, ShouldEqual, 1)
+		Convey("The least recently seen pattern should be evicted", func() {
+			s.record("q1", time.Second, 0, 0, false)
+			s.record("q3", time.Second, 0, 0, false)
+			stats = s.list()
+			So(stats, ShouldHaveLength, 2)
+			So(stats[0].Fingerprint, ShouldEqual, "q1")
+			So(stats[1].Fingerprint, ShouldEqual, "q3")
+		})
+	})
+}
+
+func TestStateQueryStats(t *testing.T) {
+	Convey("Given a chain state object with slow query log", t, func() {
+		var (
+			fl      = path.Join(testingDataDir, t.Name())
+			slowLog = path.Join(testingDataDir, fmt.Sprint(t.Name(), ".slow.log"))
+			nodeID  = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000000")
+			st      *State
+			err     error
+		)
+		strg, err := xs.NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		st, err = NewState(nodeID, strg)
+		So(err, ShouldBeNil)
+		st.InitQueryStats("db-stats", 10)
+		err = SetSlowQueryLog(slowLog, time.Nanosecond)
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = SetSlowQueryLog("", 0)
+			So(err, ShouldBeNil)
+			err = st.Close(true)
+			So(err, ShouldBeNil)
+			os.Remove(fl)
+			os.Remove(fmt.Sprint(fl, "-shm"))
+			os.Remove(fmt.Sprint(fl, "-wal"))
+			os.Remove(slowLog)
+		})
+
+		_, _, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+			buildQuery(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`),
+			buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, 1, "v1"),
+			buildQuery(`INSERT INTO t1 (k, v) VALUES (?, ?)`, 2, "v2"),
+		}))
+		So(err, ShouldBeNil)
+		_, _, err = st.Query(buildRequest(types.ReadQuery, []types.Query{
+			buildQuery(`SELECT v FROM t1 WHERE k > 0`),
+		}))
+		So(err, ShouldBeNil)
+		_, _, err = st.Query(buildRequest(types.ReadQuery, []types.Query{
+			buildQuery(`SELECT v FROM t2`),
+		}))
+		So(err, ShouldNotBeNil)
+
+		Convey("The query patterns should be recorded", func() {
+			var stats = make(map[string]types.QueryStat)
+			for _, v := range st.QueryStats() {
+				stats[v.Fingerprint] = v
+			}
+			So(stats, ShouldHaveLength, 4)
+			So(stats["INSERT INTO t1 (k, v) VALUES (?)"].Count, ShouldEqual, 2)
+			So(stats["INSERT INTO t1 (k, v) VALUES (?)"].RowsWritten, ShouldEqual, 2)
+			So(stats["SELECT v FROM t1 WHERE k > ?"].RowsRead, ShouldEqual, 2)
+			So(stats["SELECT v FROM t2"].Errors, ShouldEqual, 1)
+		})
+		Convey("The slow queries should be logged", func() {
+			f, err := os.Open(slowLog)
+			So(err, ShouldBeNil)
+			defer f.Close()
+			var (
+				scanner = bufio.NewScanner(f)
+				records []*slowQueryRecord
+			)
+			for scanner.Scan() {
+				var r = &slowQueryRecord{}
+				So(json.Unmarshal(scanner.Bytes(), r), ShouldBeNil)
+				records = append(records, r)
+			}
+			So(records, ShouldHaveLength, 5)
+			So(records[0].Database, ShouldEqual, "db-stats")
+			So(records[1].Query, ShouldEqual, `INSERT INTO t1 (k, v) VALUES (?, ?)`)
+			So(records[4].Error, ShouldNotBeEmpty)
+		})
+	})
+}
@@ -45,7 +45,7 @@ type SignedBlockHeader struct {
 }
 
 // Sign signs the block header.
-func (h *SignedBlockHeader) Sign(signer *asymmetric.PrivateKey) error {
+func (h *SignedBlockHeader) Sign(signer asymmetric.Signer) error {
 	return h.DefaultHashSignVerifierImpl.Sign(&h.BlockHeader, signer)
 }
 
@@ -62,7 +62,7 @@ type Block struct {
 }
 
 // Sign signs the block.
-func (b *Block) Sign(signer *asymmetric.PrivateKey) (err error) {
+func (b *Block) Sign(signer asymmetric.Signer) (err error) {
 	// Update header fields: generate merkle root from queries
 	var hashes []*hash.Hash
 	for _, v := range b.ReadQueries {
@@ -43,7 +43,7 @@ func (i *DefaultHashSignVerifierImpl) Hash() hash.Hash {
 
 // Sign implements hashSignVerifier.Sign.
 func (i *DefaultHashSignVerifierImpl) Sign(
-	obj marshalHasher, signer *asymmetric.PrivateKey) (err error,
+	obj marshalHasher, signer asymmetric.Signer) (err error,
 ) {
 	var enc []byte
 	if enc, err = obj.MarshalHash(); err != nil {